@@ -8,8 +8,11 @@ import (
 	"os/signal"
 	"runtime/debug"
 	"syscall"
+	"time"
 
 	"github.com/mushorg/glutton"
+	"github.com/mushorg/glutton/audit"
+	"github.com/mushorg/glutton/transcript"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -41,6 +44,11 @@ func main() {
 	pflag.BoolP("debug", "d", false, "Enable debug mode")
 	pflag.Bool("version", false, "Print version")
 	pflag.String("var-dir", "/var/lib/glutton", "Set var-dir")
+	pflag.Bool("audit", false, "Audit the protocol handlers for detectable traits and exit")
+	pflag.StringSlice("audit-handlers", nil, "Limit the audit to these handlers")
+	pflag.Float64("replay-speed", 1, "Speed up the replay of a transcript by this factor")
+	pflag.String("replay-direction", "both", "Replay the bytes sent in by the client, out by glutton or both")
+	pflag.Duration("replay-idle-limit", 2*time.Second, "Cut pauses in a replayed transcript to this long, 0 keeps them")
 
 	pflag.Parse()
 	viper.BindPFlags(pflag.CommandLine)
@@ -53,11 +61,34 @@ func main() {
 		return
 	}
 
+	if viper.GetBool("audit") {
+		report, err := audit.Run(context.Background(), viper.GetStringSlice("audit-handlers")...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(report)
+		return
+	}
+
 	g, err := glutton.New(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if pflag.Arg(0) == "replay-dlq" {
+		if err := g.ReplayDeadLetters(); err != nil {
+			log.Fatal("Failed to replay dead letters:", err)
+		}
+		return
+	}
+
+	if pflag.Arg(0) == "replay" {
+		if err := replay(pflag.Arg(1)); err != nil {
+			log.Fatal("Failed to replay transcript:", err)
+		}
+		return
+	}
+
 	if err := g.Init(); err != nil {
 		log.Fatal("Failed to initialize Glutton:", err)
 	}
@@ -87,3 +118,27 @@ func main() {
 		log.Fatal("Failed to start Glutton server:", err)
 	}
 }
+
+// replay plays the transcript of session id back to stdout
+func replay(id string) error {
+	if id == "" {
+		return fmt.Errorf("usage: glutton replay <session-id>")
+	}
+	t, err := transcript.Load(viper.GetString("transcripts.dir"), id)
+	if err != nil {
+		return err
+	}
+	var dirs []string
+	switch direction := viper.GetString("replay-direction"); direction {
+	case "both":
+		dirs = []string{transcript.In, transcript.Out}
+	case "in":
+		dirs = []string{transcript.In}
+	case "out":
+		dirs = []string{transcript.Out}
+	default:
+		return fmt.Errorf("invalid replay direction: %s", direction)
+	}
+	fmt.Fprintf(os.Stderr, "%s session from %s to port %d at %s\n\n", t.Handler, t.Src, t.DstPort, t.Started.Format(time.RFC3339))
+	return transcript.Play(os.Stdout, t, dirs, viper.GetFloat64("replay-speed"), viper.GetDuration("replay-idle-limit"))
+}
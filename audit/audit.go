@@ -0,0 +1,199 @@
+// Package audit replays sessions against the protocol handlers and reports
+// response traits that make the honeypot easy to fingerprint
+package audit
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mushorg/glutton/protocols"
+)
+
+const (
+	// banners sent faster than this are unlike a real service
+	instantBanner = 5 * time.Millisecond
+	// banner latency spread below this across sessions looks synthetic
+	uniformSpread = 2 * time.Millisecond
+	// sessions replayed per handler for the timing checks
+	samples = 3
+)
+
+// probe describes how to audit a single handler
+type probe struct {
+	name string
+	// key of the handler in the protocol handler map
+	handler string
+	port    uint16
+	// banner the server must send before any input, empty for client-first protocols
+	banner *regexp.Regexp
+	// input a real server rejects and the response it rejects it with
+	invalid  []byte
+	rejected *regexp.Regexp
+}
+
+var versionPattern = regexp.MustCompile(`\d+\.\d+`)
+
+var probes = []probe{
+	{
+		name:     "smtp",
+		handler:  "smtp",
+		port:     25,
+		banner:   regexp.MustCompile(`^220 \S+ .*E?SMTP`),
+		invalid:  []byte("XYZZY\r\n"),
+		rejected: regexp.MustCompile(`^50[0-2] `),
+	},
+	{
+		name:     "ftp",
+		handler:  "ftp",
+		port:     21,
+		banner:   regexp.MustCompile(`^220[ -]`),
+		invalid:  []byte("XYZZY\r\n"),
+		rejected: regexp.MustCompile(`^50[0-2] `),
+	},
+	{
+		name:     "http",
+		handler:  "tcp",
+		port:     80,
+		invalid:  []byte("GET / HTTP/9.9\r\nHost: localhost\r\n\r\n"),
+		rejected: regexp.MustCompile(`^HTTP/1\.[01] (400|505) `),
+	},
+}
+
+// Finding is a single detectable trait of a handler
+type Finding struct {
+	Handler string
+	Issue   string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s (detectable)", strings.ToUpper(f.Handler), f.Issue)
+}
+
+// Report holds the findings of an audit run
+type Report struct {
+	Findings []Finding
+}
+
+func (r *Report) add(handler, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Handler: handler, Issue: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) String() string {
+	if len(r.Findings) == 0 {
+		return "no detectable traits found\n"
+	}
+	b := strings.Builder{}
+	for _, f := range r.Findings {
+		b.WriteString(f.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// checkTiming flags banners sent instantly or with near constant latency
+func checkTiming(report *Report, handler string, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if sorted[0] < instantBanner {
+		report.add(handler, "banner sent instantly")
+		return
+	}
+	if len(sorted) > 1 && sorted[len(sorted)-1]-sorted[0] < uniformSpread {
+		report.add(handler, "banner timing uniform across sessions")
+	}
+}
+
+// checkBanner flags banners which don't match the protocol or name no product
+func checkBanner(report *Report, p probe, banner []byte) {
+	line, _, _ := strings.Cut(string(banner), "\n")
+	line = strings.TrimSpace(line)
+	if line == "" {
+		report.add(p.name, "no banner sent")
+		return
+	}
+	if !p.banner.MatchString(line) {
+		report.add(p.name, "banner %q does not match protocol conventions", line)
+	}
+	if !versionPattern.MatchString(line) {
+		report.add(p.name, "banner %q does not identify a product version", line)
+	}
+}
+
+// checkCompliance flags handlers that accept input a real server rejects
+func checkCompliance(report *Report, p probe, session *Session) {
+	last := session.Exchanges[len(session.Exchanges)-1]
+	if last.Input == nil {
+		report.add(p.name, "connection closed before the invalid command was sent")
+		return
+	}
+	resp := strings.TrimSpace(string(last.Response))
+	if resp == "" {
+		report.add(p.name, "no response to an invalid command")
+		return
+	}
+	if !p.rejected.MatchString(resp) {
+		line, _, _ := strings.Cut(resp, "\n")
+		report.add(p.name, "invalid command answered with %q", strings.TrimSpace(line))
+	}
+}
+
+func auditHandler(ctx context.Context, report *Report, p probe, handler protocols.TCPHandlerFunc) error {
+	var latencies []time.Duration
+	var session *Session
+	for i := 0; i < samples; i++ {
+		s, err := ReplaySession(ctx, handler, p.port, p.banner != nil, p.invalid)
+		if err != nil {
+			return err
+		}
+		session = s
+		if len(s.Banner()) > 0 {
+			latencies = append(latencies, s.Exchanges[0].Latency)
+		}
+	}
+	if p.banner != nil {
+		checkBanner(report, p, session.Banner())
+		checkTiming(report, p.name, latencies)
+	}
+	checkCompliance(report, p, session)
+	return nil
+}
+
+// Run audits the TCP handlers, or only the named ones, and returns the
+// detectable traits found
+func Run(ctx context.Context, names ...string) (*Report, error) {
+	handlers := protocols.MapTCPProtocolHandlers(nopLogger{}, nopHoneypot{})
+	report := &Report{}
+	for _, p := range probes {
+		if len(names) > 0 && !slices.Contains(names, p.name) {
+			continue
+		}
+		handler, ok := handlers[p.handler]
+		if !ok {
+			continue
+		}
+		if err := auditHandler(ctx, report, p, handler); err != nil {
+			return nil, fmt.Errorf("failed to audit %s: %w", p.name, err)
+		}
+	}
+	for _, p := range identityProbes {
+		if len(names) > 0 && !slices.Contains(names, p.name) {
+			continue
+		}
+		handler, ok := handlers[p.handler]
+		if !ok {
+			continue
+		}
+		if err := auditIdentity(ctx, report, p, handler); err != nil {
+			return nil, fmt.Errorf("failed to audit %s: %w", p.name, err)
+		}
+	}
+	return report, nil
+}
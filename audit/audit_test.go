@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTiming(t *testing.T) {
+	report := &Report{}
+	checkTiming(report, "ftp", []time.Duration{time.Millisecond, 20 * time.Millisecond})
+	require.Len(t, report.Findings, 1)
+	require.Equal(t, "FTP: banner sent instantly (detectable)", report.Findings[0].String())
+
+	report = &Report{}
+	checkTiming(report, "smtp", []time.Duration{500 * time.Millisecond, 501 * time.Millisecond})
+	require.Len(t, report.Findings, 1)
+	require.Contains(t, report.Findings[0].Issue, "uniform")
+
+	report = &Report{}
+	checkTiming(report, "smtp", []time.Duration{500 * time.Millisecond, 900 * time.Millisecond})
+	require.Empty(t, report.Findings)
+}
+
+func TestCheckBanner(t *testing.T) {
+	p := probes[0]
+	report := &Report{}
+	checkBanner(report, p, []byte("220 mail.example.com ESMTP Postfix 3.4.13\r\n"))
+	require.Empty(t, report.Findings)
+
+	checkBanner(report, p, []byte("220 Welcome!\r\n"))
+	require.Len(t, report.Findings, 2)
+}
+
+func TestCheckIdentity(t *testing.T) {
+	p := identityProbes[0]
+	report := &Report{}
+	checkIdentity(report, p, []string{"SHA256:a", "SHA256:a"})
+	require.Len(t, report.Findings, 1)
+	require.Equal(t, "SSH: host key static across IPs (detectable)", report.Findings[0].String())
+
+	report = &Report{}
+	checkIdentity(report, p, []string{"SHA256:a", "SHA256:b"})
+	require.Empty(t, report.Findings)
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/mushorg/glutton/protocols"
+	"golang.org/x/crypto/ssh"
+)
+
+// identityAddrs stand in for the addresses of a sensor, all of them reach
+// the host on Linux
+var identityAddrs = []string{"127.0.0.1", "127.0.0.2"}
+
+// identityProbe describes how to fetch the key a handler identifies with
+type identityProbe struct {
+	name string
+	// key of the handler in the protocol handler map
+	handler string
+	port    uint16
+	// what is compared, for the finding
+	identity string
+	// fingerprint connects to ip and returns the fingerprint of the key
+	fingerprint func(ctx context.Context, handler protocols.TCPHandlerFunc, ip string, port uint16) (string, error)
+}
+
+var identityProbes = []identityProbe{
+	{name: "ssh", handler: "ssh", port: 22, identity: "host key", fingerprint: sshHostKey},
+	{name: "tls", handler: "tcp", port: 443, identity: "certificate key", fingerprint: tlsCertificateKey},
+}
+
+var errHostKeySeen = errors.New("host key seen")
+
+// sshHostKey returns the fingerprint of the host key offered on ip, the
+// connection is dropped before authenticating
+func sshHostKey(ctx context.Context, handler protocols.TCPHandlerFunc, ip string, port uint16) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn, err := connectHandler(ctx, handler, ip, port)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(responseTimeout)); err != nil {
+		return "", err
+	}
+
+	fingerprint := ""
+	config := &ssh.ClientConfig{
+		User: "root",
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			fingerprint = ssh.FingerprintSHA256(key)
+			return errHostKeySeen
+		},
+	}
+	_, _, _, err = ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
+	if fingerprint == "" {
+		return "", err
+	}
+	return fingerprint, nil
+}
+
+// tlsCertificateKey returns the fingerprint of the public key certified on
+// ip for clients sending no server name, a new certificate for the same key
+// gives the sensor away as well
+func tlsCertificateKey(ctx context.Context, handler protocols.TCPHandlerFunc, ip string, port uint16) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn, err := connectHandler(ctx, handler, ip, port)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(responseTimeout)); err != nil {
+		return "", err
+	}
+
+	// the certificate is inspected, not trusted
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return "", err
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", errors.New("no certificate sent")
+	}
+	sum := sha256.Sum256(certs[0].RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkIdentity flags handlers presenting the same key on every address
+func checkIdentity(report *Report, p identityProbe, fingerprints []string) {
+	if len(fingerprints) < 2 {
+		return
+	}
+	for _, fingerprint := range fingerprints[1:] {
+		if fingerprint != fingerprints[0] {
+			return
+		}
+	}
+	report.add(p.name, "%s static across IPs", p.identity)
+}
+
+func auditIdentity(ctx context.Context, report *Report, p identityProbe, handler protocols.TCPHandlerFunc) error {
+	fingerprints := []string{}
+	for _, ip := range identityAddrs {
+		fingerprint, err := p.fingerprint(ctx, handler, ip, p.port)
+		if err != nil {
+			return err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	checkIdentity(report, p, fingerprints)
+	return nil
+}
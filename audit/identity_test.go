@@ -0,0 +1,25 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mushorg/glutton/protocols"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditIdentity(t *testing.T) {
+	handlers := protocols.MapTCPProtocolHandlers(nopLogger{}, nopHoneypot{})
+	ctx := context.Background()
+
+	// the host key is generated once per process
+	report := &Report{}
+	require.NoError(t, auditIdentity(ctx, report, identityProbes[0], handlers["ssh"]))
+	require.Len(t, report.Findings, 1)
+	require.Equal(t, "ssh", report.Findings[0].Handler)
+
+	// certificates are generated per local address
+	report = &Report{}
+	require.NoError(t, auditIdentity(ctx, report, identityProbes[1], handlers["tcp"]))
+	require.Empty(t, report.Findings)
+}
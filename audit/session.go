@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols"
+	"github.com/mushorg/glutton/rules"
+)
+
+const (
+	// how long to wait for the first byte of a response
+	responseTimeout = 3 * time.Second
+	// a response is considered complete after this much silence
+	quietPeriod = 200 * time.Millisecond
+)
+
+// Exchange is a single client write and the server response to it
+type Exchange struct {
+	Input    []byte
+	Response []byte
+	// Latency until the first response byte arrived
+	Latency time.Duration
+}
+
+// Session is the transcript of a replayed session. The first exchange has no
+// input and holds the banner sent by the server, if any.
+type Session struct {
+	Exchanges []Exchange
+}
+
+// Banner returns what the server sent before receiving any input
+func (s *Session) Banner() []byte {
+	if len(s.Exchanges) == 0 {
+		return nil
+	}
+	return s.Exchanges[0].Response
+}
+
+// nopHoneypot satisfies interfaces.Honeypot without producing events
+type nopHoneypot struct{}
+
+func (nopHoneypot) ProduceTCP(string, net.Conn, connection.Metadata, []byte, interface{}) error {
+	return nil
+}
+
+func (nopHoneypot) ProduceUDP(string, *net.UDPAddr, *net.UDPAddr, connection.Metadata, []byte, interface{}) error {
+	return nil
+}
+
+func (nopHoneypot) ConnectionByFlow([2]uint64) connection.Metadata {
+	return connection.Metadata{}
+}
+
+func (nopHoneypot) UpdateConnectionTimeout(_ context.Context, conn net.Conn) error {
+	return conn.SetDeadline(time.Now().Add(2 * responseTimeout))
+}
+
+func (nopHoneypot) MetadataByConnection(net.Conn) (connection.Metadata, error) {
+	return connection.Metadata{}, nil
+}
+
+// nopLogger discards everything the handlers log
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// readResponse reads until the server stays quiet or closes the connection
+func readResponse(conn net.Conn, start time.Time) ([]byte, time.Duration, error) {
+	var (
+		data    []byte
+		latency time.Duration
+	)
+	buffer := make([]byte, 4096)
+	deadline := start.Add(responseTimeout)
+	for {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return data, latency, err
+		}
+		n, err := conn.Read(buffer)
+		if n > 0 {
+			if len(data) == 0 {
+				latency = time.Since(start)
+			}
+			data = append(data, buffer[:n]...)
+			deadline = time.Now().Add(quietPeriod)
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return data, latency, nil
+			}
+			return data, latency, err
+		}
+	}
+}
+
+// connectHandler runs handler on a connection accepted on ip and returns the
+// client side. The handler is stopped when ctx is done.
+func connectHandler(ctx context.Context, handler protocols.TCPHandlerFunc, ip string, port uint16) (net.Conn, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(ip, "0"))
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	server, err := l.Accept()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	md := connection.Metadata{
+		Added:      time.Now(),
+		TargetPort: port,
+		Rule:       &rules.Rule{Target: "audit"},
+	}
+	go func() {
+		defer server.Close()
+		_ = handler(ctx, server, md)
+	}()
+	return client, nil
+}
+
+// ReplaySession runs handler against a loopback connection, sends the inputs
+// one after another and records the responses along with their timing. With
+// banner set it first waits for the server to speak.
+func ReplaySession(ctx context.Context, handler protocols.TCPHandlerFunc, port uint16, banner bool, inputs ...[]byte) (*Session, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+	client, err := connectHandler(ctx, handler, "127.0.0.1", port)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	session := &Session{Exchanges: []Exchange{{}}}
+	if banner {
+		data, latency, err := readResponse(client, start)
+		session.Exchanges[0] = Exchange{Response: data, Latency: latency}
+		if err != nil {
+			return session, nil
+		}
+	}
+
+	for _, input := range inputs {
+		start := time.Now()
+		if _, err := client.Write(input); err != nil {
+			break
+		}
+		resp, latency, err := readResponse(client, start)
+		session.Exchanges = append(session.Exchanges, Exchange{Input: input, Response: resp, Latency: latency})
+		if err != nil {
+			break
+		}
+	}
+	return session, nil
+}
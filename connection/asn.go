@@ -0,0 +1,173 @@
+package connection
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cymruMaxCached bounds the whois answers kept, the cache is dropped
+	// once it is reached
+	cymruMaxCached = 100000
+	// cymruMaxPending bounds the queries running at once
+	cymruMaxPending = 64
+	// cymruErrorTTL is how long a failed query keeps an address from being
+	// asked for again
+	cymruErrorTTL = 5 * time.Minute
+)
+
+// ASN is the autonomous system announcing a source address
+type ASN struct {
+	Number       uint32 `json:"number"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// ASNResolver looks up the autonomous system of an address, nil if it is
+// not known
+type ASNResolver interface {
+	LookupASN(ip string) *ASN
+}
+
+type asnRecord struct {
+	Number       uint32 `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// ASNDatabase looks up addresses in a GeoLite2 ASN database
+type ASNDatabase struct {
+	db *mmdb
+}
+
+// OpenASNDatabase opens the database at path, it is reloaded when the file
+// changes, checking at most every refresh interval
+func OpenASNDatabase(path string, refresh time.Duration) (*ASNDatabase, error) {
+	db, err := openMMDB(path, refresh)
+	if err != nil {
+		return nil, err
+	}
+	return &ASNDatabase{db: db}, nil
+}
+
+func (a *ASNDatabase) LookupASN(ip string) *ASN {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+	var record asnRecord
+	if err := a.db.lookup(addr, &record); err != nil || record.Number == 0 {
+		return nil
+	}
+	return &ASN{Number: record.Number, Organization: record.Organization}
+}
+
+// Close closes the database
+func (a *ASNDatabase) Close() error {
+	return a.db.close()
+}
+
+type cymruEntry struct {
+	asn     *ASN
+	expires time.Time
+}
+
+// CymruResolver asks the Team Cymru IP to ASN whois service in the
+// background so registering a connection never waits for it, answers are
+// cached for ttl
+type CymruResolver struct {
+	server  string
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	cache   map[string]cymruEntry
+	pending map[string]bool
+}
+
+// NewCymruResolver queries server, usually whois.cymru.com:43
+func NewCymruResolver(server string, timeout, ttl time.Duration) *CymruResolver {
+	return &CymruResolver{server: server, timeout: timeout, ttl: ttl, cache: map[string]cymruEntry{}, pending: map[string]bool{}}
+}
+
+// LookupASN returns what is cached of ip, starting a query if the answer is
+// missing or expired. The first connections of an address go without it.
+func (c *CymruResolver) LookupASN(ip string) *ASN {
+	if net.ParseIP(ip) == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[ip]
+	if ok && time.Now().Before(entry.expires) {
+		return entry.asn
+	}
+	if !c.pending[ip] && len(c.pending) < cymruMaxPending {
+		c.pending[ip] = true
+		go c.resolve(ip)
+	}
+	// an expired answer is used until the new one arrives
+	return entry.asn
+}
+
+func (c *CymruResolver) resolve(ip string) {
+	asn, err := c.query(ip)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, ip)
+	ttl := c.ttl
+	if err != nil {
+		// failures are cached briefly so an outage is not asked again for
+		// every connection, a previous answer is kept meanwhile
+		asn, ttl = c.cache[ip].asn, cymruErrorTTL
+	}
+	if len(c.cache) >= cymruMaxCached {
+		c.cache = map[string]cymruEntry{}
+	}
+	c.cache[ip] = cymruEntry{asn: asn, expires: time.Now().Add(ttl)}
+}
+
+func (c *CymruResolver) query(ip string) (*ASN, error) {
+	conn, err := net.DialTimeout("tcp", c.server, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(conn, " -v %s\r\n", ip); err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		asn, ok := parseCymruLine(scanner.Text())
+		if ok {
+			return asn, nil
+		}
+	}
+	return nil, scanner.Err()
+}
+
+// parseCymruLine reads an answer line of the verbose format,
+// AS | IP | BGP Prefix | CC | Registry | Allocated | AS Name. Addresses not
+// announced come back as NA, they resolve to a nil ASN.
+func parseCymruLine(line string) (*ASN, bool) {
+	fields := strings.Split(line, "|")
+	if len(fields) < 7 {
+		return nil, false
+	}
+	number := strings.TrimSpace(fields[0])
+	if number == "AS" {
+		return nil, false
+	}
+	n, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return nil, true
+	}
+	return &ASN{Number: uint32(n), Organization: strings.TrimSpace(fields[len(fields)-1])}, true
+}
@@ -0,0 +1,109 @@
+package connection
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestASNDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	writeMMDB(t, path, "GeoLite2-ASN", "1.2.3.0/24", map[string]any{
+		"autonomous_system_number":       uint32(398324),
+		"autonomous_system_organization": "CENSYS-ARIN-01",
+	})
+	db, err := OpenASNDatabase(path, time.Hour)
+	require.NoError(t, err)
+	defer db.Close()
+	require.Equal(t, &ASN{Number: 398324, Organization: "CENSYS-ARIN-01"}, db.LookupASN("1.2.3.4"))
+	require.Nil(t, db.LookupASN("5.6.7.8"))
+
+	table := New()
+	table.SetASN(db)
+	md, err := table.Register("1.2.3.4", "4000", 22, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint32(398324), md.AS.Number)
+}
+
+func TestParseCymruLine(t *testing.T) {
+	_, ok := parseCymruLine("AS      | IP               | BGP Prefix          | CC | Registry | Allocated  | AS Name")
+	require.False(t, ok)
+	asn, ok := parseCymruLine("15169   | 8.8.8.8          | 8.8.8.0/24          | US | arin     | 1992-12-01 | GOOGLE, US")
+	require.True(t, ok)
+	require.Equal(t, &ASN{Number: 15169, Organization: "GOOGLE, US"}, asn)
+	asn, ok = parseCymruLine("NA      | 10.0.0.1         | NA                  |    | other    |            | NA")
+	require.True(t, ok)
+	require.Nil(t, asn)
+}
+
+func TestCymruResolver(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	var queries atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			queries.Add(1)
+			query, _ := bufio.NewReader(conn).ReadString('\n')
+			if query != " -v 8.8.8.8\r\n" {
+				conn.Close()
+				continue
+			}
+			fmt.Fprint(conn, "AS      | IP               | BGP Prefix          | CC | Registry | Allocated  | AS Name\n")
+			fmt.Fprint(conn, "15169   | 8.8.8.8          | 8.8.8.0/24          | US | arin     | 1992-12-01 | GOOGLE, US\n")
+			conn.Close()
+		}
+	}()
+
+	resolver := NewCymruResolver(ln.Addr().String(), time.Second, time.Hour)
+	// registering does not wait for the query
+	require.Nil(t, resolver.LookupASN("8.8.8.8"))
+	resolvedASN(t, resolver, "8.8.8.8")
+	require.Equal(t, &ASN{Number: 15169, Organization: "GOOGLE, US"}, resolver.LookupASN("8.8.8.8"))
+	require.Equal(t, int32(1), queries.Load())
+}
+
+// resolvedASN looks ip up and waits for the background query
+func resolvedASN(t *testing.T, c *CymruResolver, ip string) *ASN {
+	c.LookupASN(ip)
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return !c.pending[ip]
+	}, time.Second, time.Millisecond)
+	return c.LookupASN(ip)
+}
+
+func TestCymruResolverFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	var queries atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// never answers, the query times out
+			queries.Add(1)
+			defer conn.Close()
+		}
+	}()
+
+	// failures are cached so an outage is not asked again
+	resolver := NewCymruResolver(ln.Addr().String(), 20*time.Millisecond, time.Hour)
+	require.Nil(t, resolvedASN(t, resolver, "8.8.8.8"))
+	require.Nil(t, resolver.LookupASN("8.8.8.8"))
+	require.Equal(t, int32(1), queries.Load())
+}
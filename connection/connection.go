@@ -47,21 +47,93 @@ type Metadata struct {
 	Added      time.Time
 	Rule       *rules.Rule
 	TargetPort uint16
+	// Tags are attached to the events produced for the connection
+	Tags []string
+	// Geo is the location of the source address if GeoIP is enabled
+	Geo *Geo
+	// AS is the autonomous system of the source address if ASN lookups are
+	// enabled
+	AS *ASN
+	// Reputation of the source address if reputation lookups are enabled,
+	// its classification is added to the Tags
+	Reputation *Reputation
+	// Hostname is the PTR name of the source address if reverse lookups are
+	// enabled, it is filled in as events are produced
+	Hostname string
+	// Fingerprints of the client, gathered by the handlers as the connection
+	// goes on
+	Fingerprints *Fingerprints
+	// PCAP is the id of the capture file holding the packets of the
+	// connection if packet capture is enabled
+	PCAP string
+	// Transcript is the id of the recorded session if transcripts are
+	// enabled for its handler
+	Transcript string
 	//TargetIP   net.IP
 }
 
 type ConnTable struct {
 	table map[CKey]Metadata
-	mtx   sync.RWMutex
+	// syns are the SYNs captured of connections not yet registered
+	syns map[CKey]SYN
+	mtx  sync.RWMutex
+	geo  *GeoIP
+	asn  ASNResolver
+	rep  ReputationResolver
+	ptr  *PTRResolver
+	// capture writes the packets of the connections if enabled
+	capture *PacketCapture
 }
 
 func New() *ConnTable {
 	ct := &ConnTable{
 		table: make(map[CKey]Metadata, 1024),
+		syns:  map[CKey]SYN{},
 	}
 	return ct
 }
 
+// SetGeoIP has the connections registered from now on looked up in geo
+func (t *ConnTable) SetGeoIP(geo *GeoIP) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.geo = geo
+}
+
+// SetASN has the connections registered from now on looked up by resolver
+func (t *ConnTable) SetASN(resolver ASNResolver) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.asn = resolver
+}
+
+// SetReputation has the connections registered from now on looked up by
+// resolver
+func (t *ConnTable) SetReputation(resolver ReputationResolver) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.rep = resolver
+}
+
+// SetPTR has the source addresses of the connections registered from now
+// on resolved by resolver
+func (t *ConnTable) SetPTR(resolver *PTRResolver) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.ptr = resolver
+}
+
+// Hostname returns the PTR name of ip if it is resolved by now
+func (t *ConnTable) Hostname(ip string) string {
+	t.mtx.RLock()
+	ptr := t.ptr
+	t.mtx.RUnlock()
+	if ptr == nil {
+		return ""
+	}
+	return ptr.Hostname(ip)
+}
+
 // RegisterConn a connection in the table
 func (t *ConnTable) RegisterConn(conn net.Conn, rule *rules.Rule) (Metadata, error) {
 	srcIP, srcPort, err := net.SplitHostPort(conn.RemoteAddr().String())
@@ -77,27 +149,62 @@ func (t *ConnTable) RegisterConn(conn net.Conn, rule *rules.Rule) (Metadata, err
 	if err != nil {
 		return Metadata{}, fmt.Errorf("failed to parse dstPort: %w", err)
 	}
-	return t.Register(srcIP, srcPort, uint16(port), rule)
+	return t.register(srcIP, srcPort, uint16(port), rule, true)
 }
 
-// Register a connection in the table
+// Register a connection in the table. The source address is looked up
+// before the table is locked, ASN and reputation lookups may have to ask a
+// remote service.
 func (t *ConnTable) Register(srcIP, srcPort string, dstPort uint16, rule *rules.Rule) (Metadata, error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
+	return t.register(srcIP, srcPort, dstPort, rule, false)
+}
 
+// register adds a connection or flow, TCP connections take the SYN
+// captured for them
+func (t *ConnTable) register(srcIP, srcPort string, dstPort uint16, rule *rules.Rule, tcp bool) (Metadata, error) {
 	ck, err := NewConnKeyByString(srcIP, srcPort)
 	if err != nil {
 		return Metadata{}, err
 	}
-	if md, ok := t.table[ck]; ok {
+	t.mtx.RLock()
+	md, ok := t.table[ck]
+	geo, asn, rep, ptr, capture := t.geo, t.asn, t.rep, t.ptr, t.capture
+	t.mtx.RUnlock()
+	if ok {
 		return md, nil
 	}
 
-	md := Metadata{
+	md = Metadata{
 		Added:      time.Now(),
 		TargetPort: dstPort,
 		Rule:       rule,
 	}
+	if ptr != nil {
+		ptr.Prefetch(srcIP)
+	}
+	if geo != nil {
+		md.Geo = geo.Lookup(srcIP)
+	}
+	if asn != nil {
+		md.AS = asn.LookupASN(srcIP)
+	}
+	if rep != nil {
+		if md.Reputation = rep.LookupReputation(srcIP); md.Reputation != nil {
+			md.Tags = append(md.Tags, md.Reputation.Tags()...)
+		}
+	}
+	if capture != nil && tcp {
+		md.PCAP = capture.Reference(ck)
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if existing, ok := t.table[ck]; ok {
+		return existing, nil
+	}
+	if syn, ok := t.takeSYN(ck); ok && tcp {
+		md.Fingerprints = &Fingerprints{JA4T: syn.JA4T(), P0f: syn.P0f(), OS: syn.OS()}
+	}
 	t.table[ck] = md
 	return md, nil
 }
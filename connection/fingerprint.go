@@ -0,0 +1,36 @@
+package connection
+
+// Fingerprints identify the software on the other end of a connection
+type Fingerprints struct {
+	// JA3 and JA3S describe the TLS ClientHello of the client and the
+	// ServerHello answering it, the hashes are what is usually shared
+	JA3      string `json:"ja3,omitempty"`
+	JA3Hash  string `json:"ja3_hash,omitempty"`
+	JA3S     string `json:"ja3s,omitempty"`
+	JA3SHash string `json:"ja3s_hash,omitempty"`
+	// JA4 describes the TLS ClientHello, JA4H the HTTP request headers and
+	// JA4T the options of the TCP SYN
+	JA4  string `json:"ja4,omitempty"`
+	JA4H string `json:"ja4h,omitempty"`
+	JA4T string `json:"ja4t,omitempty"`
+	// HASSH and HASSHServer describe the algorithms offered in the SSH
+	// KEXINIT of the client and the one answering it
+	HASSH           string `json:"hassh,omitempty"`
+	HASSHHash       string `json:"hassh_hash,omitempty"`
+	HASSHServer     string `json:"hassh_server,omitempty"`
+	HASSHServerHash string `json:"hassh_server_hash,omitempty"`
+	// P0f is the p0f signature of the TCP SYN and OS the operating system
+	// or tool it is known from
+	P0f string `json:"p0f,omitempty"`
+	OS  string `json:"os,omitempty"`
+}
+
+// Clone returns a copy of the fingerprints to add to, the metadata of a
+// connection is shared by the events of all its handlers
+func (f *Fingerprints) Clone() *Fingerprints {
+	if f == nil {
+		return &Fingerprints{}
+	}
+	clone := *f
+	return &clone
+}
@@ -0,0 +1,68 @@
+package connection
+
+import (
+	"net"
+	"time"
+)
+
+// Geo is the location of a source address
+type Geo struct {
+	Country     string  `json:"country,omitempty"`
+	CountryName string  `json:"country_name,omitempty"`
+	City        string  `json:"city,omitempty"`
+	Latitude    float64 `json:"latitude,omitempty"`
+	Longitude   float64 `json:"longitude,omitempty"`
+}
+
+type geoRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// GeoIP looks up source addresses in a GeoIP2 or GeoLite2 City database
+type GeoIP struct {
+	db *mmdb
+}
+
+// OpenGeoIP opens the database at path, it is reloaded when the file
+// changes, checking at most every refresh interval
+func OpenGeoIP(path string, refresh time.Duration) (*GeoIP, error) {
+	db, err := openMMDB(path, refresh)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{db: db}, nil
+}
+
+// Lookup returns the location of ip, nil if it is not in the database
+func (g *GeoIP) Lookup(ip string) *Geo {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+	var record geoRecord
+	if err := g.db.lookup(addr, &record); err != nil || record.Country.ISOCode == "" && record.Location.Latitude == 0 {
+		return nil
+	}
+	return &Geo{
+		Country:     record.Country.ISOCode,
+		CountryName: record.Country.Names["en"],
+		City:        record.City.Names["en"],
+		Latitude:    record.Location.Latitude,
+		Longitude:   record.Location.Longitude,
+	}
+}
+
+// Close closes the database
+func (g *GeoIP) Close() error {
+	return g.db.close()
+}
@@ -0,0 +1,68 @@
+package connection
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// mmdb is a MaxMind database file which is reopened once it changes on
+// disk, it is checked at most every refresh interval
+type mmdb struct {
+	path    string
+	refresh time.Duration
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+	checked time.Time
+}
+
+func openMMDB(path string, refresh time.Duration) (*mmdb, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &mmdb{path: path, refresh: refresh, reader: reader, modTime: info.ModTime(), checked: time.Now()}, nil
+}
+
+// reload reopens the database if it was replaced, a broken update keeps
+// the old one in use
+func (m *mmdb) reload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refresh <= 0 || time.Since(m.checked) < m.refresh {
+		return
+	}
+	m.checked = time.Now()
+	info, err := os.Stat(m.path)
+	if err != nil || info.ModTime().Equal(m.modTime) {
+		return
+	}
+	reader, err := maxminddb.Open(m.path)
+	if err != nil {
+		return
+	}
+	m.reader.Close()
+	m.reader, m.modTime = reader, info.ModTime()
+}
+
+func (m *mmdb) lookup(ip net.IP, result any) error {
+	m.reload()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.reader.Lookup(ip, result)
+}
+
+func (m *mmdb) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reader.Close()
+}
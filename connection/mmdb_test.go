@@ -0,0 +1,141 @@
+package connection
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbValue encodes a value in the MaxMind DB data format
+func mmdbValue(v any) []byte {
+	header := func(kind, size int) []byte {
+		// sizes from 29 on follow in an extra byte
+		extra := []byte{}
+		if size >= 29 {
+			size, extra = 29, []byte{byte(size - 29)}
+		}
+		if kind > 7 {
+			return append([]byte{byte(size), byte(kind - 7)}, extra...)
+		}
+		return append([]byte{byte(kind<<5 | size)}, extra...)
+	}
+	uint := func(kind int, n uint64) []byte {
+		data := binary.BigEndian.AppendUint64(nil, n)
+		for len(data) > 0 && data[0] == 0 {
+			data = data[1:]
+		}
+		return append(header(kind, len(data)), data...)
+	}
+	switch v := v.(type) {
+	case string:
+		return append(header(2, len(v)), v...)
+	case float64:
+		return binary.BigEndian.AppendUint64(header(3, 8), math.Float64bits(v))
+	case uint16:
+		return uint(5, uint64(v))
+	case uint32:
+		return uint(6, uint64(v))
+	case uint64:
+		return uint(9, v)
+	case []any:
+		data := header(11, len(v))
+		for _, item := range v {
+			data = append(data, mmdbValue(item)...)
+		}
+		return data
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		data := header(7, len(v))
+		for _, key := range keys {
+			data = append(data, mmdbValue(key)...)
+			data = append(data, mmdbValue(v[key])...)
+		}
+		return data
+	}
+	panic("unsupported mmdb value")
+}
+
+// writeMMDB writes an IPv4 database with 24 bit records holding record for
+// the addresses of network
+func writeMMDB(t *testing.T, path, dbType, network string, record map[string]any) {
+	_, ipnet, err := net.ParseCIDR(network)
+	require.NoError(t, err)
+	bits, _ := ipnet.Mask.Size()
+	ip := ipnet.IP.To4()
+	nodes := uint32(bits)
+	put := func(tree []byte, value uint32) []byte {
+		return append(tree, byte(value>>16), byte(value>>8), byte(value))
+	}
+	tree := []byte{}
+	for depth := range bits {
+		next := uint32(depth + 1)
+		if depth == bits-1 {
+			next = nodes + 16
+		}
+		if ip[depth/8]>>(7-depth%8)&1 == 0 {
+			tree = put(put(tree, next), nodes)
+		} else {
+			tree = put(put(tree, nodes), next)
+		}
+	}
+	data := append(tree, make([]byte, 16)...)
+	data = append(data, mmdbValue(record)...)
+	data = append(data, "\xab\xcd\xefMaxMind.com"...)
+	data = append(data, mmdbValue(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"database_type":               dbType,
+		"description":                 map[string]any{"en": "test"},
+		"ip_version":                  uint16(4),
+		"languages":                   []any{"en"},
+		"node_count":                  nodes,
+		"record_size":                 uint16(24),
+	})...)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+func geoRecordFor(country string) map[string]any {
+	return map[string]any{
+		"country":  map[string]any{"iso_code": country, "names": map[string]any{"en": "Germany"}},
+		"city":     map[string]any{"names": map[string]any{"en": "Berlin"}},
+		"location": map[string]any{"latitude": 52.52, "longitude": 13.405},
+	}
+}
+
+func TestGeoIP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeMMDB(t, path, "GeoLite2-City", "1.2.3.0/24", geoRecordFor("DE"))
+	geo, err := OpenGeoIP(path, time.Millisecond)
+	require.NoError(t, err)
+	defer geo.Close()
+
+	require.Equal(t, &Geo{Country: "DE", CountryName: "Germany", City: "Berlin", Latitude: 52.52, Longitude: 13.405}, geo.Lookup("1.2.3.4"))
+	require.Nil(t, geo.Lookup("5.6.7.8"))
+	require.Nil(t, geo.Lookup("invalid"))
+
+	table := New()
+	table.SetGeoIP(geo)
+	md, err := table.Register("1.2.3.4", "4000", 22, nil)
+	require.NoError(t, err)
+	require.Equal(t, "DE", md.Geo.Country)
+
+	// a replaced database is picked up
+	next := filepath.Join(t.TempDir(), "city.mmdb")
+	writeMMDB(t, next, "GeoLite2-City", "1.2.3.0/24", geoRecordFor("FR"))
+	require.NoError(t, os.Chtimes(next, time.Now(), time.Now().Add(time.Minute)))
+	require.NoError(t, os.Rename(next, path))
+	time.Sleep(2 * time.Millisecond)
+	require.Equal(t, "FR", geo.Lookup("1.2.3.4").Country)
+}
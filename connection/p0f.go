@@ -0,0 +1,115 @@
+package connection
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// osSignature is a SYN layout an operating system or scanning tool is
+// known by, in the spirit of the p0f database
+type osSignature struct {
+	os string
+	// ttl is the initial TTL, zero for tools picking random ones
+	ttl    uint8
+	layout string
+	// windows are the window sizes sent, empty for any
+	windows []uint16
+}
+
+// osSignatures are tried in order, the raw packets of scanning tools come
+// first as their layouts are the sparsest
+var osSignatures = []osSignature{
+	{os: "masscan", layout: "", windows: []uint16{1024}},
+	{os: "ZMap", ttl: 255, layout: "", windows: []uint16{65535}},
+	{os: "nmap SYN scan", layout: "mss", windows: []uint16{1024, 2048, 3072, 4096}},
+	{os: "Linux", ttl: 64, layout: "mss,sok,ts,nop,ws"},
+	{os: "Linux", ttl: 64, layout: "mss,nop,nop,sok,nop,ws"},
+	{os: "Windows", ttl: 128, layout: "mss,nop,ws,nop,nop,sok"},
+	{os: "Windows", ttl: 128, layout: "mss,nop,nop,sok"},
+	{os: "Mac OS X", ttl: 64, layout: "mss,nop,ws,nop,nop,ts,sok,eol+1"},
+	{os: "FreeBSD", ttl: 64, layout: "mss,nop,ws,sok,ts"},
+	{os: "OpenBSD", ttl: 64, layout: "mss,nop,nop,sok,nop,ws,nop,nop,ts"},
+}
+
+// initialTTL guesses the TTL the packet was sent with from the common
+// defaults
+func initialTTL(ttl uint8) uint8 {
+	for _, initial := range []uint8{32, 64, 128} {
+		if ttl <= initial {
+			return initial
+		}
+	}
+	return 255
+}
+
+// layout names the TCP options in the order sent as p0f does
+func (s SYN) layout() string {
+	names := []string{}
+	for _, kind := range s.Options {
+		switch kind {
+		case 0:
+			names = append(names, "eol+"+strconv.Itoa(s.Padding))
+		case 1:
+			names = append(names, "nop")
+		case 2:
+			names = append(names, "mss")
+		case 3:
+			names = append(names, "ws")
+		case 4:
+			names = append(names, "sok")
+		case 5:
+			names = append(names, "sack")
+		case 8:
+			names = append(names, "ts")
+		default:
+			names = append(names, "?"+strconv.Itoa(int(kind)))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// quirks lists the oddities of the IP and TCP headers p0f tells apart
+func (s SYN) quirks() string {
+	quirks := []string{}
+	if s.DF {
+		quirks = append(quirks, "df")
+		if s.IPID != 0 {
+			quirks = append(quirks, "id+")
+		}
+	} else if s.IPID == 0 {
+		quirks = append(quirks, "id-")
+	}
+	if s.ECN {
+		quirks = append(quirks, "ecn")
+	}
+	if slices.Contains(s.Options, 8) && s.Timestamp == 0 {
+		quirks = append(quirks, "ts1-")
+	}
+	return strings.Join(quirks, ",")
+}
+
+// P0f returns the p0f raw signature of the SYN, the TTL is the one seen
+// plus the hops to its guessed initial value
+func (s SYN) P0f() string {
+	window := strconv.Itoa(int(s.Window))
+	if s.MSS > 0 && s.Window%s.MSS == 0 {
+		window = fmt.Sprintf("mss*%d", s.Window/s.MSS)
+	}
+	return fmt.Sprintf("4:%d+%d:%d:%d:%s,%d:%s:%s:0", s.TTL, initialTTL(s.TTL)-s.TTL, s.IPOptions, s.MSS, window, s.WindowScale, s.layout(), s.quirks())
+}
+
+// OS guesses the operating system or tool which sent the SYN, empty if
+// its layout is not known
+func (s SYN) OS() string {
+	layout := s.layout()
+	for _, sig := range osSignatures {
+		if sig.layout == layout &&
+			(sig.ttl == 0 || sig.ttl == initialTTL(s.TTL)) &&
+			(len(sig.windows) == 0 || slices.Contains(sig.windows, s.Window)) {
+			return sig.os
+		}
+	}
+	return ""
+}
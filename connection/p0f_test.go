@@ -0,0 +1,27 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSYNOS(t *testing.T) {
+	windows := SYN{TTL: 113, DF: true, IPID: 1, Window: 64240, MSS: 1460, WindowScale: 8, Options: []uint8{2, 1, 3, 1, 1, 4}}
+	require.Equal(t, "Windows", windows.OS())
+	require.Equal(t, "4:113+15:0:1460:mss*44,8:mss,nop,ws,nop,nop,sok:df,id+:0", windows.P0f())
+
+	masscan := SYN{TTL: 255, IPID: 1, Window: 1024}
+	require.Equal(t, "masscan", masscan.OS())
+	require.Equal(t, "4:255+0:0:0:1024,0:::0", masscan.P0f())
+
+	nmap := SYN{TTL: 41, Window: 3072, MSS: 1460, Options: []uint8{2}}
+	require.Equal(t, "nmap SYN scan", nmap.OS())
+	require.Equal(t, "4:41+23:0:1460:3072,0:mss:id-:0", nmap.P0f())
+
+	mac := SYN{TTL: 64, DF: true, Window: 65535, MSS: 1460, Options: []uint8{2, 1, 3, 1, 1, 8, 4, 0}, Padding: 1}
+	require.Equal(t, "Mac OS X", mac.OS())
+	require.Contains(t, mac.P0f(), ":mss,nop,ws,nop,nop,ts,sok,eol+1:df,ts1-:")
+
+	require.Empty(t, SYN{TTL: 64, Window: 512, Options: []uint8{30}}.OS())
+}
@@ -0,0 +1,313 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+)
+
+const (
+	pcapSnapLen = 65535
+	// pcapMaxSessions bounds the session files open at once, sessions
+	// beyond it are not written
+	pcapMaxSessions = 1024
+	// pcapTime names the files by when their first packet was seen
+	pcapTime = "20060102T150405.000"
+)
+
+// CaptureConfig configures a PacketCapture
+type CaptureConfig struct {
+	Dir string
+	// Global writes every packet to one rolling file instead of a file per
+	// TCP session
+	Global bool
+	// MaxSize in bytes a file may grow to, the rolling file is rotated
+	// then and a session file stops being written
+	MaxSize int64
+	// MaxFiles rolling files are kept, zero keeps them all
+	MaxFiles int
+	// IdleTimeout closes the sessions which saw no packet for as long
+	IdleTimeout time.Duration
+}
+
+// pcapFile is a capture file being written
+type pcapFile struct {
+	id   string
+	file *os.File
+	w    *pcapgo.Writer
+	size int64
+	seen time.Time
+}
+
+// PacketCapture writes the raw packets received on an interface to pcap
+// files, one per TCP session from its SYN on or a global rolling one. The
+// events of a connection reference the file by the id from Reference.
+type PacketCapture struct {
+	config   CaptureConfig
+	linkType layers.LinkType
+	logger   *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[CKey]*pcapFile
+	rolling  *pcapFile
+}
+
+func NewPacketCapture(config CaptureConfig, linkType layers.LinkType, logger *slog.Logger) (*PacketCapture, error) {
+	if err := os.MkdirAll(config.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &PacketCapture{
+		config:   config,
+		linkType: linkType,
+		logger:   logger,
+		sessions: map[CKey]*pcapFile{},
+	}, nil
+}
+
+// create opens a new capture file named by id
+func (c *PacketCapture) create(id string, now time.Time) (*pcapFile, error) {
+	file, err := os.OpenFile(filepath.Join(c.config.Dir, id+".pcap"), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	w := pcapgo.NewWriter(file)
+	if err := w.WriteFileHeader(pcapSnapLen, c.linkType); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &pcapFile{id: id, file: file, w: w, size: 24, seen: now}, nil
+}
+
+func (f *pcapFile) write(ci gopacket.CaptureInfo, data []byte) error {
+	f.seen = ci.Timestamp
+	f.size += 16 + int64(len(data))
+	return f.w.WritePacket(ci, data)
+}
+
+// tcpPacket is what sorts a captured packet into its session
+type tcpPacket struct {
+	src, dst CKey
+	srcIP    net.IP
+	srcPort  uint16
+	// syn is set for the packet opening a connection
+	syn bool
+}
+
+func parseTCPPacket(packet gopacket.Packet) (tcpPacket, bool) {
+	ip, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if !ok {
+		return tcpPacket{}, false
+	}
+	tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok {
+		return tcpPacket{}, false
+	}
+	src, err := newConnKey(layers.NewIPEndpoint(ip.SrcIP), layers.NewTCPPortEndpoint(tcp.SrcPort))
+	if err != nil {
+		return tcpPacket{}, false
+	}
+	dst, err := newConnKey(layers.NewIPEndpoint(ip.DstIP), layers.NewTCPPortEndpoint(tcp.DstPort))
+	if err != nil {
+		return tcpPacket{}, false
+	}
+	return tcpPacket{src: src, dst: dst, srcIP: ip.SrcIP, srcPort: uint16(tcp.SrcPort), syn: tcp.SYN && !tcp.ACK}, true
+}
+
+// write adds a captured packet to its session or the rolling file
+func (c *PacketCapture) write(ci gopacket.CaptureInfo, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.config.Global {
+		return c.writeRolling(ci, data)
+	}
+
+	packet, ok := parseTCPPacket(gopacket.NewPacket(data, c.linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true}))
+	if !ok {
+		return nil
+	}
+	session, ok := c.sessions[packet.src]
+	if !ok {
+		session, ok = c.sessions[packet.dst]
+	}
+	if !ok {
+		// sessions are only followed from their SYN on
+		if !packet.syn || len(c.sessions) >= pcapMaxSessions {
+			return nil
+		}
+		var err error
+		session, err = c.create(fmt.Sprintf("%s-%s-%d", ci.Timestamp.UTC().Format(pcapTime), packet.srcIP, packet.srcPort), ci.Timestamp)
+		if err != nil {
+			return err
+		}
+		c.sessions[packet.src] = session
+	}
+	if c.config.MaxSize > 0 && session.size+16+int64(len(data)) > c.config.MaxSize {
+		return nil
+	}
+	return session.write(ci, data)
+}
+
+// writeRolling adds a packet to the rolling file, callers hold c.mu
+func (c *PacketCapture) writeRolling(ci gopacket.CaptureInfo, data []byte) error {
+	if c.rolling != nil && c.config.MaxSize > 0 && c.rolling.size+16+int64(len(data)) > c.config.MaxSize {
+		if err := c.rolling.file.Close(); err != nil {
+			return err
+		}
+		c.rolling = nil
+		c.prune()
+	}
+	if c.rolling == nil {
+		rolling, err := c.create("glutton-"+ci.Timestamp.UTC().Format(pcapTime), ci.Timestamp)
+		if err != nil {
+			return err
+		}
+		c.rolling = rolling
+	}
+	return c.rolling.write(ci, data)
+}
+
+// prune removes the oldest rolling files beyond MaxFiles, callers hold c.mu
+func (c *PacketCapture) prune() {
+	if c.config.MaxFiles <= 0 {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(c.config.Dir, "glutton-*.pcap"))
+	slices.Sort(files)
+	// the file about to be opened counts as well
+	for len(files) >= c.config.MaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			c.logger.Error("Failed to remove capture file", slog.String("path", files[0]), slog.Any("error", err))
+		}
+		files = files[1:]
+	}
+}
+
+// closeIdle closes the sessions which saw no packet since before
+func (c *PacketCapture) closeIdle(before time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ck, session := range c.sessions {
+		if session.seen.Before(before) {
+			if err := session.file.Close(); err != nil {
+				c.logger.Error("Failed to close capture file", slog.String("id", session.id), slog.Any("error", err))
+			}
+			delete(c.sessions, ck)
+		}
+	}
+}
+
+// Reference returns the id of the capture file holding the packets of the
+// connection from the client endpoint ck, empty if it is not captured
+func (c *PacketCapture) Reference(ck CKey) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.config.Global {
+		if c.rolling == nil {
+			return ""
+		}
+		return c.rolling.id
+	}
+	if session, ok := c.sessions[ck]; ok {
+		return session.id
+	}
+	return ""
+}
+
+// Close closes the files still being written
+func (c *PacketCapture) Close() {
+	c.closeIdle(time.Now().Add(time.Hour))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rolling != nil {
+		c.rolling.file.Close()
+		c.rolling = nil
+	}
+}
+
+// openLive starts capturing on iface, packets are handed over as they
+// arrive so they are seen before the connections they open are accepted
+func openLive(iface string, snapLen int, filter string) (*pcap.Handle, error) {
+	inactive, err := pcap.NewInactiveHandle(iface)
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+	if err := inactive.SetSnapLen(snapLen); err != nil {
+		return nil, err
+	}
+	if err := inactive.SetTimeout(time.Second); err != nil {
+		return nil, err
+	}
+	if err := inactive.SetImmediateMode(true); err != nil {
+		return nil, err
+	}
+	handle, err := inactive.Activate()
+	if err != nil {
+		return nil, err
+	}
+	if err := handle.SetBPFFilter(filter); err != nil {
+		handle.Close()
+		return nil, err
+	}
+	return handle, nil
+}
+
+// StartCapture writes the packets received on iface matching filter to
+// pcap files until ctx is done, the connections registered in t get the
+// reference of their file
+func (t *ConnTable) StartCapture(ctx context.Context, iface, filter string, config CaptureConfig, logger *slog.Logger) error {
+	handle, err := openLive(iface, pcapSnapLen, filter)
+	if err != nil {
+		return err
+	}
+	capture, err := NewPacketCapture(config, handle.LinkType(), logger)
+	if err != nil {
+		handle.Close()
+		return err
+	}
+	t.mtx.Lock()
+	t.capture = capture
+	t.mtx.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(max(config.IdleTimeout/2, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				handle.Close()
+				return
+			case now := <-ticker.C:
+				capture.closeIdle(now.Add(-config.IdleTimeout))
+			}
+		}
+	}()
+	go func() {
+		defer capture.Close()
+		for {
+			data, ci, err := handle.ReadPacketData()
+			switch {
+			case err == pcap.NextErrorTimeoutExpired:
+				continue
+			case err != nil:
+				logger.Debug("Packet capture stopped", slog.Any("error", err))
+				return
+			}
+			if err := capture.write(ci, data); err != nil {
+				logger.Error("Failed to write captured packet", slog.Any("error", err))
+			}
+		}
+	}()
+	return nil
+}
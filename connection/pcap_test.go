@@ -0,0 +1,90 @@
+package connection
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/require"
+)
+
+func testPacket(t *testing.T, src, dst string, srcPort, dstPort uint16, syn, ack bool, payload string) []byte {
+	eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), SYN: syn, ACK: ack, Window: 1024}
+	require.NoError(t, tcp.SetNetworkLayerForChecksum(ip))
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, eth, ip, tcp, gopacket.Payload(payload)))
+	return buf.Bytes()
+}
+
+func readPCAP(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	require.NoError(t, err)
+	packets := 0
+	for {
+		if _, _, err := r.ReadPacketData(); err != nil {
+			return packets
+		}
+		packets++
+	}
+}
+
+func TestPacketCaptureSessions(t *testing.T) {
+	dir := t.TempDir()
+	capture, err := NewPacketCapture(CaptureConfig{Dir: dir, IdleTimeout: time.Minute}, layers.LinkTypeEthernet, slog.Default())
+	require.NoError(t, err)
+	now := time.Now()
+	write := func(data []byte) {
+		require.NoError(t, capture.write(gopacket.CaptureInfo{Timestamp: now, CaptureLength: len(data), Length: len(data)}, data))
+	}
+	// packets of connections opened before the capture are left out
+	write(testPacket(t, "10.0.0.9", "10.0.0.1", 4000, 80, false, true, "old"))
+	write(testPacket(t, "10.0.0.2", "10.0.0.1", 5000, 80, true, false, ""))
+	write(testPacket(t, "10.0.0.1", "10.0.0.2", 80, 5000, true, true, ""))
+	write(testPacket(t, "10.0.0.2", "10.0.0.1", 5000, 80, false, true, "GET / HTTP/1.0\r\n\r\n"))
+
+	ck, err := NewConnKeyByString("10.0.0.2", "5000")
+	require.NoError(t, err)
+	id := capture.Reference(ck)
+	require.Contains(t, id, "10.0.0.2-5000")
+	unknown, err := NewConnKeyByString("10.0.0.9", "4000")
+	require.NoError(t, err)
+	require.Empty(t, capture.Reference(unknown))
+
+	capture.closeIdle(now.Add(time.Second))
+	require.Empty(t, capture.Reference(ck))
+	require.Equal(t, 3, readPCAP(t, filepath.Join(dir, id+".pcap")))
+	files, err := filepath.Glob(filepath.Join(dir, "*.pcap"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
+
+func TestPacketCaptureRolling(t *testing.T) {
+	dir := t.TempDir()
+	capture, err := NewPacketCapture(CaptureConfig{Dir: dir, Global: true, MaxSize: 200, MaxFiles: 2}, layers.LinkTypeEthernet, slog.Default())
+	require.NoError(t, err)
+	defer capture.Close()
+	data := testPacket(t, "10.0.0.2", "10.0.0.1", 5000, 80, false, true, "payload")
+	for i := 0; i < 10; i++ {
+		ts := time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC)
+		require.NoError(t, capture.write(gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(data), Length: len(data)}, data))
+	}
+	ck, err := NewConnKeyByString("10.0.0.2", "5000")
+	require.NoError(t, err)
+	require.Equal(t, "glutton-20240101T000008.000", capture.Reference(ck))
+	files, err := filepath.Glob(filepath.Join(dir, "glutton-*.pcap"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	capture.Close()
+	require.Equal(t, 2, readPCAP(t, filepath.Join(dir, "glutton-20240101T000008.000.pcap")))
+}
@@ -0,0 +1,95 @@
+package connection
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ptrMaxPending bounds the lookups running at once, addresses beyond it
+// are tried again with their next connection
+const ptrMaxPending = 256
+
+type ptrEntry struct {
+	ip   string
+	name string
+}
+
+// PTRResolver resolves the host names of source addresses in the
+// background so registering a connection never waits for DNS. The names,
+// and the addresses without one, are kept in a bounded LRU cache.
+type PTRResolver struct {
+	timeout time.Duration
+	size    int
+	// lookup resolves an address, net.DefaultResolver.LookupAddr by default
+	lookup func(ctx context.Context, ip string) ([]string, error)
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	pending map[string]bool
+}
+
+func NewPTRResolver(timeout time.Duration, size int) *PTRResolver {
+	return &PTRResolver{
+		timeout: timeout,
+		size:    max(size, 1),
+		lookup:  net.DefaultResolver.LookupAddr,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		pending: map[string]bool{},
+	}
+}
+
+// Prefetch starts resolving ip unless it is cached or already resolving
+func (p *PTRResolver) Prefetch(ip string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.entries[ip]; ok || p.pending[ip] || len(p.pending) >= ptrMaxPending {
+		return
+	}
+	p.pending[ip] = true
+	go p.resolve(ip)
+}
+
+func (p *PTRResolver) resolve(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	names, err := p.lookup(ctx, ip)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, ip)
+	var dnsErr *net.DNSError
+	if err != nil && (!errors.As(err, &dnsErr) || !dnsErr.IsNotFound) {
+		// timeouts and server failures are not cached
+		return
+	}
+	name := ""
+	if len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+	p.entries[ip] = p.lru.PushFront(ptrEntry{ip: ip, name: name})
+	if p.lru.Len() > p.size {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.entries, oldest.Value.(ptrEntry).ip)
+	}
+}
+
+// Hostname returns the name ip resolved to, empty if it has none or is not
+// resolved yet
+func (p *PTRResolver) Hostname(ip string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	element, ok := p.entries[ip]
+	if !ok {
+		return ""
+	}
+	p.lru.MoveToFront(element)
+	return element.Value.(ptrEntry).name
+}
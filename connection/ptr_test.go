@@ -0,0 +1,68 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPTRResolver(t *testing.T) {
+	var lookups atomic.Int32
+	release := make(chan struct{})
+	p := NewPTRResolver(time.Second, 2)
+	p.lookup = func(ctx context.Context, ip string) ([]string, error) {
+		lookups.Add(1)
+		<-release
+		switch ip {
+		case "1.2.3.4":
+			return []string{"scanner.example.com.", "other.example.com."}, nil
+		case "5.6.7.8", "5.6.7.9":
+			return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+		}
+		return nil, errors.New("server failure")
+	}
+	resolved := func(ip string) func() bool {
+		return func() bool {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			return !p.pending[ip]
+		}
+	}
+
+	table := New()
+	table.SetPTR(p)
+	_, err := table.Register("1.2.3.4", "4000", 22, nil)
+	require.NoError(t, err)
+	// the lookup does not hold up registering and runs once at a time
+	p.Prefetch("1.2.3.4")
+	require.Empty(t, table.Hostname("1.2.3.4"))
+	close(release)
+	require.Eventually(t, resolved("1.2.3.4"), time.Second, time.Millisecond)
+	require.Equal(t, "scanner.example.com", table.Hostname("1.2.3.4"))
+
+	p.Prefetch("5.6.7.8")
+	p.Prefetch("9.9.9.9")
+	require.Eventually(t, resolved("5.6.7.8"), time.Second, time.Millisecond)
+	require.Eventually(t, resolved("9.9.9.9"), time.Second, time.Millisecond)
+	require.Equal(t, int32(3), lookups.Load())
+
+	// names not found are cached, failures are not
+	p.Prefetch("5.6.7.8")
+	p.Prefetch("9.9.9.9")
+	require.Eventually(t, resolved("9.9.9.9"), time.Second, time.Millisecond)
+	require.Equal(t, int32(4), lookups.Load())
+
+	// the least recently used name is evicted
+	require.Equal(t, "scanner.example.com", table.Hostname("1.2.3.4"))
+	p.Prefetch("5.6.7.9")
+	require.Eventually(t, resolved("5.6.7.9"), time.Second, time.Millisecond)
+	require.Equal(t, 2, p.lru.Len())
+	require.Equal(t, "scanner.example.com", table.Hostname("1.2.3.4"))
+	_, cached := p.entries["5.6.7.8"]
+	require.False(t, cached)
+}
@@ -0,0 +1,253 @@
+package connection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// reputationMaxCached bounds the answers kept, the cache is dropped once
+	// it is reached
+	reputationMaxCached = 100000
+	// reputationMaxPending bounds the queries running at once
+	reputationMaxPending = 64
+	// reputationErrorTTL is how long a failed query keeps an address from
+	// being asked for again
+	reputationErrorTTL = 5 * time.Minute
+)
+
+// Classifications of a source address
+const (
+	ReputationMalicious = "malicious"
+	ReputationBenign    = "benign"
+	ReputationUnknown   = "unknown"
+)
+
+var (
+	abuseIPDBAPI = "https://api.abuseipdb.com/api/v2"
+	greyNoiseAPI = "https://api.greynoise.io/v3"
+)
+
+// Reputation is what a threat intelligence service knows of a source
+// address
+type Reputation struct {
+	Source         string `json:"source"`
+	Classification string `json:"classification"`
+	// Scanner is set for addresses known to scan the whole internet
+	Scanner bool `json:"scanner,omitempty"`
+	// Score is the AbuseIPDB abuse confidence from 0 to 100
+	Score int `json:"score,omitempty"`
+	// Name is who the address is attributed to
+	Name string `json:"name,omitempty"`
+}
+
+// Tags returns the tags the events of an address get from its reputation
+func (r *Reputation) Tags() []string {
+	tags := []string{}
+	if r.Scanner {
+		tags = append(tags, "known_scanner")
+	}
+	switch r.Classification {
+	case ReputationMalicious:
+		tags = append(tags, "known_malicious")
+	case ReputationBenign:
+		tags = append(tags, "known_benign")
+	}
+	return tags
+}
+
+// ReputationResolver looks up the reputation of an address, nil if it is
+// not known
+type ReputationResolver interface {
+	LookupReputation(ip string) *Reputation
+}
+
+type reputationEntry struct {
+	reputation *Reputation
+	expires    time.Time
+}
+
+// reputationCache keeps the answers of a service for ttl and queries it in
+// the background, so registering a connection never waits for the service.
+// Private addresses are not looked up and at most rateLimit queries are made
+// a minute.
+type reputationCache struct {
+	ttl       time.Duration
+	rateLimit int
+
+	mu      sync.Mutex
+	entries map[string]reputationEntry
+	pending map[string]bool
+	window  time.Time
+	queries int
+}
+
+// lookup returns what is cached of ip, starting a query if the answer is
+// missing or expired. The first connections of an address go without it.
+func (c *reputationCache) lookup(ip string, query func(string) (*Reputation, error)) *Reputation {
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.IsPrivate() || addr.IsLoopback() || addr.IsUnspecified() {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	entry, ok := c.entries[ip]
+	if ok && now.Before(entry.expires) {
+		return entry.reputation
+	}
+	if !c.pending[ip] && len(c.pending) < reputationMaxPending && c.allow(now) {
+		if c.pending == nil {
+			c.pending = map[string]bool{}
+		}
+		c.pending[ip] = true
+		go c.resolve(ip, query)
+	}
+	// an expired answer is used until the new one arrives
+	return entry.reputation
+}
+
+// allow counts a query against the rate limit of the current minute
+func (c *reputationCache) allow(now time.Time) bool {
+	if c.rateLimit <= 0 {
+		return true
+	}
+	if now.Sub(c.window) >= time.Minute {
+		c.window, c.queries = now, 0
+	}
+	if c.queries >= c.rateLimit {
+		return false
+	}
+	c.queries++
+	return true
+}
+
+func (c *reputationCache) resolve(ip string, query func(string) (*Reputation, error)) {
+	reputation, err := query(ip)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, ip)
+	ttl := c.ttl
+	if err != nil {
+		// failures are cached briefly so an outage is not asked again for
+		// every connection, a previous answer is kept meanwhile
+		reputation, ttl = c.entries[ip].reputation, reputationErrorTTL
+	}
+	if c.entries == nil || len(c.entries) >= reputationMaxCached {
+		c.entries = map[string]reputationEntry{}
+	}
+	c.entries[ip] = reputationEntry{reputation: reputation, expires: time.Now().Add(ttl)}
+}
+
+// getJSON decodes the answer to a GET request into result, found is false
+// for addresses the service does not know
+func getJSON(client *http.Client, endpoint string, header http.Header, result any) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(result)
+}
+
+// AbuseIPDB checks addresses against the AbuseIPDB reports, answers are
+// cached for ttl and at most rateLimit queries are made a minute
+type AbuseIPDB struct {
+	key string
+	// minScore is the abuse confidence from which an address is malicious
+	minScore int
+	client   *http.Client
+	cache    reputationCache
+}
+
+func NewAbuseIPDB(key string, minScore int, timeout, ttl time.Duration, rateLimit int) *AbuseIPDB {
+	return &AbuseIPDB{key: key, minScore: minScore, client: &http.Client{Timeout: timeout}, cache: reputationCache{ttl: ttl, rateLimit: rateLimit}}
+}
+
+func (a *AbuseIPDB) LookupReputation(ip string) *Reputation {
+	return a.cache.lookup(ip, a.query)
+}
+
+func (a *AbuseIPDB) query(ip string) (*Reputation, error) {
+	var result struct {
+		Data struct {
+			AbuseConfidenceScore int    `json:"abuseConfidenceScore"`
+			IsWhitelisted        bool   `json:"isWhitelisted"`
+			Domain               string `json:"domain"`
+		} `json:"data"`
+	}
+	header := http.Header{"Key": {a.key}, "Accept": {"application/json"}}
+	found, err := getJSON(a.client, abuseIPDBAPI+"/check?"+url.Values{"ipAddress": {ip}, "maxAgeInDays": {"90"}}.Encode(), header, &result)
+	if err != nil || !found {
+		return nil, err
+	}
+	reputation := &Reputation{Source: "abuseipdb", Classification: ReputationUnknown, Score: result.Data.AbuseConfidenceScore, Name: result.Data.Domain}
+	switch {
+	case result.Data.IsWhitelisted:
+		reputation.Classification = ReputationBenign
+	case reputation.Score >= a.minScore:
+		reputation.Classification = ReputationMalicious
+	}
+	return reputation, nil
+}
+
+// GreyNoise asks the GreyNoise community API whether addresses are known
+// to scan the internet, answers are cached for ttl and at most rateLimit
+// queries are made a minute
+type GreyNoise struct {
+	key    string
+	client *http.Client
+	cache  reputationCache
+}
+
+func NewGreyNoise(key string, timeout, ttl time.Duration, rateLimit int) *GreyNoise {
+	return &GreyNoise{key: key, client: &http.Client{Timeout: timeout}, cache: reputationCache{ttl: ttl, rateLimit: rateLimit}}
+}
+
+func (g *GreyNoise) LookupReputation(ip string) *Reputation {
+	return g.cache.lookup(ip, g.query)
+}
+
+func (g *GreyNoise) query(ip string) (*Reputation, error) {
+	var result struct {
+		Noise          bool   `json:"noise"`
+		RIOT           bool   `json:"riot"`
+		Classification string `json:"classification"`
+		Name           string `json:"name"`
+	}
+	header := http.Header{"Accept": {"application/json"}}
+	if g.key != "" {
+		header.Set("key", g.key)
+	}
+	found, err := getJSON(g.client, greyNoiseAPI+"/community/"+url.PathEscape(ip), header, &result)
+	if err != nil || !found {
+		// addresses GreyNoise has not seen are cached without a reputation
+		return nil, err
+	}
+	reputation := &Reputation{Source: "greynoise", Classification: result.Classification, Scanner: result.Noise, Name: result.Name}
+	if result.RIOT {
+		// common business services
+		reputation.Classification = ReputationBenign
+	}
+	if reputation.Classification == "" {
+		reputation.Classification = ReputationUnknown
+	}
+	return reputation, nil
+}
@@ -0,0 +1,108 @@
+package connection
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// resolvedReputation looks ip up and waits for the background query
+func resolvedReputation(t *testing.T, c *reputationCache, lookup func(string) *Reputation, ip string) *Reputation {
+	lookup(ip)
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return !c.pending[ip]
+	}, time.Second, time.Millisecond)
+	return lookup(ip)
+}
+
+func TestGreyNoise(t *testing.T) {
+	var queries atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		require.Equal(t, "key", r.Header.Get("key"))
+		switch r.URL.Path {
+		case "/community/71.6.135.131":
+			w.Write([]byte(`{"ip": "71.6.135.131", "noise": true, "riot": false, "classification": "benign", "name": "Shodan.io"}`))
+		case "/community/8.8.8.8":
+			w.Write([]byte(`{"ip": "8.8.8.8", "noise": false, "riot": true, "name": "Google Public DNS"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer svr.Close()
+	greyNoiseAPI = svr.URL
+
+	g := NewGreyNoise("key", time.Second, time.Hour, 0)
+	lookup := func(ip string) *Reputation { return resolvedReputation(t, &g.cache, g.LookupReputation, ip) }
+	require.Equal(t, &Reputation{Source: "greynoise", Classification: ReputationBenign, Scanner: true, Name: "Shodan.io"}, lookup("71.6.135.131"))
+	require.Equal(t, &Reputation{Source: "greynoise", Classification: ReputationBenign, Name: "Google Public DNS"}, lookup("8.8.8.8"))
+	require.Nil(t, lookup("1.2.3.4"))
+	require.Nil(t, lookup("1.2.3.4"))
+	require.Nil(t, g.LookupReputation("10.0.0.1"))
+	require.Equal(t, int32(3), queries.Load())
+
+	// registering does not wait for the query
+	table := New()
+	table.SetReputation(g)
+	md, err := table.Register("71.6.135.131", "4000", 22, nil)
+	require.NoError(t, err)
+	require.Equal(t, "Shodan.io", md.Reputation.Name)
+	require.Equal(t, []string{"known_scanner", "known_benign"}, md.Tags)
+	md, err = table.Register("9.9.9.9", "4000", 22, nil)
+	require.NoError(t, err)
+	require.Nil(t, md.Reputation)
+}
+
+func TestAbuseIPDB(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "key", r.Header.Get("Key"))
+		require.Equal(t, "/check", r.URL.Path)
+		switch r.URL.Query().Get("ipAddress") {
+		case "1.2.3.4":
+			w.Write([]byte(`{"data": {"abuseConfidenceScore": 100, "isWhitelisted": false, "domain": "example.com"}}`))
+		case "5.6.7.8":
+			w.Write([]byte(`{"data": {"abuseConfidenceScore": 20, "isWhitelisted": false}}`))
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer svr.Close()
+	abuseIPDBAPI = svr.URL
+
+	a := NewAbuseIPDB("key", 75, time.Second, time.Hour, 0)
+	lookup := func(ip string) *Reputation { return resolvedReputation(t, &a.cache, a.LookupReputation, ip) }
+	require.Equal(t, &Reputation{Source: "abuseipdb", Classification: ReputationMalicious, Score: 100, Name: "example.com"}, lookup("1.2.3.4"))
+	require.Equal(t, []string{}, (&Reputation{Source: "abuseipdb", Classification: ReputationUnknown, Score: 20}).Tags())
+	require.Equal(t, ReputationUnknown, lookup("5.6.7.8").Classification)
+	require.Nil(t, lookup("9.9.9.9"))
+}
+
+func TestReputationCache(t *testing.T) {
+	var queries atomic.Int32
+	failing := func(string) (*Reputation, error) {
+		queries.Add(1)
+		return nil, errors.New("service unavailable")
+	}
+	c := &reputationCache{ttl: time.Hour, rateLimit: 2}
+	lookup := func(ip string) *Reputation { return c.lookup(ip, failing) }
+
+	// failures are cached so an outage is not asked again
+	require.Nil(t, resolvedReputation(t, c, lookup, "1.2.3.4"))
+	require.Nil(t, lookup("1.2.3.4"))
+	require.Equal(t, int32(1), queries.Load())
+
+	// spoofed sources do not run up queries beyond the rate limit
+	require.Nil(t, resolvedReputation(t, c, lookup, "1.2.3.5"))
+	for _, ip := range []string{"1.2.3.6", "1.2.3.7", "1.2.3.8"} {
+		require.Nil(t, lookup(ip))
+	}
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, int32(2), queries.Load())
+}
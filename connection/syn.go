@@ -0,0 +1,154 @@
+package connection
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// synMaxPending bounds the SYNs waiting for their connection to be
+	// accepted, they are dropped once it is reached as scans leave plenty
+	synMaxPending = 65536
+	// synTTL is how long a SYN waits for its connection
+	synTTL = time.Minute
+	// synFilter captures the SYNs opening connections, not the answers
+	synFilter = "tcp[tcpflags] & (tcp-syn|tcp-ack) == tcp-syn"
+)
+
+// SYN is what the packet opening a TCP connection tells about the client
+type SYN struct {
+	TTL uint8
+	// DF is the don't fragment flag, IPID the identification of the packet
+	DF   bool
+	IPID uint16
+	// IPOptions is the length of the IP options
+	IPOptions int
+	// ECN is set when the SYN asks for explicit congestion notification
+	ECN    bool
+	Window uint16
+	// Options are the kinds of the TCP options in the order sent, Padding
+	// the bytes following the end of options
+	Options     []uint8
+	Padding     int
+	MSS         uint16
+	WindowScale uint8
+	// Timestamp is the own timestamp of the timestamps option
+	Timestamp uint32
+	seen      time.Time
+}
+
+// JA4T returns the JA4T fingerprint of the SYN
+func (s SYN) JA4T() string {
+	options := []string{}
+	for _, kind := range s.Options {
+		options = append(options, strconv.Itoa(int(kind)))
+	}
+	list := strings.Join(options, "-")
+	if list == "" {
+		list = "00"
+	}
+	return fmt.Sprintf("%d_%s_%d_%d", s.Window, list, s.MSS, s.WindowScale)
+}
+
+// parseSYN reads the source and the SYN of a captured packet
+func parseSYN(packet gopacket.Packet) (net.IP, uint16, SYN, error) {
+	ip, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if !ok {
+		return nil, 0, SYN{}, errors.New("not an IPv4 packet")
+	}
+	tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok || !tcp.SYN || tcp.ACK {
+		return nil, 0, SYN{}, errors.New("not a TCP SYN")
+	}
+	syn := SYN{
+		TTL:       ip.TTL,
+		DF:        ip.Flags&layers.IPv4DontFragment != 0,
+		IPID:      ip.Id,
+		IPOptions: int(ip.IHL)*4 - 20,
+		ECN:       tcp.ECE || tcp.CWR,
+		Window:    tcp.Window,
+		Padding:   len(tcp.Padding),
+		seen:      time.Now(),
+	}
+	for _, option := range tcp.Options {
+		syn.Options = append(syn.Options, uint8(option.OptionType))
+		switch option.OptionType {
+		case layers.TCPOptionKindMSS:
+			if len(option.OptionData) == 2 {
+				syn.MSS = uint16(option.OptionData[0])<<8 | uint16(option.OptionData[1])
+			}
+		case layers.TCPOptionKindWindowScale:
+			if len(option.OptionData) == 1 {
+				syn.WindowScale = option.OptionData[0]
+			}
+		case layers.TCPOptionKindTimestamps:
+			if len(option.OptionData) == 8 {
+				syn.Timestamp = binary.BigEndian.Uint32(option.OptionData)
+			}
+		}
+	}
+	return ip.SrcIP, uint16(tcp.SrcPort), syn, nil
+}
+
+// RecordSYN keeps the SYN of a connection until it is registered
+func (t *ConnTable) RecordSYN(srcIP net.IP, srcPort uint16, syn SYN) error {
+	ck, err := newConnKey(layers.NewIPEndpoint(srcIP.To4()), layers.NewTCPPortEndpoint(layers.TCPPort(srcPort)))
+	if err != nil {
+		return err
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if len(t.syns) >= synMaxPending {
+		t.syns = map[CKey]SYN{}
+	}
+	t.syns[ck] = syn
+	return nil
+}
+
+// takeSYN returns the SYN recorded for a connection, callers hold t.mtx
+func (t *ConnTable) takeSYN(ck CKey) (SYN, bool) {
+	syn, ok := t.syns[ck]
+	if !ok {
+		return SYN{}, false
+	}
+	delete(t.syns, ck)
+	return syn, time.Since(syn.seen) < synTTL
+}
+
+// CaptureSYNs records the SYNs received on iface until ctx is done, the
+// connections registered afterwards get their JA4T and p0f fingerprints
+func (t *ConnTable) CaptureSYNs(ctx context.Context, iface string, logger *slog.Logger) error {
+	handle, err := openLive(iface, 128, synFilter)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		handle.Close()
+	}()
+	go func() {
+		source := gopacket.NewPacketSource(handle, handle.LinkType())
+		source.NoCopy = true
+		for packet := range source.Packets() {
+			srcIP, srcPort, syn, err := parseSYN(packet)
+			if err != nil {
+				logger.Debug("Failed to parse captured SYN", slog.Any("error", err))
+				continue
+			}
+			if err := t.RecordSYN(srcIP, srcPort, syn); err != nil {
+				logger.Debug("Failed to record SYN", slog.Any("error", err))
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,43 @@
+package connection
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/mushorg/glutton/rules"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSYN(t *testing.T) {
+	ip := &layers.IPv4{Version: 4, TTL: 57, Flags: layers.IPv4DontFragment, Id: 4321, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP("127.0.0.1"), DstIP: net.ParseIP("127.0.0.2")}
+	tcp := &layers.TCP{SrcPort: 1234, DstPort: 80, SYN: true, Window: 64240, Options: []layers.TCPOption{
+		{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}},
+		{OptionType: layers.TCPOptionKindSACKPermitted, OptionLength: 2},
+		{OptionType: layers.TCPOptionKindTimestamps, OptionLength: 10, OptionData: []byte{0, 0, 0, 1, 0, 0, 0, 0}},
+		{OptionType: layers.TCPOptionKindNop},
+		{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{7}},
+	}}
+	require.NoError(t, tcp.SetNetworkLayerForChecksum(ip))
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, tcp))
+
+	srcIP, srcPort, syn, err := parseSYN(gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default))
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", srcIP.String())
+	require.Equal(t, uint16(1234), srcPort)
+	require.Equal(t, "64240_2-4-8-1-3_1460_7", syn.JA4T())
+	require.Equal(t, "4:57+7:0:1460:mss*44,7:mss,sok,ts,nop,ws:df,id+:0", syn.P0f())
+	require.Equal(t, "Linux", syn.OS())
+
+	table := New()
+	require.NoError(t, table.RecordSYN(srcIP, srcPort, syn))
+	md, err := table.register("127.0.0.1", "1234", 80, &rules.Rule{}, true)
+	require.NoError(t, err)
+	require.Equal(t, "64240_2-4-8-1-3_1460_7", md.Fingerprints.JA4T)
+	require.Equal(t, "Linux", md.Fingerprints.OS)
+	require.Empty(t, table.syns)
+
+	require.Equal(t, "1024_00_0_0", SYN{Window: 1024}.JA4T())
+}
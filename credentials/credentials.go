@@ -0,0 +1,141 @@
+// Package credentials aggregates the credentials captured by the protocol
+// handlers into a report of the most common ones
+package credentials
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Credential is a login attempt captured by a protocol handler
+type Credential struct {
+	Protocol string `json:"protocol"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Hash is what the client sent instead of a cleartext password, in the
+	// format named by HashType
+	Hash     string `json:"hash,omitempty"`
+	HashType string `json:"hash_type,omitempty"`
+	// Success is set if the handler let the client believe it logged in
+	Success bool `json:"success"`
+}
+
+// Count is how often a value was seen
+type Count struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// PairCount is how often a username and password were tried together
+type PairCount struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Count    int    `json:"count"`
+}
+
+// Report lists the most common credentials
+type Report struct {
+	Total     int            `json:"total"`
+	Protocols map[string]int `json:"protocols"`
+	Pairs     []PairCount    `json:"pairs"`
+	Usernames []Count        `json:"usernames"`
+	Passwords []Count        `json:"passwords"`
+}
+
+type pair struct {
+	username string
+	password string
+}
+
+// Stats counts credentials, keeping at most maxEntries distinct values of
+// each kind. Once that is reached the values seen only once are dropped.
+type Stats struct {
+	maxEntries int
+
+	mu        sync.Mutex
+	total     int
+	protocols map[string]int
+	pairs     map[pair]int
+	usernames map[string]int
+	passwords map[string]int
+}
+
+func NewStats(maxEntries int) *Stats {
+	return &Stats{
+		maxEntries: max(maxEntries, 1),
+		protocols:  map[string]int{},
+		pairs:      map[pair]int{},
+		usernames:  map[string]int{},
+		passwords:  map[string]int{},
+	}
+}
+
+// count increments key in m, pruning the long tail if m is full
+func count[K comparable](m map[K]int, key K, maxEntries int) {
+	if _, ok := m[key]; !ok && len(m) >= maxEntries {
+		for k, n := range m {
+			if n == 1 {
+				delete(m, k)
+			}
+		}
+		if len(m) >= maxEntries {
+			return
+		}
+	}
+	m[key]++
+}
+
+// Add counts c, hashes are counted towards the total only as they are
+// salted and rarely repeat
+func (s *Stats) Add(c Credential) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	s.protocols[c.Protocol]++
+	if c.Username != "" {
+		count(s.usernames, c.Username, s.maxEntries)
+	}
+	if c.Password != "" {
+		count(s.passwords, c.Password, s.maxEntries)
+		count(s.pairs, pair{username: c.Username, password: c.Password}, s.maxEntries)
+	}
+}
+
+// top returns the n most common values of m, ties are ordered by value
+func top[K comparable, T any](m map[K]int, n int, value func(K, int) T, less func(a, b K) int) []T {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b K) int {
+		if c := cmp.Compare(m[b], m[a]); c != 0 {
+			return c
+		}
+		return less(a, b)
+	})
+	result := []T{}
+	for _, k := range keys[:min(n, len(keys))] {
+		result = append(result, value(k, m[k]))
+	}
+	return result
+}
+
+// Top reports the n most common pairs, usernames and passwords
+func (s *Stats) Top(n int) Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	countOf := func(k string, c int) Count { return Count{Value: k, Count: c} }
+	return Report{
+		Total:     s.total,
+		Protocols: maps.Clone(s.protocols),
+		Pairs: top(s.pairs, n, func(k pair, c int) PairCount {
+			return PairCount{Username: k.username, Password: k.password, Count: c}
+		}, func(a, b pair) int {
+			return cmp.Or(cmp.Compare(a.username, b.username), cmp.Compare(a.password, b.password))
+		}),
+		Usernames: top(s.usernames, n, countOf, cmp.Compare[string]),
+		Passwords: top(s.passwords, n, countOf, cmp.Compare[string]),
+	}
+}
@@ -0,0 +1,33 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	s := NewStats(4)
+	for range 3 {
+		s.Add(Credential{Protocol: "ssh", Username: "root", Password: "123456"})
+	}
+	s.Add(Credential{Protocol: "telnet", Username: "admin", Password: "admin", Success: true})
+	s.Add(Credential{Protocol: "telnet", Username: "admin", Password: "123456", Success: true})
+	s.Add(Credential{Protocol: "mysql", Username: "root", Hash: "$mysqlna$00*11", HashType: "mysql-native"})
+
+	report := s.Top(2)
+	require.Equal(t, 6, report.Total)
+	require.Equal(t, map[string]int{"ssh": 3, "telnet": 2, "mysql": 1}, report.Protocols)
+	require.Equal(t, []PairCount{{Username: "root", Password: "123456", Count: 3}, {Username: "admin", Password: "123456", Count: 1}}, report.Pairs)
+	require.Equal(t, []Count{{Value: "root", Count: 4}, {Value: "admin", Count: 2}}, report.Usernames)
+	require.Equal(t, []Count{{Value: "123456", Count: 4}, {Value: "admin", Count: 1}}, report.Passwords)
+
+	// pairs seen once make room for new ones once the limit is reached
+	s.Add(Credential{Protocol: "ftp", Username: "anonymous", Password: "guest"})
+	s.Add(Credential{Protocol: "ftp", Username: "ftp", Password: "ftp"})
+	report = s.Top(10)
+	require.Equal(t, []PairCount{
+		{Username: "root", Password: "123456", Count: 3},
+		{Username: "ftp", Password: "ftp", Count: 1},
+	}, report.Pairs)
+}
@@ -4,20 +4,26 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/metrics"
 	"github.com/mushorg/glutton/producer"
 	"github.com/mushorg/glutton/protocols"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/udp"
 	"github.com/mushorg/glutton/rules"
 
 	"github.com/google/uuid"
@@ -57,8 +63,142 @@ func (g *Glutton) initConfig() error {
 	viper.SetDefault("ports.ssh", 22)
 	viper.SetDefault("max_tcp_payload", 4096)
 	viper.SetDefault("conn_timeout", 45)
+	viper.SetDefault("metrics.address", "127.0.0.1:2112")
+	viper.SetDefault("geoip.path", "/var/lib/GeoIP/GeoLite2-City.mmdb")
+	viper.SetDefault("geoip.refresh", "1h")
+	viper.SetDefault("asn.source", "mmdb")
+	viper.SetDefault("asn.path", "/var/lib/GeoIP/GeoLite2-ASN.mmdb")
+	viper.SetDefault("asn.refresh", "1h")
+	viper.SetDefault("asn.cymru.server", "whois.cymru.com:43")
+	viper.SetDefault("asn.cymru.timeout", "2s")
+	viper.SetDefault("asn.cymru.ttl", "24h")
+	viper.SetDefault("ptr.timeout", "2s")
+	viper.SetDefault("ptr.cache_size", 10000)
+	viper.SetDefault("reputation.source", "greynoise")
+	viper.SetDefault("reputation.timeout", "2s")
+	viper.SetDefault("reputation.ttl", "24h")
+	viper.SetDefault("reputation.min_score", 75)
+	viper.SetDefault("reputation.rate_limit", 30)
+	viper.SetDefault("pcap.mode", "session")
+	viper.SetDefault("pcap.dir", "pcap")
+	viper.SetDefault("pcap.max_size", 10)
+	viper.SetDefault("pcap.max_files", 10)
+	viper.SetDefault("pcap.idle_timeout", "2m")
+	viper.SetDefault("transcripts.handlers", []string{"telnet", "ssh", "ftp", "http"})
+	viper.SetDefault("transcripts.dir", "transcripts")
+	viper.SetDefault("transcripts.max_size", 1)
+	viper.SetDefault("credentials.report_interval", "1h")
+	viper.SetDefault("credentials.report_size", 10)
 	viper.SetDefault("rules_path", "rules/rules.yaml")
+	viper.SetDefault("storage.payloads.dir", "payloads")
+	viper.SetDefault("storage.payloads.max_size", 32)
+	viper.SetDefault("storage.payloads.max_total", 10240)
+	viper.SetDefault("storage.s3.region", "us-east-1")
+	viper.SetDefault("storage.s3.prefix", "glutton")
+	viper.SetDefault("storage.s3.keep_local", true)
+	viper.SetDefault("yara.rules_dir", "yara")
+	viper.SetDefault("yara.refresh", "1m")
+	viper.SetDefault("sample_lookup.service", "virustotal")
+	viper.SetDefault("sample_lookup.rate_limit", 4)
+	viper.SetDefault("producers.schema", "native")
+	viper.SetDefault("producers.dlq.dir", "dlq")
+	viper.SetDefault("producers.file.path", "events/glutton.ndjson")
+	viper.SetDefault("producers.file.max_size", 100)
+	viper.SetDefault("producers.file.interval", "24h")
+	viper.SetDefault("producers.file.max_backups", 30)
+	viper.SetDefault("producers.file.compress", true)
+	viper.SetDefault("producers.file.fsync_interval", "1s")
+	viper.SetDefault("producers.http.queue_dir", "queue/http")
+	viper.SetDefault("producers.http.batch_size", 100)
+	viper.SetDefault("producers.http.flush_interval", "5s")
+	viper.SetDefault("producers.http.max_batches", 1000)
+	viper.SetDefault("producers.elasticsearch.index", "glutton")
+	viper.SetDefault("producers.elasticsearch.batch_size", 500)
+	viper.SetDefault("producers.elasticsearch.flush_interval", "5s")
+	viper.SetDefault("producers.elasticsearch.queue_size", 10000)
+	viper.SetDefault("producers.elasticsearch.max_retries", 5)
+	viper.SetDefault("producers.splunk.source", "glutton")
+	viper.SetDefault("producers.splunk.sourcetype", "_json")
+	viper.SetDefault("producers.splunk.batch_size", 100)
+	viper.SetDefault("producers.splunk.flush_interval", "5s")
+	viper.SetDefault("producers.splunk.queue_size", 10000)
+	viper.SetDefault("producers.splunk.max_retries", 5)
+	viper.SetDefault("producers.otlp.endpoint", "http://localhost:4318")
+	viper.SetDefault("producers.otlp.service_name", "glutton")
+	viper.SetDefault("producers.otlp.traces", true)
+	viper.SetDefault("producers.otlp.logs", true)
+	viper.SetDefault("producers.otlp.batch_size", 100)
+	viper.SetDefault("producers.otlp.flush_interval", "5s")
+	viper.SetDefault("producers.otlp.queue_size", 10000)
+	viper.SetDefault("producers.otlp.max_retries", 5)
+	viper.SetDefault("producers.store.driver", "sqlite")
+	viper.SetDefault("producers.store.dsn", "glutton.db")
+	viper.SetDefault("producers.jetstream.stream", "GLUTTON")
+	viper.SetDefault("producers.jetstream.subject", "glutton")
+	viper.SetDefault("producers.jetstream.provision", true)
+	viper.SetDefault("producers.redis.stream", "glutton")
+	viper.SetDefault("producers.redis.maxlen", 100000)
+	viper.SetDefault("producers.grpc.address", "127.0.0.1:9090")
+	viper.SetDefault("producers.alerts.rate_limit", 10)
+	viper.SetDefault("producers.alerts.credentials", true)
+	viper.SetDefault("producers.alerts.new_hashes", true)
+	viper.SetDefault("producers.alerts.burst.events", 100)
+	viper.SetDefault("producers.alerts.burst.window", "1m")
+	viper.SetDefault("producers.stix.dir", "stix")
+	viper.SetDefault("producers.stix.interval", "1h")
+	viper.SetDefault("producers.misp.distribution", "0")
+	viper.SetDefault("producers.misp.threat_level", "3")
+	viper.SetDefault("producers.misp.batch_size", 100)
+	viper.SetDefault("producers.misp.flush_interval", "5s")
+	viper.SetDefault("producers.misp.queue_size", 10000)
+	viper.SetDefault("producers.misp.max_retries", 5)
 	viper.SetDefault("interface", "eth0") // Default interface name
+	viper.SetDefault("replay.size", 4096)
+	viper.SetDefault("replay.ttl", 300)
+	viper.SetDefault("dns.mode", "sinkhole")
+	viper.SetDefault("dns.sinkhole", "127.0.0.1")
+	viper.SetDefault("mdns.respond", false)
+	viper.SetDefault("llmnr.respond", false)
+	viper.SetDefault("snmp.communities", []string{"public", "private"})
+	viper.SetDefault("modbus.vendor", "Schneider Electric")
+	viper.SetDefault("modbus.product_code", "BMX P34 2020")
+	viper.SetDefault("modbus.revision", "v3.10")
+	viper.SetDefault("s7comm.order_code", "6ES7 315-2EH14-0AB0")
+	viper.SetDefault("s7comm.firmware", "V3.2.6")
+	viper.SetDefault("s7comm.system_name", "SIMATIC 300(1)")
+	viper.SetDefault("s7comm.module_name", "CPU 315-2 PN/DP")
+	viper.SetDefault("s7comm.copyright", "Original Siemens Equipment")
+	viper.SetDefault("s7comm.serial_number", "S C-C2UR28922012")
+	viper.SetDefault("s7comm.module_type", "CPU 315-2 PN/DP")
+	viper.SetDefault("dnp3.address", 10)
+	viper.SetDefault("bacnet.instance", 2400)
+	viper.SetDefault("bacnet.vendor_id", 5)
+	viper.SetDefault("bacnet.vendor_name", "Johnson Controls Inc")
+	viper.SetDefault("bacnet.model_name", "NAE5510-2")
+	viper.SetDefault("bacnet.firmware", "9.0.0.4109")
+	viper.SetDefault("bacnet.application_version", "9.0.0")
+	viper.SetDefault("bacnet.object_name", "NAE-01")
+	viper.SetDefault("netbios.name", "FILESRV01")
+	viper.SetDefault("netbios.workgroup", "WORKGROUP")
+	viper.SetDefault("radius.secrets", []string{"testing123", "secret", "radius", "password", "cisco"})
+	viper.SetDefault("ipmi.password", "admin")
+	viper.SetDefault("finger.users", []string{"root", "admin", "oracle"})
+	viper.SetDefault("ident.user", "root")
+	viper.SetDefault("ident.os", "UNIX")
+	viper.SetDefault("erlang.node", "rabbit@rabbitmq")
+	viper.SetDefault("erlang.port", 25672)
+	viper.SetDefault("erlang.cookies", []string{"monster", "secret", "cookie", "rabbit", "erlang"})
+	viper.SetDefault("minecraft.motd", "A Minecraft Server")
+	viper.SetDefault("minecraft.version", "1.20.4")
+	viper.SetDefault("minecraft.max_players", 20)
+	viper.SetDefault("a2s.name", "Valve 2Fort 24/7")
+	viper.SetDefault("a2s.map", "ctf_2fort")
+	viper.SetDefault("x11.open", true)
+	viper.SetDefault("tns.services", []string{"ORCL", "XE"})
+	viper.SetDefault("rsync.modules", map[string]string{"backup": "Nightly backups", "www": "Web root", "data": ""})
+	viper.SetDefault("postgres.auth", "cleartext")
+	viper.SetDefault("socks.simulate_success", true)
+	viper.SetDefault("http.proxy.mode", "success")
 
 	g.Logger.Debug("configuration set successfully", slog.String("reporter", "glutton"))
 	return nil
@@ -131,11 +271,45 @@ func (g *Glutton) Init() error {
 
 	// Initiating log producers
 	if viper.GetBool("producers.enabled") {
-		g.Producer, err = producer.New(g.id.String())
+		g.Producer, err = producer.New(g.id.String(), g.Logger)
 		if err != nil {
 			return err
 		}
 	}
+	if viper.GetBool("geoip.enabled") {
+		geo, err := connection.OpenGeoIP(viper.GetString("geoip.path"), viper.GetDuration("geoip.refresh"))
+		if err != nil {
+			return fmt.Errorf("failed to open GeoIP database: %w", err)
+		}
+		g.connTable.SetGeoIP(geo)
+	}
+	if viper.GetBool("asn.enabled") {
+		switch source := viper.GetString("asn.source"); source {
+		case "mmdb":
+			db, err := connection.OpenASNDatabase(viper.GetString("asn.path"), viper.GetDuration("asn.refresh"))
+			if err != nil {
+				return fmt.Errorf("failed to open ASN database: %w", err)
+			}
+			g.connTable.SetASN(db)
+		case "cymru":
+			g.connTable.SetASN(connection.NewCymruResolver(viper.GetString("asn.cymru.server"), viper.GetDuration("asn.cymru.timeout"), viper.GetDuration("asn.cymru.ttl")))
+		default:
+			return fmt.Errorf("unknown ASN source: %s", source)
+		}
+	}
+	if viper.GetBool("reputation.enabled") {
+		switch source := viper.GetString("reputation.source"); source {
+		case "abuseipdb":
+			g.connTable.SetReputation(connection.NewAbuseIPDB(viper.GetString("reputation.api_key"), viper.GetInt("reputation.min_score"), viper.GetDuration("reputation.timeout"), viper.GetDuration("reputation.ttl"), viper.GetInt("reputation.rate_limit")))
+		case "greynoise":
+			g.connTable.SetReputation(connection.NewGreyNoise(viper.GetString("reputation.api_key"), viper.GetDuration("reputation.timeout"), viper.GetDuration("reputation.ttl"), viper.GetInt("reputation.rate_limit")))
+		default:
+			return fmt.Errorf("unknown reputation source: %s", source)
+		}
+	}
+	if viper.GetBool("ptr.enabled") {
+		g.connTable.SetPTR(connection.NewPTRResolver(viper.GetDuration("ptr.timeout"), viper.GetInt("ptr.cache_size")))
+	}
 	// Initiating protocol handlers
 	g.tcpProtocolHandlers = protocols.MapTCPProtocolHandlers(g.Logger, g)
 	g.udpProtocolHandlers = protocols.MapUDPProtocolHandlers(g.Logger, g)
@@ -147,7 +321,7 @@ func (g *Glutton) udpListen(wg *sync.WaitGroup) {
 	defer func() {
 		wg.Done()
 	}()
-	buffer := make([]byte, 1024)
+	buffer := make([]byte, udp.MaxDatagramSize)
 	for {
 		select {
 		case <-g.ctx.Done():
@@ -179,8 +353,11 @@ func (g *Glutton) udpListen(wg *sync.WaitGroup) {
 		}
 
 		if hfunc, ok := g.udpProtocolHandlers[rule.Target]; ok {
-			data := buffer[:n]
+			// the buffer is reused for the next packet while the handler runs
+			data := bytes.Clone(buffer[:n])
 			go func() {
+				defer g.recoverHandler("udp", rule.Target, nil)
+				defer metrics.TrackSession("udp", rule.Target)()
 				if err := hfunc(g.ctx, srcAddr, dstAddr, data, md); err != nil {
 					g.Logger.Error("Failed to handle UDP payload", producer.ErrAttr(err))
 				}
@@ -189,6 +366,25 @@ func (g *Glutton) udpListen(wg *sync.WaitGroup) {
 	}
 }
 
+// recoverHandler keeps a panicking handler from taking the sensor down with
+// it, the connection of a TCP handler is closed
+func (g *Glutton) recoverHandler(transport, handler string, conn io.Closer) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	g.Logger.Error(
+		"Handler panicked",
+		slog.String("transport", transport),
+		slog.String("handler", handler),
+		slog.Any("panic", r),
+		slog.String("stack", string(debug.Stack())),
+	)
+	if conn != nil {
+		conn.Close()
+	}
+}
+
 func (g *Glutton) tcpListen() {
 	for {
 		select {
@@ -230,6 +426,8 @@ func (g *Glutton) tcpListen() {
 
 		if hfunc, ok := g.tcpProtocolHandlers[rule.Target]; ok {
 			go func() {
+				defer g.recoverHandler("tcp", rule.Target, conn)
+				defer metrics.TrackSession("tcp", rule.Target)()
 				if err := hfunc(g.ctx, conn, md); err != nil {
 					g.Logger.Error("Failed to handle TCP connection", producer.ErrAttr(err), slog.String("handler", rule.Target))
 				}
@@ -238,9 +436,93 @@ func (g *Glutton) tcpListen() {
 	}
 }
 
+// startCapture writes the packets to pcap files, leaving out the SSH port
+// of the host
+func (g *Glutton) startCapture() error {
+	global := false
+	filter := fmt.Sprintf("tcp and not port %d", viper.GetUint32("ports.ssh"))
+	switch mode := viper.GetString("pcap.mode"); mode {
+	case "session":
+	case "global":
+		global = true
+		filter = fmt.Sprintf("not port %d", viper.GetUint32("ports.ssh"))
+	default:
+		return fmt.Errorf("unknown pcap mode: %s", mode)
+	}
+	return g.connTable.StartCapture(g.ctx, viper.GetString("interface"), filter, connection.CaptureConfig{
+		Dir:         viper.GetString("pcap.dir"),
+		Global:      global,
+		MaxSize:     viper.GetInt64("pcap.max_size") << 20,
+		MaxFiles:    viper.GetInt("pcap.max_files"),
+		IdleTimeout: viper.GetDuration("pcap.idle_timeout"),
+	}, g.Logger)
+}
+
+// reportCredentials logs the most common credentials captured so far and
+// writes them to credentials.report_file if it is set
+func (g *Glutton) reportCredentials() {
+	report := helpers.Credentials.Top(viper.GetInt("credentials.report_size"))
+	if report.Total == 0 {
+		return
+	}
+	g.Logger.Info("Top credentials", slog.Any("report", report))
+	path := viper.GetString("credentials.report_file")
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		g.Logger.Error("Failed to marshal credentials report", producer.ErrAttr(err))
+		return
+	}
+	if err := os.WriteFile(path, data, 0o640); err != nil {
+		g.Logger.Error("Failed to write credentials report", producer.ErrAttr(err))
+	}
+}
+
+// startCredentialReport reports the top credentials every
+// credentials.report_interval until the sensor shuts down
+func (g *Glutton) startCredentialReport() {
+	interval := viper.GetDuration("credentials.report_interval")
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				g.reportCredentials()
+			case <-g.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
 // Start the listener, this blocks for new connections
 func (g *Glutton) Start() error {
 	g.startMonitor()
+	g.startCredentialReport()
+
+	if viper.GetBool("metrics.enabled") {
+		addr, err := metrics.Start(g.ctx, viper.GetString("metrics.address"))
+		if err != nil {
+			return fmt.Errorf("failed to start metrics listener: %w", err)
+		}
+		g.Logger.Info("Serving metrics", slog.String("addr", addr.String()))
+	}
+	if viper.GetBool("fingerprints.syn") {
+		if err := g.connTable.CaptureSYNs(g.ctx, viper.GetString("interface"), g.Logger); err != nil {
+			return fmt.Errorf("failed to capture SYNs: %w", err)
+		}
+	}
+	if viper.GetBool("pcap.enabled") {
+		if err := g.startCapture(); err != nil {
+			return fmt.Errorf("failed to start packet capture: %w", err)
+		}
+	}
 
 	sshPort := viper.GetUint32("ports.ssh")
 	if err := setTProxyIPTables(viper.GetString("interface"), g.publicAddrs[0].String(), "tcp", uint32(g.Server.tcpPort), sshPort); err != nil {
@@ -336,25 +618,50 @@ func (g *Glutton) sanitizePayload(payload []byte) []byte {
 	return payload
 }
 
+// collapsed reports if events of a replayed session should be dropped
+func collapsed(md connection.Metadata) bool {
+	return viper.GetBool("replay.collapse") && slices.Contains(md.Tags, "replayed_session")
+}
+
 func (g *Glutton) ProduceTCP(handler string, conn net.Conn, md connection.Metadata, payload []byte, decoded interface{}) error {
-	if g.Producer != nil {
+	if g.Producer != nil && !collapsed(md) {
 		payload = g.sanitizePayload(payload)
+		if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			md.Hostname = g.connTable.Hostname(host)
+		}
 		return g.Producer.LogTCP(handler, conn, md, payload, decoded)
 	}
 	return nil
 }
 
 func (g *Glutton) ProduceUDP(handler string, srcAddr, dstAddr *net.UDPAddr, md connection.Metadata, payload []byte, decoded interface{}) error {
-	if g.Producer != nil {
+	if g.Producer != nil && !collapsed(md) {
 		payload = g.sanitizePayload(payload)
-		return g.Producer.LogUDP("udp", srcAddr, md, payload, decoded)
+		md.Hostname = g.connTable.Hostname(srcAddr.IP.String())
+		return g.Producer.LogUDP(handler, srcAddr, md, payload, decoded)
 	}
 	return nil
 }
 
+// ReplayDeadLetters hands the events in the dead letter queue to the
+// producers again
+func (g *Glutton) ReplayDeadLetters() error {
+	p, err := producer.New(g.id.String(), g.Logger)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	return p.ReplayDeadLetters()
+}
+
 // Shutdown the packet processor
 func (g *Glutton) Shutdown() {
 	g.cancel() // close all connection
+	g.reportCredentials()
+
+	if g.Producer != nil {
+		g.Producer.Close()
+	}
 
 	g.Logger.Info("Flushing TCP iptables")
 	if err := flushTProxyIPTables(viper.GetString("interface"), g.publicAddrs[0].String(), "tcp", uint32(g.Server.tcpPort), uint32(viper.GetInt("ports.ssh"))); err != nil {
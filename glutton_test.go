@@ -1,7 +1,11 @@
 package glutton
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"log/slog"
+	"net"
 	"testing"
 
 	"github.com/spf13/viper"
@@ -17,4 +21,23 @@ func TestNewGlutton(t *testing.T) {
 	g, err := New(context.Background())
 	require.NoError(t, err, "error initializing glutton")
 	require.NotNil(t, g, "nil instance but no error")
-}
\ No newline at end of file
+}
+
+func TestRecoverHandler(t *testing.T) {
+	var logs bytes.Buffer
+	g := &Glutton{Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+	client, server := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer g.recoverHandler("tcp", "dns", server)
+		panic("slice bounds out of range")
+	}()
+	<-done
+	require.Contains(t, logs.String(), "Handler panicked")
+	require.Contains(t, logs.String(), "slice bounds out of range")
+	_, err := server.Write([]byte("x"))
+	require.ErrorIs(t, err, io.ErrClosedPipe, "the connection is closed")
+}
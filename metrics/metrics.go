@@ -0,0 +1,91 @@
+// Package metrics exposes the counters of the sensor to Prometheus
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// Connections counts the connections and flows by the handler they were
+	// given to
+	Connections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "glutton_connections_total",
+		Help: "Connections handed to a protocol handler.",
+	}, []string{"transport", "handler"})
+
+	// ActiveSessions is the number of handlers running
+	ActiveSessions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "glutton_active_sessions",
+		Help: "Sessions currently being handled.",
+	}, []string{"transport"})
+
+	// HandlerDuration is how long handlers took with a connection
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "glutton_handler_duration_seconds",
+		Help:    "Time protocol handlers spent on a connection.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	}, []string{"transport", "handler"})
+
+	// Events counts the events taken by each producer
+	Events = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "glutton_events_total",
+		Help: "Events handed to a producer.",
+	}, []string{"producer"})
+
+	// ProducerErrors counts the events a producer failed to take
+	ProducerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "glutton_producer_errors_total",
+		Help: "Events a producer failed to take.",
+	}, []string{"producer"})
+
+	// DroppedEvents counts the events lost by a producer, because its queue
+	// was full or the backend kept failing
+	DroppedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "glutton_dropped_events_total",
+		Help: "Events dropped by a producer.",
+	}, []string{"producer", "reason"})
+
+	// Credentials counts the credentials captured by each handler
+	Credentials = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "glutton_credentials_total",
+		Help: "Credentials captured by a protocol handler.",
+	}, []string{"handler"})
+)
+
+// TrackSession counts a connection given to handler, the returned function
+// is called once the handler is done with it
+func TrackSession(transport, handler string) func() {
+	Connections.WithLabelValues(transport, handler).Inc()
+	ActiveSessions.WithLabelValues(transport).Inc()
+	start := time.Now()
+	return func() {
+		ActiveSessions.WithLabelValues(transport).Dec()
+		HandlerDuration.WithLabelValues(transport, handler).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Start serves the metrics on addr under /metrics until ctx is done
+func Start(ctx context.Context, addr string) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	return ln.Addr(), nil
+}
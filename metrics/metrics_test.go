@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackSession(t *testing.T) {
+	done := TrackSession("tcp", "test")
+	require.Equal(t, 1.0, testutil.ToFloat64(Connections.WithLabelValues("tcp", "test")))
+	require.Equal(t, 1.0, testutil.ToFloat64(ActiveSessions.WithLabelValues("tcp")))
+	done()
+	require.Equal(t, 0.0, testutil.ToFloat64(ActiveSessions.WithLabelValues("tcp")))
+	require.Equal(t, 1, testutil.CollectAndCount(HandlerDuration))
+}
+
+func TestStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, err := Start(ctx, "127.0.0.1:0")
+	require.NoError(t, err)
+	Events.WithLabelValues("test").Inc()
+
+	resp, err := http.Get("http://" + addr.String() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `glutton_events_total{producer="test"} 1`)
+}
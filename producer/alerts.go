@@ -0,0 +1,196 @@
+package producer
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mushorg/glutton/credentials"
+	"github.com/spf13/viper"
+)
+
+const (
+	alertBacklog = 100
+	// alertMaxSeen bounds the remembered hashes and sources, they are
+	// forgotten once it is reached
+	alertMaxSeen = 100000
+)
+
+var telegramAPI = "https://api.telegram.org"
+
+// alerter sends chat notifications for notable events. Notifications go
+// out at most producers.alerts.rate_limit per minute, the ones over the
+// limit are counted and reported with the next.
+type alerter struct {
+	client *http.Client
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	hashes map[string]bool
+	bursts map[string]*alertBurst
+
+	queue chan string
+	wg    sync.WaitGroup
+}
+
+type alertBurst struct {
+	start  time.Time
+	events int
+}
+
+func newAlerter(client *http.Client, logger *slog.Logger) *alerter {
+	a := &alerter{
+		client: client,
+		logger: logger,
+		hashes: map[string]bool{},
+		bursts: map[string]*alertBurst{},
+		queue:  make(chan string, alertBacklog),
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+// capturedCredential returns the credential of the credential events the
+// protocol handlers produce for every login attempt
+func capturedCredential(event *Event) (credentials.Credential, bool) {
+	var decoded struct {
+		Event string `json:"event"`
+		credentials.Credential
+	}
+	if event.Decoded == nil {
+		return decoded.Credential, false
+	}
+	data, err := json.Marshal(event.Decoded)
+	if err != nil || json.Unmarshal(data, &decoded) != nil || decoded.Event != "credential" {
+		return credentials.Credential{}, false
+	}
+	return decoded.Credential, true
+}
+
+// alerts returns the notifications an event triggers
+func (a *alerter) alerts(event *Event) []string {
+	source := fmt.Sprintf("%s:%s → %s/%d (%s)", event.SrcHost, event.SrcPort, event.Transport, event.DstPort, event.Handler)
+	fields := decodedFields(event)
+	alerts := []string{}
+
+	if viper.GetBool("producers.alerts.credentials") {
+		if cred, ok := capturedCredential(event); ok {
+			secret := cmp.Or(cred.Password, cred.Hash)
+			alerts = append(alerts, fmt.Sprintf("🔑 Credential captured from %s: %q / %q", source, cred.Username, secret))
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if viper.GetBool("producers.alerts.new_hashes") {
+		hashes := map[string]bool{}
+		collectHashes(fields, hashes)
+		for hash := range hashes {
+			if a.hashes[hash] {
+				continue
+			}
+			if len(a.hashes) >= alertMaxSeen {
+				a.hashes = map[string]bool{}
+			}
+			a.hashes[hash] = true
+			alerts = append(alerts, fmt.Sprintf("📦 New payload %s from %s", hash, source))
+		}
+	}
+	if threshold := viper.GetInt("producers.alerts.burst.events"); threshold > 0 {
+		window := viper.GetDuration("producers.alerts.burst.window")
+		burst := a.bursts[event.SrcHost]
+		if burst == nil || event.Timestamp.Sub(burst.start) > window {
+			if len(a.bursts) >= alertMaxSeen {
+				a.bursts = map[string]*alertBurst{}
+			}
+			burst = &alertBurst{start: event.Timestamp}
+			a.bursts[event.SrcHost] = burst
+		}
+		if burst.events++; burst.events == threshold {
+			alerts = append(alerts, fmt.Sprintf("🚨 Burst of %d events within %s from %s", threshold, window, event.SrcHost))
+		}
+	}
+	return alerts
+}
+
+// log queues the notifications of an event, they are dropped when the
+// queue is full
+func (a *alerter) log(event *Event) {
+	for _, alert := range a.alerts(event) {
+		select {
+		case a.queue <- alert:
+		default:
+		}
+	}
+}
+
+func (a *alerter) run() {
+	defer a.wg.Done()
+	sent, suppressed := 0, 0
+	window := time.Now()
+	for alert := range a.queue {
+		if time.Since(window) > time.Minute {
+			sent, window = 0, time.Now()
+		}
+		if sent >= viper.GetInt("producers.alerts.rate_limit") {
+			suppressed++
+			continue
+		}
+		if suppressed > 0 {
+			alert += fmt.Sprintf("\n(%d alerts suppressed by rate limit)", suppressed)
+			suppressed = 0
+		}
+		sent++
+		a.notify(alert)
+	}
+}
+
+// notify posts an alert to every configured chat
+func (a *alerter) notify(text string) {
+	if hook := viper.GetString("producers.alerts.slack.webhook"); hook != "" {
+		a.post(hook, map[string]string{"text": text})
+	}
+	if hook := viper.GetString("producers.alerts.discord.webhook"); hook != "" {
+		a.post(hook, map[string]string{"content": text})
+	}
+	if token := viper.GetString("producers.alerts.telegram.token"); token != "" {
+		a.post(telegramAPI+"/bot"+token+"/sendMessage", map[string]string{
+			"chat_id": viper.GetString("producers.alerts.telegram.chat_id"),
+			"text":    text,
+		})
+	}
+}
+
+func (a *alerter) post(endpoint string, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	resp, err := a.client.Post(endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		// the URL holds the webhook secret or bot token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		a.logger.Error("Failed to send alert", ErrAttr(err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		a.logger.Error("Failed to send alert", slog.String("status", resp.Status))
+	}
+}
+
+func (a *alerter) close() {
+	close(a.queue)
+	a.wg.Wait()
+}
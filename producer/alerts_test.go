@@ -0,0 +1,75 @@
+package producer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlerts(t *testing.T) {
+	viper.Set("producers.alerts.credentials", true)
+	viper.Set("producers.alerts.new_hashes", true)
+	viper.Set("producers.alerts.burst.events", 3)
+	viper.Set("producers.alerts.burst.window", time.Minute)
+	defer viper.Set("producers.alerts.burst.events", 0)
+	a := &alerter{hashes: map[string]bool{}, bursts: map[string]*alertBurst{}}
+
+	ts := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	hash := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	alerts := a.alerts(&Event{Timestamp: ts, SrcHost: "1.2.3.4", Handler: "ssh", Decoded: map[string]any{"event": "credential", "protocol": "ssh", "username": "root", "password": "123456"}})
+	require.Len(t, alerts, 1)
+	require.Contains(t, alerts[0], `"root" / "123456"`)
+	alerts = a.alerts(&Event{Timestamp: ts, SrcHost: "5.6.7.8", Handler: "mysql", Decoded: map[string]any{"event": "credential", "protocol": "mysql", "username": "root", "hash": "$mysqlna$00*11"}})
+	require.Len(t, alerts, 1)
+	require.Contains(t, alerts[0], `"root" / "$mysqlna$00*11"`)
+	// the handler events holding the same login do not alert again
+	require.Empty(t, a.alerts(&Event{Timestamp: ts, SrcHost: "5.6.7.8", Handler: "ssh", Decoded: []map[string]any{{"user": "root", "password": "123456"}}}))
+
+	event := &Event{Timestamp: ts, SrcHost: "1.2.3.4", Handler: "tftp", Decoded: map[string]string{"payload_hash": hash}}
+	alerts = a.alerts(event)
+	require.Len(t, alerts, 1)
+	require.Contains(t, alerts[0], "New payload "+hash)
+	alerts = a.alerts(event)
+	require.Len(t, alerts, 1)
+	require.Contains(t, alerts[0], "Burst of 3 events")
+	require.Empty(t, a.alerts(event))
+
+	event.Timestamp = ts.Add(2 * time.Minute)
+	require.Empty(t, a.alerts(event))
+}
+
+func TestAlerterNotify(t *testing.T) {
+	messages := make(chan map[string]string, 4)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		body["path"] = r.URL.Path
+		messages <- body
+	}))
+	defer svr.Close()
+	telegramAPI = svr.URL
+	viper.Set("producers.alerts.slack.webhook", svr.URL+"/slack")
+	viper.Set("producers.alerts.telegram.token", "token")
+	viper.Set("producers.alerts.telegram.chat_id", "42")
+	viper.Set("producers.alerts.rate_limit", 1)
+	defer func() {
+		viper.Set("producers.alerts.slack.webhook", "")
+		viper.Set("producers.alerts.telegram.token", "")
+	}()
+
+	a := newAlerter(http.DefaultClient, slog.Default())
+	a.queue <- "first"
+	a.queue <- "second"
+	a.close()
+
+	slack, telegram := <-messages, <-messages
+	require.Equal(t, map[string]string{"path": "/slack", "text": "first"}, slack)
+	require.Equal(t, map[string]string{"path": "/bottoken/sendMessage", "chat_id": "42", "text": "first"}, telegram)
+	require.Empty(t, messages)
+}
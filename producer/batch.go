@@ -0,0 +1,117 @@
+package producer
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mushorg/glutton/metrics"
+)
+
+const (
+	enqueueTimeout = time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+var errQueueFull = errors.New("producer queue full")
+
+// batcher collects events into batches handed to send by a single worker.
+// The queue is bounded, when the backend falls behind producing blocks for
+// a moment and then fails instead of piling up events. send returns the
+// events of a batch to retry, these are sent again with exponential
+// backoff.
+type batcher struct {
+	name          string
+	logger        *slog.Logger
+	send          func([]*Event) ([]*Event, error)
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	// dlq takes the batches given up on, it is set before events arrive
+	dlq   *deadLetterQueue
+	queue chan *Event
+	wg    sync.WaitGroup
+}
+
+func newBatcher(name string, logger *slog.Logger, batchSize, queueSize, maxRetries int, flushInterval time.Duration, send func([]*Event) ([]*Event, error)) *batcher {
+	b := &batcher{
+		name:          name,
+		logger:        logger,
+		send:          send,
+		batchSize:     max(batchSize, 1),
+		flushInterval: max(flushInterval, time.Second),
+		maxRetries:    maxRetries,
+		queue:         make(chan *Event, max(queueSize, 1)),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+func (b *batcher) enqueue(event *Event) error {
+	select {
+	case b.queue <- event:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case b.queue <- event:
+		return nil
+	case <-timer.C:
+		return errQueueFull
+	}
+}
+
+func (b *batcher) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	batch := make([]*Event, 0, b.batchSize)
+	for {
+		select {
+		case event, ok := <-b.queue:
+			if !ok {
+				b.flush(batch)
+				return
+			}
+			if batch = append(batch, event); len(batch) < b.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		b.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+func (b *batcher) flush(batch []*Event) {
+	backoff := time.Second
+	for attempt := 0; len(batch) > 0; attempt++ {
+		retry, err := b.send(batch)
+		if err == nil && len(retry) == 0 {
+			return
+		}
+		if err == nil {
+			batch = retry
+		}
+		if attempt == b.maxRetries {
+			b.logger.Error("Failed to ship events", slog.String("producer", b.name), slog.Int("events", len(batch)), ErrAttr(err))
+			metrics.DroppedEvents.WithLabelValues(b.name, "retries_exhausted").Add(float64(len(batch)))
+			if b.dlq != nil {
+				b.dlq.write(b.name, batch, err)
+			}
+			return
+		}
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// close ships the queued events and stops the worker
+func (b *batcher) close() {
+	close(b.queue)
+	b.wg.Wait()
+}
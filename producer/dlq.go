@@ -0,0 +1,143 @@
+package producer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	deadLetterExt = ".ndjson"
+	// replaySuffix marks a dead letter file being replayed, events failing
+	// again go to a new file
+	replaySuffix = ".replay"
+)
+
+// deadLetter is an event a producer gave up on
+type deadLetter struct {
+	Time     time.Time `json:"time"`
+	Producer string    `json:"producer"`
+	Error    string    `json:"error,omitempty"`
+	Event    *Event    `json:"event"`
+}
+
+// deadLetterQueue keeps the events producers failed to ship in
+// producers.dlq.dir, one JSON lines file per producer, until they are
+// replayed with glutton replay-dlq
+type deadLetterQueue struct {
+	dir    string
+	logger *slog.Logger
+	mu     sync.Mutex
+}
+
+func newDeadLetterQueue(logger *slog.Logger) (*deadLetterQueue, error) {
+	q := &deadLetterQueue{dir: viper.GetString("producers.dlq.dir"), logger: logger}
+	if err := os.MkdirAll(q.dir, 0o700); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *deadLetterQueue) path(producer string) string {
+	return filepath.Join(q.dir, producer+deadLetterExt)
+}
+
+// write adds the events a producer gave up on, cause may be nil when the
+// backend kept refusing them
+func (q *deadLetterQueue) write(producer string, events []*Event, cause error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f, err := os.OpenFile(q.path(producer), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		q.logger.Error("Failed to open dead letter queue", slog.String("producer", producer), slog.Int("events", len(events)), ErrAttr(err))
+		return
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, event := range events {
+		letter := deadLetter{Time: time.Now().UTC(), Producer: producer, Event: event}
+		if cause != nil {
+			letter.Error = cause.Error()
+		}
+		if err := enc.Encode(letter); err != nil {
+			q.logger.Error("Failed to write dead letter", slog.String("producer", producer), ErrAttr(err))
+			return
+		}
+	}
+}
+
+// ReplayDeadLetters hands the dead letters to the producers that failed
+// them again. Events failing once more are written back to the queue, dead
+// letters of producers not enabled are left for a later replay.
+func (p *Producer) ReplayDeadLetters() error {
+	if p.dlq == nil {
+		return errors.New("dead letter queue is not enabled")
+	}
+	files, err := filepath.Glob(filepath.Join(p.dlq.dir, "*"+deadLetterExt))
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		// a replay left over from before is taken up first
+		if _, err := os.Stat(path + replaySuffix); err == nil {
+			continue
+		}
+		p.dlq.mu.Lock()
+		err := os.Rename(path, path+replaySuffix)
+		p.dlq.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	replays, err := filepath.Glob(filepath.Join(p.dlq.dir, "*"+deadLetterExt+replaySuffix))
+	if err != nil {
+		return err
+	}
+	for _, replay := range replays {
+		name := strings.TrimSuffix(filepath.Base(replay), deadLetterExt+replaySuffix)
+		if !viper.GetBool("producers." + name + ".enabled") {
+			p.logger.Warn("Skipping dead letters of disabled producer", slog.String("producer", name))
+			continue
+		}
+		if err := p.replay(name, replay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Producer) replay(name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	replayed, failed := 0, 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var letter deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil || letter.Event == nil {
+			p.logger.Error("Skipping invalid dead letter", slog.String("producer", name), ErrAttr(err))
+			continue
+		}
+		if err := p.deliver(name, letter.Event); err != nil {
+			failed++
+			continue
+		}
+		replayed++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	p.logger.Info("Replayed dead letters", slog.String("producer", name), slog.Int("replayed", replayed), slog.Int("failed", failed))
+	return os.Remove(path)
+}
@@ -0,0 +1,91 @@
+package producer
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterReplay(t *testing.T) {
+	var up atomic.Bool
+	var added atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		added.Add(1)
+	}))
+	defer svr.Close()
+	dir := t.TempDir()
+	viper.Set("producers.dlq.enabled", true)
+	viper.Set("producers.dlq.dir", dir)
+	viper.Set("producers.misp.enabled", true)
+	viper.Set("producers.misp.url", svr.URL)
+	viper.Set("producers.misp.event_id", "42")
+	// the batch is given up on at once
+	viper.Set("producers.misp.batch_size", 1)
+	viper.Set("producers.misp.max_retries", 0)
+	defer func() {
+		viper.Set("producers.dlq.enabled", false)
+		viper.Set("producers.misp.enabled", false)
+		viper.Set("producers.misp.event_id", "")
+		viper.Set("producers.misp.batch_size", 100)
+		viper.Set("producers.misp.max_retries", 5)
+	}()
+
+	p, err := New("test", slog.Default())
+	require.NoError(t, err)
+	defer p.Close()
+	event := &Event{Timestamp: time.Now(), SrcHost: "1.2.3.4", Handler: "ssh"}
+	require.NoError(t, p.log(event))
+
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(filepath.Join(dir, "misp.ndjson"))
+		return err == nil && len(data) > 0
+	}, time.Second, time.Millisecond)
+	f, err := os.Open(filepath.Join(dir, "misp.ndjson"))
+	require.NoError(t, err)
+	scanner := bufio.NewScanner(f)
+	require.True(t, scanner.Scan())
+	var letter deadLetter
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &letter))
+	f.Close()
+	require.Equal(t, "misp", letter.Producer)
+	require.Contains(t, letter.Error, "503")
+	require.Equal(t, "1.2.3.4", letter.Event.SrcHost)
+
+	up.Store(true)
+	require.NoError(t, p.ReplayDeadLetters())
+	require.Eventually(t, func() bool { return added.Load() == 1 }, time.Second, time.Millisecond)
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestBatcherDeadLetters(t *testing.T) {
+	q := &deadLetterQueue{dir: t.TempDir(), logger: slog.Default()}
+	b := newBatcher("test", slog.Default(), 10, 10, 0, time.Hour, func(batch []*Event) ([]*Event, error) {
+		return batch[1:], nil
+	})
+	b.dlq = q
+	require.NoError(t, b.enqueue(&Event{SrcHost: "1.2.3.4"}))
+	require.NoError(t, b.enqueue(&Event{SrcHost: "1.2.3.5"}))
+	b.close()
+
+	data, err := os.ReadFile(q.path("test"))
+	require.NoError(t, err)
+	var letter deadLetter
+	require.NoError(t, json.Unmarshal(data, &letter))
+	require.Equal(t, "1.2.3.5", letter.Event.SrcHost)
+}
@@ -0,0 +1,120 @@
+package producer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// esBulk ships events to the _bulk endpoint in batches
+type esBulk struct {
+	*batcher
+	client   *http.Client
+	logger   *slog.Logger
+	endpoint *url.URL
+	index    string
+}
+
+func newESBulk(client *http.Client, logger *slog.Logger) (*esBulk, error) {
+	endpoint, err := url.Parse(viper.GetString("producers.elasticsearch.url"))
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/_bulk"
+	es := &esBulk{
+		client:   client,
+		logger:   logger,
+		endpoint: endpoint,
+		index:    viper.GetString("producers.elasticsearch.index"),
+	}
+	es.batcher = newBatcher("elasticsearch", logger,
+		viper.GetInt("producers.elasticsearch.batch_size"),
+		viper.GetInt("producers.elasticsearch.queue_size"),
+		viper.GetInt("producers.elasticsearch.max_retries"),
+		viper.GetDuration("producers.elasticsearch.flush_interval"),
+		es.send,
+	)
+	return es, nil
+}
+
+// indexName returns the daily index an event is stored in
+func (es *esBulk) indexName(event *Event) string {
+	return es.index + "-" + event.Timestamp.Format("2006.01.02")
+}
+
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+	} `json:"items"`
+}
+
+// send posts a batch to the _bulk endpoint and returns the events rejected
+// with a retryable status, other rejections are logged and dropped
+func (es *esBulk) send(batch []*Event) ([]*Event, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, event := range batch {
+		action := map[string]map[string]string{"create": {"_index": es.indexName(event)}}
+		if err := enc.Encode(action); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(formatEvent("elasticsearch", event)); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, es.endpoint.Scheme+"://"+es.endpoint.Host+es.endpoint.Path, &body)
+	if err != nil {
+		return nil, err
+	}
+	if password, ok := es.endpoint.User.Password(); ok {
+		req.SetBasicAuth(es.endpoint.User.Username(), password)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := es.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("elasticsearch bulk request failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		es.logger.Error("Elasticsearch rejected bulk request", slog.String("status", resp.Status), slog.String("response", string(data)))
+		return nil, nil
+	}
+	var result esBulkResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	retry, rejected := []*Event{}, 0
+	for i, item := range result.Items {
+		for _, status := range item {
+			switch {
+			case i >= len(batch), status.Status < 300:
+			case status.Status == http.StatusTooManyRequests || status.Status >= 500:
+				retry = append(retry, batch[i])
+			default:
+				rejected++
+			}
+		}
+	}
+	if rejected > 0 {
+		es.logger.Error("Elasticsearch rejected events", slog.Int("events", rejected))
+	}
+	return retry, nil
+}
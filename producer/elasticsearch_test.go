@@ -0,0 +1,60 @@
+package producer
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestESBulk(t *testing.T) {
+	var mu sync.Mutex
+	indices := []string{}
+	requests := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/_bulk", r.URL.Path)
+		require.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		scanner := bufio.NewScanner(r.Body)
+		for i := 0; scanner.Scan(); i++ {
+			if i%2 == 0 {
+				var action map[string]map[string]string
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+				indices = append(indices, action["create"]["_index"])
+			}
+		}
+		// the second event of the first request is throttled
+		if requests == 1 {
+			_, _ = w.Write([]byte(`{"errors":true,"items":[{"create":{"status":201}},{"create":{"status":429}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errors":false,"items":[{"create":{"status":201}}]}`))
+	}))
+	defer svr.Close()
+
+	viper.Set("producers.elasticsearch.url", svr.URL)
+	viper.Set("producers.elasticsearch.index", "glutton")
+	viper.Set("producers.elasticsearch.batch_size", 2)
+	viper.Set("producers.elasticsearch.flush_interval", time.Minute)
+	viper.Set("producers.elasticsearch.queue_size", 10)
+	viper.Set("producers.elasticsearch.max_retries", 2)
+	es, err := newESBulk(http.DefaultClient, slog.Default())
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, es.enqueue(&Event{Timestamp: ts, SrcHost: "1.2.3.4"}))
+	require.NoError(t, es.enqueue(&Event{Timestamp: ts.Add(24 * time.Hour), SrcHost: "1.2.3.5"}))
+	es.close()
+
+	require.Equal(t, 2, requests)
+	require.Equal(t, []string{"glutton-2024.03.09", "glutton-2024.03.10", "glutton-2024.03.10"}, indices)
+}
@@ -0,0 +1,288 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: producer/exportpb/export.proto
+
+package exportpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SubscribeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// handlers to stream the events of, all when empty
+	Handlers []string `protobuf:"bytes,1,rep,name=handlers,proto3" json:"handlers,omitempty"`
+	// source networks in CIDR notation, all when empty
+	SourceCidrs   []string `protobuf:"bytes,2,rep,name=source_cidrs,json=sourceCidrs,proto3" json:"source_cidrs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_producer_exportpb_export_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_producer_exportpb_export_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_producer_exportpb_export_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubscribeRequest) GetHandlers() []string {
+	if x != nil {
+		return x.Handlers
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetSourceCidrs() []string {
+	if x != nil {
+		return x.SourceCidrs
+	}
+	return nil
+}
+
+type Event struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Transport string                 `protobuf:"bytes,2,opt,name=transport,proto3" json:"transport,omitempty"`
+	SrcHost   string                 `protobuf:"bytes,3,opt,name=src_host,json=srcHost,proto3" json:"src_host,omitempty"`
+	SrcPort   string                 `protobuf:"bytes,4,opt,name=src_port,json=srcPort,proto3" json:"src_port,omitempty"`
+	DstPort   uint32                 `protobuf:"varint,5,opt,name=dst_port,json=dstPort,proto3" json:"dst_port,omitempty"`
+	SensorId  string                 `protobuf:"bytes,6,opt,name=sensor_id,json=sensorId,proto3" json:"sensor_id,omitempty"`
+	Rule      string                 `protobuf:"bytes,7,opt,name=rule,proto3" json:"rule,omitempty"`
+	Handler   string                 `protobuf:"bytes,8,opt,name=handler,proto3" json:"handler,omitempty"`
+	Payload   []byte                 `protobuf:"bytes,9,opt,name=payload,proto3" json:"payload,omitempty"`
+	Scanner   string                 `protobuf:"bytes,10,opt,name=scanner,proto3" json:"scanner,omitempty"`
+	Tags      []string               `protobuf:"bytes,11,rep,name=tags,proto3" json:"tags,omitempty"`
+	// decoded protocol fields as JSON
+	Decoded       string `protobuf:"bytes,12,opt,name=decoded,proto3" json:"decoded,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_producer_exportpb_export_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_producer_exportpb_export_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_producer_exportpb_export_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Event) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Event) GetTransport() string {
+	if x != nil {
+		return x.Transport
+	}
+	return ""
+}
+
+func (x *Event) GetSrcHost() string {
+	if x != nil {
+		return x.SrcHost
+	}
+	return ""
+}
+
+func (x *Event) GetSrcPort() string {
+	if x != nil {
+		return x.SrcPort
+	}
+	return ""
+}
+
+func (x *Event) GetDstPort() uint32 {
+	if x != nil {
+		return x.DstPort
+	}
+	return 0
+}
+
+func (x *Event) GetSensorId() string {
+	if x != nil {
+		return x.SensorId
+	}
+	return ""
+}
+
+func (x *Event) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *Event) GetHandler() string {
+	if x != nil {
+		return x.Handler
+	}
+	return ""
+}
+
+func (x *Event) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Event) GetScanner() string {
+	if x != nil {
+		return x.Scanner
+	}
+	return ""
+}
+
+func (x *Event) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Event) GetDecoded() string {
+	if x != nil {
+		return x.Decoded
+	}
+	return ""
+}
+
+var File_producer_exportpb_export_proto protoreflect.FileDescriptor
+
+const file_producer_exportpb_export_proto_rawDesc = "" +
+	"\n" +
+	"\x1eproducer/exportpb/export.proto\x12\x11glutton.export.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"Q\n" +
+	"\x10SubscribeRequest\x12\x1a\n" +
+	"\bhandlers\x18\x01 \x03(\tR\bhandlers\x12!\n" +
+	"\fsource_cidrs\x18\x02 \x03(\tR\vsourceCidrs\"\xdd\x02\n" +
+	"\x05Event\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1c\n" +
+	"\ttransport\x18\x02 \x01(\tR\ttransport\x12\x19\n" +
+	"\bsrc_host\x18\x03 \x01(\tR\asrcHost\x12\x19\n" +
+	"\bsrc_port\x18\x04 \x01(\tR\asrcPort\x12\x19\n" +
+	"\bdst_port\x18\x05 \x01(\rR\adstPort\x12\x1b\n" +
+	"\tsensor_id\x18\x06 \x01(\tR\bsensorId\x12\x12\n" +
+	"\x04rule\x18\a \x01(\tR\x04rule\x12\x18\n" +
+	"\ahandler\x18\b \x01(\tR\ahandler\x12\x18\n" +
+	"\apayload\x18\t \x01(\fR\apayload\x12\x18\n" +
+	"\ascanner\x18\n" +
+	" \x01(\tR\ascanner\x12\x12\n" +
+	"\x04tags\x18\v \x03(\tR\x04tags\x12\x18\n" +
+	"\adecoded\x18\f \x01(\tR\adecoded2[\n" +
+	"\vEventExport\x12L\n" +
+	"\tSubscribe\x12#.glutton.export.v1.SubscribeRequest\x1a\x18.glutton.export.v1.Event0\x01B.Z,github.com/mushorg/glutton/producer/exportpbb\x06proto3"
+
+var (
+	file_producer_exportpb_export_proto_rawDescOnce sync.Once
+	file_producer_exportpb_export_proto_rawDescData []byte
+)
+
+func file_producer_exportpb_export_proto_rawDescGZIP() []byte {
+	file_producer_exportpb_export_proto_rawDescOnce.Do(func() {
+		file_producer_exportpb_export_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_producer_exportpb_export_proto_rawDesc), len(file_producer_exportpb_export_proto_rawDesc)))
+	})
+	return file_producer_exportpb_export_proto_rawDescData
+}
+
+var file_producer_exportpb_export_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_producer_exportpb_export_proto_goTypes = []any{
+	(*SubscribeRequest)(nil),      // 0: glutton.export.v1.SubscribeRequest
+	(*Event)(nil),                 // 1: glutton.export.v1.Event
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_producer_exportpb_export_proto_depIdxs = []int32{
+	2, // 0: glutton.export.v1.Event.timestamp:type_name -> google.protobuf.Timestamp
+	0, // 1: glutton.export.v1.EventExport.Subscribe:input_type -> glutton.export.v1.SubscribeRequest
+	1, // 2: glutton.export.v1.EventExport.Subscribe:output_type -> glutton.export.v1.Event
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_producer_exportpb_export_proto_init() }
+func file_producer_exportpb_export_proto_init() {
+	if File_producer_exportpb_export_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_producer_exportpb_export_proto_rawDesc), len(file_producer_exportpb_export_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_producer_exportpb_export_proto_goTypes,
+		DependencyIndexes: file_producer_exportpb_export_proto_depIdxs,
+		MessageInfos:      file_producer_exportpb_export_proto_msgTypes,
+	}.Build()
+	File_producer_exportpb_export_proto = out.File
+	file_producer_exportpb_export_proto_goTypes = nil
+	file_producer_exportpb_export_proto_depIdxs = nil
+}
@@ -0,0 +1,132 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: producer/exportpb/export.proto
+
+package exportpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EventExport_Subscribe_FullMethodName = "/glutton.export.v1.EventExport/Subscribe"
+)
+
+// EventExportClient is the client API for EventExport service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// EventExport streams the events of a sensor as they are produced
+type EventExportClient interface {
+	// Subscribe streams the events matching the request until the client
+	// cancels. Events are dropped for clients falling behind.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type eventExportClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventExportClient(cc grpc.ClientConnInterface) EventExportClient {
+	return &eventExportClient{cc}
+}
+
+func (c *eventExportClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EventExport_ServiceDesc.Streams[0], EventExport_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventExport_SubscribeClient = grpc.ServerStreamingClient[Event]
+
+// EventExportServer is the server API for EventExport service.
+// All implementations must embed UnimplementedEventExportServer
+// for forward compatibility.
+//
+// EventExport streams the events of a sensor as they are produced
+type EventExportServer interface {
+	// Subscribe streams the events matching the request until the client
+	// cancels. Events are dropped for clients falling behind.
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedEventExportServer()
+}
+
+// UnimplementedEventExportServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEventExportServer struct{}
+
+func (UnimplementedEventExportServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedEventExportServer) mustEmbedUnimplementedEventExportServer() {}
+func (UnimplementedEventExportServer) testEmbeddedByValue()                     {}
+
+// UnsafeEventExportServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EventExportServer will
+// result in compilation errors.
+type UnsafeEventExportServer interface {
+	mustEmbedUnimplementedEventExportServer()
+}
+
+func RegisterEventExportServer(s grpc.ServiceRegistrar, srv EventExportServer) {
+	// If the following call pancis, it indicates UnimplementedEventExportServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EventExport_ServiceDesc, srv)
+}
+
+func _EventExport_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EventExportServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventExport_SubscribeServer = grpc.ServerStreamingServer[Event]
+
+// EventExport_ServiceDesc is the grpc.ServiceDesc for EventExport service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EventExport_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "glutton.export.v1.EventExport",
+	HandlerType: (*EventExportServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _EventExport_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "producer/exportpb/export.proto",
+}
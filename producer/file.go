@@ -0,0 +1,256 @@
+package producer
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// backupTime is the timestamp rotated files are named by, it sorts by time
+const backupTime = "2006-01-02T15-04-05.000"
+
+type rotateConfig struct {
+	// MaxSize in bytes and Interval rotate the file when it would grow past
+	// the size or has been open for the interval, zero disables either
+	MaxSize  int64
+	Interval time.Duration
+	// MaxBackups and MaxAge remove the oldest rotated files, zero keeps them
+	MaxBackups int
+	MaxAge     time.Duration
+	Compress   bool
+	// SyncInterval is how often written data is flushed to disk
+	SyncInterval time.Duration
+}
+
+// rotatingFile is a writer appending to a file which is moved aside to
+// <name>-<time><ext> by size or age. Rotated files are gzipped and pruned
+// in the background, compressed files only appear once they are complete.
+type rotatingFile struct {
+	path   string
+	config rotateConfig
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	dirty  bool
+
+	cleanup sync.Mutex
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newRotatingFile(path string, config rotateConfig, logger *slog.Logger) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, config: config, logger: logger, done: make(chan struct{})}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	if config.SyncInterval > 0 {
+		r.wg.Add(1)
+		go r.syncLoop()
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size, r.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && (r.config.MaxSize > 0 && r.size+int64(len(p)) > r.config.MaxSize ||
+		r.config.Interval > 0 && time.Since(r.opened) >= r.config.Interval) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	r.dirty = true
+	return n, err
+}
+
+// backupName names the file rotated at t
+func (r *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "-" + t.UTC().Format(backupTime) + ext
+}
+
+// rotate moves the file aside and opens a new one, callers hold r.mu
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Sync(); err != nil {
+		return err
+	}
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	backup := r.backupName(time.Now())
+	if err := os.Rename(r.path, backup); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.cleanup.Lock()
+		defer r.cleanup.Unlock()
+		if r.config.Compress {
+			if err := compressFile(backup); err != nil {
+				r.logger.Error("Failed to compress rotated file", slog.String("path", backup), ErrAttr(err))
+			}
+		}
+		r.prune()
+	}()
+	return nil
+}
+
+// compressFile gzips path next to it and removes it, the archive is
+// written to a temporary file first
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// backups lists the rotated files newest first
+func (r *rotatingFile) backups() []string {
+	ext := filepath.Ext(r.path)
+	matches, _ := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-*")
+	backups := slices.DeleteFunc(matches, func(path string) bool {
+		return !strings.HasSuffix(path, ext) && !strings.HasSuffix(path, ext+".gz")
+	})
+	slices.Sort(backups)
+	slices.Reverse(backups)
+	return backups
+}
+
+// prune removes the rotated files beyond the retention limits
+func (r *rotatingFile) prune() {
+	prefix := strings.TrimSuffix(r.path, filepath.Ext(r.path)) + "-"
+	for i, backup := range r.backups() {
+		stamp := strings.TrimPrefix(backup, prefix)
+		rotated, err := time.Parse(backupTime, stamp[:min(len(stamp), len(backupTime))])
+		if err != nil {
+			continue
+		}
+		if r.config.MaxBackups > 0 && i >= r.config.MaxBackups ||
+			r.config.MaxAge > 0 && time.Since(rotated) > r.config.MaxAge {
+			if err := os.Remove(backup); err != nil {
+				r.logger.Error("Failed to remove rotated file", slog.String("path", backup), ErrAttr(err))
+			}
+		}
+	}
+}
+
+func (r *rotatingFile) syncLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			if r.dirty {
+				if err := r.file.Sync(); err != nil {
+					r.logger.Error("Failed to sync file", slog.String("path", r.path), ErrAttr(err))
+				}
+				r.dirty = false
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// Close syncs and closes the file, waiting for rotated files being
+// compressed
+func (r *rotatingFile) Close() error {
+	close(r.done)
+	r.mu.Lock()
+	r.dirty = false
+	err := r.file.Sync()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+func newEventFile(logger *slog.Logger) (*rotatingFile, error) {
+	return newRotatingFile(viper.GetString("producers.file.path"), rotateConfig{
+		MaxSize:      viper.GetInt64("producers.file.max_size") << 20,
+		Interval:     viper.GetDuration("producers.file.interval"),
+		MaxBackups:   viper.GetInt("producers.file.max_backups"),
+		MaxAge:       viper.GetDuration("producers.file.max_age"),
+		Compress:     viper.GetBool("producers.file.compress"),
+		SyncInterval: viper.GetDuration("producers.file.fsync_interval"),
+	}, logger)
+}
+
+// logFile appends an event to the events file as a JSON line
+func (p *Producer) logFile(event *Event) error {
+	data, err := marshalEvent("file", event)
+	if err != nil {
+		return err
+	}
+	_, err = p.file.Write(append(data, '\n'))
+	return err
+}
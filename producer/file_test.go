@@ -0,0 +1,63 @@
+package producer
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	r, err := newRotatingFile(path, rotateConfig{MaxSize: 10, MaxBackups: 2, Compress: true}, slog.Default())
+	require.NoError(t, err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := r.Write([]byte(line))
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.NoError(t, r.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "fourth\n", string(data))
+	backups := r.backups()
+	require.Len(t, backups, 2)
+	for i, want := range []string{"third\n", "second\n"} {
+		require.True(t, strings.HasSuffix(backups[i], ".ndjson.gz"))
+		f, err := os.Open(backups[i])
+		require.NoError(t, err)
+		zr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		got, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		f.Close()
+		require.Equal(t, want, string(got))
+	}
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	r, err := newRotatingFile(path, rotateConfig{Interval: time.Hour, SyncInterval: time.Millisecond}, slog.Default())
+	require.NoError(t, err)
+	_, err = r.Write([]byte("first\n"))
+	require.NoError(t, err)
+	r.mu.Lock()
+	r.opened = r.opened.Add(-time.Hour)
+	r.mu.Unlock()
+	_, err = r.Write([]byte("second\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	backups := r.backups()
+	require.Len(t, backups, 1)
+	data, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(data))
+}
@@ -0,0 +1,118 @@
+package producer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Event severities, from routine noise to captured credentials
+const (
+	severityInfo = iota
+	severityLow
+	severityMedium
+	severityHigh
+)
+
+var severityNames = map[string]int{
+	"info":   severityInfo,
+	"low":    severityLow,
+	"medium": severityMedium,
+	"high":   severityHigh,
+}
+
+// decodedFields returns the decoded part of an event as plain JSON values
+func decodedFields(event *Event) any {
+	var fields any
+	if event.Decoded != nil {
+		data, _ := json.Marshal(event.Decoded)
+		_ = json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+// eventSeverity rates an event: high for captured credentials, medium for
+// stored payloads, low for anything sending data and info for the rest
+func eventSeverity(event *Event) int {
+	if _, ok := capturedCredential(event); ok {
+		return severityHigh
+	}
+	fields := decodedFields(event)
+	hashes := map[string]bool{}
+	if collectHashes(fields, hashes); len(hashes) > 0 {
+		return severityMedium
+	}
+	if payload, _ := base64.StdEncoding.DecodeString(event.Payload); len(payload) > 0 {
+		return severityLow
+	}
+	return severityInfo
+}
+
+// eventFilter selects the events a producer gets from producers.<name>.filter,
+// empty lists match everything
+type eventFilter struct {
+	handlers    []string
+	ports       []uint16
+	networks    []*net.IPNet
+	asns        []uint32
+	excludeTags []string
+	minSeverity int
+}
+
+// newEventFilter reads the filter of a producer, nil if it has none
+func newEventFilter(name string) (*eventFilter, error) {
+	key := "producers." + name + ".filter"
+	if !viper.IsSet(key) {
+		return nil, nil
+	}
+	f := &eventFilter{handlers: viper.GetStringSlice(key + ".handlers")}
+	for _, port := range viper.GetIntSlice(key + ".ports") {
+		f.ports = append(f.ports, uint16(port))
+	}
+	for _, cidr := range viper.GetStringSlice(key + ".cidrs") {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s producer filter: %w", name, err)
+		}
+		f.networks = append(f.networks, network)
+	}
+	for _, asn := range viper.GetIntSlice(key + ".asns") {
+		f.asns = append(f.asns, uint32(asn))
+	}
+	f.excludeTags = viper.GetStringSlice(key + ".exclude_tags")
+	if severity := viper.GetString(key + ".min_severity"); severity != "" {
+		level, ok := severityNames[strings.ToLower(severity)]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s producer filter severity: %s", name, severity)
+		}
+		f.minSeverity = level
+	}
+	return f, nil
+}
+
+func (f *eventFilter) match(event *Event) bool {
+	if len(f.handlers) > 0 && !slices.Contains(f.handlers, event.Handler) {
+		return false
+	}
+	if len(f.ports) > 0 && !slices.Contains(f.ports, event.DstPort) {
+		return false
+	}
+	if len(f.networks) > 0 {
+		ip := net.ParseIP(event.SrcHost)
+		if !slices.ContainsFunc(f.networks, func(network *net.IPNet) bool { return network.Contains(ip) }) {
+			return false
+		}
+	}
+	if len(f.asns) > 0 && (event.AS == nil || !slices.Contains(f.asns, event.AS.Number)) {
+		return false
+	}
+	if slices.ContainsFunc(event.Tags, func(tag string) bool { return slices.Contains(f.excludeTags, tag) }) {
+		return false
+	}
+	return f.minSeverity == severityInfo || eventSeverity(event) >= f.minSeverity
+}
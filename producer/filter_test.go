@@ -0,0 +1,60 @@
+package producer
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventSeverity(t *testing.T) {
+	hash := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	require.Equal(t, severityInfo, eventSeverity(&Event{}))
+	require.Equal(t, severityLow, eventSeverity(&Event{Payload: base64.StdEncoding.EncodeToString([]byte("GET /"))}))
+	require.Equal(t, severityMedium, eventSeverity(&Event{Decoded: map[string]string{"payload_hash": hash}}))
+	require.Equal(t, severityHigh, eventSeverity(&Event{Decoded: map[string]any{"event": "credential", "protocol": "ssh", "username": "root", "password": "toor"}}))
+	// fields named like credentials in other events are not taken for one
+	require.Equal(t, severityInfo, eventSeverity(&Event{Decoded: []map[string]string{{"user": "root", "password": "toor"}}}))
+}
+
+func TestEventFilter(t *testing.T) {
+	filter, err := newEventFilter("kafka")
+	require.NoError(t, err)
+	require.Nil(t, filter)
+
+	viper.Set("producers.kafka.filter", map[string]any{
+		"handlers":     []string{"ssh", "telnet"},
+		"ports":        []int{22},
+		"cidrs":        []string{"1.2.3.0/24"},
+		"min_severity": "high",
+	})
+	defer viper.Set("producers.kafka.filter", nil)
+	filter, err = newEventFilter("kafka")
+	require.NoError(t, err)
+
+	creds := map[string]any{"event": "credential", "protocol": "ssh", "username": "root", "password": "toor"}
+	require.True(t, filter.match(&Event{Handler: "ssh", DstPort: 22, SrcHost: "1.2.3.4", Decoded: creds}))
+	require.False(t, filter.match(&Event{Handler: "ssh", DstPort: 22, SrcHost: "1.2.3.4"}))
+	require.False(t, filter.match(&Event{Handler: "http", DstPort: 22, SrcHost: "1.2.3.4", Decoded: creds}))
+	require.False(t, filter.match(&Event{Handler: "ssh", DstPort: 2222, SrcHost: "1.2.3.4", Decoded: creds}))
+	require.False(t, filter.match(&Event{Handler: "ssh", DstPort: 22, SrcHost: "5.6.7.8", Decoded: creds}))
+
+	viper.Set("producers.kafka.filter", map[string]any{"asns": []int{398324}})
+	filter, err = newEventFilter("kafka")
+	require.NoError(t, err)
+	require.True(t, filter.match(&Event{AS: &connection.ASN{Number: 398324}}))
+	require.False(t, filter.match(&Event{AS: &connection.ASN{Number: 15169}}))
+	require.False(t, filter.match(&Event{}))
+
+	viper.Set("producers.kafka.filter", map[string]any{"exclude_tags": []string{"known_scanner", "known_benign"}})
+	filter, err = newEventFilter("kafka")
+	require.NoError(t, err)
+	require.True(t, filter.match(&Event{Tags: []string{"known_malicious"}}))
+	require.False(t, filter.match(&Event{Tags: []string{"known_malicious", "known_scanner"}}))
+
+	viper.Set("producers.kafka.filter", map[string]any{"min_severity": "critical"})
+	_, err = newEventFilter("kafka")
+	require.Error(t, err)
+}
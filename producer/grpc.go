@@ -0,0 +1,176 @@
+package producer
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/mushorg/glutton/metrics"
+	"github.com/mushorg/glutton/producer/exportpb"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcBacklog is the number of events buffered for a subscriber, events
+// are dropped for subscribers falling further behind
+const grpcBacklog = 256
+
+type grpcSubscriber struct {
+	handlers []string
+	networks []*net.IPNet
+	events   chan *exportpb.Event
+}
+
+func (s *grpcSubscriber) match(event *Event) bool {
+	if len(s.handlers) > 0 && !slices.Contains(s.handlers, event.Handler) {
+		return false
+	}
+	if len(s.networks) == 0 {
+		return true
+	}
+	ip := net.ParseIP(event.SrcHost)
+	return slices.ContainsFunc(s.networks, func(network *net.IPNet) bool {
+		return ip != nil && network.Contains(ip)
+	})
+}
+
+// grpcExporter streams events to the clients subscribed over gRPC
+type grpcExporter struct {
+	exportpb.UnimplementedEventExportServer
+	server      *grpc.Server
+	listener    net.Listener
+	mu          sync.Mutex
+	subscribers map[*grpcSubscriber]struct{}
+}
+
+// newGRPCExporter listens on producers.grpc.address, with TLS when a
+// certificate is configured
+func newGRPCExporter() (*grpcExporter, error) {
+	opts := []grpc.ServerOption{}
+	if cert := viper.GetString("producers.grpc.cert"); cert != "" {
+		creds, err := credentials.NewServerTLSFromFile(cert, viper.GetString("producers.grpc.key"))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	ln, err := net.Listen("tcp", viper.GetString("producers.grpc.address"))
+	if err != nil {
+		return nil, err
+	}
+	e := &grpcExporter{
+		server:      grpc.NewServer(opts...),
+		listener:    ln,
+		subscribers: map[*grpcSubscriber]struct{}{},
+	}
+	exportpb.RegisterEventExportServer(e.server, e)
+	go func() {
+		_ = e.server.Serve(ln)
+	}()
+	return e, nil
+}
+
+// authorize checks the bearer token of a call against producers.grpc.token
+func authorize(md metadata.MD) error {
+	token := viper.GetString("producers.grpc.token")
+	if token == "" {
+		return nil
+	}
+	for _, value := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte("Bearer "+token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid token")
+}
+
+// Subscribe streams the events matching req until the client goes away
+func (e *grpcExporter) Subscribe(req *exportpb.SubscribeRequest, stream grpc.ServerStreamingServer[exportpb.Event]) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if err := authorize(md); err != nil {
+		return err
+	}
+	sub := &grpcSubscriber{handlers: req.Handlers, events: make(chan *exportpb.Event, grpcBacklog)}
+	for _, cidr := range req.SourceCidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid source CIDR %q", cidr)
+		}
+		sub.networks = append(sub.networks, network)
+	}
+
+	e.mu.Lock()
+	e.subscribers[sub] = struct{}{}
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.subscribers, sub)
+		e.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-sub.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func exportEvent(event *Event) *exportpb.Event {
+	payload, _ := base64.StdEncoding.DecodeString(event.Payload)
+	msg := &exportpb.Event{
+		Timestamp: timestamppb.New(event.Timestamp),
+		Transport: event.Transport,
+		SrcHost:   event.SrcHost,
+		SrcPort:   event.SrcPort,
+		DstPort:   uint32(event.DstPort),
+		SensorId:  event.SensorID,
+		Rule:      event.Rule,
+		Handler:   event.Handler,
+		Payload:   payload,
+		Scanner:   event.Scanner,
+		Tags:      event.Tags,
+	}
+	if event.Decoded != nil {
+		if decoded, err := json.Marshal(event.Decoded); err == nil {
+			msg.Decoded = string(decoded)
+		}
+	}
+	return msg
+}
+
+// log hands an event to the matching subscribers without waiting on them
+func (e *grpcExporter) log(event *Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var msg *exportpb.Event
+	for sub := range e.subscribers {
+		if !sub.match(event) {
+			continue
+		}
+		if msg == nil {
+			msg = exportEvent(event)
+		}
+		select {
+		case sub.events <- msg:
+		default:
+			metrics.DroppedEvents.WithLabelValues("grpc", "slow_subscriber").Inc()
+		}
+	}
+}
+
+func (e *grpcExporter) close() {
+	e.server.Stop()
+}
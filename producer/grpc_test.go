@@ -0,0 +1,55 @@
+package producer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mushorg/glutton/producer/exportpb"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCExporter(t *testing.T) {
+	viper.Set("producers.grpc.address", "127.0.0.1:0")
+	viper.Set("producers.grpc.token", "secret")
+	defer viper.Set("producers.grpc.token", "")
+	e, err := newGRPCExporter()
+	require.NoError(t, err)
+	defer e.close()
+
+	conn, err := grpc.NewClient(e.listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := exportpb.NewEventExportClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Subscribe(ctx, &exportpb.SubscribeRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	stream, err = client.Subscribe(ctx, &exportpb.SubscribeRequest{Handlers: []string{"ssh"}, SourceCidrs: []string{"1.2.3.0/24"}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return len(e.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	e.log(&Event{Handler: "http", SrcHost: "1.2.3.4"})
+	e.log(&Event{Handler: "ssh", SrcHost: "5.6.7.8"})
+	e.log(&Event{Handler: "ssh", SrcHost: "1.2.3.4", Payload: "aGVsbG8=", Decoded: map[string]string{"user": "root"}})
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.4", event.SrcHost)
+	require.Equal(t, []byte("hello"), event.Payload)
+	require.JSONEq(t, `{"user":"root"}`, event.Decoded)
+}
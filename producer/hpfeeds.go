@@ -0,0 +1,64 @@
+package producer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+
+	"github.com/d1str0/hpfeeds"
+	"github.com/spf13/viper"
+)
+
+// connectHPFeeds connects to the broker and starts publishing events to
+// producers.hpfeeds.channel. Captured payloads are published on their own
+// to producers.hpfeeds.payload_channel if set, the way dionaea publishes
+// binaries to mwbinary channels.
+func (p *Producer) connectHPFeeds() error {
+	p.hpfClient = hpfeeds.NewClient(
+		viper.GetString("producers.hpfeeds.host"),
+		viper.GetInt("producers.hpfeeds.port"),
+		viper.GetString("producers.hpfeeds.ident"),
+		viper.GetString("producers.hpfeeds.auth"),
+	)
+	if err := p.hpfClient.Connect(); err != nil {
+		return err
+	}
+	p.hpfChannel = make(chan []byte)
+	p.hpfClient.Publish(viper.GetString("producers.hpfeeds.channel"), p.hpfChannel)
+	if channel := viper.GetString("producers.hpfeeds.payload_channel"); channel != "" {
+		p.hpfPayloads = make(chan []byte)
+		p.hpfClient.Publish(channel, p.hpfPayloads)
+	}
+	return nil
+}
+
+// encodeHPFeeds encodes an event in producers.hpfeeds.format, gob unless
+// json is asked for as CHN and HoneyMap consumers expect
+func encodeHPFeeds(event *Event) ([]byte, error) {
+	if viper.GetString("producers.hpfeeds.format") == "json" {
+		return marshalEvent("hpfeeds", event)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// logHPFeeds logs an event to a hpfeeds broker
+func (p *Producer) logHPFeeds(event *Event) error {
+	data, err := encodeHPFeeds(event)
+	if err != nil {
+		return err
+	}
+	p.hpfChannel <- data
+	if p.hpfPayloads == nil || event.Payload == "" {
+		return nil
+	}
+	payload, err := base64.StdEncoding.DecodeString(event.Payload)
+	if err != nil {
+		return err
+	}
+	p.hpfPayloads <- payload
+	return nil
+}
@@ -0,0 +1,40 @@
+package producer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeHPFeeds(t *testing.T) {
+	defer viper.Set("producers.hpfeeds.format", "")
+	event := &Event{SrcHost: "1.2.3.4", Handler: "ssh", DstPort: 22}
+
+	data, err := encodeHPFeeds(event)
+	require.NoError(t, err)
+	var decoded Event
+	require.NoError(t, gob.NewDecoder(bytes.NewReader(data)).Decode(&decoded))
+	require.Equal(t, *event, decoded)
+
+	viper.Set("producers.hpfeeds.format", "json")
+	data, err = encodeHPFeeds(event)
+	require.NoError(t, err)
+	decoded = Event{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, *event, decoded)
+}
+
+func TestLogHPFeedsPayload(t *testing.T) {
+	p := &Producer{hpfChannel: make(chan []byte, 1), hpfPayloads: make(chan []byte, 1)}
+	require.NoError(t, p.logHPFeeds(&Event{Payload: "aGVsbG8="}))
+	require.NotEmpty(t, <-p.hpfChannel)
+	require.Equal(t, []byte("hello"), <-p.hpfPayloads)
+
+	require.NoError(t, p.logHPFeeds(&Event{}))
+	require.NotEmpty(t, <-p.hpfChannel)
+	require.Empty(t, p.hpfPayloads)
+}
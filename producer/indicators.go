@@ -0,0 +1,77 @@
+package producer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Kinds of indicators extracted from events
+const (
+	indicatorIP     = "ip"
+	indicatorURL    = "url"
+	indicatorSHA256 = "sha256"
+)
+
+var (
+	urlPattern    = regexp.MustCompile(`https?://[^\s"'<>\\|^{}]+`)
+	sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+type indicator struct {
+	kind  string
+	value string
+}
+
+// collectHashes gathers the sha256 digests stored payloads are named by
+// from the fields of a decoded event
+func collectHashes(v any, hashes map[string]bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && strings.HasSuffix(key, "hash") && sha256Pattern.MatchString(s) {
+				hashes[s] = true
+				continue
+			}
+			collectHashes(value, hashes)
+		}
+	case []any:
+		for _, value := range v {
+			collectHashes(value, hashes)
+		}
+	}
+}
+
+// extractIndicators returns the source address of an event along with the
+// URLs found in its payload and decoded fields and the hashes of the
+// payloads it stored
+func extractIndicators(event *Event) []indicator {
+	indicators := []indicator{{indicatorIP, event.SrcHost}}
+
+	decoded, _ := json.Marshal(event.Decoded)
+	payload, _ := base64.StdEncoding.DecodeString(event.Payload)
+	urls := map[string]bool{}
+	for _, match := range urlPattern.FindAll(append(payload, decoded...), -1) {
+		url := strings.TrimRight(string(match), ".,;)]")
+		if !urls[url] {
+			urls[url] = true
+			indicators = append(indicators, indicator{indicatorURL, url})
+		}
+	}
+
+	var fields any
+	_ = json.Unmarshal(decoded, &fields)
+	hashes := map[string]bool{}
+	collectHashes(fields, hashes)
+	sorted := make([]string, 0, len(hashes))
+	for hash := range hashes {
+		sorted = append(sorted, hash)
+	}
+	slices.Sort(sorted)
+	for _, hash := range sorted {
+		indicators = append(indicators, indicator{indicatorSHA256, hash})
+	}
+	return indicators
+}
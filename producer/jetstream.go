@@ -0,0 +1,95 @@
+package producer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/spf13/viper"
+)
+
+const jetStreamTimeout = 10 * time.Second
+
+var subjectTokenEscaper = strings.NewReplacer(".", "_", " ", "_", "*", "_", ">", "_")
+
+// jetStreamPublisher publishes events to NATS JetStream, each publish
+// waits for the stream to acknowledge it
+type jetStreamPublisher struct {
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// jetStreamConfig is the stream provisioned for producers.jetstream.subject
+func jetStreamConfig() jetstream.StreamConfig {
+	return jetstream.StreamConfig{
+		Name:       viper.GetString("producers.jetstream.stream"),
+		Subjects:   []string{viper.GetString("producers.jetstream.subject") + ".>"},
+		Storage:    jetstream.FileStorage,
+		MaxAge:     viper.GetDuration("producers.jetstream.max_age"),
+		Duplicates: 2 * time.Minute,
+	}
+}
+
+// jetStreamSubject returns the subject an event is published to,
+// <subject>.<transport>.<handler>
+func jetStreamSubject(event *Event) string {
+	return viper.GetString("producers.jetstream.subject") + "." + subjectTokenEscaper.Replace(event.Transport) + "." + subjectTokenEscaper.Replace(event.Handler)
+}
+
+// newJetStreamPublisher connects to producers.jetstream.url and creates or
+// updates the stream when producers.jetstream.provision is set
+func newJetStreamPublisher() (*jetStreamPublisher, error) {
+	opts := []nats.Option{nats.Name("glutton"), nats.MaxReconnects(-1)}
+	if user := viper.GetString("producers.jetstream.user"); user != "" {
+		opts = append(opts, nats.UserInfo(user, viper.GetString("producers.jetstream.password")))
+	}
+	if token := viper.GetString("producers.jetstream.token"); token != "" {
+		opts = append(opts, nats.Token(token))
+	}
+	if creds := viper.GetString("producers.jetstream.credentials"); creds != "" {
+		opts = append(opts, nats.UserCredentials(creds))
+	}
+	conn, err := nats.Connect(viper.GetString("producers.jetstream.url"), opts...)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if viper.GetBool("producers.jetstream.provision") {
+		ctx, cancel := context.WithTimeout(context.Background(), jetStreamTimeout)
+		defer cancel()
+		if _, err := js.CreateOrUpdateStream(ctx, jetStreamConfig()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &jetStreamPublisher{conn: conn, js: js}, nil
+}
+
+// log publishes an event. A message id lets the stream drop the duplicates
+// of retried publishes.
+func (p *jetStreamPublisher) log(event *Event) error {
+	data, err := marshalEvent("jetstream", event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jetStreamTimeout)
+	defer cancel()
+	_, err = p.js.Publish(ctx, jetStreamSubject(event), data,
+		jetstream.WithMsgID(uuid.NewString()),
+		jetstream.WithRetryAttempts(3),
+	)
+	return err
+}
+
+func (p *jetStreamPublisher) close() {
+	if err := p.conn.Drain(); err != nil {
+		p.conn.Close()
+	}
+}
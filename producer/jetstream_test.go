@@ -0,0 +1,25 @@
+package producer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJetStreamConfig(t *testing.T) {
+	viper.Set("producers.jetstream.stream", "GLUTTON")
+	viper.Set("producers.jetstream.subject", "glutton")
+	viper.Set("producers.jetstream.max_age", "24h")
+
+	cfg := jetStreamConfig()
+	require.Equal(t, "GLUTTON", cfg.Name)
+	require.Equal(t, []string{"glutton.>"}, cfg.Subjects)
+	require.Equal(t, jetstream.FileStorage, cfg.Storage)
+	require.Equal(t, 24*time.Hour, cfg.MaxAge)
+
+	require.Equal(t, "glutton.tcp.ssh", jetStreamSubject(&Event{Transport: "tcp", Handler: "ssh"}))
+	require.Equal(t, "glutton.udp.a_b", jetStreamSubject(&Event{Transport: "udp", Handler: "a.b"}))
+}
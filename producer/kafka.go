@@ -0,0 +1,82 @@
+package producer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const kafkaTimeout = 10 * time.Second
+
+// kafkaMechanism returns the SASL mechanism configured in
+// producers.kafka.sasl, nil when authentication is disabled
+func kafkaMechanism() (sasl.Mechanism, error) {
+	user := viper.GetString("producers.kafka.sasl.username")
+	pass := viper.GetString("producers.kafka.sasl.password")
+	switch mechanism := strings.ToUpper(viper.GetString("producers.kafka.sasl.mechanism")); mechanism {
+	case "":
+		return nil, nil
+	case "PLAIN":
+		return plain.Auth{User: user, Pass: pass}.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: user, Pass: pass}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: user, Pass: pass}.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("unsupported kafka SASL mechanism %q", mechanism)
+	}
+}
+
+// newKafkaClient connects to producers.kafka.brokers. Records are keyed by
+// the source address so the events of a host land in the same partition.
+func newKafkaClient() (*kgo.Client, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(viper.GetStringSlice("producers.kafka.brokers")...),
+		kgo.DefaultProduceTopic(viper.GetString("producers.kafka.topic")),
+		kgo.ProduceRequestTimeout(kafkaTimeout),
+		kgo.AllowAutoTopicCreation(),
+	}
+	if viper.GetBool("producers.kafka.tls.enabled") {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{
+			ServerName:         viper.GetString("producers.kafka.tls.server_name"),
+			InsecureSkipVerify: viper.GetBool("producers.kafka.tls.insecure"),
+		}))
+	}
+	mechanism, err := kafkaMechanism()
+	if err != nil {
+		return nil, err
+	}
+	if mechanism != nil {
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// logKafka publishes an event to the kafka topic
+func (p *Producer) logKafka(event *Event) error {
+	data, err := marshalEvent("kafka", event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	return p.kafkaClient.ProduceSync(ctx, &kgo.Record{Key: []byte(event.SrcHost), Value: data}).FirstErr()
+}
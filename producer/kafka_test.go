@@ -0,0 +1,27 @@
+package producer
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaMechanism(t *testing.T) {
+	defer viper.Set("producers.kafka.sasl.mechanism", "")
+
+	mechanism, err := kafkaMechanism()
+	require.NoError(t, err)
+	require.Nil(t, mechanism)
+
+	for _, name := range []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"} {
+		viper.Set("producers.kafka.sasl.mechanism", name)
+		mechanism, err = kafkaMechanism()
+		require.NoError(t, err)
+		require.Equal(t, name, mechanism.Name())
+	}
+
+	viper.Set("producers.kafka.sasl.mechanism", "GSSAPI")
+	_, err = kafkaMechanism()
+	require.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package producer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+type mispAttribute struct {
+	Type         string    `json:"type"`
+	Category     string    `json:"category"`
+	Value        string    `json:"value"`
+	ToIDS        bool      `json:"to_ids"`
+	Distribution string    `json:"distribution"`
+	Comment      string    `json:"comment,omitempty"`
+	Tag          []mispTag `json:"Tag,omitempty"`
+}
+
+// mispClient adds the indicators seen by the sensor to a MISP instance in
+// batches. Unless producers.misp.event_id names an event to add them to, one
+// event is created per day. Indicators are only sent once a day.
+type mispClient struct {
+	*batcher
+	client   *http.Client
+	sensorID string
+	// day, eventID and seen belong to the worker of the batcher
+	day     string
+	eventID string
+	seen    map[string]bool
+}
+
+func newMISPClient(client *http.Client, sensorID string, logger *slog.Logger) *mispClient {
+	m := &mispClient{client: client, sensorID: sensorID, seen: map[string]bool{}}
+	m.batcher = newBatcher("misp", logger,
+		viper.GetInt("producers.misp.batch_size"),
+		viper.GetInt("producers.misp.queue_size"),
+		viper.GetInt("producers.misp.max_retries"),
+		viper.GetDuration("producers.misp.flush_interval"),
+		m.send,
+	)
+	return m
+}
+
+func mispTags() []mispTag {
+	tags := []mispTag{}
+	for _, name := range viper.GetStringSlice("producers.misp.tags") {
+		tags = append(tags, mispTag{Name: name})
+	}
+	return tags
+}
+
+// mispIndicators maps the indicators of an event to attributes
+func mispIndicators(event *Event) []mispAttribute {
+	comment := fmt.Sprintf("%s on port %d", event.Handler, event.DstPort)
+	attrs := []mispAttribute{}
+	for _, ind := range extractIndicators(event) {
+		attr := mispAttribute{Value: ind.value, ToIDS: true, Comment: comment}
+		switch ind.kind {
+		case indicatorIP:
+			attr.Type, attr.Category = "ip-src", "Network activity"
+		case indicatorURL:
+			attr.Type, attr.Category = "url", "Network activity"
+		case indicatorSHA256:
+			attr.Type, attr.Category = "sha256", "Payload delivery"
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
+func (m *mispClient) post(path string, body any, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(viper.GetString("producers.misp.url"), "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", viper.GetString("producers.misp.key"))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("MISP request to %s failed: %s", path, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// event returns the event to add the indicators of the day to, creating it
+// on the first call of a day
+func (m *mispClient) event(day string) (string, error) {
+	if id := viper.GetString("producers.misp.event_id"); id != "" {
+		return id, nil
+	}
+	if m.day == day && m.eventID != "" {
+		return m.eventID, nil
+	}
+	var created struct {
+		Event struct {
+			ID string `json:"id"`
+		} `json:"Event"`
+	}
+	err := m.post("/events/add", map[string]any{"Event": map[string]any{
+		"info":            fmt.Sprintf("glutton sensor %s %s", m.sensorID, day),
+		"date":            day,
+		"distribution":    viper.GetString("producers.misp.distribution"),
+		"threat_level_id": viper.GetString("producers.misp.threat_level"),
+		"analysis":        "0",
+		"Tag":             mispTags(),
+	}}, &created)
+	if err != nil {
+		return "", err
+	}
+	m.eventID = created.Event.ID
+	return m.eventID, nil
+}
+
+// send adds the indicators of a batch not sent yet, a request per day. The
+// events of the days following a failed one are retried.
+func (m *mispClient) send(batch []*Event) ([]*Event, error) {
+	days := []string{}
+	events := map[string][]*Event{}
+	for _, event := range batch {
+		if isPrivateIP(event.SrcHost) {
+			continue
+		}
+		day := event.Timestamp.Format("2006-01-02")
+		if _, ok := events[day]; !ok {
+			days = append(days, day)
+		}
+		events[day] = append(events[day], event)
+	}
+	for i, day := range days {
+		if err := m.add(day, events[day]); err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			retry := []*Event{}
+			for _, day := range days[i:] {
+				retry = append(retry, events[day]...)
+			}
+			return retry, nil
+		}
+	}
+	return nil, nil
+}
+
+// add sends the indicators of the events of day not sent yet that day
+func (m *mispClient) add(day string, events []*Event) error {
+	if m.day != day {
+		m.day, m.eventID, m.seen = day, "", map[string]bool{}
+	}
+	attrs := []mispAttribute{}
+	queued := map[string]bool{}
+	for _, event := range events {
+		for _, attr := range mispIndicators(event) {
+			key := attr.Type + "|" + attr.Value
+			if m.seen[key] || queued[key] {
+				continue
+			}
+			queued[key] = true
+			attr.Distribution = viper.GetString("producers.misp.distribution")
+			attr.Tag = mispTags()
+			attrs = append(attrs, attr)
+		}
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	id, err := m.event(day)
+	if err != nil {
+		return err
+	}
+	if err := m.post("/attributes/add/"+id, attrs, nil); err != nil {
+		return err
+	}
+	for key := range queued {
+		m.seen[key] = true
+	}
+	return nil
+}
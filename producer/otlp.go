@@ -0,0 +1,279 @@
+package producer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	otlpSpanKindServer = 2
+	otlpSeverityInfo   = 9
+	otlpScopeName      = "github.com/mushorg/glutton"
+)
+
+// otlpValue is an OTLP AnyValue in the JSON encoding, 64 bit integers are
+// sent as strings
+type otlpValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpValue `json:"values"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpKeyValue {
+	s := strconv.FormatInt(value, 10)
+	return otlpKeyValue{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+func otlpStrings(key string, values []string) otlpKeyValue {
+	array := &otlpArrayValue{Values: []otlpValue{}}
+	for _, value := range values {
+		array.Values = append(array.Values, otlpValue{StringValue: &value})
+	}
+	return otlpKeyValue{Key: key, Value: otlpValue{ArrayValue: array}}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpValue      `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"`
+	SpanID               string         `json:"spanId"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+// otlpStart is when the session of an event began, events built outside a
+// connection start with themselves
+func otlpStart(event *Event) time.Time {
+	if event.started.IsZero() {
+		return event.Timestamp
+	}
+	return event.started
+}
+
+// otlpIDs derives the trace and span ids of an event. Every event of a
+// connection or flow shares the trace of the session, the span is the
+// handler producing the event.
+func otlpIDs(event *Event) (string, string) {
+	session := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s|%d|%d", event.SensorID, event.Transport, event.SrcHost, event.SrcPort, event.DstPort, otlpStart(event).UnixNano())))
+	span := sha256.Sum256(append(session[:], fmt.Sprintf("|%s|%d", event.Handler, event.Timestamp.UnixNano())...))
+	return hex.EncodeToString(session[:16]), hex.EncodeToString(span[:8])
+}
+
+// otlpAttributes describes an event with the semantic convention names
+// where there are ones
+func otlpAttributes(event *Event) []otlpKeyValue {
+	port, _ := strconv.Atoi(event.SrcPort)
+	attrs := []otlpKeyValue{
+		otlpString("network.transport", event.Transport),
+		otlpString("client.address", event.SrcHost),
+		otlpInt("client.port", int64(port)),
+		otlpInt("server.port", int64(event.DstPort)),
+		otlpString("glutton.handler", event.Handler),
+	}
+	if event.Rule != "" {
+		attrs = append(attrs, otlpString("glutton.rule", event.Rule))
+	}
+	if event.Scanner != "" {
+		attrs = append(attrs, otlpString("glutton.scanner", event.Scanner))
+	}
+	if len(event.Tags) > 0 {
+		attrs = append(attrs, otlpStrings("glutton.tags", event.Tags))
+	}
+	return attrs
+}
+
+// otlpExporter ships events over OTLP/HTTP with the JSON encoding. Each
+// event becomes a span of its handler in the trace of its session and a
+// log record carrying the event, linked to the span.
+type otlpExporter struct {
+	*batcher
+	client   *http.Client
+	logger   *slog.Logger
+	resource otlpResource
+}
+
+func newOTLPExporter(client *http.Client, sensorID string, logger *slog.Logger) *otlpExporter {
+	o := &otlpExporter{
+		client: client,
+		logger: logger,
+		resource: otlpResource{Attributes: []otlpKeyValue{
+			otlpString("service.name", viper.GetString("producers.otlp.service_name")),
+			otlpString("service.instance.id", sensorID),
+		}},
+	}
+	o.batcher = newBatcher("otlp", logger,
+		viper.GetInt("producers.otlp.batch_size"),
+		viper.GetInt("producers.otlp.queue_size"),
+		viper.GetInt("producers.otlp.max_retries"),
+		viper.GetDuration("producers.otlp.flush_interval"),
+		o.send,
+	)
+	return o
+}
+
+func (o *otlpExporter) traces(batch []*Event) map[string][]otlpResourceSpans {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, event := range batch {
+		traceID, spanID := otlpIDs(event)
+		spans = append(spans, otlpSpan{
+			TraceID:           traceID,
+			SpanID:            spanID,
+			Name:              event.Handler,
+			Kind:              otlpSpanKindServer,
+			StartTimeUnixNano: otlpTime(otlpStart(event)),
+			EndTimeUnixNano:   otlpTime(event.Timestamp),
+			Attributes:        otlpAttributes(event),
+		})
+	}
+	return map[string][]otlpResourceSpans{"resourceSpans": {{
+		Resource:   o.resource,
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: otlpScopeName}, Spans: spans}},
+	}}}
+}
+
+func (o *otlpExporter) logs(batch []*Event) (map[string][]otlpResourceLogs, error) {
+	records := make([]otlpLogRecord, 0, len(batch))
+	for _, event := range batch {
+		data, err := marshalEvent("otlp", event)
+		if err != nil {
+			return nil, err
+		}
+		body := string(data)
+		traceID, spanID := otlpIDs(event)
+		records = append(records, otlpLogRecord{
+			TimeUnixNano:         otlpTime(event.Timestamp),
+			ObservedTimeUnixNano: otlpTime(time.Now()),
+			SeverityNumber:       otlpSeverityInfo,
+			SeverityText:         "INFO",
+			Body:                 otlpValue{StringValue: &body},
+			Attributes:           otlpAttributes(event),
+			TraceID:              traceID,
+			SpanID:               spanID,
+		})
+	}
+	return map[string][]otlpResourceLogs{"resourceLogs": {{
+		Resource:  o.resource,
+		ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: otlpScopeName}, LogRecords: records}},
+	}}}, nil
+}
+
+// send exports the spans and log records of a batch. The ids are derived
+// from the events, a batch sent again after a partial failure repeats the
+// same spans.
+func (o *otlpExporter) send(batch []*Event) ([]*Event, error) {
+	if viper.GetBool("producers.otlp.traces") {
+		if err := o.post("/v1/traces", o.traces(batch)); err != nil {
+			return nil, err
+		}
+	}
+	if viper.GetBool("producers.otlp.logs") {
+		logs, err := o.logs(batch)
+		if err != nil {
+			return nil, err
+		}
+		if err := o.post("/v1/logs", logs); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// post sends an export request, it is retried when the collector is busy
+// or unavailable as the OTLP specification asks
+func (o *otlpExporter) post(path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(viper.GetString("producers.otlp.endpoint"), "/") + path
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range viper.GetStringMapString("producers.otlp.headers") {
+		req.Header.Set(key, value)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("OTLP export to %s failed: %s", path, resp.Status)
+	}
+	data, _ = io.ReadAll(resp.Body)
+	o.logger.Error("OTLP collector rejected events", slog.String("path", path), slog.String("status", resp.Status), slog.String("response", string(data)))
+	return nil
+}
@@ -0,0 +1,81 @@
+package producer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPIDs(t *testing.T) {
+	started := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	first := &Event{Timestamp: started.Add(time.Second), Transport: "tcp", SrcHost: "1.2.3.4", SrcPort: "4000", DstPort: 443, Handler: "tls", started: started}
+	second := &Event{Timestamp: started.Add(2 * time.Second), Transport: "tcp", SrcHost: "1.2.3.4", SrcPort: "4000", DstPort: 443, Handler: "http", started: started}
+	other := &Event{Timestamp: started.Add(time.Second), Transport: "tcp", SrcHost: "1.2.3.4", SrcPort: "4001", DstPort: 443, Handler: "tls", started: started}
+
+	trace, span := otlpIDs(first)
+	require.Len(t, trace, 32)
+	require.Len(t, span, 16)
+	secondTrace, secondSpan := otlpIDs(second)
+	require.Equal(t, trace, secondTrace)
+	require.NotEqual(t, span, secondSpan)
+	otherTrace, _ := otlpIDs(other)
+	require.NotEqual(t, trace, otherTrace)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var traces map[string][]otlpResourceSpans
+	var logs map[string][]otlpResourceLogs
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v1/traces":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&traces))
+		case "/v1/logs":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&logs))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer svr.Close()
+	viper.Set("producers.otlp.endpoint", svr.URL)
+	viper.Set("producers.otlp.headers", map[string]string{"Authorization": "Bearer secret"})
+	viper.Set("producers.otlp.service_name", "glutton")
+	viper.Set("producers.otlp.traces", true)
+	viper.Set("producers.otlp.logs", true)
+	viper.Set("producers.otlp.batch_size", 10)
+
+	o := newOTLPExporter(http.DefaultClient, "test", slog.Default())
+	started := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, o.enqueue(&Event{Timestamp: started.Add(time.Second), Transport: "tcp", SrcHost: "1.2.3.4", SrcPort: "4000", DstPort: 22, Handler: "ssh", Tags: []string{"bruteforce"}, started: started}))
+	o.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, traces["resourceSpans"], 1)
+	resource := traces["resourceSpans"][0].Resource.Attributes
+	require.Equal(t, "service.instance.id", resource[1].Key)
+	require.Equal(t, "test", *resource[1].Value.StringValue)
+	span := traces["resourceSpans"][0].ScopeSpans[0].Spans[0]
+	require.Equal(t, "ssh", span.Name)
+	require.Equal(t, "1709985600000000000", span.StartTimeUnixNano)
+	require.Equal(t, "1709985601000000000", span.EndTimeUnixNano)
+	require.Contains(t, span.Attributes, otlpInt("server.port", 22))
+	require.Contains(t, span.Attributes, otlpStrings("glutton.tags", []string{"bruteforce"}))
+
+	record := logs["resourceLogs"][0].ScopeLogs[0].LogRecords[0]
+	require.Equal(t, span.TraceID, record.TraceID)
+	require.Equal(t, span.SpanID, record.SpanID)
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(*record.Body.StringValue), &event))
+	require.Equal(t, "ssh", event.Handler)
+}
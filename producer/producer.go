@@ -1,21 +1,24 @@
 package producer
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/gob"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/metrics"
 	"github.com/mushorg/glutton/scanner"
+	"github.com/mushorg/glutton/yara"
 
 	"github.com/d1str0/hpfeeds"
 	"github.com/spf13/viper"
+	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 const (
@@ -25,25 +28,61 @@ const (
 
 // Producer for the producer
 type Producer struct {
-	sensorID   string
-	httpClient *http.Client
-	hpfClient  hpfeeds.Client
-	hpfChannel chan []byte
+	sensorID    string
+	logger      *slog.Logger
+	httpClient  *http.Client
+	dlq         *deadLetterQueue
+	filters     map[string]*eventFilter
+	file        *rotatingFile
+	hpfClient   hpfeeds.Client
+	hpfChannel  chan []byte
+	hpfPayloads chan []byte
+	kafkaClient *kgo.Client
+	esBulk      *esBulk
+	misp        *mispClient
+	stix        *stixExporter
+	siem        *siemWriter
+	splunk      *splunkHEC
+	otlp        *otlpExporter
+	store       *Store
+	jetStream   *jetStreamPublisher
+	redis       *redisStream
+	grpc        *grpcExporter
+	webhook     *webhookQueue
+	alerter     *alerter
+	yara        *yaraScanner
+	samples     *sampleLookup
 }
 
 // Event is a struct for glutton events
 type Event struct {
-	Timestamp time.Time   `json:"timestamp,omitempty"`
-	Transport string      `json:"transport,omitempty"`
-	SrcHost   string      `json:"srcHost,omitempty"`
-	SrcPort   string      `json:"srcPort,omitempty"`
-	DstPort   uint16      `json:"dstPort,omitempty"`
-	SensorID  string      `json:"sensorID,omitempty"`
-	Rule      string      `json:"rule,omitempty"`
-	Handler   string      `json:"handler,omitempty"`
-	Payload   string      `json:"payload,omitempty"`
-	Scanner   string      `json:"scanner,omitempty"`
-	Decoded   interface{} `json:"decoded,omitempty"`
+	Timestamp    time.Time                `json:"timestamp,omitempty"`
+	Transport    string                   `json:"transport,omitempty"`
+	SrcHost      string                   `json:"srcHost,omitempty"`
+	SrcPort      string                   `json:"srcPort,omitempty"`
+	Hostname     string                   `json:"hostname,omitempty"`
+	DstPort      uint16                   `json:"dstPort,omitempty"`
+	SensorID     string                   `json:"sensorID,omitempty"`
+	Rule         string                   `json:"rule,omitempty"`
+	Handler      string                   `json:"handler,omitempty"`
+	Payload      string                   `json:"payload,omitempty"`
+	Scanner      string                   `json:"scanner,omitempty"`
+	Tags         []string                 `json:"tags,omitempty"`
+	Geo          *connection.Geo          `json:"geo,omitempty"`
+	AS           *connection.ASN          `json:"as,omitempty"`
+	Reputation   *connection.Reputation   `json:"reputation,omitempty"`
+	Fingerprints *connection.Fingerprints `json:"fingerprints,omitempty"`
+	// PCAP is the id of the capture file holding the packets of the
+	// connection
+	PCAP string `json:"pcap,omitempty"`
+	// Transcript is the id of the recorded session
+	Transcript string `json:"transcript,omitempty"`
+	// YARA are the rules matching the payload or the stored payloads
+	// referenced by the decoded data
+	YARA    []yara.Match `json:"yara,omitempty"`
+	Decoded interface{}  `json:"decoded,omitempty"`
+	// started is when the connection or flow of the event was first seen
+	started time.Time
 }
 
 func makeEventTCP(handler string, conn net.Conn, md connection.Metadata, payload []byte, decoded interface{}, sensorID string) (*Event, error) {
@@ -58,16 +97,25 @@ func makeEventTCP(handler string, conn net.Conn, md connection.Metadata, payload
 	}
 
 	event := Event{
-		Timestamp: time.Now().UTC(),
-		Transport: "tcp",
-		SrcHost:   host,
-		SrcPort:   port,
-		DstPort:   uint16(md.TargetPort),
-		SensorID:  sensorID,
-		Handler:   handler,
-		Payload:   base64.StdEncoding.EncodeToString(payload),
-		Scanner:   scannerName,
-		Decoded:   decoded,
+		Timestamp:    time.Now().UTC(),
+		Transport:    "tcp",
+		SrcHost:      host,
+		SrcPort:      port,
+		Hostname:     md.Hostname,
+		DstPort:      uint16(md.TargetPort),
+		SensorID:     sensorID,
+		Handler:      handler,
+		Payload:      base64.StdEncoding.EncodeToString(payload),
+		Scanner:      scannerName,
+		Tags:         md.Tags,
+		Geo:          md.Geo,
+		AS:           md.AS,
+		Reputation:   md.Reputation,
+		Fingerprints: md.Fingerprints,
+		PCAP:         md.PCAP,
+		Transcript:   md.Transcript,
+		Decoded:      decoded,
+		started:      md.Added,
 	}
 	if md.Rule != nil {
 		event.Rule = md.Rule.String()
@@ -82,16 +130,25 @@ func makeEventUDP(handler string, srcAddr *net.UDPAddr, md connection.Metadata,
 	}
 
 	event := Event{
-		Timestamp: time.Now().UTC(),
-		Transport: "udp",
-		SrcHost:   srcAddr.IP.String(),
-		SrcPort:   strconv.Itoa(int(srcAddr.AddrPort().Port())),
-		DstPort:   uint16(md.TargetPort),
-		SensorID:  sensorID,
-		Handler:   handler,
-		Payload:   base64.StdEncoding.EncodeToString(payload),
-		Scanner:   scannerName,
-		Decoded:   decoded,
+		Timestamp:    time.Now().UTC(),
+		Transport:    "udp",
+		SrcHost:      srcAddr.IP.String(),
+		SrcPort:      strconv.Itoa(int(srcAddr.AddrPort().Port())),
+		Hostname:     md.Hostname,
+		DstPort:      uint16(md.TargetPort),
+		SensorID:     sensorID,
+		Handler:      handler,
+		Payload:      base64.StdEncoding.EncodeToString(payload),
+		Scanner:      scannerName,
+		Tags:         md.Tags,
+		Geo:          md.Geo,
+		AS:           md.AS,
+		Reputation:   md.Reputation,
+		Fingerprints: md.Fingerprints,
+		PCAP:         md.PCAP,
+		Transcript:   md.Transcript,
+		Decoded:      decoded,
+		started:      md.Added,
 	}
 	if md.Rule != nil {
 		event.Rule = md.Rule.String()
@@ -100,9 +157,11 @@ func makeEventUDP(handler string, srcAddr *net.UDPAddr, md connection.Metadata,
 }
 
 // New initializes the producers
-func New(sensorID string) (*Producer, error) {
+func New(sensorID string, logger *slog.Logger) (*Producer, error) {
 	producer := &Producer{
 		sensorID: sensorID,
+		logger:   logger,
+		filters:  map[string]*eventFilter{},
 		httpClient: &http.Client{
 			Transport: &http.Transport{
 				TLSHandshakeTimeout: tlsTimeout,
@@ -110,39 +169,179 @@ func New(sensorID string) (*Producer, error) {
 			Timeout: httpTimeout,
 		},
 	}
+	for _, name := range producerNames {
+		filter, err := newEventFilter(name)
+		if err != nil {
+			return producer, err
+		}
+		if filter != nil {
+			producer.filters[name] = filter
+		}
+	}
+	if viper.GetBool("producers.dlq.enabled") {
+		dlq, err := newDeadLetterQueue(logger)
+		if err != nil {
+			return producer, err
+		}
+		producer.dlq = dlq
+	}
+	if viper.GetBool("producers.file.enabled") {
+		file, err := newEventFile(logger)
+		if err != nil {
+			return producer, err
+		}
+		producer.file = file
+	}
+	if viper.GetBool("producers.http.enabled") {
+		webhook, err := newWebhookQueue(producer.httpClient, logger)
+		if err != nil {
+			return producer, err
+		}
+		producer.webhook = webhook
+	}
 	if viper.GetBool("producers.hpfeeds.enabled") {
-		producer.hpfClient = hpfeeds.NewClient(
-			viper.GetString("producers.hpfeeds.host"),
-			viper.GetInt("producers.hpfeeds.port"),
-			viper.GetString("producers.hpfeeds.ident"),
-			viper.GetString("producers.hpfeeds.auth"),
-		)
-		if err := producer.hpfClient.Connect(); err != nil {
+		if err := producer.connectHPFeeds(); err != nil {
+			return producer, err
+		}
+	}
+	if viper.GetBool("producers.kafka.enabled") {
+		client, err := newKafkaClient()
+		if err != nil {
+			return producer, err
+		}
+		producer.kafkaClient = client
+	}
+	if viper.GetBool("producers.elasticsearch.enabled") {
+		es, err := newESBulk(producer.httpClient, logger)
+		if err != nil {
 			return producer, err
 		}
-		producer.hpfChannel = make(chan []byte)
-		producer.hpfClient.Publish(viper.GetString("producers.hpfeeds.channel"), producer.hpfChannel)
+		es.dlq = producer.dlq
+		producer.esBulk = es
+	}
+	if viper.GetBool("producers.misp.enabled") {
+		producer.misp = newMISPClient(producer.httpClient, sensorID, logger)
+		producer.misp.dlq = producer.dlq
+	}
+	if viper.GetBool("producers.stix.enabled") {
+		stix, err := newSTIXExporter(producer.httpClient, sensorID, logger)
+		if err != nil {
+			return producer, err
+		}
+		producer.stix = stix
+	}
+	if viper.GetBool("producers.siem.enabled") {
+		producer.siem = newSIEMWriter()
+	}
+	if viper.GetBool("producers.splunk.enabled") {
+		producer.splunk = newSplunkHEC(producer.httpClient, logger)
+		producer.splunk.dlq = producer.dlq
+	}
+	if viper.GetBool("producers.otlp.enabled") {
+		producer.otlp = newOTLPExporter(producer.httpClient, sensorID, logger)
+		producer.otlp.dlq = producer.dlq
+	}
+	if viper.GetBool("producers.store.enabled") {
+		store, err := NewStore(viper.GetString("producers.store.driver"), viper.GetString("producers.store.dsn"))
+		if err != nil {
+			return producer, err
+		}
+		producer.store = store
+	}
+	if viper.GetBool("producers.jetstream.enabled") {
+		js, err := newJetStreamPublisher()
+		if err != nil {
+			return producer, err
+		}
+		producer.jetStream = js
+	}
+	if viper.GetBool("producers.redis.enabled") {
+		producer.redis = &redisStream{}
+	}
+	if viper.GetBool("producers.grpc.enabled") {
+		exporter, err := newGRPCExporter()
+		if err != nil {
+			return producer, err
+		}
+		producer.grpc = exporter
+	}
+	if viper.GetBool("producers.alerts.enabled") {
+		producer.alerter = newAlerter(producer.httpClient, logger)
+	}
+	if viper.GetBool("yara.enabled") {
+		scanner, err := newYARAScanner(logger)
+		if err != nil {
+			return producer, fmt.Errorf("failed to load YARA rules: %w", err)
+		}
+		producer.yara = scanner
+	}
+	if viper.GetBool("sample_lookup.enabled") {
+		samples, err := newSampleLookup(producer.httpClient, logger, producer.log)
+		if err != nil {
+			return producer, err
+		}
+		producer.samples = samples
 	}
 	return producer, nil
 }
 
+// Close flushes the events still buffered by the producers
+func (p *Producer) Close() {
+	if p.samples != nil {
+		p.samples.close()
+	}
+	if p.file != nil {
+		p.file.Close()
+	}
+	if p.webhook != nil {
+		p.webhook.close()
+	}
+	if p.kafkaClient != nil {
+		p.kafkaClient.Close()
+	}
+	if p.esBulk != nil {
+		p.esBulk.close()
+	}
+	if p.stix != nil {
+		p.stix.close()
+	}
+	if p.siem != nil {
+		p.siem.close()
+	}
+	if p.splunk != nil {
+		p.splunk.close()
+	}
+	if p.misp != nil {
+		p.misp.close()
+	}
+	if p.otlp != nil {
+		p.otlp.close()
+	}
+	if p.store != nil {
+		p.store.Close()
+	}
+	if p.jetStream != nil {
+		p.jetStream.close()
+	}
+	if p.redis != nil {
+		p.redis.close()
+	}
+	if p.grpc != nil {
+		p.grpc.close()
+	}
+	if p.alerter != nil {
+		p.alerter.close()
+	}
+}
+
 // LogTCP is a meta caller for all producers
 func (p *Producer) LogTCP(handler string, conn net.Conn, md connection.Metadata, payload []byte, decoded interface{}) error {
 	event, err := makeEventTCP(handler, conn, md, payload, decoded, p.sensorID)
 	if err != nil {
 		return err
 	}
-	if viper.GetBool("producers.hpfeeds.enabled") {
-		if err := p.logHPFeeds(event); err != nil {
-			return err
-		}
-	}
-	if viper.GetBool("producers.http.enabled") {
-		if err := p.logHTTP(event); err != nil {
-			return err
-		}
-	}
-	return nil
+	p.enrich(event, payload, decoded)
+	return p.log(event)
 }
 
 // LogUDP is a meta caller for all producers
@@ -151,60 +350,115 @@ func (p *Producer) LogUDP(handler string, srcAddr *net.UDPAddr, md connection.Me
 	if err != nil {
 		return err
 	}
-	if viper.GetBool("producers.hpfeeds.enabled") {
-		if err := p.logHPFeeds(event); err != nil {
-			return err
-		}
+	p.enrich(event, payload, decoded)
+	return p.log(event)
+}
+
+// enrich adds the YARA matches to an event and queues the lookups of the
+// payloads it stored
+func (p *Producer) enrich(event *Event, payload []byte, decoded interface{}) {
+	if p.yara != nil {
+		event.YARA = p.yara.scan(payload, decoded)
 	}
-	if viper.GetBool("producers.http.enabled") {
-		if err := p.logHTTP(event); err != nil {
-			return err
+	if p.samples != nil {
+		p.samples.submit(event)
+	}
+}
+
+// producerNames are the producers in the order events are handed to them
+var producerNames = []string{
+	"file", "hpfeeds", "http", "kafka", "elasticsearch", "misp", "stix", "siem",
+	"splunk", "otlp", "store", "jetstream", "redis", "grpc", "alerts",
+}
+
+// log hands an event to every enabled producer whose filter it passes, a
+// failing producer does not keep the event from the others
+func (p *Producer) log(event *Event) error {
+	errs := []error{}
+	for _, name := range producerNames {
+		if !viper.GetBool("producers." + name + ".enabled") {
+			continue
+		}
+		if filter := p.filters[name]; filter != nil && !filter.match(event) {
+			continue
+		}
+		if err := p.deliver(name, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s producer: %w", name, err))
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
-// logHPFeeds logs an event to a hpfeeds broker
-func (p *Producer) logHPFeeds(event *Event) error {
-	var buf bytes.Buffer
-	if err := gob.NewEncoder(&buf).Encode(event); err != nil {
-		return err
+// deliver hands an event to a producer, events it fails are dead lettered
+func (p *Producer) deliver(name string, event *Event) error {
+	err := p.logTo(name, event)
+	observe(name, err)
+	if err != nil && p.dlq != nil {
+		p.dlq.write(name, []*Event{event}, err)
+	}
+	return err
+}
+
+func (p *Producer) logTo(name string, event *Event) error {
+	switch name {
+	case "file":
+		return p.logFile(event)
+	case "hpfeeds":
+		return p.logHPFeeds(event)
+	case "http":
+		return p.logHTTP(event)
+	case "kafka":
+		return p.logKafka(event)
+	case "elasticsearch":
+		return p.esBulk.enqueue(event)
+	case "misp":
+		return p.misp.enqueue(event)
+	case "stix":
+		p.stix.log(event)
+	case "siem":
+		return p.siem.log(event)
+	case "splunk":
+		return p.splunk.enqueue(event)
+	case "otlp":
+		return p.otlp.enqueue(event)
+	case "store":
+		ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
+		defer cancel()
+		return p.store.Log(ctx, event)
+	case "jetstream":
+		return p.jetStream.log(event)
+	case "redis":
+		return p.redis.log(event)
+	case "grpc":
+		p.grpc.log(event)
+	case "alerts":
+		p.alerter.log(event)
 	}
-	p.hpfChannel <- buf.Bytes()
 	return nil
 }
 
+// observe counts an event taken or refused by a producer
+func observe(producer string, err error) {
+	if err == nil {
+		metrics.Events.WithLabelValues(producer).Inc()
+		return
+	}
+	metrics.ProducerErrors.WithLabelValues(producer).Inc()
+	if errors.Is(err, errQueueFull) {
+		metrics.DroppedEvents.WithLabelValues(producer, "queue_full").Inc()
+	}
+}
+
 // Check if a ip is private.
 func isPrivateIP(ip string) bool {
 	ipAddress := net.ParseIP(ip)
 	return ipAddress.IsPrivate()
 }
 
-// logHTTP send logs to HTTP endpoint
+// logHTTP queues an event for the HTTP endpoint
 func (p *Producer) logHTTP(event *Event) error {
 	if isPrivateIP(event.SrcHost) {
 		return nil
 	}
-	url, err := url.Parse(viper.GetString("producers.http.remote"))
-	if err != nil {
-		return err
-	}
-	data, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequest("POST", url.Scheme+"://"+url.Host+url.Path, bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-	req.URL.RawQuery = url.RawQuery
-	if password, ok := url.User.Password(); ok {
-		req.SetBasicAuth(url.User.Username(), password)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := p.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	return resp.Body.Close()
+	return p.webhook.enqueue(event)
 }
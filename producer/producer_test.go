@@ -1,6 +1,7 @@
 package producer
 
 import (
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -14,15 +15,19 @@ import (
 )
 
 func TestNew(t *testing.T) {
-	p, err := New("test")
+	p, err := New("test", slog.Default())
 	require.NoError(t, err)
 	require.NotNil(t, p)
 }
 
 func TestProducerLog(t *testing.T) {
-	p, err := New("test")
+	viper.Set("producers.http.enabled", true)
+	viper.Set("producers.http.queue_dir", t.TempDir())
+	defer viper.Set("producers.http.enabled", false)
+	p, err := New("test", slog.Default())
 	require.NoError(t, err)
 	require.NotNil(t, p)
+	defer p.Close()
 
 	l, err := net.Listen("tcp", ":1234")
 	require.NoError(t, err)
@@ -35,8 +40,6 @@ func TestProducerLog(t *testing.T) {
 		Rule: &rules.Rule{},
 	}
 
-	viper.Set("producers.http.enabled", true)
-
 	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer svr.Close()
 
@@ -0,0 +1,158 @@
+package producer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// redisStream appends events to a Redis stream with XADD, trimming it to
+// about producers.redis.maxlen entries
+type redisStream struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisCommand encodes a command as a RESP array of bulk strings
+func redisCommand(args ...string) []byte {
+	cmd := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		cmd = append(cmd, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	return cmd
+}
+
+// readRedisReply reads a reply, returning simple and bulk strings and
+// integers as strings. Error replies are returned as errors.
+func readRedisReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 {
+		return "", errors.New("invalid redis reply")
+	}
+	value := line[1 : len(line)-2]
+	switch line[0] {
+	case '+', ':':
+		return value, nil
+	case '-':
+		return "", redisError(value)
+	case '$':
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			return "", err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		return string(data[:size]), nil
+	}
+	return "", fmt.Errorf("unexpected redis reply %q", line[0])
+}
+
+func (s *redisStream) do(args ...string) (string, error) {
+	if err := s.conn.SetDeadline(time.Now().Add(httpTimeout)); err != nil {
+		return "", err
+	}
+	if _, err := s.conn.Write(redisCommand(args...)); err != nil {
+		return "", err
+	}
+	return readRedisReply(s.reader)
+}
+
+// connect dials producers.redis.address and authenticates
+func (s *redisStream) connect() error {
+	address := viper.GetString("producers.redis.address")
+	var conn net.Conn
+	var err error
+	if viper.GetBool("producers.redis.tls") {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: tlsTimeout}, "tcp", address, &tls.Config{})
+	} else {
+		conn, err = net.DialTimeout("tcp", address, tlsTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+	if password := viper.GetString("producers.redis.password"); password != "" {
+		args := []string{"AUTH", password}
+		if user := viper.GetString("producers.redis.username"); user != "" {
+			args = []string{"AUTH", user, password}
+		}
+		if _, err := s.do(args...); err != nil {
+			s.disconnect()
+			return err
+		}
+	}
+	if db := viper.GetInt("producers.redis.db"); db != 0 {
+		if _, err := s.do("SELECT", strconv.Itoa(db)); err != nil {
+			s.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+// log adds an event to the stream. The connection is dropped after any
+// failure but an error reply, and redialed once.
+func (s *redisStream) log(event *Event) error {
+	data, err := marshalEvent("redis", event)
+	if err != nil {
+		return err
+	}
+	args := []string{"XADD", viper.GetString("producers.redis.stream")}
+	if maxlen := viper.GetInt("producers.redis.maxlen"); maxlen > 0 {
+		args = append(args, "MAXLEN", "~", strconv.Itoa(maxlen))
+	}
+	args = append(args, "*", "handler", event.Handler, "src_host", event.SrcHost, "event", string(data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			if err := s.connect(); err != nil {
+				return err
+			}
+		}
+		_, err := s.do(args...)
+		var reply redisError
+		if err == nil || errors.As(err, &reply) {
+			return err
+		}
+		s.disconnect()
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+func (s *redisStream) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *redisStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnect()
+}
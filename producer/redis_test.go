@@ -0,0 +1,68 @@
+package producer
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// readRedisArgs reads a command sent by the client
+func readRedisArgs(t *testing.T, r *bufio.Reader) []string {
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	require.NoError(t, err)
+	args := []string{}
+	for range n {
+		_, err := r.ReadString('\n')
+		require.NoError(t, err)
+		arg, err := r.ReadString('\n')
+		require.NoError(t, err)
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return args
+}
+
+func TestRedisStream(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	commands := make(chan []string, 3)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		commands <- readRedisArgs(t, r)
+		_, _ = conn.Write([]byte("+OK\r\n"))
+		commands <- readRedisArgs(t, r)
+		_, _ = conn.Write([]byte("$15\r\n1709985600000-0\r\n"))
+		commands <- readRedisArgs(t, r)
+		_, _ = conn.Write([]byte("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"))
+	}()
+
+	viper.Set("producers.redis.address", ln.Addr().String())
+	viper.Set("producers.redis.password", "secret")
+	viper.Set("producers.redis.stream", "events")
+	viper.Set("producers.redis.maxlen", 1000)
+	defer viper.Set("producers.redis.password", "")
+	s := &redisStream{}
+	defer s.close()
+
+	require.NoError(t, s.log(&Event{Handler: "ssh", SrcHost: "1.2.3.4"}))
+	require.Equal(t, []string{"AUTH", "secret"}, <-commands)
+	xadd := <-commands
+	require.Equal(t, []string{"XADD", "events", "MAXLEN", "~", "1000", "*", "handler", "ssh", "src_host", "1.2.3.4", "event"}, xadd[:11])
+	require.Contains(t, xadd[11], `"srcHost":"1.2.3.4"`)
+
+	err = s.log(&Event{Handler: "ssh", SrcHost: "1.2.3.4"})
+	require.ErrorContains(t, err, "WRONGTYPE")
+	require.NotNil(t, s.conn)
+}
@@ -0,0 +1,252 @@
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	sampleLookupHandler = "sample_lookup"
+	sampleLookupBacklog = 1000
+
+	serviceVirusTotal    = "virustotal"
+	serviceMalwareBazaar = "malwarebazaar"
+)
+
+var (
+	virusTotalAPI    = "https://www.virustotal.com/api/v3"
+	malwareBazaarAPI = "https://mb-api.abuse.ch/api/v1/"
+)
+
+// SampleReport is what a lookup service knows about a stored payload
+type SampleReport struct {
+	SHA256  string `json:"sha256"`
+	Service string `json:"service"`
+	Found   bool   `json:"found"`
+	// Malicious is the number of the Engines flagging the sample
+	Malicious  int      `json:"malicious,omitempty"`
+	Engines    int      `json:"engines,omitempty"`
+	Label      string   `json:"label,omitempty"`
+	Detections []string `json:"detections,omitempty"`
+	FileType   string   `json:"file_type,omitempty"`
+}
+
+// sampleLookup looks up the hashes of the payloads events store on
+// VirusTotal or MalwareBazaar, each once, and logs the result in a follow
+// up event. Lookups are spread to sample_lookup.rate_limit per minute,
+// hashes arriving while the backlog is full are dropped.
+type sampleLookup struct {
+	client *http.Client
+	logger *slog.Logger
+	// log hands the follow up events to the producers
+	log func(*Event) error
+
+	mu   sync.Mutex
+	seen map[string]bool
+
+	queue chan *Event
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newSampleLookup(client *http.Client, logger *slog.Logger, log func(*Event) error) (*sampleLookup, error) {
+	switch service := viper.GetString("sample_lookup.service"); service {
+	case serviceVirusTotal, serviceMalwareBazaar:
+	default:
+		return nil, fmt.Errorf("unknown sample lookup service: %s", service)
+	}
+	s := &sampleLookup{
+		client: client,
+		logger: logger,
+		log:    log,
+		seen:   map[string]bool{},
+		queue:  make(chan *Event, sampleLookupBacklog),
+		done:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// submit queues a follow up event for every hash of event not looked up
+// before
+func (s *sampleLookup) submit(event *Event) {
+	if event.Handler == sampleLookupHandler {
+		return
+	}
+	hashes := map[string]bool{}
+	collectHashes(decodedFields(event), hashes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash := range hashes {
+		if s.seen[hash] {
+			continue
+		}
+		if len(s.seen) >= alertMaxSeen {
+			s.seen = map[string]bool{}
+		}
+		s.seen[hash] = true
+		followUp := *event
+		followUp.Handler = sampleLookupHandler
+		followUp.Payload = ""
+		followUp.YARA = nil
+		followUp.Decoded = &SampleReport{SHA256: hash}
+		select {
+		case s.queue <- &followUp:
+		default:
+			delete(s.seen, hash)
+		}
+	}
+}
+
+func (s *sampleLookup) run() {
+	defer s.wg.Done()
+	var last time.Time
+	for event := range s.queue {
+		if limit := viper.GetInt("sample_lookup.rate_limit"); limit > 0 {
+			select {
+			case <-time.After(time.Until(last.Add(time.Minute / time.Duration(limit)))):
+			case <-s.done:
+				return
+			}
+		}
+		last = time.Now()
+		report := event.Decoded.(*SampleReport)
+		if err := s.lookup(report); err != nil {
+			s.logger.Error("Failed to look up sample", slog.String("sha256", report.SHA256), ErrAttr(err))
+			continue
+		}
+		event.Timestamp = time.Now().UTC()
+		if err := s.log(event); err != nil {
+			s.logger.Error("Failed to produce sample lookup", ErrAttr(err))
+		}
+	}
+}
+
+// lookup fills in report from the configured service
+func (s *sampleLookup) lookup(report *SampleReport) error {
+	report.Service = viper.GetString("sample_lookup.service")
+	if report.Service == serviceMalwareBazaar {
+		return s.lookupMalwareBazaar(report)
+	}
+	return s.lookupVirusTotal(report)
+}
+
+func (s *sampleLookup) do(req *http.Request, result any) (bool, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return true, json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(result)
+}
+
+type virusTotalFile struct {
+	Data struct {
+		Attributes struct {
+			TypeDescription   string `json:"type_description"`
+			LastAnalysisStats struct {
+				Malicious  int `json:"malicious"`
+				Suspicious int `json:"suspicious"`
+				Undetected int `json:"undetected"`
+				Harmless   int `json:"harmless"`
+			} `json:"last_analysis_stats"`
+			LastAnalysisResults map[string]struct {
+				Category string `json:"category"`
+				Result   string `json:"result"`
+			} `json:"last_analysis_results"`
+			PopularThreatClassification struct {
+				SuggestedThreatLabel string `json:"suggested_threat_label"`
+			} `json:"popular_threat_classification"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+func (s *sampleLookup) lookupVirusTotal(report *SampleReport) error {
+	req, err := http.NewRequest(http.MethodGet, virusTotalAPI+"/files/"+report.SHA256, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-apikey", viper.GetString("sample_lookup.api_key"))
+	var file virusTotalFile
+	found, err := s.do(req, &file)
+	if err != nil || !found {
+		return err
+	}
+	attrs := file.Data.Attributes
+	stats := attrs.LastAnalysisStats
+	report.Found = true
+	report.Malicious = stats.Malicious
+	report.Engines = stats.Malicious + stats.Suspicious + stats.Undetected + stats.Harmless
+	report.Label = attrs.PopularThreatClassification.SuggestedThreatLabel
+	report.FileType = attrs.TypeDescription
+	for _, result := range attrs.LastAnalysisResults {
+		if result.Category == "malicious" && result.Result != "" {
+			report.Detections = append(report.Detections, result.Result)
+		}
+	}
+	slices.Sort(report.Detections)
+	report.Detections = slices.Compact(report.Detections)
+	return nil
+}
+
+type malwareBazaarInfo struct {
+	QueryStatus string `json:"query_status"`
+	Data        []struct {
+		Signature string   `json:"signature"`
+		FileType  string   `json:"file_type"`
+		Tags      []string `json:"tags"`
+	} `json:"data"`
+}
+
+func (s *sampleLookup) lookupMalwareBazaar(report *SampleReport) error {
+	form := url.Values{"query": {"get_info"}, "hash": {report.SHA256}}
+	req, err := http.NewRequest(http.MethodPost, malwareBazaarAPI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Auth-Key", viper.GetString("sample_lookup.api_key"))
+	var info malwareBazaarInfo
+	if _, err := s.do(req, &info); err != nil {
+		return err
+	}
+	switch info.QueryStatus {
+	case "ok":
+	case "hash_not_found":
+		return nil
+	default:
+		return fmt.Errorf("query failed: %s", info.QueryStatus)
+	}
+	report.Found = len(info.Data) > 0
+	for _, sample := range info.Data {
+		report.Label = sample.Signature
+		report.FileType = sample.FileType
+		report.Detections = append(report.Detections, sample.Tags...)
+	}
+	return nil
+}
+
+// close drops the lookups still queued
+func (s *sampleLookup) close() {
+	close(s.done)
+	close(s.queue)
+	s.wg.Wait()
+}
@@ -0,0 +1,98 @@
+package producer
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleLookupVirusTotal(t *testing.T) {
+	hash := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "key", r.Header.Get("x-apikey"))
+		if r.URL.Path != "/files/"+hash {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data": {"attributes": {
+			"type_description": "ELF",
+			"last_analysis_stats": {"malicious": 2, "undetected": 1},
+			"last_analysis_results": {
+				"A": {"category": "malicious", "result": "Linux.Mirai"},
+				"B": {"category": "malicious", "result": "Linux.Mirai"},
+				"C": {"category": "undetected", "result": null}
+			},
+			"popular_threat_classification": {"suggested_threat_label": "trojan.mirai"}
+		}}}`))
+	}))
+	defer svr.Close()
+	virusTotalAPI = svr.URL
+	viper.Set("sample_lookup.service", serviceVirusTotal)
+	viper.Set("sample_lookup.api_key", "key")
+	viper.Set("sample_lookup.rate_limit", 0)
+
+	events := make(chan *Event, 4)
+	s, err := newSampleLookup(http.DefaultClient, slog.Default(), func(e *Event) error {
+		events <- e
+		return nil
+	})
+	require.NoError(t, err)
+	other := "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"
+	event := &Event{SrcHost: "1.2.3.4", Handler: "tftp", Payload: "AA==", Decoded: map[string]string{"payload_hash": hash}}
+	s.submit(event)
+	s.submit(event)
+	s.submit(&Event{SrcHost: "1.2.3.4", Handler: "http", Decoded: map[string]string{"payload_hash": other}})
+
+	followUp := <-events
+	require.Equal(t, sampleLookupHandler, followUp.Handler)
+	require.Equal(t, "1.2.3.4", followUp.SrcHost)
+	require.Empty(t, followUp.Payload)
+	require.Equal(t, &SampleReport{
+		SHA256:     hash,
+		Service:    serviceVirusTotal,
+		Found:      true,
+		Malicious:  2,
+		Engines:    3,
+		Label:      "trojan.mirai",
+		Detections: []string{"Linux.Mirai"},
+		FileType:   "ELF",
+	}, followUp.Decoded)
+	followUp = <-events
+	require.Equal(t, &SampleReport{SHA256: other, Service: serviceVirusTotal}, followUp.Decoded)
+
+	// the follow up events are not looked up again
+	s.submit(followUp)
+	s.close()
+	require.Empty(t, events)
+}
+
+func TestSampleLookupMalwareBazaar(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "key", r.Header.Get("Auth-Key"))
+		require.Equal(t, "get_info", r.FormValue("query"))
+		if r.FormValue("hash") != "known" {
+			w.Write([]byte(`{"query_status": "hash_not_found"}`))
+			return
+		}
+		w.Write([]byte(`{"query_status": "ok", "data": [{"signature": "Mirai", "file_type": "elf", "tags": ["mirai", "arm"]}]}`))
+	}))
+	defer svr.Close()
+	malwareBazaarAPI = svr.URL
+	viper.Set("sample_lookup.service", serviceMalwareBazaar)
+	viper.Set("sample_lookup.api_key", "key")
+	defer viper.Set("sample_lookup.service", serviceVirusTotal)
+
+	s := &sampleLookup{client: &http.Client{Timeout: time.Second}}
+	report := &SampleReport{SHA256: "known"}
+	require.NoError(t, s.lookup(report))
+	require.Equal(t, &SampleReport{SHA256: "known", Service: serviceMalwareBazaar, Found: true, Label: "Mirai", Detections: []string{"mirai", "arm"}, FileType: "elf"}, report)
+
+	report = &SampleReport{SHA256: "unknown"}
+	require.NoError(t, s.lookup(report))
+	require.False(t, report.Found)
+}
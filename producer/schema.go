@@ -0,0 +1,154 @@
+package producer
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/yara"
+	"github.com/spf13/viper"
+)
+
+const (
+	schemaNative = "native"
+	schemaECS    = "ecs"
+	ecsVersion   = "8.11.0"
+)
+
+type ecsEventFields struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Module   string   `json:"module"`
+	Dataset  string   `json:"dataset"`
+	Action   string   `json:"action,omitempty"`
+}
+
+type ecsGeo struct {
+	CountryISOCode string             `json:"country_iso_code,omitempty"`
+	CountryName    string             `json:"country_name,omitempty"`
+	CityName       string             `json:"city_name,omitempty"`
+	Location       map[string]float64 `json:"location,omitempty"`
+}
+
+type ecsAS struct {
+	Number       uint32            `json:"number"`
+	Organization map[string]string `json:"organization,omitempty"`
+}
+
+type ecsEndpoint struct {
+	IP     string  `json:"ip,omitempty"`
+	Port   int     `json:"port,omitempty"`
+	Domain string  `json:"domain,omitempty"`
+	Geo    *ecsGeo `json:"geo,omitempty"`
+	AS     *ecsAS  `json:"as,omitempty"`
+}
+
+type ecsTLS struct {
+	Client map[string]string `json:"client,omitempty"`
+	Server map[string]string `json:"server,omitempty"`
+}
+
+type ecsGlutton struct {
+	Handler      string                   `json:"handler,omitempty"`
+	Scanner      string                   `json:"scanner,omitempty"`
+	Payload      string                   `json:"payload,omitempty"`
+	Reputation   *connection.Reputation   `json:"reputation,omitempty"`
+	Fingerprints *connection.Fingerprints `json:"fingerprints,omitempty"`
+	PCAP         string                   `json:"pcap,omitempty"`
+	Transcript   string                   `json:"transcript,omitempty"`
+	YARA         []yara.Match             `json:"yara,omitempty"`
+	Decoded      any                      `json:"decoded,omitempty"`
+}
+
+// ecsDocument is an event in the Elastic Common Schema, the fields without
+// an ECS counterpart are kept under glutton
+type ecsDocument struct {
+	Timestamp   time.Time         `json:"@timestamp"`
+	ECS         map[string]string `json:"ecs"`
+	Event       ecsEventFields    `json:"event"`
+	Source      ecsEndpoint       `json:"source"`
+	Destination ecsEndpoint       `json:"destination"`
+	Network     map[string]string `json:"network"`
+	Observer    map[string]string `json:"observer"`
+	Rule        map[string]string `json:"rule,omitempty"`
+	Related     map[string]any    `json:"related"`
+	TLS         *ecsTLS           `json:"tls,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Glutton     ecsGlutton        `json:"glutton"`
+}
+
+func ecsEvent(event *Event) ecsDocument {
+	port, _ := strconv.Atoi(event.SrcPort)
+	doc := ecsDocument{
+		Timestamp: event.Timestamp,
+		ECS:       map[string]string{"version": ecsVersion},
+		Event: ecsEventFields{
+			Kind:     "event",
+			Category: []string{"intrusion_detection", "network"},
+			Type:     []string{"info", "connection"},
+			Module:   "glutton",
+			Dataset:  "glutton." + event.Handler,
+			Action:   event.Handler,
+		},
+		Source:      ecsEndpoint{IP: event.SrcHost, Port: port, Domain: event.Hostname},
+		Destination: ecsEndpoint{Port: int(event.DstPort)},
+		Network:     map[string]string{"transport": event.Transport, "protocol": event.Handler},
+		Observer:    map[string]string{"type": "honeypot", "vendor": "MushMush", "product": "glutton", "name": event.SensorID},
+		Related:     map[string]any{"ip": []string{event.SrcHost}},
+		Tags:        event.Tags,
+		Glutton: ecsGlutton{
+			Handler:      event.Handler,
+			Scanner:      event.Scanner,
+			Payload:      event.Payload,
+			Reputation:   event.Reputation,
+			Fingerprints: event.Fingerprints,
+			PCAP:         event.PCAP,
+			Transcript:   event.Transcript,
+			YARA:         event.YARA,
+			Decoded:      event.Decoded,
+		},
+	}
+	if event.Geo != nil {
+		doc.Source.Geo = &ecsGeo{
+			CountryISOCode: event.Geo.Country,
+			CountryName:    event.Geo.CountryName,
+			CityName:       event.Geo.City,
+			Location:       map[string]float64{"lat": event.Geo.Latitude, "lon": event.Geo.Longitude},
+		}
+	}
+	if event.AS != nil {
+		doc.Source.AS = &ecsAS{Number: event.AS.Number, Organization: map[string]string{"name": event.AS.Organization}}
+	}
+	if fp := event.Fingerprints; fp != nil && (fp.JA3Hash != "" || fp.JA3SHash != "") {
+		doc.TLS = &ecsTLS{}
+		if fp.JA3Hash != "" {
+			doc.TLS.Client = map[string]string{"ja3": fp.JA3Hash}
+		}
+		if fp.JA3SHash != "" {
+			doc.TLS.Server = map[string]string{"ja3s": fp.JA3SHash}
+		}
+	}
+	if event.Rule != "" {
+		doc.Rule = map[string]string{"name": event.Rule}
+	}
+	return doc
+}
+
+// formatEvent returns an event in the schema of a producer, set by
+// producers.<name>.schema or else producers.schema
+func formatEvent(producer string, event *Event) any {
+	schema := viper.GetString("producers." + producer + ".schema")
+	if schema == "" {
+		schema = viper.GetString("producers.schema")
+	}
+	if schema == schemaECS {
+		return ecsEvent(event)
+	}
+	return event
+}
+
+func marshalEvent(producer string, event *Event) ([]byte, error) {
+	return json.Marshal(formatEvent(producer, event))
+}
@@ -0,0 +1,52 @@
+package producer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatEvent(t *testing.T) {
+	event := &Event{
+		Timestamp:    time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC),
+		Transport:    "tcp",
+		SrcHost:      "1.2.3.4",
+		SrcPort:      "4000",
+		DstPort:      22,
+		SensorID:     "sensor",
+		Handler:      "ssh",
+		Tags:         []string{"bruteforce"},
+		Geo:          &connection.Geo{Country: "DE", City: "Berlin", Latitude: 52.52, Longitude: 13.405},
+		Fingerprints: &connection.Fingerprints{JA3: "771,4865,0-10,29,0", JA3Hash: "e7d705a3286e19ea42f587b344ee6865"},
+	}
+	viper.Set("producers.schema", schemaNative)
+	viper.Set("producers.kafka.schema", schemaECS)
+	defer viper.Set("producers.kafka.schema", "")
+	require.Equal(t, event, formatEvent("file", event))
+
+	data, err := marshalEvent("kafka", event)
+	require.NoError(t, err)
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(data, &doc))
+	require.Equal(t, "2024-03-09T12:00:00Z", doc["@timestamp"])
+	require.Equal(t, map[string]any{
+		"ip":   "1.2.3.4",
+		"port": 4000.0,
+		"geo": map[string]any{
+			"country_iso_code": "DE",
+			"city_name":        "Berlin",
+			"location":         map[string]any{"lat": 52.52, "lon": 13.405},
+		},
+	}, doc["source"])
+	require.Equal(t, map[string]any{"port": 22.0}, doc["destination"])
+	require.Equal(t, "tcp", doc["network"].(map[string]any)["transport"])
+	require.Equal(t, []any{"intrusion_detection", "network"}, doc["event"].(map[string]any)["category"])
+	require.Equal(t, "glutton.ssh", doc["event"].(map[string]any)["dataset"])
+	require.Equal(t, "sensor", doc["observer"].(map[string]any)["name"])
+	require.Equal(t, []any{"bruteforce"}, doc["tags"])
+	require.Equal(t, map[string]any{"client": map[string]any{"ja3": "e7d705a3286e19ea42f587b344ee6865"}}, doc["tls"])
+}
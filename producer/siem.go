@@ -0,0 +1,155 @@
+package producer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	siemVendor  = "Glutton"
+	siemProduct = "Glutton"
+	siemVersion = "1.0"
+	// siemPriority is facility local0 with severity notice
+	siemPriority = 16*8 + 5
+)
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+	leefEscaper         = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+)
+
+// siemField is an event field along with its CEF and LEEF keys
+type siemField struct {
+	cef, leef, value string
+}
+
+func siemFields(event *Event) []siemField {
+	return []siemField{
+		{"src", "src", event.SrcHost},
+		{"spt", "srcPort", event.SrcPort},
+		{"dpt", "dstPort", fmt.Sprint(event.DstPort)},
+		{"proto", "proto", strings.ToUpper(event.Transport)},
+		{"cs1", "sensorID", event.SensorID},
+		{"cs2", "rule", event.Rule},
+		{"cs3", "scanner", event.Scanner},
+		{"cs4", "tags", strings.Join(event.Tags, ",")},
+	}
+}
+
+// formatCEF formats an event as an ArcSight Common Event Format record
+func formatCEF(event *Event) string {
+	labels := map[string]string{"cs1": "sensorID", "cs2": "rule", "cs3": "scanner", "cs4": "tags"}
+	ext := []string{fmt.Sprintf("rt=%d", event.Timestamp.UnixMilli())}
+	for _, field := range siemFields(event) {
+		if field.value == "" {
+			continue
+		}
+		if label, ok := labels[field.cef]; ok {
+			ext = append(ext, field.cef+"Label="+label)
+		}
+		ext = append(ext, field.cef+"="+cefExtensionEscaper.Replace(field.value))
+	}
+	handler := cefHeaderEscaper.Replace(event.Handler)
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s connection|5|%s", siemVendor, siemProduct, siemVersion, handler, handler, strings.Join(ext, " "))
+}
+
+// formatLEEF formats an event as a QRadar Log Event Extended Format 1.0
+// record, its attributes are separated by tabs
+func formatLEEF(event *Event) string {
+	attrs := []string{
+		"devTime=" + event.Timestamp.Format("Jan 02 2006 15:04:05.000 MST"),
+		"devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z",
+	}
+	for _, field := range siemFields(event) {
+		if field.value != "" {
+			attrs = append(attrs, field.leef+"="+leefEscaper.Replace(field.value))
+		}
+	}
+	return fmt.Sprintf("LEEF:1.0|%s|%s|%s|%s|%s", siemVendor, siemProduct, siemVersion, strings.ReplaceAll(event.Handler, "|", " "), strings.Join(attrs, "\t"))
+}
+
+// siemWriter sends CEF or LEEF records to a syslog receiver over UDP, TCP
+// or TLS, stream connections are redialed after a failed write
+type siemWriter struct {
+	mu       sync.Mutex
+	conn     net.Conn
+	hostname string
+}
+
+func newSIEMWriter() *siemWriter {
+	hostname, _ := os.Hostname()
+	return &siemWriter{hostname: hostname}
+}
+
+func (s *siemWriter) dial() (net.Conn, error) {
+	address := viper.GetString("producers.siem.address")
+	switch network := viper.GetString("producers.siem.network"); network {
+	case "udp", "tcp":
+		return net.DialTimeout(network, address, tlsTimeout)
+	case "tls":
+		dialer := &net.Dialer{Timeout: tlsTimeout}
+		return tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+			InsecureSkipVerify: viper.GetBool("producers.siem.insecure"),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported siem network %q", network)
+	}
+}
+
+// message frames a record as an RFC 3164 syslog message, stream
+// transports terminate it with a newline
+func (s *siemWriter) message(event *Event) []byte {
+	record := formatCEF(event)
+	if viper.GetString("producers.siem.format") == "leef" {
+		record = formatLEEF(event)
+	}
+	msg := fmt.Sprintf("<%d>%s %s glutton: %s", siemPriority, event.Timestamp.Format(time.Stamp), s.hostname, record)
+	if viper.GetString("producers.siem.network") != "udp" {
+		msg += "\n"
+	}
+	return []byte(msg)
+}
+
+func (s *siemWriter) log(event *Event) error {
+	msg := s.message(event)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			conn, err := s.dial()
+			if err != nil {
+				return err
+			}
+			s.conn = conn
+		}
+		if err := s.conn.SetWriteDeadline(time.Now().Add(tlsTimeout)); err != nil {
+			return err
+		}
+		_, err := s.conn.Write(msg)
+		if err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+func (s *siemWriter) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
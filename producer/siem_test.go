@@ -0,0 +1,56 @@
+package producer
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+var siemEvent = &Event{
+	Timestamp: time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC),
+	Transport: "tcp",
+	SrcHost:   "1.2.3.4",
+	SrcPort:   "40000",
+	DstPort:   22,
+	SensorID:  "sensor",
+	Handler:   "ssh",
+	Rule:      "Rule: a=b",
+}
+
+func TestFormatCEF(t *testing.T) {
+	require.Equal(t,
+		`CEF:0|Glutton|Glutton|1.0|ssh|ssh connection|5|rt=1709985600000 src=1.2.3.4 spt=40000 dpt=22 proto=TCP cs1Label=sensorID cs1=sensor cs2Label=rule cs2=Rule: a\=b`,
+		formatCEF(siemEvent))
+}
+
+func TestFormatLEEF(t *testing.T) {
+	require.Equal(t,
+		"LEEF:1.0|Glutton|Glutton|1.0|ssh|devTime=Mar 09 2024 12:00:00.000 UTC\tdevTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tsrc=1.2.3.4\tsrcPort=40000\tdstPort=22\tproto=TCP\tsensorID=sensor\trule=Rule: a=b",
+		formatLEEF(siemEvent))
+}
+
+func TestSIEMWriter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	viper.Set("producers.siem.network", "tcp")
+	viper.Set("producers.siem.address", ln.Addr().String())
+	viper.Set("producers.siem.format", "leef")
+	defer viper.Set("producers.siem.format", "")
+
+	s := newSIEMWriter()
+	defer s.close()
+	require.NoError(t, s.log(siemEvent))
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "<133>Mar  9 12:00:00 "))
+	require.Contains(t, line, " glutton: LEEF:1.0|Glutton|")
+}
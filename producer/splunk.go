@@ -0,0 +1,107 @@
+package producer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// splunkEvent is the envelope the HTTP Event Collector expects
+type splunkEvent struct {
+	Time       float64 `json:"time"`
+	Host       string  `json:"host,omitempty"`
+	Source     string  `json:"source,omitempty"`
+	SourceType string  `json:"sourcetype,omitempty"`
+	Index      string  `json:"index,omitempty"`
+	Event      any     `json:"event"`
+}
+
+// splunkHEC ships events to the Splunk HTTP Event Collector in batches
+type splunkHEC struct {
+	*batcher
+	client *http.Client
+	logger *slog.Logger
+}
+
+func newSplunkHEC(client *http.Client, logger *slog.Logger) *splunkHEC {
+	hec := &splunkHEC{client: client, logger: logger}
+	hec.batcher = newBatcher("splunk", logger,
+		viper.GetInt("producers.splunk.batch_size"),
+		viper.GetInt("producers.splunk.queue_size"),
+		viper.GetInt("producers.splunk.max_retries"),
+		viper.GetDuration("producers.splunk.flush_interval"),
+		hec.send,
+	)
+	return hec
+}
+
+// body encodes a batch as concatenated event envelopes, gzipped when
+// producers.splunk.gzip is set
+func (hec *splunkHEC) body(batch []*Event) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if viper.GetBool("producers.splunk.gzip") {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	enc := json.NewEncoder(w)
+	for _, event := range batch {
+		err := enc.Encode(splunkEvent{
+			Time:       float64(event.Timestamp.UnixMilli()) / 1000,
+			Host:       event.SensorID,
+			Source:     viper.GetString("producers.splunk.source"),
+			SourceType: viper.GetString("producers.splunk.sourcetype"),
+			Index:      viper.GetString("producers.splunk.index"),
+			Event:      formatEvent("splunk", event),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// send posts a batch to the collector. The collector takes or refuses a
+// batch as a whole, it is retried when the collector is busy.
+func (hec *splunkHEC) send(batch []*Event) ([]*Event, error) {
+	body, err := hec.body(batch)
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(viper.GetString("producers.splunk.url"), "/") + "/services/collector/event"
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Splunk "+viper.GetString("producers.splunk.token"))
+	req.Header.Set("Content-Type", "application/json")
+	if viper.GetBool("producers.splunk.gzip") {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := hec.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("splunk HEC request failed: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		hec.logger.Error("Splunk HEC rejected events", slog.String("status", resp.Status), slog.String("response", string(data)))
+	}
+	return nil, nil
+}
@@ -0,0 +1,53 @@
+package producer
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplunkHEC(t *testing.T) {
+	received := []splunkEvent{}
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/services/collector/event", r.URL.Path)
+		require.Equal(t, "Splunk token", r.Header.Get("Authorization"))
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		dec := json.NewDecoder(zr)
+		for dec.More() {
+			var event splunkEvent
+			require.NoError(t, dec.Decode(&event))
+			received = append(received, event)
+		}
+		_, _ = w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer svr.Close()
+
+	viper.Set("producers.splunk.url", svr.URL)
+	viper.Set("producers.splunk.token", "token")
+	viper.Set("producers.splunk.gzip", true)
+	viper.Set("producers.splunk.index", "honeypot")
+	viper.Set("producers.splunk.sourcetype", "glutton:event")
+	viper.Set("producers.splunk.batch_size", 10)
+	hec := newSplunkHEC(http.DefaultClient, slog.Default())
+
+	ts := time.Date(2024, 3, 9, 12, 0, 0, 500e6, time.UTC)
+	require.NoError(t, hec.enqueue(&Event{Timestamp: ts, SensorID: "sensor", SrcHost: "1.2.3.4"}))
+	require.NoError(t, hec.enqueue(&Event{Timestamp: ts, SensorID: "sensor", SrcHost: "1.2.3.5"}))
+	hec.close()
+
+	require.Len(t, received, 2)
+	require.Equal(t, 1709985600.5, received[0].Time)
+	require.Equal(t, "sensor", received[0].Host)
+	require.Equal(t, "honeypot", received[0].Index)
+	require.Equal(t, "glutton:event", received[0].SourceType)
+	require.Equal(t, "1.2.3.5", received[1].Event.(map[string]any)["srcHost"])
+}
@@ -0,0 +1,223 @@
+package producer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+const (
+	stixVersion = "2.1"
+	// stixTime is the timestamp format with the millisecond precision
+	// STIX expects
+	stixTime    = "2006-01-02T15:04:05.000Z"
+	taxiiMedia  = "application/taxii+json;version=2.1"
+	stixBacklog = 100000
+)
+
+// stixNamespace is the namespace the STIX specification defines for the
+// deterministic ids of cyber observables, indicators use it as well so the
+// same pattern always gets the same id
+var stixNamespace = uuid.MustParse("00abedb4-aa42-466c-9c01-fed23315a9b7")
+
+type stixObject struct {
+	Type           string   `json:"type"`
+	SpecVersion    string   `json:"spec_version"`
+	ID             string   `json:"id"`
+	Created        string   `json:"created"`
+	Modified       string   `json:"modified"`
+	CreatedByRef   string   `json:"created_by_ref,omitempty"`
+	Name           string   `json:"name,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	IdentityClass  string   `json:"identity_class,omitempty"`
+	IndicatorTypes []string `json:"indicator_types,omitempty"`
+	Pattern        string   `json:"pattern,omitempty"`
+	PatternType    string   `json:"pattern_type,omitempty"`
+	ValidFrom      string   `json:"valid_from,omitempty"`
+}
+
+type stixBundle struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Objects []stixObject `json:"objects"`
+}
+
+// stixPattern builds the STIX pattern matching an indicator
+func stixPattern(ind indicator) string {
+	value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(ind.value)
+	switch ind.kind {
+	case indicatorIP:
+		if ip := net.ParseIP(ind.value); ip != nil && ip.To4() == nil {
+			return fmt.Sprintf("[ipv6-addr:value = '%s']", value)
+		}
+		return fmt.Sprintf("[ipv4-addr:value = '%s']", value)
+	case indicatorURL:
+		return fmt.Sprintf("[url:value = '%s']", value)
+	}
+	return fmt.Sprintf("[file:hashes.'SHA-256' = '%s']", value)
+}
+
+// stixExporter writes the indicators seen within producers.stix.interval
+// to a STIX bundle in producers.stix.dir and pushes them to the TAXII
+// collection in producers.stix.taxii if one is configured
+type stixExporter struct {
+	client   *http.Client
+	logger   *slog.Logger
+	identity stixObject
+
+	mu      sync.Mutex
+	pending map[string]stixObject
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newSTIXExporter(client *http.Client, sensorID string, logger *slog.Logger) (*stixExporter, error) {
+	if err := os.MkdirAll(viper.GetString("producers.stix.dir"), 0o755); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(stixTime)
+	s := &stixExporter{
+		client: client,
+		logger: logger,
+		identity: stixObject{
+			Type:          "identity",
+			SpecVersion:   stixVersion,
+			ID:            "identity--" + uuid.NewSHA1(stixNamespace, []byte(sensorID)).String(),
+			Created:       now,
+			Modified:      now,
+			Name:          "glutton sensor " + sensorID,
+			IdentityClass: "system",
+		},
+		pending: map[string]stixObject{},
+		done:    make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// log adds the indicators of an event to the next bundle
+func (s *stixExporter) log(event *Event) {
+	if isPrivateIP(event.SrcHost) {
+		return
+	}
+	seen := event.Timestamp.UTC().Format(stixTime)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ind := range extractIndicators(event) {
+		pattern := stixPattern(ind)
+		id := "indicator--" + uuid.NewSHA1(stixNamespace, []byte(pattern)).String()
+		if _, ok := s.pending[id]; ok || len(s.pending) >= stixBacklog {
+			continue
+		}
+		s.pending[id] = stixObject{
+			Type:           "indicator",
+			SpecVersion:    stixVersion,
+			ID:             id,
+			Created:        seen,
+			Modified:       seen,
+			CreatedByRef:   s.identity.ID,
+			Description:    fmt.Sprintf("%s seen by %s on port %d", ind.kind, event.Handler, event.DstPort),
+			IndicatorTypes: []string{"malicious-activity"},
+			Pattern:        pattern,
+			PatternType:    "stix",
+			ValidFrom:      seen,
+		}
+	}
+}
+
+func (s *stixExporter) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(max(viper.GetDuration("producers.stix.interval"), time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			s.export()
+			return
+		case <-ticker.C:
+			s.export()
+		}
+	}
+}
+
+// export writes the pending indicators to a bundle and pushes them
+func (s *stixExporter) export() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = map[string]stixObject{}
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	objects := []stixObject{s.identity}
+	for _, obj := range pending {
+		objects = append(objects, obj)
+	}
+	slices.SortFunc(objects[1:], func(a, b stixObject) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	bundle := stixBundle{Type: "bundle", ID: "bundle--" + uuid.NewString(), Objects: objects}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		s.logger.Error("Failed to marshal STIX bundle", ErrAttr(err))
+		return
+	}
+	path := filepath.Join(viper.GetString("producers.stix.dir"), bundle.ID+".json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		s.logger.Error("Failed to write STIX bundle", slog.String("path", path), ErrAttr(err))
+	}
+	if viper.GetString("producers.stix.taxii.url") != "" {
+		if err := s.push(objects); err != nil {
+			s.logger.Error("Failed to push STIX bundle to TAXII", ErrAttr(err))
+		}
+	}
+}
+
+// push adds the objects to the TAXII collection, the server answers with
+// a status resource for the pending request
+func (s *stixExporter) push(objects []stixObject) error {
+	data, err := json.Marshal(map[string][]stixObject{"objects": objects})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/collections/%s/objects/", strings.TrimSuffix(viper.GetString("producers.stix.taxii.url"), "/"), viper.GetString("producers.stix.taxii.collection"))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", taxiiMedia)
+	req.Header.Set("Accept", taxiiMedia)
+	if user := viper.GetString("producers.stix.taxii.username"); user != "" {
+		req.SetBasicAuth(user, viper.GetString("producers.stix.taxii.password"))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("TAXII server returned %s", resp.Status)
+	}
+	return nil
+}
+
+// close writes the indicators still pending
+func (s *stixExporter) close() {
+	close(s.done)
+	s.wg.Wait()
+}
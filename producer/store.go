@@ -0,0 +1,234 @@
+package producer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	// database drivers for the event store
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var storePlaceholder = regexp.MustCompile(`\$\d+`)
+
+// storeSchema creates the events table and the sources table aggregating
+// the sessions of each source address
+var storeSchema = map[string][]string{
+	"sqlite3": {
+		`CREATE TABLE IF NOT EXISTS events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp TIMESTAMP NOT NULL,
+			transport TEXT NOT NULL,
+			src_host TEXT NOT NULL,
+			src_port TEXT NOT NULL,
+			dst_port INTEGER NOT NULL,
+			sensor_id TEXT NOT NULL,
+			rule TEXT NOT NULL,
+			handler TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			scanner TEXT NOT NULL,
+			tags TEXT NOT NULL,
+			decoded TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS sources (
+			src_host TEXT PRIMARY KEY,
+			first_seen TIMESTAMP NOT NULL,
+			last_seen TIMESTAMP NOT NULL,
+			events INTEGER NOT NULL
+		)`,
+	},
+	"postgres": {
+		`CREATE TABLE IF NOT EXISTS events (
+			id BIGSERIAL PRIMARY KEY,
+			timestamp TIMESTAMPTZ NOT NULL,
+			transport TEXT NOT NULL,
+			src_host TEXT NOT NULL,
+			src_port TEXT NOT NULL,
+			dst_port INTEGER NOT NULL,
+			sensor_id TEXT NOT NULL,
+			rule TEXT NOT NULL,
+			handler TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			scanner TEXT NOT NULL,
+			tags TEXT NOT NULL,
+			decoded JSONB
+		)`,
+		`CREATE TABLE IF NOT EXISTS sources (
+			src_host TEXT PRIMARY KEY,
+			first_seen TIMESTAMPTZ NOT NULL,
+			last_seen TIMESTAMPTZ NOT NULL,
+			events BIGINT NOT NULL
+		)`,
+	},
+}
+
+var storeIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS events_timestamp ON events (timestamp)`,
+	`CREATE INDEX IF NOT EXISTS events_src_host ON events (src_host)`,
+	`CREATE INDEX IF NOT EXISTS events_handler ON events (handler)`,
+}
+
+// Store persists events into SQLite or Postgres for local analysis
+type Store struct {
+	db     *sql.DB
+	driver string
+}
+
+// EventFilter narrows down the events returned by Store.Events, zero values
+// match everything
+type EventFilter struct {
+	SrcHost string
+	Handler string
+	Since   time.Time
+	Limit   int
+}
+
+// SourceStats summarizes the events of a source address
+type SourceStats struct {
+	SrcHost   string    `json:"srcHost"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Events    int64     `json:"events"`
+}
+
+// NewStore opens the database and creates the schema. driver is sqlite or
+// postgres, dsn a file name or a connection string.
+func NewStore(driver, dsn string) (*Store, error) {
+	switch driver {
+	case "", "sqlite", "sqlite3":
+		driver = "sqlite3"
+	case "postgres", "postgresql":
+		driver = "postgres"
+	default:
+		return nil, fmt.Errorf("unsupported store driver %q", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite3" {
+		// SQLite allows a single writer
+		db.SetMaxOpenConns(1)
+	}
+	for _, stmt := range append(storeSchema[driver], storeIndexes...) {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &Store{db: db, driver: driver}, nil
+}
+
+// query rewrites the numbered placeholders for SQLite
+func (s *Store) query(q string) string {
+	if s.driver == "sqlite3" {
+		return storePlaceholder.ReplaceAllString(q, "?")
+	}
+	return q
+}
+
+// Log inserts an event and updates the statistics of its source
+func (s *Store) Log(ctx context.Context, event *Event) error {
+	var decoded any
+	if event.Decoded != nil {
+		data, err := json.Marshal(event.Decoded)
+		if err != nil {
+			return err
+		}
+		decoded = string(data)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, s.query(`INSERT INTO events
+		(timestamp, transport, src_host, src_port, dst_port, sensor_id, rule, handler, payload, scanner, tags, decoded)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`),
+		event.Timestamp, event.Transport, event.SrcHost, event.SrcPort, event.DstPort, event.SensorID,
+		event.Rule, event.Handler, event.Payload, event.Scanner, strings.Join(event.Tags, ","), decoded,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, s.query(`INSERT INTO sources (src_host, first_seen, last_seen, events)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (src_host) DO UPDATE SET last_seen = excluded.last_seen, events = sources.events + 1`),
+		event.SrcHost, event.Timestamp, event.Timestamp,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Events returns the events matching filter, newest first
+func (s *Store) Events(ctx context.Context, filter EventFilter) ([]Event, error) {
+	conds, args := []string{"timestamp >= $1"}, []any{filter.Since}
+	if filter.SrcHost != "" {
+		args = append(args, filter.SrcHost)
+		conds = append(conds, fmt.Sprintf("src_host = $%d", len(args)))
+	}
+	if filter.Handler != "" {
+		args = append(args, filter.Handler)
+		conds = append(conds, fmt.Sprintf("handler = $%d", len(args)))
+	}
+	q := `SELECT timestamp, transport, src_host, src_port, dst_port, sensor_id, rule, handler, payload, scanner, tags, decoded
+		FROM events WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY timestamp DESC`
+	if filter.Limit > 0 {
+		q += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, s.query(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var tags string
+		var decoded sql.NullString
+		err := rows.Scan(&event.Timestamp, &event.Transport, &event.SrcHost, &event.SrcPort, &event.DstPort, &event.SensorID,
+			&event.Rule, &event.Handler, &event.Payload, &event.Scanner, &tags, &decoded)
+		if err != nil {
+			return nil, err
+		}
+		if tags != "" {
+			event.Tags = strings.Split(tags, ",")
+		}
+		if decoded.Valid {
+			event.Decoded = json.RawMessage(decoded.String)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// TopSources returns the source addresses with the most events
+func (s *Store) TopSources(ctx context.Context, limit int) ([]SourceStats, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT src_host, first_seen, last_seen, events
+		FROM sources ORDER BY events DESC, src_host LIMIT $1`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sources := []SourceStats{}
+	for rows.Next() {
+		var source SourceStats
+		if err := rows.Scan(&source.SrcHost, &source.FirstSeen, &source.LastSeen, &source.Events); err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
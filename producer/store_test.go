@@ -0,0 +1,48 @@
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store, err := NewStore("sqlite", filepath.Join(t.TempDir(), "glutton.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	ts := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	events := []*Event{
+		{Timestamp: ts, Transport: "tcp", SrcHost: "1.2.3.4", SrcPort: "40000", DstPort: 22, Handler: "ssh", Tags: []string{"a", "b"}, Decoded: map[string]string{"user": "root"}},
+		{Timestamp: ts.Add(time.Minute), Transport: "tcp", SrcHost: "1.2.3.4", SrcPort: "40001", DstPort: 80, Handler: "http"},
+		{Timestamp: ts.Add(2 * time.Minute), Transport: "udp", SrcHost: "5.6.7.8", SrcPort: "53", DstPort: 53, Handler: "dns"},
+	}
+	for _, event := range events {
+		require.NoError(t, store.Log(ctx, event))
+	}
+
+	got, err := store.Events(ctx, EventFilter{SrcHost: "1.2.3.4"})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, "http", got[0].Handler)
+	require.Equal(t, []string{"a", "b"}, got[1].Tags)
+	require.JSONEq(t, `{"user":"root"}`, string(got[1].Decoded.(json.RawMessage)))
+	require.True(t, ts.Equal(got[1].Timestamp))
+
+	got, err = store.Events(ctx, EventFilter{Since: ts.Add(time.Minute), Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, "dns", got[0].Handler)
+
+	sources, err := store.TopSources(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, []SourceStats{
+		{SrcHost: "1.2.3.4", FirstSeen: ts, LastSeen: ts.Add(time.Minute), Events: 2},
+		{SrcHost: "5.6.7.8", FirstSeen: ts.Add(2 * time.Minute), LastSeen: ts.Add(2 * time.Minute), Events: 1},
+	}, sources)
+}
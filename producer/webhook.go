@@ -0,0 +1,246 @@
+package producer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const webhookSpool = "spool.ndjson"
+
+// webhookQueue keeps the events for the HTTP endpoint on disk so they
+// survive collector outages and restarts. Events are appended to a spool
+// file which becomes a batch once it holds producers.http.batch_size events
+// or producers.http.flush_interval passed. Batches are sent in order as
+// JSON arrays and removed once the endpoint took them.
+type webhookQueue struct {
+	client *http.Client
+	logger *slog.Logger
+	dir    string
+
+	mu      sync.Mutex
+	spool   *os.File
+	spooled int
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newWebhookQueue(client *http.Client, logger *slog.Logger) (*webhookQueue, error) {
+	q := &webhookQueue{
+		client: client,
+		logger: logger,
+		dir:    viper.GetString("producers.http.queue_dir"),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if err := os.MkdirAll(q.dir, 0o700); err != nil {
+		return nil, err
+	}
+	// events spooled before a restart become a batch of their own
+	if info, err := os.Stat(filepath.Join(q.dir, webhookSpool)); err == nil && info.Size() > 0 {
+		q.spooled = 1
+		if err := q.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	q.wg.Add(2)
+	go q.flushLoop()
+	go q.sendLoop()
+	return q, nil
+}
+
+func (q *webhookQueue) enqueue(event *Event) error {
+	data, err := marshalEvent("http", event)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.spool == nil {
+		if q.spool, err = os.OpenFile(filepath.Join(q.dir, webhookSpool), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+			return err
+		}
+	}
+	if _, err := q.spool.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if q.spooled++; q.spooled >= viper.GetInt("producers.http.batch_size") {
+		return q.rotate()
+	}
+	return nil
+}
+
+// rotate turns the spool into a batch named by the time it was cut, the
+// oldest batches are dropped beyond producers.http.max_batches. Callers
+// hold q.mu.
+func (q *webhookQueue) rotate() error {
+	if q.spooled == 0 {
+		return nil
+	}
+	if q.spool != nil {
+		if err := q.spool.Close(); err != nil {
+			return err
+		}
+		q.spool = nil
+	}
+	q.spooled = 0
+	batch := filepath.Join(q.dir, strconv.FormatInt(time.Now().UnixNano(), 10)+".ndjson")
+	if err := os.Rename(filepath.Join(q.dir, webhookSpool), batch); err != nil {
+		return err
+	}
+	if batches := q.batches(); len(batches) > viper.GetInt("producers.http.max_batches") {
+		for _, old := range batches[:len(batches)-viper.GetInt("producers.http.max_batches")] {
+			q.logger.Error("Dropping queued HTTP batch", slog.String("batch", old))
+			os.Remove(old)
+		}
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// batches lists the batch files oldest first
+func (q *webhookQueue) batches() []string {
+	batches, _ := filepath.Glob(filepath.Join(q.dir, "*.ndjson"))
+	batches = slices.DeleteFunc(batches, func(path string) bool {
+		return filepath.Base(path) == webhookSpool
+	})
+	slices.Sort(batches)
+	return batches
+}
+
+func (q *webhookQueue) flushLoop() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(max(viper.GetDuration("producers.http.flush_interval"), time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			if err := q.rotate(); err != nil {
+				q.logger.Error("Failed to rotate HTTP queue", ErrAttr(err))
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+// sendLoop sends the batches, backing off exponentially while the endpoint
+// fails
+func (q *webhookQueue) sendLoop() {
+	defer q.wg.Done()
+	backoff := time.Second
+	for {
+		retry := false
+		for _, batch := range q.batches() {
+			var err error
+			if retry, err = q.send(batch); err != nil {
+				q.logger.Error("Failed to send HTTP batch", slog.String("batch", batch), slog.Bool("retry", retry), ErrAttr(err))
+			}
+			if retry {
+				break
+			}
+			os.Remove(batch)
+		}
+		// new batches only wake the sender while the endpoint is up
+		wait, wake := time.Hour, q.wake
+		if retry {
+			wait, wake = backoff, nil
+			backoff = min(2*backoff, maxBackoff)
+		} else {
+			backoff = time.Second
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-q.done:
+			timer.Stop()
+			return
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// signWebhook signs the timestamp and body with producers.http.secret, the
+// timestamp lets receivers reject replayed requests
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// send posts a batch, reporting whether it should be tried again
+func (q *webhookQueue) send(batch string) (bool, error) {
+	data, err := os.ReadFile(batch)
+	if err != nil {
+		return false, err
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	body := append(append([]byte("["), bytes.Join(lines, []byte(","))...), ']')
+
+	remote, err := url.Parse(viper.GetString("producers.http.remote"))
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, remote.Scheme+"://"+remote.Host+remote.Path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.URL.RawQuery = remote.RawQuery
+	if password, ok := remote.User.Password(); ok {
+		req.SetBasicAuth(remote.User.Username(), password)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := viper.GetString("producers.http.secret"); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Glutton-Timestamp", timestamp)
+		req.Header.Set("X-Glutton-Signature", signWebhook(secret, timestamp, body))
+	}
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("HTTP endpoint failed: %s", resp.Status)
+	}
+	return false, fmt.Errorf("HTTP endpoint rejected batch: %s", resp.Status)
+}
+
+// close stops the workers and cuts the spool, batches still queued are
+// sent after the next start
+func (q *webhookQueue) close() {
+	close(q.done)
+	q.wg.Wait()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.rotate(); err != nil {
+		q.logger.Error("Failed to rotate HTTP queue", ErrAttr(err))
+	}
+}
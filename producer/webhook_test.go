@@ -0,0 +1,66 @@
+package producer
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignWebhook(t *testing.T) {
+	require.Equal(t, "sha256=74f76d8933679a54d6be8c7560a5233b124658241ca5a3b0f09af80d3ea60d78", signWebhook("secret", "1700000000", []byte("[]")))
+}
+
+func TestWebhookQueue(t *testing.T) {
+	batches := make(chan []Event, 2)
+	failures := 1
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, signWebhook("secret", r.Header.Get("X-Glutton-Timestamp"), body), r.Header.Get("X-Glutton-Signature"))
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var events []Event
+		require.NoError(t, json.Unmarshal(body, &events))
+		batches <- events
+	}))
+	defer svr.Close()
+
+	dir := t.TempDir()
+	// events spooled before a restart are sent first
+	require.NoError(t, os.WriteFile(filepath.Join(dir, webhookSpool), []byte(`{"srcHost":"1.1.1.1"}`+"\n"), 0o600))
+	viper.Set("producers.http.remote", svr.URL)
+	viper.Set("producers.http.secret", "secret")
+	viper.Set("producers.http.queue_dir", dir)
+	viper.Set("producers.http.batch_size", 2)
+	viper.Set("producers.http.flush_interval", time.Minute)
+	viper.Set("producers.http.max_batches", 10)
+	defer viper.Set("producers.http.secret", "")
+	q, err := newWebhookQueue(http.DefaultClient, slog.Default())
+	require.NoError(t, err)
+	defer q.close()
+
+	require.NoError(t, q.enqueue(&Event{SrcHost: "1.2.3.4"}))
+	require.NoError(t, q.enqueue(&Event{SrcHost: "1.2.3.5"}))
+
+	recovered := <-batches
+	require.Len(t, recovered, 1)
+	require.Equal(t, "1.1.1.1", recovered[0].SrcHost)
+	events := <-batches
+	require.Len(t, events, 2)
+	require.Equal(t, "1.2.3.5", events[1].SrcHost)
+	require.Eventually(t, func() bool {
+		return len(q.batches()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,95 @@
+package producer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"sync"
+
+	"github.com/mushorg/glutton/storage"
+	"github.com/mushorg/glutton/yara"
+	"github.com/spf13/viper"
+)
+
+// yaraCacheSize bounds the stored payloads whose matches are remembered
+const yaraCacheSize = 4096
+
+// payloadHashPattern finds the digests stored payloads are referenced by
+// in the decoded data of an event
+var payloadHashPattern = regexp.MustCompile(`"([0-9a-f]{64})"`)
+
+// yaraScanner matches events against the rules in yara.rules_dir, the
+// matches of a stored payload are kept until the rules change
+type yaraScanner struct {
+	scanner  *yara.Scanner
+	payloads *storage.Store
+
+	mu    sync.Mutex
+	rules *yara.Rules
+	cache map[string][]yara.Match
+}
+
+func newYARAScanner(logger *slog.Logger) (*yaraScanner, error) {
+	scanner, err := yara.NewScanner(viper.GetString("yara.rules_dir"), viper.GetDuration("yara.refresh"), logger)
+	if err != nil {
+		return nil, err
+	}
+	payloads, err := storage.Open(viper.GetString("storage.payloads.dir"), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &yaraScanner{scanner: scanner, payloads: payloads, cache: map[string][]yara.Match{}}, nil
+}
+
+// scan matches the payload of an event and the stored payloads its
+// decoded data references
+func (y *yaraScanner) scan(payload []byte, decoded any) []yara.Match {
+	rules := y.scanner.Rules()
+	matches := rules.Scan(payload)
+	if decoded == nil {
+		return matches
+	}
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		return matches
+	}
+	seen := map[string]bool{}
+	for _, m := range payloadHashPattern.FindAllSubmatch(data, -1) {
+		hash := string(m[1])
+		if !seen[hash] {
+			seen[hash] = true
+			matches = append(matches, y.scanStored(rules, hash)...)
+		}
+	}
+	return matches
+}
+
+func (y *yaraScanner) scanStored(rules *yara.Rules, hash string) []yara.Match {
+	y.mu.Lock()
+	if y.rules != rules {
+		y.rules, y.cache = rules, map[string][]yara.Match{}
+	}
+	matches, ok := y.cache[hash]
+	y.mu.Unlock()
+	if ok {
+		return matches
+	}
+
+	data, err := y.payloads.Get(hash)
+	if err != nil {
+		return nil
+	}
+	matches = rules.Scan(data)
+	for i := range matches {
+		matches[i].PayloadHash = hash
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if y.rules == rules {
+		if len(y.cache) >= yaraCacheSize {
+			clear(y.cache)
+		}
+		y.cache[hash] = matches
+	}
+	return matches
+}
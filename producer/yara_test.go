@@ -0,0 +1,45 @@
+package producer
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mushorg/glutton/storage"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYARAScanner(t *testing.T) {
+	rulesDir, payloadsDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(rulesDir, "test.yar"), []byte(`
+rule busybox { strings: $a = "busybox" condition: $a }
+rule elf { condition: uint32be(0) == 0x7F454C46 }
+`), 0o600))
+	viper.Set("yara.rules_dir", rulesDir)
+	viper.Set("storage.payloads.dir", payloadsDir)
+	defer viper.Set("storage.payloads.dir", "")
+
+	store, err := storage.Open(payloadsDir, 0, 0)
+	require.NoError(t, err)
+	hash, _, err := store.Put([]byte("\x7fELF\x01\x01"))
+	require.NoError(t, err)
+
+	y, err := newYARAScanner(slog.Default())
+	require.NoError(t, err)
+	decoded := struct {
+		PayloadHash string `json:"payload_hash"`
+		Missing     string `json:"missing"`
+	}{hash, storage.Hash([]byte("not stored"))}
+	matches := y.scan([]byte("/bin/busybox wget"), decoded)
+	require.Len(t, matches, 2)
+	require.Equal(t, "busybox", matches[0].Rule)
+	require.Empty(t, matches[0].PayloadHash)
+	require.Equal(t, "elf", matches[1].Rule)
+	require.Equal(t, hash, matches[1].PayloadHash)
+
+	// the matches of the stored payload are remembered
+	require.NoError(t, os.Remove(store.Path(hash)))
+	require.Len(t, y.scan(nil, decoded), 1)
+}
@@ -0,0 +1,135 @@
+package helpers
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	bruteForceThreshold = 5
+	bruteForceWindow    = 10 * time.Minute
+	bruteForceStep      = time.Second
+	bruteForceMaxDelay  = 10 * time.Second
+)
+
+// BruteForce is the tracker shared by all credential capturing handlers
+var BruteForce = NewBruteForceTracker(bruteForceThreshold, bruteForceWindow, bruteForceStep, bruteForceMaxDelay)
+
+type bruteForceSource struct {
+	failures int
+	last     time.Time
+}
+
+// BruteForceTracker counts failed authentication attempts per source IP
+type BruteForceTracker struct {
+	threshold int
+	window    time.Duration
+	step      time.Duration
+	maxDelay  time.Duration
+	sources   map[string]*bruteForceSource
+	lastPrune time.Time
+	mtx       sync.Mutex
+}
+
+// NewBruteForceTracker creates a tracker which starts delaying responses once
+// threshold failures were seen from a source within window. The delay grows by
+// step per additional failure up to maxDelay.
+func NewBruteForceTracker(threshold int, window, step, maxDelay time.Duration) *BruteForceTracker {
+	return &BruteForceTracker{
+		threshold: threshold,
+		window:    window,
+		step:      step,
+		maxDelay:  maxDelay,
+		sources:   map[string]*bruteForceSource{},
+		lastPrune: time.Now(),
+	}
+}
+
+// Fail records a failed attempt from ip. It returns the delay to apply before
+// responding and whether this attempt reached the detection threshold.
+func (t *BruteForceTracker) Fail(ip string) (time.Duration, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.lastPrune) > t.window {
+		for k, src := range t.sources {
+			if now.Sub(src.last) > t.window {
+				delete(t.sources, k)
+			}
+		}
+		t.lastPrune = now
+	}
+
+	src, ok := t.sources[ip]
+	if !ok || now.Sub(src.last) > t.window {
+		src = &bruteForceSource{}
+		t.sources[ip] = src
+	}
+	src.failures++
+	src.last = now
+
+	if src.failures <= t.threshold {
+		return 0, src.failures == t.threshold
+	}
+	delay := time.Duration(src.failures-t.threshold) * t.step
+	if delay > t.maxDelay {
+		delay = t.maxDelay
+	}
+	return delay, false
+}
+
+// Failures returns the number of failed attempts currently tracked for ip
+func (t *BruteForceTracker) Failures(ip string) int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if src, ok := t.sources[ip]; ok && time.Since(src.last) <= t.window {
+		return src.failures
+	}
+	return 0
+}
+
+type bruteForceEvent struct {
+	Event    string `json:"event"`
+	Failures int    `json:"failures"`
+}
+
+// RecordAuthFailure registers a failed login on conn with the shared tracker,
+// RecordCredential calls this for every credential a handler rejects. Once
+// the threshold is crossed a bruteforce_detected event is produced and later
+// attempts are slowed down.
+func RecordAuthFailure(ctx context.Context, handler string, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return
+	}
+	delay, detected := BruteForce.Fail(host)
+	if detected {
+		logger.Info(
+			"brute force detected",
+			slog.String("handler", handler),
+			slog.String("src_ip", host),
+			slog.Int("failures", bruteForceThreshold),
+		)
+		md.Tags = append(md.Tags, "bruteforce_detected")
+		if err := h.ProduceTCP(handler, conn, md, nil, bruteForceEvent{
+			Event:    "bruteforce_detected",
+			Failures: BruteForce.Failures(host),
+		}); err != nil {
+			logger.Error("Failed to produce message", slog.String("handler", handler), producer.ErrAttr(err))
+		}
+	}
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
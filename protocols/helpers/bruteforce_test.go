@@ -0,0 +1,31 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBruteForceTracker(t *testing.T) {
+	tracker := NewBruteForceTracker(5, time.Minute, time.Second, 3*time.Second)
+	for i := 1; i < 5; i++ {
+		delay, detected := tracker.Fail("1.2.3.4")
+		require.Zero(t, delay)
+		require.False(t, detected)
+	}
+	delay, detected := tracker.Fail("1.2.3.4")
+	require.Zero(t, delay)
+	require.True(t, detected, "expected detection on the fifth failure")
+
+	delay, detected = tracker.Fail("1.2.3.4")
+	require.Equal(t, time.Second, delay)
+	require.False(t, detected, "detection should only fire once")
+
+	for i := 0; i < 5; i++ {
+		delay, _ = tracker.Fail("1.2.3.4")
+	}
+	require.Equal(t, 3*time.Second, delay, "delay should be capped")
+	require.Equal(t, 11, tracker.Failures("1.2.3.4"))
+	require.Zero(t, tracker.Failures("4.3.2.1"))
+}
@@ -0,0 +1,81 @@
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	mrand "math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// GenerateCert creates a self-signed certificate for name with a validity
+// period that does not start right now
+func GenerateCert(name string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now().Add(-time.Duration(30+mrand.IntN(300)) * 24 * time.Hour).Truncate(time.Hour)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// CertCache generates self-signed certificates per server name, keeping up
+// to maxCerts of them
+type CertCache struct {
+	maxCerts int
+	certs    map[string]*tls.Certificate
+	mtx      sync.Mutex
+}
+
+func NewCertCache(maxCerts int) *CertCache {
+	return &CertCache{maxCerts: maxCerts, certs: map[string]*tls.Certificate{}}
+}
+
+// Get returns the certificate for name, generating it on first use
+func (c *CertCache) Get(name string) (*tls.Certificate, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if cert, ok := c.certs[name]; ok {
+		return cert, nil
+	}
+	cert, err := GenerateCert(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.certs) >= c.maxCerts {
+		c.certs = map[string]*tls.Certificate{}
+	}
+	c.certs[name] = cert
+	return cert, nil
+}
@@ -0,0 +1,376 @@
+package helpers
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	tlsHandshakeClientHello = 1
+	tlsHandshakeServerHello = 2
+	tlsRecordHandshake      = 22
+
+	tlsExtServerName          = 0
+	tlsExtSupportedGroups     = 10
+	tlsExtPointFormats        = 11
+	tlsExtSignatureAlgorithms = 13
+	tlsExtALPN                = 16
+	tlsExtSupportedVersions   = 43
+)
+
+// JA4 transports of the hellos fingerprinted
+const (
+	JA4TCP  = 't'
+	JA4QUIC = 'q'
+	JA4DTLS = 'd'
+)
+
+// ClientHello holds what a TLS ClientHello tells about the client and the
+// server it wants to reach
+type ClientHello struct {
+	Version      uint16   `json:"version"`
+	CipherSuites []uint16 `json:"cipher_suites,omitempty"`
+	Extensions   []uint16 `json:"extensions,omitempty"`
+	ServerName   string   `json:"server_name,omitempty"`
+	ALPN         []string `json:"alpn,omitempty"`
+	// SupportedGroups and PointFormats complete the JA3 fingerprint
+	SupportedGroups []uint16 `json:"supported_groups,omitempty"`
+	PointFormats    []uint16 `json:"point_formats,omitempty"`
+	// SupportedVersions and SignatureAlgorithms complete the JA4 fingerprint
+	SupportedVersions   []uint16 `json:"supported_versions,omitempty"`
+	SignatureAlgorithms []uint16 `json:"signature_algorithms,omitempty"`
+	// Random and Cookie, what a DTLS client echoes from a HelloVerifyRequest,
+	// are needed to complete handshakes
+	Random []byte `json:"-"`
+	Cookie []byte `json:"-"`
+}
+
+// isGREASE reports whether v is one of the reserved values of RFC 8701
+// clients sprinkle in to keep servers tolerant
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// JA3 returns the JA3 fingerprint string of the ClientHello and its MD5
+func (c *ClientHello) JA3() (string, string) {
+	join := func(values []uint16) string {
+		parts := []string{}
+		for _, v := range values {
+			if !isGREASE(v) {
+				parts = append(parts, strconv.Itoa(int(v)))
+			}
+		}
+		return strings.Join(parts, "-")
+	}
+	fingerprint := strings.Join([]string{
+		strconv.Itoa(int(c.Version)),
+		join(c.CipherSuites),
+		join(c.Extensions),
+		join(c.SupportedGroups),
+		join(c.PointFormats),
+	}, ",")
+	sum := md5.Sum([]byte(fingerprint))
+	return fingerprint, hex.EncodeToString(sum[:])
+}
+
+// ja4Versions names the protocol versions in JA4 fingerprints
+var ja4Versions = map[uint16]string{
+	0x0304: "13", 0x0303: "12", 0x0302: "11", 0x0301: "10", 0x0300: "s3", 0x0002: "s2",
+	0xfeff: "d1", 0xfefd: "d2", 0xfefc: "d3",
+}
+
+// ja4Hash is the truncated SHA256 JA4 fingerprints are made of, zeros
+// for nothing to hash
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:6])
+}
+
+// ja4List joins the values which are not GREASE as hex, sorted if asked
+func ja4List(values []uint16, sorted bool, skip ...uint16) []string {
+	parts := []string{}
+	for _, v := range values {
+		if !isGREASE(v) && !slices.Contains(skip, v) {
+			parts = append(parts, fmt.Sprintf("%04x", v))
+		}
+	}
+	if sorted {
+		slices.Sort(parts)
+	}
+	return parts
+}
+
+// JA4 returns the JA4 fingerprint of the ClientHello received over the
+// transport, one of JA4TCP, JA4QUIC or JA4DTLS
+func (c *ClientHello) JA4(transport byte) string {
+	version := c.Version
+	for _, v := range c.SupportedVersions {
+		if !isGREASE(v) && (version>>8 == 0xfe && v < version || version>>8 != 0xfe && v > version) {
+			version = v
+		}
+	}
+	name, ok := ja4Versions[version]
+	if !ok {
+		name = "00"
+	}
+	sni := "i"
+	if c.ServerName != "" {
+		sni = "d"
+	}
+	alpn := "00"
+	if len(c.ALPN) > 0 && c.ALPN[0] != "" {
+		first, last := c.ALPN[0][0], c.ALPN[0][len(c.ALPN[0])-1]
+		isAlnum := func(b byte) bool {
+			return b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+		}
+		if isAlnum(first) && isAlnum(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			alpn = fmt.Sprintf("%x%x", first>>4, last&0x0f)
+		}
+	}
+	ciphers := ja4List(c.CipherSuites, true)
+	extensions := ja4List(c.Extensions, false)
+	a := fmt.Sprintf("%c%s%s%02d%02d%s", transport, name, sni, min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	// the server name and ALPN are already part of the first section
+	sorted := strings.Join(ja4List(c.Extensions, true, tlsExtServerName, tlsExtALPN), ",")
+	if algorithms := ja4List(c.SignatureAlgorithms, false); sorted != "" && len(algorithms) > 0 {
+		sorted += "_" + strings.Join(algorithms, ",")
+	}
+	return a + "_" + ja4Hash(strings.Join(ciphers, ",")) + "_" + ja4Hash(sorted)
+}
+
+// ServerHello holds what a ServerHello answering a client tells about the
+// server software
+type ServerHello struct {
+	Version     uint16   `json:"version"`
+	CipherSuite uint16   `json:"cipher_suite"`
+	Extensions  []uint16 `json:"extensions,omitempty"`
+}
+
+// JA3S returns the JA3S fingerprint string of the ServerHello and its MD5
+func (s *ServerHello) JA3S() (string, string) {
+	extensions := []string{}
+	for _, ext := range s.Extensions {
+		extensions = append(extensions, strconv.Itoa(int(ext)))
+	}
+	fingerprint := strings.Join([]string{
+		strconv.Itoa(int(s.Version)),
+		strconv.Itoa(int(s.CipherSuite)),
+		strings.Join(extensions, "-"),
+	}, ",")
+	sum := md5.Sum([]byte(fingerprint))
+	return fingerprint, hex.EncodeToString(sum[:])
+}
+
+// HandshakeMessages joins the fragments of the TLS handshake records data
+// starts with, the stream ends at the first record of another type or
+// the first one cut short
+func HandshakeMessages(data []byte) []byte {
+	var messages []byte
+	s := cryptobyte.String(data)
+	for !s.Empty() {
+		var contentType uint8
+		var fragment cryptobyte.String
+		if !s.ReadUint8(&contentType) || contentType != tlsRecordHandshake ||
+			!s.Skip(2) || !s.ReadUint16LengthPrefixed(&fragment) {
+			break
+		}
+		messages = append(messages, fragment...)
+	}
+	return messages
+}
+
+// ClientHelloLength returns the length of the handshake message msg starts
+// with, including its 4 byte header, or 0 if msg is too short to tell
+func ClientHelloLength(msg []byte) int {
+	if len(msg) < 4 {
+		return 0
+	}
+	return 4 + (int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3]))
+}
+
+// ParseClientHello decodes a ClientHello handshake message, including its
+// type and length header
+func ParseClientHello(msg []byte) (*ClientHello, error) {
+	s := cryptobyte.String(msg)
+	var msgType uint8
+	var body cryptobyte.String
+	if !s.ReadUint8(&msgType) || msgType != tlsHandshakeClientHello || !s.ReadUint24LengthPrefixed(&body) {
+		return nil, errors.New("not a ClientHello")
+	}
+	return parseClientHelloBody(body, false)
+}
+
+// ParseDTLSClientHello decodes an unfragmented DTLS ClientHello handshake
+// message, including its 12 byte header
+func ParseDTLSClientHello(msg []byte) (*ClientHello, error) {
+	s := cryptobyte.String(msg)
+	var msgType uint8
+	var length, offset, fragmentLength uint32
+	if !s.ReadUint8(&msgType) || msgType != tlsHandshakeClientHello ||
+		!s.ReadUint24(&length) || !s.Skip(2) || !s.ReadUint24(&offset) || !s.ReadUint24(&fragmentLength) {
+		return nil, errors.New("not a DTLS ClientHello")
+	}
+	if offset != 0 || fragmentLength != length || len(s) < int(length) {
+		return nil, errors.New("fragmented DTLS ClientHello")
+	}
+	return parseClientHelloBody(s[:length], true)
+}
+
+// ParseServerHello decodes a ServerHello handshake message, including its
+// type and length header
+func ParseServerHello(msg []byte) (*ServerHello, error) {
+	s := cryptobyte.String(msg)
+	var msgType uint8
+	var body, sessionID cryptobyte.String
+	if !s.ReadUint8(&msgType) || msgType != tlsHandshakeServerHello || !s.ReadUint24LengthPrefixed(&body) {
+		return nil, errors.New("not a ServerHello")
+	}
+	hello := &ServerHello{}
+	var compression uint8
+	if !body.ReadUint16(&hello.Version) ||
+		!body.Skip(32) ||
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16(&hello.CipherSuite) ||
+		!body.ReadUint8(&compression) {
+		return nil, errors.New("truncated ServerHello")
+	}
+	if body.Empty() {
+		return hello, nil
+	}
+	var extensions cryptobyte.String
+	if !body.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errors.New("invalid extensions")
+	}
+	for !extensions.Empty() {
+		var ext uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&ext) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, errors.New("invalid extension")
+		}
+		hello.Extensions = append(hello.Extensions, ext)
+	}
+	return hello, nil
+}
+
+func parseClientHelloBody(body cryptobyte.String, dtls bool) (*ClientHello, error) {
+	hello := &ClientHello{}
+	var sessionID, cookie, suites, compression cryptobyte.String
+	if !body.ReadUint16(&hello.Version) ||
+		!body.ReadBytes(&hello.Random, 32) ||
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		dtls && !body.ReadUint8LengthPrefixed(&cookie) ||
+		!body.ReadUint16LengthPrefixed(&suites) ||
+		!body.ReadUint8LengthPrefixed(&compression) {
+		return nil, errors.New("truncated ClientHello")
+	}
+	hello.Cookie = cookie
+	for !suites.Empty() {
+		var suite uint16
+		if !suites.ReadUint16(&suite) {
+			return nil, errors.New("invalid cipher suites")
+		}
+		hello.CipherSuites = append(hello.CipherSuites, suite)
+	}
+	if body.Empty() {
+		return hello, nil
+	}
+
+	var extensions cryptobyte.String
+	if !body.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errors.New("invalid extensions")
+	}
+	for !extensions.Empty() {
+		var ext uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&ext) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, errors.New("invalid extension")
+		}
+		hello.Extensions = append(hello.Extensions, ext)
+		switch ext {
+		case tlsExtServerName:
+			var names cryptobyte.String
+			if !data.ReadUint16LengthPrefixed(&names) {
+				return nil, errors.New("invalid server name extension")
+			}
+			for !names.Empty() {
+				var nameType uint8
+				var name cryptobyte.String
+				if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+					return nil, errors.New("invalid server name")
+				}
+				if nameType == 0 {
+					hello.ServerName = string(name)
+				}
+			}
+		case tlsExtSupportedGroups:
+			var groups cryptobyte.String
+			if !data.ReadUint16LengthPrefixed(&groups) {
+				return nil, errors.New("invalid supported groups extension")
+			}
+			for !groups.Empty() {
+				var group uint16
+				if !groups.ReadUint16(&group) {
+					return nil, errors.New("invalid supported group")
+				}
+				hello.SupportedGroups = append(hello.SupportedGroups, group)
+			}
+		case tlsExtPointFormats:
+			var formats cryptobyte.String
+			if !data.ReadUint8LengthPrefixed(&formats) {
+				return nil, errors.New("invalid point formats extension")
+			}
+			for _, format := range formats {
+				hello.PointFormats = append(hello.PointFormats, uint16(format))
+			}
+		case tlsExtSignatureAlgorithms, tlsExtSupportedVersions:
+			var list cryptobyte.String
+			var ok bool
+			if ext == tlsExtSignatureAlgorithms {
+				ok = data.ReadUint16LengthPrefixed(&list)
+			} else {
+				ok = data.ReadUint8LengthPrefixed(&list)
+			}
+			if !ok {
+				return nil, errors.New("invalid extension list")
+			}
+			for !list.Empty() {
+				var v uint16
+				if !list.ReadUint16(&v) {
+					return nil, errors.New("invalid extension list")
+				}
+				if ext == tlsExtSignatureAlgorithms {
+					hello.SignatureAlgorithms = append(hello.SignatureAlgorithms, v)
+				} else {
+					hello.SupportedVersions = append(hello.SupportedVersions, v)
+				}
+			}
+		case tlsExtALPN:
+			var protocols cryptobyte.String
+			if !data.ReadUint16LengthPrefixed(&protocols) {
+				return nil, errors.New("invalid ALPN extension")
+			}
+			for !protocols.Empty() {
+				var protocol cryptobyte.String
+				if !protocols.ReadUint8LengthPrefixed(&protocol) {
+					return nil, errors.New("invalid ALPN protocol")
+				}
+				hello.ALPN = append(hello.ALPN, string(protocol))
+			}
+		}
+	}
+	return hello, nil
+}
@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/metrics"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// credentialsMaxEntries bounds the distinct values counted for the report
+const credentialsMaxEntries = 100000
+
+// Credentials counts the credentials captured by all handlers
+var Credentials = credentials.NewStats(credentialsMaxEntries)
+
+type credentialEvent struct {
+	Event string `json:"event"`
+	credentials.Credential
+}
+
+// countCredential adds cred to the report and logs it
+func countCredential(cred credentials.Credential, host string, logger interfaces.Logger) {
+	Credentials.Add(cred)
+	metrics.Credentials.WithLabelValues(cred.Protocol).Inc()
+	logger.Info(
+		"credential captured",
+		slog.String("handler", cred.Protocol),
+		slog.String("src_ip", host),
+		slog.String("username", cred.Username),
+		slog.String("password", cred.Password),
+		slog.String("hash", cred.Hash),
+		slog.Bool("success", cred.Success),
+	)
+}
+
+// RecordCredential reports a credential captured on conn by the handler
+// named in cred.Protocol. It is logged, produced as a credential event and
+// counted for the top credentials report. Logins the handler rejects are
+// registered with the brute force tracker as well, so the client is never
+// slowed down after being let in.
+func RecordCredential(ctx context.Context, conn net.Conn, md connection.Metadata, cred credentials.Credential, logger interfaces.Logger, h interfaces.Honeypot) {
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	countCredential(cred, host, logger)
+	if err := h.ProduceTCP(cred.Protocol, conn, md, nil, credentialEvent{Event: "credential", Credential: cred}); err != nil {
+		logger.Error("Failed to produce message", slog.String("handler", cred.Protocol), producer.ErrAttr(err))
+	}
+	if !cred.Success {
+		RecordAuthFailure(ctx, cred.Protocol, conn, md, logger, h)
+	}
+}
+
+// RecordUDPCredential is RecordCredential for the datagrams of a UDP
+// handler, which are not tracked for brute forcing
+func RecordUDPCredential(srcAddr, dstAddr *net.UDPAddr, md connection.Metadata, cred credentials.Credential, logger interfaces.Logger, h interfaces.Honeypot) {
+	countCredential(cred, srcAddr.IP.String(), logger)
+	if err := h.ProduceUDP(cred.Protocol, srcAddr, dstAddr, md, nil, credentialEvent{Event: "credential", Credential: cred}); err != nil {
+		logger.Error("Failed to produce message", slog.String("handler", cred.Protocol), producer.ErrAttr(err))
+	}
+}
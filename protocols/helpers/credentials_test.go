@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordCredential(t *testing.T) {
+	Credentials = credentials.NewStats(100)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	h := &mocks.MockHoneypot{}
+	cred := credentials.Credential{Protocol: "telnet", Username: "root", Password: "vizxv", Success: true}
+	h.EXPECT().ProduceTCP("telnet", mock.Anything, mock.Anything, []byte(nil), credentialEvent{Event: "credential", Credential: cred}).Return(nil)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	RecordCredential(context.Background(), server, connection.Metadata{}, cred, l, h)
+	h.AssertExpectations(t)
+
+	report := Credentials.Top(10)
+	require.Equal(t, 1, report.Total)
+	require.Equal(t, []credentials.PairCount{{Username: "root", Password: "vizxv", Count: 1}}, report.Pairs)
+}
+
+func TestRecordCredentialBruteForce(t *testing.T) {
+	previous := BruteForce
+	BruteForce = NewBruteForceTracker(1, time.Minute, time.Second, time.Second)
+	defer func() { BruteForce = previous }()
+
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("brute force detected", mock.Anything, mock.Anything, mock.Anything).Return().Once()
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().ProduceTCP("ftp", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// accepted logins are neither counted nor delayed
+	started := time.Now()
+	for range 3 {
+		RecordCredential(context.Background(), conn, connection.Metadata{}, credentials.Credential{Protocol: "ftp", Username: "root", Success: true}, l, h)
+	}
+	require.Less(t, time.Since(started), time.Second)
+	require.Zero(t, BruteForce.Failures("127.0.0.1"))
+
+	RecordCredential(context.Background(), conn, connection.Metadata{}, credentials.Credential{Protocol: "ftp", Username: "root"}, l, h)
+	require.Equal(t, 1, BruteForce.Failures("127.0.0.1"))
+	l.AssertExpectations(t)
+}
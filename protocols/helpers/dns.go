@@ -0,0 +1,108 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/spf13/viper"
+)
+
+const dnsAnswerTTL = 300
+
+// DNSQuestion is a single query of a DNS message
+type DNSQuestion struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// DNSMessage is the decoded form of a DNS query and our answer to it
+type DNSMessage struct {
+	ID        uint16        `json:"id"`
+	Opcode    string        `json:"opcode"`
+	Questions []DNSQuestion `json:"questions,omitempty"`
+	RCode     string        `json:"rcode"`
+	Answers   []string      `json:"answers,omitempty"`
+}
+
+// DecodeDNS decodes a DNS message. gopacket panics on some malformed
+// questions, those are returned as errors.
+func DecodeDNS(data []byte) (dns *layers.DNS, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			dns, err = nil, fmt.Errorf("malformed DNS message: %v", r)
+		}
+	}()
+	dns = &layers.DNS{}
+	if err := dns.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		return nil, err
+	}
+	return dns, nil
+}
+
+// DNSResponse parses a DNS query and creates the configured answer: the
+// sinkhole address for A and AAAA questions, or NXDOMAIN when the dns.mode
+// setting is "nxdomain"
+func DNSResponse(data []byte) ([]byte, DNSMessage, error) {
+	query, err := DecodeDNS(data)
+	if err != nil {
+		return nil, DNSMessage{}, err
+	}
+	msg := DNSMessage{
+		ID:     query.ID,
+		Opcode: query.OpCode.String(),
+	}
+	for _, q := range query.Questions {
+		msg.Questions = append(msg.Questions, DNSQuestion{Name: string(q.Name), Type: q.Type.String()})
+	}
+	if query.QR {
+		return nil, msg, errors.New("not a DNS query")
+	}
+
+	resp := &layers.DNS{
+		ID:           query.ID,
+		QR:           true,
+		OpCode:       query.OpCode,
+		RD:           query.RD,
+		RA:           true,
+		ResponseCode: layers.DNSResponseCodeNoErr,
+		Questions:    query.Questions,
+	}
+	sinkhole := net.ParseIP(viper.GetString("dns.sinkhole"))
+	switch {
+	case query.OpCode != layers.DNSOpCodeQuery:
+		resp.ResponseCode = layers.DNSResponseCodeNotImp
+	case viper.GetString("dns.mode") == "nxdomain":
+		resp.ResponseCode = layers.DNSResponseCodeNXDomain
+	case sinkhole != nil:
+		for _, q := range query.Questions {
+			answer := layers.DNSResourceRecord{
+				Name:  q.Name,
+				Type:  q.Type,
+				Class: layers.DNSClassIN,
+				TTL:   dnsAnswerTTL,
+			}
+			switch {
+			case q.Type == layers.DNSTypeA && sinkhole.To4() != nil:
+				answer.IP = sinkhole.To4()
+			case q.Type == layers.DNSTypeAAAA && sinkhole.To4() == nil:
+				answer.IP = sinkhole
+			default:
+				continue
+			}
+			resp.Answers = append(resp.Answers, answer)
+			msg.Answers = append(msg.Answers, answer.IP.String())
+		}
+	}
+	resp.QDCount = uint16(len(resp.Questions))
+	resp.ANCount = uint16(len(resp.Answers))
+	msg.RCode = resp.ResponseCode.String()
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := resp.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		return nil, msg, err
+	}
+	return buf.Bytes(), msg, nil
+}
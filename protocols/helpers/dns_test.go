@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func dnsQuery(t *testing.T, name string, qtype layers.DNSType) []byte {
+	query := &layers.DNS{
+		ID:        0x1234,
+		RD:        true,
+		QDCount:   1,
+		Questions: []layers.DNSQuestion{{Name: []byte(name), Type: qtype, Class: layers.DNSClassIN}},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, query.SerializeTo(buf, gopacket.SerializeOptions{}))
+	return buf.Bytes()
+}
+
+func TestDNSResponse(t *testing.T) {
+	viper.Set("dns.mode", "sinkhole")
+	viper.Set("dns.sinkhole", "192.0.2.1")
+	defer viper.Reset()
+
+	data, msg, err := DNSResponse(dnsQuery(t, "example.com", layers.DNSTypeA))
+	require.NoError(t, err)
+	require.Equal(t, []DNSQuestion{{Name: "example.com", Type: "A"}}, msg.Questions)
+	require.Equal(t, []string{"192.0.2.1"}, msg.Answers)
+
+	resp := &layers.DNS{}
+	require.NoError(t, resp.DecodeFromBytes(data, gopacket.NilDecodeFeedback))
+	require.True(t, resp.QR)
+	require.Equal(t, uint16(0x1234), resp.ID)
+	require.Len(t, resp.Answers, 1)
+	require.Equal(t, "192.0.2.1", resp.Answers[0].IP.String())
+
+	_, msg, err = DNSResponse(dnsQuery(t, "example.com", layers.DNSTypeAAAA))
+	require.NoError(t, err)
+	require.Empty(t, msg.Answers)
+	require.Equal(t, "No Error", msg.RCode)
+
+	viper.Set("dns.mode", "nxdomain")
+	_, msg, err = DNSResponse(dnsQuery(t, "example.com", layers.DNSTypeA))
+	require.NoError(t, err)
+	require.Equal(t, "Non-Existent Domain", msg.RCode)
+
+	_, _, err = DNSResponse([]byte{0x00})
+	require.Error(t, err)
+}
+
+func TestDNSResponseMalformed(t *testing.T) {
+	// questions gopacket fails to decode with a panic
+	udp, err := hex.DecodeString("b601ffff5aff068d6b0101e62f8930ffc547509dffbaffffff2affff3eaaff01ff035f10ffdbff01ffffff01ff0300189e0223026602034903ffffcc018c00001b")
+	require.NoError(t, err)
+	for _, data := range [][]byte{[]byte("000000000&0\x00\x00\x02\x000"), udp} {
+		require.NotPanics(t, func() {
+			_, _, err := DNSResponse(data)
+			require.Error(t, err)
+		})
+	}
+}
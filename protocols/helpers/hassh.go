@@ -0,0 +1,91 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const sshMsgKexInit = 20
+
+// SSHKexInit holds the algorithms an SSH KEXINIT message offers
+type SSHKexInit struct {
+	KexAlgorithms           []string `json:"kex_algorithms,omitempty"`
+	HostKeyAlgorithms       []string `json:"host_key_algorithms,omitempty"`
+	CiphersClientServer     []string `json:"ciphers_client_server,omitempty"`
+	CiphersServerClient     []string `json:"ciphers_server_client,omitempty"`
+	MACsClientServer        []string `json:"macs_client_server,omitempty"`
+	MACsServerClient        []string `json:"macs_server_client,omitempty"`
+	CompressionClientServer []string `json:"compression_client_server,omitempty"`
+	CompressionServerClient []string `json:"compression_server_client,omitempty"`
+}
+
+func hassh(lists ...[]string) (string, string) {
+	parts := make([]string, 0, len(lists))
+	for _, list := range lists {
+		parts = append(parts, strings.Join(list, ","))
+	}
+	fingerprint := strings.Join(parts, ";")
+	sum := md5.Sum([]byte(fingerprint))
+	return fingerprint, hex.EncodeToString(sum[:])
+}
+
+// HASSH returns the HASSH fingerprint string of a client KEXINIT and its MD5
+func (k *SSHKexInit) HASSH() (string, string) {
+	return hassh(k.KexAlgorithms, k.CiphersClientServer, k.MACsClientServer, k.CompressionClientServer)
+}
+
+// HASSHServer returns the HASSHServer fingerprint string of a server
+// KEXINIT and its MD5
+func (k *SSHKexInit) HASSHServer() (string, string) {
+	return hassh(k.KexAlgorithms, k.CiphersServerClient, k.MACsServerClient, k.CompressionServerClient)
+}
+
+// readSSHString reads a uint32 length prefixed string as SSH encodes them
+func readSSHString(s *cryptobyte.String, out *cryptobyte.String) bool {
+	var length uint32
+	return s.ReadUint32(&length) && s.ReadBytes((*[]byte)(out), int(length))
+}
+
+// ParseSSHKexInit decodes the KEXINIT an SSH stream starts with after the
+// version exchange, the lines sent before the version are skipped
+func ParseSSHKexInit(stream []byte) (*SSHKexInit, error) {
+	for {
+		line, rest, ok := bytes.Cut(stream, []byte("\n"))
+		if !ok {
+			return nil, errors.New("missing SSH version")
+		}
+		stream = rest
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			break
+		}
+	}
+
+	s := cryptobyte.String(stream)
+	var packet cryptobyte.String
+	var padding, msgType uint8
+	if !readSSHString(&s, &packet) || !packet.ReadUint8(&padding) ||
+		!packet.ReadUint8(&msgType) || msgType != sshMsgKexInit || !packet.Skip(16) {
+		return nil, errors.New("not an SSH KEXINIT")
+	}
+	kex := &SSHKexInit{}
+	for _, list := range []*[]string{
+		&kex.KexAlgorithms, &kex.HostKeyAlgorithms,
+		&kex.CiphersClientServer, &kex.CiphersServerClient,
+		&kex.MACsClientServer, &kex.MACsServerClient,
+		&kex.CompressionClientServer, &kex.CompressionServerClient,
+	} {
+		var names cryptobyte.String
+		if !readSSHString(&packet, &names) {
+			return nil, errors.New("truncated SSH KEXINIT")
+		}
+		if len(names) > 0 {
+			*list = strings.Split(string(names), ",")
+		}
+	}
+	return kex, nil
+}
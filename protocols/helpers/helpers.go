@@ -1,10 +1,13 @@
 package helpers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"bytes"
 	"os"
-	"path/filepath"
+	"sync"
+
+	"github.com/mushorg/glutton/storage"
+	"github.com/mushorg/glutton/transcript"
+	"github.com/spf13/viper"
 )
 
 func FirstOrEmpty[T any](s []T) T {
@@ -15,24 +18,66 @@ func FirstOrEmpty[T any](s []T) T {
 	return t
 }
 
+var (
+	payloadStore     *storage.Store
+	payloadStoreErr  error
+	payloadStoreOnce sync.Once
+)
+
+// payloads opens the payload store in storage.payloads.dir once
+func payloads() (*storage.Store, error) {
+	payloadStoreOnce.Do(func() {
+		dir := viper.GetString("storage.payloads.dir")
+		if dir == "" {
+			dir = "payloads"
+		}
+		payloadStore, payloadStoreErr = storage.Open(dir,
+			viper.GetInt64("storage.payloads.max_size")<<20,
+			viper.GetInt64("storage.payloads.max_total")<<20,
+		)
+	})
+	return payloadStore, payloadStoreErr
+}
+
+// StorePayload keeps data in the payload store under its sha256 digest,
+// which is returned for events to reference it. New payloads are also
+// uploaded to S3 when storage.s3 is enabled.
 func StorePayload(data []byte) (string, error) {
-	sum := sha256.Sum256(data)
-	if err := os.MkdirAll("payloads", os.ModePerm); err != nil {
-		return "", err
-	}
-	sha256Hash := hex.EncodeToString(sum[:])
-	path := filepath.Join("payloads", sha256Hash)
-	if _, err := os.Stat(path); err == nil {
-		// file already exists
-		return "", nil
+	upload := viper.GetBool("storage.s3.enabled")
+	if upload && !viper.GetBool("storage.s3.keep_local") {
+		hash := storage.Hash(data)
+		return hash, UploadObject(ObjectPayload, hash, data)
 	}
-	out, err := os.Create(path)
+	store, err := payloads()
 	if err != nil {
 		return "", err
 	}
-	defer out.Close()
-	if _, err = out.Write(data); err != nil {
-		return "", err
+	hash, stored, err := store.Put(data)
+	if err != nil || !stored || !upload {
+		return hash, err
+	}
+	return hash, UploadObject(ObjectPayload, hash, data)
+}
+
+// StoreTranscript writes a session transcript to transcripts.dir, it is
+// uploaded to S3 as well when storage.s3 is enabled
+func StoreTranscript(t *transcript.Transcript) error {
+	var buf bytes.Buffer
+	if err := t.Encode(&buf); err != nil {
+		return err
+	}
+	upload := viper.GetBool("storage.s3.enabled")
+	if !upload || viper.GetBool("storage.s3.keep_local") {
+		dir := viper.GetString("transcripts.dir")
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return err
+		}
+		if err := os.WriteFile(transcript.Path(dir, t.ID), buf.Bytes(), 0o640); err != nil {
+			return err
+		}
+	}
+	if upload {
+		return UploadObject(ObjectTranscript, t.ID, buf.Bytes())
 	}
-	return sha256Hash, nil
+	return nil
 }
@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// JA4H returns the JA4H fingerprint of an HTTP/1 request from its raw
+// head, the header names are taken in the order and case sent
+func JA4H(head []byte) string {
+	if end := bytes.Index(head, []byte("\r\n\r\n")); end >= 0 {
+		head = head[:end]
+	}
+	lines := strings.Split(string(head), "\r\n")
+	requestLine := strings.Fields(lines[0])
+	if len(requestLine) != 3 {
+		return ""
+	}
+	method := strings.ToLower(requestLine[0])
+	if len(method) > 2 {
+		method = method[:2]
+	}
+	version := strings.ReplaceAll(strings.TrimPrefix(requestLine[2], "HTTP/"), ".", "")
+	version = (version + "0")[:2]
+
+	cookie, referer, lang := "n", "n", "0000"
+	names, cookies := []string{}, []string{}
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(name) {
+		case "cookie":
+			cookie = "c"
+			for _, field := range strings.Split(value, ";") {
+				if field = strings.TrimSpace(field); field != "" {
+					cookies = append(cookies, field)
+				}
+			}
+			continue
+		case "referer":
+			referer = "r"
+			continue
+		case "accept-language":
+			first, _, _ := strings.Cut(strings.ReplaceAll(strings.ToLower(value), "-", ""), ",")
+			first, _, _ = strings.Cut(first, ";")
+			lang = (first + "0000")[:4]
+		}
+		names = append(names, name)
+	}
+
+	fields := []string{}
+	for _, c := range cookies {
+		name, _, _ := strings.Cut(c, "=")
+		fields = append(fields, name)
+	}
+	slices.Sort(fields)
+	slices.Sort(cookies)
+	return fmt.Sprintf("%s%s%s%s%02d%s_%s_%s_%s", method, version, cookie, referer, min(len(names), 99), lang,
+		ja4Hash(strings.Join(names, ",")), ja4Hash(strings.Join(fields, ",")), ja4Hash(strings.Join(cookies, ",")))
+}
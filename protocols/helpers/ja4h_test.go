@@ -0,0 +1,22 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJA4H(t *testing.T) {
+	head := "GET /index.html HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"User-Agent: curl/8.0\r\n" +
+		"Accept-Language: en-US,en;q=0.9\r\n" +
+		"Cookie: session=abc; lang=de\r\n" +
+		"Referer: http://example.com/\r\n" +
+		"\r\n"
+	require.Equal(t, "ge11cr03enus_"+ja4Hash("Host,User-Agent,Accept-Language")+"_"+ja4Hash("lang,session")+"_"+ja4Hash("lang=de,session=abc"), JA4H([]byte(head)))
+
+	fp := JA4H([]byte("POST / HTTP/1.0\r\nHost: x\r\n\r\nbody"))
+	require.Equal(t, "po10nn010000_"+ja4Hash("Host")+"_000000000000_000000000000", fp)
+	require.Empty(t, JA4H([]byte("garbage")))
+}
@@ -0,0 +1,225 @@
+package helpers
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	krbASReq  = 10
+	krbTGSReq = 12
+	krbError  = 30
+
+	krbPrincipalSrvInst = 2
+	krbPAEncTimestamp   = 2
+	krbPAETypeInfo2     = 19
+
+	krbErrServerUnknown   = 7
+	krbErrPreauthFailed   = 24
+	krbErrPreauthRequired = 25
+)
+
+var krbEncryptionTypes = map[int]string{
+	1:  "des-cbc-crc",
+	3:  "des-cbc-md5",
+	17: "aes128-cts-hmac-sha1-96",
+	18: "aes256-cts-hmac-sha1-96",
+	23: "rc4-hmac",
+	24: "rc4-hmac-exp",
+}
+
+var krbErrors = map[int]string{
+	krbErrServerUnknown:   "KDC_ERR_S_PRINCIPAL_UNKNOWN",
+	krbErrPreauthFailed:   "KDC_ERR_PREAUTH_FAILED",
+	krbErrPreauthRequired: "KDC_ERR_PREAUTH_REQUIRED",
+}
+
+type krbPrincipal struct {
+	NameType   int      `asn1:"explicit,tag:0"`
+	NameString []string `asn1:"explicit,tag:1"`
+}
+
+func (p krbPrincipal) String() string {
+	return strings.Join(p.NameString, "/")
+}
+
+type krbPAData struct {
+	Type  int    `asn1:"explicit,tag:1"`
+	Value []byte `asn1:"explicit,tag:2"`
+}
+
+type krbEncryptedData struct {
+	EType  int    `asn1:"explicit,tag:0"`
+	KVNO   int    `asn1:"optional,explicit,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+type krbRequestBody struct {
+	Options asn1.BitString `asn1:"explicit,tag:0"`
+	CName   krbPrincipal   `asn1:"optional,explicit,tag:1"`
+	Realm   string         `asn1:"explicit,tag:2"`
+	SName   krbPrincipal   `asn1:"optional,explicit,tag:3"`
+	From    asn1.RawValue  `asn1:"optional,explicit,tag:4"`
+	Till    asn1.RawValue  `asn1:"optional,explicit,tag:5"`
+	RTime   asn1.RawValue  `asn1:"optional,explicit,tag:6"`
+	Nonce   int64          `asn1:"explicit,tag:7"`
+	ETypes  []int          `asn1:"explicit,tag:8"`
+}
+
+type krbKDCRequest struct {
+	PVNO    int            `asn1:"explicit,tag:1"`
+	MsgType int            `asn1:"explicit,tag:2"`
+	PAData  []krbPAData    `asn1:"optional,explicit,tag:3"`
+	Body    krbRequestBody `asn1:"explicit,tag:4"`
+}
+
+// KerberosMessage is the decoded form of a KDC request and our answer to it
+type KerberosMessage struct {
+	Type            string   `json:"type"`
+	Realm           string   `json:"realm,omitempty"`
+	Client          string   `json:"client,omitempty"`
+	Service         string   `json:"service,omitempty"`
+	EncryptionTypes []string `json:"encryption_types,omitempty"`
+	PreAuth         []int    `json:"preauth,omitempty"`
+	// Hash is the encrypted timestamp of the pre-authentication in the
+	// hashcat krb5pa format
+	Hash  string `json:"hash,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func krbTLV(class, tag int, compound bool, content ...[]byte) []byte {
+	value := []byte{}
+	for _, c := range content {
+		value = append(value, c...)
+	}
+	data, _ := asn1.Marshal(asn1.RawValue{Class: class, Tag: tag, IsCompound: compound, Bytes: value})
+	return data
+}
+
+func krbExplicit(tag int, content ...[]byte) []byte {
+	return krbTLV(asn1.ClassContextSpecific, tag, true, content...)
+}
+
+func krbSequence(content ...[]byte) []byte {
+	return krbTLV(asn1.ClassUniversal, asn1.TagSequence, true, content...)
+}
+
+func krbInt(n int) []byte {
+	data, _ := asn1.Marshal(n)
+	return data
+}
+
+func krbString(s string) []byte {
+	return krbTLV(asn1.ClassUniversal, asn1.TagGeneralString, false, []byte(s))
+}
+
+func krbPrincipalName(p krbPrincipal) []byte {
+	names := [][]byte{}
+	for _, name := range p.NameString {
+		names = append(names, krbString(name))
+	}
+	return krbSequence(krbExplicit(0, krbInt(p.NameType)), krbExplicit(1, krbSequence(names...)))
+}
+
+// krbErrorMessage builds a KRB-ERROR for the request, e-data is left out
+// when edata is nil
+func krbErrorMessage(code int, req *krbKDCRequest, now time.Time, edata []byte) []byte {
+	stime, _ := asn1.MarshalWithParams(now.UTC().Truncate(time.Second), "generalized")
+	sname := req.Body.SName
+	if len(sname.NameString) == 0 {
+		sname = krbPrincipal{NameType: krbPrincipalSrvInst, NameString: []string{"krbtgt", req.Body.Realm}}
+	}
+	fields := [][]byte{
+		krbExplicit(0, krbInt(5)),
+		krbExplicit(1, krbInt(krbError)),
+		krbExplicit(4, stime),
+		krbExplicit(5, krbInt(now.Nanosecond()/1000)),
+		krbExplicit(6, krbInt(code)),
+	}
+	if len(req.Body.CName.NameString) > 0 {
+		fields = append(fields, krbExplicit(7, krbString(req.Body.Realm)), krbExplicit(8, krbPrincipalName(req.Body.CName)))
+	}
+	fields = append(fields, krbExplicit(9, krbString(req.Body.Realm)), krbExplicit(10, krbPrincipalName(sname)))
+	if edata != nil {
+		fields = append(fields, krbExplicit(12, krbTLV(asn1.ClassUniversal, asn1.TagOctetString, false, edata)))
+	}
+	return krbTLV(asn1.ClassApplication, krbError, true, krbSequence(fields...))
+}
+
+// krbPreauthMethods lists encrypted timestamp pre-authentication with the
+// AES and RC4 keys of a Windows KDC, salted with the realm and user name
+func krbPreauthMethods(req *krbKDCRequest) []byte {
+	salt := strings.ToUpper(req.Body.Realm) + strings.Join(req.Body.CName.NameString, "")
+	info := krbSequence(
+		krbSequence(krbExplicit(0, krbInt(18)), krbExplicit(1, krbString(salt))),
+		krbSequence(krbExplicit(0, krbInt(23))),
+	)
+	return krbSequence(
+		krbSequence(krbExplicit(1, krbInt(krbPAETypeInfo2)), krbExplicit(2, krbTLV(asn1.ClassUniversal, asn1.TagOctetString, false, info))),
+		krbSequence(krbExplicit(1, krbInt(krbPAEncTimestamp)), krbExplicit(2, krbTLV(asn1.ClassUniversal, asn1.TagOctetString, false))),
+	)
+}
+
+// KerberosResponse parses an AS-REQ or TGS-REQ and creates the error a KDC
+// would answer with: AS-REQs without pre-authentication are asked for it,
+// pre-authenticated ones fail and TGS-REQs name an unknown service
+func KerberosResponse(data []byte) ([]byte, KerberosMessage, error) {
+	outer := asn1.RawValue{}
+	if _, err := asn1.Unmarshal(data, &outer); err != nil {
+		return nil, KerberosMessage{}, err
+	}
+	msg := KerberosMessage{}
+	switch {
+	case outer.Class == asn1.ClassApplication && outer.Tag == krbASReq:
+		msg.Type = "as_req"
+	case outer.Class == asn1.ClassApplication && outer.Tag == krbTGSReq:
+		msg.Type = "tgs_req"
+	default:
+		return nil, msg, errors.New("not a KDC request")
+	}
+	req := &krbKDCRequest{}
+	if _, err := asn1.Unmarshal(outer.Bytes, req); err != nil {
+		return nil, msg, err
+	}
+	msg.Realm = req.Body.Realm
+	msg.Client = req.Body.CName.String()
+	msg.Service = req.Body.SName.String()
+	for _, etype := range req.Body.ETypes {
+		name, ok := krbEncryptionTypes[etype]
+		if !ok {
+			name = fmt.Sprintf("etype-%d", etype)
+		}
+		msg.EncryptionTypes = append(msg.EncryptionTypes, name)
+	}
+	encTimestamp := false
+	for _, pa := range req.PAData {
+		msg.PreAuth = append(msg.PreAuth, pa.Type)
+		if pa.Type != krbPAEncTimestamp {
+			continue
+		}
+		enc := krbEncryptedData{}
+		if _, err := asn1.Unmarshal(pa.Value, &enc); err != nil {
+			continue
+		}
+		encTimestamp = true
+		switch enc.EType {
+		case 23:
+			msg.Hash = fmt.Sprintf("$krb5pa$23$%s$%s$$%x", msg.Client, msg.Realm, enc.Cipher)
+		case 17, 18:
+			msg.Hash = fmt.Sprintf("$krb5pa$%d$%s$%s$%x", enc.EType, msg.Client, msg.Realm, enc.Cipher)
+		}
+	}
+
+	code, edata := krbErrServerUnknown, []byte(nil)
+	if msg.Type == "as_req" {
+		code, edata = krbErrPreauthRequired, krbPreauthMethods(req)
+		if encTimestamp {
+			code, edata = krbErrPreauthFailed, nil
+		}
+	}
+	msg.Error = krbErrors[code]
+	return krbErrorMessage(code, req, time.Now(), edata), msg, nil
+}
@@ -0,0 +1,82 @@
+package helpers
+
+import (
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func krbASRequest(padata ...[]byte) []byte {
+	options, _ := asn1.Marshal(asn1.BitString{Bytes: []byte{0x40, 0x81, 0x00, 0x10}, BitLength: 32})
+	till, _ := asn1.MarshalWithParams(time.Date(2037, 9, 13, 2, 48, 5, 0, time.UTC), "generalized")
+	body := krbSequence(
+		krbExplicit(0, options),
+		krbExplicit(1, krbPrincipalName(krbPrincipal{NameType: 1, NameString: []string{"svc_sql"}})),
+		krbExplicit(2, krbString("CORP.LOCAL")),
+		krbExplicit(3, krbPrincipalName(krbPrincipal{NameType: 2, NameString: []string{"krbtgt", "CORP.LOCAL"}})),
+		krbExplicit(5, till),
+		krbExplicit(7, krbInt(12345)),
+		krbExplicit(8, krbSequence(krbInt(18), krbInt(23))),
+	)
+	fields := [][]byte{krbExplicit(1, krbInt(5)), krbExplicit(2, krbInt(krbASReq))}
+	if len(padata) > 0 {
+		fields = append(fields, krbExplicit(3, krbSequence(padata...)))
+	}
+	fields = append(fields, krbExplicit(4, body))
+	return krbTLV(asn1.ClassApplication, krbASReq, true, krbSequence(fields...))
+}
+
+func TestKerberosResponse(t *testing.T) {
+	resp, msg, err := KerberosResponse(krbASRequest())
+	require.NoError(t, err)
+	require.Equal(t, KerberosMessage{
+		Type:            "as_req",
+		Realm:           "CORP.LOCAL",
+		Client:          "svc_sql",
+		Service:         "krbtgt/CORP.LOCAL",
+		EncryptionTypes: []string{"aes256-cts-hmac-sha1-96", "rc4-hmac"},
+		Error:           "KDC_ERR_PREAUTH_REQUIRED",
+	}, msg)
+
+	krbErr := asn1.RawValue{}
+	_, err = asn1.Unmarshal(resp, &krbErr)
+	require.NoError(t, err)
+	require.Equal(t, asn1.ClassApplication, krbErr.Class)
+	require.Equal(t, krbError, krbErr.Tag)
+	var fields struct {
+		PVNO    int          `asn1:"explicit,tag:0"`
+		MsgType int          `asn1:"explicit,tag:1"`
+		STime   time.Time    `asn1:"generalized,explicit,tag:4"`
+		SUSec   int          `asn1:"explicit,tag:5"`
+		Code    int          `asn1:"explicit,tag:6"`
+		CRealm  string       `asn1:"optional,explicit,tag:7"`
+		CName   krbPrincipal `asn1:"optional,explicit,tag:8"`
+		Realm   string       `asn1:"explicit,tag:9"`
+		SName   krbPrincipal `asn1:"explicit,tag:10"`
+		EData   []byte       `asn1:"optional,explicit,tag:12"`
+	}
+	_, err = asn1.Unmarshal(krbErr.Bytes, &fields)
+	require.NoError(t, err)
+	require.Equal(t, krbErrPreauthRequired, fields.Code)
+	require.Equal(t, []string{"svc_sql"}, fields.CName.NameString)
+	methods := []krbPAData{}
+	_, err = asn1.Unmarshal(fields.EData, &methods)
+	require.NoError(t, err)
+	require.Equal(t, krbPAETypeInfo2, methods[0].Type)
+
+	// the client retries with an RC4 encrypted timestamp
+	cipher := make([]byte, 52)
+	cipher[0] = 0xab
+	enc := krbSequence(krbExplicit(0, krbInt(23)), krbExplicit(2, krbTLV(asn1.ClassUniversal, asn1.TagOctetString, false, cipher)))
+	pa := krbSequence(krbExplicit(1, krbInt(krbPAEncTimestamp)), krbExplicit(2, krbTLV(asn1.ClassUniversal, asn1.TagOctetString, false, enc)))
+	_, msg, err = KerberosResponse(krbASRequest(pa))
+	require.NoError(t, err)
+	require.Equal(t, "KDC_ERR_PREAUTH_FAILED", msg.Error)
+	require.Equal(t, []int{krbPAEncTimestamp}, msg.PreAuth)
+	require.Equal(t, "$krb5pa$23$svc_sql$CORP.LOCAL$$ab", msg.Hash[:33])
+
+	_, _, err = KerberosResponse([]byte{0x30, 0x00})
+	require.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"net"
+	"sync"
+)
+
+// maxRecorded bounds the bytes a Recorder keeps of each direction
+const maxRecorded = 1 << 16
+
+// Recorder is a connection keeping the first bytes read from and written
+// to it until it is stopped, the handshakes fingerprints are taken of
+type Recorder struct {
+	net.Conn
+	mu      sync.Mutex
+	in, out []byte
+	stopped bool
+}
+
+func NewRecorder(conn net.Conn) *Recorder {
+	return &Recorder{Conn: conn}
+}
+
+func (r *Recorder) record(buf *[]byte, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopped && len(*buf) < maxRecorded {
+		*buf = append(*buf, p[:min(len(p), maxRecorded-len(*buf))]...)
+	}
+}
+
+func (r *Recorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	r.record(&r.in, p[:n])
+	return n, err
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	n, err := r.Conn.Write(p)
+	r.record(&r.out, p[:n])
+	return n, err
+}
+
+// Stop ends the recording and returns the bytes read and written so far
+func (r *Recorder) Stop() ([]byte, []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	return r.in, r.out
+}
@@ -0,0 +1,154 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const s3Timeout = 10 * time.Second
+
+// Kinds of objects uploaded, each under its own prefix so lifecycle rules
+// can expire them separately
+const (
+	ObjectPayload    = "payloads"
+	ObjectTranscript = "transcripts"
+)
+
+var s3Client = &http.Client{Timeout: s3Timeout}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes an object path the way Signature Version 4 expects,
+// everything but the unreserved characters and slashes is encoded
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// signS3 signs a request with AWS Signature Version 4, covering the host
+// and every header already set on the request
+func signS3(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// s3ObjectURL returns the URL of an object in storage.s3.bucket, in path
+// style for MinIO and other endpoints without bucket subdomains
+func s3ObjectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(viper.GetString("storage.s3.endpoint"))
+	if err != nil {
+		return nil, err
+	}
+	bucket := viper.GetString("storage.s3.bucket")
+	if viper.GetBool("storage.s3.path_style") {
+		endpoint.Path = "/" + bucket + "/" + key
+	} else {
+		endpoint.Host = bucket + "." + endpoint.Host
+		endpoint.Path = "/" + key
+	}
+	return endpoint, nil
+}
+
+// UploadObject stores data in S3 under its sha256 digest, keyed
+// <prefix>/<kind>/<first two hex digits>/<digest>. Objects are encrypted
+// at rest with storage.s3.sse.
+func UploadObject(kind, hash string, data []byte) error {
+	key := path.Join(viper.GetString("storage.s3.prefix"), kind, hash[:2], hash)
+	objectURL, err := s3ObjectURL(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	switch sse := viper.GetString("storage.s3.sse"); sse {
+	case "":
+	case "aws:kms":
+		req.Header.Set("X-Amz-Server-Side-Encryption", sse)
+		if keyID := viper.GetString("storage.s3.kms_key_id"); keyID != "" {
+			req.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", keyID)
+		}
+	default:
+		req.Header.Set("X-Amz-Server-Side-Encryption", sse)
+	}
+	sum := sha256.Sum256(data)
+	signS3(req, hex.EncodeToString(sum[:]),
+		viper.GetString("storage.s3.access_key"),
+		viper.GetString("storage.s3.secret_key"),
+		viper.GetString("storage.s3.region"),
+		time.Now(),
+	)
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("S3 upload of %s failed: %s", key, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package helpers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	slpSrvRqst     = 1
+	slpSrvRply     = 2
+	slpAttrRqst    = 6
+	slpAttrRply    = 7
+	slpDAAdvert    = 8
+	slpSrvTypeRqst = 9
+	slpSrvTypeRply = 10
+
+	slpHeaderLength = 14
+)
+
+var slpFunctions = map[byte]string{
+	1:  "srv_rqst",
+	2:  "srv_rply",
+	3:  "srv_reg",
+	4:  "srv_dereg",
+	5:  "srv_ack",
+	6:  "attr_rqst",
+	7:  "attr_rply",
+	8:  "da_advert",
+	9:  "srv_type_rqst",
+	10: "srv_type_rply",
+	11: "sa_advert",
+}
+
+// slpAttributes is what the SLP daemon of ESXi 7.0 U2 registers for its
+// management interface
+const slpAttributes = `(product="VMware ESXi 7.0.2 build-17630552"),(vendor=VMware, Inc.),(version=7.0.2)`
+
+// SLPMessage is the decoded form of an SLPv2 message
+type SLPMessage struct {
+	Function    string `json:"function"`
+	XID         uint16 `json:"xid"`
+	Language    string `json:"language,omitempty"`
+	ServiceType string `json:"service_type,omitempty"`
+	Scopes      string `json:"scopes,omitempty"`
+	Predicate   string `json:"predicate,omitempty"`
+	// URL is the service URL of attribute requests and directory agent
+	// adverts, the latter being how OpenSLP exploits for ESXi
+	// (CVE-2021-21974) deliver their overflow
+	URL         string `json:"url,omitempty"`
+	PayloadHash string `json:"payload_hash,omitempty"`
+}
+
+// SLPLength returns the message length of an SLPv2 header, TCP streams are
+// framed by it
+func SLPLength(header []byte) int {
+	if len(header) < 5 {
+		return 0
+	}
+	return int(header[2])<<16 | int(header[3])<<8 | int(header[4])
+}
+
+func slpString(data []byte, offset int) (string, int, error) {
+	if len(data) < offset+2 {
+		return "", 0, errors.New("SLP message too short")
+	}
+	size := int(binary.BigEndian.Uint16(data[offset:]))
+	if len(data) < offset+2+size {
+		return "", 0, errors.New("SLP string out of range")
+	}
+	return string(data[offset+2 : offset+2+size]), offset + 2 + size, nil
+}
+
+func appendSLPString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// slpReply prepends the header of the request to the body of a reply
+func slpReply(function byte, xid uint16, language string, body []byte) []byte {
+	length := slpHeaderLength + len(language) + len(body)
+	buf := []byte{2, function, byte(length >> 16), byte(length >> 8), byte(length), 0, 0, 0, 0, 0}
+	buf = binary.BigEndian.AppendUint16(buf, xid)
+	buf = appendSLPString(buf, language)
+	return append(buf, body...)
+}
+
+// slpServiceURL names the ESXi service matching the requested type on host
+func slpServiceURL(serviceType, host string) string {
+	if strings.Contains(strings.ToLower(serviceType), "wbem") {
+		return fmt.Sprintf("service:wbem:https://%s:5989", host)
+	}
+	return fmt.Sprintf("service:VMwareInfrastructure://%s", host)
+}
+
+// SLPResponse parses an SLPv2 request and answers it like the service agent
+// of an ESXi host reachable at host. Service, type and attribute requests
+// are answered, other messages only get recorded.
+func SLPResponse(data []byte, host string) ([]byte, SLPMessage, error) {
+	msg := SLPMessage{}
+	if len(data) < slpHeaderLength || data[0] != 2 {
+		return nil, msg, errors.New("not an SLPv2 message")
+	}
+	function, ok := slpFunctions[data[1]]
+	if !ok {
+		return nil, msg, fmt.Errorf("unknown SLP function %d", data[1])
+	}
+	msg.Function = function
+	msg.XID = binary.BigEndian.Uint16(data[10:])
+	language, offset, err := slpString(data, 12)
+	if err != nil {
+		return nil, msg, err
+	}
+	msg.Language = language
+
+	body := []byte{0, 0}
+	switch data[1] {
+	case slpSrvRqst:
+		// previous responders, service type, scopes and predicate
+		fields := make([]string, 4)
+		for i := range fields {
+			if fields[i], offset, err = slpString(data, offset); err != nil {
+				return nil, msg, err
+			}
+		}
+		msg.ServiceType, msg.Scopes, msg.Predicate = fields[1], fields[2], fields[3]
+		url := slpServiceURL(msg.ServiceType, host)
+		body = binary.BigEndian.AppendUint16(body, 1)
+		body = append(body, 0)
+		body = binary.BigEndian.AppendUint16(body, 10800)
+		body = appendSLPString(body, url)
+		body = append(body, 0)
+		return slpReply(slpSrvRply, msg.XID, language, body), msg, nil
+	case slpSrvTypeRqst:
+		body = appendSLPString(body, "service:VMwareInfrastructure,service:wbem")
+		return slpReply(slpSrvTypeRply, msg.XID, language, body), msg, nil
+	case slpAttrRqst:
+		if _, offset, err = slpString(data, offset); err != nil {
+			return nil, msg, err
+		}
+		if msg.URL, offset, err = slpString(data, offset); err != nil {
+			return nil, msg, err
+		}
+		if msg.Scopes, _, err = slpString(data, offset); err != nil {
+			return nil, msg, err
+		}
+		body = appendSLPString(body, slpAttributes)
+		body = append(body, 0)
+		return slpReply(slpAttrRply, msg.XID, language, body), msg, nil
+	case slpDAAdvert:
+		// error code and boot timestamp precede the URL
+		if msg.URL, offset, err = slpString(data, offset+6); err != nil {
+			return nil, msg, err
+		}
+		msg.Scopes, _, _ = slpString(data, offset)
+		if msg.PayloadHash, err = StorePayload(data); err != nil {
+			return nil, msg, err
+		}
+	}
+	return nil, msg, nil
+}
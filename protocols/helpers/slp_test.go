@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func slpRequest(function byte, fields ...string) []byte {
+	body := []byte{}
+	for _, field := range fields {
+		body = appendSLPString(body, field)
+	}
+	if function == slpSrvRqst {
+		// empty SPI string
+		body = appendSLPString(body, "")
+	}
+	return slpReply(function, 0x1234, "en", body)
+}
+
+func TestSLPResponse(t *testing.T) {
+	req := slpRequest(slpSrvRqst, "", "service:VMwareInfrastructure", "DEFAULT", "")
+	require.Equal(t, len(req), SLPLength(req))
+	resp, msg, err := SLPResponse(req, "192.0.2.1")
+	require.NoError(t, err)
+	require.Equal(t, SLPMessage{
+		Function:    "srv_rqst",
+		XID:         0x1234,
+		Language:    "en",
+		ServiceType: "service:VMwareInfrastructure",
+		Scopes:      "DEFAULT",
+	}, msg)
+	require.Equal(t, byte(slpSrvRply), resp[1])
+	require.Equal(t, len(resp), SLPLength(resp))
+	url, _, err := slpString(resp, 16+7)
+	require.NoError(t, err)
+	require.Equal(t, "service:VMwareInfrastructure://192.0.2.1", url)
+
+	resp, msg, err = SLPResponse(slpRequest(slpAttrRqst, "", "service:wbem:https://192.0.2.1:5989", "DEFAULT", "", ""), "192.0.2.1")
+	require.NoError(t, err)
+	require.Equal(t, "service:wbem:https://192.0.2.1:5989", msg.URL)
+	attrs, _, err := slpString(resp, 18)
+	require.NoError(t, err)
+	require.Equal(t, slpAttributes, attrs)
+
+	_, _, err = SLPResponse([]byte{1, 1, 0, 0, 14}, "192.0.2.1")
+	require.Error(t, err)
+}
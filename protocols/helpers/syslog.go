@@ -0,0 +1,114 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyslogMessage is the decoded form of an RFC 3164 or RFC 5424 message
+type SyslogMessage struct {
+	Format         string `json:"format"`
+	Facility       int    `json:"facility"`
+	Severity       int    `json:"severity"`
+	Timestamp      string `json:"timestamp,omitempty"`
+	Hostname       string `json:"hostname,omitempty"`
+	AppName        string `json:"app_name,omitempty"`
+	ProcID         string `json:"proc_id,omitempty"`
+	MsgID          string `json:"msg_id,omitempty"`
+	StructuredData string `json:"structured_data,omitempty"`
+	Message        string `json:"message,omitempty"`
+}
+
+// syslogField reads a space terminated RFC 5424 header field, the nil
+// value "-" comes back empty
+func syslogField(s string) (string, string) {
+	field, rest, _ := strings.Cut(s, " ")
+	if field == "-" {
+		field = ""
+	}
+	return field, rest
+}
+
+// syslogStructuredData splits the structured data elements off s, brackets
+// and quotes may be escaped inside parameter values
+func syslogStructuredData(s string) (string, string, error) {
+	if strings.HasPrefix(s, "-") {
+		return "", strings.TrimPrefix(s[1:], " "), nil
+	}
+	quoted, escaped, i := false, false, 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ']' && !quoted && (i+1 == len(s) || s[i+1] != '['):
+			return s[:i+1], strings.TrimPrefix(s[i+1:], " "), nil
+		}
+	}
+	return "", "", errors.New("unterminated syslog structured data")
+}
+
+// ParseSyslog decodes a syslog message. Messages whose header does not
+// follow RFC 3164 are kept whole as the message, as relays do.
+func ParseSyslog(data []byte) (SyslogMessage, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+	end := bytes.IndexByte(data, '>')
+	if len(data) < 3 || data[0] != '<' || end < 2 || end > 4 {
+		return SyslogMessage{}, errors.New("missing syslog priority")
+	}
+	priority, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || priority > 191 {
+		return SyslogMessage{}, errors.New("invalid syslog priority")
+	}
+	msg := SyslogMessage{Facility: priority / 8, Severity: priority % 8}
+	rest := string(data[end+1:])
+
+	if strings.HasPrefix(rest, "1 ") {
+		msg.Format = "rfc5424"
+		rest = rest[2:]
+		msg.Timestamp, rest = syslogField(rest)
+		msg.Hostname, rest = syslogField(rest)
+		msg.AppName, rest = syslogField(rest)
+		msg.ProcID, rest = syslogField(rest)
+		msg.MsgID, rest = syslogField(rest)
+		if msg.StructuredData, rest, err = syslogStructuredData(rest); err != nil {
+			return msg, err
+		}
+		msg.Message = strings.TrimPrefix(rest, "\ufeff")
+		return msg, nil
+	}
+
+	msg.Format = "rfc3164"
+	if len(rest) < 16 || rest[15] != ' ' {
+		msg.Message = rest
+		return msg, nil
+	}
+	if _, err := time.Parse(time.Stamp, rest[:15]); err != nil {
+		msg.Message = rest
+		return msg, nil
+	}
+	msg.Timestamp = rest[:15]
+	msg.Hostname, rest, _ = strings.Cut(rest[16:], " ")
+	// the tag ends at the first character not allowed in it, usually the
+	// colon or the bracket of the process id
+	tag := strings.IndexAny(rest, ":[ ")
+	if tag <= 0 || tag > 32 {
+		msg.Message = rest
+		return msg, nil
+	}
+	msg.AppName, rest = rest[:tag], rest[tag:]
+	if strings.HasPrefix(rest, "[") {
+		if pid, after, ok := strings.Cut(rest[1:], "]"); ok {
+			msg.ProcID, rest = pid, after
+		}
+	}
+	msg.Message = strings.TrimPrefix(strings.TrimPrefix(rest, ":"), " ")
+	return msg, nil
+}
@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyslog(t *testing.T) {
+	msg, err := ParseSyslog([]byte("<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8\n"))
+	require.NoError(t, err)
+	require.Equal(t, SyslogMessage{
+		Format: "rfc3164", Facility: 4, Severity: 2,
+		Timestamp: "Oct 11 22:14:15", Hostname: "mymachine", AppName: "su", ProcID: "230",
+		Message: "'su root' failed for lonvick on /dev/pts/8",
+	}, msg)
+
+	msg, err = ParseSyslog([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App\]lication"][examplePriority@32473 class="high"] ` + "\ufeffAn application event"))
+	require.NoError(t, err)
+	require.Equal(t, SyslogMessage{
+		Format: "rfc5424", Facility: 20, Severity: 5,
+		Timestamp: "2003-10-11T22:14:15.003Z", Hostname: "mymachine.example.com", AppName: "evntslog", MsgID: "ID47",
+		StructuredData: `[exampleSDID@32473 iut="3" eventSource="App\]lication"][examplePriority@32473 class="high"]`,
+		Message:        "An application event",
+	}, msg)
+
+	msg, err = ParseSyslog([]byte("<13>exfil: c2VjcmV0"))
+	require.NoError(t, err)
+	require.Equal(t, "exfil: c2VjcmV0", msg.Message)
+
+	_, err = ParseSyslog([]byte("<999>x"))
+	require.Error(t, err)
+	_, err = ParseSyslog([]byte("GET / HTTP/1.1"))
+	require.Error(t, err)
+}
@@ -2,6 +2,8 @@ package protocols
 
 import (
 	"bufio"
+	"bytes"
+	"io"
 	"net"
 	"time"
 )
@@ -20,6 +22,12 @@ func (b BufferedConn) peek(n int) ([]byte, error) {
 	return b.r.Peek(n)
 }
 
+// buffered returns the data already read from the connection without consuming it
+func (b BufferedConn) buffered() []byte {
+	data, _ := b.r.Peek(b.r.Buffered())
+	return data
+}
+
 func (b BufferedConn) Read(p []byte) (int, error) {
 	return b.r.Read(p)
 }
@@ -33,3 +41,29 @@ func Peek(conn net.Conn, length int) ([]byte, BufferedConn, error) {
 	snip, err := bufConn.peek(length)
 	return snip, bufConn, err
 }
+
+// prefixConn yields data already read from the connection before reading on
+type prefixConn struct {
+	r io.Reader
+	net.Conn
+}
+
+func (c prefixConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// peekPayload returns what the client sends within timeout, if anything, and
+// a connection yielding it again. The read deadline is left to the caller to
+// reset.
+func peekPayload(conn net.Conn, timeout time.Duration) ([]byte, net.Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, conn, err
+	}
+	buf := make([]byte, 4096)
+	// a read error is seen again by the handler
+	n, _ := conn.Read(buf)
+	if n == 0 {
+		return nil, conn, nil
+	}
+	return buf[:n], prefixConn{io.MultiReader(bytes.NewReader(buf[:n]), conn), conn}, nil
+}
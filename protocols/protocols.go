@@ -5,24 +5,120 @@ import (
 	"context"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/mushorg/glutton/connection"
 	"github.com/mushorg/glutton/producer"
 	"github.com/mushorg/glutton/protocols/interfaces"
 	"github.com/mushorg/glutton/protocols/tcp"
 	"github.com/mushorg/glutton/protocols/udp"
+
+	"github.com/spf13/viper"
 )
 
 type TCPHandlerFunc func(ctx context.Context, conn net.Conn, md connection.Metadata) error
 
 type UDPHandlerFunc func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error
 
+func newReplayCacheFromConfig() *replayCache {
+	return newReplayCache(viper.GetInt("replay.size"), time.Duration(viper.GetInt("replay.ttl"))*time.Second)
+}
+
 // MapUDPProtocolHandlers map protocol handlers to corresponding protocol
 func MapUDPProtocolHandlers(log interfaces.Logger, h interfaces.Honeypot) map[string]UDPHandlerFunc {
 	protocolHandlers := map[string]UDPHandlerFunc{}
 	protocolHandlers["udp"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
 		return udp.HandleUDP(ctx, srcAddr, dstAddr, data, md, log, h)
 	}
+	protocolHandlers["wdb"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleWDB(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["dns"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleDNS(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["snmp"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleSNMP(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["ntp"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleNTP(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["tftp"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleTFTP(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["ssdp"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleSSDP(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["bacnet"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleBACnet(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["coap"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleCoAP(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["mdns"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleMDNS(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["llmnr"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleLLMNR(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["nbns"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleNBNS(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["nbdgm"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleNBDatagram(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["radius"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleRADIUS(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["ipmi"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleIPMI(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["wsd"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleWSD(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["echo"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleEcho(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["discard"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleDiscard(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["daytime"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleDaytime(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["chargen"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleChargen(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["kerberos"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleKerberos(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["slp"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleSLP(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["a2s"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleA2S(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["quic"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		// DTLS VPNs share the port with QUIC
+		if udp.IsDTLS(data) {
+			return udp.HandleDTLS(ctx, srcAddr, dstAddr, data, md, log, h)
+		}
+		return udp.HandleQUIC(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["dtls"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleDTLS(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["wireguard"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleWireGuard(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+	protocolHandlers["syslog"] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+		return udp.HandleSyslog(ctx, srcAddr, dstAddr, data, md, log, h)
+	}
+
+	replays := newReplayCacheFromConfig()
+	for name, handler := range protocolHandlers {
+		protocolHandlers[name] = func(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata) error {
+			return handler(ctx, srcAddr, dstAddr, data, markReplay(replays, md, data, log))
+		}
+	}
 	return protocolHandlers
 }
 
@@ -65,7 +161,145 @@ func MapTCPProtocolHandlers(log interfaces.Logger, h interfaces.Honeypot) map[st
 	protocolHandlers["adb"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
 		return tcp.HandleADB(ctx, conn, md, log, h)
 	}
-	protocolHandlers["tcp"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+	protocolHandlers["mssql"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleMSSQL(ctx, conn, md, log, h)
+	}
+	protocolHandlers["bitcoin"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleBitcoin(ctx, conn, md, log, h)
+	}
+	protocolHandlers["devp2p"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleDevP2P(ctx, conn, md, log, h)
+	}
+	protocolHandlers["pjl"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleRaw9100(ctx, conn, md, log, h)
+	}
+	protocolHandlers["ssh"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleSSH(ctx, conn, md, log, h)
+	}
+	protocolHandlers["modbus"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleModbus(ctx, conn, md, log, h)
+	}
+	protocolHandlers["s7comm"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleS7Comm(ctx, conn, md, log, h)
+	}
+	protocolHandlers["dnp3"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleDNP3(ctx, conn, md, log, h)
+	}
+	protocolHandlers["mysql"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleMySQL(ctx, conn, md, log, h)
+	}
+	protocolHandlers["postgres"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandlePostgres(ctx, conn, md, log, h)
+	}
+	protocolHandlers["redis"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleRedis(ctx, conn, md, log, h)
+	}
+	protocolHandlers["mongodb"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleMongoDB(ctx, conn, md, log, h)
+	}
+	protocolHandlers["ldap"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleLDAP(ctx, conn, md, log, h)
+	}
+	protocolHandlers["imap"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleIMAP(ctx, conn, md, log, h)
+	}
+	protocolHandlers["pop3"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandlePOP3(ctx, conn, md, log, h)
+	}
+	protocolHandlers["irc"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleIRC(ctx, conn, md, log, h)
+	}
+	protocolHandlers["amqp"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleAMQP(ctx, conn, md, log, h)
+	}
+	protocolHandlers["socks"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleSOCKS(ctx, conn, md, log, h)
+	}
+	protocolHandlers["rtsp"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleRTSP(ctx, conn, md, log, h)
+	}
+	protocolHandlers["echo"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleEcho(ctx, conn, md, log, h)
+	}
+	protocolHandlers["discard"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleDiscard(ctx, conn, md, log, h)
+	}
+	protocolHandlers["daytime"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleDaytime(ctx, conn, md, log, h)
+	}
+	protocolHandlers["chargen"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleChargen(ctx, conn, md, log, h)
+	}
+	protocolHandlers["finger"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleFinger(ctx, conn, md, log, h)
+	}
+	protocolHandlers["ident"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleIdent(ctx, conn, md, log, h)
+	}
+	protocolHandlers["kerberos"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleKerberos(ctx, conn, md, log, h)
+	}
+	protocolHandlers["slp"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleSLP(ctx, conn, md, log, h)
+	}
+	protocolHandlers["epmd"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleEPMD(ctx, conn, md, log, h)
+	}
+	protocolHandlers["erlang"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleErlangDist(ctx, conn, md, log, h)
+	}
+	protocolHandlers["zookeeper"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleZookeeper(ctx, conn, md, log, h)
+	}
+	protocolHandlers["cassandra"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleCassandra(ctx, conn, md, log, h)
+	}
+	protocolHandlers["minecraft"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleMinecraft(ctx, conn, md, log, h)
+	}
+	protocolHandlers["git"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleGit(ctx, conn, md, log, h)
+	}
+	protocolHandlers["rsync"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleRsync(ctx, conn, md, log, h)
+	}
+	protocolHandlers["x11"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleX11(ctx, conn, md, log, h)
+	}
+	protocolHandlers["tns"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleTNS(ctx, conn, md, log, h)
+	}
+	protocolHandlers["smpp"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleSMPP(ctx, conn, md, log, h)
+	}
+	protocolHandlers["syslog"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleSyslog(ctx, conn, md, log, h)
+	}
+	protocolHandlers["nats"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleNATS(ctx, conn, md, log, h)
+	}
+	protocolHandlers["dns"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleDNS(ctx, conn, md, log, h)
+	}
+	// each handler records its transcript once, the "tcp" dispatcher leaves
+	// it to the handler it picks so TLS is recorded decrypted
+	recorded := make(map[string]TCPHandlerFunc, len(protocolHandlers)+1)
+	for name, handler := range protocolHandlers {
+		recorded[name] = recordTranscript(name, handler, log)
+	}
+	handleHTTP := recordTranscript("http", func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleHTTP(ctx, conn, md, log, h)
+	}, log)
+	handleTCP := recordTranscript("tcp", func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return tcp.HandleTCP(ctx, conn, md, log, h)
+	}, log)
+
+	certs := newCertCache()
+	// implicitTLS maps ports of protocols wrapped in TLS to the handler taking
+	// over the decrypted stream
+	implicitTLS := map[uint16]string{993: "imap", 995: "pop3", 6697: "irc"}
+	var dispatchTCP func(ctx context.Context, conn net.Conn, md connection.Metadata, decrypted bool) error
+	dispatchTCP = func(ctx context.Context, conn net.Conn, md connection.Metadata, decrypted bool) error {
 		snip, bufConn, err := Peek(conn, 4)
 		if err != nil {
 			if err := conn.Close(); err != nil {
@@ -74,17 +308,40 @@ func MapTCPProtocolHandlers(log interfaces.Logger, h interfaces.Honeypot) map[st
 			log.Debug("failed to peek connection", producer.ErrAttr(err))
 			return nil
 		}
+		// terminate TLS and run the detection again on the decrypted stream
+		if !decrypted && isClientHello(snip) {
+			tlsConn, md, ok := terminateTLS(ctx, bufConn, md, certs, log, h)
+			if !ok {
+				return nil
+			}
+			md.Tags = append(md.Tags, "tls")
+			if handler, ok := recorded[implicitTLS[md.TargetPort]]; ok {
+				return handler(ctx, tlsConn, md)
+			}
+			return dispatchTCP(ctx, tlsConn, md, true)
+		}
 		// poor mans check for HTTP request
-		httpMap := map[string]bool{"GET ": true, "POST": true, "HEAD": true, "OPTI": true, "CONN": true}
+		httpMap := map[string]bool{"GET ": true, "POST": true, "HEAD": true, "OPTI": true, "CONN": true, "SUBS": true, "UNSU": true, "PUT ": true, "DELE": true}
 		if _, ok := httpMap[strings.ToUpper(string(snip))]; ok {
-			return tcp.HandleHTTP(ctx, bufConn, md, log, h)
+			return handleHTTP(ctx, bufConn, md)
 		}
 		// poor mans check for RDP header
 		if bytes.Equal(snip, []byte{0x03, 0x00, 0x00, 0x2b}) {
-			return tcp.HandleRDP(ctx, bufConn, md, log, h)
+			return recorded["rdp"](ctx, bufConn, md)
 		}
 		// fallback TCP handler
-		return tcp.HandleTCP(ctx, bufConn, md, log, h)
+		return handleTCP(ctx, bufConn, md)
 	}
-	return protocolHandlers
+	recorded["tcp"] = func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		return dispatchTCP(ctx, conn, md, false)
+	}
+
+	// the replay detection sees each connection once, not again after TLS
+	// termination
+	replays := newReplayCacheFromConfig()
+	handlers := make(map[string]TCPHandlerFunc, len(recorded))
+	for name, handler := range recorded {
+		handlers[name] = detectReplay(handler, replays, log, h)
+	}
+	return handlers
 }
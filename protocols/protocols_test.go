@@ -8,6 +8,7 @@ import (
 
 	"github.com/mushorg/glutton/connection"
 	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -24,6 +25,9 @@ func testConn(t *testing.T) (net.Conn, func() error) {
 }
 
 func TestMapUDPProtocolHandlers(t *testing.T) {
+	viper.Set("storage.payloads.dir", t.TempDir())
+	defer viper.Set("storage.payloads.dir", "")
+
 	h := &mocks.MockHoneypot{}
 	h.EXPECT().ProduceUDP(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
 
@@ -42,6 +46,7 @@ func TestMapUDPProtocolHandlers(t *testing.T) {
 
 func TestMapTCPProtocolHandlers(t *testing.T) {
 	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil).Maybe()
 	l := &mocks.MockLogger{}
 	l.EXPECT().Debug(mock.Anything, mock.Anything).Return().Maybe()
 
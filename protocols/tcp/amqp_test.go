@@ -0,0 +1,58 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAMQPConnectionStart(t *testing.T) {
+	kind, channel, payload, err := readAMQPFrame(bufio.NewReader(bytes.NewReader(amqpConnectionStart())))
+	require.NoError(t, err)
+	require.Equal(t, byte(amqpMethodFrame), kind)
+	require.Zero(t, channel)
+
+	r := &amqpReader{data: payload}
+	require.Equal(t, uint16(10), r.uint16())
+	require.Equal(t, uint16(10), r.uint16())
+	r.take(2)
+	properties := r.table(0)
+	require.NoError(t, r.err)
+	require.Equal(t, "RabbitMQ", properties["product"])
+	require.Equal(t, uint8(1), properties["capabilities"].(map[string]any)["basic.nack"])
+	require.Equal(t, "PLAIN AMQPLAIN", r.longString())
+}
+
+func TestParseAMQPMethod(t *testing.T) {
+	w := &amqpWriter{}
+	w.uint16(10)
+	w.uint16(11)
+	w.table([][2]any{{"product", "pika"}})
+	w.shortString("PLAIN")
+	w.longString("\x00guest\x00guest")
+	w.shortString("en_US")
+	op, resp, err := parseAMQPMethod(0, w.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, &amqpOperation{Method: "connection.start-ok", Mechanism: "PLAIN", Username: "guest", Password: "guest", Product: "pika"}, op)
+	require.Equal(t, []byte{amqpMethodFrame, 0, 0, 0, 0, 0, 12, 0, 10, 0, 30, 0x07, 0xff, 0, 2, 0, 0, 0, 60, amqpFrameEnd}, resp)
+
+	w = &amqpWriter{}
+	w.uint16(50)
+	w.uint16(10)
+	w.uint16(0)
+	w.shortString("backup")
+	w.WriteByte(0)
+	w.table(nil)
+	op, resp, err = parseAMQPMethod(1, w.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, "queue.declare", op.Method)
+	require.Equal(t, "backup", op.Queue)
+	require.Equal(t, uint16(1), op.Channel)
+	require.Equal(t, amqpMethod(1, 50, 11, func(w *amqpWriter) {
+		w.shortString("backup")
+		w.uint32(0)
+		w.uint32(0)
+	}), resp)
+}
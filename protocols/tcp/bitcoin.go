@@ -0,0 +1,317 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	bitcoinHeaderLen = 24
+	// largest payload we accept, real nodes allow 4MB blocks but peers we
+	// talk to never get that far
+	bitcoinMaxPayload = 1 << 16
+	bitcoinVersion    = 70016
+	bitcoinUserAgent  = "/Satoshi:25.0.0/"
+	// NODE_NETWORK | NODE_WITNESS | NODE_NETWORK_LIMITED
+	bitcoinServices = 1 | 8 | 1024
+	// genesis block timestamp, used to estimate a plausible chain height
+	bitcoinGenesis = 1231006505
+)
+
+var errBitcoinChecksum = errors.New("invalid Bitcoin message checksum")
+
+type bitcoinHeader struct {
+	Magic    uint32
+	Command  [12]byte
+	Length   uint32
+	Checksum [4]byte
+}
+
+type bitcoinAddr struct {
+	Services uint64 `json:"services"`
+	IP       net.IP `json:"ip"`
+	Port     uint16 `json:"port"`
+}
+
+type bitcoinVersionMsg struct {
+	Version     int32       `json:"version"`
+	Services    uint64      `json:"services"`
+	Timestamp   int64       `json:"timestamp"`
+	AddrRecv    bitcoinAddr `json:"addr_recv"`
+	AddrFrom    bitcoinAddr `json:"addr_from"`
+	Nonce       uint64      `json:"nonce"`
+	UserAgent   string      `json:"user_agent"`
+	StartHeight int32       `json:"start_height"`
+	Relay       bool        `json:"relay"`
+}
+
+type parsedBitcoin struct {
+	Direction string             `json:"direction,omitempty"`
+	Command   string             `json:"command,omitempty"`
+	Version   *bitcoinVersionMsg `json:"version,omitempty"`
+	Payload   []byte             `json:"payload,omitempty"`
+}
+
+type bitcoinServer struct {
+	events []parsedBitcoin
+	conn   net.Conn
+	magic  uint32
+}
+
+// bitcoinChecksum is the first four bytes of the double SHA256 of the payload
+func bitcoinChecksum(payload []byte) [4]byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return [4]byte(second[:4])
+}
+
+func bitcoinCommand(name string) [12]byte {
+	cmd := [12]byte{}
+	copy(cmd[:], name)
+	return cmd
+}
+
+// readMessage reads a single framed message and verifies its checksum
+func (s *bitcoinServer) readMessage() (string, []byte, error) {
+	header := bitcoinHeader{}
+	if err := binary.Read(s.conn, binary.LittleEndian, &header); err != nil {
+		return "", nil, err
+	}
+	if header.Length > bitcoinMaxPayload {
+		return "", nil, errors.New("Bitcoin message too large")
+	}
+	payload := make([]byte, header.Length)
+	if _, err := io.ReadFull(s.conn, payload); err != nil {
+		return "", nil, err
+	}
+	// reply on whatever network the peer is on
+	s.magic = header.Magic
+	command := string(bytes.TrimRight(header.Command[:], "\x00"))
+	if bitcoinChecksum(payload) != header.Checksum {
+		return command, payload, errBitcoinChecksum
+	}
+	return command, payload, nil
+}
+
+func (s *bitcoinServer) write(command string, payload []byte) error {
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, bitcoinHeader{
+		Magic:    s.magic,
+		Command:  bitcoinCommand(command),
+		Length:   uint32(len(payload)),
+		Checksum: bitcoinChecksum(payload),
+	}); err != nil {
+		return err
+	}
+	buf.Write(payload)
+	s.events = append(s.events, parsedBitcoin{
+		Direction: "write",
+		Command:   command,
+		Payload:   buf.Bytes(),
+	})
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+func readVarInt(r *bytes.Reader) (uint64, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch prefix {
+	case 0xfd:
+		var v uint16
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return uint64(v), err
+	case 0xfe:
+		var v uint32
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return uint64(v), err
+	case 0xff:
+		var v uint64
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return v, err
+	}
+	return uint64(prefix), nil
+}
+
+func writeVarString(buf *bytes.Buffer, s string) {
+	// user agents are short, a single byte length is enough
+	buf.WriteByte(uint8(len(s)))
+	buf.WriteString(s)
+}
+
+func readBitcoinAddr(r *bytes.Reader) (bitcoinAddr, error) {
+	addr := bitcoinAddr{IP: make(net.IP, 16)}
+	if err := binary.Read(r, binary.LittleEndian, &addr.Services); err != nil {
+		return addr, err
+	}
+	if _, err := io.ReadFull(r, addr.IP); err != nil {
+		return addr, err
+	}
+	err := binary.Read(r, binary.BigEndian, &addr.Port)
+	return addr, err
+}
+
+func writeBitcoinAddr(buf *bytes.Buffer, addr bitcoinAddr) {
+	binary.Write(buf, binary.LittleEndian, addr.Services)
+	buf.Write(addr.IP.To16())
+	binary.Write(buf, binary.BigEndian, addr.Port)
+}
+
+// parseBitcoinVersion decodes the payload of a version message
+func parseBitcoinVersion(payload []byte) (*bitcoinVersionMsg, error) {
+	r := bytes.NewReader(payload)
+	msg := &bitcoinVersionMsg{}
+	for _, field := range []any{&msg.Version, &msg.Services, &msg.Timestamp} {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if msg.AddrRecv, err = readBitcoinAddr(r); err != nil {
+		return nil, err
+	}
+	if msg.AddrFrom, err = readBitcoinAddr(r); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &msg.Nonce); err != nil {
+		return nil, err
+	}
+	length, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(r.Len()) {
+		return nil, errors.New("invalid Bitcoin user agent length")
+	}
+	agent := make([]byte, length)
+	if _, err := io.ReadFull(r, agent); err != nil {
+		return nil, err
+	}
+	msg.UserAgent = string(agent)
+	if err := binary.Read(r, binary.LittleEndian, &msg.StartHeight); err != nil {
+		return nil, err
+	}
+	// relay is optional for protocol versions before 70001
+	if relay, err := r.ReadByte(); err == nil {
+		msg.Relay = relay != 0
+	}
+	return msg, nil
+}
+
+// bitcoinVersionPayload creates our version message addressed to the peer
+func bitcoinVersionPayload(peer *bitcoinVersionMsg, remote net.Addr) []byte {
+	recv := bitcoinAddr{IP: net.IPv6zero}
+	if addr, ok := remote.(*net.TCPAddr); ok {
+		recv = bitcoinAddr{Services: peer.Services, IP: addr.IP, Port: uint16(addr.Port)}
+	}
+	now := time.Now().Unix()
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, int32(bitcoinVersion))
+	binary.Write(buf, binary.LittleEndian, uint64(bitcoinServices))
+	binary.Write(buf, binary.LittleEndian, now)
+	writeBitcoinAddr(buf, recv)
+	writeBitcoinAddr(buf, bitcoinAddr{Services: bitcoinServices, IP: net.IPv6zero})
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	buf.Write(nonce)
+	writeVarString(buf, bitcoinUserAgent)
+	// one block every ten minutes since genesis, blocks have come slightly
+	// faster in practice
+	binary.Write(buf, binary.LittleEndian, int32((now-bitcoinGenesis)/600*103/100))
+	buf.WriteByte(1) // relay
+	return buf.Bytes()
+}
+
+// HandleBitcoin handles the Bitcoin P2P version handshake
+func HandleBitcoin(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	server := &bitcoinServer{
+		events: []parsedBitcoin{},
+		conn:   conn,
+	}
+	defer func() {
+		if err := h.ProduceTCP("bitcoin", conn, md, helpers.FirstOrEmpty[parsedBitcoin](server.events).Payload, server.events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "bitcoin"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close Bitcoin connection", slog.String("protocol", "bitcoin"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "bitcoin"), producer.ErrAttr(err))
+			return nil
+		}
+		command, payload, err := server.readMessage()
+		if err != nil {
+			if command != "" {
+				server.events = append(server.events, parsedBitcoin{Direction: "read", Command: command, Payload: payload})
+			}
+			logger.Debug("Failed to read Bitcoin message", slog.String("protocol", "bitcoin"), producer.ErrAttr(err))
+			return nil
+		}
+		event := parsedBitcoin{
+			Direction: "read",
+			Command:   command,
+			Payload:   payload,
+		}
+
+		switch command {
+		case "version":
+			version, err := parseBitcoinVersion(payload)
+			if err != nil {
+				server.events = append(server.events, event)
+				logger.Debug("Failed to parse Bitcoin version", slog.String("protocol", "bitcoin"), producer.ErrAttr(err))
+				return nil
+			}
+			event.Version = version
+			server.events = append(server.events, event)
+			logger.Info(
+				"Bitcoin version received",
+				slog.String("handler", "bitcoin"),
+				slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+				slog.String("src_ip", host),
+				slog.String("src_port", port),
+				slog.String("user_agent", version.UserAgent),
+				slog.Int("protocol_version", int(version.Version)),
+				slog.Uint64("services", version.Services),
+				slog.Int("start_height", int(version.StartHeight)),
+			)
+			if err := server.write("version", bitcoinVersionPayload(version, conn.RemoteAddr())); err != nil {
+				return err
+			}
+			if err := server.write("verack", nil); err != nil {
+				return err
+			}
+		case "ping":
+			server.events = append(server.events, event)
+			if err := server.write("pong", payload); err != nil {
+				return err
+			}
+		default:
+			// verack, getaddr, getheaders and friends are recorded but not answered
+			server.events = append(server.events, event)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitcoinChecksum(t *testing.T) {
+	sum := bitcoinChecksum(nil)
+	require.Equal(t, "5df6e0e2", hex.EncodeToString(sum[:]))
+}
+
+func TestParseBitcoinVersion(t *testing.T) {
+	peer := &bitcoinVersionMsg{Services: 1}
+	payload := bitcoinVersionPayload(peer, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 8333})
+	msg, err := parseBitcoinVersion(payload)
+	require.NoError(t, err)
+	require.Equal(t, int32(bitcoinVersion), msg.Version)
+	require.Equal(t, uint64(bitcoinServices), msg.Services)
+	require.Equal(t, bitcoinUserAgent, msg.UserAgent)
+	require.True(t, msg.AddrRecv.IP.Equal(net.ParseIP("192.0.2.1")))
+	require.Equal(t, uint16(8333), msg.AddrRecv.Port)
+	require.Greater(t, msg.StartHeight, int32(800000))
+	require.True(t, msg.Relay)
+
+	_, err = parseBitcoinVersion(payload[:50])
+	require.Error(t, err)
+}
+
+func TestParseRLPxAuth(t *testing.T) {
+	ecies := append([]byte{0x04}, bytes.Repeat([]byte{0xab}, 300)...)
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(ecies)))
+	auth, err := parseRLPxAuth(append(data, ecies...))
+	require.NoError(t, err)
+	require.Equal(t, "eip8", auth.Format)
+	require.Len(t, auth.EphemeralKey, 128)
+
+	auth, err = parseRLPxAuth(ecies[:rlpxLegacyAuthLen])
+	require.NoError(t, err)
+	require.Equal(t, "legacy", auth.Format)
+
+	_, err = parseRLPxAuth([]byte{0x00, 0x10, 0x01})
+	require.Error(t, err)
+}
@@ -0,0 +1,239 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	cqlError        = 0x00
+	cqlStartup      = 0x01
+	cqlAuthenticate = 0x03
+	cqlOptions      = 0x05
+	cqlSupported    = 0x06
+	cqlQuery        = 0x07
+	cqlPrepare      = 0x09
+	cqlAuthResponse = 0x0f
+
+	cqlErrProtocol       = 0x000a
+	cqlErrBadCredentials = 0x0100
+	cqlErrUnauthorized   = 0x2100
+
+	cqlMaxFrame    = 1 << 20
+	cqlMaxRequests = 20
+)
+
+var cqlOpcodes = map[byte]string{
+	0x01: "startup",
+	0x05: "options",
+	0x07: "query",
+	0x09: "prepare",
+	0x0a: "execute",
+	0x0b: "register",
+	0x0d: "batch",
+	0x0f: "auth_response",
+}
+
+type parsedCassandra struct {
+	Direction string `json:"direction,omitempty"`
+	Opcode    string `json:"opcode,omitempty"`
+	Query     string `json:"query,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+type cqlFrame struct {
+	version byte
+	stream  uint16
+	opcode  byte
+	body    []byte
+}
+
+func readCQLFrame(r io.Reader) (*cqlFrame, []byte, error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[5:])
+	if length > cqlMaxFrame {
+		return nil, header, errors.New("CQL frame too long")
+	}
+	frame := &cqlFrame{
+		version: header[0],
+		stream:  binary.BigEndian.Uint16(header[2:]),
+		opcode:  header[4],
+		body:    make([]byte, length),
+	}
+	if _, err := io.ReadFull(r, frame.body); err != nil {
+		return nil, header, err
+	}
+	return frame, append(header, frame.body...), nil
+}
+
+// cqlResponse frames body as the response to req
+func cqlResponse(req *cqlFrame, opcode byte, body []byte) []byte {
+	version := req.version | 0x80
+	if req.version&0x7f > 4 || req.version&0x7f < 3 {
+		version = 0x84
+	}
+	buf := []byte{version, 0}
+	buf = binary.BigEndian.AppendUint16(buf, req.stream)
+	buf = append(buf, opcode)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(body)))
+	return append(buf, body...)
+}
+
+func appendCQLString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+func cqlErrorBody(code uint32, message string) []byte {
+	return appendCQLString(binary.BigEndian.AppendUint32(nil, code), message)
+}
+
+// cqlSupportedBody lists the options of Cassandra 3.11 as a string multimap
+func cqlSupportedBody() []byte {
+	options := []struct {
+		key    string
+		values []string
+	}{
+		{"CQL_VERSION", []string{"3.4.4"}},
+		{"COMPRESSION", []string{"snappy", "lz4"}},
+		{"PROTOCOL_VERSIONS", []string{"3/v3", "4/v4", "5/v5-beta"}},
+	}
+	buf := binary.BigEndian.AppendUint16(nil, uint16(len(options)))
+	for _, option := range options {
+		buf = appendCQLString(buf, option.key)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(option.values)))
+		for _, value := range option.values {
+			buf = appendCQLString(buf, value)
+		}
+	}
+	return buf
+}
+
+// parseCQLQuery reads the long string leading QUERY and PREPARE bodies
+func parseCQLQuery(body []byte) (string, error) {
+	if len(body) < 4 {
+		return "", errors.New("CQL query too short")
+	}
+	length := int(int32(binary.BigEndian.Uint32(body)))
+	if length < 0 || len(body) < 4+length {
+		return "", errors.New("CQL query out of range")
+	}
+	return string(body[4 : 4+length]), nil
+}
+
+// parseCQLCredentials reads the SASL PLAIN token of an AUTH_RESPONSE
+func parseCQLCredentials(body []byte) (string, string, error) {
+	if len(body) < 4 {
+		return "", "", errors.New("CQL token too short")
+	}
+	length := int(int32(binary.BigEndian.Uint32(body)))
+	if length < 0 || len(body) < 4+length {
+		return "", "", errors.New("CQL token out of range")
+	}
+	parts := bytes.Split(body[4:4+length], []byte{0})
+	if len(parts) != 3 {
+		return "", "", errors.New("invalid SASL PLAIN token")
+	}
+	return string(parts[1]), string(parts[2]), nil
+}
+
+// HandleCassandra speaks the CQL native protocol far enough to ask for a
+// password, which is always rejected. Queries sent without logging in are
+// recorded and refused.
+func HandleCassandra(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedCassandra{}
+	defer func() {
+		if err := h.ProduceTCP("cassandra", conn, md, helpers.FirstOrEmpty[parsedCassandra](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "cassandra"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close Cassandra connection", slog.String("protocol", "cassandra"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	for range cqlMaxRequests {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "cassandra"), producer.ErrAttr(err))
+			return nil
+		}
+		frame, data, err := readCQLFrame(conn)
+		if err != nil {
+			if len(data) > 0 {
+				events = append(events, parsedCassandra{Direction: "read", Payload: data})
+			}
+			logger.Debug("Failed to read CQL frame", slog.String("protocol", "cassandra"), producer.ErrAttr(err))
+			return nil
+		}
+		event := parsedCassandra{Direction: "read", Opcode: cqlOpcodes[frame.opcode], Payload: data}
+
+		var resp []byte
+		switch {
+		case frame.version&0x7f < 3 || frame.version&0x7f > 4:
+			version := frame.version & 0x7f
+			resp = cqlResponse(frame, cqlError, cqlErrorBody(cqlErrProtocol,
+				fmt.Sprintf("Invalid or unsupported protocol version (%d); supported versions are (3/v3, 4/v4, 5/v5-beta)", version)))
+		case frame.opcode == cqlOptions:
+			resp = cqlResponse(frame, cqlSupported, cqlSupportedBody())
+		case frame.opcode == cqlStartup:
+			resp = cqlResponse(frame, cqlAuthenticate, appendCQLString(nil, "org.apache.cassandra.auth.PasswordAuthenticator"))
+		case frame.opcode == cqlAuthResponse:
+			event.Username, event.Password, err = parseCQLCredentials(frame.body)
+			if err != nil {
+				logger.Debug("Failed to parse CQL credentials", slog.String("protocol", "cassandra"), producer.ErrAttr(err))
+			}
+			resp = cqlResponse(frame, cqlError, cqlErrorBody(cqlErrBadCredentials,
+				fmt.Sprintf("Provided username %s and/or password are incorrect", event.Username)))
+		case frame.opcode == cqlQuery || frame.opcode == cqlPrepare:
+			if event.Query, err = parseCQLQuery(frame.body); err != nil {
+				logger.Debug("Failed to parse CQL query", slog.String("protocol", "cassandra"), producer.ErrAttr(err))
+			}
+			resp = cqlResponse(frame, cqlError, cqlErrorBody(cqlErrUnauthorized, "You have not logged in"))
+		default:
+			resp = cqlResponse(frame, cqlError, cqlErrorBody(cqlErrProtocol, "Unexpected message, expecting STARTUP or OPTIONS"))
+		}
+		events = append(events, event)
+		logger.Info(
+			"Cassandra request",
+			slog.String("handler", "cassandra"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("opcode", event.Opcode),
+			slog.String("query", event.Query),
+			slog.String("username", event.Username),
+			slog.String("password", event.Password),
+		)
+		if frame.opcode == cqlAuthResponse {
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "cassandra", Username: event.Username, Password: event.Password}, logger, h)
+		}
+
+		events = append(events, parsedCassandra{Direction: "write", Payload: resp})
+		if _, err := conn.Write(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
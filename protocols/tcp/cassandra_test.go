@@ -0,0 +1,38 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassandraFrames(t *testing.T) {
+	token := []byte("\x00cassandra\x00cassandra")
+	body := binary.BigEndian.AppendUint32(nil, uint32(len(token)))
+	body = append(body, token...)
+	req := []byte{0x04, 0, 0, 7, cqlAuthResponse}
+	req = binary.BigEndian.AppendUint32(req, uint32(len(body)))
+	req = append(req, body...)
+
+	frame, data, err := readCQLFrame(bytes.NewReader(req))
+	require.NoError(t, err)
+	require.Equal(t, req, data)
+	require.Equal(t, uint16(7), frame.stream)
+	username, password, err := parseCQLCredentials(frame.body)
+	require.NoError(t, err)
+	require.Equal(t, "cassandra", username)
+	require.Equal(t, "cassandra", password)
+
+	resp := cqlResponse(frame, cqlError, cqlErrorBody(cqlErrBadCredentials, "bad"))
+	require.Equal(t, []byte{0x84, 0, 0, 7, cqlError, 0, 0, 0, 9, 0, 0, 1, 0, 0, 3}, resp[:15])
+
+	query := "SELECT * FROM system_auth.roles"
+	body = binary.BigEndian.AppendUint32(nil, uint32(len(query)))
+	body = append(body, query...)
+	body = append(body, 0, 1, 0)
+	parsed, err := parseCQLQuery(body)
+	require.NoError(t, err)
+	require.Equal(t, query, parsed)
+}
@@ -0,0 +1,120 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	// pre EIP-8 auth messages have a fixed size
+	rlpxLegacyAuthLen = 307
+	// ECIES overhead: ephemeral public key, IV and MAC
+	rlpxECIESOverhead = 65 + 16 + 32
+	rlpxMaxAuthLen    = 2048
+)
+
+type parsedDevP2P struct {
+	Format       string `json:"format,omitempty"`
+	EphemeralKey string `json:"ephemeral_key,omitempty"`
+	Size         int    `json:"size,omitempty"`
+	Payload      []byte `json:"payload,omitempty"`
+}
+
+// parseRLPxAuth identifies the RLPx auth message format and extracts the
+// initiator's ephemeral ECIES public key
+func parseRLPxAuth(data []byte) (parsedDevP2P, error) {
+	auth := parsedDevP2P{Size: len(data), Payload: data}
+	var ecies []byte
+	switch {
+	case len(data) == rlpxLegacyAuthLen && data[0] == 0x04:
+		auth.Format = "legacy"
+		ecies = data
+	case len(data) > 2:
+		size := int(binary.BigEndian.Uint16(data[:2]))
+		if size != len(data)-2 {
+			return auth, errors.New("invalid RLPx auth size prefix")
+		}
+		auth.Format = "eip8"
+		ecies = data[2:]
+	default:
+		return auth, errors.New("RLPx auth message too short")
+	}
+	if len(ecies) < rlpxECIESOverhead || ecies[0] != 0x04 {
+		return auth, errors.New("not an ECIES message")
+	}
+	auth.EphemeralKey = hex.EncodeToString(ecies[1:65])
+	return auth, nil
+}
+
+// HandleDevP2P records the Ethereum RLPx auth message. Completing the
+// handshake requires secp256k1 ECIES, so the connection is closed after it.
+func HandleDevP2P(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	var auth parsedDevP2P
+	defer func() {
+		if err := h.ProduceTCP("devp2p", conn, md, auth.Payload, auth); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "devp2p"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close devp2p connection", slog.String("protocol", "devp2p"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		logger.Debug("Failed to set connection timeout", slog.String("protocol", "devp2p"), producer.ErrAttr(err))
+		return nil
+	}
+
+	prefix := make([]byte, 2)
+	if _, err := io.ReadFull(conn, prefix); err != nil {
+		logger.Debug("Failed to read RLPx auth", slog.String("protocol", "devp2p"), producer.ErrAttr(err))
+		return nil
+	}
+	// legacy messages start with the uncompressed key marker, EIP-8 size
+	// prefixes only do so for messages of 1024 bytes and more
+	size := rlpxLegacyAuthLen - 2
+	if prefix[0] != 0x04 {
+		size = int(binary.BigEndian.Uint16(prefix))
+	}
+	if size > rlpxMaxAuthLen {
+		auth.Payload = prefix
+		return nil
+	}
+	data := make([]byte, size)
+	n, err := io.ReadFull(conn, data)
+	data = append(prefix, data[:n]...)
+	if err != nil {
+		auth.Payload = data
+		logger.Debug("Failed to read RLPx auth", slog.String("protocol", "devp2p"), producer.ErrAttr(err))
+		return nil
+	}
+
+	auth, err = parseRLPxAuth(data)
+	if err != nil {
+		logger.Debug("Failed to parse RLPx auth", slog.String("protocol", "devp2p"), producer.ErrAttr(err))
+		return nil
+	}
+	logger.Info(
+		"Ethereum devp2p handshake",
+		slog.String("handler", "devp2p"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("format", auth.Format),
+		slog.String("ephemeral_key", auth.EphemeralKey),
+	)
+	return nil
+}
@@ -0,0 +1,368 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	dnp3LinkReset      = 0
+	dnp3LinkTest       = 2
+	dnp3LinkConfirmed  = 3
+	dnp3LinkUser       = 4
+	dnp3LinkStatus     = 9
+	dnp3LinkAck        = 0
+	dnp3LinkStatusResp = 11
+
+	dnp3Primary = 0x40
+	dnp3FIR     = 0x40
+	dnp3FIN     = 0x80
+
+	dnp3Confirm  = 0
+	dnp3Read     = 1
+	dnp3Response = 0x81
+
+	// IIN2 bits
+	dnp3NoFuncSupport = 0x01
+	dnp3ObjectUnknown = 0x02
+
+	dnp3MaxFragment = 2048
+	// a link frame carries up to 250 bytes of transport header and data
+	dnp3MaxSegment = 249
+)
+
+var dnp3Functions = map[byte]string{
+	0:  "confirm",
+	1:  "read",
+	2:  "write",
+	3:  "select",
+	4:  "operate",
+	5:  "direct_operate",
+	6:  "direct_operate_no_ack",
+	13: "cold_restart",
+	14: "warm_restart",
+	18: "stop_application",
+	20: "enable_unsolicited",
+	21: "disable_unsolicited",
+}
+
+// functions that change the state of the outstation
+var dnp3ControlFunctions = []string{
+	"write", "select", "operate", "direct_operate", "direct_operate_no_ack",
+	"cold_restart", "warm_restart", "stop_application",
+}
+
+type dnp3Request struct {
+	LinkFunction uint8    `json:"link_function"`
+	Destination  uint16   `json:"destination"`
+	Source       uint16   `json:"source"`
+	Function     string   `json:"function,omitempty"`
+	Objects      []string `json:"objects,omitempty"`
+}
+
+type parsedDNP3 struct {
+	Direction string       `json:"direction,omitempty"`
+	Request   *dnp3Request `json:"request,omitempty"`
+	Payload   []byte       `json:"payload,omitempty"`
+}
+
+type dnp3Link struct {
+	Control     uint8
+	Destination uint16
+	Source      uint16
+	Data        []byte
+}
+
+// dnp3CRC computes the CRC-16/DNP of a link header or data block
+func dnp3CRC(data []byte) uint16 {
+	crc := uint16(0)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa6bc
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
+
+// dnp3Frame builds a link layer frame, user data is split into blocks of 16
+// bytes each followed by its CRC
+func dnp3Frame(control uint8, dst, src uint16, data []byte) []byte {
+	frame := []byte{0x05, 0x64, byte(5 + len(data)), control}
+	frame = binary.LittleEndian.AppendUint16(frame, dst)
+	frame = binary.LittleEndian.AppendUint16(frame, src)
+	frame = binary.LittleEndian.AppendUint16(frame, dnp3CRC(frame))
+	for block := range slices.Chunk(data, 16) {
+		frame = append(frame, block...)
+		frame = binary.LittleEndian.AppendUint16(frame, dnp3CRC(block))
+	}
+	return frame
+}
+
+// readDNP3Frame reads a link layer frame and strips the CRCs
+func readDNP3Frame(r io.Reader) (dnp3Link, []byte, error) {
+	link := dnp3Link{}
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return link, header, err
+	}
+	if header[0] != 0x05 || header[1] != 0x64 || header[2] < 5 {
+		return link, header, errors.New("invalid DNP3 link header")
+	}
+	if binary.LittleEndian.Uint16(header[8:]) != dnp3CRC(header[:8]) {
+		return link, header, errors.New("invalid DNP3 header CRC")
+	}
+	link.Control = header[3]
+	link.Destination = binary.LittleEndian.Uint16(header[4:])
+	link.Source = binary.LittleEndian.Uint16(header[6:])
+
+	size := int(header[2]) - 5
+	blocks := make([]byte, size+2*((size+15)/16))
+	if _, err := io.ReadFull(r, blocks); err != nil {
+		return link, header, err
+	}
+	for block := range slices.Chunk(blocks, 18) {
+		data := block[:len(block)-2]
+		if binary.LittleEndian.Uint16(block[len(block)-2:]) != dnp3CRC(data) {
+			return link, append(header, blocks...), errors.New("invalid DNP3 data CRC")
+		}
+		link.Data = append(link.Data, data...)
+	}
+	return link, append(header, blocks...), nil
+}
+
+// dnp3Outstation holds the points served to integrity polls
+type dnp3Outstation struct {
+	address uint16
+	binary  []bool
+	analog  []int32
+	tseq    uint8
+}
+
+func newDNP3Outstation() *dnp3Outstation {
+	o := &dnp3Outstation{address: uint16(viper.GetUint("dnp3.address"))}
+	for _, v := range viper.GetIntSlice("dnp3.binary_inputs") {
+		o.binary = append(o.binary, v != 0)
+	}
+	for _, v := range viper.GetIntSlice("dnp3.analog_inputs") {
+		o.analog = append(o.analog, int32(v))
+	}
+	return o
+}
+
+// classData returns binary inputs (g1v2) and analog inputs (g30v1), analog
+// values drift by up to one percent between polls
+func (o *dnp3Outstation) classData() []byte {
+	data := []byte{}
+	if len(o.binary) > 0 {
+		data = append(data, 1, 2, 0x00, 0, byte(len(o.binary)-1))
+		for _, v := range o.binary {
+			flags := byte(0x01)
+			if v {
+				flags |= 0x80
+			}
+			data = append(data, flags)
+		}
+	}
+	if len(o.analog) > 0 {
+		data = append(data, 30, 1, 0x00, 0, byte(len(o.analog)-1))
+		for _, v := range o.analog {
+			if spread := v / 100; spread > 0 {
+				v += rand.Int32N(2*spread+1) - spread
+			}
+			data = append(data, 0x01)
+			data = binary.LittleEndian.AppendUint32(data, uint32(v))
+		}
+	}
+	return data
+}
+
+// respond handles an application request fragment and returns the response
+// fragment, or nil when none is due
+func (o *dnp3Outstation) respond(req *dnp3Request, app []byte) []byte {
+	if len(app) < 2 {
+		return nil
+	}
+	control, function := app[0], app[1]
+	req.Function = dnp3Functions[function]
+	if req.Function == "" {
+		req.Function = strconv.Itoa(int(function))
+	}
+	if function == dnp3Confirm {
+		return nil
+	}
+
+	iin2 := byte(0)
+	objects := []byte{}
+	switch function {
+	case dnp3Read:
+		class := false
+		rest := app[2:]
+		for len(rest) >= 3 {
+			group, variation, qualifier := rest[0], rest[1], rest[2]
+			req.Objects = append(req.Objects, fmt.Sprintf("g%dv%d", group, variation))
+			// only all objects headers have a fixed size we can skip
+			if qualifier != 0x06 {
+				iin2 |= dnp3ObjectUnknown
+				break
+			}
+			switch group {
+			case 1, 30, 60:
+				class = true
+			default:
+				iin2 |= dnp3ObjectUnknown
+			}
+			rest = rest[3:]
+		}
+		if class {
+			objects = o.classData()
+		}
+	case 13, 14:
+		// time delay fine (g52v2) of one second before the restart
+		objects = []byte{52, 2, 0x07, 1, 0xe8, 0x03}
+	case 20, 21:
+	default:
+		iin2 |= dnp3NoFuncSupport
+	}
+	resp := []byte{dnp3FIR | dnp3FIN | control&0x0f, dnp3Response, 0x00, iin2}
+	return append(resp, objects...)
+}
+
+// HandleDNP3 handles DNP3 over TCP as an outstation answering link layer
+// requests and integrity polls
+func HandleDNP3(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedDNP3{}
+	defer func() {
+		if err := h.ProduceTCP("dnp3", conn, md, helpers.FirstOrEmpty[parsedDNP3](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "dnp3"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close DNP3 connection", slog.String("protocol", "dnp3"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	outstation := newDNP3Outstation()
+	write := func(control uint8, dst uint16, data []byte) error {
+		out := dnp3Frame(control, dst, outstation.address, data)
+		events = append(events, parsedDNP3{
+			Direction: "write",
+			Payload:   out,
+		})
+		_, err := conn.Write(out)
+		return err
+	}
+
+	fragment := []byte{}
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "dnp3"), producer.ErrAttr(err))
+			return nil
+		}
+		link, raw, err := readDNP3Frame(conn)
+		if err != nil {
+			logger.Debug("Failed to read DNP3 frame", slog.String("protocol", "dnp3"), producer.ErrAttr(err))
+			return nil
+		}
+
+		req := &dnp3Request{
+			LinkFunction: link.Control & 0x0f,
+			Destination:  link.Destination,
+			Source:       link.Source,
+		}
+		var resp []byte
+		if link.Control&dnp3Primary != 0 && (link.Destination == outstation.address || link.Destination >= 0xfffd) {
+			switch req.LinkFunction {
+			case dnp3LinkReset, dnp3LinkTest:
+				if err := write(dnp3LinkAck, link.Source, nil); err != nil {
+					return err
+				}
+			case dnp3LinkStatus:
+				if err := write(dnp3LinkStatusResp, link.Source, nil); err != nil {
+					return err
+				}
+			case dnp3LinkConfirmed, dnp3LinkUser:
+				if req.LinkFunction == dnp3LinkConfirmed {
+					if err := write(dnp3LinkAck, link.Source, nil); err != nil {
+						return err
+					}
+				}
+				if len(link.Data) < 1 {
+					break
+				}
+				transport := link.Data[0]
+				if transport&dnp3FIR != 0 {
+					fragment = fragment[:0]
+				}
+				if len(fragment)+len(link.Data) > dnp3MaxFragment {
+					logger.Debug("DNP3 fragment too large", slog.String("protocol", "dnp3"))
+					return nil
+				}
+				fragment = append(fragment, link.Data[1:]...)
+				if transport&dnp3FIN != 0 {
+					resp = outstation.respond(req, fragment)
+				}
+			}
+		}
+		events = append(events, parsedDNP3{
+			Direction: "read",
+			Request:   req,
+			Payload:   raw,
+		})
+		if slices.Contains(dnp3ControlFunctions, req.Function) && !slices.Contains(md.Tags, "dnp3_control") {
+			md.Tags = append(md.Tags, "dnp3_control")
+		}
+		logger.Info(
+			"DNP3 request",
+			slog.String("handler", "dnp3"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.Int("link_function", int(req.LinkFunction)),
+			slog.Int("destination", int(req.Destination)),
+			slog.String("function", req.Function),
+			slog.Any("objects", req.Objects),
+		)
+		if resp == nil {
+			continue
+		}
+
+		// responses are sent as unconfirmed user data
+		for i := 0; i < len(resp); i += dnp3MaxSegment {
+			transport := outstation.tseq & 0x3f
+			outstation.tseq++
+			if i == 0 {
+				transport |= dnp3FIR
+			}
+			if i+dnp3MaxSegment >= len(resp) {
+				transport |= dnp3FIN
+			}
+			segment := append([]byte{transport}, resp[i:min(i+dnp3MaxSegment, len(resp))]...)
+			if err := write(dnp3Primary|dnp3LinkUser, link.Source, segment); err != nil {
+				return err
+			}
+		}
+	}
+}
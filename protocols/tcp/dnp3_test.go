@@ -0,0 +1,49 @@
+package tcp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNP3Frame(t *testing.T) {
+	// request link status from address 10, as sent by nmap dnp3-info
+	frame := dnp3Frame(0xc9, 10, 1, nil)
+	require.Equal(t, []byte{0x05, 0x64, 0x05, 0xc9, 0x0a, 0x00, 0x01, 0x00}, frame[:8])
+
+	data := bytes.Repeat([]byte{0xaa}, 20)
+	link, raw, err := readDNP3Frame(bytes.NewReader(dnp3Frame(0xc4, 10, 1, data)))
+	require.NoError(t, err)
+	require.Len(t, raw, 10+20+4)
+	require.Equal(t, data, link.Data)
+	require.Equal(t, uint16(10), link.Destination)
+
+	corrupt := dnp3Frame(0xc4, 10, 1, data)
+	corrupt[12] ^= 0xff
+	_, _, err = readDNP3Frame(bytes.NewReader(corrupt))
+	require.Error(t, err)
+}
+
+func TestDNP3Outstation(t *testing.T) {
+	viper.Set("dnp3.binary_inputs", []int{1, 0})
+	viper.Set("dnp3.analog_inputs", []int{50})
+	defer viper.Reset()
+	outstation := newDNP3Outstation()
+
+	// integrity poll: read class 1, 2, 3 and 0
+	req := &dnp3Request{}
+	resp := outstation.respond(req, []byte{0xc3, 0x01, 60, 2, 0x06, 60, 3, 0x06, 60, 4, 0x06, 60, 1, 0x06})
+	require.Equal(t, "read", req.Function)
+	require.Equal(t, []string{"g60v2", "g60v3", "g60v4", "g60v1"}, req.Objects)
+	require.Equal(t, []byte{0xc3, dnp3Response, 0, 0}, resp[:4])
+	require.Equal(t, []byte{1, 2, 0, 0, 1, 0x81, 0x01, 30, 1, 0, 0, 0, 0x01, 50, 0, 0, 0}, resp[4:])
+
+	req = &dnp3Request{}
+	resp = outstation.respond(req, []byte{0xc4, 0x05, 12, 1, 0x28})
+	require.Equal(t, "direct_operate", req.Function)
+	require.Equal(t, byte(dnp3NoFuncSupport), resp[3])
+
+	require.Nil(t, outstation.respond(&dnp3Request{}, []byte{0xc0, 0x00}))
+}
@@ -0,0 +1,88 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+type parsedDNS struct {
+	Direction string             `json:"direction,omitempty"`
+	Message   helpers.DNSMessage `json:"message,omitempty"`
+	Payload   []byte             `json:"payload,omitempty"`
+}
+
+// HandleDNS answers length prefixed DNS queries with the configured
+// sinkhole or NXDOMAIN
+func HandleDNS(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedDNS{}
+	defer func() {
+		if err := h.ProduceTCP("dns", conn, md, helpers.FirstOrEmpty[parsedDNS](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "dns"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close DNS connection", slog.String("protocol", "dns"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "dns"), producer.ErrAttr(err))
+			return nil
+		}
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			logger.Debug("Failed to read DNS message length", slog.String("protocol", "dns"), producer.ErrAttr(err))
+			return nil
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			logger.Debug("Failed to read DNS message", slog.String("protocol", "dns"), producer.ErrAttr(err))
+			return nil
+		}
+
+		resp, msg, err := helpers.DNSResponse(data)
+		events = append(events, parsedDNS{
+			Direction: "read",
+			Message:   msg,
+			Payload:   data,
+		})
+		if err != nil {
+			logger.Debug("Failed to parse DNS query", slog.String("protocol", "dns"), producer.ErrAttr(err))
+			return nil
+		}
+		for _, q := range msg.Questions {
+			logger.Info(
+				"DNS query",
+				slog.String("handler", "dns"),
+				slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+				slog.String("src_ip", host),
+				slog.String("src_port", port),
+				slog.String("qname", q.Name),
+				slog.String("qtype", q.Type),
+			)
+		}
+
+		events = append(events, parsedDNS{
+			Direction: "write",
+			Message:   msg,
+			Payload:   resp,
+		})
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...)); err != nil {
+			return err
+		}
+	}
+}
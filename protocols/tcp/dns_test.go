@@ -0,0 +1,36 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleDNSMalformed(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("dns", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	// a question gopacket fails to decode with a panic
+	_, err = client.Write([]byte("\x00\x10000000000&0\x00\x00\x02\x000"))
+	require.NoError(t, err)
+	require.NotPanics(t, func() {
+		require.NoError(t, HandleDNS(context.Background(), server, connection.Metadata{TargetPort: 53}, l, h))
+	})
+}
@@ -0,0 +1,141 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	epmdAlive2Req      = 'x'
+	epmdAlive2Resp     = 'y'
+	epmdPortPlease2Req = 'z'
+	epmdPort2Resp      = 'w'
+	epmdNamesReq       = 'n'
+	epmdDumpReq        = 'd'
+	epmdKillReq        = 'k'
+	epmdStopReq        = 's'
+
+	epmdPort = 4369
+)
+
+var epmdRequests = map[byte]string{
+	epmdAlive2Req:      "alive2",
+	epmdPortPlease2Req: "port_please2",
+	epmdNamesReq:       "names",
+	epmdDumpReq:        "dump",
+	epmdKillReq:        "kill",
+	epmdStopReq:        "stop",
+}
+
+type parsedEPMD struct {
+	Direction string `json:"direction,omitempty"`
+	Request   string `json:"request,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// epmdResponse answers an EPMD request for the node of erlang.node running
+// its distribution on erlang.port
+func epmdResponse(req []byte) (parsedEPMD, []byte) {
+	event := parsedEPMD{Direction: "read", Payload: req}
+	if len(req) == 0 {
+		return event, nil
+	}
+	// EPMD only knows the name part of the node
+	name, _, _ := strings.Cut(viper.GetString("erlang.node"), "@")
+	port := viper.GetInt("erlang.port")
+	event.Request = epmdRequests[req[0]]
+	switch req[0] {
+	case epmdNamesReq:
+		resp := binary.BigEndian.AppendUint32(nil, epmdPort)
+		return event, fmt.Appendf(resp, "name %s at port %d\n", name, port)
+	case epmdDumpReq:
+		resp := binary.BigEndian.AppendUint32(nil, epmdPort)
+		return event, fmt.Appendf(resp, "active name     <%s> at port %d, fd = 7\n\x00", name, port)
+	case epmdPortPlease2Req:
+		event.Node = string(req[1:])
+		if event.Node != name {
+			return event, []byte{epmdPort2Resp, 1}
+		}
+		resp := []byte{epmdPort2Resp, 0}
+		resp = binary.BigEndian.AppendUint16(resp, uint16(port))
+		// normal Erlang node over TCP, distribution versions 5 to 6
+		resp = append(resp, 77, 0, 0, 6, 0, 5)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(name)))
+		resp = append(resp, name...)
+		return event, binary.BigEndian.AppendUint16(resp, 0)
+	case epmdAlive2Req:
+		if len(req) >= 11 {
+			size := int(binary.BigEndian.Uint16(req[9:]))
+			if len(req) >= 11+size {
+				event.Node = string(req[11 : 11+size])
+			}
+		}
+		return event, []byte{epmdAlive2Resp, 0, 0, 1}
+	case epmdKillReq:
+		return event, []byte("OK")
+	}
+	return event, nil
+}
+
+// HandleEPMD answers the Erlang port mapper with a single registered node,
+// pointing clients to the distribution port served by HandleErlangDist
+func HandleEPMD(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedEPMD{}
+	defer func() {
+		if err := h.ProduceTCP("epmd", conn, md, helpers.FirstOrEmpty[parsedEPMD](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "epmd"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close EPMD connection", slog.String("protocol", "epmd"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		logger.Debug("Failed to read EPMD request length", slog.String("protocol", "epmd"), producer.ErrAttr(err))
+		return nil
+	}
+	req := make([]byte, length)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		logger.Debug("Failed to read EPMD request", slog.String("protocol", "epmd"), producer.ErrAttr(err))
+		return nil
+	}
+
+	event, resp := epmdResponse(req)
+	events = append(events, event)
+	logger.Info(
+		"EPMD request",
+		slog.String("handler", "epmd"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("request", event.Request),
+		slog.String("node", event.Node),
+	)
+	if resp == nil {
+		return nil
+	}
+	events = append(events, parsedEPMD{Direction: "write", Payload: resp})
+	_, err = conn.Write(resp)
+	return err
+}
@@ -0,0 +1,55 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEPMDResponse(t *testing.T) {
+	viper.Set("erlang.node", "rabbit@rabbitmq")
+	viper.Set("erlang.port", 25672)
+
+	event, resp := epmdResponse([]byte{epmdNamesReq})
+	require.Equal(t, "names", event.Request)
+	require.Equal(t, uint32(epmdPort), binary.BigEndian.Uint32(resp))
+	require.Equal(t, "name rabbit at port 25672\n", string(resp[4:]))
+
+	event, resp = epmdResponse(append([]byte{epmdPortPlease2Req}, "rabbit"...))
+	require.Equal(t, "rabbit", event.Node)
+	require.Equal(t, []byte{epmdPort2Resp, 0}, resp[:2])
+	require.Equal(t, uint16(25672), binary.BigEndian.Uint16(resp[2:]))
+	require.Equal(t, "rabbit", string(resp[12:18]))
+
+	_, resp = epmdResponse(append([]byte{epmdPortPlease2Req}, "couchdb"...))
+	require.Equal(t, []byte{epmdPort2Resp, 1}, resp)
+}
+
+func TestErlangHandshake(t *testing.T) {
+	viper.Set("erlang.cookies", []string{"monster"})
+
+	name := []byte{'N'}
+	name = binary.BigEndian.AppendUint64(name, erlangDistFlags)
+	name = binary.BigEndian.AppendUint32(name, 7)
+	name = binary.BigEndian.AppendUint16(name, 11)
+	name = append(name, "attacker@x1"...)
+	node, err := parseErlangName(name)
+	require.NoError(t, err)
+	require.Equal(t, "attacker@x1", node)
+
+	node, err = parseErlangName(append([]byte{'n', 0, 5, 0, 0, 0, 0}, "old@x1"...))
+	require.NoError(t, err)
+	require.Equal(t, "old@x1", node)
+
+	challenge := erlangChallenge(true, 1234, "rabbit@rabbitmq")
+	require.Equal(t, uint32(1234), binary.BigEndian.Uint32(challenge[7:]))
+	require.Equal(t, "rabbit@rabbitmq", string(challenge[11:]))
+
+	cookie, ok := erlangCookie(erlangDigest("monster", 1234), 1234)
+	require.True(t, ok)
+	require.Equal(t, "monster", cookie)
+	_, ok = erlangCookie(erlangDigest("s3cret", 1234), 1234)
+	require.False(t, ok)
+}
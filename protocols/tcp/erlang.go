@@ -0,0 +1,225 @@
+package tcp
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	// erlangDistFlags are the capabilities mandatory since OTP 25 along
+	// with the OTP 23 handshake
+	erlangDistFlags = 0x1070f9d
+	// erlangMaxMessages bounds the distribution messages recorded after a
+	// client got in with a guessed cookie
+	erlangMaxMessages = 20
+	erlangMaxMessage  = 1 << 20
+)
+
+type parsedErlangDist struct {
+	Direction string `json:"direction,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Challenge uint32 `json:"challenge,omitempty"`
+	// Digest is md5(cookie ++ challenge as a decimal string), enough to crack
+	// the cookie of the client offline
+	Digest      string `json:"digest,omitempty"`
+	Cookie      string `json:"cookie,omitempty"`
+	PayloadHash string `json:"payload_hash,omitempty"`
+	Payload     []byte `json:"payload,omitempty"`
+}
+
+func erlangDigest(cookie string, challenge uint32) []byte {
+	sum := md5.Sum([]byte(cookie + strconv.FormatUint(uint64(challenge), 10)))
+	return sum[:]
+}
+
+// erlangCookie returns the cookie of erlang.cookies the digest was made
+// with, if any
+func erlangCookie(digest []byte, challenge uint32) (string, bool) {
+	for _, cookie := range viper.GetStringSlice("erlang.cookies") {
+		if string(erlangDigest(cookie, challenge)) == string(digest) {
+			return cookie, true
+		}
+	}
+	return "", false
+}
+
+// parseErlangName reads the node name of the old 'n' or the new 'N'
+// send_name message
+func parseErlangName(msg []byte) (string, error) {
+	switch {
+	case len(msg) >= 7 && msg[0] == 'n':
+		return string(msg[7:]), nil
+	case len(msg) >= 15 && msg[0] == 'N':
+		size := int(binary.BigEndian.Uint16(msg[13:]))
+		if len(msg) < 15+size {
+			return "", errors.New("Erlang node name out of range")
+		}
+		return string(msg[15 : 15+size]), nil
+	}
+	return "", errors.New("not an Erlang send_name message")
+}
+
+// erlangChallenge answers send_name in the format the client used
+func erlangChallenge(old bool, challenge uint32, node string) []byte {
+	if old {
+		msg := []byte{'n', 0, 5}
+		msg = binary.BigEndian.AppendUint32(msg, erlangDistFlags)
+		msg = binary.BigEndian.AppendUint32(msg, challenge)
+		return append(msg, node...)
+	}
+	msg := []byte{'N'}
+	msg = binary.BigEndian.AppendUint64(msg, erlangDistFlags)
+	msg = binary.BigEndian.AppendUint32(msg, challenge)
+	msg = binary.BigEndian.AppendUint32(msg, 1)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(node)))
+	return append(msg, node...)
+}
+
+func readErlangHandshake(conn net.Conn) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	_, err := io.ReadFull(conn, msg)
+	return msg, err
+}
+
+func writeErlangHandshake(conn net.Conn, msg []byte) error {
+	_, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+	return err
+}
+
+// HandleErlangDist runs the Erlang distribution handshake of erlang.node to
+// record the cookie digest of the client. Clients using one of the weak
+// erlang.cookies are let in and the control messages they send, usually
+// an RPC spawning a shell command, are stored.
+func HandleErlangDist(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedErlangDist{}
+	defer func() {
+		if err := h.ProduceTCP("erlang", conn, md, helpers.FirstOrEmpty[parsedErlangDist](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "erlang"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close Erlang connection", slog.String("protocol", "erlang"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	msg, err := readErlangHandshake(conn)
+	if err != nil {
+		logger.Debug("Failed to read Erlang handshake", slog.String("protocol", "erlang"), producer.ErrAttr(err))
+		return nil
+	}
+	node, err := parseErlangName(msg)
+	events = append(events, parsedErlangDist{Direction: "read", Node: node, Payload: msg})
+	if err != nil {
+		logger.Debug("Failed to parse Erlang handshake", slog.String("protocol", "erlang"), producer.ErrAttr(err))
+		return nil
+	}
+
+	challengeBytes := make([]byte, 4)
+	if _, err := rand.Read(challengeBytes); err != nil {
+		return err
+	}
+	challenge := binary.BigEndian.Uint32(challengeBytes)
+	if err := writeErlangHandshake(conn, []byte("sok")); err != nil {
+		return err
+	}
+	if err := writeErlangHandshake(conn, erlangChallenge(msg[0] == 'n', challenge, viper.GetString("erlang.node"))); err != nil {
+		return err
+	}
+
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	msg, err = readErlangHandshake(conn)
+	if err != nil {
+		logger.Debug("Failed to read Erlang challenge reply", slog.String("protocol", "erlang"), producer.ErrAttr(err))
+		return nil
+	}
+	if len(msg) < 21 || msg[0] != 'r' {
+		events = append(events, parsedErlangDist{Direction: "read", Payload: msg})
+		logger.Debug("Invalid Erlang challenge reply", slog.String("protocol", "erlang"))
+		return nil
+	}
+	event := parsedErlangDist{
+		Direction: "read",
+		Node:      node,
+		Challenge: challenge,
+		Digest:    hex.EncodeToString(msg[5:21]),
+		Payload:   msg,
+	}
+	cookie, ok := erlangCookie(msg[5:21], challenge)
+	event.Cookie = cookie
+	events = append(events, event)
+	logger.Info(
+		"Erlang distribution handshake",
+		slog.String("handler", "erlang"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("node", node),
+		slog.String("digest", event.Digest),
+		slog.Bool("cookie_guessed", ok),
+	)
+	if !ok {
+		helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "erlang", Username: node, Hash: event.Digest, HashType: "erlang-challenge"}, logger, h)
+		return nil
+	}
+
+	md.Tags = append(md.Tags, "erlang_cookie")
+	if err := writeErlangHandshake(conn, append([]byte{'a'}, erlangDigest(cookie, binary.BigEndian.Uint32(msg[1:]))...)); err != nil {
+		return err
+	}
+	for range erlangMaxMessages {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		var length uint32
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return nil
+		}
+		if length == 0 {
+			// tick, answered to keep the connection up
+			if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+				return err
+			}
+			continue
+		}
+		if length > erlangMaxMessage {
+			return nil
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return nil
+		}
+		event := parsedErlangDist{Direction: "read", Payload: data}
+		if event.PayloadHash, err = helpers.StorePayload(data); err != nil {
+			logger.Error("Failed to store the Erlang message", producer.ErrAttr(err))
+		}
+		events = append(events, event)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const fingerMaxQuery = 512
+
+type parsedFinger struct {
+	Direction string `json:"direction,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Verbose   bool   `json:"verbose,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// parseFingerQuery splits an RFC 1288 query into the user, the host a
+// forwarded query is meant for and the /W verbose switch
+func parseFingerQuery(line string) parsedFinger {
+	query := parsedFinger{Direction: "read", Payload: []byte(line)}
+	line = strings.TrimSpace(line)
+	if rest, ok := strings.CutPrefix(line, "/W"); ok {
+		query.Verbose = true
+		line = strings.TrimSpace(rest)
+	}
+	query.Username, query.Host, _ = strings.Cut(line, "@")
+	return query
+}
+
+// fingerResponse lists the finger.users as logged in, or shows one of them
+// in detail. The login times are relative to now so they always look fresh.
+func fingerResponse(query parsedFinger, now time.Time) string {
+	users := viper.GetStringSlice("finger.users")
+	if query.Host != "" {
+		return "finger: forwarding service denied\r\n"
+	}
+	if query.Username == "" {
+		resp := &strings.Builder{}
+		resp.WriteString("Login     Name              Tty      Idle  Login Time   Office     Office Phone\r\n")
+		for i, user := range users {
+			login := now.Add(-time.Duration(i*97+23) * time.Minute)
+			fmt.Fprintf(resp, "%-9s %-17s pts/%-4d %5s  %s\r\n", user, user, i, strconv.Itoa(i*13)+"m", login.Format("Jan _2 15:04"))
+		}
+		return resp.String()
+	}
+	i := slices.Index(users, query.Username)
+	if i < 0 {
+		return fmt.Sprintf("finger: %s: no such user.\r\n", query.Username)
+	}
+	home := "/home/" + query.Username
+	if query.Username == "root" {
+		home = "/root"
+	}
+	login := now.Add(-time.Duration(i*97+23) * time.Minute)
+	return fmt.Sprintf("Login: %-32sName: %s\r\nDirectory: %-28sShell: /bin/bash\r\nOn since %s (UTC) on pts/%d\r\nNo mail.\r\nNo Plan.\r\n",
+		query.Username, query.Username, home, login.Format("Mon Jan _2 15:04"), i)
+}
+
+// HandleFinger answers a single finger query with a fake user listing and
+// records the queried user names
+func HandleFinger(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedFinger{}
+	defer func() {
+		if err := h.ProduceTCP("finger", conn, md, helpers.FirstOrEmpty[parsedFinger](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "finger"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close finger connection", slog.String("protocol", "finger"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	line, err := bufio.NewReaderSize(conn, fingerMaxQuery).ReadSlice('\n')
+	if err != nil {
+		logger.Debug("Failed to read finger query", slog.String("protocol", "finger"), producer.ErrAttr(err))
+		return nil
+	}
+	query := parseFingerQuery(string(line))
+	events = append(events, query)
+	logger.Info(
+		"finger query",
+		slog.String("handler", "finger"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("username", query.Username),
+		slog.String("host", query.Host),
+	)
+
+	resp := fingerResponse(query, time.Now().UTC())
+	events = append(events, parsedFinger{Direction: "write", Payload: []byte(resp)})
+	_, err = conn.Write([]byte(resp))
+	return err
+}
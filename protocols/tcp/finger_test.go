@@ -0,0 +1,29 @@
+package tcp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFinger(t *testing.T) {
+	viper.Set("finger.users", []string{"root", "admin"})
+	defer viper.Reset()
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	query := parseFingerQuery("/W admin@10.0.0.1\r\n")
+	require.Equal(t, "admin", query.Username)
+	require.Equal(t, "10.0.0.1", query.Host)
+	require.True(t, query.Verbose)
+	require.Equal(t, "finger: forwarding service denied\r\n", fingerResponse(query, now))
+
+	listing := fingerResponse(parseFingerQuery("\r\n"), now)
+	require.Len(t, strings.Split(strings.TrimSpace(listing), "\r\n"), 3)
+	require.Contains(t, listing, "admin     admin             pts/1")
+
+	require.Contains(t, fingerResponse(parseFingerQuery("root\r\n"), now), "Directory: /root")
+	require.Equal(t, "finger: guest: no such user.\r\n", fingerResponse(parseFingerQuery("guest\r\n"), now))
+}
@@ -4,13 +4,13 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"strconv"
 	"strings"
 
 	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
 	"github.com/mushorg/glutton/producer"
 	"github.com/mushorg/glutton/protocols/helpers"
 	"github.com/mushorg/glutton/protocols/interfaces"
@@ -24,10 +24,11 @@ type parsedFTP struct {
 type ftpServer struct {
 	events []parsedFTP
 	conn   net.Conn
+	reader *bufio.Reader
 }
 
 func (s *ftpServer) read(_ interfaces.Logger, _ interfaces.Honeypot) (string, error) {
-	msg, err := bufio.NewReader(s.conn).ReadString('\n')
+	msg, err := s.reader.ReadString('\n')
 	if err != nil {
 		return msg, err
 	}
@@ -54,7 +55,8 @@ func (s *ftpServer) write(msg string) error {
 // HandleFTP takes a net.Conn and does basic FTP communication
 func HandleFTP(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
 	server := ftpServer{
-		conn: conn,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
 	}
 	defer func() {
 		if err := h.ProduceTCP("ftp", conn, md, helpers.FirstOrEmpty[parsedFTP](server.events).Payload, server.events); err != nil {
@@ -73,13 +75,14 @@ func HandleFTP(ctx context.Context, conn net.Conn, md connection.Metadata, logge
 	if _, err := conn.Write([]byte("220 Welcome!\r\n")); err != nil {
 		return err
 	}
+	username := ""
 	for {
 		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
 			logger.Debug("Failed to set connection timeout", slog.String("protocol", "ftp"), producer.ErrAttr(err))
 			return nil
 		}
 		msg, err := server.read(logger, h)
-		if err != nil || err != io.EOF {
+		if err != nil {
 			logger.Debug("Failed to read data", slog.String("protocol", "ftp"), producer.ErrAttr(err))
 			break
 		}
@@ -100,8 +103,10 @@ func HandleFTP(ctx context.Context, conn net.Conn, md connection.Metadata, logge
 		var resp string
 		switch cmd {
 		case "USER":
+			username = strings.TrimSpace(msg[4:])
 			resp = "331 OK.\r\n"
 		case "PASS":
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "ftp", Username: username, Password: strings.TrimSpace(msg[4:]), Success: true}, logger, h)
 			resp = "230 OK.\r\n"
 		default:
 			resp = "200 OK.\r\n"
@@ -0,0 +1,67 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// isolateBruteForce gives the test its own brute force tracker so the logins
+// of handler tests on 127.0.0.1 do not add up to a detection
+func isolateBruteForce(t *testing.T) *helpers.BruteForceTracker {
+	tracker := helpers.NewBruteForceTracker(5, time.Minute, time.Second, 10*time.Second)
+	previous := helpers.BruteForce
+	helpers.BruteForce = tracker
+	t.Cleanup(func() { helpers.BruteForce = previous })
+	return tracker
+}
+
+func TestHandleFTP(t *testing.T) {
+	tracker := isolateBruteForce(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("ftp", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("ftp payload received", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	done := make(chan error)
+	go func() {
+		done <- HandleFTP(context.Background(), server, connection.Metadata{TargetPort: 21}, l, h)
+	}()
+
+	reader := bufio.NewReader(client)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "220 Welcome!\r\n", line)
+	// both commands in one segment must be answered
+	_, err = client.Write([]byte("USER anonymous\r\nPASS guest@\r\n"))
+	require.NoError(t, err)
+	for _, want := range []string{"331 OK.\r\n", "230 OK.\r\n"} {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, want, line)
+	}
+	client.Close()
+	require.NoError(t, <-done)
+	// the login was accepted, so it is not counted as a failure
+	require.Zero(t, tracker.Failures("127.0.0.1"))
+}
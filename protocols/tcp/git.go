@@ -0,0 +1,182 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	gitAgent       = "git/2.39.2"
+	gitMaxPktLine  = 65520
+	gitMaxPktLines = 100
+)
+
+var gitCapabilities = map[string]string{
+	"git-upload-pack":  "multi_ack thin-pack side-band side-band-64k ofs-delta shallow deepen-since deepen-not deepen-relative no-progress include-tag multi_ack_detailed object-format=sha1 agent=" + gitAgent,
+	"git-receive-pack": "report-status report-status-v2 delete-refs quiet atomic ofs-delta object-format=sha1 agent=" + gitAgent,
+}
+
+type parsedGit struct {
+	Direction string `json:"direction,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	Line      string `json:"line,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// readPktLine reads a pkt-line. The special packets come back as nil,
+// flush tells whether it was a flush packet.
+func readPktLine(r io.Reader) (line []byte, flush bool, err error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, false, err
+	}
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid pkt-line length %q", header)
+	}
+	if length < 4 {
+		return nil, length == 0, nil
+	}
+	if length > gitMaxPktLine {
+		return nil, false, errors.New("pkt-line too long")
+	}
+	line = make([]byte, length-4)
+	if _, err := io.ReadFull(r, line); err != nil {
+		return nil, false, err
+	}
+	return line, false, nil
+}
+
+func appendPktLine(buf []byte, line string) []byte {
+	return append(fmt.Appendf(buf, "%04x", len(line)+4), line...)
+}
+
+// parseGitRequest reads the service, repository and extra parameters of
+// the request opening a git daemon connection
+func parseGitRequest(line []byte) (parsedGit, error) {
+	fields := bytes.Split(line, []byte{0})
+	service, path, ok := strings.Cut(string(fields[0]), " ")
+	if !ok || !strings.HasPrefix(service, "git-") {
+		return parsedGit{}, errors.New("invalid git daemon request")
+	}
+	req := parsedGit{Direction: "read", Service: service, Path: path, Payload: line}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(string(field), "=")
+		switch key {
+		case "host":
+			req.Host = value
+		case "version":
+			req.Version, _ = strconv.Atoi(value)
+		}
+	}
+	return req, nil
+}
+
+// gitAdvertisement announces an empty repository, which clients clone
+// without asking for anything
+func gitAdvertisement(req parsedGit) ([]byte, error) {
+	if req.Service == "git-upload-pack" && req.Version == 2 {
+		buf := []byte{}
+		for _, line := range []string{"version 2", "agent=" + gitAgent, "ls-refs=unborn", "fetch=shallow wait-for-done", "server-option", "object-format=sha1"} {
+			buf = appendPktLine(buf, line+"\n")
+		}
+		return append(buf, "0000"...), nil
+	}
+	capabilities, ok := gitCapabilities[req.Service]
+	if !ok {
+		return nil, fmt.Errorf("unsupported git service %q", req.Service)
+	}
+	buf := appendPktLine(nil, strings.Repeat("0", 40)+" capabilities^{}\x00"+capabilities+"\n")
+	return append(buf, "0000"...), nil
+}
+
+// HandleGit serves every repository requested from the git daemon as an
+// empty one, recording the paths and what clients send after the
+// advertisement
+func HandleGit(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedGit{}
+	defer func() {
+		if err := h.ProduceTCP("git", conn, md, helpers.FirstOrEmpty[parsedGit](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "git"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close git connection", slog.String("protocol", "git"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	line, _, err := readPktLine(conn)
+	if err != nil || line == nil {
+		logger.Debug("Failed to read git request", slog.String("protocol", "git"), producer.ErrAttr(err))
+		return nil
+	}
+	req, err := parseGitRequest(line)
+	if err != nil {
+		events = append(events, parsedGit{Direction: "read", Payload: line})
+		logger.Debug("Failed to parse git request", slog.String("protocol", "git"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, req)
+	logger.Info(
+		"git daemon request",
+		slog.String("handler", "git"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("service", req.Service),
+		slog.String("path", req.Path),
+		slog.String("host", req.Host),
+	)
+
+	resp, err := gitAdvertisement(req)
+	if err != nil {
+		resp = appendPktLine(nil, "ERR access denied or repository not exported: "+req.Path)
+	}
+	events = append(events, parsedGit{Direction: "write", Payload: resp})
+	if _, err := conn.Write(resp); err != nil {
+		return err
+	}
+
+	for range gitMaxPktLines {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		line, flush, err := readPktLine(conn)
+		if err != nil {
+			return nil
+		}
+		if line == nil {
+			// v2 commands like ls-refs are answered with no refs, v0
+			// clients are done after the empty advertisement
+			if flush && req.Version == 2 {
+				if _, err := conn.Write([]byte("0000")); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		events = append(events, parsedGit{Direction: "read", Line: strings.TrimSuffix(string(line), "\n")})
+	}
+	return nil
+}
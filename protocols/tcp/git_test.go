@@ -0,0 +1,39 @@
+package tcp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitRequest(t *testing.T) {
+	req := appendPktLine(nil, "git-upload-pack /srv/app.git\x00host=192.0.2.1:9418\x00\x00version=2\x00")
+	line, flush, err := readPktLine(bytes.NewReader(req))
+	require.NoError(t, err)
+	require.False(t, flush)
+	msg, err := parseGitRequest(line)
+	require.NoError(t, err)
+	require.Equal(t, "git-upload-pack", msg.Service)
+	require.Equal(t, "/srv/app.git", msg.Path)
+	require.Equal(t, "192.0.2.1:9418", msg.Host)
+	require.Equal(t, 2, msg.Version)
+
+	resp, err := gitAdvertisement(msg)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(resp, []byte("000eversion 2\n")))
+
+	msg.Version = 0
+	resp, err = gitAdvertisement(msg)
+	require.NoError(t, err)
+	line, _, err = readPktLine(bytes.NewReader(resp))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(line, []byte("0000000000000000000000000000000000000000 capabilities^{}\x00multi_ack ")))
+	require.True(t, bytes.HasSuffix(resp, []byte("0000")))
+
+	_, flush, err = readPktLine(bytes.NewReader([]byte("0000")))
+	require.NoError(t, err)
+	require.True(t, flush)
+	_, err = parseGitRequest([]byte("GET / HTTP/1.1"))
+	require.Error(t, err)
+}
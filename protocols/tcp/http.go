@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/mushorg/glutton/connection"
 	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
 	"github.com/mushorg/glutton/protocols/interfaces"
 )
 
@@ -45,6 +47,23 @@ func formatRequest(r *http.Request) string {
 	return strings.Join(request, "\n")
 }
 
+// sendHTTP writes a complete HTTP response with the given status, header and body
+func sendHTTP(conn net.Conn, status int, header http.Header, data []byte) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	if err := header.Write(buf); err != nil {
+		return err
+	}
+	buf.WriteString("\r\n")
+	buf.Write(data)
+	_, err := conn.Write(buf.Bytes())
+	return err
+}
+
 func sendJSON(data []byte, conn net.Conn) error {
 	_, err := conn.Write(append([]byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length:%d\r\n\r\n", len(data))), data...))
 	return err
@@ -108,11 +127,40 @@ Content-Type: text/plain; charset=UTF-8`
 	return err
 }
 
+// maxRecordedHead bounds the bytes of a request kept for its JA4H
+const maxRecordedHead = 16 << 10
+
+// headRecorder keeps the first bytes read through it, net/http does not
+// keep the order and case of the header names JA4H is made of
+type headRecorder struct {
+	r    io.Reader
+	head []byte
+}
+
+func (h *headRecorder) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if len(h.head) < maxRecordedHead {
+		h.head = append(h.head, p[:min(n, maxRecordedHead-len(h.head))]...)
+	}
+	return n, err
+}
+
 type decodedHTTP struct {
-	Method string `json:"method,omitempty"`
-	URL    string `json:"url,omitempty"`
-	Path   string `json:"path,omitempty"`
-	Query  string `json:"query,omitempty"`
+	Method string         `json:"method,omitempty"`
+	URL    string         `json:"url,omitempty"`
+	Path   string         `json:"path,omitempty"`
+	Query  string         `json:"query,omitempty"`
+	Job    *jobSubmission `json:"job,omitempty"`
+	// Container spec, pulled image or exec command sent to the Docker API
+	Container *dockerContainer `json:"container,omitempty"`
+	// Kubernetes API call along with the bearer token and submitted pod
+	Kubernetes *kubeRequest `json:"kubernetes,omitempty"`
+	// Elasticsearch index and bulk operations touched by the request
+	Elasticsearch *esRequest `json:"elasticsearch,omitempty"`
+	// etcd keys read or written by the request
+	Etcd *etcdRequest `json:"etcd,omitempty"`
+	// Callback of UPnP event subscriptions
+	Callback string `json:"callback,omitempty"`
 }
 
 // HandleHTTP takes a net.Conn and does basic HTTP communication
@@ -124,10 +172,16 @@ func HandleHTTP(ctx context.Context, conn net.Conn, md connection.Metadata, logg
 		}
 	}()
 
-	req, err := http.ReadRequest(bufio.NewReader(conn))
+	head := &headRecorder{r: conn}
+	reader := bufio.NewReader(head)
+	req, err := http.ReadRequest(reader)
 	if err != nil {
 		return fmt.Errorf("failed to read the HTTP request: %w", err)
 	}
+	if ja4h := helpers.JA4H(head.head); ja4h != "" {
+		md.Fingerprints = md.Fingerprints.Clone()
+		md.Fingerprints.JA4H = ja4h
+	}
 
 	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
 	if err != nil {
@@ -156,15 +210,107 @@ func HandleHTTP(ctx context.Context, conn net.Conn, md connection.Metadata, logg
 		logger.Info(fmt.Sprintf("HTTP payload:\n%s", hex.Dump(buf.Bytes()[:length%1024])))
 	}
 
+	tags := []string{}
+	if req.Method == http.MethodConnect {
+		tags = append(tags, "http_proxy")
+	}
+	if tag := dashboardProbeTag(req, buf.Bytes()); tag != "" {
+		tags = append(tags, tag)
+	}
+	job, tag, err := clusterSubmission(req, buf.Bytes())
+	if err != nil {
+		logger.Error("Failed to store the cluster job payload", producer.ErrAttr(err))
+	}
+	if tag != "" {
+		tags = append(tags, tag)
+	}
+	if tag := upnpTag(req); tag != "" {
+		tags = append(tags, tag)
+	}
+	container, tag := dockerRequest(req, buf.Bytes())
+	if tag != "" {
+		tags = append(tags, tag)
+	}
+	var kube *kubeRequest
+	if isKubernetesRequest(req, md.TargetPort) {
+		kube, tag = kubernetesRequest(req, buf.Bytes())
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	var es *esRequest
+	if isElasticsearchRequest(req, md.TargetPort) {
+		es, tag = elasticsearchRequest(req, buf.Bytes())
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+		if buf.Len() > 0 {
+			if es.PayloadHash, err = helpers.StorePayload(buf.Bytes()); err != nil {
+				logger.Error("Failed to store the Elasticsearch payload", producer.ErrAttr(err))
+			}
+		}
+	}
+	var etcd *etcdRequest
+	if isEtcdRequest(req, md.TargetPort) {
+		etcd, tag = parseEtcdRequest(req, buf.Bytes())
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	winrm := isWinRMRequest(req, md.TargetPort)
+	if winrm {
+		tags = append(tags, "winrm")
+	}
+	for _, tag := range tags {
+		logger.Info(
+			"HTTP exploit attempt",
+			slog.String("handler", "http"),
+			slog.String("tag", tag),
+			slog.String("uri", req.RequestURI),
+		)
+	}
+	md.Tags = append(md.Tags, tags...)
+
 	if err := h.ProduceTCP("http", conn, md, buf.Bytes(), decodedHTTP{
-		Method: req.Method,
-		URL:    req.URL.EscapedPath(),
-		Path:   req.URL.EscapedPath(),
-		Query:  req.URL.Query().Encode(),
+		Method:        req.Method,
+		URL:           req.URL.EscapedPath(),
+		Path:          req.URL.EscapedPath(),
+		Query:         req.URL.Query().Encode(),
+		Job:           job,
+		Container:     container,
+		Kubernetes:    kube,
+		Elasticsearch: es,
+		Etcd:          etcd,
+		Callback:      req.Header.Get("Callback"),
 	}); err != nil {
 		logger.Error("Failed to produce message", slog.String("protocol", "http"), producer.ErrAttr(err))
 	}
 
+	switch {
+	case req.Method == http.MethodConnect:
+		return handleConnect(ctx, conn, reader, req, md, logger, h)
+	case isGrafanaRequest(req):
+		return handleGrafana(conn, req)
+	case isKibanaRequest(req):
+		return handleKibana(conn, req)
+	case isSparkRequest(req, md.TargetPort):
+		return handleSpark(conn, req)
+	case isFlinkRequest(req):
+		return handleFlink(conn, req, job)
+	case isUPnPRequest(req):
+		return handleUPnP(conn, req)
+	case winrm:
+		return handleWinRM(ctx, conn, reader, req, buf.Bytes(), md, logger, h)
+	case isDockerRequest(req, md.TargetPort):
+		return handleDocker(conn, req, container)
+	case kube != nil:
+		return handleKubernetes(conn, req, kube, buf.Bytes())
+	case es != nil:
+		return handleElasticsearch(conn, req, es)
+	case etcd != nil:
+		return handleEtcd(conn, req, etcd)
+	}
+
 	switch req.Method {
 	case http.MethodPost:
 		return handlePOST(req, conn, buf, logger)
@@ -179,15 +325,6 @@ func HandleHTTP(ctx context.Context, conn net.Conn, md connection.Metadata, logg
 		return err
 	}
 
-	if strings.Contains(req.RequestURI, "/v1.16/version") {
-		data, err := res.ReadFile("resources/docker_api.json")
-		if err != nil {
-			return fmt.Errorf("failed to read embedded file: %w", err)
-		}
-		_, err = conn.Write(append([]byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length:%d\r\n\r\n", len(data))), data...))
-		return err
-	}
-
 	if strings.HasPrefix(req.RequestURI, "/vpn/") {
 		return smbHandler(conn, req)
 	}
@@ -0,0 +1,199 @@
+package tcp
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mushorg/glutton/protocols/helpers"
+)
+
+const (
+	sparkVersion = "2.4.3"
+	flinkVersion = "1.11.2"
+)
+
+// jobSubmission holds the application an attacker tried to run on a cluster
+type jobSubmission struct {
+	Resource    string   `json:"resource,omitempty"`
+	MainClass   string   `json:"main_class,omitempty"`
+	Arguments   []string `json:"arguments,omitempty"`
+	Filename    string   `json:"filename,omitempty"`
+	PayloadHash string   `json:"payload_hash,omitempty"`
+}
+
+type sparkSubmission struct {
+	Action          string            `json:"action"`
+	AppResource     string            `json:"appResource"`
+	MainClass       string            `json:"mainClass"`
+	AppArgs         []string          `json:"appArgs"`
+	SparkProperties map[string]string `json:"sparkProperties"`
+}
+
+type flinkRunRequest struct {
+	EntryClass      string   `json:"entryClass"`
+	ProgramArgs     string   `json:"programArgs"`
+	ProgramArgsList []string `json:"programArgsList"`
+}
+
+// isSparkRequest matches the REST submission server and the paths only the
+// master web UI serves, its index on 8080 is left to the other handlers as
+// many services share that port
+func isSparkRequest(req *http.Request, port uint16) bool {
+	return port == 6066 ||
+		req.URL.Path == "/v1/submissions" ||
+		strings.HasPrefix(req.URL.Path, "/v1/submissions/") ||
+		req.URL.Path == "/json" || req.URL.Path == "/json/" ||
+		(port == 8080 && req.URL.Path == "/app/" && req.URL.Query().Has("appId"))
+}
+
+func isFlinkRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, "/jars") ||
+		req.URL.Path == "/config" ||
+		req.URL.Path == "/overview"
+}
+
+// clusterSubmission extracts a Spark or Flink job submission from the request
+// and returns it along with its tag. The submitted payload is stored, an
+// error doing so is returned with the submission.
+func clusterSubmission(req *http.Request, body []byte) (*jobSubmission, string, error) {
+	if req.Method != http.MethodPost {
+		return nil, "", nil
+	}
+	switch {
+	case req.URL.Path == "/v1/submissions/create":
+		job := &jobSubmission{}
+		sub := sparkSubmission{}
+		if err := json.Unmarshal(body, &sub); err == nil {
+			job.Resource = cmp.Or(sub.AppResource, sub.SparkProperties["spark.jars"])
+			job.MainClass = sub.MainClass
+			job.Arguments = sub.AppArgs
+		}
+		var err error
+		job.PayloadHash, err = helpers.StorePayload(body)
+		return job, "spark_rce", err
+	case req.URL.Path == "/jars/upload":
+		job := &jobSubmission{}
+		filename, jar, err := multipartFile(req, body)
+		if err != nil {
+			return job, "flink_rce", nil
+		}
+		job.Filename = filename
+		job.PayloadHash, err = helpers.StorePayload(jar)
+		return job, "flink_rce", err
+	case strings.HasPrefix(req.URL.Path, "/jars/") && strings.HasSuffix(req.URL.Path, "/run"):
+		job := &jobSubmission{
+			Resource:  strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/jars/"), "/run"),
+			MainClass: req.URL.Query().Get("entry-class"),
+		}
+		if args := req.URL.Query().Get("program-args"); args != "" {
+			job.Arguments = strings.Fields(args)
+		}
+		run := flinkRunRequest{}
+		if err := json.Unmarshal(body, &run); err == nil {
+			if run.EntryClass != "" {
+				job.MainClass = run.EntryClass
+			}
+			if len(run.ProgramArgsList) > 0 {
+				job.Arguments = run.ProgramArgsList
+			} else if run.ProgramArgs != "" {
+				job.Arguments = strings.Fields(run.ProgramArgs)
+			}
+		}
+		return job, "flink_rce", nil
+	}
+	return nil, "", nil
+}
+
+// multipartFile returns the first file part of a multipart request body
+func multipartFile(req *http.Request, body []byte) (string, []byte, error) {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return "", nil, err
+	}
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			return "", nil, err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		data, err := io.ReadAll(part)
+		return part.FileName(), data, err
+	}
+}
+
+// handleSpark responds like a Spark standalone master and its REST submission server
+func handleSpark(conn net.Conn, req *http.Request) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json;charset=utf-8")
+	header.Set("Server", "Jetty(9.3.z-SNAPSHOT)")
+
+	switch {
+	case req.URL.Path == "/v1/submissions/create":
+		data := fmt.Sprintf(`{"action":"CreateSubmissionResponse","message":"Driver successfully submitted as driver-20240311101502-0004",`+
+			`"serverSparkVersion":"%s","submissionId":"driver-20240311101502-0004","success":true}`, sparkVersion)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	case strings.HasPrefix(req.URL.Path, "/v1/submissions/status/"):
+		id := strings.TrimPrefix(req.URL.Path, "/v1/submissions/status/")
+		data := fmt.Sprintf(`{"action":"SubmissionStatusResponse","driverState":"RUNNING","serverSparkVersion":"%s",`+
+			`"submissionId":"%s","success":true,"workerHostPort":"10.0.2.15:38153","workerId":"worker-20240311095911-10.0.2.15-38153"}`, sparkVersion, id)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	case req.URL.Path == "/json" || req.URL.Path == "/json/":
+		data := `{"url":"spark://spark-master:7077","workers":[{"id":"worker-20240311095911-10.0.2.15-38153","host":"10.0.2.15",` +
+			`"port":38153,"cores":8,"coresused":0,"memory":15006,"memoryused":0,"state":"ALIVE"}],"cores":8,"coresused":0,` +
+			`"memory":15006,"memoryused":0,"activeapps":[],"completedapps":[],"activedrivers":[],"status":"ALIVE"}`
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	case req.URL.Path == "/app/":
+		// unknown applications are shown the master page
+		header.Set("Content-Type", "text/html;charset=utf-8")
+		data := fmt.Sprintf(`<!DOCTYPE html><html><head><title>Spark Master at spark://spark-master:7077</title></head><body>`+
+			`<div class="container-fluid"><h3 style="vertical-align: middle; display: inline-block;">`+
+			`<span class="version" style="margin-right: 15px;">%s</span>Spark Master at spark://spark-master:7077</h3>`+
+			`<ul class="unstyled"><li><strong>URL:</strong> spark://spark-master:7077</li>`+
+			`<li><strong>REST URL:</strong> spark://spark-master:6066 <span class="rest-uri"> (cluster mode)</span></li>`+
+			`<li><strong>Alive Workers:</strong> 1</li><li><strong>Status:</strong> ALIVE</li></ul></div></body></html>`, sparkVersion)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	}
+	data := fmt.Sprintf(`{"action":"ErrorResponse","message":"Unknown protocol version 'v1'.","serverSparkVersion":"%s"}`, sparkVersion)
+	return sendHTTP(conn, http.StatusBadRequest, header, []byte(data))
+}
+
+// handleFlink responds like the Flink JobManager REST API
+func handleFlink(conn net.Conn, req *http.Request, job *jobSubmission) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=UTF-8")
+	header.Set("Access-Control-Allow-Origin", "*")
+
+	switch {
+	case req.URL.Path == "/jars/upload" && job != nil:
+		name := job.Filename
+		if name == "" {
+			name = "job.jar"
+		}
+		data := fmt.Sprintf(`{"filename":"/tmp/flink-web-4be3b6e4/flink-web-upload/2f6c1a24-0a3d-4b73-9c65-3c1b9d6b0c7e_%s","status":"success"}`, name)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	case strings.HasSuffix(req.URL.Path, "/run"):
+		return sendHTTP(conn, http.StatusOK, header, []byte(`{"jobid":"5b5d1c4ff2a1c6c0e1e5c0a2f1e1d2c3"}`))
+	case req.URL.Path == "/jars":
+		return sendHTTP(conn, http.StatusOK, header, []byte(`{"address":"http://localhost:8081","files":[]}`))
+	case req.URL.Path == "/config":
+		data := fmt.Sprintf(`{"refresh-interval":3000,"timezone-name":"Coordinated Universal Time","timezone-offset":0,`+
+			`"flink-version":"%s","flink-revision":"fe36135 @ 2020-09-09T16:19:03+02:00","features":{"web-submit":true}}`, flinkVersion)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	case req.URL.Path == "/overview":
+		data := fmt.Sprintf(`{"taskmanagers":1,"slots-total":1,"slots-available":1,"jobs-running":0,"jobs-finished":0,`+
+			`"jobs-cancelled":0,"jobs-failed":0,"flink-version":"%s","flink-commit":"fe36135"}`, flinkVersion)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	}
+	return sendHTTP(conn, http.StatusNotFound, header, []byte(`{"errors":["Not found."]}`))
+}
@@ -0,0 +1,117 @@
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	grafanaVersion = "8.2.6"
+	kibanaVersion  = "6.5.4"
+)
+
+// unescapedURI returns the raw request URI with percent-encoding removed so
+// encoded traversal sequences are visible
+func unescapedURI(req *http.Request) string {
+	uri, err := url.PathUnescape(req.RequestURI)
+	if err != nil {
+		return req.RequestURI
+	}
+	return uri
+}
+
+// dashboardProbeTag returns the tag of the exploit family a Grafana or Kibana
+// request belongs to, or an empty string for regular requests
+func dashboardProbeTag(req *http.Request, body []byte) string {
+	uri := unescapedURI(req)
+	switch {
+	// CVE-2021-43798
+	case strings.HasPrefix(uri, "/public/plugins/") && strings.Contains(uri, ".."):
+		return "grafana_lfi"
+	// CVE-2018-17246
+	case strings.HasPrefix(uri, "/api/console/api_server") && strings.Contains(uri, ".."):
+		return "kibana_lfi"
+	// CVE-2019-7609
+	case strings.HasPrefix(uri, "/api/timelion/run") && strings.Contains(string(body), "__proto__"):
+		return "kibana_rce"
+	}
+	return ""
+}
+
+func isGrafanaRequest(req *http.Request) bool {
+	return req.URL.Path == "/login" ||
+		req.URL.Path == "/api/health" ||
+		strings.HasPrefix(req.RequestURI, "/public/plugins/")
+}
+
+func isKibanaRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, "/app/kibana") ||
+		req.URL.Path == "/api/status" ||
+		strings.HasPrefix(req.URL.Path, "/api/console/") ||
+		strings.HasPrefix(req.URL.Path, "/api/timelion/")
+}
+
+// handleGrafana responds like a Grafana instance vulnerable to CVE-2021-43798
+func handleGrafana(conn net.Conn, req *http.Request) error {
+	header := http.Header{}
+	header.Set("X-Frame-Options", "deny")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("X-Xss-Protection", "1; mode=block")
+
+	switch {
+	case req.URL.Path == "/api/health":
+		header.Set("Content-Type", "application/json")
+		data := fmt.Sprintf(`{"commit":"3a7a0c5b4","database":"ok","version":"%s"}`, grafanaVersion)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	case req.URL.Path == "/login":
+		header.Set("Content-Type", "text/html; charset=UTF-8")
+		data := fmt.Sprintf(`<!DOCTYPE html><html lang="en"><head><meta charset="utf-8"><title>Grafana</title>`+
+			`<base href="/" /><link rel="icon" type="image/png" href="public/img/fav32.png"></head>`+
+			`<body class="theme-dark app-grafana"><grafana-app class="grafana-app"></grafana-app>`+
+			`<script>window.grafanaBootData = {"settings":{"buildInfo":{"version":"%s"}}};</script></body></html>`, grafanaVersion)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	}
+
+	uri := unescapedURI(req)
+	if strings.HasSuffix(uri, "/etc/passwd") {
+		data, err := res.ReadFile("resources/passwd")
+		if err != nil {
+			return fmt.Errorf("failed to read embedded file: %w", err)
+		}
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		return sendHTTP(conn, http.StatusOK, header, data)
+	}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	return sendHTTP(conn, http.StatusNotFound, header, []byte("Plugin file not found"))
+}
+
+// handleKibana responds like a Kibana instance vulnerable to CVE-2019-7609
+func handleKibana(conn net.Conn, req *http.Request) error {
+	header := http.Header{}
+	header.Set("kbn-name", "kibana")
+	header.Set("kbn-version", kibanaVersion)
+	header.Set("Cache-Control", "no-cache")
+
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/app/kibana"):
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		data := fmt.Sprintf(`<!DOCTYPE html><html lang="en"><head><meta charset="utf-8"><title>Kibana</title></head>`+
+			`<body><kbn-injected-metadata data="{&quot;version&quot;:&quot;%s&quot;,&quot;buildNumber&quot;:18787}">`+
+			`</kbn-injected-metadata><div class="kibanaWelcomeView" id="kbn_loading_message"></div></body></html>`, kibanaVersion)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	case req.URL.Path == "/api/status":
+		header.Set("Content-Type", "application/json; charset=utf-8")
+		data := fmt.Sprintf(`{"name":"kibana","uuid":"5b2de169-2785-441b-ae8c-186a1936b17d",`+
+			`"version":{"number":"%s","build_hash":"6e4f4d2b0c9dd1e0f6dcbdaa1a4b5fc4ba04a3c4","build_number":18787,"build_snapshot":false},`+
+			`"status":{"overall":{"state":"green","title":"Green","nickname":"Looking good","icon":"success"}}}`, kibanaVersion)
+		return sendHTTP(conn, http.StatusOK, header, []byte(data))
+	case strings.HasPrefix(req.URL.Path, "/api/timelion/"):
+		header.Set("Content-Type", "application/json; charset=utf-8")
+		return sendHTTP(conn, http.StatusOK, header, []byte(`{"sheet":[{"list":[],"type":"seriesList"}],"stats":{"invokeTime":1,"queryCount":0}}`))
+	}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	return sendHTTP(conn, http.StatusOK, header, []byte("{}"))
+}
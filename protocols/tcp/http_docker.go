@@ -0,0 +1,217 @@
+package tcp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dockerVersionPrefix matches the API version clients put in front of paths
+var dockerVersionPrefix = regexp.MustCompile(`^/v1\.\d+`)
+
+// dockerContainer is the container spec submitted by a client, along with the
+// image it pulled or the command it tried to exec
+type dockerContainer struct {
+	Image      string   `json:"image,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Cmd        []string `json:"cmd,omitempty"`
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Env        []string `json:"env,omitempty"`
+	Binds      []string `json:"binds,omitempty"`
+	Privileged bool     `json:"privileged,omitempty"`
+	PidMode    string   `json:"pid_mode,omitempty"`
+	Network    string   `json:"network_mode,omitempty"`
+}
+
+// dockerStrings accepts the string or list forms of Cmd and Entrypoint
+type dockerStrings []string
+
+func (s *dockerStrings) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = dockerStrings{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+func dockerPath(req *http.Request) string {
+	return dockerVersionPrefix.ReplaceAllString(req.URL.Path, "")
+}
+
+func isDockerRequest(req *http.Request, port uint16) bool {
+	if port == 2375 || port == 2376 {
+		return true
+	}
+	if dockerVersionPrefix.MatchString(req.URL.Path) {
+		return true
+	}
+	path := dockerPath(req)
+	return path == "/_ping" || strings.HasPrefix(path, "/containers/") || strings.HasPrefix(path, "/images/")
+}
+
+// dockerRequest extracts the container spec, pulled image or exec command and
+// returns it along with its tag
+func dockerRequest(req *http.Request, body []byte) (*dockerContainer, string) {
+	if req.Method != http.MethodPost {
+		return nil, ""
+	}
+	path := dockerPath(req)
+	switch {
+	case path == "/containers/create":
+		spec := struct {
+			Image      string
+			Cmd        dockerStrings
+			Entrypoint dockerStrings
+			Env        []string
+			HostConfig struct {
+				Binds       []string
+				Privileged  bool
+				PidMode     string
+				NetworkMode string
+			}
+		}{}
+		if err := json.Unmarshal(body, &spec); err != nil {
+			return nil, ""
+		}
+		container := &dockerContainer{
+			Image:      spec.Image,
+			Name:       req.URL.Query().Get("name"),
+			Cmd:        spec.Cmd,
+			Entrypoint: spec.Entrypoint,
+			Env:        spec.Env,
+			Binds:      spec.HostConfig.Binds,
+			Privileged: spec.HostConfig.Privileged,
+			PidMode:    spec.HostConfig.PidMode,
+			Network:    spec.HostConfig.NetworkMode,
+		}
+		hostRoot := slices.ContainsFunc(container.Binds, func(bind string) bool {
+			return strings.HasPrefix(bind, "/:")
+		})
+		if container.Privileged || container.PidMode == "host" || hostRoot {
+			return container, "docker_escape"
+		}
+		return container, "docker_create"
+	case path == "/images/create":
+		image := req.URL.Query().Get("fromImage")
+		if tag := req.URL.Query().Get("tag"); tag != "" {
+			image += ":" + tag
+		}
+		return &dockerContainer{Image: image}, "docker_pull"
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/exec"):
+		spec := struct{ Cmd dockerStrings }{}
+		if err := json.Unmarshal(body, &spec); err != nil {
+			return nil, ""
+		}
+		return &dockerContainer{Cmd: spec.Cmd}, "docker_exec"
+	}
+	return nil, ""
+}
+
+func dockerID() string {
+	id := make([]byte, 32)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// handleDocker responds like a Docker daemon exposing its API without TLS
+func handleDocker(conn net.Conn, req *http.Request, container *dockerContainer) error {
+	header := http.Header{}
+	header.Set("Api-Version", "1.41")
+	header.Set("Docker-Experimental", "false")
+	header.Set("Ostype", "linux")
+	header.Set("Server", "Docker/20.10.9 (linux)")
+	header.Set("Content-Type", "application/json")
+
+	reply := func(status int, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return sendHTTP(conn, status, header, append(data, '\n'))
+	}
+
+	path := dockerPath(req)
+	switch {
+	case path == "/_ping":
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		return sendHTTP(conn, http.StatusOK, header, []byte("OK"))
+	case path == "/version":
+		data, err := res.ReadFile("resources/docker_api.json")
+		if err != nil {
+			return fmt.Errorf("failed to read embedded file: %w", err)
+		}
+		return sendHTTP(conn, http.StatusOK, header, data)
+	case path == "/info":
+		return reply(http.StatusOK, map[string]any{
+			"ID":                "7TRN:IPZB:QYBB:VPBQ:UWYJ:KHTK:TGDC:ZDKB:JC6E:Z2FD:KNRU:3JLZ",
+			"Containers":        1,
+			"ContainersRunning": 1,
+			"Images":            3,
+			"Driver":            "overlay2",
+			"KernelVersion":     "5.14.10-1-amd64",
+			"OperatingSystem":   "Debian GNU/Linux 11 (bullseye)",
+			"OSType":            "linux",
+			"Architecture":      "x86_64",
+			"NCPU":              8,
+			"MemTotal":          33564790784,
+			"Name":              "docker-host",
+			"ServerVersion":     "20.10.9",
+			"DockerRootDir":     "/var/lib/docker",
+		})
+	case path == "/containers/json":
+		return reply(http.StatusOK, []map[string]any{{
+			"Id":      "8dfafdbc3a40d2a3a2e8b2f1b9a93c7f3e52f5e83b8c3fbe7ea7e3a1f4f2d1c6",
+			"Names":   []string{"/web"},
+			"Image":   "nginx:1.21",
+			"ImageID": "sha256:87a94228f133e2da99cb16d653cd1373c5b4e8689956386c1c12b60a20421a02",
+			"Command": "/docker-entrypoint.sh nginx -g 'daemon off;'",
+			"Created": time.Now().Add(-41 * 24 * time.Hour).Unix(),
+			"State":   "running",
+			"Status":  "Up 5 weeks",
+			"Ports":   []map[string]any{{"IP": "0.0.0.0", "PrivatePort": 80, "PublicPort": 80, "Type": "tcp"}},
+		}})
+	case path == "/images/json":
+		return reply(http.StatusOK, []map[string]any{{
+			"Id":       "sha256:87a94228f133e2da99cb16d653cd1373c5b4e8689956386c1c12b60a20421a02",
+			"RepoTags": []string{"nginx:1.21"},
+			"Created":  1634000000,
+			"Size":     133249757,
+		}})
+	case path == "/images/create":
+		image := "library/alpine"
+		if container != nil && container.Image != "" {
+			image = container.Image
+		}
+		status := fmt.Sprintf("{\"status\":\"Pulling from %s\",\"id\":\"latest\"}\n"+
+			"{\"status\":\"Digest: sha256:%s\"}\n"+
+			"{\"status\":\"Status: Downloaded newer image for %s\"}\n", image, dockerID(), image)
+		return sendHTTP(conn, http.StatusOK, header, []byte(status))
+	case path == "/containers/create":
+		return reply(http.StatusCreated, map[string]any{"Id": dockerID(), "Warnings": []string{}})
+	case strings.HasSuffix(path, "/exec"):
+		return reply(http.StatusCreated, map[string]string{"Id": dockerID()})
+	case strings.HasSuffix(path, "/wait"):
+		return reply(http.StatusOK, map[string]any{"StatusCode": 0})
+	case strings.HasSuffix(path, "/start"), strings.HasSuffix(path, "/stop"), strings.HasSuffix(path, "/kill"),
+		req.Method == http.MethodDelete:
+		header.Del("Content-Type")
+		return sendHTTP(conn, http.StatusNoContent, header, nil)
+	case strings.HasSuffix(path, "/logs"), strings.HasSuffix(path, "/attach"):
+		header.Set("Content-Type", "application/vnd.docker.raw-stream")
+		return sendHTTP(conn, http.StatusOK, header, nil)
+	}
+	return reply(http.StatusNotFound, map[string]string{"message": "page not found"})
+}
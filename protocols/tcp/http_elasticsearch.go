@@ -0,0 +1,257 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const esVersion = "7.10.2"
+
+// esIndices are listed by _cat/indices and searched by _search
+var esIndices = []struct {
+	name string
+	docs int
+	size string
+}{
+	{"customers", 184223, "96.1mb"},
+	{"orders", 1023311, "412.7mb"},
+	{"logs-2024.03", 5312877, "2.1gb"},
+}
+
+// esRequest holds what an Elasticsearch request did to the cluster
+type esRequest struct {
+	Index       string     `json:"index,omitempty"`
+	Endpoint    string     `json:"endpoint,omitempty"`
+	Bulk        []esBulkOp `json:"bulk,omitempty"`
+	PayloadHash string     `json:"payload_hash,omitempty"`
+}
+
+type esBulkOp struct {
+	Action string `json:"action"`
+	Index  string `json:"index,omitempty"`
+	ID     string `json:"id,omitempty"`
+}
+
+// esEndpoints are the path segments that identify Elasticsearch requests on
+// ports other than 9200
+var esEndpoints = []string{"_search", "_bulk", "_cat", "_cluster", "_nodes", "_mapping", "_doc", "_all", "_stats", "_aliases"}
+
+func isElasticsearchRequest(req *http.Request, port uint16) bool {
+	if port == 9200 {
+		return true
+	}
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		for _, endpoint := range esEndpoints {
+			if segment == endpoint {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseBulk reads the action lines of a newline delimited bulk body, the
+// document lines following index, create and update actions are skipped
+func parseBulk(body []byte, index string) []esBulkOp {
+	ops := []esBulkOp{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64<<10), len(body)+1)
+	skip := false
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if skip {
+			skip = false
+			continue
+		}
+		action := map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}{}
+		if err := json.Unmarshal(line, &action); err != nil {
+			continue
+		}
+		for name, meta := range action {
+			op := esBulkOp{Action: name, Index: meta.Index, ID: meta.ID}
+			if op.Index == "" {
+				op.Index = index
+			}
+			ops = append(ops, op)
+			skip = name != "delete"
+		}
+	}
+	return ops
+}
+
+// elasticsearchRequest decodes an Elasticsearch request and returns it along
+// with its tag: index deletion used by ransom campaigns and scripted
+// searches used by the Groovy and MVEL RCEs
+func elasticsearchRequest(req *http.Request, body []byte) (*esRequest, string) {
+	es := &esRequest{}
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if segments[0] != "" && !strings.HasPrefix(segments[0], "_") {
+		es.Index = segments[0]
+		segments = segments[1:]
+	}
+	if len(segments) > 0 {
+		es.Endpoint = segments[0]
+	}
+
+	switch {
+	case es.Endpoint == "_bulk":
+		es.Bulk = parseBulk(body, es.Index)
+		for _, op := range es.Bulk {
+			if op.Action == "delete" {
+				return es, "elasticsearch_delete"
+			}
+		}
+	case req.Method == http.MethodDelete && (es.Index != "" && es.Endpoint == "" || es.Endpoint == "_all"):
+		return es, "elasticsearch_delete"
+	case es.Endpoint == "_search" && (bytes.Contains(body, []byte("script_fields")) || bytes.Contains(body, []byte(`"script"`))):
+		return es, "elasticsearch_rce"
+	}
+	return es, ""
+}
+
+func esHits(index string) []map[string]any {
+	hits := []map[string]any{}
+	for i, name := range []string{"jsmith", "mgarcia", "lchen"} {
+		hits = append(hits, map[string]any{
+			"_index": index,
+			"_type":  "_doc",
+			"_id":    fmt.Sprintf("%d", 1000+i),
+			"_score": 1.0,
+			"_source": map[string]any{
+				"username": name,
+				"email":    name + "@example.com",
+				"created":  fmt.Sprintf("2023-10-26T09:%02d:00Z", i*7),
+			},
+		})
+	}
+	return hits
+}
+
+// handleElasticsearch responds like an open Elasticsearch 7 node
+func handleElasticsearch(conn net.Conn, req *http.Request, es *esRequest) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	reply := func(status int, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return sendHTTP(conn, status, header, data)
+	}
+
+	switch {
+	case es.Index == "" && es.Endpoint == "":
+		return reply(http.StatusOK, map[string]any{
+			"name":         "es-node-01",
+			"cluster_name": "elasticsearch",
+			"cluster_uuid": "kPj3Qx1TQ2aGmYwR9f5dLw",
+			"version": map[string]any{
+				"number":                              esVersion,
+				"build_flavor":                        "default",
+				"build_type":                          "deb",
+				"build_hash":                          "747e1cc71def077253878a59143c1f785afa92b9",
+				"build_date":                          "2021-01-13T00:42:12.435326Z",
+				"build_snapshot":                      false,
+				"lucene_version":                      "8.7.0",
+				"minimum_wire_compatibility_version":  "6.8.0",
+				"minimum_index_compatibility_version": "6.0.0-beta1",
+			},
+			"tagline": "You Know, for Search",
+		})
+	case es.Endpoint == "_cat":
+		if req.URL.Query().Get("format") == "json" {
+			indices := []map[string]string{}
+			for _, index := range esIndices {
+				indices = append(indices, map[string]string{
+					"health": "yellow", "status": "open", "index": index.name,
+					"docs.count": fmt.Sprint(index.docs), "store.size": index.size,
+				})
+			}
+			return reply(http.StatusOK, indices)
+		}
+		header.Set("Content-Type", "text/plain; charset=UTF-8")
+		table := &bytes.Buffer{}
+		if req.URL.Query().Has("v") {
+			fmt.Fprintf(table, "%-6s %-6s %-14s %-22s %3s %3s %10s %12s %10s %14s\n",
+				"health", "status", "index", "uuid", "pri", "rep", "docs.count", "docs.deleted", "store.size", "pri.store.size")
+		}
+		for _, index := range esIndices {
+			fmt.Fprintf(table, "%-6s %-6s %-14s %-22s %3d %3d %10d %12d %10s %14s\n",
+				"yellow", "open", index.name, "Zq0mC4xKRwqk8m3u7lJb2g", 1, 1, index.docs, 0, index.size, index.size)
+		}
+		return sendHTTP(conn, http.StatusOK, header, table.Bytes())
+	case es.Endpoint == "_search":
+		index := es.Index
+		if index == "" {
+			index = esIndices[0].name
+		}
+		hits := esHits(index)
+		return reply(http.StatusOK, map[string]any{
+			"took":      3,
+			"timed_out": false,
+			"_shards":   map[string]int{"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+			"hits": map[string]any{
+				"total":     map[string]any{"value": len(hits), "relation": "eq"},
+				"max_score": 1.0,
+				"hits":      hits,
+			},
+		})
+	case es.Endpoint == "_bulk":
+		items := []map[string]any{}
+		for i, op := range es.Bulk {
+			result, status := "created", http.StatusCreated
+			if op.Action == "delete" {
+				result, status = "deleted", http.StatusOK
+			}
+			id := op.ID
+			if id == "" {
+				id = fmt.Sprintf("bE7m%08d", i)
+			}
+			items = append(items, map[string]any{op.Action: map[string]any{
+				"_index": op.Index, "_type": "_doc", "_id": id, "_version": 1,
+				"result": result, "status": status,
+			}})
+		}
+		return reply(http.StatusOK, map[string]any{"took": 30, "errors": false, "items": items})
+	case es.Endpoint == "_cluster":
+		return reply(http.StatusOK, map[string]any{
+			"cluster_name": "elasticsearch", "status": "yellow", "timed_out": false,
+			"number_of_nodes": 1, "number_of_data_nodes": 1, "active_primary_shards": len(esIndices),
+			"active_shards": len(esIndices), "unassigned_shards": len(esIndices),
+		})
+	case es.Endpoint == "_doc" || es.Endpoint == "_create":
+		return reply(http.StatusCreated, map[string]any{
+			"_index": es.Index, "_type": "_doc", "_id": "bE7m00000001", "_version": 1, "result": "created",
+			"_shards": map[string]int{"total": 2, "successful": 1, "failed": 0},
+		})
+	case req.Method == http.MethodDelete:
+		return reply(http.StatusOK, map[string]bool{"acknowledged": true})
+	case req.Method == http.MethodPut && es.Index != "" && es.Endpoint == "":
+		return reply(http.StatusOK, map[string]any{"acknowledged": true, "shards_acknowledged": true, "index": es.Index})
+	case es.Index != "" && es.Endpoint == "":
+		return reply(http.StatusOK, map[string]any{es.Index: map[string]any{
+			"aliases":  map[string]any{},
+			"mappings": map[string]any{},
+			"settings": map[string]any{"index": map[string]string{"number_of_shards": "1", "number_of_replicas": "1"}},
+		}})
+	}
+	return reply(http.StatusBadRequest, map[string]any{
+		"error": map[string]any{
+			"type":   "illegal_argument_exception",
+			"reason": fmt.Sprintf("request [%s] contains unrecognized parameter", req.URL.Path),
+		},
+		"status": http.StatusBadRequest,
+	})
+}
@@ -0,0 +1,291 @@
+package tcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// kubeRequest is the API call a client made against the apiserver persona
+type kubeRequest struct {
+	Namespace string   `json:"namespace,omitempty"`
+	Resource  string   `json:"resource,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Token     string   `json:"token,omitempty"`
+	Subject   string   `json:"subject,omitempty"`
+	Pod       *kubePod `json:"pod,omitempty"`
+}
+
+// kubePod summarizes a submitted pod spec, the full spec is the event payload
+type kubePod struct {
+	Name        string     `json:"name,omitempty"`
+	Images      []string   `json:"images,omitempty"`
+	Commands    [][]string `json:"commands,omitempty"`
+	Privileged  bool       `json:"privileged,omitempty"`
+	HostPID     bool       `json:"host_pid,omitempty"`
+	HostNetwork bool       `json:"host_network,omitempty"`
+	HostPaths   []string   `json:"host_paths,omitempty"`
+}
+
+func isKubernetesRequest(req *http.Request, port uint16) bool {
+	return port == 6443 ||
+		strings.HasPrefix(req.URL.Path, "/api/v1") ||
+		strings.HasPrefix(req.URL.Path, "/apis/") ||
+		strings.HasPrefix(req.URL.Path, "/openapi/")
+}
+
+// kubeSubject reads the subject of a service account JWT without verifying it
+func kubeSubject(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+	subject := struct {
+		Sub string `json:"sub"`
+	}{}
+	if err := json.Unmarshal(claims, &subject); err != nil {
+		return ""
+	}
+	return subject.Sub
+}
+
+func parsePod(body []byte) *kubePod {
+	type container struct {
+		Image           string
+		Command         []string
+		Args            []string
+		SecurityContext struct {
+			Privileged bool
+		}
+	}
+	spec := struct {
+		Metadata struct {
+			Name string
+		}
+		Spec struct {
+			HostPID        bool
+			HostNetwork    bool
+			Containers     []container
+			InitContainers []container
+			Volumes        []struct {
+				HostPath *struct {
+					Path string
+				}
+			}
+		}
+	}{}
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return nil
+	}
+	pod := &kubePod{
+		Name:        spec.Metadata.Name,
+		HostPID:     spec.Spec.HostPID,
+		HostNetwork: spec.Spec.HostNetwork,
+	}
+	for _, c := range append(spec.Spec.InitContainers, spec.Spec.Containers...) {
+		pod.Images = append(pod.Images, c.Image)
+		pod.Commands = append(pod.Commands, append(c.Command, c.Args...))
+		pod.Privileged = pod.Privileged || c.SecurityContext.Privileged
+	}
+	for _, volume := range spec.Spec.Volumes {
+		if volume.HostPath != nil {
+			pod.HostPaths = append(pod.HostPaths, volume.HostPath.Path)
+		}
+	}
+	return pod
+}
+
+// kubernetesRequest decodes the API path, bearer token and any submitted pod
+// and returns them along with the tag of the request
+func kubernetesRequest(req *http.Request, body []byte) (*kubeRequest, string) {
+	kr := &kubeRequest{}
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+		kr.Token = token
+		kr.Subject = kubeSubject(token)
+	}
+
+	// /api/v1/... or /apis/<group>/<version>/...
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		segments = segments[3:]
+	default:
+		segments = nil
+	}
+	if len(segments) >= 2 && segments[0] == "namespaces" {
+		kr.Namespace = segments[1]
+		segments = segments[2:]
+		if len(segments) == 0 {
+			kr.Resource = "namespaces"
+			kr.Name = kr.Namespace
+		}
+	}
+	if len(segments) > 0 {
+		kr.Resource = segments[0]
+	}
+	if len(segments) > 1 {
+		kr.Name = segments[1]
+	}
+	if len(segments) > 2 {
+		kr.Resource += "/" + segments[2]
+	}
+
+	switch {
+	case req.Method == http.MethodPost && kr.Resource == "pods":
+		kr.Pod = parsePod(body)
+		if kr.Pod != nil && (kr.Pod.Privileged || kr.Pod.HostPID || kr.Pod.HostNetwork || len(kr.Pod.HostPaths) > 0) {
+			return kr, "kubernetes_escape"
+		}
+		return kr, "kubernetes_pod_create"
+	case kr.Resource == "pods/exec":
+		return kr, "kubernetes_exec"
+	case kr.Resource == "secrets":
+		return kr, "kubernetes_secrets"
+	}
+	return kr, ""
+}
+
+func kubeStatus(code int, reason, message string) map[string]any {
+	return map[string]any{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   map[string]any{},
+		"status":     "Failure",
+		"message":    message,
+		"reason":     reason,
+		"code":       code,
+	}
+}
+
+// handleKubernetes responds like a kube-apiserver with anonymous auth
+// enabled. Anonymous clients only get public info, requests with any bearer
+// token are accepted so the follow-up calls are captured too.
+func handleKubernetes(conn net.Conn, req *http.Request, kr *kubeRequest, body []byte) error {
+	header := http.Header{}
+	header.Set("Cache-Control", "no-cache, private")
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Kubernetes-Pf-Flowschema-Uid", "3c9d6f0e-7e4b-4d8a-9b67-2bb2a4e9a3f1")
+	header.Set("X-Kubernetes-Pf-Prioritylevel-Uid", "7a1b0a5e-5b2e-4d52-8f4a-0b4e8c3d1f22")
+
+	reply := func(status int, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return sendHTTP(conn, status, header, data)
+	}
+
+	switch req.URL.Path {
+	case "/version":
+		return reply(http.StatusOK, map[string]string{
+			"major":        "1",
+			"minor":        "21",
+			"gitVersion":   "v1.21.14",
+			"gitCommit":    "0f77da5bd4809927e15d1658fb4aa8f13ad890a5",
+			"gitTreeState": "clean",
+			"buildDate":    "2022-06-15T14:11:36Z",
+			"goVersion":    "go1.16.15",
+			"compiler":     "gc",
+			"platform":     "linux/amd64",
+		})
+	case "/healthz", "/livez", "/readyz":
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		return sendHTTP(conn, http.StatusOK, header, []byte("ok"))
+	case "/api":
+		return reply(http.StatusOK, map[string]any{
+			"kind":     "APIVersions",
+			"versions": []string{"v1"},
+			"serverAddressByClientCIDRs": []map[string]string{
+				{"clientCIDR": "0.0.0.0/0", "serverAddress": "10.0.0.10:6443"},
+			},
+		})
+	}
+
+	if kr.Token == "" {
+		if kr.Resource == "" {
+			return reply(http.StatusForbidden, kubeStatus(http.StatusForbidden, "Forbidden",
+				fmt.Sprintf("forbidden: User \"system:anonymous\" cannot get path \"%s\"", req.URL.Path)))
+		}
+		verb := map[string]string{http.MethodPost: "create", http.MethodPut: "update", http.MethodDelete: "delete", http.MethodPatch: "patch"}[req.Method]
+		if verb == "" {
+			verb = "list"
+			if kr.Name != "" {
+				verb = "get"
+			}
+		}
+		scope := "at the cluster scope"
+		if kr.Namespace != "" {
+			scope = fmt.Sprintf("in the namespace \"%s\"", kr.Namespace)
+		}
+		resource, _, _ := strings.Cut(kr.Resource, "/")
+		message := fmt.Sprintf("%s is forbidden: User \"system:anonymous\" cannot %s resource \"%s\" in API group \"\" %s", resource, verb, resource, scope)
+		status := kubeStatus(http.StatusForbidden, "Forbidden", message)
+		status["details"] = map[string]string{"kind": resource}
+		return reply(http.StatusForbidden, status)
+	}
+
+	switch {
+	case req.Method == http.MethodPost:
+		object := map[string]any{}
+		if err := json.Unmarshal(body, &object); err != nil {
+			return reply(http.StatusBadRequest, kubeStatus(http.StatusBadRequest, "BadRequest", "the object provided is unrecognized"))
+		}
+		metadata, _ := object["metadata"].(map[string]any)
+		if metadata == nil {
+			metadata = map[string]any{}
+			object["metadata"] = metadata
+		}
+		if kr.Namespace != "" {
+			metadata["namespace"] = kr.Namespace
+		}
+		metadata["uid"] = "5f0c7a9e-2b8d-4c1f-a6e3-9d4b7e2a1c08"
+		metadata["resourceVersion"] = "4182551"
+		metadata["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+		return reply(http.StatusCreated, object)
+	case req.Method == http.MethodDelete:
+		return reply(http.StatusOK, map[string]any{"kind": "Status", "apiVersion": "v1", "metadata": map[string]any{}, "status": "Success"})
+	case kr.Name != "":
+		resource, _, _ := strings.Cut(kr.Resource, "/")
+		return reply(http.StatusNotFound, kubeStatus(http.StatusNotFound, "NotFound",
+			fmt.Sprintf("%s \"%s\" not found", resource, kr.Name)))
+	}
+
+	items := []map[string]any{}
+	switch kr.Resource {
+	case "namespaces":
+		for _, name := range []string{"default", "kube-system", "kube-public", "monitoring"} {
+			items = append(items, map[string]any{
+				"metadata": map[string]any{"name": name},
+				"status":   map[string]string{"phase": "Active"},
+			})
+		}
+	case "pods":
+		items = append(items, map[string]any{
+			"metadata": map[string]any{"name": "web-6d4cf56db6-x2kqp", "namespace": "default"},
+			"spec": map[string]any{"containers": []map[string]any{
+				{"name": "web", "image": "nginx:1.21"},
+			}},
+			"status": map[string]string{"phase": "Running", "podIP": "10.244.0.12"},
+		})
+	}
+	kind := "List"
+	if kr.Resource != "" {
+		kind = strings.ToUpper(kr.Resource[:1]) + strings.TrimSuffix(kr.Resource[1:], "s") + "List"
+	}
+	return reply(http.StatusOK, map[string]any{
+		"kind":       kind,
+		"apiVersion": "v1",
+		"metadata":   map[string]string{"resourceVersion": "4182550"},
+		"items":      items,
+	})
+}
@@ -0,0 +1,127 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	proxyMaxTunnel   = 4096
+	proxyMaxRelay    = 1 << 20
+	proxyDialTimeout = 5 * time.Second
+	proxyTarpitReads = 100
+)
+
+// proxyTunnel is the data a client sent through a CONNECT tunnel
+type proxyTunnel struct {
+	Destination string `json:"destination"`
+	Mode        string `json:"mode"`
+	Relayed     bool   `json:"relayed,omitempty"`
+}
+
+// proxyAllowed reports whether destination, a host:port pair, matches an
+// entry of the relay allowlist given either as host or as host:port
+func proxyAllowed(destination string, allowlist []string) bool {
+	host, _, err := net.SplitHostPort(destination)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(allowlist, destination) || slices.Contains(allowlist, host)
+}
+
+// handleConnect emulates an open proxy for CONNECT requests. Depending on
+// http.proxy.mode the tunnel is faked, the client is tarpitted or the tunnel
+// is relayed when the destination is on http.proxy.allowlist.
+func handleConnect(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *http.Request, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	tunnel := proxyTunnel{Destination: req.Host, Mode: viper.GetString("http.proxy.mode")}
+	if _, _, err := net.SplitHostPort(tunnel.Destination); err != nil {
+		tunnel.Destination = net.JoinHostPort(tunnel.Destination, "443")
+	}
+
+	// the first chunk the client sends through the tunnel, usually a TLS
+	// ClientHello or a plain text request
+	record := func(data []byte) {
+		if err := h.ProduceTCP("http", conn, md, data, tunnel); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "http"), producer.ErrAttr(err))
+		}
+	}
+	readFirst := func() []byte {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		buf := make([]byte, proxyMaxTunnel)
+		n, err := reader.Read(buf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			logger.Debug("Failed to read proxy tunnel data", slog.String("protocol", "http"), producer.ErrAttr(err))
+		}
+		return buf[:n]
+	}
+
+	switch tunnel.Mode {
+	case "tarpit":
+		// never answer and hold the client for as long as it keeps sending
+		var first []byte
+		buf := make([]byte, proxyMaxTunnel)
+		for range proxyTarpitReads {
+			if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+				break
+			}
+			n, err := reader.Read(buf)
+			if first == nil && n > 0 {
+				first = append([]byte{}, buf[:n]...)
+			}
+			if err != nil {
+				break
+			}
+		}
+		record(first)
+		return nil
+	case "relay":
+		if !proxyAllowed(tunnel.Destination, viper.GetStringSlice("http.proxy.allowlist")) {
+			record(nil)
+			return sendHTTP(conn, http.StatusForbidden, nil, nil)
+		}
+		target, err := net.DialTimeout("tcp", tunnel.Destination, proxyDialTimeout)
+		if err != nil {
+			record(nil)
+			return sendHTTP(conn, http.StatusBadGateway, nil, nil)
+		}
+		defer target.Close()
+		if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+			return err
+		}
+		first := readFirst()
+		tunnel.Relayed = true
+		record(first)
+		if err := h.UpdateConnectionTimeout(ctx, target); err != nil {
+			return err
+		}
+		if _, err := target.Write(first); err != nil {
+			return nil
+		}
+		go func() {
+			_, _ = io.CopyN(target, reader, proxyMaxRelay)
+			_ = target.Close()
+		}()
+		_, _ = io.CopyN(conn, target, proxyMaxRelay)
+		return nil
+	}
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		return err
+	}
+	record(readFirst())
+	return nil
+}
@@ -0,0 +1,101 @@
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const upnpServer = "Linux/3.14 UPnP/1.0 MiniUPnPd/2.1"
+
+// upnpRootDesc describes an internet gateway device with a WANIPConnection
+// service, the usual target of port mapping abuse
+const upnpRootDesc = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<device>
+<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<friendlyName>ARRIS TG1672G</friendlyName>
+<manufacturer>ARRIS Group, Inc.</manufacturer>
+<modelName>TG1672G</modelName>
+<modelNumber>9.1.103</modelNumber>
+<UDN>uuid:1c5c2a8e-61d4-4b3b-9f4e-3f0a1d7b2c91</UDN>
+<deviceList><device>
+<deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<UDN>uuid:1c5c2a8e-61d4-4b3b-9f4e-3f0a1d7b2c92</UDN>
+<deviceList><device>
+<deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+<UDN>uuid:1c5c2a8e-61d4-4b3b-9f4e-3f0a1d7b2c93</UDN>
+<serviceList><service>
+<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+<serviceId>urn:upnp-org:serviceId:WANIPConn1</serviceId>
+<SCPDURL>/WANIPCn.xml</SCPDURL>
+<controlURL>/ctl/IPConn</controlURL>
+<eventSubURL>/evt/IPConn</eventSubURL>
+</service></serviceList>
+</device></deviceList>
+</device></deviceList>
+</device>
+</root>`
+
+// upnpAction returns the SOAP action of a UPnP control request
+func upnpAction(req *http.Request) string {
+	action := strings.Trim(req.Header.Get("SOAPAction"), `"`)
+	if _, name, ok := strings.Cut(action, "#"); ok {
+		return name
+	}
+	return action
+}
+
+// upnpTag returns the tag of UPnP abuse found in the request: event
+// subscriptions with a callback (CVE-2020-12695, CallStranger) and port
+// mapping changes
+func upnpTag(req *http.Request) string {
+	switch {
+	case req.Method == "SUBSCRIBE" && req.Header.Get("Callback") != "":
+		return "upnp_callstranger"
+	case strings.HasSuffix(upnpAction(req), "PortMapping"):
+		return "upnp_portmap"
+	}
+	return ""
+}
+
+func isUPnPRequest(req *http.Request) bool {
+	return req.URL.Path == "/rootDesc.xml" ||
+		req.URL.Path == "/WANIPCn.xml" ||
+		strings.HasPrefix(req.URL.Path, "/ctl/") ||
+		strings.HasPrefix(req.URL.Path, "/evt/") ||
+		req.Method == "SUBSCRIBE" ||
+		req.Method == "UNSUBSCRIBE"
+}
+
+// handleUPnP serves the device description advertised over SSDP and accepts
+// control and event subscription requests
+func handleUPnP(conn net.Conn, req *http.Request) error {
+	header := http.Header{}
+	header.Set("Server", upnpServer)
+	switch {
+	case req.Method == "SUBSCRIBE":
+		header.Set("SID", "uuid:7e0d3a55-9c1b-4e2f-8a47-0c6f3b1d2e84")
+		header.Set("Timeout", "Second-1800")
+		return sendHTTP(conn, http.StatusOK, header, nil)
+	case req.Method == "UNSUBSCRIBE":
+		return sendHTTP(conn, http.StatusOK, header, nil)
+	case strings.HasPrefix(req.URL.Path, "/ctl/"):
+		action := upnpAction(req)
+		if action == "" {
+			return sendHTTP(conn, http.StatusMethodNotAllowed, header, nil)
+		}
+		header.Set("Content-Type", `text/xml; charset="utf-8"`)
+		body := fmt.Sprintf(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:%sResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1"></u:%sResponse></s:Body>
+</s:Envelope>`, action, action)
+		return sendHTTP(conn, http.StatusOK, header, []byte(body))
+	case req.URL.Path == "/rootDesc.xml":
+		header.Set("Content-Type", `text/xml; charset="utf-8"`)
+		return sendHTTP(conn, http.StatusOK, header, []byte(upnpRootDesc))
+	}
+	return sendHTTP(conn, http.StatusNotFound, header, nil)
+}
@@ -0,0 +1,166 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	// winrmMaxRequests bounds the requests served on one connection, an NTLM
+	// handshake takes two
+	winrmMaxRequests = 10
+	winrmMaxBody     = 1 << 20
+)
+
+// winrmIdentify is the anonymous WS-Management Identify answer of Windows,
+// which leaves out the OS version until the client authenticated
+const winrmIdentify = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xml:lang="en-US"><s:Header/><s:Body>` +
+	`<wsmid:IdentifyResponse xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd">` +
+	`<wsmid:ProtocolVersion>http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd</wsmid:ProtocolVersion>` +
+	`<wsmid:ProductVendor>Microsoft Corporation</wsmid:ProductVendor>` +
+	`<wsmid:ProductVersion>OS: 0.0.0 SP: 0.0 Stack: 3.0</wsmid:ProductVersion>` +
+	`</wsmid:IdentifyResponse></s:Body></s:Envelope>`
+
+// winrmLogin is a credential captured from a WinRM client
+type winrmLogin struct {
+	Scheme   string    `json:"scheme"`
+	Password string    `json:"password,omitempty"`
+	NTLM     *ntlmAuth `json:"ntlm,omitempty"`
+}
+
+func isWinRMRequest(req *http.Request, port uint16) bool {
+	return port == 5985 || port == 5986 || strings.EqualFold(req.URL.Path, "/wsman")
+}
+
+func winrmHeader() http.Header {
+	header := http.Header{}
+	header.Set("Server", "Microsoft-HTTPAPI/2.0")
+	return header
+}
+
+// handleWinRM answers WS-Management requests like a Windows host. Identify
+// requests are answered anonymously, everything else must authenticate with
+// Basic or NTLM. Logins always fail after the credentials or the NTLM
+// response were captured.
+func handleWinRM(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *http.Request, body []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	challenge := make([]byte, 8)
+	if _, err := rand.Read(challenge); err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	record := func(login winrmLogin) {
+		if !slices.Contains(md.Tags, "winrm_login") {
+			md.Tags = append(md.Tags, "winrm_login")
+		}
+		username := ""
+		if login.NTLM != nil {
+			username = login.NTLM.Domain + `\` + login.NTLM.Username
+		}
+		logger.Info(
+			"WinRM login",
+			slog.String("handler", "http"),
+			slog.String("src_ip", host),
+			slog.String("scheme", login.Scheme),
+			slog.String("username", username),
+		)
+		if err := h.ProduceTCP("http", conn, md, nil, login); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "http"), producer.ErrAttr(err))
+		}
+		cred := credentials.Credential{Protocol: "http", Username: strings.TrimPrefix(username, `\`), Password: login.Password}
+		if login.NTLM != nil && login.NTLM.Hash != "" {
+			cred.Hash, cred.HashType = login.NTLM.Hash, "netntlm"
+		}
+		helpers.RecordCredential(ctx, conn, md, cred, logger, h)
+	}
+	unauthorized := func() error {
+		header := winrmHeader()
+		header.Add("WWW-Authenticate", "Negotiate")
+		header.Add("WWW-Authenticate", `Basic realm="WSMAN"`)
+		return sendHTTP(conn, http.StatusUnauthorized, header, nil)
+	}
+
+	for i := 0; ; i++ {
+		scheme, credentials, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+		token, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+		switch strings.ToLower(scheme) {
+		case "":
+			if req.Method == http.MethodPost && bytes.Contains(body, []byte("wsmanidentity.xsd")) {
+				header := winrmHeader()
+				header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+				if err := sendHTTP(conn, http.StatusOK, header, []byte(winrmIdentify)); err != nil {
+					return err
+				}
+				break
+			}
+			if err := unauthorized(); err != nil {
+				return err
+			}
+		case "basic":
+			username, password, _ := strings.Cut(string(token), ":")
+			record(winrmLogin{Scheme: "basic", Password: password, NTLM: &ntlmAuth{Username: username}})
+			if err := unauthorized(); err != nil {
+				return err
+			}
+		case "negotiate", "ntlm":
+			msg, msgType, ok := ntlmToken(token)
+			if ok && msgType == ntlmNegotiate {
+				resp := ntlmChallengeMessage(challenge, viper.GetString("netbios.workgroup"), viper.GetString("netbios.name"), time.Now())
+				if !bytes.HasPrefix(token, ntlmSignature) {
+					resp = ntlmSPNEGOResponse(resp)
+				}
+				header := winrmHeader()
+				header.Set("WWW-Authenticate", scheme+" "+base64.StdEncoding.EncodeToString(resp))
+				if err := sendHTTP(conn, http.StatusUnauthorized, header, nil); err != nil {
+					return err
+				}
+				break
+			}
+			if ok && msgType == ntlmAuthenticate {
+				auth, err := parseNTLMAuthenticate(msg, challenge)
+				if err != nil {
+					logger.Debug("Failed to parse NTLM message", slog.String("handler", "http"), producer.ErrAttr(err))
+				} else {
+					record(winrmLogin{Scheme: "ntlm", NTLM: auth})
+				}
+			}
+			if err := unauthorized(); err != nil {
+				return err
+			}
+		default:
+			if err := unauthorized(); err != nil {
+				return err
+			}
+		}
+
+		if i+1 >= winrmMaxRequests {
+			return nil
+		}
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		var err error
+		if req, err = http.ReadRequest(reader); err != nil {
+			return nil
+		}
+		if body, err = io.ReadAll(io.LimitReader(req.Body, winrmMaxBody)); err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	identMaxLine    = 1000
+	identMaxQueries = 20
+)
+
+type parsedIdent struct {
+	Direction  string `json:"direction,omitempty"`
+	ServerPort uint16 `json:"server_port,omitempty"`
+	ClientPort uint16 `json:"client_port,omitempty"`
+	Payload    []byte `json:"payload,omitempty"`
+}
+
+// parseIdentQuery reads the "server-port , client-port" pair of RFC 1413
+func parseIdentQuery(line string) (uint16, uint16, error) {
+	server, client, ok := strings.Cut(strings.TrimSpace(line), ",")
+	if !ok {
+		return 0, 0, errors.New("invalid ident query")
+	}
+	serverPort, err := strconv.ParseUint(strings.TrimSpace(server), 10, 16)
+	if err != nil || serverPort == 0 {
+		return 0, 0, errors.New("invalid ident server port")
+	}
+	clientPort, err := strconv.ParseUint(strings.TrimSpace(client), 10, 16)
+	if err != nil || clientPort == 0 {
+		return 0, 0, errors.New("invalid ident client port")
+	}
+	return uint16(serverPort), uint16(clientPort), nil
+}
+
+// identResponse answers with ident.user and ident.os, or with the error of
+// ident.error when it is set, e.g. NO-USER or HIDDEN-USER
+func identResponse(serverPort, clientPort uint16) string {
+	if reason := viper.GetString("ident.error"); reason != "" {
+		return fmt.Sprintf("%d, %d : ERROR : %s\r\n", serverPort, clientPort, reason)
+	}
+	return fmt.Sprintf("%d, %d : USERID : %s : %s\r\n", serverPort, clientPort, viper.GetString("ident.os"), viper.GetString("ident.user"))
+}
+
+// HandleIdent answers ident queries with a configurable user and records the
+// port pairs asked about
+func HandleIdent(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedIdent{}
+	defer func() {
+		if err := h.ProduceTCP("ident", conn, md, helpers.FirstOrEmpty[parsedIdent](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "ident"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close ident connection", slog.String("protocol", "ident"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(conn, identMaxLine)
+	for range identMaxQueries {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "ident"), producer.ErrAttr(err))
+			return nil
+		}
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			logger.Debug("Failed to read ident query", slog.String("protocol", "ident"), producer.ErrAttr(err))
+			return nil
+		}
+		event := parsedIdent{Direction: "read", Payload: append([]byte{}, line...)}
+		serverPort, clientPort, err := parseIdentQuery(string(line))
+		resp := ""
+		if err != nil {
+			resp = strings.TrimSpace(string(line)) + " : ERROR : INVALID-PORT\r\n"
+		} else {
+			event.ServerPort, event.ClientPort = serverPort, clientPort
+			resp = identResponse(serverPort, clientPort)
+		}
+		events = append(events, event)
+		logger.Info(
+			"ident query",
+			slog.String("handler", "ident"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.Int("server_port", int(serverPort)),
+			slog.Int("client_port", int(clientPort)),
+		)
+
+		if _, err := conn.Write([]byte(resp)); err != nil {
+			return err
+		}
+		events = append(events, parsedIdent{Direction: "write", Payload: []byte(resp)})
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package tcp
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdent(t *testing.T) {
+	viper.Set("ident.user", "nobody")
+	viper.Set("ident.os", "UNIX")
+	defer viper.Reset()
+
+	serverPort, clientPort, err := parseIdentQuery("6667 , 51234\r\n")
+	require.NoError(t, err)
+	require.Equal(t, uint16(6667), serverPort)
+	require.Equal(t, uint16(51234), clientPort)
+	require.Equal(t, "6667, 51234 : USERID : UNIX : nobody\r\n", identResponse(serverPort, clientPort))
+
+	viper.Set("ident.error", "HIDDEN-USER")
+	require.Equal(t, "6667, 51234 : ERROR : HIDDEN-USER\r\n", identResponse(serverPort, clientPort))
+
+	_, _, err = parseIdentQuery("70000, 1\r\n")
+	require.Error(t, err)
+}
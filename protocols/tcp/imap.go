@@ -0,0 +1,339 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	imapMaxLine     = 8 << 10
+	imapMaxLiteral  = 64 << 10
+	imapMaxCommands = 50
+	imapCapability  = "IMAP4rev1 SASL-IR LOGIN-REFERRALS ID ENABLE IDLE LITERAL+ AUTH=PLAIN AUTH=LOGIN"
+)
+
+var imapLiteral = regexp.MustCompile(`\{(\d+)(\+?)\}$`)
+
+// imapFolders are listed after login
+var imapFolders = []string{"INBOX", "Drafts", "Sent", "Junk", "Trash"}
+
+type parsedIMAP struct {
+	Direction string `json:"direction,omitempty"`
+	Command   string `json:"command,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Mailbox   string `json:"mailbox,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+type imapServer struct {
+	events []parsedIMAP
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (s *imapServer) write(msg string) error {
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		return err
+	}
+	s.events = append(s.events, parsedIMAP{Direction: "write", Payload: []byte(msg)})
+	return nil
+}
+
+func (s *imapServer) readLine() (string, error) {
+	line, err := s.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", errors.New("IMAP line too long")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// imapTokens splits a command line into atoms and quoted strings
+func imapTokens(line string) []string {
+	tokens := []string{}
+	for line = strings.TrimLeft(line, " "); line != ""; line = strings.TrimLeft(line, " ") {
+		if line[0] != '"' {
+			token, rest, _ := strings.Cut(line, " ")
+			tokens = append(tokens, token)
+			line = rest
+			continue
+		}
+		token := strings.Builder{}
+		i := 1
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+			}
+			token.WriteByte(line[i])
+		}
+		tokens = append(tokens, token.String())
+		line = line[min(i+1, len(line)):]
+	}
+	return tokens
+}
+
+// readCommand reads a tagged command, literals are read in full and become
+// a single token
+func (s *imapServer) readCommand() ([]string, []byte, error) {
+	tokens := []string{}
+	raw := []byte{}
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return nil, nil, err
+		}
+		raw = append(raw, line+"\r\n"...)
+		match := imapLiteral.FindStringSubmatch(line)
+		if match == nil {
+			return append(tokens, imapTokens(line)...), raw, nil
+		}
+		tokens = append(tokens, imapTokens(line[:len(line)-len(match[0])])...)
+		size, err := strconv.Atoi(match[1])
+		if err != nil || size > imapMaxLiteral {
+			return nil, nil, fmt.Errorf("invalid IMAP literal size %q", match[1])
+		}
+		if match[2] == "" {
+			if err := s.write("+ OK\r\n"); err != nil {
+				return nil, nil, err
+			}
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(s.reader, literal); err != nil {
+			return nil, nil, err
+		}
+		raw = append(raw, literal...)
+		tokens = append(tokens, string(literal))
+	}
+}
+
+// authenticate runs the SASL PLAIN or LOGIN exchange and returns the
+// credentials sent by the client
+func (s *imapServer) authenticate(args []string) (string, string, error) {
+	if len(args) == 0 {
+		return "", "", errors.New("missing SASL mechanism")
+	}
+	response := func(prompt string) ([]byte, error) {
+		if err := s.write("+ " + prompt + "\r\n"); err != nil {
+			return nil, err
+		}
+		line, err := s.readLine()
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(line)
+	}
+	switch strings.ToUpper(args[0]) {
+	case "PLAIN":
+		var data []byte
+		var err error
+		if len(args) > 1 {
+			data, err = base64.StdEncoding.DecodeString(args[1])
+		} else {
+			data, err = response("")
+		}
+		if err != nil {
+			return "", "", err
+		}
+		parts := bytes.SplitN(data, []byte{0}, 3)
+		if len(parts) != 3 {
+			return "", "", errors.New("malformed SASL PLAIN response")
+		}
+		return string(parts[1]), string(parts[2]), nil
+	case "LOGIN":
+		username, err := response(base64.StdEncoding.EncodeToString([]byte("Username:")))
+		if err != nil {
+			return "", "", err
+		}
+		password, err := response(base64.StdEncoding.EncodeToString([]byte("Password:")))
+		if err != nil {
+			return "", "", err
+		}
+		return string(username), string(password), nil
+	}
+	return "", "", fmt.Errorf("unsupported SASL mechanism %q", args[0])
+}
+
+// imapAuthenticated are the commands only valid after login
+var imapAuthenticated = map[string]bool{
+	"SELECT": true, "EXAMINE": true, "LIST": true, "LSUB": true, "STATUS": true, "CREATE": true, "DELETE": true,
+	"RENAME": true, "SUBSCRIBE": true, "UNSUBSCRIBE": true, "APPEND": true, "FETCH": true, "SEARCH": true,
+	"UID": true, "CLOSE": true, "EXPUNGE": true, "STORE": true, "COPY": true, "NAMESPACE": true, "IDLE": true,
+}
+
+func imapTitle(cmd string) string {
+	return cmd[:1] + strings.ToLower(cmd[1:])
+}
+
+// imapResponse answers a command of a logged in client, every folder exists
+// and is empty
+func imapResponse(tag, cmd string, args []string) string {
+	mailbox := "INBOX"
+	if len(args) > 0 {
+		mailbox = args[0]
+	}
+	switch cmd {
+	case "LIST", "LSUB":
+		resp := ""
+		for _, folder := range imapFolders {
+			resp += fmt.Sprintf("* %s (\\HasNoChildren) \"/\" %s\r\n", cmd, folder)
+		}
+		return resp + fmt.Sprintf("%s OK %s completed (0.001 + 0.000 secs).\r\n", tag, imapTitle(cmd))
+	case "SELECT", "EXAMINE":
+		mode := "READ-WRITE"
+		if cmd == "EXAMINE" {
+			mode = "READ-ONLY"
+		}
+		return "* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft)\r\n" +
+			"* OK [PERMANENTFLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft \\*)] Flags permitted.\r\n" +
+			"* 0 EXISTS\r\n* 0 RECENT\r\n" +
+			"* OK [UIDVALIDITY 1612345678] UIDs valid\r\n* OK [UIDNEXT 1] Predicted next UID\r\n" +
+			fmt.Sprintf("%s OK [%s] %s completed (0.001 + 0.000 secs).\r\n", tag, mode, imapTitle(cmd))
+	case "STATUS":
+		return fmt.Sprintf("* STATUS %s (MESSAGES 0 RECENT 0 UIDNEXT 1 UIDVALIDITY 1612345678 UNSEEN 0)\r\n%s OK Status completed.\r\n", mailbox, tag)
+	case "NAMESPACE":
+		return fmt.Sprintf("* NAMESPACE ((\"\" \"/\")) NIL NIL\r\n%s OK Namespace completed.\r\n", tag)
+	case "SEARCH":
+		return fmt.Sprintf("* SEARCH\r\n%s OK Search completed.\r\n", tag)
+	case "UID":
+		if len(args) > 0 && strings.EqualFold(args[0], "SEARCH") {
+			return fmt.Sprintf("* SEARCH\r\n%s OK Search completed.\r\n", tag)
+		}
+		return fmt.Sprintf("%s OK UID completed.\r\n", tag)
+	case "APPEND":
+		return fmt.Sprintf("%s OK [APPENDUID 1612345678 1] Append completed.\r\n", tag)
+	}
+	return fmt.Sprintf("%s OK %s completed.\r\n", tag, imapTitle(cmd))
+}
+
+// HandleIMAP accepts any login, harvesting the credentials, and serves an
+// empty mailbox so folder listing and selection attempts are recorded
+func HandleIMAP(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	server := &imapServer{
+		events: []parsedIMAP{},
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, imapMaxLine),
+	}
+	defer func() {
+		if err := h.ProduceTCP("imap", conn, md, helpers.FirstOrEmpty[parsedIMAP](server.events).Payload, server.events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "imap"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close IMAP connection", slog.String("protocol", "imap"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	if err := server.write("* OK [CAPABILITY " + imapCapability + "] Dovecot ready.\r\n"); err != nil {
+		return err
+	}
+	authenticated := false
+	for range imapMaxCommands {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "imap"), producer.ErrAttr(err))
+			return nil
+		}
+		tokens, raw, err := server.readCommand()
+		if err != nil {
+			logger.Debug("Failed to read IMAP command", slog.String("protocol", "imap"), producer.ErrAttr(err))
+			return nil
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		event := parsedIMAP{Direction: "read", Payload: raw}
+		if len(tokens) < 2 {
+			server.events = append(server.events, event)
+			if err := server.write("* BAD Error in IMAP command received by server.\r\n"); err != nil {
+				return err
+			}
+			continue
+		}
+		tag, cmd, args := tokens[0], strings.ToUpper(tokens[1]), tokens[2:]
+		event.Command = cmd
+
+		var resp string
+		switch {
+		case cmd == "CAPABILITY":
+			resp = fmt.Sprintf("* CAPABILITY %s\r\n%s OK Pre-login capabilities listed, post-login capabilities have more.\r\n", imapCapability, tag)
+		case cmd == "NOOP":
+			resp = tag + " OK NOOP completed.\r\n"
+		case cmd == "ID":
+			resp = fmt.Sprintf("* ID (\"name\" \"Dovecot\")\r\n%s OK ID completed.\r\n", tag)
+		case cmd == "STARTTLS":
+			resp = tag + " BAD TLS support isn't enabled.\r\n"
+		case cmd == "LOGOUT":
+			server.events = append(server.events, event)
+			return server.write(fmt.Sprintf("* BYE Logging out\r\n%s OK Logout completed.\r\n", tag))
+		case cmd == "LOGIN" || cmd == "AUTHENTICATE":
+			if cmd == "LOGIN" && len(args) >= 2 {
+				event.Username, event.Password = args[0], args[1]
+			} else if cmd == "AUTHENTICATE" {
+				if event.Username, event.Password, err = server.authenticate(args); err != nil {
+					logger.Debug("Failed IMAP authentication", slog.String("protocol", "imap"), producer.ErrAttr(err))
+				}
+			}
+			if event.Username == "" {
+				resp = tag + " NO [AUTHENTICATIONFAILED] Authentication failed.\r\n"
+				break
+			}
+			logger.Info(
+				"IMAP login",
+				slog.String("handler", "imap"),
+				slog.String("src_ip", host),
+				slog.String("username", event.Username),
+				slog.String("password", event.Password),
+			)
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "imap", Username: event.Username, Password: event.Password, Success: true}, logger, h)
+			authenticated = true
+			resp = fmt.Sprintf("%s OK [CAPABILITY %s NAMESPACE UIDPLUS] Logged in\r\n", tag, imapCapability)
+		case imapAuthenticated[cmd] && authenticated:
+			if len(args) > 0 && cmd != "UID" && cmd != "FETCH" && cmd != "SEARCH" && cmd != "STORE" {
+				event.Mailbox = args[0]
+				if (cmd == "LIST" || cmd == "LSUB") && len(args) > 1 {
+					event.Mailbox = args[0] + args[1]
+				}
+			}
+			resp = imapResponse(tag, cmd, args)
+		default:
+			resp = fmt.Sprintf("%s BAD Error in IMAP command %s: Unknown command.\r\n", tag, cmd)
+		}
+		server.events = append(server.events, event)
+
+		logger.Info(
+			"IMAP command",
+			slog.String("handler", "imap"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("command", cmd),
+			slog.String("mailbox", event.Mailbox),
+		)
+		if err := server.write(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
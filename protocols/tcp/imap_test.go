@@ -0,0 +1,35 @@
+package tcp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIMAPReadCommand(t *testing.T) {
+	server := &imapServer{reader: bufio.NewReader(strings.NewReader(
+		"a1 LOGIN \"info@example.com\" {6+}\r\np\"ss w\r\n" +
+			"a2 AUTHENTICATE PLAIN AHVzZXIAc2VjcmV0\r\n",
+	))}
+	tokens, raw, err := server.readCommand()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a1", "LOGIN", "info@example.com", "p\"ss w"}, tokens)
+	require.Equal(t, "a1 LOGIN \"info@example.com\" {6+}\r\np\"ss w\r\n", string(raw))
+
+	tokens, _, err = server.readCommand()
+	require.NoError(t, err)
+	username, password, err := server.authenticate(tokens[2:])
+	require.NoError(t, err)
+	require.Equal(t, "user", username)
+	require.Equal(t, "secret", password)
+}
+
+func TestIMAPResponse(t *testing.T) {
+	require.Equal(t, []string{"a", "b c", `d"e`}, imapTokens(`a "b c" "d\"e"`))
+	resp := imapResponse("a3", "LIST", []string{"", "*"})
+	require.Contains(t, resp, "* LIST (\\HasNoChildren) \"/\" INBOX\r\n")
+	require.True(t, strings.HasSuffix(resp, "a3 OK List completed (0.001 + 0.000 secs).\r\n"))
+	require.Contains(t, imapResponse("a4", "SELECT", []string{"INBOX"}), "a4 OK [READ-WRITE] Select completed")
+}
@@ -0,0 +1,183 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	// inetdMaxEcho is how much an echo client gets back before we hang up
+	inetdMaxEcho = 64 << 10
+	// chargen streams one line per interval up to chargenMaxLines lines
+	chargenInterval = 100 * time.Millisecond
+	chargenMaxLines = 600
+	chargenWidth    = 72
+)
+
+type parsedInetd struct {
+	Direction string `json:"direction,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// chargenLine is line n of the RFC 864 pattern, 72 printable characters
+// rotating by one position per line
+func chargenLine(n int) []byte {
+	line := make([]byte, 0, chargenWidth+2)
+	for i := range chargenWidth {
+		line = append(line, byte(' '+(n+i)%95))
+	}
+	return append(line, '\r', '\n')
+}
+
+// inetdSession holds the common bookkeeping of the small inetd services
+type inetdSession struct {
+	service string
+	conn    net.Conn
+	md      connection.Metadata
+	logger  interfaces.Logger
+	h       interfaces.Honeypot
+	events  []parsedInetd
+}
+
+func newInetdSession(service string, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) *inetdSession {
+	if !slices.Contains(md.Tags, "inetd") {
+		md.Tags = append(md.Tags, "inetd")
+	}
+	host, port, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	logger.Info(
+		"inetd connection",
+		slog.String("handler", service),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+	)
+	return &inetdSession{service: service, conn: conn, md: md, logger: logger, h: h, events: []parsedInetd{}}
+}
+
+// record keeps data, only the first max_tcp_payload bytes read are stored
+func (s *inetdSession) record(direction string, data []byte) {
+	stored := 0
+	for _, event := range s.events {
+		if event.Direction == direction {
+			stored += len(event.Payload)
+		}
+	}
+	if limit := viper.GetInt("max_tcp_payload"); stored+len(data) > limit {
+		data = data[:max(limit-stored, 0)]
+	}
+	if len(data) > 0 {
+		s.events = append(s.events, parsedInetd{Direction: direction, Payload: append([]byte{}, data...)})
+	}
+}
+
+func (s *inetdSession) close() {
+	if err := s.h.ProduceTCP(s.service, s.conn, s.md, helpers.FirstOrEmpty[parsedInetd](s.events).Payload, s.events); err != nil {
+		s.logger.Error("Failed to produce message", slog.String("protocol", s.service), producer.ErrAttr(err))
+	}
+	if err := s.conn.Close(); err != nil {
+		s.logger.Debug("Failed to close connection", slog.String("protocol", s.service), producer.ErrAttr(err))
+	}
+}
+
+// HandleEcho sends back everything the client writes (RFC 862)
+func HandleEcho(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	s := newInetdSession("echo", conn, md, logger, h)
+	defer s.close()
+
+	buf := make([]byte, 1024)
+	for echoed := 0; echoed < inetdMaxEcho; {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		n, err := conn.Read(buf)
+		if n > 0 {
+			s.record("read", buf[:n])
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return err
+			}
+			echoed += n
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Debug("Failed to read echo data", slog.String("protocol", "echo"), producer.ErrAttr(err))
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// HandleDiscard reads and records whatever the client sends (RFC 863)
+func HandleDiscard(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	s := newInetdSession("discard", conn, md, logger, h)
+	defer s.close()
+
+	buf := make([]byte, 1024)
+	for read := 0; read < viper.GetInt("max_tcp_payload"); {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		n, err := conn.Read(buf)
+		s.record("read", buf[:n])
+		read += n
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Debug("Failed to read discard data", slog.String("protocol", "discard"), producer.ErrAttr(err))
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// HandleDaytime sends the current time in a human readable form and closes
+// the connection (RFC 867)
+func HandleDaytime(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	s := newInetdSession("daytime", conn, md, logger, h)
+	defer s.close()
+
+	resp := []byte(time.Now().UTC().Format("Monday, January 2, 2006 15:04:05-MST") + "\r\n")
+	s.record("write", resp)
+	_, err := conn.Write(resp)
+	return err
+}
+
+// HandleChargen streams the character generator pattern (RFC 864). Lines are
+// paced and capped so the sensor cannot be used to flood anybody.
+func HandleChargen(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	s := newInetdSession("chargen", conn, md, logger, h)
+	defer s.close()
+
+	ticker := time.NewTicker(chargenInterval)
+	defer ticker.Stop()
+	for n := range chargenMaxLines {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		line := chargenLine(n)
+		if n == 0 {
+			s.record("write", line)
+		}
+		if _, err := conn.Write(line); err != nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
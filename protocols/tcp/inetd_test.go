@@ -0,0 +1,15 @@
+package tcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChargenLine(t *testing.T) {
+	line := chargenLine(0)
+	require.Len(t, line, chargenWidth+2)
+	require.Equal(t, ` !"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\]^_`+"`abcdefg\r\n", string(line))
+	require.Equal(t, byte('!'), chargenLine(1)[0])
+	require.Equal(t, byte(' '), chargenLine(95)[0])
+}
@@ -0,0 +1,303 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	ircServerName  = "irc.local"
+	ircMaxLine     = 2048
+	ircMaxMessages = 200
+)
+
+type parsedIRC struct {
+	Direction string `json:"direction,omitempty"`
+	Command   string `json:"command,omitempty"`
+	Nick      string `json:"nick,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	Target    string `json:"target,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// ircMessage is a parsed RFC 1459 message line
+type ircMessage struct {
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+func parseIRCMessage(line string) ircMessage {
+	msg := ircMessage{}
+	if strings.HasPrefix(line, ":") {
+		msg.Prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+	for line = strings.TrimLeft(line, " "); line != ""; line = strings.TrimLeft(line, " ") {
+		if strings.HasPrefix(line, ":") && msg.Command != "" {
+			msg.Params = append(msg.Params, line[1:])
+			break
+		}
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		if msg.Command == "" {
+			msg.Command = strings.ToUpper(param)
+		} else {
+			msg.Params = append(msg.Params, param)
+		}
+	}
+	return msg
+}
+
+// ircSession tracks the registration and channels of a client
+type ircSession struct {
+	nick     string
+	user     string
+	host     string
+	welcomed bool
+	channels map[string]string
+}
+
+func (s *ircSession) numeric(code string, params ...string) string {
+	nick := s.nick
+	if nick == "" {
+		nick = "*"
+	}
+	return fmt.Sprintf(":%s %s %s %s\r\n", ircServerName, code, nick, strings.Join(params, " "))
+}
+
+func (s *ircSession) source() string {
+	return fmt.Sprintf("%s!~%s@%s", s.nick, s.user, s.host)
+}
+
+func (s *ircSession) welcome() string {
+	s.welcomed = true
+	return s.numeric("001", ":Welcome to the Internet Relay Network "+s.source()) +
+		s.numeric("002", ":Your host is "+ircServerName+", running version UnrealIRCd-5.2.4") +
+		s.numeric("003", ":This server was created Mon Mar 7 2022 at 10:21:44 UTC") +
+		s.numeric("004", ircServerName, "UnrealIRCd-5.2.4", "iowrsxzdHtIDZRqpWGTSB", "lvhopsmntikraqbeI") +
+		s.numeric("005", "CHANTYPES=#", "PREFIX=(qaohv)~&@%+", "NETWORK=Local", "CASEMAPPING=ascii", ":are supported by this server") +
+		s.numeric("375", ":- "+ircServerName+" Message of the Day -") +
+		s.numeric("372", ":- Welcome!") +
+		s.numeric("376", ":End of /MOTD command.")
+}
+
+// handle returns the reply to msg along with whether the client quit
+func (s *ircSession) handle(msg ircMessage) (string, bool) {
+	param := func(i int) string {
+		if i < len(msg.Params) {
+			return msg.Params[i]
+		}
+		return ""
+	}
+	switch msg.Command {
+	case "CAP":
+		if strings.EqualFold(param(0), "LS") {
+			return fmt.Sprintf(":%s CAP * LS :\r\n", ircServerName), false
+		}
+		return "", false
+	case "PASS":
+		return "", false
+	case "NICK":
+		if param(0) == "" {
+			return s.numeric("431", ":No nickname given"), false
+		}
+		old := s.source()
+		s.nick = param(0)
+		if s.welcomed {
+			return fmt.Sprintf(":%s NICK :%s\r\n", old, s.nick), false
+		}
+		if s.user != "" {
+			return s.welcome(), false
+		}
+		return "", false
+	case "USER":
+		if s.welcomed {
+			return s.numeric("462", ":You may not reregister"), false
+		}
+		s.user = param(0)
+		if s.nick != "" {
+			return s.welcome(), false
+		}
+		return "", false
+	case "PING":
+		return fmt.Sprintf(":%s PONG %s :%s\r\n", ircServerName, ircServerName, param(0)), false
+	case "PONG":
+		return "", false
+	case "QUIT":
+		return fmt.Sprintf("ERROR :Closing Link: %s (Quit: %s)\r\n", s.host, param(0)), true
+	}
+
+	if !s.welcomed {
+		return s.numeric("451", ":You have not registered"), false
+	}
+	switch msg.Command {
+	case "JOIN":
+		resp := ""
+		for _, channel := range strings.Split(param(0), ",") {
+			if !strings.HasPrefix(channel, "#") {
+				resp += s.numeric("403", channel, ":No such channel")
+				continue
+			}
+			if _, ok := s.channels[channel]; !ok {
+				s.channels[channel] = ""
+			}
+			resp += fmt.Sprintf(":%s JOIN :%s\r\n", s.source(), channel)
+			if topic := s.channels[channel]; topic != "" {
+				resp += s.numeric("332", channel, ":"+topic)
+			}
+			resp += s.numeric("353", "=", channel, ":@"+s.nick) + s.numeric("366", channel, ":End of /NAMES list.")
+		}
+		return resp, false
+	case "PART":
+		resp := ""
+		for _, channel := range strings.Split(param(0), ",") {
+			delete(s.channels, channel)
+			resp += fmt.Sprintf(":%s PART %s\r\n", s.source(), channel)
+		}
+		return resp, false
+	case "TOPIC":
+		channel := param(0)
+		if len(msg.Params) > 1 {
+			s.channels[channel] = param(1)
+			return fmt.Sprintf(":%s TOPIC %s :%s\r\n", s.source(), channel, param(1)), false
+		}
+		if topic := s.channels[channel]; topic != "" {
+			return s.numeric("332", channel, ":"+topic), false
+		}
+		return s.numeric("331", channel, ":No topic is set."), false
+	case "PRIVMSG", "NOTICE":
+		// nobody else is around to read it
+		return "", false
+	case "MODE":
+		if strings.HasPrefix(param(0), "#") {
+			return s.numeric("324", param(0), "+nt"), false
+		}
+		return s.numeric("221", "+iwx"), false
+	case "WHO":
+		return s.numeric("352", param(0), "~"+s.user, s.host, ircServerName, s.nick, "H@", ":0 "+s.user) +
+			s.numeric("315", param(0), ":End of /WHO list."), false
+	case "LIST":
+		resp := s.numeric("321", "Channel", ":Users  Name")
+		for channel, topic := range s.channels {
+			resp += s.numeric("322", channel, "1", ":"+topic)
+		}
+		return resp + s.numeric("323", ":End of /LIST"), false
+	case "USERHOST", "ISON", "WHOIS", "AWAY":
+		return "", false
+	}
+	return s.numeric("421", msg.Command, ":Unknown command"), false
+}
+
+// HandleIRC completes client registration and lets the client join channels
+// and talk, recording every message and topic a bot sends
+func HandleIRC(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedIRC{}
+	defer func() {
+		if err := h.ProduceTCP("irc", conn, md, helpers.FirstOrEmpty[parsedIRC](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "irc"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close IRC connection", slog.String("protocol", "irc"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	session := &ircSession{host: host, channels: map[string]string{}}
+	notice := fmt.Sprintf(":%s NOTICE * :*** Looking up your hostname...\r\n:%s NOTICE * :*** Couldn't resolve your hostname; using your IP address instead\r\n", ircServerName, ircServerName)
+	if _, err := conn.Write([]byte(notice)); err != nil {
+		return err
+	}
+	events = append(events, parsedIRC{Direction: "write", Payload: []byte(notice)})
+
+	reader := bufio.NewReaderSize(conn, ircMaxLine)
+	for range ircMaxMessages {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "irc"), producer.ErrAttr(err))
+			return nil
+		}
+		data, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			logger.Debug("IRC line too long", slog.String("protocol", "irc"))
+			return nil
+		}
+		if err != nil {
+			logger.Debug("Failed to read IRC message", slog.String("protocol", "irc"), producer.ErrAttr(err))
+			return nil
+		}
+		line := strings.TrimRight(string(data), "\r\n")
+		msg := parseIRCMessage(line)
+		if msg.Command == "" {
+			continue
+		}
+
+		event := parsedIRC{Direction: "read", Command: msg.Command, Nick: session.nick, Payload: []byte(line)}
+		switch msg.Command {
+		case "JOIN", "PART":
+			if len(msg.Params) > 0 {
+				event.Channel = msg.Params[0]
+			}
+		case "TOPIC":
+			if len(msg.Params) > 0 {
+				event.Channel = msg.Params[0]
+			}
+			if len(msg.Params) > 1 {
+				event.Message = msg.Params[1]
+			}
+		case "PRIVMSG", "NOTICE":
+			if len(msg.Params) > 1 {
+				event.Target, event.Message = msg.Params[0], msg.Params[1]
+			}
+		}
+		resp, quit := session.handle(msg)
+		if msg.Command == "NICK" {
+			event.Nick = session.nick
+		}
+		events = append(events, event)
+
+		if event.Message != "" || event.Channel != "" {
+			if !slices.Contains(md.Tags, "irc_c2") {
+				md.Tags = append(md.Tags, "irc_c2")
+			}
+			logger.Info(
+				"IRC message",
+				slog.String("handler", "irc"),
+				slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+				slog.String("src_ip", host),
+				slog.String("src_port", port),
+				slog.String("command", msg.Command),
+				slog.String("nick", session.nick),
+				slog.String("channel", event.Channel),
+				slog.String("target", event.Target),
+				slog.String("message", event.Message),
+			)
+		}
+
+		if resp != "" {
+			if _, err := conn.Write([]byte(resp)); err != nil {
+				return err
+			}
+			events = append(events, parsedIRC{Direction: "write", Payload: []byte(resp)})
+		}
+		if quit {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package tcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIRCMessage(t *testing.T) {
+	require.Equal(t, ircMessage{Command: "PRIVMSG", Params: []string{"#bots", ".udp 1.2.3.4 80 60"}}, parseIRCMessage("privmsg #bots :.udp 1.2.3.4 80 60"))
+	require.Equal(t, ircMessage{Prefix: "n!u@h", Command: "JOIN", Params: []string{"#x", "key"}}, parseIRCMessage(":n!u@h JOIN #x key"))
+	require.Equal(t, ircMessage{Command: "USER", Params: []string{"u", "0", "*", ""}}, parseIRCMessage("USER u 0 * :"))
+}
+
+func TestIRCSession(t *testing.T) {
+	session := &ircSession{host: "1.2.3.4", channels: map[string]string{}}
+	resp, _ := session.handle(parseIRCMessage("JOIN #x"))
+	require.Contains(t, resp, " 451 * ")
+
+	resp, _ = session.handle(parseIRCMessage("NICK bot123"))
+	require.Empty(t, resp)
+	resp, _ = session.handle(parseIRCMessage("USER bot 0 * :bot"))
+	require.True(t, strings.HasPrefix(resp, ":irc.local 001 bot123 :Welcome to the Internet Relay Network bot123!~bot@1.2.3.4\r\n"))
+
+	session.handle(parseIRCMessage("TOPIC #x :.scan 10.0.0.0/8"))
+	resp, _ = session.handle(parseIRCMessage("JOIN #x"))
+	require.Contains(t, resp, ":bot123!~bot@1.2.3.4 JOIN :#x\r\n")
+	require.Contains(t, resp, " 332 bot123 #x :.scan 10.0.0.0/8\r\n")
+
+	_, quit := session.handle(parseIRCMessage("QUIT :bye"))
+	require.True(t, quit)
+}
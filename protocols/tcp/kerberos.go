@@ -0,0 +1,97 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// kerberosMaxMessage bounds the length prefix, real requests are far smaller
+const kerberosMaxMessage = 64 << 10
+
+type parsedKerberos struct {
+	Direction string                  `json:"direction,omitempty"`
+	Message   helpers.KerberosMessage `json:"message,omitempty"`
+	Payload   []byte                  `json:"payload,omitempty"`
+}
+
+// HandleKerberos answers length prefixed AS-REQ and TGS-REQ messages with the
+// errors of a KDC, recording the requested principals and encryption types
+func HandleKerberos(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedKerberos{}
+	defer func() {
+		if err := h.ProduceTCP("kerberos", conn, md, helpers.FirstOrEmpty[parsedKerberos](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close Kerberos connection", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+			return nil
+		}
+		var length uint32
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			logger.Debug("Failed to read Kerberos message length", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+			return nil
+		}
+		if length > kerberosMaxMessage {
+			logger.Debug("Kerberos message too long", slog.String("protocol", "kerberos"))
+			return nil
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			logger.Debug("Failed to read Kerberos message", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+			return nil
+		}
+
+		resp, msg, err := helpers.KerberosResponse(data)
+		events = append(events, parsedKerberos{
+			Direction: "read",
+			Message:   msg,
+			Payload:   data,
+		})
+		if err != nil {
+			logger.Debug("Failed to parse Kerberos request", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+			return nil
+		}
+		logger.Info(
+			"Kerberos request",
+			slog.String("handler", "kerberos"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("type", msg.Type),
+			slog.String("realm", msg.Realm),
+			slog.String("client", msg.Client),
+			slog.String("service", msg.Service),
+			slog.String("encryption_types", strings.Join(msg.EncryptionTypes, ",")),
+		)
+
+		events = append(events, parsedKerberos{
+			Direction: "write",
+			Message:   msg,
+			Payload:   resp,
+		})
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(resp))), resp...)); err != nil {
+			return err
+		}
+	}
+}
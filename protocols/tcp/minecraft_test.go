@@ -0,0 +1,51 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinecraftPackets(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 25565, -1} {
+		v, err := readMCVarInt(bytes.NewReader(appendMCVarInt(nil, n)))
+		require.NoError(t, err)
+		require.Equal(t, n, int(int32(v)))
+	}
+
+	handshake := appendMCVarInt(nil, 763)
+	handshake = appendMCString(handshake, "mc.example.com")
+	handshake = append(handshake, 0x63, 0xdd, mcStateStatus)
+	packet, err := readMCPacket(bufio.NewReader(bytes.NewReader(mcFrame(0x00, handshake))))
+	require.NoError(t, err)
+	require.Equal(t, 0, packet.id)
+	protocol, err := readMCVarInt(packet.data)
+	require.NoError(t, err)
+	require.Equal(t, 763, protocol)
+	address, err := packet.string()
+	require.NoError(t, err)
+	require.Equal(t, "mc.example.com", address)
+
+	viper.Set("minecraft.motd", "Survival")
+	packet, err = readMCPacket(bufio.NewReader(bytes.NewReader(mcStatus(763))))
+	require.NoError(t, err)
+	data, err := packet.string()
+	require.NoError(t, err)
+	status := struct {
+		Version struct {
+			Protocol int `json:"protocol"`
+		} `json:"version"`
+		Description struct {
+			Text string `json:"text"`
+		} `json:"description"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(data), &status))
+	require.Equal(t, 763, status.Version.Protocol)
+	require.Equal(t, "Survival", status.Description.Text)
+
+	require.Equal(t, "b50ad385-829d-3141-a216-7e7d7539ba7f", mcOfflineUUID("Notch"))
+}
@@ -0,0 +1,272 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	modbusReadCoils          = 1
+	modbusReadDiscreteInputs = 2
+	modbusReadHolding        = 3
+	modbusReadInput          = 4
+	modbusWriteCoil          = 5
+	modbusWriteRegister      = 6
+	modbusEncapsulated       = 43
+	modbusMEIDeviceID        = 14
+
+	modbusIllegalFunction = 1
+	modbusIllegalAddress  = 2
+	modbusIllegalValue    = 3
+
+	modbusMaxBits      = 2000
+	modbusMaxRegisters = 125
+	// size of each coil and register bank
+	modbusBankSize = 10000
+	modbusMaxPDU   = 253
+)
+
+type modbusHeader struct {
+	TransactionID uint16
+	ProtocolID    uint16
+	Length        uint16
+	UnitID        uint8
+}
+
+type modbusRequest struct {
+	UnitID   uint8  `json:"unit_id"`
+	Function uint8  `json:"function"`
+	Address  uint16 `json:"address,omitempty"`
+	Quantity uint16 `json:"quantity,omitempty"`
+	Value    uint16 `json:"value,omitempty"`
+}
+
+type parsedModbus struct {
+	Direction string        `json:"direction,omitempty"`
+	Request   modbusRequest `json:"request,omitempty"`
+	Payload   []byte        `json:"payload,omitempty"`
+}
+
+// modbusDevice holds the coils and registers of a session, writes are kept
+// for the rest of the connection
+type modbusDevice struct {
+	coils    []bool
+	discrete []bool
+	holding  []uint16
+	input    []uint16
+}
+
+func modbusRegisters(key string) []uint16 {
+	regs := make([]uint16, modbusBankSize)
+	for i, v := range viper.GetIntSlice(key) {
+		if i < modbusBankSize {
+			regs[i] = uint16(v)
+		}
+	}
+	return regs
+}
+
+func modbusBits(key string) []bool {
+	bits := make([]bool, modbusBankSize)
+	for i, v := range viper.GetIntSlice(key) {
+		if i < modbusBankSize {
+			bits[i] = v != 0
+		}
+	}
+	return bits
+}
+
+func newModbusDevice() *modbusDevice {
+	return &modbusDevice{
+		coils:    modbusBits("modbus.coils"),
+		discrete: modbusBits("modbus.discrete_inputs"),
+		holding:  modbusRegisters("modbus.holding_registers"),
+		input:    modbusRegisters("modbus.input_registers"),
+	}
+}
+
+func modbusException(function, code uint8) []byte {
+	return []byte{function | 0x80, code}
+}
+
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// modbusDeviceID answers a read device identification request with the
+// basic objects: vendor, product code and revision
+func modbusDeviceID(data []byte) []byte {
+	if len(data) < 3 || data[0] != modbusMEIDeviceID {
+		return modbusException(modbusEncapsulated, modbusIllegalFunction)
+	}
+	objects := []string{
+		viper.GetString("modbus.vendor"),
+		viper.GetString("modbus.product_code"),
+		viper.GetString("modbus.revision"),
+	}
+	resp := []byte{modbusEncapsulated, modbusMEIDeviceID, data[1], 0x01, 0x00, 0x00, byte(len(objects))}
+	for id, value := range objects {
+		resp = append(resp, byte(id), byte(len(value)))
+		resp = append(resp, value...)
+	}
+	return resp
+}
+
+// handle executes a request PDU and returns the response PDU
+func (d *modbusDevice) handle(req *modbusRequest, pdu []byte) []byte {
+	req.Function = pdu[0]
+	data := pdu[1:]
+	if req.Function == modbusEncapsulated {
+		return modbusDeviceID(data)
+	}
+	if req.Function < modbusReadCoils || req.Function > modbusWriteRegister {
+		return modbusException(req.Function, modbusIllegalFunction)
+	}
+	if len(data) < 4 {
+		return modbusException(req.Function, modbusIllegalValue)
+	}
+	req.Address = binary.BigEndian.Uint16(data)
+	arg := binary.BigEndian.Uint16(data[2:])
+	start := int(req.Address)
+
+	switch req.Function {
+	case modbusReadCoils, modbusReadDiscreteInputs:
+		req.Quantity = arg
+		if arg == 0 || arg > modbusMaxBits {
+			return modbusException(req.Function, modbusIllegalValue)
+		}
+		if start+int(arg) > modbusBankSize {
+			return modbusException(req.Function, modbusIllegalAddress)
+		}
+		bank := d.coils
+		if req.Function == modbusReadDiscreteInputs {
+			bank = d.discrete
+		}
+		packed := packBits(bank[start : start+int(arg)])
+		return append([]byte{req.Function, byte(len(packed))}, packed...)
+	case modbusReadHolding, modbusReadInput:
+		req.Quantity = arg
+		if arg == 0 || arg > modbusMaxRegisters {
+			return modbusException(req.Function, modbusIllegalValue)
+		}
+		if start+int(arg) > modbusBankSize {
+			return modbusException(req.Function, modbusIllegalAddress)
+		}
+		bank := d.holding
+		if req.Function == modbusReadInput {
+			bank = d.input
+		}
+		resp := []byte{req.Function, byte(arg * 2)}
+		for _, v := range bank[start : start+int(arg)] {
+			resp = binary.BigEndian.AppendUint16(resp, v)
+		}
+		return resp
+	case modbusWriteCoil:
+		req.Value = arg
+		if arg != 0xff00 && arg != 0x0000 {
+			return modbusException(req.Function, modbusIllegalValue)
+		}
+		if start >= modbusBankSize {
+			return modbusException(req.Function, modbusIllegalAddress)
+		}
+		d.coils[start] = arg == 0xff00
+	case modbusWriteRegister:
+		req.Value = arg
+		if start >= modbusBankSize {
+			return modbusException(req.Function, modbusIllegalAddress)
+		}
+		d.holding[start] = arg
+	}
+	// writes are acknowledged by echoing the request
+	return pdu[:5]
+}
+
+// HandleModbus handles Modbus/TCP requests against a simulated device
+func HandleModbus(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedModbus{}
+	defer func() {
+		if err := h.ProduceTCP("modbus", conn, md, helpers.FirstOrEmpty[parsedModbus](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "modbus"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close Modbus connection", slog.String("protocol", "modbus"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	device := newModbusDevice()
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "modbus"), producer.ErrAttr(err))
+			return nil
+		}
+		header := modbusHeader{}
+		if err := binary.Read(conn, binary.BigEndian, &header); err != nil {
+			logger.Debug("Failed to read Modbus header", slog.String("protocol", "modbus"), producer.ErrAttr(err))
+			return nil
+		}
+		if header.ProtocolID != 0 || header.Length < 2 || header.Length > modbusMaxPDU+1 {
+			logger.Debug("Invalid Modbus header", slog.String("protocol", "modbus"))
+			return nil
+		}
+		pdu := make([]byte, header.Length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			logger.Debug("Failed to read Modbus PDU", slog.String("protocol", "modbus"), producer.ErrAttr(err))
+			return nil
+		}
+
+		req := modbusRequest{UnitID: header.UnitID}
+		resp := device.handle(&req, pdu)
+		events = append(events, parsedModbus{
+			Direction: "read",
+			Request:   req,
+			Payload:   pdu,
+		})
+		logger.Info(
+			"Modbus request",
+			slog.String("handler", "modbus"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.Int("unit_id", int(req.UnitID)),
+			slog.Int("function", int(req.Function)),
+			slog.Int("address", int(req.Address)),
+			slog.Int("quantity", int(req.Quantity)),
+		)
+
+		header.Length = uint16(len(resp) + 1)
+		out := binary.BigEndian.AppendUint16(nil, header.TransactionID)
+		out = binary.BigEndian.AppendUint16(out, header.ProtocolID)
+		out = binary.BigEndian.AppendUint16(out, header.Length)
+		out = append(out, header.UnitID)
+		out = append(out, resp...)
+		events = append(events, parsedModbus{
+			Direction: "write",
+			Request:   req,
+			Payload:   out,
+		})
+		if _, err := conn.Write(out); err != nil {
+			return err
+		}
+	}
+}
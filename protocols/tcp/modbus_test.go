@@ -0,0 +1,35 @@
+package tcp
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModbusDevice(t *testing.T) {
+	viper.Set("modbus.holding_registers", []int{1, 220, 50})
+	viper.Set("modbus.coils", []int{1, 0, 1})
+	viper.Set("modbus.vendor", "Schneider Electric")
+	defer viper.Reset()
+	device := newModbusDevice()
+
+	req := modbusRequest{}
+	require.Equal(t, []byte{3, 6, 0, 1, 0, 220, 0, 50}, device.handle(&req, []byte{3, 0, 0, 0, 3}))
+	require.Equal(t, uint16(3), req.Quantity)
+
+	require.Equal(t, []byte{1, 1, 0x05}, device.handle(&modbusRequest{}, []byte{1, 0, 0, 0, 3}))
+
+	// writes are echoed and stick for the session
+	write := []byte{6, 0, 1, 0x01, 0x00}
+	require.Equal(t, write, device.handle(&modbusRequest{}, write))
+	require.Equal(t, []byte{3, 2, 1, 0}, device.handle(&modbusRequest{}, []byte{3, 0, 1, 0, 1}))
+
+	require.Equal(t, []byte{0x83, modbusIllegalAddress}, device.handle(&modbusRequest{}, []byte{3, 0x27, 0x0f, 0, 2}))
+	require.Equal(t, []byte{0x83, modbusIllegalValue}, device.handle(&modbusRequest{}, []byte{3, 0, 0, 0, 200}))
+	require.Equal(t, []byte{0x90, modbusIllegalFunction}, device.handle(&modbusRequest{}, []byte{16, 0, 0, 0, 1}))
+
+	id := device.handle(&modbusRequest{}, []byte{43, 14, 1, 0})
+	require.Equal(t, []byte{43, 14, 1}, id[:3])
+	require.Contains(t, string(id), "Schneider Electric")
+}
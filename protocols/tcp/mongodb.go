@@ -0,0 +1,484 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	mongoOpReply  = 1
+	mongoOpInsert = 2002
+	mongoOpQuery  = 2004
+	mongoOpMsg    = 2013
+
+	mongoVersion     = "4.4.29"
+	mongoWireVersion = 9
+	mongoMaxMessage  = 16 << 20
+	mongoMaxBSON     = 16 << 20
+)
+
+type mongoCommand struct {
+	Database   string           `json:"database,omitempty"`
+	Command    string           `json:"command"`
+	Collection string           `json:"collection,omitempty"`
+	Username   string           `json:"username,omitempty"`
+	Documents  []map[string]any `json:"documents,omitempty"`
+}
+
+type parsedMongoDB struct {
+	Direction string        `json:"direction,omitempty"`
+	OpCode    int32         `json:"op_code,omitempty"`
+	Command   *mongoCommand `json:"command,omitempty"`
+	Payload   []byte        `json:"payload,omitempty"`
+}
+
+// mongoSession keeps the databases of a connection so drops and inserts
+// of ransom notes show up in later listings
+type mongoSession struct {
+	databases map[string][]string
+	dropped   bool
+	remote    string
+	requestID int32
+}
+
+func newMongoSession(remote string) *mongoSession {
+	return &mongoSession{
+		remote: remote,
+		databases: map[string][]string{
+			"admin":     {"system.version"},
+			"config":    {"system.sessions"},
+			"local":     {"startup_log"},
+			"customers": {"users", "orders"},
+		},
+	}
+}
+
+// mongoFakeDocuments are returned by every find so dumps look successful
+func mongoFakeDocuments() []any {
+	docs := []any{}
+	for i, name := range []string{"jsmith", "mgarcia", "lchen"} {
+		id := [12]byte{0x65, 0x3a, 0x1f, 0x0c, 0x9e, 0x4b, 0x2d, 0x11, 0x7a, 0x00, 0x00, byte(i + 1)}
+		docs = append(docs, bsonDoc{
+			{"_id", id},
+			{"username", name},
+			{"email", name + "@example.com"},
+			{"created", time.Date(2023, 10, 26, 9, i*7, 0, 0, time.UTC)},
+		})
+	}
+	return docs
+}
+
+func mongoError(code int32, codeName, msg string) bsonDoc {
+	return bsonDoc{{"ok", 0.0}, {"errmsg", msg}, {"code", code}, {"codeName", codeName}}
+}
+
+func mongoCursor(ns string, batch []any) bsonDoc {
+	return bsonDoc{
+		{"cursor", bsonDoc{{"firstBatch", batch}, {"id", int64(0)}, {"ns", ns}}},
+		{"ok", 1.0},
+	}
+}
+
+func bsonDocs(value any) []bsonDoc {
+	array, _ := value.([]any)
+	docs := []bsonDoc{}
+	for _, item := range array {
+		if doc, ok := item.(bsonDoc); ok {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// command runs a database command and returns the reply document
+func (s *mongoSession) command(cmd *mongoCommand, doc bsonDoc, docs []bsonDoc) bsonDoc {
+	if len(doc) == 0 {
+		return mongoError(59, "CommandNotFound", "no such command: ''")
+	}
+	cmd.Command = doc[0].Key
+	if name, ok := doc[0].Value.(string); ok {
+		cmd.Collection = name
+	}
+	switch strings.ToLower(cmd.Command) {
+	case "ismaster", "hello":
+		reply := bsonDoc{{"ismaster", true}}
+		if cmd.Command == "hello" {
+			reply = bsonDoc{{"isWritablePrimary", true}}
+		}
+		return append(reply,
+			bsonElem{"topologyVersion", bsonDoc{{"processId", [12]byte{0x65, 0x3a, 0x1e, 0xf2}}, {"counter", int64(0)}}},
+			bsonElem{"maxBsonObjectSize", int32(mongoMaxBSON)},
+			bsonElem{"maxMessageSizeBytes", int32(48000000)},
+			bsonElem{"maxWriteBatchSize", int32(100000)},
+			bsonElem{"localTime", time.Now().UTC()},
+			bsonElem{"logicalSessionTimeoutMinutes", int32(30)},
+			bsonElem{"connectionId", int32(4231)},
+			bsonElem{"minWireVersion", int32(0)},
+			bsonElem{"maxWireVersion", int32(mongoWireVersion)},
+			bsonElem{"readOnly", false},
+			bsonElem{"ok", 1.0},
+		)
+	case "buildinfo":
+		return bsonDoc{
+			{"version", mongoVersion},
+			{"gitVersion", "f4d6e5fab4a6d6ebc2a0e5d5c8e07e8d1c7b2a3e"},
+			{"modules", []any{}},
+			{"allocator", "tcmalloc"},
+			{"javascriptEngine", "mozjs"},
+			{"sysInfo", "deprecated"},
+			{"versionArray", []any{int32(4), int32(4), int32(29), int32(0)}},
+			{"openssl", bsonDoc{{"running", "OpenSSL 1.1.1f  31 Mar 2020"}, {"compiled", "OpenSSL 1.1.1f  31 Mar 2020"}}},
+			{"buildEnvironment", bsonDoc{{"distmod", "ubuntu2004"}, {"distarch", "x86_64"}, {"target_arch", "x86_64"}, {"target_os", "linux"}}},
+			{"bits", int32(64)},
+			{"debug", false},
+			{"maxBsonObjectSize", int32(mongoMaxBSON)},
+			{"storageEngines", []any{"biggie", "devnull", "ephemeralForTest", "wiredTiger"}},
+			{"ok", 1.0},
+		}
+	case "listdatabases":
+		names := make([]string, 0, len(s.databases))
+		for name := range s.databases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		databases := []any{}
+		total := int64(0)
+		for _, name := range names {
+			size := int64(40960 * (1 + len(s.databases[name])))
+			total += size
+			databases = append(databases, bsonDoc{{"name", name}, {"sizeOnDisk", size}, {"empty", false}})
+		}
+		return bsonDoc{{"databases", databases}, {"totalSize", total}, {"ok", 1.0}}
+	case "listcollections":
+		collections := []any{}
+		for _, name := range s.databases[cmd.Database] {
+			collections = append(collections, bsonDoc{
+				{"name", name},
+				{"type", "collection"},
+				{"options", bsonDoc{}},
+				{"info", bsonDoc{{"readOnly", false}}},
+			})
+		}
+		return mongoCursor(cmd.Database+".$cmd.listCollections", collections)
+	case "find", "aggregate":
+		batch := []any{}
+		if slices.Contains(s.databases[cmd.Database], cmd.Collection) {
+			batch = mongoFakeDocuments()
+		}
+		return mongoCursor(cmd.Database+"."+cmd.Collection, batch)
+	case "count":
+		n := int32(0)
+		if slices.Contains(s.databases[cmd.Database], cmd.Collection) {
+			n = int32(len(mongoFakeDocuments()))
+		}
+		return bsonDoc{{"n", n}, {"ok", 1.0}}
+	case "insert":
+		value, _ := doc.Get("documents")
+		docs = append(docs, bsonDocs(value)...)
+		for _, d := range docs {
+			cmd.Documents = append(cmd.Documents, d.Map())
+		}
+		if !slices.Contains(s.databases[cmd.Database], cmd.Collection) {
+			s.databases[cmd.Database] = append(s.databases[cmd.Database], cmd.Collection)
+		}
+		return bsonDoc{{"n", int32(len(docs))}, {"ok", 1.0}}
+	case "update", "delete":
+		return bsonDoc{{"n", int32(0)}, {"ok", 1.0}}
+	case "drop":
+		if !slices.Contains(s.databases[cmd.Database], cmd.Collection) {
+			return mongoError(26, "NamespaceNotFound", "ns not found")
+		}
+		s.dropped = true
+		s.databases[cmd.Database] = slices.DeleteFunc(s.databases[cmd.Database], func(c string) bool { return c == cmd.Collection })
+		return bsonDoc{{"nIndexesWas", int32(1)}, {"ns", cmd.Database + "." + cmd.Collection}, {"ok", 1.0}}
+	case "dropdatabase":
+		s.dropped = true
+		delete(s.databases, cmd.Database)
+		return bsonDoc{{"dropped", cmd.Database}, {"ok", 1.0}}
+	case "create":
+		s.databases[cmd.Database] = append(s.databases[cmd.Database], cmd.Collection)
+		return bsonDoc{{"ok", 1.0}}
+	case "saslstart", "authenticate":
+		// the username is in the SCRAM client-first message "n,,n=user,r=nonce"
+		if payload, ok := doc.Get("payload"); ok {
+			if data, ok := payload.([]byte); ok {
+				for _, field := range strings.Split(string(data), ",") {
+					if strings.HasPrefix(field, "n=") {
+						cmd.Username = field[2:]
+					}
+				}
+			}
+		}
+		if user := doc.String("user"); user != "" {
+			cmd.Username = user
+		}
+		return mongoError(18, "AuthenticationFailed", "Authentication failed.")
+	case "whatsmyuri":
+		return bsonDoc{{"you", s.remote}, {"ok", 1.0}}
+	case "getlog":
+		return bsonDoc{{"totalLinesWritten", int32(0)}, {"log", []any{}}, {"ok", 1.0}}
+	case "getlasterror":
+		return bsonDoc{{"n", int32(0)}, {"err", nil}, {"ok", 1.0}}
+	case "ping", "endsessions", "killcursors", "getfreemonitoringstatus", "getcmdlineopts":
+		return bsonDoc{{"ok", 1.0}}
+	}
+	return mongoError(59, "CommandNotFound", fmt.Sprintf("no such command: '%s'", cmd.Command))
+}
+
+// parseOpMsg returns the body and the document sequences of an OP_MSG
+func parseOpMsg(data []byte) (bsonDoc, []bsonDoc, error) {
+	if len(data) < 5 {
+		return nil, nil, errors.New("OP_MSG too short")
+	}
+	flags := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	if flags&1 != 0 {
+		// checksum present
+		if len(data) < 4 {
+			return nil, nil, errors.New("OP_MSG too short")
+		}
+		data = data[:len(data)-4]
+	}
+	var body bsonDoc
+	docs := []bsonDoc{}
+	for len(data) > 0 {
+		kind := data[0]
+		data = data[1:]
+		switch kind {
+		case 0:
+			doc, rest, err := bsonDecode(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			body, data = doc, rest
+		case 1:
+			if len(data) < 4 {
+				return nil, nil, errors.New("invalid OP_MSG document sequence")
+			}
+			size := int(binary.LittleEndian.Uint32(data))
+			if size < 4 || size > len(data) {
+				return nil, nil, errors.New("invalid OP_MSG document sequence size")
+			}
+			_, seq, err := bsonCString(data[4:size])
+			if err != nil {
+				return nil, nil, err
+			}
+			for len(seq) > 0 {
+				doc, rest, err := bsonDecode(seq)
+				if err != nil {
+					return nil, nil, err
+				}
+				docs = append(docs, doc)
+				seq = rest
+			}
+			data = data[size:]
+		default:
+			return nil, nil, fmt.Errorf("invalid OP_MSG section kind %d", kind)
+		}
+	}
+	if body == nil {
+		return nil, nil, errors.New("OP_MSG without body")
+	}
+	return body, docs, nil
+}
+
+// parseOpQuery returns the namespace and query document of an OP_QUERY, a
+// wrapped $query is unwrapped
+func parseOpQuery(data []byte) (string, bsonDoc, error) {
+	if len(data) < 4 {
+		return "", nil, errors.New("OP_QUERY too short")
+	}
+	ns, rest, err := bsonCString(data[4:])
+	if err != nil {
+		return "", nil, err
+	}
+	if len(rest) < 8 {
+		return "", nil, errors.New("OP_QUERY too short")
+	}
+	query, _, err := bsonDecode(rest[8:])
+	if err != nil {
+		return ns, nil, err
+	}
+	if inner, ok := query.Get("$query"); ok {
+		if doc, ok := inner.(bsonDoc); ok {
+			query = doc
+		}
+	}
+	return ns, query, nil
+}
+
+func (s *mongoSession) message(responseTo, opCode int32, body []byte) []byte {
+	s.requestID++
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(16+len(body)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(s.requestID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(responseTo))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(opCode))
+	return append(buf, body...)
+}
+
+func mongoReply(docs ...bsonDoc) []byte {
+	body := binary.LittleEndian.AppendUint32(nil, 0)
+	body = binary.LittleEndian.AppendUint64(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(docs)))
+	for _, doc := range docs {
+		body = append(body, bsonEncode(doc)...)
+	}
+	return body
+}
+
+func mongoMsg(doc bsonDoc) []byte {
+	body := binary.LittleEndian.AppendUint32(nil, 0)
+	body = append(body, 0)
+	return append(body, bsonEncode(doc)...)
+}
+
+// HandleMongoDB emulates an unauthenticated MongoDB 4.4 server over
+// OP_QUERY and OP_MSG and records the commands of ransom bots, from
+// listing and dumping databases to dropping them and inserting the note
+func HandleMongoDB(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedMongoDB{}
+	defer func() {
+		if err := h.ProduceTCP("mongodb", conn, md, helpers.FirstOrEmpty[parsedMongoDB](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "mongodb"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close MongoDB connection", slog.String("protocol", "mongodb"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	session := newMongoSession(conn.RemoteAddr().String())
+	header := make([]byte, 16)
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "mongodb"), producer.ErrAttr(err))
+			return nil
+		}
+		if _, err := io.ReadFull(conn, header); err != nil {
+			logger.Debug("Failed to read MongoDB header", slog.String("protocol", "mongodb"), producer.ErrAttr(err))
+			return nil
+		}
+		length := int(binary.LittleEndian.Uint32(header))
+		requestID := int32(binary.LittleEndian.Uint32(header[4:]))
+		opCode := int32(binary.LittleEndian.Uint32(header[12:]))
+		if length < 16 || length > mongoMaxMessage {
+			logger.Debug("Invalid MongoDB message length", slog.String("protocol", "mongodb"))
+			return nil
+		}
+		data := make([]byte, length-16)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			logger.Debug("Failed to read MongoDB message", slog.String("protocol", "mongodb"), producer.ErrAttr(err))
+			return nil
+		}
+
+		cmd := &mongoCommand{}
+		var resp []byte
+		switch opCode {
+		case mongoOpQuery:
+			ns, query, err := parseOpQuery(data)
+			if err != nil {
+				logger.Debug("Failed to parse OP_QUERY", slog.String("protocol", "mongodb"), producer.ErrAttr(err))
+				break
+			}
+			db, collection, _ := strings.Cut(ns, ".")
+			cmd.Database = db
+			if collection == "$cmd" {
+				resp = session.message(requestID, mongoOpReply, mongoReply(session.command(cmd, query, nil)))
+				break
+			}
+			// legacy find on a collection
+			cmd.Command, cmd.Collection = "query", collection
+			docs := []bsonDoc{}
+			if slices.Contains(session.databases[db], collection) {
+				for _, doc := range mongoFakeDocuments() {
+					docs = append(docs, doc.(bsonDoc))
+				}
+			}
+			resp = session.message(requestID, mongoOpReply, mongoReply(docs...))
+		case mongoOpMsg:
+			body, docs, err := parseOpMsg(data)
+			if err != nil {
+				logger.Debug("Failed to parse OP_MSG", slog.String("protocol", "mongodb"), producer.ErrAttr(err))
+				break
+			}
+			cmd.Database = body.String("$db")
+			resp = session.message(requestID, mongoOpMsg, mongoMsg(session.command(cmd, body, docs)))
+		case mongoOpInsert:
+			// legacy insert, never acknowledged
+			if len(data) < 4 {
+				break
+			}
+			ns, rest, err := bsonCString(data[4:])
+			if err != nil {
+				break
+			}
+			cmd.Command = "insert"
+			cmd.Database, cmd.Collection, _ = strings.Cut(ns, ".")
+			for len(rest) > 0 {
+				doc, next, err := bsonDecode(rest)
+				if err != nil {
+					break
+				}
+				cmd.Documents = append(cmd.Documents, doc.Map())
+				rest = next
+			}
+		default:
+			cmd.Command = "opcode_" + strconv.Itoa(int(opCode))
+		}
+
+		events = append(events, parsedMongoDB{
+			Direction: "read",
+			OpCode:    opCode,
+			Command:   cmd,
+			Payload:   data,
+		})
+		if cmd.Username != "" {
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "mongodb", Username: cmd.Username}, logger, h)
+		}
+		if cmd.Command == "insert" && session.dropped && !slices.Contains(md.Tags, "mongodb_ransom") {
+			md.Tags = append(md.Tags, "mongodb_ransom")
+		}
+		logger.Info(
+			"MongoDB command",
+			slog.String("handler", "mongodb"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("database", cmd.Database),
+			slog.String("command", cmd.Command),
+			slog.String("collection", cmd.Collection),
+			slog.Int("documents", len(cmd.Documents)),
+		)
+		if resp == nil {
+			continue
+		}
+		events = append(events, parsedMongoDB{
+			Direction: "write",
+			Payload:   resp,
+		})
+		if _, err := conn.Write(resp); err != nil {
+			return err
+		}
+	}
+}
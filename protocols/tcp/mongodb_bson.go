@@ -0,0 +1,265 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// bsonElem is a single key and value of a BSON document
+type bsonElem struct {
+	Key   string
+	Value any
+}
+
+// bsonDoc keeps the elements in order since MongoDB takes the command name
+// from the first key
+type bsonDoc []bsonElem
+
+func (d bsonDoc) Get(key string) (any, bool) {
+	for _, elem := range d {
+		if elem.Key == key {
+			return elem.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (d bsonDoc) String(key string) string {
+	value, _ := d.Get(key)
+	s, _ := value.(string)
+	return s
+}
+
+// Map converts the document for logging, object IDs and binary data become
+// hex strings
+func (d bsonDoc) Map() map[string]any {
+	m := make(map[string]any, len(d))
+	for _, elem := range d {
+		m[elem.Key] = bsonPlain(elem.Value)
+	}
+	return m
+}
+
+func bsonPlain(value any) any {
+	switch v := value.(type) {
+	case bsonDoc:
+		return v.Map()
+	case []any:
+		plain := make([]any, len(v))
+		for i, item := range v {
+			plain[i] = bsonPlain(item)
+		}
+		return plain
+	case []byte:
+		return hex.EncodeToString(v)
+	case [12]byte:
+		return hex.EncodeToString(v[:])
+	}
+	return value
+}
+
+func bsonCString(data []byte) (string, []byte, error) {
+	value, rest, found := bytes.Cut(data, []byte{0})
+	if !found {
+		return "", nil, errors.New("unterminated BSON cstring")
+	}
+	return string(value), rest, nil
+}
+
+// documents nested deeper than this are rejected, like MongoDB does
+const bsonMaxDepth = 100
+
+// bsonDecode parses a document and returns it with the remaining bytes
+func bsonDecode(data []byte) (bsonDoc, []byte, error) {
+	return bsonDecodeDepth(data, 0)
+}
+
+func bsonDecodeDepth(data []byte, depth int) (bsonDoc, []byte, error) {
+	if depth > bsonMaxDepth {
+		return nil, nil, errors.New("BSON document nested too deeply")
+	}
+	if len(data) < 5 {
+		return nil, nil, errors.New("BSON document too short")
+	}
+	size := int(binary.LittleEndian.Uint32(data))
+	if size < 5 || size > len(data) || data[size-1] != 0 {
+		return nil, nil, errors.New("invalid BSON document size")
+	}
+	rest := data[4 : size-1]
+	doc := bsonDoc{}
+	for len(rest) > 0 {
+		kind := rest[0]
+		key, next, err := bsonCString(rest[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		value, next, err := bsonDecodeValue(kind, next, depth)
+		if err != nil {
+			return nil, nil, fmt.Errorf("BSON key %q: %w", key, err)
+		}
+		doc = append(doc, bsonElem{Key: key, Value: value})
+		rest = next
+	}
+	return doc, data[size:], nil
+}
+
+func bsonDecodeValue(kind byte, data []byte, depth int) (any, []byte, error) {
+	fixed := func(n int) error {
+		if len(data) < n {
+			return errors.New("BSON value too short")
+		}
+		return nil
+	}
+	switch kind {
+	case 0x01:
+		if err := fixed(8); err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), data[8:], nil
+	case 0x02, 0x0d, 0x0e:
+		if err := fixed(4); err != nil {
+			return nil, nil, err
+		}
+		size := int(binary.LittleEndian.Uint32(data))
+		if size < 1 || len(data) < 4+size {
+			return nil, nil, errors.New("invalid BSON string size")
+		}
+		return string(data[4 : 4+size-1]), data[4+size:], nil
+	case 0x03:
+		return bsonDecodeDepth(data, depth+1)
+	case 0x04:
+		doc, rest, err := bsonDecodeDepth(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		array := make([]any, len(doc))
+		for i, elem := range doc {
+			array[i] = elem.Value
+		}
+		return array, rest, nil
+	case 0x05:
+		if err := fixed(5); err != nil {
+			return nil, nil, err
+		}
+		size := int(binary.LittleEndian.Uint32(data))
+		if size < 0 || len(data) < 5+size {
+			return nil, nil, errors.New("invalid BSON binary size")
+		}
+		return data[5 : 5+size], data[5+size:], nil
+	case 0x06, 0x0a, 0x7f, 0xff:
+		return nil, data, nil
+	case 0x07:
+		if err := fixed(12); err != nil {
+			return nil, nil, err
+		}
+		return [12]byte(data[:12]), data[12:], nil
+	case 0x08:
+		if err := fixed(1); err != nil {
+			return nil, nil, err
+		}
+		return data[0] != 0, data[1:], nil
+	case 0x09:
+		if err := fixed(8); err != nil {
+			return nil, nil, err
+		}
+		return time.UnixMilli(int64(binary.LittleEndian.Uint64(data))).UTC(), data[8:], nil
+	case 0x0b:
+		pattern, rest, err := bsonCString(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, rest, err = bsonCString(rest)
+		return pattern, rest, err
+	case 0x10:
+		if err := fixed(4); err != nil {
+			return nil, nil, err
+		}
+		return int32(binary.LittleEndian.Uint32(data)), data[4:], nil
+	case 0x11, 0x12:
+		if err := fixed(8); err != nil {
+			return nil, nil, err
+		}
+		return int64(binary.LittleEndian.Uint64(data)), data[8:], nil
+	case 0x13:
+		if err := fixed(16); err != nil {
+			return nil, nil, err
+		}
+		return data[:16], data[16:], nil
+	}
+	return nil, nil, fmt.Errorf("unsupported BSON type 0x%02x", kind)
+}
+
+// bsonEncode serializes a document, values of unknown types are encoded as
+// null
+func bsonEncode(doc bsonDoc) []byte {
+	body := []byte{}
+	for _, elem := range doc {
+		body = bsonAppendValue(body, elem.Key, elem.Value)
+	}
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(body)+5))
+	buf = append(buf, body...)
+	return append(buf, 0)
+}
+
+func bsonAppendValue(buf []byte, key string, value any) []byte {
+	header := func(kind byte) {
+		buf = append(buf, kind)
+		buf = append(buf, key...)
+		buf = append(buf, 0)
+	}
+	switch v := value.(type) {
+	case float64:
+		header(0x01)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	case string:
+		header(0x02)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(v)+1))
+		buf = append(buf, v...)
+		buf = append(buf, 0)
+	case bsonDoc:
+		header(0x03)
+		buf = append(buf, bsonEncode(v)...)
+	case []any:
+		header(0x04)
+		array := make(bsonDoc, len(v))
+		for i, item := range v {
+			array[i] = bsonElem{Key: fmt.Sprint(i), Value: item}
+		}
+		buf = append(buf, bsonEncode(array)...)
+	case []byte:
+		header(0x05)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(v)))
+		buf = append(buf, 0x00)
+		buf = append(buf, v...)
+	case [12]byte:
+		header(0x07)
+		buf = append(buf, v[:]...)
+	case bool:
+		header(0x08)
+		if v {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	case time.Time:
+		header(0x09)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(v.UnixMilli()))
+	case int32:
+		header(0x10)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(v))
+	case int:
+		header(0x10)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(v))
+	case int64:
+		header(0x12)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(v))
+	default:
+		header(0x0a)
+	}
+	return buf
+}
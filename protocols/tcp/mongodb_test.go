@@ -0,0 +1,139 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBSONRoundTrip(t *testing.T) {
+	doc := bsonDoc{
+		{"insert", "README"},
+		{"n", int32(3)},
+		{"big", int64(1 << 40)},
+		{"ok", 1.0},
+		{"flag", true},
+		{"none", nil},
+		{"when", time.UnixMilli(1700000000000).UTC()},
+		{"nested", bsonDoc{{"a", "b"}}},
+		{"list", []any{"x", int32(1)}},
+		{"bin", []byte{1, 2, 3}},
+		{"_id", [12]byte{1}},
+	}
+	decoded, rest, err := bsonDecode(bsonEncode(doc))
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Equal(t, doc, decoded)
+
+	// a document nested deeper than MongoDB allows
+	deep := bsonDoc{{"x", int32(1)}}
+	for i := 0; i < bsonMaxDepth+2; i++ {
+		deep = bsonDoc{{"x", deep}}
+	}
+	_, _, err = bsonDecode(bsonEncode(deep))
+	require.Error(t, err)
+}
+
+func TestMongoRansomFlow(t *testing.T) {
+	session := newMongoSession("1.2.3.4:5555")
+
+	reply := session.command(&mongoCommand{Database: "admin"}, bsonDoc{{"isMaster", int32(1)}}, nil)
+	require.Equal(t, true, reply[0].Value)
+
+	reply = session.command(&mongoCommand{Database: "admin"}, bsonDoc{{"listDatabases", int32(1)}}, nil)
+	databases, _ := reply.Get("databases")
+	require.Len(t, databases, 4)
+
+	cmd := &mongoCommand{Database: "customers"}
+	reply = session.command(cmd, bsonDoc{{"find", "users"}}, nil)
+	cursor, _ := reply.Get("cursor")
+	batch, _ := cursor.(bsonDoc).Get("firstBatch")
+	require.Len(t, batch, 3)
+	require.Equal(t, "users", cmd.Collection)
+
+	session.command(&mongoCommand{Database: "customers"}, bsonDoc{{"dropDatabase", int32(1)}}, nil)
+	require.True(t, session.dropped)
+
+	cmd = &mongoCommand{Database: "READ__ME_TO_RECOVER_YOUR_DATA"}
+	reply = session.command(cmd, bsonDoc{{"insert", "README"}}, []bsonDoc{{{"content", "All your data is backed up. Send 0.01 BTC"}}})
+	require.Equal(t, int32(1), reply[0].Value)
+	require.Equal(t, "All your data is backed up. Send 0.01 BTC", cmd.Documents[0]["content"])
+	require.Contains(t, session.databases, "READ__ME_TO_RECOVER_YOUR_DATA")
+
+	reply = session.command(&mongoCommand{}, bsonDoc{{"eval", "db.x()"}}, nil)
+	require.Equal(t, int32(59), reply[2].Value)
+}
+
+func TestParseOpMsg(t *testing.T) {
+	body := bsonEncode(bsonDoc{{"insert", "README"}, {"$db", "ransom"}})
+	note := bsonEncode(bsonDoc{{"content", "pay"}})
+	seq := binary.LittleEndian.AppendUint32(nil, uint32(4+len("documents")+1+len(note)))
+	seq = append(append(seq, "documents\x00"...), note...)
+
+	data := binary.LittleEndian.AppendUint32(nil, 0)
+	data = append(append(data, 0), body...)
+	data = append(append(data, 1), seq...)
+	doc, docs, err := parseOpMsg(data)
+	require.NoError(t, err)
+	require.Equal(t, "ransom", doc.String("$db"))
+	require.Len(t, docs, 1)
+}
+
+func TestHandleMongoDBSASL(t *testing.T) {
+	isolateBruteForce(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+
+	creds := make(chan string, 1)
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("mongodb", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(_ string, _ net.Conn, _ connection.Metadata, _ []byte, event interface{}) {
+			if _, ok := event.([]parsedMongoDB); ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			require.NoError(t, err)
+			creds <- string(data)
+		}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("MongoDB command", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	done := make(chan error)
+	go func() {
+		done <- HandleMongoDB(context.Background(), server, connection.Metadata{TargetPort: 27017}, l, h)
+	}()
+
+	// the SCRAM-SHA-256 client-first message of the mongo shell
+	body := mongoMsg(bsonDoc{{"saslStart", int32(1)}, {"mechanism", "SCRAM-SHA-256"}, {"payload", []byte("n,,n=admin,r=rOprNGfwEbeRWgbNEkqO")}, {"$db", "admin"}})
+	msg := binary.LittleEndian.AppendUint32(nil, uint32(16+len(body)))
+	msg = binary.LittleEndian.AppendUint32(msg, 1)
+	msg = binary.LittleEndian.AppendUint32(msg, 0)
+	msg = binary.LittleEndian.AppendUint32(msg, mongoOpMsg)
+	_, err = client.Write(append(msg, body...))
+	require.NoError(t, err)
+	header := make([]byte, 16)
+	_, err = io.ReadFull(client, header)
+	require.NoError(t, err)
+	client.Close()
+	require.NoError(t, <-done)
+
+	require.JSONEq(t, `{"event": "credential", "protocol": "mongodb", "username": "admin", "success": false}`, <-creds)
+}
@@ -0,0 +1,291 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	tdsPreLogin     = 0x12
+	tdsLogin7       = 0x10
+	tdsTabularReply = 0x04
+	tdsStatusEOM    = 0x01
+	tdsHeaderLen    = 8
+	tdsMaxPacket    = 32767
+)
+
+type tdsHeader struct {
+	Type     uint8
+	Status   uint8
+	Length   uint16
+	SPID     uint16
+	PacketID uint8
+	Window   uint8
+}
+
+type mssqlLogin struct {
+	TDSVersion uint32 `json:"tds_version,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	AppName    string `json:"app_name,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+	Library    string `json:"library,omitempty"`
+	Language   string `json:"language,omitempty"`
+	Database   string `json:"database,omitempty"`
+}
+
+type parsedMSSQL struct {
+	Direction string      `json:"direction,omitempty"`
+	Type      uint8       `json:"type,omitempty"`
+	Login     *mssqlLogin `json:"login,omitempty"`
+	Payload   []byte      `json:"payload,omitempty"`
+}
+
+type mssqlServer struct {
+	events []parsedMSSQL
+	conn   net.Conn
+}
+
+// readPacket reads a TDS message, joining packets until end of message
+func (s *mssqlServer) readPacket() (uint8, []byte, error) {
+	var (
+		msgType uint8
+		payload []byte
+	)
+	for {
+		header := tdsHeader{}
+		if err := binary.Read(s.conn, binary.BigEndian, &header); err != nil {
+			return 0, nil, err
+		}
+		if header.Length < tdsHeaderLen {
+			return 0, nil, errors.New("invalid TDS packet length")
+		}
+		data := make([]byte, header.Length-tdsHeaderLen)
+		if _, err := io.ReadFull(s.conn, data); err != nil {
+			return 0, nil, err
+		}
+		msgType = header.Type
+		payload = append(payload, data...)
+		if header.Status&tdsStatusEOM != 0 || len(payload) > tdsMaxPacket {
+			break
+		}
+	}
+	return msgType, payload, nil
+}
+
+func (s *mssqlServer) write(msgType uint8, payload []byte) error {
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.BigEndian, tdsHeader{
+		Type:     msgType,
+		Status:   tdsStatusEOM,
+		Length:   uint16(tdsHeaderLen + len(payload)),
+		PacketID: 1,
+	}); err != nil {
+		return err
+	}
+	buf.Write(payload)
+	s.events = append(s.events, parsedMSSQL{
+		Direction: "write",
+		Type:      msgType,
+		Payload:   buf.Bytes(),
+	})
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+// preLoginResponse advertises SQL Server 2019 without encryption support
+func preLoginResponse() []byte {
+	options := []struct {
+		token uint8
+		data  []byte
+	}{
+		{0x00, []byte{0x0f, 0x00, 0x07, 0xd0, 0x00, 0x00}}, // VERSION 15.0.2000
+		{0x01, []byte{0x02}}, // ENCRYPTION: ENCRYPT_NOT_SUP
+		{0x02, []byte{0x00}}, // INSTOPT
+		{0x03, []byte{}},     // THREADID
+		{0x04, []byte{0x00}}, // MARS
+	}
+	offset := len(options)*5 + 1
+	head := &bytes.Buffer{}
+	body := &bytes.Buffer{}
+	for _, opt := range options {
+		head.WriteByte(opt.token)
+		binary.Write(head, binary.BigEndian, uint16(offset+body.Len()))
+		binary.Write(head, binary.BigEndian, uint16(len(opt.data)))
+		body.Write(opt.data)
+	}
+	head.WriteByte(0xff)
+	return append(head.Bytes(), body.Bytes()...)
+}
+
+func decodeUCS2(data []byte) string {
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
+func encodeUCS2(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	data := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(data[i*2:], c)
+	}
+	return data
+}
+
+// decodeTDSPassword reverses the TDS password obfuscation: every byte is
+// XORed with 0xA5 and has its nibbles swapped
+func decodeTDSPassword(data []byte) string {
+	plain := make([]byte, len(data))
+	for i, b := range data {
+		b ^= 0xa5
+		plain[i] = b<<4 | b>>4
+	}
+	return decodeUCS2(plain)
+}
+
+// parseLogin7 extracts the client fields from a Login7 message
+func parseLogin7(data []byte) (*mssqlLogin, error) {
+	// fixed header followed by the offset/length table up to the database field
+	if len(data) < 36+9*4 {
+		return nil, errors.New("Login7 message too short")
+	}
+	field := func(idx int, password bool) string {
+		pos := 36 + idx*4
+		offset := int(binary.LittleEndian.Uint16(data[pos:]))
+		length := int(binary.LittleEndian.Uint16(data[pos+2:])) * 2
+		if length == 0 || offset+length > len(data) {
+			return ""
+		}
+		if password {
+			return decodeTDSPassword(data[offset : offset+length])
+		}
+		return decodeUCS2(data[offset : offset+length])
+	}
+	return &mssqlLogin{
+		TDSVersion: binary.LittleEndian.Uint32(data[4:8]),
+		Hostname:   field(0, false),
+		Username:   field(1, false),
+		Password:   field(2, true),
+		AppName:    field(3, false),
+		ServerName: field(4, false),
+		Library:    field(6, false),
+		Language:   field(7, false),
+		Database:   field(8, false),
+	}, nil
+}
+
+// loginFailed creates the ERROR and DONE tokens of a failed login
+func loginFailed(username string) []byte {
+	msg := encodeUCS2(fmt.Sprintf("Login failed for user '%s'.", username))
+	server := encodeUCS2("MSSQLSERVER")
+
+	token := &bytes.Buffer{}
+	binary.Write(token, binary.LittleEndian, uint32(18456)) // error number
+	token.WriteByte(1)                                      // state
+	token.WriteByte(14)                                     // class
+	binary.Write(token, binary.LittleEndian, uint16(len(msg)/2))
+	token.Write(msg)
+	token.WriteByte(uint8(len(server) / 2))
+	token.Write(server)
+	token.WriteByte(0) // procedure name
+	binary.Write(token, binary.LittleEndian, uint32(1))
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte(0xaa) // ERROR
+	binary.Write(buf, binary.LittleEndian, uint16(token.Len()))
+	buf.Write(token.Bytes())
+	buf.WriteByte(0xfd)                                 // DONE
+	binary.Write(buf, binary.LittleEndian, uint16(0x2)) // DONE_ERROR
+	binary.Write(buf, binary.LittleEndian, uint16(0))
+	binary.Write(buf, binary.LittleEndian, uint64(0))
+	return buf.Bytes()
+}
+
+// HandleMSSQL takes a net.Conn and does basic MSSQL (TDS) communication
+func HandleMSSQL(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	server := &mssqlServer{
+		events: []parsedMSSQL{},
+		conn:   conn,
+	}
+	defer func() {
+		if err := h.ProduceTCP("mssql", conn, md, helpers.FirstOrEmpty[parsedMSSQL](server.events).Payload, server.events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "mssql"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close MSSQL connection", slog.String("protocol", "mssql"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "mssql"), producer.ErrAttr(err))
+			return nil
+		}
+		msgType, payload, err := server.readPacket()
+		if err != nil {
+			logger.Debug("Failed to read TDS packet", slog.String("protocol", "mssql"), producer.ErrAttr(err))
+			return nil
+		}
+		event := parsedMSSQL{
+			Direction: "read",
+			Type:      msgType,
+			Payload:   payload,
+		}
+
+		switch msgType {
+		case tdsPreLogin:
+			server.events = append(server.events, event)
+			if err := server.write(tdsTabularReply, preLoginResponse()); err != nil {
+				return err
+			}
+		case tdsLogin7:
+			login, err := parseLogin7(payload)
+			if err != nil {
+				server.events = append(server.events, event)
+				return err
+			}
+			event.Login = login
+			server.events = append(server.events, event)
+			logger.Info(
+				"MSSQL login attempt",
+				slog.String("handler", "mssql"),
+				slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+				slog.String("src_ip", host),
+				slog.String("src_port", port),
+				slog.String("username", login.Username),
+				slog.String("password", login.Password),
+				slog.String("app_name", login.AppName),
+				slog.String("hostname", login.Hostname),
+				slog.String("database", login.Database),
+			)
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "mssql", Username: login.Username, Password: login.Password}, logger, h)
+			return server.write(tdsTabularReply, loginFailed(login.Username))
+		default:
+			server.events = append(server.events, event)
+			return nil
+		}
+	}
+}
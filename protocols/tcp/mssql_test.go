@@ -0,0 +1,61 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func obfuscateTDSPassword(password string) []byte {
+	data := encodeUCS2(password)
+	for i, b := range data {
+		data[i] = (b<<4 | b>>4) ^ 0xa5
+	}
+	return data
+}
+
+func TestParseLogin7(t *testing.T) {
+	fields := [][]byte{
+		encodeUCS2("WORKSTATION"),
+		encodeUCS2("sa"),
+		obfuscateTDSPassword("P@ssw0rd"),
+		encodeUCS2("sqlmap"),
+		encodeUCS2("1.2.3.4"),
+		{},
+		encodeUCS2("ODBC"),
+		{},
+		encodeUCS2("master"),
+	}
+	fixed := make([]byte, 36)
+	binary.LittleEndian.PutUint32(fixed[4:], 0x74000004)
+	table := &bytes.Buffer{}
+	data := &bytes.Buffer{}
+	offset := len(fixed) + len(fields)*4
+	for _, f := range fields {
+		binary.Write(table, binary.LittleEndian, uint16(offset+data.Len()))
+		binary.Write(table, binary.LittleEndian, uint16(len(f)/2))
+		data.Write(f)
+	}
+	msg := append(append(fixed, table.Bytes()...), data.Bytes()...)
+
+	login, err := parseLogin7(msg)
+	require.NoError(t, err)
+	require.Equal(t, "sa", login.Username)
+	require.Equal(t, "P@ssw0rd", login.Password)
+	require.Equal(t, "WORKSTATION", login.Hostname)
+	require.Equal(t, "sqlmap", login.AppName)
+	require.Equal(t, "master", login.Database)
+	require.Equal(t, uint32(0x74000004), login.TDSVersion)
+
+	_, err = parseLogin7(msg[:20])
+	require.Error(t, err)
+}
+
+func TestPreLoginResponse(t *testing.T) {
+	resp := preLoginResponse()
+	require.Equal(t, uint8(0x00), resp[0], "expected version option first")
+	offset := binary.BigEndian.Uint16(resp[1:3])
+	require.Equal(t, []byte{0x0f, 0x00, 0x07, 0xd0, 0x00, 0x00}, resp[offset:offset+6])
+}
@@ -0,0 +1,563 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	mysqlVersion       = "8.0.36-0ubuntu0.22.04.1"
+	mysqlNativePlugin  = "mysql_native_password"
+	mysqlMaxPacket     = 1 << 16
+	mysqlMaxQueries    = 5
+	mysqlStatusAutoCmt = 0x0002
+
+	mysqlClientConnectWithDB  = 0x00000008
+	mysqlClientProtocol41     = 0x00000200
+	mysqlClientSSL            = 0x00000800
+	mysqlClientSecureConn     = 0x00008000
+	mysqlClientPluginAuth     = 0x00080000
+	mysqlClientConnectAttrs   = 0x00100000
+	mysqlClientPluginAuthLenc = 0x00200000
+	// everything up to CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA except
+	// compression and SSL
+	mysqlServerCapabilities = 0x003ff7df
+
+	mysqlComQuit           = 0x01
+	mysqlComInitDB         = 0x02
+	mysqlComQuery          = 0x03
+	mysqlComPing           = 0x0e
+	mysqlComBinlogDump     = 0x12
+	mysqlComRegisterSlave  = 0x15
+	mysqlComBinlogDumpGTID = 0x1e
+
+	mysqlBinlogQuery       = 0x02
+	mysqlBinlogRotate      = 0x04
+	mysqlBinlogFormatDesc  = 0x0f
+	mysqlBinlogHeaderSize  = 19
+	mysqlBinlogArtificial  = 0x0020
+	mysqlBinlogChecksumCRC = 0x01
+	mysqlBinlogFile        = "binlog.000042"
+)
+
+var mysqlDatabases = []string{"information_schema", "mysql", "performance_schema", "sys", "wordpress"}
+
+type mysqlLogin struct {
+	Username    string            `json:"username,omitempty"`
+	Database    string            `json:"database,omitempty"`
+	AuthPlugin  string            `json:"auth_plugin,omitempty"`
+	Salt        string            `json:"salt,omitempty"`
+	Hash        string            `json:"hash,omitempty"`
+	ClientAttrs map[string]string `json:"client_attrs,omitempty"`
+}
+
+// mysqlReplication is a binlog dump requested by a client posing as a replica
+type mysqlReplication struct {
+	Command  string `json:"command"`
+	ServerID uint32 `json:"server_id"`
+	File     string `json:"file,omitempty"`
+	Position uint64 `json:"position"`
+}
+
+type parsedMySQL struct {
+	Direction   string            `json:"direction,omitempty"`
+	Login       *mysqlLogin       `json:"login,omitempty"`
+	Query       string            `json:"query,omitempty"`
+	Replication *mysqlReplication `json:"replication,omitempty"`
+	Payload     []byte            `json:"payload,omitempty"`
+}
+
+type mysqlServer struct {
+	events []parsedMySQL
+	conn   net.Conn
+	seq    uint8
+}
+
+func (s *mysqlServer) readPacket() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if length > mysqlMaxPacket {
+		return nil, errors.New("MySQL packet too large")
+	}
+	s.seq = header[3] + 1
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// write sends each payload as a packet with the next sequence number
+func (s *mysqlServer) write(payloads ...[]byte) error {
+	buf := &bytes.Buffer{}
+	for _, payload := range payloads {
+		buf.Write([]byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), s.seq})
+		buf.Write(payload)
+		s.seq++
+	}
+	s.events = append(s.events, parsedMySQL{
+		Direction: "write",
+		Payload:   buf.Bytes(),
+	})
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+// mysqlGreeting creates the protocol 10 handshake offering native password
+// authentication with the given 20 byte scramble
+func mysqlGreeting(connID uint32, scramble []byte) []byte {
+	buf := []byte{0x0a}
+	buf = append(buf, mysqlVersion...)
+	buf = append(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, connID)
+	buf = append(buf, scramble[:8]...)
+	buf = append(buf, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(mysqlServerCapabilities&0xffff))
+	buf = append(buf, 0xff) // utf8mb4_0900_ai_ci
+	buf = binary.LittleEndian.AppendUint16(buf, mysqlStatusAutoCmt)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(mysqlServerCapabilities>>16))
+	buf = append(buf, byte(len(scramble)+1))
+	buf = append(buf, make([]byte, 10)...)
+	buf = append(buf, scramble[8:]...)
+	buf = append(buf, 0)
+	buf = append(buf, mysqlNativePlugin...)
+	return append(buf, 0)
+}
+
+// readLenEnc decodes a length encoded integer
+func readLenEnc(data []byte) (uint64, []byte, bool) {
+	if len(data) < 1 {
+		return 0, data, false
+	}
+	size := map[byte]int{0xfc: 2, 0xfd: 3, 0xfe: 8}[data[0]]
+	if size == 0 {
+		return uint64(data[0]), data[1:], data[0] < 0xfb
+	}
+	if len(data) < 1+size {
+		return 0, data, false
+	}
+	value := uint64(0)
+	for i := size; i > 0; i-- {
+		value = value<<8 | uint64(data[i])
+	}
+	return value, data[1+size:], true
+}
+
+func readLenEncString(data []byte) (string, []byte, bool) {
+	size, rest, ok := readLenEnc(data)
+	if !ok || uint64(len(rest)) < size {
+		return "", data, false
+	}
+	return string(rest[:size]), rest[size:], true
+}
+
+func readNullString(data []byte) (string, []byte) {
+	value, rest, found := bytes.Cut(data, []byte{0})
+	if !found {
+		return string(data), nil
+	}
+	return string(value), rest
+}
+
+func appendLenEncString(buf []byte, value string) []byte {
+	switch {
+	case len(value) < 0xfb:
+		buf = append(buf, byte(len(value)))
+	default:
+		buf = append(buf, 0xfc)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(value)))
+	}
+	return append(buf, value...)
+}
+
+// parseHandshakeResponse decodes a protocol 41 handshake response and
+// returns the login with the raw auth response
+func parseHandshakeResponse(data []byte) (*mysqlLogin, []byte, error) {
+	if len(data) < 32 {
+		return nil, nil, errors.New("MySQL handshake response too short")
+	}
+	caps := binary.LittleEndian.Uint32(data)
+	if caps&mysqlClientProtocol41 == 0 {
+		return nil, nil, errors.New("MySQL client does not support protocol 41")
+	}
+	login := &mysqlLogin{}
+	rest := data[32:]
+	if len(rest) == 0 && caps&mysqlClientSSL != 0 {
+		return nil, nil, errors.New("MySQL client requested SSL")
+	}
+	login.Username, rest = readNullString(rest)
+
+	var auth []byte
+	switch {
+	case caps&mysqlClientPluginAuthLenc != 0:
+		value, next, ok := readLenEncString(rest)
+		if !ok {
+			return login, nil, errors.New("invalid MySQL auth response")
+		}
+		auth, rest = []byte(value), next
+	case caps&mysqlClientSecureConn != 0:
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return login, nil, errors.New("invalid MySQL auth response")
+		}
+		auth, rest = rest[1:1+int(rest[0])], rest[1+int(rest[0]):]
+	default:
+		var value string
+		value, rest = readNullString(rest)
+		auth = []byte(value)
+	}
+	if caps&mysqlClientConnectWithDB != 0 {
+		login.Database, rest = readNullString(rest)
+	}
+	if caps&mysqlClientPluginAuth != 0 {
+		login.AuthPlugin, rest = readNullString(rest)
+	}
+	if caps&mysqlClientConnectAttrs != 0 {
+		size, next, ok := readLenEnc(rest)
+		if ok && uint64(len(next)) >= size {
+			attrs := next[:size]
+			login.ClientAttrs = map[string]string{}
+			for len(attrs) > 0 {
+				key, next, ok := readLenEncString(attrs)
+				if !ok {
+					break
+				}
+				value, next, ok := readLenEncString(next)
+				if !ok {
+					break
+				}
+				login.ClientAttrs[key] = value
+				attrs = next
+			}
+		}
+	}
+	return login, auth, nil
+}
+
+func mysqlOK() []byte {
+	buf := []byte{0x00, 0x00, 0x00}
+	buf = binary.LittleEndian.AppendUint16(buf, mysqlStatusAutoCmt)
+	return binary.LittleEndian.AppendUint16(buf, 0)
+}
+
+func mysqlEOF() []byte {
+	buf := []byte{0xfe, 0x00, 0x00}
+	return binary.LittleEndian.AppendUint16(buf, mysqlStatusAutoCmt)
+}
+
+func mysqlError(code uint16, state, msg string) []byte {
+	buf := binary.LittleEndian.AppendUint16([]byte{0xff}, code)
+	buf = append(buf, '#')
+	buf = append(buf, state...)
+	return append(buf, msg...)
+}
+
+// mysqlResultSet creates the packets of a text result set with a single
+// string column
+func mysqlResultSet(column string, rows ...string) [][]byte {
+	def := appendLenEncString(nil, "def")
+	for _, field := range []string{"", "", "", column, ""} {
+		def = appendLenEncString(def, field)
+	}
+	def = append(def, 0x0c)
+	def = binary.LittleEndian.AppendUint16(def, 0x21) // utf8_general_ci
+	def = binary.LittleEndian.AppendUint32(def, 256)
+	def = append(def, 0xfd, 0x00, 0x00, 0x1f, 0x00, 0x00)
+
+	packets := [][]byte{{0x01}, def, mysqlEOF()}
+	for _, row := range rows {
+		packets = append(packets, appendLenEncString(nil, row))
+	}
+	return append(packets, mysqlEOF())
+}
+
+// mysqlQueryResponse answers the handful of queries clients and scanners send
+// right after logging in
+func mysqlQueryResponse(query, username string) [][]byte {
+	query = strings.TrimRight(strings.TrimSpace(query), "; ")
+	normalized := strings.ToLower(query)
+	switch {
+	case normalized == "select version()" || normalized == "select @@version":
+		// the column is named after the expression as it was written
+		return mysqlResultSet(query[len("select "):], mysqlVersion)
+	case normalized == "select @@version_comment limit 1":
+		return mysqlResultSet("@@version_comment", "(Ubuntu)")
+	case normalized == "show databases":
+		return mysqlResultSet("Database", mysqlDatabases...)
+	case strings.HasPrefix(normalized, "set "), strings.HasPrefix(normalized, "use "):
+		return [][]byte{mysqlOK()}
+	}
+	command, _, _ := strings.Cut(query, " ")
+	return [][]byte{mysqlError(1142, "42000", fmt.Sprintf("%s command denied to user '%s'@'%%'", strings.ToUpper(command), username))}
+}
+
+// parseBinlogDump decodes a COM_BINLOG_DUMP or COM_BINLOG_DUMP_GTID request
+func parseBinlogDump(data []byte) (*mysqlReplication, error) {
+	if len(data) < 11 {
+		return nil, errors.New("MySQL binlog dump request too short")
+	}
+	if data[0] == mysqlComBinlogDump {
+		return &mysqlReplication{
+			Command:  "binlog_dump",
+			Position: uint64(binary.LittleEndian.Uint32(data[1:])),
+			ServerID: binary.LittleEndian.Uint32(data[7:]),
+			File:     string(data[11:]),
+		}, nil
+	}
+	// the GTID variant carries a length prefixed file name and a 64 bit
+	// position followed by the GTID set
+	replication := &mysqlReplication{
+		Command:  "binlog_dump_gtid",
+		ServerID: binary.LittleEndian.Uint32(data[3:]),
+	}
+	size := int(binary.LittleEndian.Uint32(data[7:]))
+	if len(data) < 11+size+8 {
+		return nil, errors.New("invalid MySQL binlog dump request")
+	}
+	replication.File = string(data[11 : 11+size])
+	replication.Position = binary.LittleEndian.Uint64(data[11+size:])
+	return replication, nil
+}
+
+// mysqlBinlogEvent frames a binlog event ending at pos as a network packet,
+// the events carry a CRC32 checksum as announced by the format description
+func mysqlBinlogEvent(eventType byte, pos uint32, flags uint16, body []byte) []byte {
+	timestamp := uint32(time.Now().Unix())
+	if flags&mysqlBinlogArtificial != 0 {
+		timestamp = 0
+	}
+	event := binary.LittleEndian.AppendUint32(nil, timestamp)
+	event = append(event, eventType)
+	event = binary.LittleEndian.AppendUint32(event, 1) // server ID
+	event = binary.LittleEndian.AppendUint32(event, uint32(mysqlBinlogHeaderSize+len(body)+4))
+	event = binary.LittleEndian.AppendUint32(event, pos)
+	event = binary.LittleEndian.AppendUint16(event, flags)
+	event = append(event, body...)
+	event = binary.LittleEndian.AppendUint32(event, crc32.ChecksumIEEE(event))
+	return append([]byte{0x00}, event...)
+}
+
+// mysqlBinlogStream creates the start of a binlog as streamed to a replica:
+// the artificial rotate to the current file, the format description and a
+// transaction touching the fake database
+func mysqlBinlogStream() [][]byte {
+	rotate := binary.LittleEndian.AppendUint64(nil, 4)
+	rotate = append(rotate, mysqlBinlogFile...)
+
+	desc := binary.LittleEndian.AppendUint16(nil, 4)
+	desc = append(desc, mysqlVersion...)
+	desc = append(desc, make([]byte, 50-len(mysqlVersion))...)
+	desc = binary.LittleEndian.AppendUint32(desc, 0)
+	desc = append(desc, mysqlBinlogHeaderSize)
+	// post header lengths of the event types of a MySQL 8.0 server
+	desc = append(desc, 0, 13, 0, 8, 0, 0, 0, 0, 4, 0, 4, 0, 0, 0, 98, 0, 4, 26, 8, 0, 0, 0, 8, 8, 8, 2, 0, 0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0, 10, 40, 0)
+	desc = append(desc, mysqlBinlogChecksumCRC)
+
+	packets := [][]byte{mysqlBinlogEvent(mysqlBinlogRotate, 0, mysqlBinlogArtificial, rotate)}
+	pos := uint32(4)
+	for _, event := range []struct {
+		eventType byte
+		body      []byte
+	}{
+		{mysqlBinlogFormatDesc, desc},
+		{mysqlBinlogQuery, mysqlBinlogQueryEvent("wordpress", "BEGIN")},
+		{mysqlBinlogQuery, mysqlBinlogQueryEvent("wordpress", "UPDATE wp_options SET option_value = '1' WHERE option_name = 'cron'")},
+		{mysqlBinlogQuery, mysqlBinlogQueryEvent("wordpress", "COMMIT")},
+	} {
+		pos += uint32(mysqlBinlogHeaderSize + len(event.body) + 4)
+		packets = append(packets, mysqlBinlogEvent(event.eventType, pos, 0, event.body))
+	}
+	return packets
+}
+
+// mysqlBinlogQueryEvent creates the body of a query event without status
+// variables
+func mysqlBinlogQueryEvent(database, query string) []byte {
+	body := binary.LittleEndian.AppendUint32(nil, 8) // thread ID
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = append(body, byte(len(database)))
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = append(body, database...)
+	body = append(body, 0)
+	return append(body, query...)
+}
+
+// HandleMySQL accepts any MySQL login, captures the native password hash and
+// answers a few queries before disconnecting. Clients requesting a binlog
+// dump are tagged and sent a few fake events.
+func HandleMySQL(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	server := &mysqlServer{
+		events: []parsedMySQL{},
+		conn:   conn,
+	}
+	defer func() {
+		if err := h.ProduceTCP("mysql", conn, md, helpers.FirstOrEmpty[parsedMySQL](server.events).Payload, server.events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close MySQL connection", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	// the first four bytes become the connection ID
+	scramble := make([]byte, 24)
+	if _, err := rand.Read(scramble); err != nil {
+		return err
+	}
+	connID := binary.LittleEndian.Uint32(scramble) % 100000
+	scramble = scramble[4:]
+	// the scramble must not contain NUL bytes
+	for i := range scramble {
+		scramble[i] = scramble[i]&0x7f | 0x01
+	}
+	if err := server.write(mysqlGreeting(connID, scramble)); err != nil {
+		return err
+	}
+
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		logger.Debug("Failed to set connection timeout", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+		return nil
+	}
+	data, err := server.readPacket()
+	if err != nil {
+		logger.Debug("Failed to read MySQL handshake response", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+		return nil
+	}
+	login, auth, err := parseHandshakeResponse(data)
+	if err != nil {
+		server.events = append(server.events, parsedMySQL{Direction: "read", Payload: data})
+		logger.Debug("Failed to parse MySQL handshake response", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+		return nil
+	}
+
+	// clients defaulting to another plugin are switched to native password
+	// so the hash can be cracked offline
+	if login.AuthPlugin != "" && login.AuthPlugin != mysqlNativePlugin {
+		switchReq := append([]byte{0xfe}, mysqlNativePlugin...)
+		switchReq = append(switchReq, 0)
+		switchReq = append(append(switchReq, scramble...), 0)
+		if err := server.write(switchReq); err != nil {
+			return err
+		}
+		if auth, err = server.readPacket(); err != nil {
+			logger.Debug("Failed to read MySQL auth switch response", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+			return nil
+		}
+		login.AuthPlugin = mysqlNativePlugin
+	}
+	login.Salt = hex.EncodeToString(scramble)
+	if len(auth) > 0 {
+		login.Hash = fmt.Sprintf("$mysqlna$%s*%s", login.Salt, hex.EncodeToString(auth))
+	}
+	server.events = append(server.events, parsedMySQL{
+		Direction: "read",
+		Login:     login,
+		Payload:   data,
+	})
+	logger.Info(
+		"MySQL login attempt",
+		slog.String("handler", "mysql"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("username", login.Username),
+		slog.String("hash", login.Hash),
+		slog.String("database", login.Database),
+	)
+	helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "mysql", Username: login.Username, Hash: login.Hash, HashType: "mysql-native", Success: true}, logger, h)
+	if err := server.write(mysqlOK()); err != nil {
+		return err
+	}
+
+	for i := 0; i < mysqlMaxQueries; i++ {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+			return nil
+		}
+		data, err := server.readPacket()
+		if err != nil || len(data) == 0 {
+			logger.Debug("Failed to read MySQL command", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+			return nil
+		}
+		event := parsedMySQL{
+			Direction: "read",
+			Payload:   data,
+		}
+		var resp [][]byte
+		switch data[0] {
+		case mysqlComQuit:
+			server.events = append(server.events, event)
+			return nil
+		case mysqlComInitDB, mysqlComPing, mysqlComRegisterSlave:
+			resp = [][]byte{mysqlOK()}
+		case mysqlComBinlogDump, mysqlComBinlogDumpGTID:
+			replication, err := parseBinlogDump(data)
+			if err != nil {
+				server.events = append(server.events, event)
+				logger.Debug("Failed to parse MySQL binlog dump request", slog.String("protocol", "mysql"), producer.ErrAttr(err))
+				return nil
+			}
+			event.Replication = replication
+			server.events = append(server.events, event)
+			logger.Info(
+				"MySQL replication request",
+				slog.String("handler", "mysql"),
+				slog.String("src_ip", host),
+				slog.String("username", login.Username),
+				slog.Uint64("server_id", uint64(replication.ServerID)),
+				slog.String("file", replication.File),
+				slog.Uint64("position", replication.Position),
+			)
+			if !slices.Contains(md.Tags, "db_replication_abuse") {
+				md.Tags = append(md.Tags, "db_replication_abuse")
+			}
+			// the dump is never continued, the replica sees the primary
+			// going away after the first transaction
+			return server.write(mysqlBinlogStream()...)
+		case mysqlComQuery:
+			event.Query = string(data[1:])
+			logger.Info(
+				"MySQL query",
+				slog.String("handler", "mysql"),
+				slog.String("src_ip", host),
+				slog.String("username", login.Username),
+				slog.String("query", event.Query),
+			)
+			resp = mysqlQueryResponse(event.Query, login.Username)
+		default:
+			resp = [][]byte{mysqlError(1047, "08S01", "Unknown command")}
+		}
+		server.events = append(server.events, event)
+		if err := server.write(resp...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLHandshake(t *testing.T) {
+	scramble := []byte("abcdefghijklmnopqrst")
+	greeting := mysqlGreeting(42, scramble)
+	require.Equal(t, byte(0x0a), greeting[0])
+	require.Contains(t, string(greeting), mysqlVersion)
+	require.Contains(t, string(greeting), "abcdefgh\x00")
+	require.Contains(t, string(greeting), "ijklmnopqrst\x00"+mysqlNativePlugin)
+
+	// handshake response of the mysql 8.0 command line client
+	data, err := hex.DecodeString("8da2bf0900000001ff0000000000000000000000000000000000000000000000726f6f740014" +
+		"0102030405060708090a0b0c0d0e0f1011121314" + "7465737400" + "6d7973716c5f6e61746976655f70617373776f726400" +
+		"16" + "0c5f636c69656e745f6e616d65" + "086c69626d7973716c")
+	require.NoError(t, err)
+	login, auth, err := parseHandshakeResponse(data)
+	require.NoError(t, err)
+	require.Equal(t, "root", login.Username)
+	require.Equal(t, "test", login.Database)
+	require.Equal(t, mysqlNativePlugin, login.AuthPlugin)
+	require.Len(t, auth, 20)
+	require.Equal(t, map[string]string{"_client_name": "libmysql"}, login.ClientAttrs)
+
+	_, _, err = parseHandshakeResponse(data[:20])
+	require.Error(t, err)
+}
+
+func TestMySQLQueryResponse(t *testing.T) {
+	resp := mysqlQueryResponse("SELECT VERSION();", "root")
+	require.Len(t, resp, 5)
+	require.Contains(t, string(resp[1]), "VERSION()")
+	require.Contains(t, string(resp[3]), mysqlVersion)
+
+	resp = mysqlQueryResponse("show databases", "root")
+	require.Len(t, resp, 3+len(mysqlDatabases)+1)
+
+	resp = mysqlQueryResponse("DROP TABLE users", "root")
+	require.Equal(t, byte(0xff), resp[0][0])
+	require.Contains(t, string(resp[0]), "DROP command denied to user 'root'@'%'")
+}
+
+func TestMySQLBinlogDump(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+
+	var md connection.Metadata
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("mysql", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(_ string, _ net.Conn, m connection.Metadata, _ []byte, _ interface{}) {
+		md = m
+	}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("MySQL login attempt", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("MySQL replication request", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	done := make(chan error)
+	go func() {
+		done <- HandleMySQL(context.Background(), server, connection.Metadata{TargetPort: 3306}, l, h)
+	}()
+
+	readPacket := func() []byte {
+		header := make([]byte, 4)
+		_, err := io.ReadFull(client, header)
+		require.NoError(t, err)
+		data := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+		_, err = io.ReadFull(client, data)
+		require.NoError(t, err)
+		return data
+	}
+	writePacket := func(seq byte, data []byte) {
+		_, err := client.Write(append([]byte{byte(len(data)), byte(len(data) >> 8), byte(len(data) >> 16), seq}, data...))
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, byte(0x0a), readPacket()[0])
+	login, err := hex.DecodeString("8da2bf0900000001ff0000000000000000000000000000000000000000000000726f6f740014" +
+		"0102030405060708090a0b0c0d0e0f1011121314" + "7465737400" + "6d7973716c5f6e61746976655f70617373776f726400" +
+		"16" + "0c5f636c69656e745f6e616d65" + "086c69626d7973716c")
+	require.NoError(t, err)
+	writePacket(1, login)
+	require.Equal(t, mysqlOK(), readPacket())
+
+	// COM_REGISTER_SLAVE followed by COM_BINLOG_DUMP as sent by a replica
+	writePacket(0, []byte{mysqlComRegisterSlave, 0x39, 0x30, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	require.Equal(t, mysqlOK(), readPacket())
+	dump := binary.LittleEndian.AppendUint32([]byte{mysqlComBinlogDump}, 4)
+	dump = binary.LittleEndian.AppendUint16(dump, 0)
+	dump = binary.LittleEndian.AppendUint32(dump, 12345)
+	writePacket(0, append(dump, "binlog.000001"...))
+
+	var events []byte
+	for i := 0; i < 5; i++ {
+		event := readPacket()
+		require.Equal(t, byte(0x00), event[0])
+		size := binary.LittleEndian.Uint32(event[10:])
+		require.Equal(t, int(size), len(event)-1)
+		require.Equal(t, crc32.ChecksumIEEE(event[1:len(event)-4]), binary.LittleEndian.Uint32(event[len(event)-4:]))
+		events = append(events, event[5])
+	}
+	require.Equal(t, []byte{mysqlBinlogRotate, mysqlBinlogFormatDesc, mysqlBinlogQuery, mysqlBinlogQuery, mysqlBinlogQuery}, events)
+
+	require.NoError(t, <-done)
+	require.Contains(t, md.Tags, "db_replication_abuse")
+}
+
+func TestParseBinlogDump(t *testing.T) {
+	dump := binary.LittleEndian.AppendUint32([]byte{mysqlComBinlogDump}, 154)
+	dump = binary.LittleEndian.AppendUint16(dump, 0)
+	dump = binary.LittleEndian.AppendUint32(dump, 2)
+	replication, err := parseBinlogDump(append(dump, "binlog.000003"...))
+	require.NoError(t, err)
+	require.Equal(t, &mysqlReplication{Command: "binlog_dump", ServerID: 2, File: "binlog.000003", Position: 154}, replication)
+
+	gtid := binary.LittleEndian.AppendUint16([]byte{mysqlComBinlogDumpGTID}, 0)
+	gtid = binary.LittleEndian.AppendUint32(gtid, 7)
+	gtid = binary.LittleEndian.AppendUint32(gtid, 0)
+	replication, err = parseBinlogDump(binary.LittleEndian.AppendUint64(gtid, 4))
+	require.NoError(t, err)
+	require.Equal(t, &mysqlReplication{Command: "binlog_dump_gtid", ServerID: 7, Position: 4}, replication)
+
+	_, err = parseBinlogDump(gtid)
+	require.Error(t, err)
+}
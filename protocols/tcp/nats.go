@@ -0,0 +1,215 @@
+package tcp
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	natsVersion     = "2.10.7"
+	natsMaxLine     = 4096
+	natsMaxPayload  = 1 << 20
+	natsMaxCommands = 100
+)
+
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	User      string `json:"user"`
+	Pass      string `json:"pass"`
+	AuthToken string `json:"auth_token"`
+	NKey      string `json:"nkey"`
+	JWT       string `json:"jwt"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+}
+
+type parsedNATS struct {
+	Direction string `json:"direction,omitempty"`
+	Command   string `json:"command,omitempty"`
+	User      string `json:"user,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Token     string `json:"token,omitempty"`
+	NKey      string `json:"nkey,omitempty"`
+	JWT       string `json:"jwt,omitempty"`
+	Client    string `json:"client,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Queue     string `json:"queue,omitempty"`
+	ReplyTo   string `json:"reply_to,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// natsInfo is the banner of a server requiring authentication, the client
+// is shown the address it connected from like nats-server does
+func natsInfo(host string, port uint16) []byte {
+	id := make([]byte, 28)
+	_, _ = rand.Read(id)
+	for i := range id {
+		id[i] = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"[id[i]%32]
+	}
+	info, _ := json.Marshal(map[string]any{
+		"server_id":     "N" + string(id),
+		"server_name":   "N" + string(id),
+		"version":       natsVersion,
+		"proto":         1,
+		"go":            "go1.21.5",
+		"host":          "0.0.0.0",
+		"port":          port,
+		"headers":       true,
+		"auth_required": true,
+		"max_payload":   natsMaxPayload,
+		"client_id":     5,
+		"client_ip":     host,
+	})
+	return []byte("INFO " + string(info) + "\r\n")
+}
+
+// readNATSPayload reads the message following a PUB or HPUB line, size is
+// the last of the arguments
+func readNATSPayload(r io.Reader, args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing NATS payload size")
+	}
+	size, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || size < 0 || size > natsMaxPayload {
+		return nil, errors.New("invalid NATS payload size")
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+// HandleNATS emulates a NATS server accepting any credentials, recording
+// them along with the subjects clients subscribe and publish to
+func HandleNATS(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedNATS{}
+	defer func() {
+		if err := h.ProduceTCP("nats", conn, md, helpers.FirstOrEmpty[parsedNATS](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "nats"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close NATS connection", slog.String("protocol", "nats"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	write := func(data []byte) error {
+		events = append(events, parsedNATS{Direction: "write", Payload: data})
+		_, err := conn.Write(data)
+		return err
+	}
+	logCommand := func(msg parsedNATS) {
+		logger.Info(
+			"NATS command",
+			slog.String("handler", "nats"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("command", msg.Command),
+			slog.String("user", msg.User),
+			slog.String("password", msg.Password),
+			slog.String("subject", msg.Subject),
+		)
+	}
+
+	if err := write(natsInfo(host, md.TargetPort)); err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(conn, natsMaxLine)
+	verbose := false
+	for range natsMaxCommands {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			logger.Debug("Failed to read NATS command", slog.String("protocol", "nats"), producer.ErrAttr(err))
+			return nil
+		}
+		op, rest, _ := strings.Cut(strings.TrimRight(string(line), "\r\n"), " ")
+		msg := parsedNATS{Direction: "read", Command: strings.ToUpper(op), Payload: append([]byte{}, line...)}
+		args := strings.Fields(rest)
+
+		switch msg.Command {
+		case "CONNECT":
+			var options natsConnect
+			if err := json.Unmarshal([]byte(rest), &options); err != nil {
+				events = append(events, msg)
+				return write([]byte("-ERR 'Invalid Protocol Options'\r\n"))
+			}
+			verbose = options.Verbose
+			msg.User, msg.Password, msg.Token = options.User, options.Pass, options.AuthToken
+			msg.NKey, msg.JWT = options.NKey, options.JWT
+			msg.Client = strings.TrimSpace(fmt.Sprintf("%s %s %s", options.Name, options.Lang, options.Version))
+			logCommand(msg)
+			if msg.User != "" || msg.Password != "" || msg.Token != "" {
+				helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "nats", Username: msg.User, Password: cmp.Or(msg.Password, msg.Token), Success: true}, logger, h)
+			}
+		case "SUB":
+			// SUB <subject> [queue group] <sid>
+			if len(args) < 2 || len(args) > 3 {
+				events = append(events, msg)
+				return write([]byte("-ERR 'Unknown Protocol Operation'\r\n"))
+			}
+			msg.Subject = args[0]
+			if len(args) == 3 {
+				msg.Queue = args[1]
+			}
+			logCommand(msg)
+		case "PUB", "HPUB":
+			// PUB <subject> [reply-to] <size>, HPUB carries the header size too
+			data, err := readNATSPayload(reader, args)
+			if err != nil {
+				events = append(events, msg)
+				logger.Debug("Failed to read NATS payload", slog.String("protocol", "nats"), producer.ErrAttr(err))
+				return nil
+			}
+			msg.Subject = args[0]
+			if fixed := map[string]int{"PUB": 2, "HPUB": 3}[msg.Command]; len(args) > fixed {
+				msg.ReplyTo = args[1]
+			}
+			msg.Message = string(data)
+			msg.Payload = append(msg.Payload, data...)
+			logCommand(msg)
+		case "PING":
+			events = append(events, msg)
+			if err := write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+			continue
+		case "PONG", "UNSUB":
+		default:
+			events = append(events, msg)
+			return write([]byte("-ERR 'Unknown Protocol Operation'\r\n"))
+		}
+		events = append(events, msg)
+		if verbose {
+			if err := write([]byte("+OK\r\n")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleNATS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+	events := make(chan []parsedNATS, 1)
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("nats", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(_ string, _ net.Conn, _ connection.Metadata, _ []byte, event interface{}) {
+			if parsed, ok := event.([]parsedNATS); ok {
+				events <- parsed
+				return
+			}
+			data, err := json.Marshal(event)
+			require.NoError(t, err)
+			require.JSONEq(t, `{"event": "credential", "protocol": "nats", "username": "admin", "password": "nats", "success": true}`, string(data))
+		}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	go func() {
+		require.NoError(t, HandleNATS(context.Background(), server, connection.Metadata{TargetPort: 4222}, l, h))
+	}()
+
+	reader := bufio.NewReader(client)
+	info, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(info, "INFO {"))
+	require.Contains(t, info, `"auth_required":true`)
+
+	_, err = client.Write([]byte(`CONNECT {"verbose":true,"user":"admin","pass":"nats","name":"probe","lang":"go","version":"1.31.0"}` + "\r\nSUB > 1\r\nPUB cmd _INBOX.1 5\r\nhello\r\nPING\r\n"))
+	require.NoError(t, err)
+	for _, want := range []string{"+OK\r\n", "+OK\r\n", "+OK\r\n", "PONG\r\n"} {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, want, line)
+	}
+	client.Close()
+
+	got := <-events
+	require.Equal(t, "admin", got[1].User)
+	require.Equal(t, "nats", got[1].Password)
+	require.Equal(t, "probe go 1.31.0", got[1].Client)
+	require.Equal(t, ">", got[3].Subject)
+	require.Equal(t, "cmd", got[5].Subject)
+	require.Equal(t, "_INBOX.1", got[5].ReplyTo)
+	require.Equal(t, "hello", got[5].Message)
+}
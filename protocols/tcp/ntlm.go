@@ -0,0 +1,154 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	ntlmNegotiate    = 1
+	ntlmChallenge    = 2
+	ntlmAuthenticate = 3
+
+	ntlmFlagUnicode = 0x00000001
+	// ntlmServerFlags is what a Windows server answers with: unicode, NTLM,
+	// extended session security, target info, version, 128 and 56 bit keys
+	ntlmServerFlags = 0xe28a8215
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmSPNEGOOID is the NTLMSSP mechanism of SPNEGO, 1.3.6.1.4.1.311.2.2.10
+var ntlmSPNEGOOID = []byte{0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37, 0x02, 0x02, 0x0a}
+
+// ntlmAuth is what an AUTHENTICATE message reveals, Hash holds the
+// NetNTLMv1 or NetNTLMv2 response in the hashcat format
+type ntlmAuth struct {
+	Domain      string `json:"domain,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Workstation string `json:"workstation,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+}
+
+// ntlmToken finds the NTLMSSP message in a raw or SPNEGO wrapped token and
+// returns it along with its message type
+func ntlmToken(token []byte) ([]byte, uint32, bool) {
+	i := bytes.Index(token, ntlmSignature)
+	if i < 0 || len(token) < i+12 {
+		return nil, 0, false
+	}
+	msg := token[i:]
+	return msg, binary.LittleEndian.Uint32(msg[8:]), true
+}
+
+func utf16le(s string) []byte {
+	buf := []byte{}
+	for _, r := range utf16.Encode([]rune(s)) {
+		buf = binary.LittleEndian.AppendUint16(buf, r)
+	}
+	return buf
+}
+
+func ntlmString(data []byte, unicode bool) string {
+	if !unicode {
+		return string(data)
+	}
+	runes := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		runes = append(runes, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(runes))
+}
+
+// ntlmChallengeMessage builds the CHALLENGE for a server named computer in
+// the NetBIOS domain, the DNS names are derived from both
+func ntlmChallengeMessage(challenge []byte, domain, computer string, now time.Time) []byte {
+	dnsDomain := strings.ToLower(domain) + ".local"
+	target := utf16le(strings.ToUpper(domain))
+
+	info := []byte{}
+	avPair := func(id uint16, value []byte) {
+		info = binary.LittleEndian.AppendUint16(info, id)
+		info = binary.LittleEndian.AppendUint16(info, uint16(len(value)))
+		info = append(info, value...)
+	}
+	avPair(2, target)
+	avPair(1, utf16le(strings.ToUpper(computer)))
+	avPair(4, utf16le(dnsDomain))
+	avPair(3, utf16le(strings.ToLower(computer)+"."+dnsDomain))
+	avPair(5, utf16le(dnsDomain))
+	// FILETIME, 100ns intervals since 1601
+	avPair(7, binary.LittleEndian.AppendUint64(nil, uint64(now.UnixNano()/100+116444736000000000)))
+	avPair(0, nil)
+
+	const header = 56
+	msg := append([]byte{}, ntlmSignature...)
+	msg = binary.LittleEndian.AppendUint32(msg, ntlmChallenge)
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(target)))
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(target)))
+	msg = binary.LittleEndian.AppendUint32(msg, header)
+	msg = binary.LittleEndian.AppendUint32(msg, ntlmServerFlags)
+	msg = append(msg, challenge...)
+	msg = append(msg, make([]byte, 8)...)
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(info)))
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(info)))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(header+len(target)))
+	// Windows Server 2019, build 17763, NTLM revision 15
+	msg = append(msg, 0x0a, 0x00, 0x63, 0x45, 0x00, 0x00, 0x00, 0x0f)
+	msg = append(msg, target...)
+	return append(msg, info...)
+}
+
+// ntlmSPNEGOResponse wraps a CHALLENGE in a SPNEGO NegTokenResp asking the
+// client to continue with NTLMSSP
+func ntlmSPNEGOResponse(msg []byte) []byte {
+	state := berTLV(0xa0, []byte{0x0a, 0x01, 0x01})
+	mech := berTLV(0xa1, ntlmSPNEGOOID)
+	token := berTLV(0xa2, berTLV(0x04, msg))
+	return berTLV(0xa1, berTLV(0x30, append(append(state, mech...), token...)))
+}
+
+// parseNTLMAuthenticate reads the names and challenge responses of an
+// AUTHENTICATE message answering challenge
+func parseNTLMAuthenticate(msg, challenge []byte) (*ntlmAuth, error) {
+	if len(msg) < 64 || !bytes.HasPrefix(msg, ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != ntlmAuthenticate {
+		return nil, errors.New("not an NTLM AUTHENTICATE message")
+	}
+	field := func(offset int) ([]byte, error) {
+		size := int(binary.LittleEndian.Uint16(msg[offset:]))
+		start := int(binary.LittleEndian.Uint32(msg[offset+4:]))
+		if start+size > len(msg) {
+			return nil, errors.New("NTLM field out of range")
+		}
+		return msg[start : start+size], nil
+	}
+	fields := make([][]byte, 5)
+	for i := range fields {
+		var err error
+		if fields[i], err = field(12 + 8*i); err != nil {
+			return nil, err
+		}
+	}
+	unicode := binary.LittleEndian.Uint32(msg[60:])&ntlmFlagUnicode != 0
+	lm, nt := fields[0], fields[1]
+	auth := &ntlmAuth{
+		Domain:      ntlmString(fields[2], unicode),
+		Username:    ntlmString(fields[3], unicode),
+		Workstation: ntlmString(fields[4], unicode),
+	}
+	switch {
+	case auth.Username == "" && len(nt) == 0:
+		// anonymous authentication carries no hash
+	case len(nt) == 24:
+		auth.Hash = fmt.Sprintf("%s::%s:%s:%s:%s", auth.Username, auth.Domain, hex.EncodeToString(lm), hex.EncodeToString(nt), hex.EncodeToString(challenge))
+	case len(nt) > 16:
+		auth.Hash = fmt.Sprintf("%s::%s:%s:%s:%s", auth.Username, auth.Domain, hex.EncodeToString(challenge), hex.EncodeToString(nt[:16]), hex.EncodeToString(nt[16:]))
+	}
+	return auth, nil
+}
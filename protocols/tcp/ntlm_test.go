@@ -0,0 +1,71 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testNTLMAuthenticate(domain, user string, lm, nt []byte) []byte {
+	payload := [][]byte{lm, nt, utf16le(domain), utf16le(user), utf16le("WS01")}
+	msg := append([]byte{}, ntlmSignature...)
+	msg = binary.LittleEndian.AppendUint32(msg, ntlmAuthenticate)
+	offset := 64
+	for _, field := range payload {
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(field)))
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(field)))
+		msg = binary.LittleEndian.AppendUint32(msg, uint32(offset))
+		offset += len(field)
+	}
+	msg = append(msg, make([]byte, 8)...)
+	msg = binary.LittleEndian.AppendUint32(msg, ntlmFlagUnicode)
+	for _, field := range payload {
+		msg = append(msg, field...)
+	}
+	return msg
+}
+
+func TestNTLMChallengeMessage(t *testing.T) {
+	challenge := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	msg := ntlmChallengeMessage(challenge, "WORKGROUP", "FILESRV01", time.Unix(0, 0))
+	data, msgType, ok := ntlmToken(msg)
+	require.True(t, ok)
+	require.Equal(t, uint32(ntlmChallenge), msgType)
+	require.Equal(t, challenge, data[24:32])
+	require.Equal(t, "WORKGROUP", ntlmString(data[56:56+18], true))
+
+	wrapped := ntlmSPNEGOResponse(msg)
+	require.Equal(t, byte(0xa1), wrapped[0])
+	data, msgType, ok = ntlmToken(wrapped)
+	require.True(t, ok)
+	require.Equal(t, uint32(ntlmChallenge), msgType)
+	require.Equal(t, msg, data)
+}
+
+func TestParseNTLMAuthenticate(t *testing.T) {
+	challenge, _ := hex.DecodeString("1122334455667788")
+	nt, _ := hex.DecodeString("00112233445566778899aabbccddeeff01010000000000000000000000000000")
+	auth, err := parseNTLMAuthenticate(testNTLMAuthenticate("CORP", "administrator", make([]byte, 24), nt), challenge)
+	require.NoError(t, err)
+	require.Equal(t, "CORP", auth.Domain)
+	require.Equal(t, "administrator", auth.Username)
+	require.Equal(t, "WS01", auth.Workstation)
+	require.Equal(t, "administrator::CORP:1122334455667788:00112233445566778899aabbccddeeff:01010000000000000000000000000000", auth.Hash)
+
+	_, err = parseNTLMAuthenticate(ntlmSignature, challenge)
+	require.Error(t, err)
+}
+
+func TestIsWinRMRequest(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/WSMAN", nil)
+	require.NoError(t, err)
+	require.True(t, isWinRMRequest(req, 80))
+	req, err = http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	require.NoError(t, err)
+	require.True(t, isWinRMRequest(req, 5985))
+	require.False(t, isWinRMRequest(req, 80))
+}
@@ -0,0 +1,226 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	// universal exit language, starts and ends PJL jobs
+	pjlUEL = "\x1b%-12345X"
+	// largest print job or downloaded file we keep
+	pjlMaxJob   = 1 << 20
+	pjlPrinter  = "HP LaserJet 4250"
+	pjlFormFeed = "\x0c"
+)
+
+var (
+	pjlName = regexp.MustCompile(`(?i)NAME\s*=\s*"([^"]*)"`)
+	pjlSize = regexp.MustCompile(`(?i)SIZE\s*=\s*(\d+)`)
+)
+
+type pjlCommand struct {
+	Command string `json:"command"`
+	Args    string `json:"args,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Size    int    `json:"size,omitempty"`
+}
+
+type parsedPJL struct {
+	Direction   string      `json:"direction,omitempty"`
+	Command     *pjlCommand `json:"command,omitempty"`
+	PayloadHash string      `json:"payload_hash,omitempty"`
+	Payload     []byte      `json:"payload,omitempty"`
+}
+
+// parsePJL splits a PJL line into the command and its arguments
+func parsePJL(line string) (*pjlCommand, bool) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, pjlUEL))
+	if len(line) < 4 || !strings.EqualFold(line[:4], "@PJL") {
+		return nil, false
+	}
+	cmd, args, _ := strings.Cut(strings.TrimSpace(line[4:]), " ")
+	command := &pjlCommand{
+		Command: strings.ToUpper(cmd),
+		Args:    strings.TrimSpace(args),
+	}
+	if m := pjlName.FindStringSubmatch(args); m != nil {
+		command.Name = m[1]
+	}
+	if m := pjlSize.FindStringSubmatch(args); m != nil {
+		command.Size, _ = strconv.Atoi(m[1])
+	}
+	return command, true
+}
+
+// isPrinterFSCommand reports commands which access the printer file system
+func isPrinterFSCommand(command string) bool {
+	return strings.HasPrefix(command, "FS")
+}
+
+// pjlFile returns the content of a fake file on the printer file system
+func pjlFile(name string) ([]byte, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasSuffix(name, "/etc/passwd") {
+		data, err := res.ReadFile("resources/passwd")
+		return data, err == nil
+	}
+	return nil, false
+}
+
+// pjlResponse creates the reply to a PJL command, nil if there is none
+func pjlResponse(cmd *pjlCommand) []byte {
+	switch cmd.Command {
+	case "INFO":
+		category := strings.ToUpper(strings.Fields(cmd.Args + " ")[0])
+		body := ""
+		switch category {
+		case "ID":
+			body = fmt.Sprintf("%q\r\n", pjlPrinter)
+		case "STATUS":
+			body = "CODE=10001\r\nDISPLAY=\"Ready\"\r\nONLINE=TRUE\r\n"
+		case "CONFIG":
+			body = "IN TRAYS [3 ENUMERATED]\r\n\tINTRAY1 MP\r\n\tINTRAY2 PC\r\n\tINTRAY3 LC\r\n" +
+				"DUPLEX\r\nMEMORY=134217728\r\nDISPLAY LINES=2\r\nDISPLAY CHARACTER SIZE=16\r\n"
+		case "FILESYS":
+			body = "VOLUME\tTOTAL SIZE\tFREE SPACE\tLOCATION\tLABEL\tSTATUS\r\n" +
+				"0:\\\t15998976\t14215168\tRAM\t?\tREAD-WRITE\r\n"
+		case "PAGECOUNT":
+			body = "PAGECOUNT=48213\r\n"
+		}
+		return []byte(fmt.Sprintf("@PJL INFO %s\r\n%s%s", category, body, pjlFormFeed))
+	case "ECHO":
+		return []byte(fmt.Sprintf("@PJL ECHO %s\r\n%s", cmd.Args, pjlFormFeed))
+	case "FSQUERY":
+		if data, ok := pjlFile(cmd.Name); ok {
+			return []byte(fmt.Sprintf("@PJL FSQUERY NAME=%q TYPE=FILE SIZE=%d\r\n%s", cmd.Name, len(data), pjlFormFeed))
+		}
+		return []byte(fmt.Sprintf("@PJL FSQUERY NAME=%q TYPE=DIR\r\n%s", cmd.Name, pjlFormFeed))
+	case "FSDIRLIST":
+		return []byte(fmt.Sprintf("@PJL FSDIRLIST NAME=%q ENTRY=1\r\n"+
+			". TYPE=DIR\r\n.. TYPE=DIR\r\nPJL TYPE=DIR\r\nPostScript TYPE=DIR\r\nwebServer TYPE=DIR\r\n%s", cmd.Name, pjlFormFeed))
+	case "FSUPLOAD":
+		data, ok := pjlFile(cmd.Name)
+		if !ok {
+			return []byte(fmt.Sprintf("@PJL FSUPLOAD NAME=%q\r\nFILEERROR=3\r\n%s", cmd.Name, pjlFormFeed))
+		}
+		return append([]byte(fmt.Sprintf("@PJL FSUPLOAD FORMAT:BINARY NAME=%q OFFSET=0 SIZE=%d\r\n", cmd.Name, len(data))), data...)
+	}
+	return nil
+}
+
+// HandleRaw9100 handles raw print jobs and PJL commands
+func HandleRaw9100(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedPJL{}
+	job := &bytes.Buffer{}
+	defer func() {
+		if job.Len() > 0 {
+			hash, err := helpers.StorePayload(job.Bytes())
+			if err != nil {
+				logger.Error("Failed to store print job", slog.String("protocol", "pjl"), producer.ErrAttr(err))
+			}
+			events = append(events, parsedPJL{
+				Direction:   "read",
+				PayloadHash: hash,
+				Payload:     job.Bytes(),
+			})
+		}
+		if err := h.ProduceTCP("pjl", conn, md, helpers.FirstOrEmpty[parsedPJL](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "pjl"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close PJL connection", slog.String("protocol", "pjl"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "pjl"), producer.ErrAttr(err))
+			return nil
+		}
+		// binary job data can lack newlines, so overlong lines are read in chunks
+		chunk, err := reader.ReadSlice('\n')
+		line := string(chunk)
+		if err == bufio.ErrBufferFull {
+			err = nil
+		}
+		if len(line) > 0 {
+			cmd, ok := parsePJL(line)
+			if !ok {
+				if job.Len()+len(line) <= pjlMaxJob {
+					job.WriteString(line)
+				}
+			} else {
+				event := parsedPJL{
+					Direction: "read",
+					Command:   cmd,
+					Payload:   []byte(line),
+				}
+				logger.Info(
+					"PJL command received",
+					slog.String("handler", "pjl"),
+					slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+					slog.String("src_ip", host),
+					slog.String("src_port", port),
+					slog.String("command", cmd.Command),
+					slog.String("args", cmd.Args),
+				)
+				if isPrinterFSCommand(cmd.Command) && !slices.Contains(md.Tags, "printer_fs_abuse") {
+					md.Tags = append(md.Tags, "printer_fs_abuse")
+				}
+
+				if cmd.Command == "FSDOWNLOAD" && cmd.Size > 0 && cmd.Size <= pjlMaxJob {
+					data := make([]byte, cmd.Size)
+					n, err := io.ReadFull(reader, data)
+					hash, serr := helpers.StorePayload(data[:n])
+					if serr != nil {
+						logger.Error("Failed to store PJL download", slog.String("protocol", "pjl"), producer.ErrAttr(serr))
+					}
+					event.PayloadHash = hash
+					events = append(events, event)
+					if err != nil {
+						logger.Debug("Failed to read PJL download", slog.String("protocol", "pjl"), producer.ErrAttr(err))
+						return nil
+					}
+					continue
+				}
+				events = append(events, event)
+
+				if resp := pjlResponse(cmd); resp != nil {
+					events = append(events, parsedPJL{
+						Direction: "write",
+						Command:   cmd,
+						Payload:   resp,
+					})
+					if _, err := conn.Write(resp); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if err != nil {
+			logger.Debug("Failed to read PJL data", slog.String("protocol", "pjl"), producer.ErrAttr(err))
+			return nil
+		}
+	}
+}
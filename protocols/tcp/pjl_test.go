@@ -0,0 +1,41 @@
+package tcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePJL(t *testing.T) {
+	cmd, ok := parsePJL("\x1b%-12345X@PJL INFO ID\r\n")
+	require.True(t, ok)
+	require.Equal(t, "INFO", cmd.Command)
+	require.Equal(t, "ID", cmd.Args)
+
+	cmd, ok = parsePJL(`@PJL FSDOWNLOAD FORMAT:BINARY SIZE=42 NAME="0:\..\..\etc\profile"` + "\r\n")
+	require.True(t, ok)
+	require.Equal(t, "FSDOWNLOAD", cmd.Command)
+	require.Equal(t, 42, cmd.Size)
+	require.Equal(t, `0:\..\..\etc\profile`, cmd.Name)
+	require.True(t, isPrinterFSCommand(cmd.Command))
+
+	_, ok = parsePJL("%!PS-Adobe-3.0\n")
+	require.False(t, ok)
+}
+
+func TestPJLResponse(t *testing.T) {
+	cmd, _ := parsePJL("@PJL INFO ID")
+	require.Equal(t, "@PJL INFO ID\r\n\"HP LaserJet 4250\"\r\n\x0c", string(pjlResponse(cmd)))
+
+	cmd, _ = parsePJL(`@PJL FSUPLOAD NAME="0:\..\..\..\etc\passwd" OFFSET=0 SIZE=1000`)
+	resp := string(pjlResponse(cmd))
+	require.True(t, strings.HasPrefix(resp, "@PJL FSUPLOAD FORMAT:BINARY"))
+	require.Contains(t, resp, "root:")
+
+	cmd, _ = parsePJL(`@PJL FSUPLOAD NAME="0:\missing"`)
+	require.Contains(t, string(pjlResponse(cmd)), "FILEERROR=3")
+
+	cmd, _ = parsePJL("@PJL SET COPIES=1")
+	require.Nil(t, pjlResponse(cmd))
+}
@@ -0,0 +1,217 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	pop3MaxLine     = 1024
+	pop3MaxCommands = 50
+)
+
+type parsedPOP3 struct {
+	Direction string `json:"direction,omitempty"`
+	Command   string `json:"command,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+type pop3Server struct {
+	events []parsedPOP3
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (s *pop3Server) write(msg string) error {
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		return err
+	}
+	s.events = append(s.events, parsedPOP3{Direction: "write", Payload: []byte(msg)})
+	return nil
+}
+
+func (s *pop3Server) readLine() (string, error) {
+	line, err := s.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", errors.New("POP3 line too long")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// pop3Plain decodes a SASL PLAIN response into username and password
+func pop3Plain(response string) (string, string, error) {
+	data, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return "", "", err
+	}
+	parts := bytes.SplitN(data, []byte{0}, 3)
+	if len(parts) != 3 {
+		return "", "", errors.New("malformed SASL PLAIN response")
+	}
+	return string(parts[1]), string(parts[2]), nil
+}
+
+// pop3Response answers the transaction state commands, the mailbox is empty
+func pop3Response(cmd string, args []string) string {
+	switch cmd {
+	case "STAT":
+		return "+OK 0 0\r\n"
+	case "LIST", "UIDL":
+		if len(args) > 0 {
+			return "-ERR There's no message " + args[0] + ".\r\n"
+		}
+		return "+OK 0 messages:\r\n.\r\n"
+	case "RETR", "TOP", "DELE":
+		return "-ERR There's no message " + strings.Join(args, " ") + ".\r\n"
+	case "NOOP", "RSET":
+		return "+OK\r\n"
+	}
+	return "-ERR Unknown command: " + cmd + "\r\n"
+}
+
+// HandlePOP3 accepts any USER/PASS, APOP or AUTH PLAIN login, recording the
+// credentials, and serves an empty mailbox
+func HandlePOP3(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	server := &pop3Server{
+		events: []parsedPOP3{},
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, pop3MaxLine),
+	}
+	defer func() {
+		if err := h.ProduceTCP("pop3", conn, md, helpers.FirstOrEmpty[parsedPOP3](server.events).Payload, server.events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "pop3"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close POP3 connection", slog.String("protocol", "pop3"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	if err := server.write("+OK Dovecot ready.\r\n"); err != nil {
+		return err
+	}
+	var username string
+	authenticated := false
+	for range pop3MaxCommands {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "pop3"), producer.ErrAttr(err))
+			return nil
+		}
+		line, err := server.readLine()
+		if err != nil {
+			logger.Debug("Failed to read POP3 command", slog.String("protocol", "pop3"), producer.ErrAttr(err))
+			return nil
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := strings.ToUpper(fields[0]), fields[1:]
+		event := parsedPOP3{Direction: "read", Command: cmd, Payload: []byte(line)}
+
+		var resp string
+		switch {
+		case cmd == "CAPA":
+			resp = "+OK\r\nCAPA\r\nTOP\r\nUIDL\r\nRESP-CODES\r\nPIPELINING\r\nAUTH-RESP-CODE\r\nUSER\r\nSASL PLAIN\r\n.\r\n"
+		case cmd == "QUIT":
+			server.events = append(server.events, event)
+			return server.write("+OK Logging out.\r\n")
+		case cmd == "STLS":
+			resp = "-ERR TLS support isn't enabled.\r\n"
+		case authenticated:
+			resp = pop3Response(cmd, args)
+		case cmd == "USER" && len(args) > 0:
+			username = strings.Join(args, " ")
+			event.Username = username
+			resp = "+OK\r\n"
+		case cmd == "PASS" || cmd == "APOP" || cmd == "AUTH":
+			switch cmd {
+			case "PASS":
+				// passwords may contain spaces
+				event.Username, event.Password = username, strings.TrimPrefix(line[len(fields[0]):], " ")
+			case "APOP":
+				if len(args) == 2 {
+					event.Username, event.Password = args[0], args[1]
+				}
+			case "AUTH":
+				if len(args) == 0 {
+					resp = "+OK\r\nPLAIN\r\n.\r\n"
+					break
+				}
+				if !strings.EqualFold(args[0], "PLAIN") {
+					resp = "-ERR [AUTH] Unsupported authentication mechanism.\r\n"
+					break
+				}
+				response := ""
+				if len(args) > 1 {
+					response = args[1]
+				} else {
+					if err := server.write("+ \r\n"); err != nil {
+						return err
+					}
+					if response, err = server.readLine(); err != nil {
+						return nil
+					}
+				}
+				if event.Username, event.Password, err = pop3Plain(response); err != nil {
+					logger.Debug("Failed to decode POP3 AUTH PLAIN", slog.String("protocol", "pop3"), producer.ErrAttr(err))
+				}
+			}
+			if resp != "" {
+				break
+			}
+			if event.Username == "" {
+				resp = "-ERR [AUTH] Authentication failed.\r\n"
+				break
+			}
+			logger.Info(
+				"POP3 login",
+				slog.String("handler", "pop3"),
+				slog.String("src_ip", host),
+				slog.String("username", event.Username),
+				slog.String("password", event.Password),
+			)
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "pop3", Username: event.Username, Password: event.Password, Success: true}, logger, h)
+			authenticated = true
+			resp = "+OK Logged in.\r\n"
+		default:
+			resp = "-ERR Unknown command.\r\n"
+		}
+		server.events = append(server.events, event)
+
+		logger.Info(
+			"POP3 command",
+			slog.String("handler", "pop3"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("command", cmd),
+		)
+		if err := server.write(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
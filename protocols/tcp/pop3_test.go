@@ -0,0 +1,21 @@
+package tcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPOP3(t *testing.T) {
+	username, password, err := pop3Plain("AHVzZXIAcGEgc3M=")
+	require.NoError(t, err)
+	require.Equal(t, "user", username)
+	require.Equal(t, "pa ss", password)
+
+	_, _, err = pop3Plain("dXNlcg==")
+	require.Error(t, err)
+
+	require.Equal(t, "+OK 0 0\r\n", pop3Response("STAT", nil))
+	require.Equal(t, "+OK 0 messages:\r\n.\r\n", pop3Response("LIST", nil))
+	require.Equal(t, "-ERR There's no message 1.\r\n", pop3Response("RETR", []string{"1"}))
+}
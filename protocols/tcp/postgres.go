@@ -0,0 +1,511 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	pgVersion       = "14.11 (Ubuntu 14.11-0ubuntu0.22.04.1)"
+	pgProtocol3     = 196608
+	pgSSLRequest    = 80877103
+	pgGSSENCRequest = 80877104
+	pgCancelRequest = 80877102
+	pgMaxMessage    = 1 << 16
+	pgMaxQueries    = 10
+
+	pgAuthOK        = 0
+	pgAuthCleartext = 3
+	pgAuthMD5       = 5
+
+	pgSystemID       = 7212389435612876523
+	pgWALPosition    = 0x3000148
+	pgWALPageSize    = 8192
+	pgWALSegmentSize = 16 << 20
+	pgWALPageMagic   = 0xd10d
+	pgWALPages       = 3
+)
+
+type pgStartup struct {
+	Protocol   uint32            `json:"protocol"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+type pgLogin struct {
+	Username string `json:"username,omitempty"`
+	Database string `json:"database,omitempty"`
+	AuthType string `json:"auth_type,omitempty"`
+	Password string `json:"password,omitempty"`
+	Salt     string `json:"salt,omitempty"`
+}
+
+type parsedPostgres struct {
+	Direction string     `json:"direction,omitempty"`
+	Startup   *pgStartup `json:"startup,omitempty"`
+	Login     *pgLogin   `json:"login,omitempty"`
+	Query     string     `json:"query,omitempty"`
+	Payload   []byte     `json:"payload,omitempty"`
+}
+
+type pgServer struct {
+	events []parsedPostgres
+	conn   net.Conn
+}
+
+// readStartup reads an untyped startup phase message
+func (s *pgServer) readStartup() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length < 8 || length > pgMaxMessage {
+		return nil, errors.New("invalid PostgreSQL startup length")
+	}
+	data := make([]byte, length-4)
+	if _, err := io.ReadFull(s.conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readMessage reads a typed message
+func (s *pgServer) readMessage() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > pgMaxMessage {
+		return 0, nil, errors.New("invalid PostgreSQL message length")
+	}
+	data := make([]byte, length-4)
+	if _, err := io.ReadFull(s.conn, data); err != nil {
+		return 0, nil, err
+	}
+	return header[0], data, nil
+}
+
+func (s *pgServer) write(data []byte) error {
+	s.events = append(s.events, parsedPostgres{
+		Direction: "write",
+		Payload:   data,
+	})
+	_, err := s.conn.Write(data)
+	return err
+}
+
+// pgMessage builds a typed backend message
+func pgMessage(msgType byte, body []byte) []byte {
+	buf := []byte{msgType}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(body)+4))
+	return append(buf, body...)
+}
+
+func pgCString(values ...string) []byte {
+	buf := []byte{}
+	for _, value := range values {
+		buf = append(buf, value...)
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// parseStartup decodes the protocol version and parameters of a startup
+// message
+func parseStartup(data []byte) (*pgStartup, error) {
+	if len(data) < 4 {
+		return nil, errors.New("PostgreSQL startup message too short")
+	}
+	startup := &pgStartup{Protocol: binary.BigEndian.Uint32(data)}
+	if startup.Protocol != pgProtocol3 {
+		return startup, nil
+	}
+	fields := strings.Split(strings.TrimRight(string(data[4:]), "\x00"), "\x00")
+	startup.Parameters = map[string]string{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		startup.Parameters[fields[i]] = fields[i+1]
+	}
+	return startup, nil
+}
+
+func pgError(code, msg string) []byte {
+	body := []byte{'S'}
+	body = append(body, pgCString("ERROR")...)
+	body = append(body, 'V')
+	body = append(body, pgCString("ERROR")...)
+	body = append(body, 'C')
+	body = append(body, pgCString(code)...)
+	body = append(body, 'M')
+	body = append(body, pgCString(msg)...)
+	return pgMessage('E', append(body, 0))
+}
+
+func pgReady() []byte {
+	return pgMessage('Z', []byte{'I'})
+}
+
+// pgLoginOK accepts the login and sends the parameters and key data a
+// PostgreSQL 14 server reports
+func pgLoginOK(secret []byte) []byte {
+	buf := pgMessage('R', binary.BigEndian.AppendUint32(nil, pgAuthOK))
+	for _, param := range [][2]string{
+		{"application_name", ""},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"IntervalStyle", "postgres"},
+		{"is_superuser", "off"},
+		{"server_encoding", "UTF8"},
+		{"server_version", pgVersion},
+		{"session_authorization", ""},
+		{"standard_conforming_strings", "on"},
+		{"TimeZone", "Etc/UTC"},
+	} {
+		buf = append(buf, pgMessage('S', pgCString(param[0], param[1]))...)
+	}
+	buf = append(buf, pgMessage('K', secret)...)
+	return append(buf, pgReady()...)
+}
+
+// pgResultSet creates the response to a query returning a single row of
+// text columns
+func pgResultSet(tag string, columns []string, values []string) []byte {
+	desc := binary.BigEndian.AppendUint16(nil, uint16(len(columns)))
+	for _, column := range columns {
+		desc = append(desc, pgCString(column)...)
+		desc = binary.BigEndian.AppendUint32(desc, 0)
+		desc = binary.BigEndian.AppendUint16(desc, 0)
+		desc = binary.BigEndian.AppendUint32(desc, 25) // text
+		desc = binary.BigEndian.AppendUint16(desc, 0xffff)
+		desc = binary.BigEndian.AppendUint32(desc, 0xffffffff)
+		desc = binary.BigEndian.AppendUint16(desc, 0)
+	}
+
+	row := binary.BigEndian.AppendUint16(nil, uint16(len(values)))
+	for _, value := range values {
+		row = binary.BigEndian.AppendUint32(row, uint32(len(value)))
+		row = append(row, value...)
+	}
+
+	buf := pgMessage('T', desc)
+	buf = append(buf, pgMessage('D', row)...)
+	buf = append(buf, pgMessage('C', pgCString(tag))...)
+	return append(buf, pgReady()...)
+}
+
+// pgQueryResponse answers a simple query, only version queries succeed
+func pgQueryResponse(query string) []byte {
+	normalized := strings.ToLower(strings.TrimRight(strings.TrimSpace(query), "; "))
+	switch normalized {
+	case "select version()":
+		version := "PostgreSQL " + pgVersion + " on x86_64-pc-linux-gnu, compiled by gcc (Ubuntu 11.4.0-1ubuntu1~22.04) 11.4.0, 64-bit"
+		return pgResultSet("SELECT 1", []string{"version"}, []string{version})
+	case "":
+		return append(pgMessage('I', nil), pgReady()...)
+	}
+	return append(pgError("42501", "permission denied"), pgReady()...)
+}
+
+// pgReplicationCommand returns the walsender command starting query, if any
+func pgReplicationCommand(query string) string {
+	command, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	command = strings.ToUpper(strings.TrimRight(command, ";"))
+	switch command {
+	case "IDENTIFY_SYSTEM", "START_REPLICATION", "CREATE_REPLICATION_SLOT", "BASE_BACKUP", "TIMELINE_HISTORY":
+		return command
+	}
+	return ""
+}
+
+// parseLSN decodes a WAL position written as two hexadecimal halves
+func parseLSN(value string) (uint64, bool) {
+	hi, lo, found := strings.Cut(value, "/")
+	if !found {
+		return 0, false
+	}
+	high, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	low, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return high<<32 | low, true
+}
+
+// pgWALStream switches to copy both mode and sends a few fake WAL pages
+// starting at the LSN requested by START_REPLICATION, followed by a
+// keepalive
+func pgWALStream(query string, now time.Time) []byte {
+	start := uint64(pgWALPosition)
+	for _, field := range strings.Fields(query) {
+		if lsn, ok := parseLSN(field); ok {
+			start = lsn
+			break
+		}
+	}
+	// WAL is streamed from the start of the page containing the position
+	start -= start % pgWALPageSize
+	// timestamps count microseconds since 2000-01-01
+	sendTime := uint64(now.Sub(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).Microseconds())
+
+	buf := pgMessage('W', []byte{0, 0, 0})
+	for i := 0; i < pgWALPages; i++ {
+		// a page header with the PostgreSQL 14 magic, the rest of the page
+		// is not sent
+		page := binary.LittleEndian.AppendUint16(nil, pgWALPageMagic)
+		long := start%pgWALSegmentSize == 0
+		if long {
+			page = binary.LittleEndian.AppendUint16(page, 0x0002)
+		} else {
+			page = binary.LittleEndian.AppendUint16(page, 0)
+		}
+		page = binary.LittleEndian.AppendUint32(page, 1) // timeline
+		page = binary.LittleEndian.AppendUint64(page, start)
+		page = append(page, make([]byte, 8)...)
+		if long {
+			page = binary.LittleEndian.AppendUint64(page, pgSystemID)
+			page = binary.LittleEndian.AppendUint32(page, pgWALSegmentSize)
+			page = binary.LittleEndian.AppendUint32(page, pgWALPageSize)
+		}
+
+		data := []byte{'w'}
+		data = binary.BigEndian.AppendUint64(data, start)
+		data = binary.BigEndian.AppendUint64(data, start+uint64(len(page)))
+		data = binary.BigEndian.AppendUint64(data, sendTime)
+		buf = append(buf, pgMessage('d', append(data, page...))...)
+		start += pgWALPageSize
+	}
+	keepalive := []byte{'k'}
+	keepalive = binary.BigEndian.AppendUint64(keepalive, start)
+	keepalive = binary.BigEndian.AppendUint64(keepalive, sendTime)
+	return append(buf, pgMessage('d', append(keepalive, 0))...)
+}
+
+// pgReplicationResponse answers the walsender commands of a client posing as
+// a standby
+func pgReplicationResponse(command, query, database string) []byte {
+	switch command {
+	case "IDENTIFY_SYSTEM":
+		return pgResultSet("IDENTIFY_SYSTEM", []string{"systemid", "timeline", "xlogpos", "dbname"}, []string{
+			strconv.FormatUint(pgSystemID, 10), "1", fmt.Sprintf("%X/%X", pgWALPosition>>32, pgWALPosition&0xffffffff), database,
+		})
+	case "START_REPLICATION":
+		return pgWALStream(query, time.Now())
+	}
+	return append(pgError("42501", "must be superuser or replication role to start walsender"), pgReady()...)
+}
+
+// HandlePostgres requests a password for any startup message, harvests the
+// credentials and records the simple queries sent after logging in.
+// Replication commands are tagged and START_REPLICATION is sent a few fake
+// WAL pages.
+func HandlePostgres(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	server := &pgServer{
+		events: []parsedPostgres{},
+		conn:   conn,
+	}
+	defer func() {
+		if err := h.ProduceTCP("postgres", conn, md, helpers.FirstOrEmpty[parsedPostgres](server.events).Payload, server.events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close PostgreSQL connection", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	var startup *pgStartup
+	for startup == nil {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+			return nil
+		}
+		data, err := server.readStartup()
+		if err != nil {
+			logger.Debug("Failed to read PostgreSQL startup message", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+			return nil
+		}
+		msg, err := parseStartup(data)
+		server.events = append(server.events, parsedPostgres{
+			Direction: "read",
+			Startup:   msg,
+			Payload:   data,
+		})
+		if err != nil {
+			logger.Debug("Failed to parse PostgreSQL startup message", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+			return nil
+		}
+		switch msg.Protocol {
+		case pgSSLRequest, pgGSSENCRequest:
+			// encryption is declined and the client continues in plaintext
+			if err := server.write([]byte{'N'}); err != nil {
+				return err
+			}
+		case pgProtocol3:
+			startup = msg
+		case pgCancelRequest:
+			return nil
+		default:
+			return server.write(pgError("0A000", "unsupported frontend protocol"))
+		}
+	}
+
+	login := &pgLogin{
+		Username: startup.Parameters["user"],
+		Database: startup.Parameters["database"],
+		AuthType: "cleartext",
+	}
+	if login.Database == "" {
+		login.Database = login.Username
+	}
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	authReq := binary.BigEndian.AppendUint32(nil, pgAuthCleartext)
+	if viper.GetString("postgres.auth") == "md5" {
+		login.AuthType = "md5"
+		login.Salt = hex.EncodeToString(random[:4])
+		authReq = binary.BigEndian.AppendUint32(nil, pgAuthMD5)
+		authReq = append(authReq, random[:4]...)
+	}
+	if err := server.write(pgMessage('R', authReq)); err != nil {
+		return err
+	}
+
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		logger.Debug("Failed to set connection timeout", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+		return nil
+	}
+	msgType, data, err := server.readMessage()
+	if err != nil || msgType != 'p' {
+		logger.Debug("Failed to read PostgreSQL password message", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+		return nil
+	}
+	// md5 passwords arrive as "md5" followed by md5(md5(password + user) + salt)
+	login.Password, _, _ = strings.Cut(string(data), "\x00")
+	server.events = append(server.events, parsedPostgres{
+		Direction: "read",
+		Login:     login,
+		Payload:   data,
+	})
+	logger.Info(
+		"PostgreSQL login attempt",
+		slog.String("handler", "postgres"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("username", login.Username),
+		slog.String("password", login.Password),
+		slog.String("database", login.Database),
+		slog.String("application_name", startup.Parameters["application_name"]),
+	)
+	cred := credentials.Credential{Protocol: "postgres", Username: login.Username, Password: login.Password, Success: true}
+	if login.AuthType == "md5" {
+		cred.Password, cred.Hash, cred.HashType = "", login.Password, "postgres-md5"
+	}
+	helpers.RecordCredential(ctx, conn, md, cred, logger, h)
+	if err := server.write(pgLoginOK(random[4:])); err != nil {
+		return err
+	}
+
+	// after an error in the extended query protocol messages are discarded
+	// until the next Sync
+	extendedFailed := false
+	for i := 0; i < pgMaxQueries; i++ {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+			return nil
+		}
+		msgType, data, err := server.readMessage()
+		if err != nil {
+			logger.Debug("Failed to read PostgreSQL message", slog.String("protocol", "postgres"), producer.ErrAttr(err))
+			return nil
+		}
+		event := parsedPostgres{
+			Direction: "read",
+			Payload:   data,
+		}
+		var resp []byte
+		switch msgType {
+		case 'X':
+			server.events = append(server.events, event)
+			return nil
+		case 'Q':
+			event.Query = string(bytes.TrimRight(data, "\x00"))
+			logger.Info(
+				"PostgreSQL query",
+				slog.String("handler", "postgres"),
+				slog.String("src_ip", host),
+				slog.String("username", login.Username),
+				slog.String("database", login.Database),
+				slog.String("query", event.Query),
+			)
+			command := pgReplicationCommand(event.Query)
+			if command == "" {
+				resp = pgQueryResponse(event.Query)
+				break
+			}
+			logger.Info(
+				"PostgreSQL replication request",
+				slog.String("handler", "postgres"),
+				slog.String("src_ip", host),
+				slog.String("username", login.Username),
+				slog.String("replication", startup.Parameters["replication"]),
+				slog.String("command", command),
+			)
+			if !slices.Contains(md.Tags, "db_replication_abuse") {
+				md.Tags = append(md.Tags, "db_replication_abuse")
+			}
+			resp = pgReplicationResponse(command, event.Query, login.Database)
+			if command == "START_REPLICATION" {
+				// the stream is never continued, the standby sees the
+				// primary going away
+				server.events = append(server.events, event)
+				return server.write(resp)
+			}
+		case 'S':
+			extendedFailed = false
+			resp = pgReady()
+		default:
+			if !extendedFailed {
+				extendedFailed = true
+				resp = pgError("0A000", "extended query protocol not supported")
+			}
+		}
+		server.events = append(server.events, event)
+		if resp == nil {
+			continue
+		}
+		if err := server.write(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
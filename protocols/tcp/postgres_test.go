@@ -0,0 +1,134 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStartup(t *testing.T) {
+	data := binary.BigEndian.AppendUint32(nil, pgProtocol3)
+	data = append(data, pgCString("user", "postgres", "database", "prod", "application_name", "psql", "")...)
+	startup, err := parseStartup(data)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"user": "postgres", "database": "prod", "application_name": "psql"}, startup.Parameters)
+
+	startup, err = parseStartup(binary.BigEndian.AppendUint32(nil, pgSSLRequest))
+	require.NoError(t, err)
+	require.Equal(t, uint32(pgSSLRequest), startup.Protocol)
+
+	_, err = parseStartup([]byte{0, 3})
+	require.Error(t, err)
+}
+
+func TestPgQueryResponse(t *testing.T) {
+	resp := pgQueryResponse("SELECT version();")
+	require.Equal(t, byte('T'), resp[0])
+	require.Contains(t, string(resp), "PostgreSQL "+pgVersion)
+	require.Equal(t, pgReady(), resp[len(resp)-6:])
+
+	resp = pgQueryResponse("COPY cmd FROM PROGRAM 'id'")
+	require.Equal(t, byte('E'), resp[0])
+	require.Contains(t, string(resp), "42501")
+}
+
+func TestPgReplication(t *testing.T) {
+	require.Equal(t, "IDENTIFY_SYSTEM", pgReplicationCommand("identify_system;"))
+	require.Equal(t, "START_REPLICATION", pgReplicationCommand("START_REPLICATION SLOT s LOGICAL 0/0"))
+	require.Empty(t, pgReplicationCommand("SELECT version()"))
+
+	lsn, ok := parseLSN("16/B374D848")
+	require.True(t, ok)
+	require.Equal(t, uint64(0x16B374D848), lsn)
+	_, ok = parseLSN("B374D848")
+	require.False(t, ok)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+
+	var md connection.Metadata
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("postgres", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(_ string, _ net.Conn, m connection.Metadata, _ []byte, _ interface{}) {
+		md = m
+	}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("PostgreSQL login attempt", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("PostgreSQL query", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("PostgreSQL replication request", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	done := make(chan error)
+	go func() {
+		done <- HandlePostgres(context.Background(), server, connection.Metadata{TargetPort: 5432}, l, h)
+	}()
+
+	readMessage := func() (byte, []byte) {
+		header := make([]byte, 5)
+		_, err := io.ReadFull(client, header)
+		require.NoError(t, err)
+		body := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+		_, err = io.ReadFull(client, body)
+		require.NoError(t, err)
+		return header[0], body
+	}
+	// reads messages up to and including the first of type until
+	readUntil := func(until byte) [][]byte {
+		messages := [][]byte{}
+		for {
+			msgType, body := readMessage()
+			messages = append(messages, append([]byte{msgType}, body...))
+			if msgType == until {
+				return messages
+			}
+		}
+	}
+
+	startup := binary.BigEndian.AppendUint32(nil, pgProtocol3)
+	startup = append(startup, pgCString("user", "replicator", "replication", "true", "")...)
+	_, err = client.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(startup)+4)), startup...))
+	require.NoError(t, err)
+	msgType, _ := readMessage()
+	require.Equal(t, byte('R'), msgType)
+	_, err = client.Write(pgMessage('p', pgCString("secret")))
+	require.NoError(t, err)
+	readUntil('Z')
+
+	_, err = client.Write(pgMessage('Q', pgCString("IDENTIFY_SYSTEM")))
+	require.NoError(t, err)
+	messages := readUntil('Z')
+	require.Equal(t, byte('D'), messages[1][0])
+	require.Contains(t, string(messages[1]), "0/3000148")
+
+	_, err = client.Write(pgMessage('Q', pgCString("START_REPLICATION 0/3000148 TIMELINE 1")))
+	require.NoError(t, err)
+	msgType, _ = readMessage()
+	require.Equal(t, byte('W'), msgType)
+	for i := 0; i < pgWALPages; i++ {
+		msgType, body := readMessage()
+		require.Equal(t, byte('d'), msgType)
+		require.Equal(t, byte('w'), body[0])
+		require.Equal(t, uint64(0x3000000+i*pgWALPageSize), binary.BigEndian.Uint64(body[1:]))
+		require.Equal(t, uint16(pgWALPageMagic), binary.LittleEndian.Uint16(body[25:]))
+	}
+	msgType, body := readMessage()
+	require.Equal(t, byte('d'), msgType)
+	require.Equal(t, byte('k'), body[0])
+
+	require.NoError(t, <-done)
+	require.Contains(t, md.Tags, "db_replication_abuse")
+}
@@ -0,0 +1,405 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	redisVersion = "5.0.7"
+	redisMaxArgs = 1024
+	redisMaxBulk = 512 << 10
+	redisMaxLine = 64 << 10
+	redisMaxKeys = 1024
+	redisRunID   = "3b6c5e5f8b5f0d8d2c9a4f6e1a7b9c0d2e4f6a8b"
+)
+
+type redisSave struct {
+	Path        string `json:"path"`
+	Size        int    `json:"size"`
+	PayloadHash string `json:"payload_hash,omitempty"`
+}
+
+type parsedRedis struct {
+	Direction string     `json:"direction,omitempty"`
+	Command   []string   `json:"command,omitempty"`
+	Save      *redisSave `json:"save,omitempty"`
+	Payload   []byte     `json:"payload,omitempty"`
+}
+
+// redisSession keeps the keys and config values of a connection so the
+// file written by SAVE reflects what the client set up
+type redisSession struct {
+	keys   map[string]string
+	order  []string
+	config map[string]string
+	master string
+}
+
+func newRedisSession() *redisSession {
+	return &redisSession{
+		keys: map[string]string{},
+		config: map[string]string{
+			"dir":        "/var/lib/redis",
+			"dbfilename": "dump.rdb",
+		},
+	}
+}
+
+// readRedisCommand reads a command in RESP array or inline form
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRedisLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > redisMaxArgs {
+		return nil, errors.New("invalid RESP array length")
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readRedisLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errors.New("expected RESP bulk string")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > redisMaxBulk {
+			return nil, errors.New("invalid RESP bulk length")
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:size]))
+	}
+	return args, nil
+}
+
+func readRedisLine(r *bufio.Reader) (string, error) {
+	line := []byte{}
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > redisMaxLine {
+			return "", errors.New("RESP line too long")
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+func redisBulk(value string) []byte {
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(value), value))
+}
+
+func redisArray(values ...string) []byte {
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(values)))
+	for _, value := range values {
+		buf = append(buf, redisBulk(value)...)
+	}
+	return buf
+}
+
+func redisError(msg string) []byte {
+	return []byte("-ERR " + msg + "\r\n")
+}
+
+func redisWrongArgs(cmd string) []byte {
+	return redisError(fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+}
+
+func (s *redisSession) info() string {
+	role := "role:master\r\nconnected_slaves:0"
+	if s.master != "" {
+		host, port, _ := strings.Cut(s.master, " ")
+		role = fmt.Sprintf("role:slave\r\nmaster_host:%s\r\nmaster_port:%s\r\nmaster_link_status:down", host, port)
+	}
+	return strings.Join([]string{
+		"# Server",
+		"redis_version:" + redisVersion,
+		"redis_git_sha1:00000000",
+		"redis_mode:standalone",
+		"os:Linux 5.4.0-150-generic x86_64",
+		"arch_bits:64",
+		"process_id:1021",
+		"run_id:" + redisRunID,
+		"tcp_port:6379",
+		"uptime_in_seconds:8723415",
+		"uptime_in_days:100",
+		"executable:/usr/bin/redis-server",
+		"config_file:/etc/redis/redis.conf",
+		"",
+		"# Clients",
+		"connected_clients:1",
+		"",
+		"# Memory",
+		"used_memory:869472",
+		"used_memory_human:849.09K",
+		"",
+		"# Persistence",
+		"rdb_bgsave_in_progress:0",
+		"rdb_last_bgsave_status:ok",
+		"",
+		"# Replication",
+		role,
+		"",
+		"# Keyspace",
+		fmt.Sprintf("db0:keys=%d,expires=0,avg_ttl=0", len(s.keys)),
+		"",
+	}, "\r\n")
+}
+
+// snapshot returns what SAVE would write: the stored values in the order
+// they were set, which is where cron lines and SSH keys end up
+func (s *redisSession) snapshot() (string, []byte) {
+	data := []byte{}
+	for _, key := range s.order {
+		data = append(data, s.keys[key]...)
+	}
+	return path.Join(s.config["dir"], s.config["dbfilename"]), data
+}
+
+// handle executes a command against the session, save is set when the
+// command writes the database to disk
+func (s *redisSession) handle(args []string) (resp []byte, save bool, quit bool) {
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "PING":
+		if len(args) > 1 {
+			return redisBulk(args[1]), false, false
+		}
+		return []byte("+PONG\r\n"), false, false
+	case "ECHO":
+		if len(args) != 2 {
+			return redisWrongArgs(cmd), false, false
+		}
+		return redisBulk(args[1]), false, false
+	case "AUTH":
+		return redisError("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"), false, false
+	case "INFO":
+		return redisBulk(s.info()), false, false
+	case "CONFIG":
+		if len(args) < 2 {
+			return redisWrongArgs(cmd), false, false
+		}
+		switch strings.ToUpper(args[1]) {
+		case "SET":
+			if len(args) != 4 {
+				return redisWrongArgs("config|set"), false, false
+			}
+			s.config[strings.ToLower(args[2])] = args[3]
+			return []byte("+OK\r\n"), false, false
+		case "GET":
+			if len(args) != 3 {
+				return redisWrongArgs("config|get"), false, false
+			}
+			values := []string{}
+			for key, value := range s.config {
+				if ok, _ := path.Match(strings.ToLower(args[2]), key); ok {
+					values = append(values, key, value)
+				}
+			}
+			return redisArray(values...), false, false
+		case "REWRITE", "RESETSTAT":
+			return []byte("+OK\r\n"), false, false
+		}
+		return redisError("Unknown subcommand or wrong number of arguments for '" + args[1] + "'. Try CONFIG HELP."), false, false
+	case "SET":
+		if len(args) < 3 {
+			return redisWrongArgs(cmd), false, false
+		}
+		if _, ok := s.keys[args[1]]; !ok {
+			if len(s.keys) >= redisMaxKeys {
+				return redisError("OOM command not allowed when used memory > 'maxmemory'."), false, false
+			}
+			s.order = append(s.order, args[1])
+		}
+		s.keys[args[1]] = args[2]
+		return []byte("+OK\r\n"), false, false
+	case "GET":
+		if len(args) != 2 {
+			return redisWrongArgs(cmd), false, false
+		}
+		if value, ok := s.keys[args[1]]; ok {
+			return redisBulk(value), false, false
+		}
+		return []byte("$-1\r\n"), false, false
+	case "KEYS":
+		if len(args) != 2 {
+			return redisWrongArgs(cmd), false, false
+		}
+		keys := []string{}
+		for _, key := range s.order {
+			if ok, _ := path.Match(args[1], key); ok {
+				keys = append(keys, key)
+			}
+		}
+		return redisArray(keys...), false, false
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.keys[key]; ok {
+				delete(s.keys, key)
+				s.order = slices.DeleteFunc(s.order, func(k string) bool { return k == key })
+				deleted++
+			}
+		}
+		return []byte(fmt.Sprintf(":%d\r\n", deleted)), false, false
+	case "FLUSHALL", "FLUSHDB":
+		s.keys = map[string]string{}
+		s.order = nil
+		return []byte("+OK\r\n"), false, false
+	case "DBSIZE":
+		return []byte(fmt.Sprintf(":%d\r\n", len(s.keys))), false, false
+	case "SLAVEOF", "REPLICAOF":
+		if len(args) != 3 {
+			return redisWrongArgs(cmd), false, false
+		}
+		if strings.EqualFold(args[1], "no") && strings.EqualFold(args[2], "one") {
+			s.master = ""
+			return []byte("+OK\r\n"), false, false
+		}
+		s.master = args[1] + " " + args[2]
+		return []byte("+OK\r\n"), false, false
+	case "SAVE":
+		return []byte("+OK\r\n"), true, false
+	case "BGSAVE":
+		return []byte("+Background saving started\r\n"), true, false
+	case "MODULE":
+		return redisError("Error loading the extension. Please check the server logs."), false, false
+	case "COMMAND":
+		return []byte("*0\r\n"), false, false
+	case "SELECT":
+		return []byte("+OK\r\n"), false, false
+	case "QUIT":
+		return []byte("+OK\r\n"), false, true
+	}
+	rest := ""
+	for _, arg := range args[1:] {
+		rest += "`" + arg + "`, "
+	}
+	return redisError(fmt.Sprintf("unknown command `%s`, with args beginning with: %s", args[0], rest)), false, false
+}
+
+// HandleRedis emulates an unauthenticated Redis server and records the
+// files that CONFIG SET dir/dbfilename followed by SAVE would write
+func HandleRedis(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedRedis{}
+	defer func() {
+		if err := h.ProduceTCP("redis", conn, md, helpers.FirstOrEmpty[parsedRedis](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "redis"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close Redis connection", slog.String("protocol", "redis"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	session := newRedisSession()
+	reader := bufio.NewReader(conn)
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "redis"), producer.ErrAttr(err))
+			return nil
+		}
+		args, err := readRedisCommand(reader)
+		if err != nil {
+			logger.Debug("Failed to read Redis command", slog.String("protocol", "redis"), producer.ErrAttr(err))
+			return nil
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		resp, save, quit := session.handle(args)
+		event := parsedRedis{
+			Direction: "read",
+			Command:   args,
+			Payload:   []byte(strings.Join(args, " ")),
+		}
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" && len(args) > 1 {
+			// AUTH takes a password or, since Redis 6, a username and password
+			cred := credentials.Credential{Protocol: "redis", Password: args[len(args)-1]}
+			if len(args) > 2 {
+				cred.Username = args[1]
+			}
+			helpers.RecordCredential(ctx, conn, md, cred, logger, h)
+		}
+		if cmd == "SLAVEOF" || cmd == "REPLICAOF" {
+			if session.master != "" && !slices.Contains(md.Tags, "redis_rogue_master") {
+				md.Tags = append(md.Tags, "redis_rogue_master")
+			}
+		}
+		if save {
+			file, data := session.snapshot()
+			event.Save = &redisSave{Path: file, Size: len(data)}
+			if len(data) > 0 {
+				if event.Save.PayloadHash, err = helpers.StorePayload(data); err != nil {
+					logger.Error("Failed to store Redis payload", slog.String("protocol", "redis"), producer.ErrAttr(err))
+				}
+			}
+			if !slices.Contains(md.Tags, "redis_file_write") {
+				md.Tags = append(md.Tags, "redis_file_write")
+			}
+			logger.Info(
+				"Redis file write",
+				slog.String("handler", "redis"),
+				slog.String("src_ip", host),
+				slog.String("path", file),
+				slog.Int("size", len(data)),
+				slog.String("sha256", event.Save.PayloadHash),
+			)
+		}
+		events = append(events, event)
+		logger.Info(
+			"Redis command",
+			slog.String("handler", "redis"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("command", cmd),
+			slog.Int("args", len(args)-1),
+		)
+
+		events = append(events, parsedRedis{
+			Direction: "write",
+			Payload:   resp,
+		})
+		if _, err := conn.Write(resp); err != nil {
+			return err
+		}
+		if quit {
+			return nil
+		}
+	}
+}
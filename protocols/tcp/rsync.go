@@ -0,0 +1,150 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	rsyncGreeting = "@RSYNCD: 31.0\n"
+	rsyncMaxLine  = 4096
+	rsyncMaxArgs  = 64
+)
+
+type parsedRsync struct {
+	Direction string   `json:"direction,omitempty"`
+	Version   string   `json:"version,omitempty"`
+	Module    string   `json:"module,omitempty"`
+	Args      []string `json:"args,omitempty"`
+	Payload   []byte   `json:"payload,omitempty"`
+}
+
+// rsyncModules lists rsync.modules sorted by name, one per line with its
+// comment the way rsyncd does
+func rsyncModules() string {
+	modules := viper.GetStringMapString("rsync.modules")
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	list := ""
+	for _, name := range names {
+		list += fmt.Sprintf("%-15s\t%s\n", name, modules[name])
+	}
+	return list
+}
+
+// rsyncProtocol reads the major protocol version from a greeting
+func rsyncProtocol(greeting string) int {
+	version := strings.TrimPrefix(greeting, "@RSYNCD: ")
+	major, _, _ := strings.Cut(strings.TrimSpace(version), ".")
+	protocol, _ := strconv.Atoi(major)
+	return protocol
+}
+
+// HandleRsync lists the modules in rsync.modules and accepts requests for
+// them, recording the arguments naming the paths to be synced before the
+// connection is dropped
+func HandleRsync(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedRsync{}
+	defer func() {
+		if err := h.ProduceTCP("rsync", conn, md, helpers.FirstOrEmpty[parsedRsync](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "rsync"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close rsync connection", slog.String("protocol", "rsync"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(conn, rsyncMaxLine)
+	write := func(data string) error {
+		events = append(events, parsedRsync{Direction: "write", Payload: []byte(data)})
+		_, err := conn.Write([]byte(data))
+		return err
+	}
+	read := func(delim byte) (string, error) {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return "", err
+		}
+		line, err := reader.ReadSlice(delim)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n\x00"), nil
+	}
+
+	if err := write(rsyncGreeting); err != nil {
+		return err
+	}
+	greeting, err := read('\n')
+	if err != nil {
+		logger.Debug("Failed to read rsync greeting", slog.String("protocol", "rsync"), producer.ErrAttr(err))
+		return nil
+	}
+	if !strings.HasPrefix(greeting, "@RSYNCD: ") {
+		events = append(events, parsedRsync{Direction: "read", Payload: []byte(greeting)})
+		return write("@ERROR: protocol startup error\n")
+	}
+	events = append(events, parsedRsync{Direction: "read", Version: strings.TrimPrefix(greeting, "@RSYNCD: "), Payload: []byte(greeting)})
+	request := len(events) - 1
+	module, err := read('\n')
+	if err != nil {
+		return nil
+	}
+	events[request].Module = module
+	logRequest := func() {
+		logger.Info(
+			"rsync request",
+			slog.String("handler", "rsync"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("module", events[request].Module),
+			slog.Any("args", events[request].Args),
+		)
+	}
+
+	if module == "" || module == "#list" {
+		logRequest()
+		return write(rsyncModules() + "@RSYNCD: EXIT\n")
+	}
+	if _, ok := viper.GetStringMapString("rsync.modules")[module]; !ok {
+		logRequest()
+		return write(fmt.Sprintf("@ERROR: Unknown module '%s'\n", module))
+	}
+	if err := write("@RSYNCD: OK\n"); err != nil {
+		return err
+	}
+
+	// protocol 30 and later separate the arguments by null bytes
+	delim := byte('\n')
+	if rsyncProtocol(greeting) >= 30 {
+		delim = 0
+	}
+	for range rsyncMaxArgs {
+		arg, err := read(delim)
+		if err != nil || arg == "" {
+			break
+		}
+		events[request].Args = append(events[request].Args, arg)
+	}
+	logRequest()
+	return nil
+}
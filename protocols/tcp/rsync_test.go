@@ -0,0 +1,58 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleRsync(t *testing.T) {
+	viper.Set("rsync.modules", map[string]string{"www": "Web root", "backup": "Nightly backups"})
+	require.Equal(t, "backup         \tNightly backups\nwww            \tWeb root\n", rsyncModules())
+	require.Equal(t, 31, rsyncProtocol("@RSYNCD: 31.0 sha512 md5"))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+	events := make(chan []parsedRsync, 1)
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("rsync", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(_ string, _ net.Conn, _ connection.Metadata, _ []byte, event interface{}) {
+			events <- event.([]parsedRsync)
+		}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	go func() {
+		require.NoError(t, HandleRsync(context.Background(), server, connection.Metadata{}, l, h))
+	}()
+
+	reader := bufio.NewReader(client)
+	greeting, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, rsyncGreeting, greeting)
+	_, err = client.Write([]byte("@RSYNCD: 31.0\nwww\n"))
+	require.NoError(t, err)
+	ok, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "@RSYNCD: OK\n", ok)
+	_, err = client.Write([]byte("--server\x00--sender\x00-logDtpre.iLsfxC\x00.\x00www/.env\x00\x00"))
+	require.NoError(t, err)
+
+	event := (<-events)[1]
+	require.Equal(t, "31.0", event.Version)
+	require.Equal(t, "www", event.Module)
+	require.Equal(t, []string{"--server", "--sender", "-logDtpre.iLsfxC", ".", "www/.env"}, event.Args)
+}
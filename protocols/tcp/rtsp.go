@@ -0,0 +1,258 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	rtspMaxRequests = 30
+	rtspMaxBody     = 64 << 10
+	rtspRealm       = "IP Camera(23421)"
+)
+
+// rtspSDP describes a single H.264 video stream like a cheap IP camera
+const rtspSDP = "v=0\r\n" +
+	"o=- 1647261742384029 1 IN IP4 %[1]s\r\n" +
+	"s=Media Presentation\r\n" +
+	"e=NONE\r\n" +
+	"b=AS:5050\r\n" +
+	"t=0 0\r\n" +
+	"a=control:%[2]s/\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"b=AS:5000\r\n" +
+	"a=recvonly\r\n" +
+	"a=x-dimensions:1920,1080\r\n" +
+	"a=control:%[2]s/trackID=1\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=fmtp:96 profile-level-id=420029; packetization-mode=1; sprop-parameter-sets=Z00AKp2oHgCJ+WbgICAoAAADAAgAAAMBlCA=,aO48gA==\r\n"
+
+type rtspAuth struct {
+	Scheme   string `json:"scheme"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Realm    string `json:"realm,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+type parsedRTSP struct {
+	Direction string    `json:"direction,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Auth      *rtspAuth `json:"auth,omitempty"`
+	Payload   []byte    `json:"payload,omitempty"`
+}
+
+// parseRTSPAuth decodes Basic and Digest Authorization headers
+func parseRTSPAuth(header string) *rtspAuth {
+	scheme, params, ok := strings.Cut(header, " ")
+	if !ok {
+		return nil
+	}
+	switch strings.ToLower(scheme) {
+	case "basic":
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(params))
+		if err != nil {
+			return nil
+		}
+		username, password, _ := strings.Cut(string(data), ":")
+		return &rtspAuth{Scheme: "basic", Username: username, Password: password}
+	case "digest":
+		auth := &rtspAuth{Scheme: "digest"}
+		for _, param := range strings.Split(params, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(key) {
+			case "username":
+				auth.Username = value
+			case "realm":
+				auth.Realm = value
+			case "nonce":
+				auth.Nonce = value
+			case "uri":
+				auth.URI = value
+			case "response":
+				auth.Response = value
+			}
+		}
+		return auth
+	}
+	return nil
+}
+
+func rtspResponse(status int, reason string, header textproto.MIMEHeader, body string) string {
+	resp := &strings.Builder{}
+	fmt.Fprintf(resp, "RTSP/1.0 %d %s\r\n", status, reason)
+	if body != "" {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	for _, key := range []string{"CSeq", "Server", "Public", "WWW-Authenticate", "Content-Base", "Content-Type", "Content-Length", "Transport", "Session", "RTP-Info"} {
+		for _, value := range header[key] {
+			fmt.Fprintf(resp, "%s: %s\r\n", key, value)
+		}
+	}
+	resp.WriteString("\r\n")
+	resp.WriteString(body)
+	return resp.String()
+}
+
+// HandleRTSP emulates an IP camera that asks for credentials on DESCRIBE,
+// capturing the stream paths and credentials tried by camera scanners
+func HandleRTSP(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedRTSP{}
+	defer func() {
+		if err := h.ProduceTCP("rtsp", conn, md, helpers.FirstOrEmpty[parsedRTSP](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "rtsp"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close RTSP connection", slog.String("protocol", "rtsp"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	localIP, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	session := strconv.FormatUint(uint64(binary.BigEndian.Uint32(nonceBytes)), 10)
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	for range rtspMaxRequests {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "rtsp"), producer.ErrAttr(err))
+			return nil
+		}
+		line, err := reader.ReadLine()
+		if err != nil {
+			logger.Debug("Failed to read RTSP request", slog.String("protocol", "rtsp"), producer.ErrAttr(err))
+			return nil
+		}
+		if line == "" {
+			continue
+		}
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			logger.Debug("Failed to read RTSP headers", slog.String("protocol", "rtsp"), producer.ErrAttr(err))
+			return nil
+		}
+		if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length > 0 && length <= rtspMaxBody {
+			if _, err := io.CopyN(io.Discard, reader.R, int64(length)); err != nil {
+				return nil
+			}
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasPrefix(fields[2], "RTSP/") {
+			events = append(events, parsedRTSP{Direction: "read", Payload: []byte(line)})
+			resp := rtspResponse(400, "Bad Request", textproto.MIMEHeader{}, "")
+			events = append(events, parsedRTSP{Direction: "write", Payload: []byte(resp)})
+			_, err := conn.Write([]byte(resp))
+			return err
+		}
+		event := parsedRTSP{
+			Direction: "read",
+			Method:    strings.ToUpper(fields[0]),
+			URL:       fields[1],
+			UserAgent: header.Get("User-Agent"),
+			Auth:      parseRTSPAuth(header.Get("Authorization")),
+			Payload:   []byte(line),
+		}
+		events = append(events, event)
+		logger.Info(
+			"RTSP request",
+			slog.String("handler", "rtsp"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("method", event.Method),
+			slog.String("url", event.URL),
+			slog.String("user_agent", event.UserAgent),
+		)
+		if event.Auth != nil {
+			logger.Info(
+				"RTSP login",
+				slog.String("handler", "rtsp"),
+				slog.String("src_ip", host),
+				slog.String("scheme", event.Auth.Scheme),
+				slog.String("username", event.Auth.Username),
+				slog.String("password", event.Auth.Password),
+				slog.String("response", event.Auth.Response),
+			)
+			cred := credentials.Credential{Protocol: "rtsp", Username: event.Auth.Username, Password: event.Auth.Password, Success: true}
+			if event.Auth.Response != "" {
+				cred.Hash, cred.HashType = event.Auth.Response, "http-digest"
+			}
+			helpers.RecordCredential(ctx, conn, md, cred, logger, h)
+		}
+
+		out := textproto.MIMEHeader{}
+		out.Set("CSeq", header.Get("CSeq"))
+		out.Set("Server", "Hipcam RealServer/V1.0")
+		status, reason, body := 200, "OK", ""
+		switch event.Method {
+		case "OPTIONS":
+			out.Set("Public", "OPTIONS, DESCRIBE, SETUP, TEARDOWN, PLAY, PAUSE, GET_PARAMETER, SET_PARAMETER")
+		case "DESCRIBE":
+			if event.Auth == nil {
+				status, reason = 401, "Unauthorized"
+				out.Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s"`, rtspRealm, nonce))
+				out.Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, rtspRealm))
+				break
+			}
+			out.Set("Content-Base", strings.TrimSuffix(event.URL, "/")+"/")
+			out.Set("Content-Type", "application/sdp")
+			body = fmt.Sprintf(rtspSDP, localIP, strings.TrimSuffix(event.URL, "/"))
+		case "SETUP":
+			transport := header.Get("Transport")
+			if transport == "" {
+				transport = "RTP/AVP;unicast"
+			}
+			out.Set("Transport", transport+";server_port=6970-6971;ssrc=5C3A1B2D;mode=play")
+			out.Set("Session", session+";timeout=60")
+		case "PLAY":
+			out.Set("Session", session)
+			out.Set("RTP-Info", fmt.Sprintf("url=%s/trackID=1;seq=1;rtptime=0", strings.TrimSuffix(event.URL, "/")))
+		case "PAUSE", "TEARDOWN", "GET_PARAMETER", "SET_PARAMETER", "ANNOUNCE":
+			out.Set("Session", session)
+		default:
+			status, reason = 405, "Method Not Allowed"
+		}
+
+		resp := rtspResponse(status, reason, out, body)
+		events = append(events, parsedRTSP{Direction: "write", Payload: []byte(resp)})
+		if _, err := conn.Write([]byte(resp)); err != nil {
+			return err
+		}
+		if event.Method == "TEARDOWN" {
+			return nil
+		}
+	}
+	return nil
+}
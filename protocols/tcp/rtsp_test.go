@@ -0,0 +1,21 @@
+package tcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRTSPAuth(t *testing.T) {
+	require.Equal(t, &rtspAuth{Scheme: "basic", Username: "admin", Password: "12345"}, parseRTSPAuth("Basic YWRtaW46MTIzNDU="))
+	require.Equal(t, &rtspAuth{
+		Scheme:   "digest",
+		Username: "admin",
+		Realm:    rtspRealm,
+		Nonce:    "abc",
+		URI:      "rtsp://10.0.0.1:554/Streaming/Channels/101",
+		Response: "6629fae49393a05397450978507c4ef1",
+	}, parseRTSPAuth(`Digest username="admin", realm="IP Camera(23421)", nonce="abc", uri="rtsp://10.0.0.1:554/Streaming/Channels/101", response="6629fae49393a05397450978507c4ef1"`))
+	require.Nil(t, parseRTSPAuth("Bearer"))
+	require.Nil(t, parseRTSPAuth("Basic !!!"))
+}
@@ -0,0 +1,351 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	cotpConnectionRequest = 0xe0
+	cotpConnectionConfirm = 0xd0
+	cotpData              = 0xf0
+
+	s7ProtocolID = 0x32
+	s7Job        = 0x01
+	s7AckData    = 0x03
+	s7UserData   = 0x07
+
+	s7SetupCommunication = 0xf0
+	s7ReadVar            = 0x04
+	s7WriteVar           = 0x05
+
+	s7MaxTPKT = 4096
+	s7MaxPDU  = 480
+)
+
+var s7Functions = map[byte]string{
+	0x00: "cpu_services",
+	0x04: "read_var",
+	0x05: "write_var",
+	0x1a: "request_download",
+	0x1b: "download_block",
+	0x1c: "download_ended",
+	0x1d: "start_upload",
+	0x1e: "upload",
+	0x1f: "end_upload",
+	0x28: "plc_control",
+	0x29: "plc_stop",
+	0xf0: "setup_communication",
+}
+
+type s7Request struct {
+	COTP     string `json:"cotp"`
+	ROSCTR   uint8  `json:"rosctr,omitempty"`
+	Function string `json:"function,omitempty"`
+	SZLID    uint16 `json:"szl_id,omitempty"`
+	SZLIndex uint16 `json:"szl_index,omitempty"`
+}
+
+type parsedS7 struct {
+	Direction string     `json:"direction,omitempty"`
+	Request   *s7Request `json:"request,omitempty"`
+	Payload   []byte     `json:"payload,omitempty"`
+}
+
+type s7PDU struct {
+	ROSCTR uint8
+	PDURef uint16
+	Params []byte
+	Data   []byte
+}
+
+func parseS7(data []byte) (s7PDU, error) {
+	pdu := s7PDU{}
+	if len(data) < 10 || data[0] != s7ProtocolID {
+		return pdu, errors.New("invalid S7 header")
+	}
+	pdu.ROSCTR = data[1]
+	pdu.PDURef = binary.BigEndian.Uint16(data[4:])
+	paramLen := int(binary.BigEndian.Uint16(data[6:]))
+	dataLen := int(binary.BigEndian.Uint16(data[8:]))
+	if len(data) < 10+paramLen+dataLen {
+		return pdu, errors.New("S7 PDU too short")
+	}
+	pdu.Params = data[10 : 10+paramLen]
+	pdu.Data = data[10+paramLen : 10+paramLen+dataLen]
+	return pdu, nil
+}
+
+// s7Packet builds an S7 PDU, acknowledgements carry an error class and code
+func s7Packet(rosctr uint8, pduRef uint16, params, data []byte, errClass, errCode byte) []byte {
+	buf := []byte{s7ProtocolID, rosctr, 0, 0}
+	buf = binary.BigEndian.AppendUint16(buf, pduRef)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(params)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(data)))
+	if rosctr == s7AckData {
+		buf = append(buf, errClass, errCode)
+	}
+	buf = append(buf, params...)
+	return append(buf, data...)
+}
+
+func tpktFrame(payload []byte) []byte {
+	buf := []byte{3, 0}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(payload)+4))
+	return append(buf, payload...)
+}
+
+// cotpConfirm answers a connection request, the TSAP parameters are echoed
+func cotpConfirm(tpdu []byte) []byte {
+	params := tpdu[7:]
+	resp := []byte{byte(6 + len(params)), cotpConnectionConfirm, tpdu[4], tpdu[5], 0x00, 0x01, 0x00}
+	return append(resp, params...)
+}
+
+// s7String pads value to size with the given fill byte
+func s7String(value string, size int, fill byte) []byte {
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = fill
+	}
+	copy(buf, value)
+	return buf
+}
+
+// s7Firmware turns a version like "V3.2.6" into the three version bytes
+func s7Firmware(version string) [3]byte {
+	out := [3]byte{}
+	for i, part := range strings.SplitN(strings.TrimPrefix(version, "V"), ".", 3) {
+		n, _ := strconv.Atoi(part)
+		out[i] = byte(n)
+	}
+	return out
+}
+
+// szlRecords returns the record length and records of a system status list,
+// only the lists read by device identification scanners are known
+func szlRecords(id uint16) (uint16, [][]byte, bool) {
+	switch id & 0x00ff {
+	case 0x11:
+		// module identification: order number, hardware and firmware
+		orderCode := viper.GetString("s7comm.order_code")
+		fw := s7Firmware(viper.GetString("s7comm.firmware"))
+		record := func(index uint16, mlfb string, ausbg, ausbe uint16) []byte {
+			buf := binary.BigEndian.AppendUint16(nil, index)
+			buf = append(buf, s7String(mlfb, 20, ' ')...)
+			buf = binary.BigEndian.AppendUint16(buf, 0)
+			buf = binary.BigEndian.AppendUint16(buf, ausbg)
+			return binary.BigEndian.AppendUint16(buf, ausbe)
+		}
+		return 28, [][]byte{
+			record(1, orderCode, 0, 4),
+			record(6, orderCode, 0, 4),
+			record(7, "", uint16('V')<<8|uint16(fw[0]), uint16(fw[1])<<8|uint16(fw[2])),
+		}, true
+	case 0x1c:
+		// component identification
+		record := func(index uint16, value string) []byte {
+			return append(binary.BigEndian.AppendUint16(nil, index), s7String(value, 32, 0)...)
+		}
+		return 34, [][]byte{
+			record(1, viper.GetString("s7comm.system_name")),
+			record(2, viper.GetString("s7comm.module_name")),
+			record(3, viper.GetString("s7comm.plant_id")),
+			record(4, viper.GetString("s7comm.copyright")),
+			record(5, viper.GetString("s7comm.serial_number")),
+			record(7, viper.GetString("s7comm.module_type")),
+		}, true
+	}
+	return 0, nil, false
+}
+
+// s7ReadSZL answers a userdata read SZL request
+func s7ReadSZL(req *s7Request, pdu s7PDU) []byte {
+	seq := byte(0)
+	if len(pdu.Params) >= 8 {
+		seq = pdu.Params[7]
+	}
+	params := []byte{0x00, 0x01, 0x12, 0x08, 0x12, 0x84, 0x01, seq, 0x00, 0x00}
+	if len(pdu.Data) < 8 {
+		params = append(params, 0xd4, 0x01)
+		return s7Packet(s7UserData, pdu.PDURef, params, []byte{0x0a, 0x00, 0x00, 0x00}, 0, 0)
+	}
+	req.SZLID = binary.BigEndian.Uint16(pdu.Data[4:])
+	req.SZLIndex = binary.BigEndian.Uint16(pdu.Data[6:])
+	size, records, ok := szlRecords(req.SZLID)
+	if !ok {
+		params = append(params, 0xd4, 0x01)
+		return s7Packet(s7UserData, pdu.PDURef, params, []byte{0x0a, 0x00, 0x00, 0x00}, 0, 0)
+	}
+	params = append(params, 0x00, 0x00)
+	szl := binary.BigEndian.AppendUint16(nil, req.SZLID)
+	szl = binary.BigEndian.AppendUint16(szl, req.SZLIndex)
+	szl = binary.BigEndian.AppendUint16(szl, size)
+	szl = binary.BigEndian.AppendUint16(szl, uint16(len(records)))
+	for _, record := range records {
+		szl = append(szl, record...)
+	}
+	data := []byte{0xff, 0x09}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(szl)))
+	return s7Packet(s7UserData, pdu.PDURef, params, append(data, szl...), 0, 0)
+}
+
+// s7Response answers a S7 PDU, variable access fails with object does not
+// exist and other jobs are rejected
+func s7Response(req *s7Request, pdu s7PDU) []byte {
+	req.ROSCTR = pdu.ROSCTR
+	switch pdu.ROSCTR {
+	case s7UserData:
+		// read SZL is subfunction 1 of the CPU functions group
+		if len(pdu.Params) >= 7 && pdu.Params[5]&0x0f == 0x04 && pdu.Params[6] == 0x01 {
+			req.Function = "read_szl"
+			return s7ReadSZL(req, pdu)
+		}
+		req.Function = "userdata"
+		return nil
+	case s7Job:
+	default:
+		return nil
+	}
+	if len(pdu.Params) == 0 {
+		return nil
+	}
+	function := pdu.Params[0]
+	req.Function = s7Functions[function]
+	if req.Function == "" {
+		req.Function = fmt.Sprintf("0x%02x", function)
+	}
+	switch function {
+	case s7SetupCommunication:
+		if len(pdu.Params) < 8 {
+			return nil
+		}
+		params := append([]byte{}, pdu.Params[:8]...)
+		if binary.BigEndian.Uint16(params[6:]) > s7MaxPDU {
+			binary.BigEndian.PutUint16(params[6:], s7MaxPDU)
+		}
+		return s7Packet(s7AckData, pdu.PDURef, params, nil, 0, 0)
+	case s7ReadVar, s7WriteVar:
+		if len(pdu.Params) < 2 {
+			return nil
+		}
+		items := pdu.Params[1]
+		data := []byte{}
+		for i := byte(0); i < items; i++ {
+			if function == s7ReadVar {
+				data = append(data, 0x0a, 0x00, 0x00, 0x00)
+			} else {
+				data = append(data, 0x0a)
+			}
+		}
+		return s7Packet(s7AckData, pdu.PDURef, []byte{function, items}, data, 0, 0)
+	}
+	return s7Packet(s7AckData, pdu.PDURef, []byte{function}, nil, 0x81, 0x04)
+}
+
+// HandleS7Comm handles ISO-TSAP connections and answers S7 communication
+// setup and device identification like a Siemens PLC
+func HandleS7Comm(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedS7{}
+	defer func() {
+		if err := h.ProduceTCP("s7comm", conn, md, helpers.FirstOrEmpty[parsedS7](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "s7comm"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close S7comm connection", slog.String("protocol", "s7comm"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "s7comm"), producer.ErrAttr(err))
+			return nil
+		}
+		if _, err := io.ReadFull(conn, header); err != nil {
+			logger.Debug("Failed to read TPKT header", slog.String("protocol", "s7comm"), producer.ErrAttr(err))
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(header[2:]))
+		if header[0] != 3 || length < 7 || length > s7MaxTPKT {
+			logger.Debug("Invalid TPKT header", slog.String("protocol", "s7comm"))
+			return nil
+		}
+		tpdu := make([]byte, length-4)
+		if _, err := io.ReadFull(conn, tpdu); err != nil {
+			logger.Debug("Failed to read COTP packet", slog.String("protocol", "s7comm"), producer.ErrAttr(err))
+			return nil
+		}
+		if int(tpdu[0]) >= len(tpdu) {
+			logger.Debug("Invalid COTP header", slog.String("protocol", "s7comm"))
+			return nil
+		}
+
+		req := &s7Request{}
+		var resp []byte
+		switch tpdu[1] & 0xf0 {
+		case cotpConnectionRequest:
+			req.COTP = "connection_request"
+			if tpdu[0] >= 6 {
+				resp = cotpConfirm(tpdu[:tpdu[0]+1])
+			}
+		case cotpData:
+			req.COTP = "data"
+			pdu, err := parseS7(tpdu[tpdu[0]+1:])
+			if err != nil {
+				logger.Debug("Failed to parse S7 PDU", slog.String("protocol", "s7comm"), producer.ErrAttr(err))
+				break
+			}
+			if s7 := s7Response(req, pdu); s7 != nil {
+				resp = append([]byte{0x02, cotpData, 0x80}, s7...)
+			}
+		default:
+			req.COTP = fmt.Sprintf("0x%02x", tpdu[1])
+		}
+		events = append(events, parsedS7{
+			Direction: "read",
+			Request:   req,
+			Payload:   append(header, tpdu...),
+		})
+		logger.Info(
+			"S7comm request",
+			slog.String("handler", "s7comm"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("cotp", req.COTP),
+			slog.String("function", req.Function),
+			slog.Int("szl_id", int(req.SZLID)),
+		)
+		if resp == nil {
+			continue
+		}
+
+		out := tpktFrame(resp)
+		events = append(events, parsedS7{
+			Direction: "write",
+			Payload:   out,
+		})
+		if _, err := conn.Write(out); err != nil {
+			return err
+		}
+	}
+}
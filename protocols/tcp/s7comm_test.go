@@ -0,0 +1,53 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS7Comm(t *testing.T) {
+	viper.Set("s7comm.system_name", "SIMATIC 300(1)")
+	viper.Set("s7comm.order_code", "6ES7 315-2EH14-0AB0")
+	viper.Set("s7comm.firmware", "V3.2.6")
+	defer viper.Reset()
+
+	cr := []byte{0x11, 0xe0, 0x00, 0x00, 0x00, 0x01, 0x00, 0xc0, 0x01, 0x0a, 0xc1, 0x02, 0x01, 0x00, 0xc2, 0x02, 0x01, 0x02}
+	cc := cotpConfirm(cr)
+	require.Equal(t, byte(cotpConnectionConfirm), cc[1])
+	require.Equal(t, cr[7:], cc[7:])
+
+	setup, err := parseS7([]byte{0x32, 0x01, 0x00, 0x00, 0x00, 0x05, 0x00, 0x08, 0x00, 0x00, 0xf0, 0x00, 0x00, 0x01, 0x00, 0x01, 0x03, 0xc0})
+	require.NoError(t, err)
+	req := &s7Request{}
+	resp := s7Response(req, setup)
+	require.Equal(t, "setup_communication", req.Function)
+	require.Equal(t, byte(s7AckData), resp[1])
+	require.Equal(t, uint16(s7MaxPDU), binary.BigEndian.Uint16(resp[18:]))
+
+	szl, err := parseS7([]byte{
+		0x32, 0x07, 0x00, 0x00, 0x00, 0x06, 0x00, 0x08, 0x00, 0x08,
+		0x00, 0x01, 0x12, 0x04, 0x11, 0x44, 0x01, 0x00,
+		0xff, 0x09, 0x00, 0x04, 0x00, 0x1c, 0x00, 0x00,
+	})
+	require.NoError(t, err)
+	req = &s7Request{}
+	resp = s7Response(req, szl)
+	require.Equal(t, "read_szl", req.Function)
+	require.Equal(t, uint16(0x1c), req.SZLID)
+	require.Contains(t, string(resp), "SIMATIC 300(1)")
+
+	size, records, ok := szlRecords(0x11)
+	require.True(t, ok)
+	require.Equal(t, uint16(28), size)
+	require.Equal(t, []byte{'V', 3, 2, 6}, records[2][24:])
+
+	stop, err := parseS7([]byte{0x32, 0x01, 0x00, 0x00, 0x00, 0x07, 0x00, 0x01, 0x00, 0x00, 0x29})
+	require.NoError(t, err)
+	req = &s7Request{}
+	resp = s7Response(req, stop)
+	require.Equal(t, "plc_stop", req.Function)
+	require.Equal(t, []byte{0x81, 0x04}, resp[10:12])
+}
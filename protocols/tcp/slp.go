@@ -0,0 +1,107 @@
+package tcp
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// slpMaxMessage bounds the SLP length field, the overflows aimed at OpenSLP
+// fit easily
+const slpMaxMessage = 64 << 10
+
+type parsedSLP struct {
+	Direction string             `json:"direction,omitempty"`
+	Message   helpers.SLPMessage `json:"message,omitempty"`
+	Payload   []byte             `json:"payload,omitempty"`
+}
+
+// HandleSLP answers SLP service requests with the services of a VMware ESXi
+// host and records the directory agent adverts OpenSLP exploits are made of
+func HandleSLP(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedSLP{}
+	defer func() {
+		if err := h.ProduceTCP("slp", conn, md, helpers.FirstOrEmpty[parsedSLP](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "slp"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close SLP connection", slog.String("protocol", "slp"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	localHost, _, err := net.SplitHostPort(conn.LocalAddr().String())
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			logger.Debug("Failed to set connection timeout", slog.String("protocol", "slp"), producer.ErrAttr(err))
+			return nil
+		}
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			logger.Debug("Failed to read SLP header", slog.String("protocol", "slp"), producer.ErrAttr(err))
+			return nil
+		}
+		length := helpers.SLPLength(header)
+		if length < len(header) || length > slpMaxMessage {
+			logger.Debug("Invalid SLP message length", slog.String("protocol", "slp"), slog.Int("length", length))
+			return nil
+		}
+		data := make([]byte, length)
+		copy(data, header)
+		if _, err := io.ReadFull(conn, data[len(header):]); err != nil {
+			logger.Debug("Failed to read SLP message", slog.String("protocol", "slp"), producer.ErrAttr(err))
+			return nil
+		}
+
+		resp, msg, err := helpers.SLPResponse(data, localHost)
+		events = append(events, parsedSLP{
+			Direction: "read",
+			Message:   msg,
+			Payload:   data,
+		})
+		if err != nil {
+			logger.Debug("Failed to parse SLP message", slog.String("protocol", "slp"), producer.ErrAttr(err))
+			return nil
+		}
+		if msg.Function == "da_advert" && !slices.Contains(md.Tags, "slp_da_advert") {
+			md.Tags = append(md.Tags, "slp_da_advert")
+		}
+		logger.Info(
+			"SLP message",
+			slog.String("handler", "slp"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("function", msg.Function),
+			slog.String("service_type", msg.ServiceType),
+			slog.String("url", msg.URL),
+		)
+		if resp == nil {
+			continue
+		}
+
+		events = append(events, parsedSLP{
+			Direction: "write",
+			Message:   msg,
+			Payload:   resp,
+		})
+		if _, err := conn.Write(resp); err != nil {
+			return err
+		}
+	}
+}
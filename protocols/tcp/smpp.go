@@ -0,0 +1,297 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	smppGenericNack     = 0x80000000
+	smppBindReceiver    = 0x00000001
+	smppBindTransmitter = 0x00000002
+	smppSubmitSM        = 0x00000004
+	smppUnbind          = 0x00000006
+	smppBindTransceiver = 0x00000009
+	smppEnquireLink     = 0x00000015
+	smppResponse        = 0x80000000
+
+	smppStatusInvalidCommand = 0x00000003
+
+	smppTagMessagePayload = 0x0424
+	smppDataCodingUCS2    = 8
+
+	smppSystemID = "SMSC"
+	smppMaxPDU   = 1 << 16
+	smppMaxPDUs  = 100
+)
+
+var smppCommands = map[uint32]string{
+	smppBindReceiver:    "bind_receiver",
+	smppBindTransmitter: "bind_transmitter",
+	smppSubmitSM:        "submit_sm",
+	smppUnbind:          "unbind",
+	smppBindTransceiver: "bind_transceiver",
+	smppEnquireLink:     "enquire_link",
+	0x00000003:          "query_sm",
+	0x00000021:          "submit_multi",
+	0x00000103:          "data_sm",
+}
+
+type parsedSMPP struct {
+	Direction   string `json:"direction,omitempty"`
+	Command     string `json:"command,omitempty"`
+	SystemID    string `json:"system_id,omitempty"`
+	Password    string `json:"password,omitempty"`
+	SystemType  string `json:"system_type,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	DataCoding  int    `json:"data_coding,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Payload     []byte `json:"payload,omitempty"`
+}
+
+type smppPDU struct {
+	command uint32
+	seq     uint32
+	body    []byte
+}
+
+func readSMPPPDU(r io.Reader) (*smppPDU, []byte, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length < 16 || length > smppMaxPDU {
+		return nil, header, errors.New("invalid SMPP PDU length")
+	}
+	raw := append(header, make([]byte, length-16)...)
+	if _, err := io.ReadFull(r, raw[16:]); err != nil {
+		return nil, header, err
+	}
+	return &smppPDU{
+		command: binary.BigEndian.Uint32(header[4:]),
+		seq:     binary.BigEndian.Uint32(header[12:]),
+		body:    raw[16:],
+	}, raw, nil
+}
+
+func smppFrame(command, status, seq uint32, body []byte) []byte {
+	pdu := binary.BigEndian.AppendUint32(nil, uint32(16+len(body)))
+	pdu = binary.BigEndian.AppendUint32(pdu, command)
+	pdu = binary.BigEndian.AppendUint32(pdu, status)
+	pdu = binary.BigEndian.AppendUint32(pdu, seq)
+	return append(pdu, body...)
+}
+
+// smppReader reads the fields of a PDU body
+type smppReader struct {
+	*bytes.Reader
+}
+
+func (r smppReader) cString() (string, error) {
+	value := []byte{}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == 0 {
+			return string(value), nil
+		}
+		value = append(value, b)
+	}
+}
+
+func (r smppReader) skip(n int64) error {
+	_, err := r.Seek(n, io.SeekCurrent)
+	return err
+}
+
+func parseSMPPBind(body []byte, msg *parsedSMPP) error {
+	r := smppReader{bytes.NewReader(body)}
+	var err error
+	if msg.SystemID, err = r.cString(); err != nil {
+		return err
+	}
+	if msg.Password, err = r.cString(); err != nil {
+		return err
+	}
+	msg.SystemType, err = r.cString()
+	return err
+}
+
+// smppMessage decodes a short message by its data coding, UCS2 messages
+// are converted and everything else is kept as sent
+func smppMessage(data []byte, coding int) string {
+	if coding != smppDataCodingUCS2 || len(data)%2 != 0 {
+		return string(data)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func parseSMPPSubmit(body []byte, msg *parsedSMPP) error {
+	r := smppReader{bytes.NewReader(body)}
+	var err error
+	if _, err = r.cString(); err != nil {
+		return err
+	}
+	if err = r.skip(2); err != nil {
+		return err
+	}
+	if msg.Source, err = r.cString(); err != nil {
+		return err
+	}
+	if err = r.skip(2); err != nil {
+		return err
+	}
+	if msg.Destination, err = r.cString(); err != nil {
+		return err
+	}
+	// esm class, protocol id, priority flag
+	if err = r.skip(3); err != nil {
+		return err
+	}
+	for range 2 {
+		if _, err = r.cString(); err != nil {
+			return err
+		}
+	}
+	// registered delivery, replace if present, data coding, default message
+	// id, message length
+	fields := make([]byte, 5)
+	if _, err = io.ReadFull(r, fields); err != nil {
+		return err
+	}
+	msg.DataCoding = int(fields[2])
+	message := make([]byte, fields[4])
+	if _, err = io.ReadFull(r, message); err != nil {
+		return err
+	}
+	// long messages come in the message_payload TLV instead
+	for len(message) == 0 && r.Len() >= 4 {
+		tlv := make([]byte, 4)
+		if _, err = io.ReadFull(r, tlv); err != nil {
+			return err
+		}
+		value := make([]byte, binary.BigEndian.Uint16(tlv[2:]))
+		if _, err = io.ReadFull(r, value); err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint16(tlv) == smppTagMessagePayload {
+			message = value
+		}
+	}
+	msg.Message = smppMessage(message, msg.DataCoding)
+	return nil
+}
+
+// smppResponsePDU accepts every bind and submission, submissions are
+// given a message id like an SMSC queueing them would
+func smppResponsePDU(pdu *smppPDU) []byte {
+	switch pdu.command {
+	case smppBindReceiver, smppBindTransmitter, smppBindTransceiver:
+		body := append([]byte(smppSystemID), 0)
+		// sc_interface_version 3.4
+		body = append(body, 0x02, 0x10, 0x00, 0x01, 0x34)
+		return smppFrame(pdu.command|smppResponse, 0, pdu.seq, body)
+	case smppSubmitSM:
+		id := make([]byte, 4)
+		_, _ = rand.Read(id)
+		return smppFrame(pdu.command|smppResponse, 0, pdu.seq, append([]byte(hex.EncodeToString(id)), 0))
+	case smppEnquireLink, smppUnbind:
+		return smppFrame(pdu.command|smppResponse, 0, pdu.seq, nil)
+	}
+	return smppFrame(smppGenericNack, smppStatusInvalidCommand, pdu.seq, nil)
+}
+
+// HandleSMPP emulates an SMSC accepting any bind, harvesting the system_id
+// and password pairs of SMS gateway scanners and the messages they submit
+func HandleSMPP(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedSMPP{}
+	defer func() {
+		if err := h.ProduceTCP("smpp", conn, md, helpers.FirstOrEmpty[parsedSMPP](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "smpp"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close SMPP connection", slog.String("protocol", "smpp"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	for range smppMaxPDUs {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		pdu, raw, err := readSMPPPDU(conn)
+		if err != nil {
+			if len(raw) > 0 {
+				events = append(events, parsedSMPP{Direction: "read", Payload: raw})
+			}
+			logger.Debug("Failed to read SMPP PDU", slog.String("protocol", "smpp"), producer.ErrAttr(err))
+			return nil
+		}
+		msg := parsedSMPP{Direction: "read", Command: smppCommands[pdu.command], Payload: raw}
+		switch pdu.command {
+		case smppBindReceiver, smppBindTransmitter, smppBindTransceiver:
+			err = parseSMPPBind(pdu.body, &msg)
+		case smppSubmitSM:
+			err = parseSMPPSubmit(pdu.body, &msg)
+		}
+		if err != nil {
+			logger.Debug("Failed to parse SMPP PDU", slog.String("protocol", "smpp"), producer.ErrAttr(err))
+		}
+		events = append(events, msg)
+		if pdu.command != smppEnquireLink {
+			logger.Info(
+				"SMPP PDU",
+				slog.String("handler", "smpp"),
+				slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+				slog.String("src_ip", host),
+				slog.String("src_port", port),
+				slog.String("command", msg.Command),
+				slog.String("system_id", msg.SystemID),
+				slog.String("password", msg.Password),
+				slog.String("destination", msg.Destination),
+				slog.String("message", msg.Message),
+			)
+		}
+		if strings.HasPrefix(msg.Command, "bind_") {
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "smpp", Username: msg.SystemID, Password: msg.Password, Success: true}, logger, h)
+		}
+
+		resp := smppResponsePDU(pdu)
+		events = append(events, parsedSMPP{Direction: "write", Payload: resp})
+		if _, err := conn.Write(resp); err != nil {
+			return err
+		}
+		if pdu.command == smppUnbind {
+			return nil
+		}
+	}
+	return nil
+}
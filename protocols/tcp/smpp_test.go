@@ -0,0 +1,36 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMPPPDUs(t *testing.T) {
+	bind := smppFrame(smppBindTransceiver, 0, 1, []byte("smppclient1\x00password\x00VMA\x00\x34\x00\x00\x00"))
+	pdu, raw, err := readSMPPPDU(bytes.NewReader(bind))
+	require.NoError(t, err)
+	require.Equal(t, bind, raw)
+	msg := parsedSMPP{}
+	require.NoError(t, parseSMPPBind(pdu.body, &msg))
+	require.Equal(t, parsedSMPP{SystemID: "smppclient1", Password: "password", SystemType: "VMA"}, msg)
+	resp := smppResponsePDU(pdu)
+	require.Equal(t, uint32(0x80000009), binary.BigEndian.Uint32(resp[4:]))
+	require.Equal(t, uint32(1), binary.BigEndian.Uint32(resp[12:]))
+
+	body := []byte("\x00\x05\x00Bank\x00\x01\x01+15550100\x00\x00\x00\x00\x00\x00\x00\x00\x08\x00\x00")
+	body = append(body, 0x04, 0x24, 0, 6, 0, 'O', 0, 'T', 0, 'P')
+	pdu, _, err = readSMPPPDU(bytes.NewReader(smppFrame(smppSubmitSM, 0, 2, body)))
+	require.NoError(t, err)
+	msg = parsedSMPP{}
+	require.NoError(t, parseSMPPSubmit(pdu.body, &msg))
+	require.Equal(t, parsedSMPP{Source: "Bank", Destination: "+15550100", DataCoding: 8, Message: "OTP"}, msg)
+	resp = smppResponsePDU(pdu)
+	require.Len(t, resp, 16+9)
+
+	resp = smppResponsePDU(&smppPDU{command: 0x00000103, seq: 3})
+	require.Equal(t, uint32(smppGenericNack), binary.BigEndian.Uint32(resp[4:]))
+	require.Equal(t, uint32(smppStatusInvalidCommand), binary.BigEndian.Uint32(resp[8:]))
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"log/slog"
 	"math/big"
 	"net"
@@ -12,7 +14,9 @@ import (
 	"time"
 
 	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
 	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
 	"github.com/mushorg/glutton/protocols/interfaces"
 )
 
@@ -53,6 +57,59 @@ func validateRCPT(query string) bool {
 	return rcpt.MatchString(query)
 }
 
+var errSMTPAuthMechanism = errors.New("unsupported SMTP AUTH mechanism")
+
+// readSMTPAuth runs the PLAIN or LOGIN exchange started by the AUTH command
+// in query and returns the credentials the client sent
+func readSMTPAuth(client *Client, query string) (string, string, error) {
+	fields := strings.Fields(query)
+	if len(fields) < 2 {
+		return "", "", errSMTPAuthMechanism
+	}
+	// response prompts the client unless it sent the initial response with
+	// the command
+	response := func(initial int, prompt string) (string, error) {
+		value := ""
+		if len(fields) > initial {
+			value = fields[initial]
+		} else {
+			client.w("334 " + prompt)
+			line, err := client.read()
+			if err != nil {
+				return "", err
+			}
+			value = strings.TrimSpace(line)
+		}
+		if value == "*" {
+			return "", errors.New("SMTP AUTH canceled")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		return string(decoded), err
+	}
+
+	switch strings.ToUpper(fields[1]) {
+	case "PLAIN":
+		value, err := response(2, "")
+		if err != nil {
+			return "", "", err
+		}
+		// authorization identity, authentication identity and password
+		parts := strings.SplitN(value, "\x00", 3)
+		if len(parts) != 3 {
+			return "", "", errors.New("invalid SMTP AUTH PLAIN response")
+		}
+		return parts[1], parts[2], nil
+	case "LOGIN":
+		username, err := response(2, "VXNlcm5hbWU6")
+		if err != nil {
+			return "", "", err
+		}
+		password, err := response(3, "UGFzc3dvcmQ6")
+		return username, password, err
+	}
+	return "", "", errSMTPAuthMechanism
+}
+
 // HandleSMTP takes a net.Conn and does basic SMTP communication
 func HandleSMTP(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
 	defer func() {
@@ -61,6 +118,11 @@ func HandleSMTP(ctx context.Context, conn net.Conn, md connection.Metadata, logg
 		}
 	}()
 
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
 	client := &Client{
 		conn:   conn,
 		bufin:  bufio.NewReader(conn),
@@ -86,6 +148,32 @@ func HandleSMTP(ctx context.Context, conn net.Conn, md connection.Metadata, logg
 				return err
 			}
 			client.w("250 Hello! Pleased to meet you.")
+		} else if strings.HasPrefix(query, "EHLO ") {
+			if err := randomSleep(); err != nil {
+				return err
+			}
+			client.w("250-Hello! Pleased to meet you.")
+			client.w("250 AUTH LOGIN PLAIN")
+		} else if strings.HasPrefix(strings.ToUpper(query), "AUTH ") {
+			username, password, err := readSMTPAuth(client, query)
+			switch {
+			case errors.Is(err, errSMTPAuthMechanism):
+				client.w("504 5.5.4 Unrecognized authentication type")
+				continue
+			case err != nil:
+				logger.Debug("Failed to read SMTP AUTH response", slog.String("protocol", "smtp"), producer.ErrAttr(err))
+				client.w("501 5.5.2 Cannot decode response")
+				continue
+			}
+			logger.Info(
+				"SMTP auth attempt",
+				slog.String("handler", "smtp"),
+				slog.String("src_ip", host),
+				slog.String("username", username),
+				slog.String("password", password),
+			)
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "smtp", Username: username, Password: password}, logger, h)
+			client.w("535 5.7.8 Authentication credentials invalid")
 		} else if validateMail(query) {
 			if err := randomSleep(); err != nil {
 				return err
@@ -1,8 +1,16 @@
 package tcp
 
 import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
 	"testing"
 
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -15,3 +23,63 @@ func TestValidateRCPT(t *testing.T) {
 	require.True(t, validateRCPT("RCPT TO:<example@example.com>"), "validate rcpt regex failed")
 	require.False(t, validateRCPT("RCPT TO:<example.com>"), "validate rcpt regex failed")
 }
+
+func TestHandleSMTPAuth(t *testing.T) {
+	tracker := isolateBruteForce(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+
+	creds := []string{}
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("smtp", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(_ string, _ net.Conn, _ connection.Metadata, _ []byte, event interface{}) {
+			data, err := json.Marshal(event)
+			require.NoError(t, err)
+			creds = append(creds, string(data))
+		}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("SMTP auth attempt", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	done := make(chan error)
+	go func() {
+		done <- HandleSMTP(context.Background(), server, connection.Metadata{TargetPort: 25}, l, h)
+	}()
+
+	reader := bufio.NewReader(client)
+	exchange := func(line string, want ...string) {
+		_, err := client.Write([]byte(line + "\r\n"))
+		require.NoError(t, err)
+		for _, w := range want {
+			got, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			require.Equal(t, w+"\r\n", got)
+		}
+	}
+	greeting, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "220 Welcome!\r\n", greeting)
+
+	exchange("AUTH PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00admin\x00admin123")), "535 5.7.8 Authentication credentials invalid")
+	exchange("AUTH LOGIN", "334 VXNlcm5hbWU6")
+	exchange(base64.StdEncoding.EncodeToString([]byte("info@example.com")), "334 UGFzc3dvcmQ6")
+	exchange(base64.StdEncoding.EncodeToString([]byte("123456")), "535 5.7.8 Authentication credentials invalid")
+	exchange("AUTH CRAM-MD5", "504 5.5.4 Unrecognized authentication type")
+	exchange("AUTH PLAIN", "334 ")
+	exchange("*", "501 5.5.2 Cannot decode response")
+	exchange("QUIT", "Bye")
+
+	require.NoError(t, <-done)
+	require.Equal(t, 2, tracker.Failures("127.0.0.1"))
+	require.Len(t, creds, 2)
+	require.JSONEq(t, `{"event": "credential", "protocol": "smtp", "username": "admin", "password": "admin123", "success": false}`, creds[0])
+	require.JSONEq(t, `{"event": "credential", "protocol": "smtp", "username": "info@example.com", "password": "123456", "success": false}`, creds[1])
+}
@@ -0,0 +1,292 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+// socksMaxTunnel is how much of the tunneled data is kept after a simulated
+// successful connect
+const socksMaxTunnel = 4096
+
+var socksCommands = map[byte]string{1: "connect", 2: "bind", 3: "udp_associate"}
+
+type socksRequest struct {
+	Version  int    `json:"version"`
+	Command  string `json:"command,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Port     uint16 `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type parsedSOCKS struct {
+	Direction string        `json:"direction,omitempty"`
+	Request   *socksRequest `json:"request,omitempty"`
+	Payload   []byte        `json:"payload,omitempty"`
+}
+
+func readNullTerminated(r *bufio.Reader, limit int) (string, error) {
+	value := []byte{}
+	for len(value) < limit {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == 0 {
+			return string(value), nil
+		}
+		value = append(value, b)
+	}
+	return "", errors.New("SOCKS string too long")
+}
+
+// readSOCKS4 reads a SOCKS4 or SOCKS4a request after the version byte
+func readSOCKS4(r *bufio.Reader) (*socksRequest, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	req := &socksRequest{
+		Version: 4,
+		Command: socksCommands[header[0]],
+		Port:    binary.BigEndian.Uint16(header[1:3]),
+		Host:    net.IP(header[3:7]).String(),
+	}
+	var err error
+	if req.Username, err = readNullTerminated(r, 255); err != nil {
+		return nil, err
+	}
+	// SOCKS4a puts the hostname after the user ID and sets the address to 0.0.0.x
+	if header[3] == 0 && header[4] == 0 && header[5] == 0 && header[6] != 0 {
+		if req.Host, err = readNullTerminated(r, 255); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// socks5Server runs the SOCKS5 method negotiation, authentication and request
+type socks5Server struct {
+	reader *bufio.Reader
+	conn   net.Conn
+	events []parsedSOCKS
+}
+
+func (s *socks5Server) write(data []byte) error {
+	if _, err := s.conn.Write(data); err != nil {
+		return err
+	}
+	s.events = append(s.events, parsedSOCKS{Direction: "write", Payload: data})
+	return nil
+}
+
+func (s *socks5Server) readString() (string, error) {
+	size, err := s.reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	value := make([]byte, size)
+	if _, err := io.ReadFull(s.reader, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func (s *socks5Server) negotiate() (*socksRequest, error) {
+	count, err := s.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	methods := make([]byte, count)
+	if _, err := io.ReadFull(s.reader, methods); err != nil {
+		return nil, err
+	}
+	req := &socksRequest{Version: 5}
+
+	// prefer username/password authentication to learn the credentials
+	switch {
+	case slices.Contains(methods, 0x02):
+		if err := s.write([]byte{0x05, 0x02}); err != nil {
+			return nil, err
+		}
+		version, err := s.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if version != 0x01 {
+			return nil, fmt.Errorf("unexpected SOCKS5 auth version %d", version)
+		}
+		if req.Username, err = s.readString(); err != nil {
+			return nil, err
+		}
+		if req.Password, err = s.readString(); err != nil {
+			return nil, err
+		}
+		if err := s.write([]byte{0x01, 0x00}); err != nil {
+			return nil, err
+		}
+	case slices.Contains(methods, 0x00):
+		if err := s.write([]byte{0x05, 0x00}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, s.write([]byte{0x05, 0xff})
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s.reader, header); err != nil {
+		return nil, err
+	}
+	req.Command = socksCommands[header[1]]
+	switch header[3] {
+	case 0x01, 0x04:
+		addr := make([]byte, 4)
+		if header[3] == 0x04 {
+			addr = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(s.reader, addr); err != nil {
+			return nil, err
+		}
+		req.Host = net.IP(addr).String()
+	case 0x03:
+		if req.Host, err = s.readString(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SOCKS5 address type %d", header[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(s.reader, port); err != nil {
+		return nil, err
+	}
+	req.Port = binary.BigEndian.Uint16(port)
+	return req, nil
+}
+
+// socksReply builds the response to a request, granted requests report the
+// address the client connected to as the bound address
+func socksReply(req *socksRequest, granted bool, bound *net.TCPAddr) []byte {
+	ip := net.IPv4zero.To4()
+	port := uint16(0)
+	if bound != nil && bound.IP.To4() != nil {
+		ip, port = bound.IP.To4(), uint16(bound.Port)
+	}
+	if req.Version == 4 {
+		code := byte(0x5b)
+		if granted {
+			code = 0x5a
+		}
+		return append([]byte{0x00, code, byte(port >> 8), byte(port)}, ip...)
+	}
+	code := byte(0x02)
+	switch {
+	case req.Command != "connect":
+		code = 0x07
+	case granted:
+		code = 0x00
+	}
+	resp := append([]byte{0x05, code, 0x00, 0x01}, ip...)
+	return append(resp, byte(port>>8), byte(port))
+}
+
+// HandleSOCKS completes SOCKS4, SOCKS4a and SOCKS5 handshakes, recording the
+// requested destination and credentials. Connects are never relayed, with
+// socks.simulate_success set the client is told it succeeded and the first
+// data it sends through the tunnel is recorded.
+func HandleSOCKS(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	server := &socks5Server{
+		reader: bufio.NewReader(conn),
+		conn:   conn,
+		events: []parsedSOCKS{},
+	}
+	defer func() {
+		if err := h.ProduceTCP("socks", conn, md, helpers.FirstOrEmpty[parsedSOCKS](server.events).Payload, server.events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "socks"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close SOCKS connection", slog.String("protocol", "socks"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	version, err := server.reader.ReadByte()
+	if err != nil {
+		logger.Debug("Failed to read SOCKS version", slog.String("protocol", "socks"), producer.ErrAttr(err))
+		return nil
+	}
+	var req *socksRequest
+	switch version {
+	case 0x04:
+		req, err = readSOCKS4(server.reader)
+	case 0x05:
+		req, err = server.negotiate()
+	default:
+		err = fmt.Errorf("unsupported SOCKS version %d", version)
+	}
+	if err != nil || req == nil {
+		logger.Debug("Failed to read SOCKS request", slog.String("protocol", "socks"), producer.ErrAttr(err))
+		return nil
+	}
+	server.events = append(server.events, parsedSOCKS{Direction: "read", Request: req})
+	if !slices.Contains(md.Tags, "socks_proxy") {
+		md.Tags = append(md.Tags, "socks_proxy")
+	}
+	logger.Info(
+		"SOCKS request",
+		slog.String("handler", "socks"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.Int("version", req.Version),
+		slog.String("command", req.Command),
+		slog.String("target", net.JoinHostPort(req.Host, strconv.Itoa(int(req.Port)))),
+		slog.String("username", req.Username),
+		slog.String("password", req.Password),
+	)
+	if req.Password != "" {
+		helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "socks", Username: req.Username, Password: req.Password, Success: true}, logger, h)
+	}
+
+	granted := req.Command == "connect" && viper.GetBool("socks.simulate_success")
+	bound, _ := conn.LocalAddr().(*net.TCPAddr)
+	if err := server.write(socksReply(req, granted, bound)); err != nil {
+		return err
+	}
+	if !granted {
+		return nil
+	}
+
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		logger.Debug("Failed to set connection timeout", slog.String("protocol", "socks"), producer.ErrAttr(err))
+		return nil
+	}
+	buf := make([]byte, socksMaxTunnel)
+	n, err := server.reader.Read(buf)
+	if n > 0 {
+		server.events = append(server.events, parsedSOCKS{Direction: "read", Payload: buf[:n]})
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		logger.Debug("Failed to read SOCKS tunnel data", slog.String("protocol", "socks"), producer.ErrAttr(err))
+	}
+	return nil
+}
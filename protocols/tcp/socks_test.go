@@ -0,0 +1,49 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSOCKS4(t *testing.T) {
+	req, err := readSOCKS4(bufio.NewReader(bytes.NewReader([]byte("\x01\x00\x50\x00\x00\x00\x01bot\x00example.com\x00"))))
+	require.NoError(t, err)
+	require.Equal(t, &socksRequest{Version: 4, Command: "connect", Host: "example.com", Port: 80, Username: "bot"}, req)
+
+	bound := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1080}
+	require.Equal(t, []byte{0x00, 0x5a, 0x04, 0x38, 10, 0, 0, 1}, socksReply(req, true, bound))
+}
+
+func TestSOCKS5Negotiate(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	s := &socks5Server{reader: bufio.NewReader(server), conn: server}
+	done := make(chan *socksRequest)
+	go func() {
+		req, err := s.negotiate()
+		require.NoError(t, err)
+		done <- req
+	}()
+
+	resp := make([]byte, 2)
+	_, err := client.Write([]byte{0x02, 0x00, 0x02})
+	require.NoError(t, err)
+	_, err = client.Read(resp)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x05, 0x02}, resp)
+	_, err = client.Write([]byte("\x01\x04user\x04pass"))
+	require.NoError(t, err)
+	_, err = client.Read(resp)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x01, 0x00}, resp)
+	_, err = client.Write([]byte("\x05\x01\x00\x03\x0dsmtp.mail.com\x00\x19"))
+	require.NoError(t, err)
+
+	req := <-done
+	require.Equal(t, &socksRequest{Version: 5, Command: "connect", Host: "smtp.mail.com", Port: 25, Username: "user", Password: "pass"}, req)
+	require.Equal(t, []byte{0x05, 0x02, 0x00, 0x01, 0, 0, 0, 0, 0, 0}, socksReply(req, false, nil))
+}
@@ -0,0 +1,197 @@
+package tcp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshServerVersion = "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6"
+	sshMaxAuthTries  = 6
+)
+
+var (
+	sshHostKeys     []ssh.Signer
+	sshHostKeysErr  error
+	sshHostKeysOnce sync.Once
+)
+
+type sshAuth struct {
+	Method      string `json:"method"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	KeyType     string `json:"key_type,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+type parsedSSH struct {
+	ClientVersion string    `json:"client_version,omitempty"`
+	Auth          []sshAuth `json:"auth,omitempty"`
+}
+
+// hostKeys generates the RSA and Ed25519 host keys once per process
+func hostKeys() ([]ssh.Signer, error) {
+	sshHostKeysOnce.Do(func() {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 3072)
+		if err != nil {
+			sshHostKeysErr = err
+			return
+		}
+		rsaSigner, err := ssh.NewSignerFromKey(rsaKey)
+		if err != nil {
+			sshHostKeysErr = err
+			return
+		}
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			sshHostKeysErr = err
+			return
+		}
+		edSigner, err := ssh.NewSignerFromKey(edKey)
+		if err != nil {
+			sshHostKeysErr = err
+			return
+		}
+		sshHostKeys = []ssh.Signer{rsaSigner, edSigner}
+	})
+	return sshHostKeys, sshHostKeysErr
+}
+
+// sshServerConfig creates a server config which rejects every login and
+// hands each attempt to record
+func sshServerConfig(record func(sshAuth)) (*ssh.ServerConfig, error) {
+	keys, err := hostKeys()
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{
+		ServerVersion: sshServerVersion,
+		MaxAuthTries:  sshMaxAuthTries,
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			record(sshAuth{Method: "password", Username: c.User(), Password: string(password)})
+			return nil, fmt.Errorf("password rejected for %s", c.User())
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			record(sshAuth{
+				Method:      "publickey",
+				Username:    c.User(),
+				KeyType:     key.Type(),
+				Fingerprint: ssh.FingerprintSHA256(key),
+			})
+			return nil, fmt.Errorf("public key rejected for %s", c.User())
+		},
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client(c.User(), "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) == 1 {
+				record(sshAuth{Method: "keyboard-interactive", Username: c.User(), Password: answers[0]})
+			}
+			return nil, fmt.Errorf("keyboard-interactive rejected for %s", c.User())
+		},
+	}
+	for _, key := range keys {
+		config.AddHostKey(key)
+	}
+	return config, nil
+}
+
+// fingerprintSSH adds the HASSH of the client KEXINIT read and the
+// HASSHServer of the one written to the fingerprints of md
+func fingerprintSSH(in, out []byte, md connection.Metadata) connection.Metadata {
+	kex, err := helpers.ParseSSHKexInit(in)
+	if err != nil {
+		return md
+	}
+	fp := md.Fingerprints.Clone()
+	fp.HASSH, fp.HASSHHash = kex.HASSH()
+	if kex, err := helpers.ParseSSHKexInit(out); err == nil {
+		fp.HASSHServer, fp.HASSHServerHash = kex.HASSHServer()
+	}
+	md.Fingerprints = fp
+	return md
+}
+
+// HandleSSH performs the SSH key exchange and records authentication attempts
+func HandleSSH(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	session := parsedSSH{}
+	// the key exchange is over once the client tries to log in
+	recorder := helpers.NewRecorder(conn)
+	var fingerprinted sync.Once
+	fingerprint := func() {
+		fingerprinted.Do(func() {
+			in, out := recorder.Stop()
+			md = fingerprintSSH(in, out, md)
+		})
+	}
+	defer func() {
+		fingerprint()
+		if err := h.ProduceTCP("ssh", conn, md, []byte(session.ClientVersion), session); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "ssh"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close SSH connection", slog.String("protocol", "ssh"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	config, err := sshServerConfig(func(auth sshAuth) {
+		fingerprint()
+		session.Auth = append(session.Auth, auth)
+		logger.Info(
+			"SSH login attempt",
+			slog.String("handler", "ssh"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("method", auth.Method),
+			slog.String("username", auth.Username),
+			slog.String("password", auth.Password),
+			slog.String("fingerprint", auth.Fingerprint),
+		)
+		cred := credentials.Credential{Protocol: "ssh", Username: auth.Username, Password: auth.Password}
+		if auth.Fingerprint != "" {
+			cred.Hash, cred.HashType = auth.Fingerprint, "ssh-publickey"
+		}
+		helpers.RecordCredential(ctx, conn, md, cred, logger, h)
+	})
+	if err != nil {
+		return err
+	}
+	config.AuthLogCallback = func(c ssh.ConnMetadata, _ string, _ error) {
+		session.ClientVersion = string(c.ClientVersion())
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		logger.Debug("Failed to set connection timeout", slog.String("protocol", "ssh"), producer.ErrAttr(err))
+		return nil
+	}
+
+	// every attempt is rejected, so the handshake always ends in an error
+	sshConn, _, _, err := ssh.NewServerConn(recorder, config)
+	if sshConn != nil {
+		sshConn.Close()
+	}
+	if err != nil {
+		logger.Debug("SSH handshake ended", slog.String("protocol", "ssh"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package tcp
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHServerConfig(t *testing.T) {
+	var attempts []sshAuth
+	config, err := sshServerConfig(func(auth sshAuth) {
+		attempts = append(attempts, auth)
+	})
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		server, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer server.Close()
+		_, _, _, _ = ssh.NewServerConn(server, config)
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, _, _, err = ssh.NewClientConn(client, l.Addr().String(), &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{ssh.Password("123456")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.Error(t, err)
+	require.Len(t, attempts, 1)
+	require.Equal(t, sshAuth{Method: "password", Username: "root", Password: "123456"}, attempts[0])
+}
+
+func TestFingerprintSSH(t *testing.T) {
+	config, err := sshServerConfig(func(sshAuth) {})
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	recorders := make(chan *helpers.Recorder, 1)
+	go func() {
+		server, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer server.Close()
+		recorder := helpers.NewRecorder(server)
+		_, _, _, _ = ssh.NewServerConn(recorder, config)
+		recorders <- recorder
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, _, _, err = ssh.NewClientConn(client, l.Addr().String(), &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{ssh.Password("123456")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Config:          ssh.Config{KeyExchanges: []string{"curve25519-sha256"}, Ciphers: []string{"aes128-ctr"}, MACs: []string{"hmac-sha2-256"}},
+	})
+	require.Error(t, err)
+
+	in, out := (<-recorders).Stop()
+	md := fingerprintSSH(in, out, connection.Metadata{Fingerprints: &connection.Fingerprints{JA4T: "1024_00_0_0"}})
+	require.Contains(t, md.Fingerprints.HASSH, "curve25519-sha256")
+	require.True(t, strings.HasSuffix(md.Fingerprints.HASSH, ";aes128-ctr;hmac-sha2-256;none"), md.Fingerprints.HASSH)
+	require.Len(t, md.Fingerprints.HASSHHash, 32)
+	require.NotEmpty(t, md.Fingerprints.HASSHServer)
+	require.Equal(t, "1024_00_0_0", md.Fingerprints.JA4T)
+
+	md = fingerprintSSH([]byte("garbage"), nil, connection.Metadata{})
+	require.Nil(t, md.Fingerprints)
+}
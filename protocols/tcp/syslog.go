@@ -0,0 +1,102 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	syslogMaxMessage  = 8192
+	syslogMaxMessages = 1000
+)
+
+type parsedSyslog struct {
+	Message helpers.SyslogMessage `json:"message"`
+	Payload []byte                `json:"payload,omitempty"`
+}
+
+// readSyslogFrame reads a message framed by octet counting or terminated
+// by a newline, see RFC 6587
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] < '1' || first[0] > '9' {
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			err = nil
+		}
+		return append([]byte{}, line...), err
+	}
+	prefix, err := r.ReadSlice(' ')
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+	if err != nil || length > syslogMaxMessage {
+		return nil, errors.New("invalid syslog frame length")
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// HandleSyslog records the syslog messages devices send to the sensor,
+// whether misrouted or exfiltrated
+func HandleSyslog(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedSyslog{}
+	defer func() {
+		if err := h.ProduceTCP("syslog", conn, md, helpers.FirstOrEmpty[parsedSyslog](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "syslog"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close syslog connection", slog.String("protocol", "syslog"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(conn, syslogMaxMessage)
+	for range syslogMaxMessages {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		data, err := readSyslogFrame(reader)
+		if err != nil {
+			logger.Debug("Failed to read syslog message", slog.String("protocol", "syslog"), producer.ErrAttr(err))
+			return nil
+		}
+		msg, err := helpers.ParseSyslog(data)
+		events = append(events, parsedSyslog{Message: msg, Payload: data})
+		if err != nil {
+			logger.Debug("Failed to parse syslog message", slog.String("protocol", "syslog"), producer.ErrAttr(err))
+			continue
+		}
+		logger.Info(
+			"syslog message",
+			slog.String("handler", "syslog"),
+			slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+			slog.String("src_ip", host),
+			slog.String("src_port", port),
+			slog.String("hostname", msg.Hostname),
+			slog.String("app_name", msg.AppName),
+			slog.String("message", msg.Message),
+		)
+	}
+	return nil
+}
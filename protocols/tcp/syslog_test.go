@@ -0,0 +1,28 @@
+package tcp
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSyslogFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("<13>first\n10 <13>second<13>third"))
+	frame, err := readSyslogFrame(r)
+	require.NoError(t, err)
+	require.Equal(t, "<13>first\n", string(frame))
+	frame, err = readSyslogFrame(r)
+	require.NoError(t, err)
+	require.Equal(t, "<13>second", string(frame))
+	frame, err = readSyslogFrame(r)
+	require.NoError(t, err)
+	require.Equal(t, "<13>third", string(frame))
+	_, err = readSyslogFrame(r)
+	require.ErrorIs(t, err, io.EOF)
+
+	_, err = readSyslogFrame(bufio.NewReader(strings.NewReader("99999 <13>x")))
+	require.Error(t, err)
+}
@@ -4,21 +4,18 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"io"
 	"log/slog"
 	"math/big"
 	"net"
 	"net/http"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
 	"github.com/mushorg/glutton/producer"
 	"github.com/mushorg/glutton/protocols/helpers"
 	"github.com/mushorg/glutton/protocols/interfaces"
@@ -111,23 +108,7 @@ func (s *telnetServer) getSample(cmd string, logger interfaces.Logger) error {
 	if err != nil {
 		return err
 	}
-	sum := sha256.Sum256(bodyBuffer)
-	// Ignoring errors for if the folder already exists
-	if err = os.MkdirAll("samples", os.ModePerm); err != nil {
-		return err
-	}
-	sha256Hash := hex.EncodeToString(sum[:])
-	path := filepath.Join("samples", sha256Hash)
-	if _, err = os.Stat(path); err == nil {
-		logger.Debug("getSample already known", slog.String("sha", sha256Hash), slog.String("handler", "telnet"))
-		return nil
-	}
-	out, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-	_, err = out.Write(bodyBuffer)
+	sha256Hash, err := helpers.StorePayload(bodyBuffer)
 	if err != nil {
 		return err
 	}
@@ -173,16 +154,24 @@ func HandleTelnet(ctx context.Context, conn net.Conn, md connection.Metadata, lo
 	if err := s.write(conn, "Username: "); err != nil {
 		return err
 	}
-	if _, err := s.read(conn); err != nil {
+	username, err := s.read(conn)
+	if err != nil {
 		logger.Debug("Failed to read from connection", slog.String("protocol", "telnet"), producer.ErrAttr(err))
 		return nil
 	}
 	if err := s.write(conn, "Password: "); err != nil {
 		return err
 	}
-	if _, err := s.read(conn); err != nil {
+	password, err := s.read(conn)
+	if err != nil {
 		return err
 	}
+	helpers.RecordCredential(ctx, conn, md, credentials.Credential{
+		Protocol: "telnet",
+		Username: strings.TrimSpace(username),
+		Password: strings.TrimSpace(password),
+		Success:  true,
+	}, logger, h)
 	if err := s.write(conn, "welcome\r\n> "); err != nil {
 		return err
 	}
@@ -0,0 +1,264 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	tnsConnect = 1
+	tnsAccept  = 2
+	tnsRefuse  = 4
+	tnsData    = 6
+
+	// tnsVersion is accepted instead of anything newer, from 315 on the
+	// packet lengths grow to 4 bytes
+	tnsVersion = 314
+	// tnsVSN is the version number of a 19c listener
+	tnsVSN = 318767104
+
+	tnsMaxPackets = 20
+
+	tnsErrUnknownSID     = 12505
+	tnsErrUnknownService = 12514
+	tnsErrCommand        = 1189
+)
+
+var tnsPacketTypes = map[byte]string{
+	1:  "connect",
+	2:  "accept",
+	4:  "refuse",
+	5:  "redirect",
+	6:  "data",
+	11: "resend",
+	12: "marker",
+}
+
+// tnsFields are the connect descriptor parameters recorded, HOST is only
+// taken from the CID describing the client
+var (
+	tnsFields = regexp.MustCompile(`(?i)\((SERVICE_NAME|SID|PROGRAM|USER|COMMAND)=([^)]*)\)`)
+	tnsCID    = regexp.MustCompile(`(?i)\(CID=((?:\([^()]*\))*)\)`)
+	tnsHost   = regexp.MustCompile(`(?i)\(HOST=([^)]*)\)`)
+)
+
+type parsedTNS struct {
+	Direction   string `json:"direction,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Version     int    `json:"version,omitempty"`
+	ServiceName string `json:"service_name,omitempty"`
+	SID         string `json:"sid,omitempty"`
+	Program     string `json:"program,omitempty"`
+	Host        string `json:"host,omitempty"`
+	User        string `json:"user,omitempty"`
+	Command     string `json:"command,omitempty"`
+	ConnectData string `json:"connect_data,omitempty"`
+	Payload     []byte `json:"payload,omitempty"`
+}
+
+type tnsPacket struct {
+	kind byte
+	body []byte
+	raw  []byte
+}
+
+func readTNSPacket(r io.Reader) (*tnsPacket, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header))
+	if length < 8 {
+		return nil, errors.New("invalid TNS packet length")
+	}
+	raw := append(header, make([]byte, length-8)...)
+	if _, err := io.ReadFull(r, raw[8:]); err != nil {
+		return nil, err
+	}
+	return &tnsPacket{kind: header[4], body: raw[8:], raw: raw}, nil
+}
+
+func tnsFrame(kind byte, body []byte) []byte {
+	packet := binary.BigEndian.AppendUint16(nil, uint16(8+len(body)))
+	packet = append(packet, 0, 0, kind, 0, 0, 0)
+	return append(packet, body...)
+}
+
+// parseTNSConnect reads a CONNECT packet. Connect data not fitting into the
+// packet follows in the next one, it is read from r.
+func parseTNSConnect(packet *tnsPacket, r io.Reader) (parsedTNS, error) {
+	body := packet.body
+	msg := parsedTNS{Direction: "read", Type: "connect", Payload: packet.raw}
+	if len(body) < 20 {
+		return msg, errors.New("TNS connect too short")
+	}
+	msg.Version = int(binary.BigEndian.Uint16(body))
+	length := int(binary.BigEndian.Uint16(body[16:]))
+	offset := int(binary.BigEndian.Uint16(body[18:]))
+	data := []byte{}
+	if length > 0 && offset+length <= len(packet.raw) {
+		data = packet.raw[offset : offset+length]
+	} else if length > 0 {
+		next, err := readTNSPacket(r)
+		if err != nil {
+			return msg, err
+		}
+		msg.Payload = append(msg.Payload, next.raw...)
+		data = next.body
+		if next.kind == tnsData && len(data) >= 2 {
+			data = data[2:]
+		}
+	}
+	msg.ConnectData = string(data)
+	for _, match := range tnsFields.FindAllStringSubmatch(msg.ConnectData, -1) {
+		value := strings.TrimSpace(match[2])
+		switch strings.ToUpper(match[1]) {
+		case "SERVICE_NAME":
+			msg.ServiceName = value
+		case "SID":
+			msg.SID = value
+		case "PROGRAM":
+			msg.Program = value
+		case "USER":
+			msg.User = value
+		case "COMMAND":
+			msg.Command = value
+		}
+	}
+	if cid := tnsCID.FindStringSubmatch(msg.ConnectData); cid != nil {
+		if match := tnsHost.FindStringSubmatch(cid[1]); match != nil {
+			msg.Host = match[1]
+		}
+	}
+	return msg, nil
+}
+
+// tnsServiceKnown reports whether name is in tns.services, service names
+// match by their first label
+func tnsServiceKnown(name string) bool {
+	name, _, _ = strings.Cut(name, ".")
+	return slices.ContainsFunc(viper.GetStringSlice("tns.services"), func(service string) bool {
+		return strings.EqualFold(service, name)
+	})
+}
+
+func tnsRefusePacket(code int) []byte {
+	data := fmt.Sprintf("(DESCRIPTION=(TMP=)(VSNNUM=%d)(ERR=%d)(ERROR_STACK=(ERROR=(CODE=%d)(EMFI=4))))", tnsVSN, code, code)
+	body := binary.BigEndian.AppendUint16([]byte{0x22, 0x00}, uint16(len(data)))
+	return tnsFrame(tnsRefuse, append(body, data...))
+}
+
+// tnsAcceptPacket accepts the connection with an 8k SDU and no data
+func tnsAcceptPacket() []byte {
+	body := binary.BigEndian.AppendUint16(nil, tnsVersion)
+	for _, v := range []uint16{0x0801, 0x2000, 0xffff, 0x0100, 0, 32} {
+		body = binary.BigEndian.AppendUint16(body, v)
+	}
+	body = append(body, 0x41, 0x01)
+	return tnsFrame(tnsAccept, append(body, make([]byte, 8)...))
+}
+
+// tnsResponse refuses listener commands and unknown SIDs or service names
+// with the errors of a 19c listener and accepts the ones in tns.services
+func tnsResponse(msg parsedTNS) ([]byte, bool) {
+	switch {
+	case msg.Command != "":
+		return tnsRefusePacket(tnsErrCommand), false
+	case msg.ServiceName != "" && tnsServiceKnown(msg.ServiceName), msg.SID != "" && tnsServiceKnown(msg.SID):
+		return tnsAcceptPacket(), true
+	case msg.SID != "":
+		return tnsRefusePacket(tnsErrUnknownSID), false
+	}
+	return tnsRefusePacket(tnsErrUnknownService), false
+}
+
+// HandleTNS emulates an Oracle listener. Connects are refused unless they
+// name one of the services in tns.services, which lets SID guessing tools
+// be told apart by the services they try. Packets sent after an accept are
+// recorded.
+func HandleTNS(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedTNS{}
+	defer func() {
+		if err := h.ProduceTCP("tns", conn, md, helpers.FirstOrEmpty[parsedTNS](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "tns"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close TNS connection", slog.String("protocol", "tns"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	packet, err := readTNSPacket(conn)
+	if err != nil {
+		logger.Debug("Failed to read TNS packet", slog.String("protocol", "tns"), producer.ErrAttr(err))
+		return nil
+	}
+	if packet.kind != tnsConnect {
+		events = append(events, parsedTNS{Direction: "read", Type: tnsPacketTypes[packet.kind], Payload: packet.raw})
+		return nil
+	}
+	msg, err := parseTNSConnect(packet, conn)
+	events = append(events, msg)
+	if err != nil {
+		logger.Debug("Failed to parse TNS connect", slog.String("protocol", "tns"), producer.ErrAttr(err))
+		return nil
+	}
+	logger.Info(
+		"TNS connect",
+		slog.String("handler", "tns"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("service_name", msg.ServiceName),
+		slog.String("sid", msg.SID),
+		slog.String("program", msg.Program),
+		slog.String("user", msg.User),
+		slog.String("command", msg.Command),
+	)
+
+	resp, accepted := tnsResponse(msg)
+	events = append(events, parsedTNS{Direction: "write", Type: tnsPacketTypes[resp[4]], Payload: resp})
+	if _, err := conn.Write(resp); err != nil {
+		return err
+	}
+	if !accepted {
+		if msg.Command == "" {
+			helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "tns", Username: msg.User}, logger, h)
+		}
+		return nil
+	}
+
+	for range tnsMaxPackets {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		packet, err := readTNSPacket(conn)
+		if err != nil {
+			return nil
+		}
+		events = append(events, parsedTNS{Direction: "read", Type: tnsPacketTypes[packet.kind], Payload: packet.raw})
+	}
+	return nil
+}
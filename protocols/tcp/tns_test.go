@@ -0,0 +1,49 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func testTNSConnect(data string) []byte {
+	body := binary.BigEndian.AppendUint16(nil, 318)
+	for _, v := range []uint16{300, 0x0c41, 8192, 0xffff, 0x4f98, 0, 0x0001, uint16(len(data)), 34} {
+		body = binary.BigEndian.AppendUint16(body, v)
+	}
+	body = append(body, make([]byte, 34-8-len(body))...)
+	return tnsFrame(tnsConnect, append(body, data...))
+}
+
+func TestTNSConnect(t *testing.T) {
+	viper.Set("tns.services", []string{"ORCL", "XE"})
+	data := "(DESCRIPTION=(CONNECT_DATA=(SID=PROD)(CID=(PROGRAM=odat.py)(HOST=kali)(USER=root)))(ADDRESS=(PROTOCOL=TCP)(HOST=192.0.2.1)(PORT=1521)))"
+	raw := testTNSConnect(data)
+	packet, err := readTNSPacket(bytes.NewReader(raw))
+	require.NoError(t, err)
+	msg, err := parseTNSConnect(packet, bytes.NewReader(nil))
+	require.NoError(t, err)
+	require.Equal(t, parsedTNS{
+		Direction: "read", Type: "connect", Version: 318,
+		SID: "PROD", Program: "odat.py", Host: "kali", User: "root",
+		ConnectData: data, Payload: raw,
+	}, msg)
+
+	resp, accepted := tnsResponse(msg)
+	require.False(t, accepted)
+	require.Equal(t, byte(tnsRefuse), resp[4])
+	require.Contains(t, string(resp), "(ERR=12505)")
+
+	msg.SID, msg.ServiceName = "", "orcl.example.com"
+	resp, accepted = tnsResponse(msg)
+	require.True(t, accepted)
+	require.Equal(t, byte(tnsAccept), resp[4])
+	require.Equal(t, len(resp), int(binary.BigEndian.Uint16(resp)))
+
+	msg.Command = "version"
+	resp, _ = tnsResponse(msg)
+	require.Contains(t, string(resp), "(VSNNUM=318767104)(ERR=1189)")
+}
@@ -0,0 +1,258 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	x11Vendor      = "The X.Org Foundation"
+	x11Release     = 12101004
+	x11MaxRequests = 100
+	x11MaxRequest  = 1 << 16
+
+	x11GetImage       = 73
+	x11QueryExtension = 98
+)
+
+var x11Requests = map[byte]string{
+	1:   "CreateWindow",
+	8:   "MapWindow",
+	14:  "GetGeometry",
+	15:  "QueryTree",
+	16:  "InternAtom",
+	20:  "GetProperty",
+	38:  "QueryPointer",
+	43:  "GetInputFocus",
+	73:  "GetImage",
+	98:  "QueryExtension",
+	99:  "ListExtensions",
+	101: "GetKeyboardMapping",
+}
+
+type parsedX11 struct {
+	Direction    string `json:"direction,omitempty"`
+	ByteOrder    string `json:"byte_order,omitempty"`
+	Version      string `json:"version,omitempty"`
+	AuthProtocol string `json:"auth_protocol,omitempty"`
+	AuthData     string `json:"auth_data,omitempty"`
+	Request      string `json:"request,omitempty"`
+	Payload      []byte `json:"payload,omitempty"`
+}
+
+// x11ByteOrder is the byte order chosen by the client
+type x11ByteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+func x11Pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+// readX11Setup reads the connection setup, returning the byte order the
+// client speaks in
+func readX11Setup(r io.Reader) (x11ByteOrder, parsedX11, []byte, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, parsedX11{}, header, err
+	}
+	var order x11ByteOrder
+	switch header[0] {
+	case 'B':
+		order = binary.BigEndian
+	case 'l':
+		order = binary.LittleEndian
+	default:
+		return nil, parsedX11{}, header, errors.New("invalid X11 byte order")
+	}
+	msg := parsedX11{
+		Direction: "read",
+		ByteOrder: string(header[0]),
+		Version:   strconv.Itoa(int(order.Uint16(header[2:]))) + "." + strconv.Itoa(int(order.Uint16(header[4:]))),
+	}
+	nameLen, dataLen := int(order.Uint16(header[6:])), int(order.Uint16(header[8:]))
+	auth := make([]byte, nameLen+x11Pad(nameLen)+dataLen+x11Pad(dataLen))
+	if _, err := io.ReadFull(r, auth); err != nil {
+		return nil, msg, header, err
+	}
+	offset := nameLen + x11Pad(nameLen)
+	msg.AuthProtocol = string(auth[:nameLen])
+	msg.AuthData = hex.EncodeToString(auth[offset : offset+dataLen])
+	msg.Payload = append(header, auth...)
+	return order, msg, msg.Payload, nil
+}
+
+// x11SetupFailed refuses the connection the way Xorg does for clients
+// without a valid cookie
+func x11SetupFailed(order x11ByteOrder) []byte {
+	reason := "Authorization required, but no authorization protocol specified\n"
+	resp := []byte{0, byte(len(reason))}
+	resp = order.AppendUint16(resp, 11)
+	resp = order.AppendUint16(resp, 0)
+	resp = order.AppendUint16(resp, uint16((len(reason)+x11Pad(len(reason)))/4))
+	resp = append(resp, reason...)
+	return append(resp, make([]byte, x11Pad(len(reason)))...)
+}
+
+// x11SetupSuccess describes a single 1920x1080 true color screen
+func x11SetupSuccess(order x11ByteOrder) []byte {
+	info := order.AppendUint32(nil, x11Release)
+	// resource id base and mask, motion buffer size
+	info = order.AppendUint32(info, 0x04000000)
+	info = order.AppendUint32(info, 0x001fffff)
+	info = order.AppendUint32(info, 256)
+	info = order.AppendUint16(info, uint16(len(x11Vendor)))
+	info = order.AppendUint16(info, 0xffff)
+	// screens, formats, LSB first images and bitmaps, scanline unit and pad,
+	// keycode range
+	info = append(info, 1, 2, 0, 0, 32, 32, 8, 255, 0, 0, 0, 0)
+	info = append(info, x11Vendor...)
+	info = append(info, make([]byte, x11Pad(len(x11Vendor)))...)
+	info = append(info, 1, 1, 32, 0, 0, 0, 0, 0)
+	info = append(info, 24, 32, 32, 0, 0, 0, 0, 0)
+
+	// root window, colormap, white and black pixel, event mask
+	for _, v := range []uint32{0x000003f5, 0x00000020, 0x00ffffff, 0x00000000, 0x00fa8033} {
+		info = order.AppendUint32(info, v)
+	}
+	for _, v := range []uint16{1920, 1080, 508, 285, 1, 1} {
+		info = order.AppendUint16(info, v)
+	}
+	info = order.AppendUint32(info, 0x21)
+	// no backing stores or save unders, depth 24 with one visual
+	info = append(info, 0, 0, 24, 1)
+	info = append(info, 24, 0)
+	info = order.AppendUint16(info, 1)
+	info = append(info, 0, 0, 0, 0)
+	info = order.AppendUint32(info, 0x21)
+	// TrueColor, 8 bits per primary
+	info = append(info, 4, 8)
+	info = order.AppendUint16(info, 256)
+	for _, mask := range []uint32{0xff0000, 0x00ff00, 0x0000ff, 0} {
+		info = order.AppendUint32(info, mask)
+	}
+
+	resp := []byte{1, 0}
+	resp = order.AppendUint16(resp, 11)
+	resp = order.AppendUint16(resp, 0)
+	resp = order.AppendUint16(resp, uint16(len(info)/4))
+	return append(resp, info...)
+}
+
+// x11Reply answers a request, extensions are reported missing and
+// everything else fails with an Implementation error
+func x11Reply(order x11ByteOrder, opcode byte, seq uint16) []byte {
+	resp := make([]byte, 32)
+	if opcode == x11QueryExtension {
+		resp[0] = 1
+		order.PutUint16(resp[2:], seq)
+		return resp
+	}
+	resp[1] = 17
+	order.PutUint16(resp[2:], seq)
+	resp[10] = opcode
+	return resp
+}
+
+// HandleX11 completes the X11 connection setup with the authorization
+// the client presents when x11.open is set, and refuses it otherwise. The
+// requests of clients let in are recorded, the ones grabbing the screen
+// get tagged.
+func HandleX11(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedX11{}
+	defer func() {
+		if err := h.ProduceTCP("x11", conn, md, helpers.FirstOrEmpty[parsedX11](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "x11"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close X11 connection", slog.String("protocol", "x11"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	order, setup, data, err := readX11Setup(reader)
+	if err != nil {
+		events = append(events, parsedX11{Direction: "read", Payload: data})
+		logger.Debug("Failed to read X11 setup", slog.String("protocol", "x11"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, setup)
+	logger.Info(
+		"X11 connection setup",
+		slog.String("handler", "x11"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("auth_protocol", setup.AuthProtocol),
+		slog.String("auth_data", setup.AuthData),
+	)
+	if setup.AuthProtocol != "" {
+		helpers.RecordCredential(ctx, conn, md, credentials.Credential{Protocol: "x11", Hash: setup.AuthData, HashType: setup.AuthProtocol, Success: viper.GetBool("x11.open")}, logger, h)
+	}
+
+	if !viper.GetBool("x11.open") {
+		resp := x11SetupFailed(order)
+		events = append(events, parsedX11{Direction: "write", Payload: resp})
+		_, err := conn.Write(resp)
+		return err
+	}
+	resp := x11SetupSuccess(order)
+	events = append(events, parsedX11{Direction: "write", Payload: resp})
+	if _, err := conn.Write(resp); err != nil {
+		return err
+	}
+
+	grabbed := false
+	for seq := uint16(1); seq <= x11MaxRequests; seq++ {
+		if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+			return nil
+		}
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil
+		}
+		length := int(order.Uint16(header[2:])) * 4
+		if length < 4 || length > x11MaxRequest {
+			return nil
+		}
+		body := make([]byte, length-4)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil
+		}
+		request, ok := x11Requests[header[0]]
+		if !ok {
+			request = strconv.Itoa(int(header[0]))
+		}
+		events = append(events, parsedX11{Direction: "read", Request: request, Payload: append(header, body...)})
+		if header[0] == x11GetImage && !grabbed {
+			grabbed = true
+			md.Tags = append(md.Tags, "x11_screenshot")
+		}
+		if _, err := conn.Write(x11Reply(order, header[0], seq)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
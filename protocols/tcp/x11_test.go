@@ -0,0 +1,79 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestX11Setup(t *testing.T) {
+	setup := []byte{'l', 0, 11, 0, 0, 0, 18, 0, 16, 0, 0, 0}
+	setup = append(setup, "MIT-MAGIC-COOKIE-1\x00\x00"...)
+	setup = append(setup, bytes.Repeat([]byte{0xab}, 16)...)
+	order, msg, _, err := readX11Setup(bytes.NewReader(setup))
+	require.NoError(t, err)
+	require.Equal(t, x11ByteOrder(binary.LittleEndian), order)
+	require.Equal(t, "11.0", msg.Version)
+	require.Equal(t, "MIT-MAGIC-COOKIE-1", msg.AuthProtocol)
+	require.Equal(t, "abababababababababababababababab", msg.AuthData)
+
+	resp := x11SetupSuccess(binary.BigEndian)
+	require.Equal(t, byte(1), resp[0])
+	require.Equal(t, len(resp)-8, int(binary.BigEndian.Uint16(resp[6:]))*4)
+	resp = x11SetupFailed(binary.LittleEndian)
+	require.Equal(t, byte(0), resp[0])
+	require.Equal(t, len(resp)-8, int(binary.LittleEndian.Uint16(resp[6:]))*4)
+
+	_, _, _, err = readX11Setup(bytes.NewReader([]byte("GET / HTTP/1.1\r\n")))
+	require.Error(t, err)
+}
+
+func TestHandleX11Cookie(t *testing.T) {
+	isolateBruteForce(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+
+	creds := make(chan string, 1)
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil)
+	h.EXPECT().ProduceTCP("x11", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(_ string, _ net.Conn, _ connection.Metadata, _ []byte, event interface{}) {
+			if _, ok := event.([]parsedX11); ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			require.NoError(t, err)
+			creds <- string(data)
+		}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("X11 connection setup", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	done := make(chan error)
+	go func() {
+		done <- HandleX11(context.Background(), server, connection.Metadata{TargetPort: 6000}, l, h)
+	}()
+
+	setup := []byte{'l', 0, 11, 0, 0, 0, 18, 0, 16, 0, 0, 0}
+	setup = append(setup, "MIT-MAGIC-COOKIE-1\x00\x00"...)
+	_, err = client.Write(append(setup, bytes.Repeat([]byte{0xab}, 16)...))
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+
+	require.JSONEq(t, `{"event": "credential", "protocol": "x11", "hash": "abababababababababababababababab", "hash_type": "MIT-MAGIC-COOKIE-1", "success": false}`, <-creds)
+}
@@ -0,0 +1,109 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const zookeeperVersion = "3.6.3--6401e4ad2087061bc6b9f80dec2d69f2e3c8660a, built on 04/08/2021 16:35 GMT"
+
+// zookeeperRecon are the four letter words dumping sessions, watches and
+// metrics, they are not on the whitelist just like on a default install
+var zookeeperRecon = []string{"mntr", "dump", "cons", "wchs", "wchc", "wchp", "conf", "crst", "srst"}
+
+type parsedZookeeper struct {
+	Direction string `json:"direction,omitempty"`
+	Command   string `json:"command,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// zookeeperResponse answers a four letter word of the client at addr like a
+// standalone ZooKeeper 3.6 whitelisting ruok, stat, srvr and envi
+func zookeeperResponse(command, addr string) string {
+	switch command {
+	case "ruok":
+		return "imok"
+	case "srvr", "stat":
+		clients := ""
+		if command == "stat" {
+			clients = fmt.Sprintf("Clients:\n /%s[0](queued=0,recved=1,sent=0)\n\n", addr)
+		}
+		return fmt.Sprintf("Zookeeper version: %s\n%sLatency min/avg/max: 0/0.4/12\nReceived: 1843\nSent: 1842\nConnections: 1\nOutstanding: 0\nZxid: 0x10000004a\nMode: standalone\nNode count: 147\n", zookeeperVersion, clients)
+	case "envi":
+		return "Environment:\n" +
+			"zookeeper.version=" + zookeeperVersion + "\n" +
+			"host.name=zk01\n" +
+			"java.version=11.0.11\n" +
+			"java.vendor=Oracle Corporation\n" +
+			"java.home=/usr/local/openjdk-11\n" +
+			"java.class.path=/apache-zookeeper-3.6.3-bin/bin/../zookeeper-server/target/classes:/apache-zookeeper-3.6.3-bin/bin/../lib/zookeeper-3.6.3.jar:/conf:\n" +
+			"java.library.path=/usr/java/packages/lib:/usr/lib64:/lib64:/lib:/usr/lib\n" +
+			"java.io.tmpdir=/tmp\n" +
+			"java.compiler=<NA>\n" +
+			"os.name=Linux\n" +
+			"os.arch=amd64\n" +
+			"os.version=5.4.0-144-generic\n" +
+			"user.name=zookeeper\n" +
+			"user.home=/home/zookeeper\n" +
+			"user.dir=/apache-zookeeper-3.6.3-bin\n" +
+			"os.memory.free=990MB\n" +
+			"os.memory.max=1000MB\n" +
+			"os.memory.total=1000MB\n"
+	}
+	return command + " is not executed because it is not in the whitelist.\n"
+}
+
+// HandleZookeeper answers the four letter word commands of ZooKeeper and
+// tags the ones used to enumerate a cluster
+func HandleZookeeper(ctx context.Context, conn net.Conn, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedZookeeper{}
+	defer func() {
+		if err := h.ProduceTCP("zookeeper", conn, md, helpers.FirstOrEmpty[parsedZookeeper](events).Payload, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "zookeeper"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug("Failed to close ZooKeeper connection", slog.String("protocol", "zookeeper"), producer.ErrAttr(err))
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		return err
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		logger.Debug("Failed to read ZooKeeper command", slog.String("protocol", "zookeeper"), producer.ErrAttr(err))
+		return nil
+	}
+	command := string(buf)
+	events = append(events, parsedZookeeper{Direction: "read", Command: command, Payload: buf})
+	if slices.Contains(zookeeperRecon, command) {
+		md.Tags = append(md.Tags, "zookeeper_recon")
+	}
+	logger.Info(
+		"ZooKeeper command",
+		slog.String("handler", "zookeeper"),
+		slog.String("dest_port", strconv.Itoa(int(md.TargetPort))),
+		slog.String("src_ip", host),
+		slog.String("src_port", port),
+		slog.String("command", command),
+	)
+
+	resp := zookeeperResponse(command, conn.RemoteAddr().String())
+	events = append(events, parsedZookeeper{Direction: "write", Payload: []byte(resp)})
+	_, err = conn.Write([]byte(resp))
+	return err
+}
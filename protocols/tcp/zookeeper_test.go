@@ -0,0 +1,18 @@
+package tcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZookeeperResponse(t *testing.T) {
+	require.Equal(t, "imok", zookeeperResponse("ruok", "192.0.2.1:4242"))
+	stat := zookeeperResponse("stat", "192.0.2.1:4242")
+	require.True(t, strings.HasPrefix(stat, "Zookeeper version: 3.6.3"))
+	require.Contains(t, stat, " /192.0.2.1:4242[0]")
+	require.NotContains(t, zookeeperResponse("srvr", "192.0.2.1:4242"), "Clients:")
+	require.Contains(t, zookeeperResponse("envi", "192.0.2.1:4242"), "host.name=zk01\n")
+	require.Equal(t, "mntr is not executed because it is not in the whitelist.\n", zookeeperResponse("mntr", "192.0.2.1:4242"))
+}
@@ -0,0 +1,131 @@
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// certificates are cached per server name up to this many entries
+const maxTLSCerts = 1024
+
+// isClientHello reports whether the peeked bytes start a TLS handshake record
+// carrying a ClientHello
+func isClientHello(snip []byte) bool {
+	return len(snip) >= 3 && snip[0] == 0x16 && snip[1] == 0x03 && snip[2] <= 0x04
+}
+
+// certCache generates self-signed certificates per requested server name
+type certCache struct {
+	certs *helpers.CertCache
+}
+
+func newCertCache() *certCache {
+	return &certCache{certs: helpers.NewCertCache(maxTLSCerts)}
+}
+
+// get returns the certificate for the requested server name, falling back to
+// the address the client connected to
+func (c *certCache) get(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := hello.ServerName
+	if name == "" {
+		if addr, ok := hello.Conn.LocalAddr().(*net.TCPAddr); ok {
+			name = addr.IP.String()
+		} else {
+			name = "localhost"
+		}
+	}
+	return c.certs.Get(name)
+}
+
+func (c *certCache) config() *tls.Config {
+	return &tls.Config{
+		GetCertificate: c.get,
+		MinVersion:     tls.VersionTLS10,
+	}
+}
+
+// firstHandshake returns the first complete handshake message of the
+// records in data
+func firstHandshake(data []byte) []byte {
+	msg := helpers.HandshakeMessages(data)
+	length := helpers.ClientHelloLength(msg)
+	if length == 0 || len(msg) < length {
+		return nil
+	}
+	return msg[:length]
+}
+
+// fingerprintTLS adds the JA3 and JA4 of the ClientHello read and the JA3S
+// of the ServerHello written to fp, the latter is missing when the
+// handshake failed before we answered. It reports whether the ClientHello
+// was found.
+func fingerprintTLS(in, out []byte, fp *connection.Fingerprints) bool {
+	hello, err := helpers.ParseClientHello(firstHandshake(in))
+	if err != nil {
+		return false
+	}
+	fp.JA3, fp.JA3Hash = hello.JA3()
+	fp.JA4 = hello.JA4(helpers.JA4TCP)
+	if hello, err := helpers.ParseServerHello(firstHandshake(out)); err == nil {
+		fp.JA3S, fp.JA3SHash = hello.JA3S()
+	}
+	return true
+}
+
+type failedTLSHandshake struct {
+	ServerName string `json:"server_name,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// terminateTLS completes the TLS handshake on conn and adds the JA3, JA3S
+// and JA4 fingerprints to the metadata. Failed handshakes are produced as
+// events with the ClientHello as payload and closed.
+func terminateTLS(ctx context.Context, conn BufferedConn, md connection.Metadata, certs *certCache, log interfaces.Logger, h interfaces.Honeypot) (net.Conn, connection.Metadata, bool) {
+	hello := conn.buffered()
+	var serverName string
+	config := certs.config()
+	config.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+		serverName = info.ServerName
+		return nil, nil
+	}
+
+	recorder := helpers.NewRecorder(conn)
+	tlsConn := tls.Server(recorder, config)
+	if err := h.UpdateConnectionTimeout(ctx, conn); err != nil {
+		log.Debug("failed to set connection timeout", producer.ErrAttr(err))
+	}
+	err := tlsConn.HandshakeContext(ctx)
+	fp := md.Fingerprints.Clone()
+	if in, out := recorder.Stop(); fingerprintTLS(in, out, fp) {
+		md.Fingerprints = fp
+	}
+	if err != nil {
+		log.Debug("failed TLS handshake", slog.String("server_name", serverName), producer.ErrAttr(err))
+		if err := h.ProduceTCP("tls", conn, md, hello, failedTLSHandshake{ServerName: serverName, Error: err.Error()}); err != nil {
+			log.Error("failed to produce message", slog.String("protocol", "tls"), producer.ErrAttr(err))
+		}
+		if err := conn.Close(); err != nil {
+			log.Debug("failed to close connection", producer.ErrAttr(err))
+		}
+		return nil, md, false
+	}
+
+	state := tlsConn.ConnectionState()
+	log.Info(
+		"TLS connection terminated",
+		slog.String("server_name", state.ServerName),
+		slog.String("version", tls.VersionName(state.Version)),
+		slog.String("cipher_suite", tls.CipherSuiteName(state.CipherSuite)),
+		slog.String("ja3_hash", fp.JA3Hash),
+		slog.String("ja3s_hash", fp.JA3SHash),
+		slog.String("ja4", fp.JA4),
+	)
+	return tlsConn, md, true
+}
@@ -0,0 +1,82 @@
+package protocols
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsClientHello(t *testing.T) {
+	require.True(t, isClientHello([]byte{0x16, 0x03, 0x01, 0x02}))
+	require.False(t, isClientHello([]byte("GET ")))
+	require.False(t, isClientHello([]byte{0x16, 0x03}))
+}
+
+func TestCertCache(t *testing.T) {
+	certs := newCertCache()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", certs.config())
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+		ServerName:         "www.example.com",
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	cert := conn.ConnectionState().PeerCertificates[0]
+	require.NoError(t, cert.VerifyHostname("www.example.com"))
+
+	cached, err := certs.get(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(cached.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, cert.SerialNumber, parsed.SerialNumber)
+}
+
+func TestHandshakeFingerprints(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	recorder := helpers.NewRecorder(server)
+	tlsServer := tls.Server(recorder, newCertCache().config())
+	go func() {
+		_ = tls.Client(client, &tls.Config{
+			ServerName:         "www.example.com",
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS12,
+			CipherSuites:       []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		}).Handshake()
+	}()
+	require.NoError(t, tlsServer.Handshake())
+
+	in, out := recorder.Stop()
+	var fp connection.Fingerprints
+	require.True(t, fingerprintTLS(in, out, &fp))
+	require.True(t, strings.HasPrefix(fp.JA3, "771,49195,"), fp.JA3)
+	require.Len(t, fp.JA3Hash, 32)
+	require.True(t, strings.HasPrefix(fp.JA3S, "771,49195,"), fp.JA3S)
+	require.Len(t, fp.JA3SHash, 32)
+	require.True(t, strings.HasPrefix(fp.JA4, "t12d01"), fp.JA4)
+
+	// nothing is recorded once stopped
+	go func() { _, _ = client.Write([]byte("data")) }()
+	_, err := recorder.Read(make([]byte, 4))
+	require.NoError(t, err)
+	stopped, _ := recorder.Stop()
+	require.Len(t, stopped, len(in))
+}
@@ -0,0 +1,35 @@
+package protocols
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/mushorg/glutton/transcript"
+
+	"github.com/spf13/viper"
+)
+
+// recordTranscript wraps handler to record the sessions it handles if
+// transcripts.handlers lists name, the events of a session reference its
+// transcript
+func recordTranscript(name string, handler TCPHandlerFunc, log interfaces.Logger) TCPHandlerFunc {
+	if !viper.GetBool("transcripts.enabled") || !slices.Contains(viper.GetStringSlice("transcripts.handlers"), name) {
+		return handler
+	}
+	return func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		recorder := transcript.NewRecorder(conn, name, md.TargetPort, viper.GetInt("transcripts.max_size")<<20)
+		md.Transcript = recorder.ID()
+		defer func() {
+			if err := helpers.StoreTranscript(recorder.Transcript()); err != nil {
+				log.Error("Failed to store transcript", slog.String("handler", name), producer.ErrAttr(err))
+			}
+		}()
+		return handler(ctx, recorder, md)
+	}
+}
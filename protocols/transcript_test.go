@@ -0,0 +1,115 @@
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/mushorg/glutton/transcript"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordTranscript(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("transcripts.enabled", true)
+	viper.Set("transcripts.handlers", []string{"telnet"})
+	viper.Set("transcripts.dir", dir)
+	viper.Set("transcripts.max_size", 1)
+	defer func() {
+		viper.Set("transcripts.enabled", false)
+		viper.Set("transcripts.dir", "transcripts")
+	}()
+
+	l := &mocks.MockLogger{}
+	var id string
+	handler := func(ctx context.Context, conn net.Conn, md connection.Metadata) error {
+		id = md.Transcript
+		conn.Write([]byte("login: "))
+		_, err := io.ReadFull(conn, make([]byte, 5))
+		return err
+	}
+	session := func(name string) error {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			io.ReadFull(client, make([]byte, 7))
+			client.Write([]byte("root\n"))
+		}()
+		return recordTranscript(name, handler, l)(context.Background(), server, connection.Metadata{TargetPort: 23})
+	}
+	require.NoError(t, session("ftp"))
+	require.Empty(t, id, "handlers not listed are not recorded")
+
+	err := session("telnet")
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	tr, err := transcript.Load(dir, id)
+	require.NoError(t, err)
+	require.Equal(t, "telnet", tr.Handler)
+	require.Equal(t, uint16(23), tr.DstPort)
+	require.Len(t, tr.Chunks, 2)
+	require.Equal(t, "login: ", string(tr.Chunks[0].Data))
+	require.Equal(t, "root\n", string(tr.Chunks[1].Data))
+}
+
+func TestRecordTranscriptTLS(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("transcripts.enabled", true)
+	viper.Set("transcripts.handlers", []string{"tcp", "imap"})
+	viper.Set("transcripts.dir", dir)
+	viper.Set("transcripts.max_size", 1)
+	defer func() {
+		viper.Set("transcripts.enabled", false)
+		viper.Set("transcripts.dir", "transcripts")
+	}()
+
+	l := &mocks.MockLogger{}
+	for _, method := range []string{"Debug", "Info", "Error"} {
+		for n := range 12 {
+			l.On(method, slices.Repeat([]any{mock.Anything}, n+1)...).Return().Maybe()
+		}
+	}
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().UpdateConnectionTimeout(mock.Anything, mock.Anything).Return(nil).Maybe()
+	h.EXPECT().ProduceTCP(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	m := MapTCPProtocolHandlers(l, h)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	server, err := ln.Accept()
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		done <- m["tcp"](context.Background(), server, connection.Metadata{TargetPort: 993})
+	}()
+
+	client := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	banner, err := bufio.NewReader(client).ReadString('\n')
+	require.NoError(t, err)
+	require.Contains(t, banner, "Dovecot ready")
+	client.Close()
+	<-done
+
+	// the IMAP handler records the decrypted session, the dispatcher nothing
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	tr, err := transcript.Load(dir, strings.TrimSuffix(entries[0].Name(), ".jsonl"))
+	require.NoError(t, err)
+	require.Equal(t, "imap", tr.Handler)
+	require.Equal(t, banner, string(tr.Chunks[0].Data))
+}
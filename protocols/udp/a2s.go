@@ -0,0 +1,140 @@
+package udp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	a2sInfo      = 'T'
+	a2sPlayer    = 'U'
+	a2sRules     = 'V'
+	a2sChallenge = 'A'
+	a2sInfoReply = 'I'
+	a2sPlayers   = 'D'
+	a2sRuleList  = 'E'
+)
+
+var a2sHeader = []byte{0xff, 0xff, 0xff, 0xff}
+
+var a2sInfoPayload = []byte("Source Engine Query\x00")
+
+var a2sRequests = map[byte]string{
+	a2sInfo:   "info",
+	a2sPlayer: "player",
+	a2sRules:  "rules",
+}
+
+// a2sSecret derives the challenge of each source, spoofed floods never see
+// it and so never get more than the challenge back
+var a2sSecret = func() []byte {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return secret
+}()
+
+type parsedA2S struct {
+	Request string `json:"request"`
+	// Challenge tells whether the request carried the challenge handed to
+	// its source, which spoofed requests cannot know
+	Challenge bool `json:"challenge"`
+}
+
+func a2sChallengeFor(ip net.IP) []byte {
+	mac := hmac.New(sha256.New, a2sSecret)
+	mac.Write(ip.To16())
+	return mac.Sum(nil)[:4]
+}
+
+func appendA2SString(buf []byte, s string) []byte {
+	return append(append(buf, s...), 0)
+}
+
+// a2sInfoResponse describes a Team Fortress 2 server named a2s.name. It has
+// to stay within the amplification limit of the 29 byte request.
+func a2sInfoResponse() []byte {
+	resp := append(append([]byte{}, a2sHeader...), a2sInfoReply, 17)
+	resp = appendA2SString(resp, viper.GetString("a2s.name"))
+	resp = appendA2SString(resp, viper.GetString("a2s.map"))
+	resp = appendA2SString(resp, "tf")
+	resp = appendA2SString(resp, "Team Fortress")
+	resp = binary.LittleEndian.AppendUint16(resp, 440)
+	// players, max players, bots, dedicated, linux, public, VAC secured
+	resp = append(resp, 11, 24, 0, 'd', 'l', 0, 1)
+	return appendA2SString(resp, "8622567")
+}
+
+// a2sResponse parses an A2S query from ip and creates the answer: the
+// challenge for requests without a valid one, the actual reply otherwise
+func a2sResponse(data []byte, ip net.IP) ([]byte, parsedA2S, error) {
+	if len(data) < 5 || !bytes.Equal(data[:4], a2sHeader) {
+		return nil, parsedA2S{}, errors.New("not an A2S query")
+	}
+	name, ok := a2sRequests[data[4]]
+	if !ok {
+		return nil, parsedA2S{}, errors.New("unknown A2S query")
+	}
+	msg := parsedA2S{Request: name}
+	challenge := data[5:]
+	if data[4] == a2sInfo {
+		if !bytes.HasPrefix(challenge, a2sInfoPayload) {
+			return nil, msg, errors.New("invalid A2S_INFO payload")
+		}
+		challenge = challenge[len(a2sInfoPayload):]
+	}
+	expected := a2sChallengeFor(ip)
+	if !hmac.Equal(challenge, expected) {
+		return append(append(append([]byte{}, a2sHeader...), a2sChallenge), expected...), msg, nil
+	}
+	msg.Challenge = true
+
+	switch data[4] {
+	case a2sPlayer:
+		return append(append([]byte{}, a2sHeader...), a2sPlayers, 0), msg, nil
+	case a2sRules:
+		return append(append([]byte{}, a2sHeader...), a2sRuleList, 0, 0), msg, nil
+	}
+	return a2sInfoResponse(), msg, nil
+}
+
+// HandleA2S answers Source engine server queries with a fake game server.
+// Sources hitting the reply rate limit without ever returning their
+// challenge are tagged as spoofed reflection floods.
+func HandleA2S(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	resp, msg, err := a2sResponse(data, srcAddr.IP)
+	defer func() {
+		if err := h.ProduceUDP("a2s", srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "a2s"), producer.ErrAttr(err))
+		}
+	}()
+	if err != nil {
+		logger.Debug("Failed to parse A2S query", slog.String("protocol", "a2s"), producer.ErrAttr(err))
+		return nil
+	}
+	logger.Info(
+		"A2S query",
+		slog.String("handler", "a2s"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("request", msg.Request),
+		slog.Bool("challenge", msg.Challenge),
+	)
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		if errors.Is(err, errRateLimited) && !msg.Challenge {
+			md.Tags = append(md.Tags, "a2s_flood")
+		}
+		logger.Debug("Failed to send A2S response", slog.String("protocol", "a2s"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package udp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestA2SResponse(t *testing.T) {
+	viper.Set("a2s.name", "Valve 2Fort 24/7")
+	viper.Set("a2s.map", "ctf_2fort")
+	ip := net.ParseIP("192.0.2.1")
+	req := append(append([]byte{}, a2sHeader...), a2sInfo)
+	req = append(req, a2sInfoPayload...)
+
+	resp, msg, err := a2sResponse(req, ip)
+	require.NoError(t, err)
+	require.False(t, msg.Challenge)
+	require.Equal(t, append(append([]byte{}, a2sHeader...), a2sChallenge), resp[:5])
+	challenge := resp[5:]
+	require.Len(t, challenge, 4)
+
+	req = append(req, challenge...)
+	resp, msg, err = a2sResponse(req, ip)
+	require.NoError(t, err)
+	require.Equal(t, parsedA2S{Request: "info", Challenge: true}, msg)
+	require.Equal(t, byte(a2sInfoReply), resp[4])
+	require.Contains(t, string(resp), "Valve 2Fort 24/7\x00ctf_2fort\x00tf\x00")
+	require.LessOrEqual(t, len(resp), maxAmplification*len(req))
+
+	_, msg, err = a2sResponse(req, net.ParseIP("192.0.2.2"))
+	require.NoError(t, err)
+	require.False(t, msg.Challenge)
+}
@@ -0,0 +1,320 @@
+package udp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	bacnetBVLC           = 0x81
+	bacnetForwardedNPDU  = 0x04
+	bacnetConfirmed      = 0x00
+	bacnetUnconfirmed    = 0x10
+	bacnetComplexACK     = 0x30
+	bacnetError          = 0x50
+	bacnetWhoIs          = 8
+	bacnetIAm            = 0
+	bacnetReadProperty   = 12
+	bacnetDeviceObject   = 8
+	bacnetUnknownObject  = 31
+	bacnetUnknownProp    = 32
+	bacnetErrorObject    = 1
+	bacnetErrorProperty  = 2
+	bacnetMaxInstance    = 0x3fffff
+	bacnetMaxAPDU        = 1476
+	bacnetNoSegmentation = 3
+)
+
+var bacnetServices = map[byte]string{
+	0:  "i_am",
+	1:  "i_have",
+	7:  "who_has",
+	8:  "who_is",
+	12: "read_property",
+	14: "read_property_multiple",
+	15: "write_property",
+	17: "device_communication_control",
+	20: "reinitialize_device",
+}
+
+type bacnetRequest struct {
+	Type       string `json:"type"`
+	Service    string `json:"service,omitempty"`
+	InvokeID   uint8  `json:"invoke_id,omitempty"`
+	ObjectType uint16 `json:"object_type,omitempty"`
+	Instance   uint32 `json:"instance,omitempty"`
+	Property   uint32 `json:"property,omitempty"`
+}
+
+type parsedBACnet struct {
+	Direction string        `json:"direction,omitempty"`
+	Request   bacnetRequest `json:"request,omitempty"`
+	Payload   []byte        `json:"payload,omitempty"`
+}
+
+// bacnetAPDU strips the BVLC and NPDU headers, network layer messages have
+// no APDU and are returned as an error
+func bacnetAPDU(data []byte) ([]byte, error) {
+	if len(data) < 6 || data[0] != bacnetBVLC || int(binary.BigEndian.Uint16(data[2:])) != len(data) {
+		return nil, errors.New("invalid BVLC header")
+	}
+	npdu := data[4:]
+	if data[1] == bacnetForwardedNPDU {
+		if len(npdu) < 8 {
+			return nil, errors.New("invalid forwarded NPDU")
+		}
+		npdu = npdu[6:]
+	}
+	if len(npdu) < 2 || npdu[0] != 0x01 {
+		return nil, errors.New("invalid NPDU version")
+	}
+	control := npdu[1]
+	rest := npdu[2:]
+	skipAddress := func() error {
+		if len(rest) < 3 || len(rest) < 3+int(rest[2]) {
+			return errors.New("NPDU address too short")
+		}
+		rest = rest[3+int(rest[2]):]
+		return nil
+	}
+	if control&0x20 != 0 {
+		if err := skipAddress(); err != nil {
+			return nil, err
+		}
+	}
+	if control&0x08 != 0 {
+		if err := skipAddress(); err != nil {
+			return nil, err
+		}
+	}
+	if control&0x20 != 0 {
+		if len(rest) < 1 {
+			return nil, errors.New("NPDU hop count missing")
+		}
+		rest = rest[1:]
+	}
+	if control&0x80 != 0 {
+		return nil, errors.New("network layer message")
+	}
+	if len(rest) < 1 {
+		return nil, errors.New("empty APDU")
+	}
+	return rest, nil
+}
+
+// bacnetPacket wraps an APDU in an original unicast BVLC and NPDU
+func bacnetPacket(apdu []byte) []byte {
+	buf := []byte{bacnetBVLC, 0x0a}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(apdu)+6))
+	buf = append(buf, 0x01, 0x00)
+	return append(buf, apdu...)
+}
+
+// bacnetContext decodes a context tagged unsigned value
+func bacnetContext(data []byte, tag byte) (uint32, []byte, bool) {
+	if len(data) < 1 || data[0]>>4 != tag || data[0]&0x08 == 0 {
+		return 0, data, false
+	}
+	size := int(data[0] & 0x07)
+	if size < 1 || size > 4 || len(data) < 1+size {
+		return 0, data, false
+	}
+	value := uint32(0)
+	for _, b := range data[1 : 1+size] {
+		value = value<<8 | uint32(b)
+	}
+	return value, data[1+size:], true
+}
+
+// bacnetUnsigned encodes an unsigned value, tag holds the tag number and
+// class bits
+func bacnetUnsigned(tag byte, value uint32) []byte {
+	switch {
+	case value < 1<<8:
+		return []byte{tag | 1, byte(value)}
+	case value < 1<<16:
+		return binary.BigEndian.AppendUint16([]byte{tag | 2}, uint16(value))
+	}
+	return binary.BigEndian.AppendUint32([]byte{tag | 4}, value)
+}
+
+func bacnetObjectID(objectType uint16, instance uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{0xc4}, uint32(objectType)<<22|instance)
+}
+
+func bacnetString(value string) []byte {
+	size := len(value) + 1
+	buf := []byte{0x75}
+	if size > 4 {
+		buf = append(buf, byte(min(size, 253)))
+		value = value[:min(len(value), 252)]
+	} else {
+		buf[0] = 0x70 | byte(size)
+	}
+	buf = append(buf, 0x00)
+	return append(buf, value...)
+}
+
+func bacnetInstance() uint32 {
+	return uint32(viper.GetUint("bacnet.instance")) & bacnetMaxInstance
+}
+
+// bacnetIAmAPDU announces the device, its maximum APDU size, segmentation
+// support and vendor
+func bacnetIAmAPDU() []byte {
+	apdu := []byte{bacnetUnconfirmed, bacnetIAm}
+	apdu = append(apdu, bacnetObjectID(bacnetDeviceObject, bacnetInstance())...)
+	apdu = append(apdu, bacnetUnsigned(0x20, bacnetMaxAPDU)...)
+	apdu = append(apdu, 0x91, bacnetNoSegmentation)
+	return append(apdu, bacnetUnsigned(0x20, uint32(viper.GetUint("bacnet.vendor_id")))...)
+}
+
+// bacnetProperty returns the application tagged value of a device property
+func bacnetProperty(property uint32) ([]byte, bool) {
+	switch property {
+	case 75:
+		return bacnetObjectID(bacnetDeviceObject, bacnetInstance()), true
+	case 79:
+		return []byte{0x91, bacnetDeviceObject}, true
+	case 120:
+		return bacnetUnsigned(0x20, uint32(viper.GetUint("bacnet.vendor_id"))), true
+	}
+	keys := map[uint32]string{
+		77:  "bacnet.object_name",
+		121: "bacnet.vendor_name",
+		70:  "bacnet.model_name",
+		44:  "bacnet.firmware",
+		12:  "bacnet.application_version",
+		28:  "bacnet.description",
+		58:  "bacnet.location",
+	}
+	if key, ok := keys[property]; ok {
+		return bacnetString(viper.GetString(key)), true
+	}
+	return nil, false
+}
+
+// bacnetResponse answers Who-Is and ReadProperty requests on the device
+// object, other requests are only recorded
+func bacnetResponse(req *bacnetRequest, apdu []byte) []byte {
+	switch apdu[0] & 0xf0 {
+	case bacnetUnconfirmed:
+		req.Type = "unconfirmed"
+		if len(apdu) < 2 {
+			return nil
+		}
+		req.Service = bacnetServices[apdu[1]]
+		if apdu[1] != bacnetWhoIs {
+			return nil
+		}
+		instance := bacnetInstance()
+		low, rest, ok := bacnetContext(apdu[2:], 0)
+		if ok {
+			high, _, ok := bacnetContext(rest, 1)
+			if !ok || instance < low || instance > high {
+				return nil
+			}
+		}
+		return bacnetIAmAPDU()
+	case bacnetConfirmed:
+		req.Type = "confirmed"
+		header := 4
+		if apdu[0]&0x08 != 0 {
+			// segmented requests carry a sequence number and window size
+			header = 6
+		}
+		if len(apdu) < header {
+			return nil
+		}
+		req.InvokeID = apdu[2]
+		service := apdu[header-1]
+		req.Service = bacnetServices[service]
+		if service != bacnetReadProperty {
+			return nil
+		}
+		object, rest, ok := bacnetContext(apdu[header:], 0)
+		if !ok {
+			return nil
+		}
+		property, _, ok := bacnetContext(rest, 1)
+		if !ok {
+			return nil
+		}
+		req.ObjectType = uint16(object >> 22)
+		req.Instance = object & bacnetMaxInstance
+		req.Property = property
+
+		errorClass, errorCode := byte(bacnetErrorObject), byte(bacnetUnknownObject)
+		if req.ObjectType == bacnetDeviceObject && (req.Instance == bacnetInstance() || req.Instance == bacnetMaxInstance) {
+			value, ok := bacnetProperty(property)
+			if ok {
+				resp := []byte{bacnetComplexACK, req.InvokeID, bacnetReadProperty, 0x0c}
+				resp = binary.BigEndian.AppendUint32(resp, uint32(bacnetDeviceObject)<<22|bacnetInstance())
+				resp = append(resp, bacnetUnsigned(0x18, property)...)
+				resp = append(resp, 0x3e)
+				resp = append(resp, value...)
+				return append(resp, 0x3f)
+			}
+			errorClass, errorCode = bacnetErrorProperty, bacnetUnknownProp
+		}
+		return []byte{bacnetError, req.InvokeID, bacnetReadProperty, 0x91, errorClass, 0x91, errorCode}
+	}
+	req.Type = "other"
+	return nil
+}
+
+// HandleBACnet answers BACnet/IP device discovery and property reads like a
+// building automation controller
+func HandleBACnet(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedBACnet{}
+	defer func() {
+		if err := h.ProduceUDP("bacnet", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "bacnet"), producer.ErrAttr(err))
+		}
+	}()
+
+	apdu, err := bacnetAPDU(data)
+	if err != nil {
+		logger.Debug("Failed to parse BACnet packet", slog.String("protocol", "bacnet"), producer.ErrAttr(err))
+		return nil
+	}
+	req := bacnetRequest{}
+	resp := bacnetResponse(&req, apdu)
+	events = append(events, parsedBACnet{
+		Direction: "read",
+		Request:   req,
+		Payload:   data,
+	})
+	logger.Info(
+		"BACnet request",
+		slog.String("handler", "bacnet"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("type", req.Type),
+		slog.String("service", req.Service),
+		slog.Int("object_type", int(req.ObjectType)),
+		slog.Int("instance", int(req.Instance)),
+		slog.Int("property", int(req.Property)),
+	)
+	if resp == nil {
+		return nil
+	}
+
+	out := bacnetPacket(resp)
+	events = append(events, parsedBACnet{
+		Direction: "write",
+		Request:   req,
+		Payload:   out,
+	})
+	if err := sendResponse(srcAddr, dstAddr, data, out); err != nil {
+		logger.Debug("Failed to send BACnet response", slog.String("protocol", "bacnet"), producer.ErrAttr(err))
+	}
+	return nil
+}
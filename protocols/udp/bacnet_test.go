@@ -0,0 +1,42 @@
+package udp
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBACnet(t *testing.T) {
+	viper.Set("bacnet.instance", 2400)
+	viper.Set("bacnet.vendor_id", 5)
+	viper.Set("bacnet.model_name", "NAE5510-2")
+	defer viper.Reset()
+
+	// global Who-Is broadcast
+	apdu, err := bacnetAPDU([]byte{0x81, 0x0b, 0x00, 0x0c, 0x01, 0x20, 0xff, 0xff, 0x00, 0xff, 0x10, 0x08})
+	require.NoError(t, err)
+	req := bacnetRequest{}
+	resp := bacnetResponse(&req, apdu)
+	require.Equal(t, "who_is", req.Service)
+	require.Equal(t, []byte{0x10, 0x00, 0xc4, 0x02, 0x00, 0x09, 0x60, 0x22, 0x05, 0xc4, 0x91, 0x03, 0x21, 0x05}, resp)
+
+	// Who-Is for a range that excludes the device
+	require.Nil(t, bacnetResponse(&bacnetRequest{}, []byte{0x10, 0x08, 0x09, 0x01, 0x19, 0x02}))
+
+	// ReadProperty model-name of device 4194303, as sent by nmap bacnet-info
+	apdu, err = bacnetAPDU([]byte{0x81, 0x0a, 0x00, 0x11, 0x01, 0x04, 0x00, 0x05, 0x01, 0x0c, 0x0c, 0x02, 0x3f, 0xff, 0xff, 0x19, 0x46})
+	require.NoError(t, err)
+	req = bacnetRequest{}
+	resp = bacnetResponse(&req, apdu)
+	require.Equal(t, "read_property", req.Service)
+	require.Equal(t, uint32(70), req.Property)
+	require.Equal(t, []byte{0x30, 0x01, 0x0c, 0x0c, 0x02, 0x00, 0x09, 0x60, 0x19, 0x46, 0x3e, 0x75, 0x0a, 0x00}, resp[:14])
+	require.Equal(t, "NAE5510-2", string(resp[14:len(resp)-1]))
+
+	resp = bacnetResponse(&bacnetRequest{}, []byte{0x00, 0x05, 0x02, 0x0c, 0x0c, 0x02, 0x3f, 0xff, 0xff, 0x19, 0x63})
+	require.Equal(t, []byte{0x50, 0x02, 0x0c, 0x91, 0x02, 0x91, 0x20}, resp)
+
+	_, err = bacnetAPDU([]byte{0x81, 0x0a, 0x00, 0x07, 0x01, 0x80, 0x00})
+	require.Error(t, err)
+}
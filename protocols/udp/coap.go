@@ -0,0 +1,442 @@
+package udp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	coapConfirmable    = 0
+	coapNonConfirmable = 1
+	coapAck            = 2
+	coapReset          = 3
+
+	coapOptionLocationPath  = 8
+	coapOptionOSCORE        = 9
+	coapOptionURIPath       = 11
+	coapOptionContentFormat = 12
+	coapOptionURIQuery      = 15
+	coapOptionBlock2        = 23
+
+	coapCreated      = 0x41
+	coapDeleted      = 0x42
+	coapChanged      = 0x44
+	coapContent      = 0x45
+	coapBadRequest   = 0x80
+	coapUnauthorized = 0x81
+	coapNotFound     = 0x84
+	coapNotAllowed   = 0x85
+	coapLinkFormat   = 40
+	coapTextPlain    = 0
+	coapPayloadMark  = 0xff
+	// coapMaxSZX keeps response blocks at 32 bytes so discovery answers stay
+	// within the amplification limit, clients fetch the rest block by block
+	coapMaxSZX = 1
+)
+
+var coapMethods = map[byte]string{1: "GET", 2: "POST", 3: "PUT", 4: "DELETE", 5: "FETCH", 6: "PATCH", 7: "iPATCH"}
+
+var coapTypes = map[byte]string{coapConfirmable: "CON", coapNonConfirmable: "NON", coapAck: "ACK", coapReset: "RST"}
+
+// coapResources is the content of a small sensor node, keyed by path
+var coapResources = map[string]struct {
+	format  uint16
+	content string
+}{
+	".well-known/core": {coapLinkFormat, `</sensors/temp>;rt="temperature-c";if="sensor";obs,` +
+		`</sensors/humidity>;rt="humidity-p";if="sensor";obs,` +
+		`</actuators/relay>;rt="switch";if="actuator",` +
+		`</device/info>;ct=0,</firmware>;rt="firmware";sz=262144`},
+	"sensors/temp":     {coapTextPlain, "21.4"},
+	"sensors/humidity": {coapTextPlain, "48"},
+	"actuators/relay":  {coapTextPlain, "0"},
+	"device/info":      {coapTextPlain, "contiki-ng 4.7 cc2538"},
+}
+
+type coapOption struct {
+	Number uint16
+	Value  []byte
+}
+
+type coapMessage struct {
+	Type      byte
+	Code      byte
+	MessageID uint16
+	Token     []byte
+	Options   []coapOption
+	Payload   []byte
+}
+
+// lwm2mRegistration is an LwM2M client registering with the resource
+// directory, objects lists the object instance paths of the payload
+type lwm2mRegistration struct {
+	Endpoint string   `json:"endpoint,omitempty"`
+	Lifetime string   `json:"lifetime,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Binding  string   `json:"binding,omitempty"`
+	Objects  []string `json:"objects,omitempty"`
+	Location string   `json:"location,omitempty"`
+}
+
+type coapRequest struct {
+	Type      string             `json:"type"`
+	Method    string             `json:"method,omitempty"`
+	MessageID uint16             `json:"message_id"`
+	Token     string             `json:"token,omitempty"`
+	Path      string             `json:"path,omitempty"`
+	Query     string             `json:"query,omitempty"`
+	OSCORE    bool               `json:"oscore,omitempty"`
+	LwM2M     *lwm2mRegistration `json:"lwm2m,omitempty"`
+	Body      []byte             `json:"body,omitempty"`
+}
+
+type parsedCoAP struct {
+	Direction string      `json:"direction,omitempty"`
+	Request   coapRequest `json:"request,omitempty"`
+	Payload   []byte      `json:"payload,omitempty"`
+}
+
+// coapExtended reads the extended delta or length that follows an option
+// header nibble
+func coapExtended(nibble byte, data []byte) (int, []byte, error) {
+	switch nibble {
+	case 13:
+		if len(data) < 1 {
+			return 0, nil, errors.New("truncated CoAP option")
+		}
+		return int(data[0]) + 13, data[1:], nil
+	case 14:
+		if len(data) < 2 {
+			return 0, nil, errors.New("truncated CoAP option")
+		}
+		return int(binary.BigEndian.Uint16(data)) + 269, data[2:], nil
+	case 15:
+		return 0, nil, errors.New("reserved CoAP option nibble")
+	}
+	return int(nibble), data, nil
+}
+
+func parseCoAP(data []byte) (*coapMessage, error) {
+	if len(data) < 4 || data[0]>>6 != 1 {
+		return nil, errors.New("invalid CoAP header")
+	}
+	tkl := int(data[0] & 0x0f)
+	if tkl > 8 || len(data) < 4+tkl {
+		return nil, errors.New("invalid CoAP token length")
+	}
+	msg := &coapMessage{
+		Type:      (data[0] >> 4) & 0x03,
+		Code:      data[1],
+		MessageID: binary.BigEndian.Uint16(data[2:]),
+		Token:     data[4 : 4+tkl],
+	}
+	rest := data[4+tkl:]
+	number := 0
+	for len(rest) > 0 {
+		if rest[0] == coapPayloadMark {
+			if len(rest) == 1 {
+				return nil, errors.New("empty CoAP payload after marker")
+			}
+			msg.Payload = rest[1:]
+			break
+		}
+		header := rest[0]
+		delta, next, err := coapExtended(header>>4, rest[1:])
+		if err != nil {
+			return nil, err
+		}
+		length, next, err := coapExtended(header&0x0f, next)
+		if err != nil {
+			return nil, err
+		}
+		if len(next) < length {
+			return nil, errors.New("truncated CoAP option value")
+		}
+		number += delta
+		if number > 0xffff {
+			return nil, errors.New("invalid CoAP option number")
+		}
+		msg.Options = append(msg.Options, coapOption{Number: uint16(number), Value: next[:length]})
+		rest = next[length:]
+	}
+	return msg, nil
+}
+
+func (m *coapMessage) option(number uint16) []string {
+	values := []string{}
+	for _, opt := range m.Options {
+		if opt.Number == number {
+			values = append(values, string(opt.Value))
+		}
+	}
+	return values
+}
+
+func coapUint(value []byte) uint32 {
+	n := uint32(0)
+	for _, b := range value {
+		n = n<<8 | uint32(b)
+	}
+	return n
+}
+
+func coapUintBytes(n uint32) []byte {
+	value := []byte{}
+	for ; n > 0; n >>= 8 {
+		value = append([]byte{byte(n)}, value...)
+	}
+	return value
+}
+
+func coapOptionNibble(n int) (byte, []byte) {
+	switch {
+	case n < 13:
+		return byte(n), nil
+	case n < 269:
+		return 13, []byte{byte(n - 13)}
+	}
+	return 14, binary.BigEndian.AppendUint16(nil, uint16(n-269))
+}
+
+// encode serializes the message, options must be sorted by number
+func (m *coapMessage) encode() []byte {
+	buf := []byte{1<<6 | m.Type<<4 | byte(len(m.Token)), m.Code}
+	buf = binary.BigEndian.AppendUint16(buf, m.MessageID)
+	buf = append(buf, m.Token...)
+	last := 0
+	for _, opt := range m.Options {
+		delta, deltaExt := coapOptionNibble(int(opt.Number) - last)
+		length, lengthExt := coapOptionNibble(len(opt.Value))
+		buf = append(buf, delta<<4|length)
+		buf = append(buf, deltaExt...)
+		buf = append(buf, lengthExt...)
+		buf = append(buf, opt.Value...)
+		last = int(opt.Number)
+	}
+	if len(m.Payload) > 0 {
+		buf = append(buf, coapPayloadMark)
+		buf = append(buf, m.Payload...)
+	}
+	return buf
+}
+
+// coapReply creates the response to msg, piggybacked on the ACK of
+// confirmable requests
+func coapReply(msg *coapMessage) *coapMessage {
+	resp := &coapMessage{Type: coapNonConfirmable, MessageID: uint16(rand.N(1 << 16)), Token: msg.Token}
+	if msg.Type == coapConfirmable {
+		resp.Type, resp.MessageID = coapAck, msg.MessageID
+	}
+	return resp
+}
+
+// coapResponse answers GET requests for the known resources, splitting the
+// content into Block2 blocks. Unknown paths get 4.04 and other methods 4.05.
+func coapResponse(msg *coapMessage, path string) *coapMessage {
+	resp := coapReply(msg)
+
+	resource, ok := coapResources[path]
+	switch {
+	case !ok:
+		resp.Code = coapNotFound
+		return resp
+	case msg.Code != 1:
+		resp.Code = coapNotAllowed
+		return resp
+	}
+
+	num, szx := uint32(0), uint32(coapMaxSZX)
+	if block := msg.option(coapOptionBlock2); len(block) > 0 {
+		value := coapUint([]byte(block[0]))
+		num, szx = value>>4, value&0x07
+		if szx == 7 {
+			resp.Code = coapBadRequest
+			return resp
+		}
+		if szx > coapMaxSZX {
+			// a smaller block size than requested renumbers the blocks
+			num, szx = num<<(szx-coapMaxSZX), coapMaxSZX
+		}
+	}
+	size := uint32(16) << szx
+	content := resource.content
+	start := min(int(num*size), len(content))
+	end := min(start+int(size), len(content))
+	more := uint32(0)
+	if end < len(content) {
+		more = 1
+	}
+
+	resp.Code = coapContent
+	resp.Options = []coapOption{{Number: coapOptionContentFormat, Value: coapUintBytes(uint32(resource.format))}}
+	if len(content) > int(size) {
+		resp.Options = append(resp.Options, coapOption{Number: coapOptionBlock2, Value: coapUintBytes(num<<4 | more<<3 | szx)})
+	}
+	resp.Payload = []byte(content[start:end])
+	return resp
+}
+
+// parseLwM2MRegistration decodes the query parameters and the link format
+// object list of a registration request
+func parseLwM2MRegistration(msg *coapMessage) *lwm2mRegistration {
+	reg := &lwm2mRegistration{}
+	for _, param := range msg.option(coapOptionURIQuery) {
+		key, value, _ := strings.Cut(param, "=")
+		switch key {
+		case "ep":
+			reg.Endpoint = value
+		case "lt":
+			reg.Lifetime = value
+		case "lwm2m":
+			reg.Version = value
+		case "b":
+			reg.Binding = value
+		}
+	}
+	for _, link := range strings.Split(string(msg.Payload), ",") {
+		target, _, _ := strings.Cut(strings.TrimSpace(link), ";")
+		if strings.HasPrefix(target, "<") && strings.HasSuffix(target, ">") {
+			reg.Objects = append(reg.Objects, target[1:len(target)-1])
+		}
+	}
+	return reg
+}
+
+// lwm2mResponse answers the registration interface of an LwM2M server: a
+// registration is created under a random location, updates and
+// deregistrations of any location succeed
+func lwm2mResponse(msg *coapMessage, segments []string, reg *lwm2mRegistration) *coapMessage {
+	resp := coapReply(msg)
+	switch {
+	case len(segments) == 1 && msg.Code == 2 && reg.Endpoint != "":
+		reg.Location = fmt.Sprintf("%08x", rand.Uint32())
+		resp.Code = coapCreated
+		resp.Options = []coapOption{
+			{Number: coapOptionLocationPath, Value: []byte("rd")},
+			{Number: coapOptionLocationPath, Value: []byte(reg.Location)},
+		}
+	case len(segments) == 2 && msg.Code == 2:
+		resp.Code = coapChanged
+	case len(segments) == 2 && msg.Code == 4:
+		resp.Code = coapDeleted
+	case len(segments) == 1 && msg.Code == 2:
+		resp.Code = coapBadRequest
+	default:
+		resp.Code = coapNotAllowed
+	}
+	return resp
+}
+
+// HandleCoAP answers CoAP resource discovery and GET requests like a
+// constrained sensor node, recording the paths and payloads clients send.
+// LwM2M registrations are accepted like a device management server would
+// and OSCORE protected requests are refused for lack of a security context.
+func HandleCoAP(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedCoAP{}
+	defer func() {
+		if err := h.ProduceUDP("coap", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "coap"), producer.ErrAttr(err))
+		}
+	}()
+
+	msg, err := parseCoAP(data)
+	if err != nil {
+		logger.Debug("Failed to parse CoAP message", slog.String("protocol", "coap"), producer.ErrAttr(err))
+		return nil
+	}
+	segments := msg.option(coapOptionURIPath)
+	path := strings.Join(segments, "/")
+	req := coapRequest{
+		Type:      coapTypes[msg.Type],
+		Method:    coapMethods[msg.Code],
+		MessageID: msg.MessageID,
+		Token:     hex.EncodeToString(msg.Token),
+		Path:      "/" + path,
+		Query:     strings.Join(msg.option(coapOptionURIQuery), "&"),
+		Body:      msg.Payload,
+	}
+	if req.Method == "" {
+		req.Method = fmt.Sprintf("%d.%02d", msg.Code>>5, msg.Code&0x1f)
+	}
+	isRequest := msg.Code>>5 == 0 && msg.Code != 0 && msg.Type != coapAck && msg.Type != coapReset
+	req.OSCORE = len(msg.option(coapOptionOSCORE)) > 0
+	if isRequest && !req.OSCORE && len(segments) > 0 && len(segments) <= 2 && segments[0] == "rd" {
+		req.LwM2M = parseLwM2MRegistration(msg)
+	}
+	events = append(events, parsedCoAP{
+		Direction: "read",
+		Request:   req,
+		Payload:   data,
+	})
+	logger.Info(
+		"CoAP request",
+		slog.String("handler", "coap"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("type", req.Type),
+		slog.String("method", req.Method),
+		slog.String("path", req.Path),
+		slog.String("query", req.Query),
+	)
+
+	var resp *coapMessage
+	switch {
+	case msg.Type == coapConfirmable && msg.Code == 0:
+		// an empty confirmable message is a CoAP ping
+		resp = &coapMessage{Type: coapReset, MessageID: msg.MessageID}
+	case isRequest && req.OSCORE:
+		logger.Info(
+			"CoAP OSCORE request",
+			slog.String("handler", "coap"),
+			slog.String("src_ip", srcAddr.IP.String()),
+			slog.String("oscore_option", hex.EncodeToString([]byte(msg.option(coapOptionOSCORE)[0]))),
+		)
+		if !slices.Contains(md.Tags, "oscore_probe") {
+			md.Tags = append(md.Tags, "oscore_probe")
+		}
+		// the request cannot be decrypted without a security context
+		resp = coapReply(msg)
+		resp.Code = coapUnauthorized
+	case req.LwM2M != nil:
+		resp = lwm2mResponse(msg, segments, req.LwM2M)
+		logger.Info(
+			"LwM2M registration",
+			slog.String("handler", "coap"),
+			slog.String("src_ip", srcAddr.IP.String()),
+			slog.String("method", req.Method),
+			slog.String("path", req.Path),
+			slog.String("endpoint", req.LwM2M.Endpoint),
+			slog.String("lifetime", req.LwM2M.Lifetime),
+			slog.String("objects", strings.Join(req.LwM2M.Objects, ",")),
+		)
+		if !slices.Contains(md.Tags, "lwm2m") {
+			md.Tags = append(md.Tags, "lwm2m")
+		}
+	case isRequest:
+		resp = coapResponse(msg, path)
+	default:
+		return nil
+	}
+
+	out := resp.encode()
+	events = append(events, parsedCoAP{
+		Direction: "write",
+		Request:   req,
+		Payload:   out,
+	})
+	if err := sendResponse(srcAddr, dstAddr, data, out); err != nil {
+		logger.Debug("Failed to send CoAP response", slog.String("protocol", "coap"), producer.ErrAttr(err))
+	}
+	return nil
+}
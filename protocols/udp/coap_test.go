@@ -0,0 +1,86 @@
+package udp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoAPDiscovery(t *testing.T) {
+	// CON GET /.well-known/core with token 0x2a
+	req := []byte{0x41, 0x01, 0x12, 0x34, 0x2a, 0xbb, '.', 'w', 'e', 'l', 'l', '-', 'k', 'n', 'o', 'w', 'n', 0x04, 'c', 'o', 'r', 'e'}
+	msg, err := parseCoAP(req)
+	require.NoError(t, err)
+	require.Equal(t, []string{".well-known", "core"}, msg.option(coapOptionURIPath))
+
+	resp := coapResponse(msg, ".well-known/core")
+	require.Equal(t, byte(coapAck), resp.Type)
+	require.Equal(t, uint16(0x1234), resp.MessageID)
+	require.Equal(t, byte(coapContent), resp.Code)
+	require.Equal(t, `</sensors/temp>;rt="temperature-`, string(resp.Payload))
+	out := resp.encode()
+	require.Equal(t, []byte{0x61, 0x45, 0x12, 0x34, 0x2a, 0xc1, 0x28, 0xb1, 0x09, 0xff}, out[:10])
+	require.LessOrEqual(t, len(out), maxAmplification*len(req))
+
+	// the second 64 byte block starts at the third 32 byte block
+	msg.Options = append(msg.Options, coapOption{Number: coapOptionBlock2, Value: []byte{0x12}})
+	resp = coapResponse(msg, ".well-known/core")
+	require.Equal(t, []byte{0x29}, resp.Options[1].Value)
+	require.Equal(t, `idity>;rt="humidity-p";if="senso`, string(resp.Payload))
+
+	parsed, err := parseCoAP(out)
+	require.NoError(t, err)
+	require.Equal(t, resp.Token, parsed.Token)
+
+	msg.Code = 3
+	require.Equal(t, byte(coapNotAllowed), coapResponse(msg, "sensors/temp").Code)
+	require.Equal(t, byte(coapNotFound), coapResponse(msg, "admin").Code)
+
+	_, err = parseCoAP([]byte{0x41, 0x01, 0x00})
+	require.Error(t, err)
+}
+
+func TestLwM2MRegistration(t *testing.T) {
+	// CON POST /rd?ep=node-1&lt=86400&lwm2m=1.1&b=U as sent by Leshan clients
+	req := &coapMessage{
+		Type:      coapConfirmable,
+		Code:      2,
+		MessageID: 0x0102,
+		Token:     []byte{0x07},
+		Options: []coapOption{
+			{Number: coapOptionURIPath, Value: []byte("rd")},
+			{Number: coapOptionContentFormat, Value: []byte{coapLinkFormat}},
+			{Number: coapOptionURIQuery, Value: []byte("ep=node-1")},
+			{Number: coapOptionURIQuery, Value: []byte("lt=86400")},
+			{Number: coapOptionURIQuery, Value: []byte("lwm2m=1.1")},
+			{Number: coapOptionURIQuery, Value: []byte("b=U")},
+		},
+		Payload: []byte(`</>;rt="oma.lwm2m";ct=11543,</1/0>,</3/0>,</5/0>`),
+	}
+	msg, err := parseCoAP(req.encode())
+	require.NoError(t, err)
+	reg := parseLwM2MRegistration(msg)
+	require.Equal(t, "node-1", reg.Endpoint)
+	require.Equal(t, "86400", reg.Lifetime)
+	require.Equal(t, "1.1", reg.Version)
+	require.Equal(t, "U", reg.Binding)
+	require.Equal(t, []string{"/", "/1/0", "/3/0", "/5/0"}, reg.Objects)
+
+	resp := lwm2mResponse(msg, []string{"rd"}, reg)
+	require.Equal(t, byte(coapAck), resp.Type)
+	require.Equal(t, uint16(0x0102), resp.MessageID)
+	require.Equal(t, byte(coapCreated), resp.Code)
+	parsed, err := parseCoAP(resp.encode())
+	require.NoError(t, err)
+	require.Equal(t, []string{"rd", reg.Location}, parsed.option(coapOptionLocationPath))
+	require.Len(t, reg.Location, 8)
+
+	// updates and deregistrations of the location succeed
+	require.Equal(t, byte(coapChanged), lwm2mResponse(msg, []string{"rd", reg.Location}, reg).Code)
+	msg.Code = 4
+	require.Equal(t, byte(coapDeleted), lwm2mResponse(msg, []string{"rd", reg.Location}, reg).Code)
+
+	// a registration needs an endpoint name
+	msg.Code = 2
+	require.Equal(t, byte(coapBadRequest), lwm2mResponse(msg, []string{"rd"}, &lwm2mRegistration{}).Code)
+}
@@ -0,0 +1,39 @@
+package udp
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// HandleDNS answers DNS queries with the configured sinkhole or NXDOMAIN
+func HandleDNS(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	resp, msg, err := helpers.DNSResponse(data)
+	defer func() {
+		if err := h.ProduceUDP("dns", srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "dns"), producer.ErrAttr(err))
+		}
+	}()
+	if err != nil {
+		logger.Debug("Failed to parse DNS query", slog.String("protocol", "dns"), producer.ErrAttr(err))
+		return nil
+	}
+	for _, q := range msg.Questions {
+		logger.Info(
+			"DNS query",
+			slog.String("handler", "dns"),
+			slog.String("src_ip", srcAddr.IP.String()),
+			slog.String("qname", q.Name),
+			slog.String("qtype", q.Type),
+		)
+	}
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send DNS response", slog.String("protocol", "dns"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,582 @@
+package udp
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	dtlsChangeCipherSpec = 20
+	dtlsAlert            = 21
+	dtlsHandshake        = 22
+	dtlsApplicationData  = 23
+
+	dtlsClientHello        = 1
+	dtlsServerHello        = 2
+	dtlsHelloVerifyRequest = 3
+	dtlsCertificate        = 11
+	dtlsServerKeyExchange  = 12
+	dtlsServerHelloDone    = 14
+	dtlsClientKeyExchange  = 16
+	dtlsFinished           = 20
+
+	dtlsVersion10 = 0xfeff
+	dtlsVersion12 = 0xfefd
+	// dtlsCipherSuite is TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, the one
+	// suite offered since every DTLS 1.2 stack supports it
+	dtlsCipherSuite = 0xc02b
+
+	dtlsGroupP256   = 23
+	dtlsGroupX25519 = 29
+
+	dtlsExtPointFormats  = 11
+	dtlsExtRenegotiation = 0xff01
+	dtlsSCSV             = 0x00ff
+
+	dtlsRecordHeader    = 13
+	dtlsHandshakeHeader = 12
+	dtlsExplicitNonce   = 8
+
+	dtlsSessionTimeout = time.Minute
+	dtlsMaxSessions    = 1024
+	dtlsMaxCerts       = 256
+)
+
+// dtlsSecret keys the stateless cookies, sessions are only created for
+// sources that echoed theirs
+var dtlsSecret = func() []byte {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return secret
+}()
+
+type parsedDTLS struct {
+	ClientHello *helpers.ClientHello `json:"client_hello,omitempty"`
+	JA3         string               `json:"ja3,omitempty"`
+	JA3Hash     string               `json:"ja3_hash,omitempty"`
+	JA4         string               `json:"ja4,omitempty"`
+	// Verified is set once the source echoed its cookie
+	Verified    bool     `json:"verified"`
+	Established bool     `json:"established"`
+	Alerts      []int    `json:"alerts,omitempty"`
+	Data        [][]byte `json:"data,omitempty"`
+}
+
+// IsDTLS reports whether data starts with a DTLS record, which tells it
+// apart from QUIC on ports both are used on
+func IsDTLS(data []byte) bool {
+	return len(data) >= dtlsRecordHeader && data[0] >= dtlsChangeCipherSpec && data[0] <= dtlsApplicationData && data[1] == 0xfe
+}
+
+type dtlsRecord struct {
+	contentType byte
+	epoch       uint16
+	seq         uint64
+	header      []byte
+	fragment    []byte
+}
+
+func parseDTLSRecords(data []byte) ([]dtlsRecord, error) {
+	records := []dtlsRecord{}
+	for len(data) > 0 {
+		if len(data) < dtlsRecordHeader {
+			return records, errors.New("truncated DTLS record header")
+		}
+		end := dtlsRecordHeader + int(binary.BigEndian.Uint16(data[11:]))
+		if len(data) < end {
+			return records, errors.New("truncated DTLS record")
+		}
+		records = append(records, dtlsRecord{
+			contentType: data[0],
+			epoch:       binary.BigEndian.Uint16(data[3:]),
+			seq:         binary.BigEndian.Uint64(data[3:]) & (1<<48 - 1),
+			header:      data[:dtlsRecordHeader],
+			fragment:    data[dtlsRecordHeader:end],
+		})
+		data = data[end:]
+	}
+	return records, nil
+}
+
+func appendUint24(buf []byte, v int) []byte {
+	return append(buf, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func uint24(b []byte) int {
+	return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+}
+
+// dtlsHandshakeMessages splits a handshake fragment into its messages,
+// fragmented messages are not reassembled
+func dtlsHandshakeMessages(fragment []byte) ([][]byte, error) {
+	messages := [][]byte{}
+	for len(fragment) > 0 {
+		if len(fragment) < dtlsHandshakeHeader {
+			return nil, errors.New("truncated DTLS handshake header")
+		}
+		length := uint24(fragment[1:])
+		if uint24(fragment[6:]) != 0 || uint24(fragment[9:]) != length {
+			return nil, errors.New("fragmented DTLS handshake message")
+		}
+		if len(fragment) < dtlsHandshakeHeader+length {
+			return nil, errors.New("truncated DTLS handshake message")
+		}
+		messages = append(messages, fragment[:dtlsHandshakeHeader+length])
+		fragment = fragment[dtlsHandshakeHeader+length:]
+	}
+	return messages, nil
+}
+
+// dtlsPRF is the TLS 1.2 PRF with SHA-256
+func dtlsPRF(secret []byte, label string, seed []byte, length int) []byte {
+	seed = append([]byte(label), seed...)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(seed)
+	a := mac.Sum(nil)
+	out := []byte{}
+	for len(out) < length {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+	return out[:length]
+}
+
+func dtlsCookie(addr *net.UDPAddr, clientRandom []byte) []byte {
+	mac := hmac.New(sha256.New, dtlsSecret)
+	mac.Write([]byte(addr.String()))
+	mac.Write(clientRandom)
+	return mac.Sum(nil)[:20]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var dtlsCerts = helpers.NewCertCache(dtlsMaxCerts)
+
+// dtlsSession is the server side of a DTLS 1.2 connection
+type dtlsSession struct {
+	clientRandom []byte
+	serverRandom []byte
+	key          *ecdh.PrivateKey
+	// transcript holds the handshake messages from the second ClientHello
+	// on, the first one and the HelloVerifyRequest are not part of it
+	transcript   []byte
+	masterSecret []byte
+	clientAEAD   cipher.AEAD
+	serverAEAD   cipher.AEAD
+	clientIV     []byte
+	serverIV     []byte
+	// epoch and seq number the records we send, messageSeq the handshake
+	// messages
+	epoch       uint16
+	seq         uint64
+	messageSeq  uint16
+	established bool
+	seen        time.Time
+	mtx         sync.Mutex
+}
+
+// record frames fragment, encrypting it once our epoch changed
+func (s *dtlsSession) record(contentType byte, fragment []byte) []byte {
+	header := []byte{contentType, dtlsVersion12 >> 8, dtlsVersion12 & 0xff}
+	header = binary.BigEndian.AppendUint64(header, uint64(s.epoch)<<48|s.seq)
+	s.seq++
+	if s.epoch > 0 {
+		explicit := header[3:11]
+		nonce := append(slices.Clone(s.serverIV), explicit...)
+		aad := append(slices.Clone(header[3:11]), header[:3]...)
+		aad = binary.BigEndian.AppendUint16(aad, uint16(len(fragment)))
+		fragment = s.serverAEAD.Seal(slices.Clone(explicit), nonce, fragment, aad)
+	}
+	header = binary.BigEndian.AppendUint16(header, uint16(len(fragment)))
+	return append(header, fragment...)
+}
+
+// open decrypts a record the client sent after its ChangeCipherSpec
+func (s *dtlsSession) open(record dtlsRecord) ([]byte, error) {
+	if s.clientAEAD == nil || record.epoch != 1 {
+		return nil, fmt.Errorf("unexpected DTLS epoch %d", record.epoch)
+	}
+	if len(record.fragment) < dtlsExplicitNonce+s.clientAEAD.Overhead() {
+		return nil, errors.New("DTLS record too short")
+	}
+	nonce := append(slices.Clone(s.clientIV), record.fragment[:dtlsExplicitNonce]...)
+	aad := append(slices.Clone(record.header[3:11]), record.header[:3]...)
+	aad = binary.BigEndian.AppendUint16(aad, uint16(len(record.fragment)-dtlsExplicitNonce-s.clientAEAD.Overhead()))
+	return s.clientAEAD.Open(nil, nonce, record.fragment[dtlsExplicitNonce:], aad)
+}
+
+// handshake frames body as our next handshake message and adds it to the
+// transcript
+func (s *dtlsSession) handshake(msgType byte, body []byte) []byte {
+	msg := appendUint24([]byte{msgType}, len(body))
+	msg = binary.BigEndian.AppendUint16(msg, s.messageSeq)
+	msg = appendUint24(appendUint24(msg, 0), len(body))
+	msg = append(msg, body...)
+	s.messageSeq++
+	s.transcript = append(s.transcript, msg...)
+	return msg
+}
+
+func dtlsAlertRecord(record dtlsRecord, description byte) []byte {
+	resp := slices.Clone(record.header[:11])
+	resp = binary.BigEndian.AppendUint16(resp, 2)
+	return append(resp, 2, description)
+}
+
+// dtlsVerifyRequest asks the client to prove it receives our replies
+// before any state is kept. It reuses the record and message sequence
+// numbers of the ClientHello as stateless servers do.
+func dtlsVerifyRequest(record dtlsRecord, cookie []byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, dtlsVersion10)
+	body = append(append(body, byte(len(cookie))), cookie...)
+	msg := appendUint24([]byte{dtlsHelloVerifyRequest}, len(body))
+	msg = append(msg, record.fragment[4:6]...)
+	msg = appendUint24(appendUint24(msg, 0), len(body))
+	msg = append(msg, body...)
+
+	resp := []byte{dtlsHandshake, dtlsVersion10 >> 8, dtlsVersion10 & 0xff}
+	resp = append(resp, record.header[3:11]...)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(msg)))
+	return append(resp, msg...)
+}
+
+// newDTLSSession answers a ClientHello that carried a valid cookie with
+// the ServerHello up to the ServerHelloDone in a single datagram
+func newDTLSSession(hello *helpers.ClientHello, record dtlsRecord, cert *tls.Certificate) (*dtlsSession, []byte, error) {
+	if !slices.Contains(hello.CipherSuites, dtlsCipherSuite) {
+		return nil, nil, errors.New("no supported DTLS cipher suite")
+	}
+	curve, group := ecdh.Curve(nil), uint16(0)
+	for _, g := range hello.SupportedGroups {
+		if g == dtlsGroupX25519 {
+			curve, group = ecdh.X25519(), g
+			break
+		}
+		if g == dtlsGroupP256 && curve == nil {
+			curve, group = ecdh.P256(), g
+		}
+	}
+	if curve == nil {
+		return nil, nil, errors.New("no supported DTLS group")
+	}
+	key, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := &dtlsSession{
+		clientRandom: hello.Random,
+		serverRandom: make([]byte, 32),
+		key:          key,
+		transcript:   slices.Clone(record.fragment[:dtlsHandshakeHeader+uint24(record.fragment[1:])]),
+		seq:          record.seq,
+		messageSeq:   binary.BigEndian.Uint16(record.fragment[4:]),
+	}
+	if _, err := rand.Read(s.serverRandom); err != nil {
+		return nil, nil, err
+	}
+
+	body := binary.BigEndian.AppendUint16(nil, dtlsVersion12)
+	body = append(body, s.serverRandom...)
+	sessionID := make([]byte, 32)
+	_, _ = rand.Read(sessionID)
+	body = append(append(body, byte(len(sessionID))), sessionID...)
+	body = binary.BigEndian.AppendUint16(body, dtlsCipherSuite)
+	body = append(body, 0)
+	extensions := []byte{}
+	if slices.Contains(hello.Extensions, dtlsExtRenegotiation) || slices.Contains(hello.CipherSuites, dtlsSCSV) {
+		extensions = append(extensions, 0xff, 0x01, 0, 1, 0)
+	}
+	if slices.Contains(hello.Extensions, dtlsExtPointFormats) {
+		extensions = append(extensions, 0, dtlsExtPointFormats, 0, 2, 1, 0)
+	}
+	if len(extensions) > 0 {
+		body = append(binary.BigEndian.AppendUint16(body, uint16(len(extensions))), extensions...)
+	}
+	flight := s.record(dtlsHandshake, s.handshake(dtlsServerHello, body))
+
+	certs := []byte{}
+	for _, der := range cert.Certificate {
+		certs = append(appendUint24(certs, len(der)), der...)
+	}
+	flight = append(flight, s.record(dtlsHandshake, s.handshake(dtlsCertificate, append(appendUint24(nil, len(certs)), certs...)))...)
+
+	public := key.PublicKey().Bytes()
+	params := binary.BigEndian.AppendUint16([]byte{3}, group)
+	params = append(append(params, byte(len(public))), public...)
+	digest := sha256.Sum256(slices.Concat(s.clientRandom, s.serverRandom, params))
+	signer, ok := cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("DTLS certificate key is not ECDSA")
+	}
+	signature, err := ecdsa.SignASN1(rand.Reader, signer, digest[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	// signed with ecdsa_secp256r1_sha256
+	body = append(params, 4, 3)
+	body = append(binary.BigEndian.AppendUint16(body, uint16(len(signature))), signature...)
+	flight = append(flight, s.record(dtlsHandshake, s.handshake(dtlsServerKeyExchange, body))...)
+	flight = append(flight, s.record(dtlsHandshake, s.handshake(dtlsServerHelloDone, nil))...)
+	return s, flight, nil
+}
+
+func (s *dtlsSession) clientKeyExchange(message []byte) error {
+	body := message[dtlsHandshakeHeader:]
+	if len(body) < 1 || len(body) != 1+int(body[0]) {
+		return errors.New("invalid DTLS ClientKeyExchange")
+	}
+	peer, err := s.key.Curve().NewPublicKey(body[1:])
+	if err != nil {
+		return err
+	}
+	preMaster, err := s.key.ECDH(peer)
+	if err != nil {
+		return err
+	}
+	s.transcript = append(s.transcript, message...)
+	s.masterSecret = dtlsPRF(preMaster, "master secret", slices.Concat(s.clientRandom, s.serverRandom), 48)
+	keys := dtlsPRF(s.masterSecret, "key expansion", slices.Concat(s.serverRandom, s.clientRandom), 40)
+	if s.clientAEAD, err = newGCM(keys[:16]); err != nil {
+		return err
+	}
+	if s.serverAEAD, err = newGCM(keys[16:32]); err != nil {
+		return err
+	}
+	s.clientIV, s.serverIV = keys[32:36], keys[36:40]
+	return nil
+}
+
+// finished checks the Finished of the client and answers with our
+// ChangeCipherSpec and Finished
+func (s *dtlsSession) finished(message []byte) ([]byte, error) {
+	transcript := sha256.Sum256(s.transcript)
+	if !hmac.Equal(message[dtlsHandshakeHeader:], dtlsPRF(s.masterSecret, "client finished", transcript[:], 12)) {
+		return nil, errors.New("invalid DTLS Finished")
+	}
+	s.transcript = append(s.transcript, message...)
+	transcript = sha256.Sum256(s.transcript)
+	finished := s.handshake(dtlsFinished, dtlsPRF(s.masterSecret, "server finished", transcript[:], 12))
+	resp := s.record(dtlsChangeCipherSpec, []byte{1})
+	s.epoch, s.seq = 1, 0
+	s.established = true
+	return append(resp, s.record(dtlsHandshake, finished)...), nil
+}
+
+// handle processes a record the client sent after its ClientHello
+func (s *dtlsSession) handle(record dtlsRecord, msg *parsedDTLS) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	fragment := record.fragment
+	if record.epoch > 0 {
+		var err error
+		if fragment, err = s.open(record); err != nil {
+			return nil, err
+		}
+	}
+	switch record.contentType {
+	case dtlsChangeCipherSpec:
+		return nil, nil
+	case dtlsAlert:
+		if len(fragment) == 2 {
+			msg.Alerts = append(msg.Alerts, int(fragment[1]))
+		}
+		return nil, nil
+	case dtlsApplicationData:
+		if !s.established {
+			return nil, errors.New("DTLS application data before the handshake finished")
+		}
+		msg.Data = append(msg.Data, fragment)
+		return nil, nil
+	case dtlsHandshake:
+	default:
+		return nil, fmt.Errorf("unknown DTLS content type %d", record.contentType)
+	}
+
+	messages, err := dtlsHandshakeMessages(fragment)
+	if err != nil {
+		return nil, err
+	}
+	resp := []byte{}
+	for _, message := range messages {
+		switch {
+		case message[0] == dtlsClientKeyExchange && record.epoch == 0 && s.masterSecret == nil:
+			if err := s.clientKeyExchange(message); err != nil {
+				return resp, err
+			}
+		case message[0] == dtlsFinished && record.epoch == 1 && !s.established:
+			out, err := s.finished(message)
+			if err != nil {
+				return resp, err
+			}
+			msg.Established = true
+			resp = append(resp, out...)
+		}
+	}
+	return resp, nil
+}
+
+// dtlsSessionStore keeps the sessions of sources that echoed their cookie
+type dtlsSessionStore struct {
+	sessions map[string]*dtlsSession
+	mtx      sync.Mutex
+}
+
+var dtlsSessions = &dtlsSessionStore{sessions: map[string]*dtlsSession{}}
+
+func (st *dtlsSessionStore) get(addr string, now time.Time) *dtlsSession {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	for a, s := range st.sessions {
+		if now.Sub(s.seen) > dtlsSessionTimeout {
+			delete(st.sessions, a)
+		}
+	}
+	s, ok := st.sessions[addr]
+	if ok {
+		s.seen = now
+	}
+	return s
+}
+
+func (st *dtlsSessionStore) put(addr string, s *dtlsSession, now time.Time) bool {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	if _, ok := st.sessions[addr]; !ok && len(st.sessions) >= dtlsMaxSessions {
+		return false
+	}
+	s.seen = now
+	st.sessions[addr] = s
+	return true
+}
+
+// dtlsRespond processes a datagram and creates the reply. verified tells
+// whether the source proved to receive our replies.
+func dtlsRespond(data []byte, srcAddr, dstAddr *net.UDPAddr, msg *parsedDTLS, now time.Time) (resp []byte, verified bool, err error) {
+	records, err := parseDTLSRecords(data)
+	if err != nil {
+		return nil, false, err
+	}
+	session := dtlsSessions.get(srcAddr.String(), now)
+	for _, record := range records {
+		if record.contentType == dtlsHandshake && record.epoch == 0 && len(record.fragment) > 0 && record.fragment[0] == dtlsClientHello {
+			hello, err := helpers.ParseDTLSClientHello(record.fragment)
+			if err != nil {
+				return nil, false, err
+			}
+			msg.ClientHello = hello
+			msg.JA3, msg.JA3Hash = hello.JA3()
+			msg.JA4 = hello.JA4(helpers.JA4DTLS)
+			cookie := dtlsCookie(srcAddr, hello.Random)
+			if !hmac.Equal(hello.Cookie, cookie) {
+				return dtlsVerifyRequest(record, cookie), false, nil
+			}
+			msg.Verified = true
+
+			name := hello.ServerName
+			if name == "" {
+				name = dstAddr.IP.String()
+			}
+			cert, err := dtlsCerts.Get(name)
+			if err != nil {
+				return nil, true, err
+			}
+			var flight []byte
+			session, flight, err = newDTLSSession(hello, record, cert)
+			if err != nil {
+				// handshake_failure
+				return dtlsAlertRecord(record, 40), true, err
+			}
+			if !dtlsSessions.put(srcAddr.String(), session, now) {
+				return nil, true, errors.New("too many DTLS sessions")
+			}
+			resp = append(resp, flight...)
+			continue
+		}
+		if session == nil {
+			return resp, verified, errors.New("no DTLS session for source")
+		}
+		msg.Verified = true
+		out, err := session.handle(record, msg)
+		resp = append(resp, out...)
+		if err != nil {
+			return resp, true, err
+		}
+	}
+	return resp, msg.Verified, nil
+}
+
+// HandleDTLS completes DTLS 1.2 handshakes with a self-signed certificate
+// to fingerprint the clients and record the application data they send.
+// Sources get nothing but a HelloVerifyRequest before echoing its cookie.
+func HandleDTLS(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	msg := parsedDTLS{}
+	defer func() {
+		if err := h.ProduceUDP("dtls", srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "dtls"), producer.ErrAttr(err))
+		}
+	}()
+
+	resp, verified, err := dtlsRespond(data, srcAddr, dstAddr, &msg, time.Now())
+	if err != nil {
+		logger.Debug("Failed to process DTLS datagram", slog.String("protocol", "dtls"), producer.ErrAttr(err))
+	}
+	if msg.ClientHello != nil || msg.Established || len(msg.Data) > 0 {
+		serverName := ""
+		if msg.ClientHello != nil {
+			serverName = msg.ClientHello.ServerName
+		}
+		logger.Info(
+			"DTLS datagram",
+			slog.String("handler", "dtls"),
+			slog.String("src_ip", srcAddr.IP.String()),
+			slog.String("server_name", serverName),
+			slog.String("ja3_hash", msg.JA3Hash),
+			slog.Bool("established", msg.Established),
+			slog.Int("data_records", len(msg.Data)),
+		)
+	}
+	if len(resp) == 0 {
+		return nil
+	}
+	if verified {
+		err = sendVerifiedResponse(srcAddr, dstAddr, resp)
+	} else {
+		err = sendResponse(srcAddr, dstAddr, data, resp)
+	}
+	if err != nil {
+		logger.Debug("Failed to send DTLS response", slog.String("protocol", "dtls"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package udp
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDTLSPRF(t *testing.T) {
+	secret, _ := hex.DecodeString("9bbe436ba940f017b17652849a71db35")
+	seed, _ := hex.DecodeString("a0ba9f936cda311827a6f796ffd5198c")
+	require.Equal(t,
+		"e3f229ba727be17b8d122620557cd453c2aab21d07c3d495329b52d4e61edb5a",
+		hex.EncodeToString(dtlsPRF(secret, "test label", seed, 32)),
+	)
+}
+
+// testDTLSRecord frames a plaintext record the way a client does
+func testDTLSRecord(contentType byte, seq uint64, fragment []byte) []byte {
+	record := []byte{contentType, 0xfe, 0xfd}
+	record = binary.BigEndian.AppendUint64(record, seq)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(fragment)))
+	return append(record, fragment...)
+}
+
+func testDTLSHandshake(msgType byte, messageSeq uint16, body []byte) []byte {
+	msg := appendUint24([]byte{msgType}, len(body))
+	msg = binary.BigEndian.AppendUint16(msg, messageSeq)
+	msg = appendUint24(appendUint24(msg, 0), len(body))
+	return append(msg, body...)
+}
+
+func testDTLSClientHello(random, cookie []byte, messageSeq uint16) []byte {
+	body := append([]byte{0xfe, 0xfd}, random...)
+	body = append(body, 0, byte(len(cookie)))
+	body = append(body, cookie...)
+	// the cipher suite preceded by a GREASE value, null compression
+	body = append(body, 0, 4, 0x0a, 0x0a, 0xc0, 0x2b, 1, 0)
+	// supported groups and point formats
+	extensions := []byte{0, 10, 0, 4, 0, 2, 0, dtlsGroupX25519, 0, 11, 0, 2, 1, 0}
+	body = append(binary.BigEndian.AppendUint16(body, uint16(len(extensions))), extensions...)
+	return testDTLSHandshake(dtlsClientHello, messageSeq, body)
+}
+
+func TestDTLSHandshake(t *testing.T) {
+	require.True(t, IsDTLS(testDTLSRecord(dtlsHandshake, 0, make([]byte, 4))))
+	require.False(t, IsDTLS([]byte{0xc3, 0, 0, 0, 1, 8, 1, 2, 3, 4, 5, 6, 7, 8}))
+
+	src := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}
+	dst := &net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 4433}
+	now := time.Now()
+	clientRandom := make([]byte, 32)
+	_, _ = rand.Read(clientRandom)
+
+	req := testDTLSRecord(dtlsHandshake, 0, testDTLSClientHello(clientRandom, nil, 0))
+	msg := parsedDTLS{}
+	resp, verified, err := dtlsRespond(req, src, dst, &msg, now)
+	require.NoError(t, err)
+	require.False(t, verified)
+	require.Equal(t, "65277,49195,10-11,29,0", msg.JA3)
+	require.Equal(t, "dd2i010200_648b5c445417_33a13ba74d1c", msg.JA4)
+	require.LessOrEqual(t, len(resp), maxAmplification*len(req))
+	records, err := parseDTLSRecords(resp)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, byte(dtlsHelloVerifyRequest), records[0].fragment[0])
+	cookie := records[0].fragment[dtlsHandshakeHeader+3:]
+
+	clientHello := testDTLSClientHello(clientRandom, cookie, 1)
+	msg = parsedDTLS{}
+	resp, verified, err = dtlsRespond(testDTLSRecord(dtlsHandshake, 1, clientHello), src, dst, &msg, now)
+	require.NoError(t, err)
+	require.True(t, verified)
+	require.True(t, msg.Verified)
+	records, err = parseDTLSRecords(resp)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+
+	transcript := slices.Clone(clientHello)
+	bodies := [][]byte{}
+	for i, record := range records {
+		require.Equal(t, uint64(1+i), record.seq)
+		transcript = append(transcript, record.fragment...)
+		bodies = append(bodies, record.fragment[dtlsHandshakeHeader:])
+	}
+	require.Equal(t, []byte{0xc0, 0x2b}, bodies[0][67:69])
+	serverRandom := bodies[0][2:34]
+	cert, err := x509.ParseCertificate(bodies[1][6:])
+	require.NoError(t, err)
+	require.Equal(t, "192.0.2.2", cert.Subject.CommonName)
+	params := bodies[2][:4+bodies[2][3]]
+	digest := sha256.Sum256(slices.Concat(clientRandom, serverRandom, params))
+	signature := bodies[2][len(params)+4:]
+	require.True(t, ecdsa.VerifyASN1(cert.PublicKey.(*ecdsa.PublicKey), digest[:], signature))
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	serverKey, err := ecdh.X25519().NewPublicKey(params[4:])
+	require.NoError(t, err)
+	preMaster, err := key.ECDH(serverKey)
+	require.NoError(t, err)
+	masterSecret := dtlsPRF(preMaster, "master secret", slices.Concat(clientRandom, serverRandom), 48)
+	keys := dtlsPRF(masterSecret, "key expansion", slices.Concat(serverRandom, clientRandom), 40)
+	clientAEAD, err := newGCM(keys[:16])
+	require.NoError(t, err)
+	serverAEAD, err := newGCM(keys[16:32])
+	require.NoError(t, err)
+	// sessions with the keys swapped act as the client
+	client := &dtlsSession{epoch: 1, serverAEAD: clientAEAD, serverIV: keys[32:36]}
+	server := &dtlsSession{clientAEAD: serverAEAD, clientIV: keys[36:40]}
+
+	public := key.PublicKey().Bytes()
+	keyExchange := testDTLSHandshake(dtlsClientKeyExchange, 2, append([]byte{byte(len(public))}, public...))
+	transcript = append(transcript, keyExchange...)
+	hash := sha256.Sum256(transcript)
+	finished := testDTLSHandshake(dtlsFinished, 3, dtlsPRF(masterSecret, "client finished", hash[:], 12))
+	transcript = append(transcript, finished...)
+	req = slices.Concat(
+		testDTLSRecord(dtlsHandshake, 2, keyExchange),
+		testDTLSRecord(dtlsChangeCipherSpec, 3, []byte{1}),
+		client.record(dtlsHandshake, finished),
+	)
+	msg = parsedDTLS{}
+	resp, verified, err = dtlsRespond(req, src, dst, &msg, now)
+	require.NoError(t, err)
+	require.True(t, verified)
+	require.True(t, msg.Established)
+	records, err = parseDTLSRecords(resp)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, byte(dtlsChangeCipherSpec), records[0].contentType)
+	plain, err := server.open(records[1])
+	require.NoError(t, err)
+	hash = sha256.Sum256(transcript)
+	require.Equal(t, dtlsPRF(masterSecret, "server finished", hash[:], 12), plain[dtlsHandshakeHeader:])
+
+	msg = parsedDTLS{}
+	resp, _, err = dtlsRespond(client.record(dtlsApplicationData, []byte("GET / HTTP/1.1\r\n")), src, dst, &msg, now)
+	require.NoError(t, err)
+	require.Empty(t, resp)
+	require.Equal(t, [][]byte{[]byte("GET / HTTP/1.1\r\n")}, msg.Data)
+
+	_, _, err = dtlsRespond(req, &net.UDPAddr{IP: src.IP, Port: 40001}, dst, &parsedDTLS{}, now)
+	require.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package udp
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// chargenMaxDatagram is the largest chargen answer RFC 864 allows
+const chargenMaxDatagram = 512
+
+type parsedInetd struct {
+	Direction string `json:"direction,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// chargenDatagram fills size bytes with the RFC 864 pattern of 72 character
+// lines
+func chargenDatagram(size int) []byte {
+	resp := make([]byte, 0, size)
+	for n := 0; len(resp) < size; n++ {
+		for i := range 72 {
+			resp = append(resp, byte(' '+(n+i)%95))
+		}
+		resp = append(resp, '\r', '\n')
+	}
+	return resp[:size]
+}
+
+// inetdResponse builds the answer of the small inetd services, discard has
+// none. Chargen answers are cut to what the amplification limit lets through
+// instead of being dropped.
+func inetdResponse(service string, data []byte) []byte {
+	switch service {
+	case "echo":
+		return data
+	case "daytime":
+		return []byte(time.Now().UTC().Format("Monday, January 2, 2006 15:04:05-MST") + "\r\n")
+	case "chargen":
+		return chargenDatagram(min(chargenMaxDatagram, maxAmplification*len(data)))
+	}
+	return nil
+}
+
+func handleInetd(service string, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	if !slices.Contains(md.Tags, "inetd") {
+		md.Tags = append(md.Tags, "inetd")
+	}
+	events := []parsedInetd{{Direction: "read", Payload: data}}
+	defer func() {
+		if err := h.ProduceUDP(service, srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", service), producer.ErrAttr(err))
+		}
+	}()
+
+	logger.Info(
+		"inetd datagram",
+		slog.String("handler", service),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.Int("size", len(data)),
+	)
+	resp := inetdResponse(service, data)
+	if len(resp) == 0 {
+		return nil
+	}
+	events = append(events, parsedInetd{Direction: "write", Payload: resp})
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send response", slog.String("protocol", service), producer.ErrAttr(err))
+	}
+	return nil
+}
+
+// HandleEcho sends datagrams back unchanged (RFC 862)
+func HandleEcho(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	return handleInetd("echo", srcAddr, dstAddr, data, md, logger, h)
+}
+
+// HandleDiscard only records datagrams (RFC 863)
+func HandleDiscard(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	return handleInetd("discard", srcAddr, dstAddr, data, md, logger, h)
+}
+
+// HandleDaytime answers with the current time (RFC 867)
+func HandleDaytime(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	return handleInetd("daytime", srcAddr, dstAddr, data, md, logger, h)
+}
+
+// HandleChargen answers with the character generator pattern (RFC 864)
+func HandleChargen(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	return handleInetd("chargen", srcAddr, dstAddr, data, md, logger, h)
+}
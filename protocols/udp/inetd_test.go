@@ -0,0 +1,20 @@
+package udp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInetdResponse(t *testing.T) {
+	require.Equal(t, []byte("ping"), inetdResponse("echo", []byte("ping")))
+	require.Nil(t, inetdResponse("discard", []byte("ping")))
+	require.True(t, strings.HasSuffix(string(inetdResponse("daytime", []byte{0})), "-UTC\r\n"))
+
+	resp := inetdResponse("chargen", []byte{0})
+	require.Equal(t, []byte(` !"`), resp)
+	resp = inetdResponse("chargen", make([]byte, 400))
+	require.Len(t, resp, chargenMaxDatagram)
+	require.Equal(t, "\r\n!\"#", string(resp[72:77]))
+}
@@ -0,0 +1,292 @@
+package udp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	rmcpVersion   = 0x06
+	rmcpClassASF  = 0x06
+	rmcpClassIPMI = 0x07
+	asfIANA       = 0x000011be
+	asfPing       = 0x80
+	asfPong       = 0x40
+
+	ipmiAuthRMCPPlus        = 0x06
+	ipmiOpenSessionRequest  = 0x10
+	ipmiOpenSessionResponse = 0x11
+	ipmiRAKP1               = 0x12
+	ipmiRAKP2               = 0x13
+	ipmiRAKP3               = 0x14
+	ipmiRAKP4               = 0x15
+	ipmiNetFnApp            = 0x06
+	ipmiGetChannelAuthCaps  = 0x38
+	// ipmiInvalidIntegrity is the RAKP status sent back to RAKP 3 messages
+	ipmiInvalidIntegrity = 0x0f
+)
+
+var ipmiPayloadTypes = map[byte]string{
+	ipmiOpenSessionRequest: "open_session_request",
+	ipmiRAKP1:              "rakp1",
+	ipmiRAKP3:              "rakp3",
+}
+
+// ipmiSecret keeps the RMCP+ handshake stateless, the managed system session
+// ID is the console session ID masked with it and the managed system random
+// number is fixed for the lifetime of the process
+var ipmiSecret = func() []byte {
+	secret := make([]byte, 20)
+	_, _ = rand.Read(secret)
+	return secret
+}()
+
+var ipmiGUID = []byte{0xa1, 0x23, 0x8c, 0x60, 0x72, 0x1f, 0x11, 0xe8, 0x80, 0x00, 0x0c, 0xc4, 0x7a, 0x3e, 0x91, 0x5d}
+
+type ipmiRequest struct {
+	Type           string `json:"type"`
+	Role           uint8  `json:"role,omitempty"`
+	Username       string `json:"username,omitempty"`
+	ConsoleSession uint32 `json:"console_session,omitempty"`
+	ConsoleRandom  string `json:"console_random,omitempty"`
+	AuthCode       string `json:"auth_code,omitempty"`
+}
+
+type parsedIPMI struct {
+	Direction string      `json:"direction,omitempty"`
+	Request   ipmiRequest `json:"request,omitempty"`
+	Payload   []byte      `json:"payload,omitempty"`
+}
+
+func ipmiManagedSession(console uint32) uint32 {
+	return console ^ binary.BigEndian.Uint32(ipmiSecret)
+}
+
+func ipmiChecksum(data []byte) byte {
+	sum := byte(0)
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+// asfPongMessage answers an RMCP presence ping, announcing IPMI support
+func asfPongMessage(tag byte) []byte {
+	resp := []byte{rmcpVersion, 0x00, 0xff, rmcpClassASF}
+	resp = binary.BigEndian.AppendUint32(resp, asfIANA)
+	resp = append(resp, asfPong, tag, 0x00, 0x10)
+	resp = binary.BigEndian.AppendUint32(resp, asfIANA)
+	resp = append(resp, 0x00, 0x00, 0x00, 0x00, 0x81, 0x00)
+	return append(resp, make([]byte, 6)...)
+}
+
+// ipmiChannelAuthCaps answers Get Channel Authentication Capabilities sent in
+// an IPMI 1.5 session wrapper. The BMC supports IPMI 2.0 and MD5, MD2, none
+// and straight password authentication like a common server board.
+func ipmiChannelAuthCaps(data []byte, req *ipmiRequest) ([]byte, error) {
+	if len(data) < 10 || data[0] != 0x00 {
+		return nil, errors.New("unsupported IPMI 1.5 session")
+	}
+	size := int(data[9])
+	msg := data[10:]
+	if size < 7 || len(msg) < size {
+		return nil, errors.New("truncated IPMI message")
+	}
+	msg = msg[:size]
+	if msg[1]>>2 != ipmiNetFnApp || msg[5] != ipmiGetChannelAuthCaps {
+		req.Type = "other"
+		return nil, nil
+	}
+	req.Type = "get_channel_auth_caps"
+	if len(msg) > 7 {
+		req.Role = msg[7] & 0x0f
+	}
+
+	// the response swaps the requester and responder addresses and LUNs
+	body := []byte{msg[3], (ipmiNetFnApp+1)<<2 | msg[4]&0x03}
+	body = append(body, ipmiChecksum(body))
+	tail := []byte{msg[0], msg[4]&0xfc | msg[1]&0x03, ipmiGetChannelAuthCaps, 0x00, 0x01, 0x97, 0x04, 0x03, 0x00, 0x00, 0x00, 0x00}
+	tail = append(tail, ipmiChecksum(tail))
+	body = append(body, tail...)
+
+	resp := []byte{rmcpVersion, 0x00, 0xff, rmcpClassIPMI, 0x00}
+	resp = append(resp, make([]byte, 8)...)
+	resp = append(resp, byte(len(body)))
+	return append(resp, body...), nil
+}
+
+// ipmiRAKP2Code is the key exchange authentication code a BMC with the
+// configured password would send, clients crack it offline to learn the
+// password
+func ipmiRAKP2Code(console, managed uint32, consoleRandom []byte, role byte, username string) []byte {
+	mac := hmac.New(sha1.New, []byte(viper.GetString("ipmi.password")))
+	_ = binary.Write(mac, binary.LittleEndian, console)
+	_ = binary.Write(mac, binary.LittleEndian, managed)
+	mac.Write(consoleRandom)
+	mac.Write(ipmiSecret[4:])
+	mac.Write(ipmiGUID)
+	mac.Write([]byte{role, byte(len(username))})
+	mac.Write([]byte(username))
+	return mac.Sum(nil)
+}
+
+// ipmiRMCPPlus runs the stateless side of the RMCP+ session setup: open
+// session requests are accepted, RAKP 1 is answered with RAKP 2 and RAKP 3
+// is refused with an integrity check error
+func ipmiRMCPPlus(data []byte, req *ipmiRequest) ([]byte, error) {
+	if len(data) < 12 {
+		return nil, errors.New("truncated RMCP+ session header")
+	}
+	payloadType := data[1] & 0x3f
+	size := int(binary.LittleEndian.Uint16(data[10:]))
+	payload := data[12:]
+	if len(payload) < size {
+		return nil, errors.New("truncated RMCP+ payload")
+	}
+	payload = payload[:size]
+	req.Type = ipmiPayloadTypes[payloadType]
+	if req.Type == "" {
+		req.Type = "other"
+	}
+
+	var out []byte
+	respType := byte(0)
+	switch payloadType {
+	case ipmiOpenSessionRequest:
+		if len(payload) < 32 {
+			return nil, errors.New("truncated open session request")
+		}
+		req.Role = payload[1]
+		req.ConsoleSession = binary.LittleEndian.Uint32(payload[4:])
+		respType = ipmiOpenSessionResponse
+		role := payload[1]
+		if role == 0 {
+			role = 0x04
+		}
+		out = []byte{payload[0], 0x00, role, 0x00}
+		out = append(out, payload[4:8]...)
+		out = binary.LittleEndian.AppendUint32(out, ipmiManagedSession(req.ConsoleSession))
+		out = append(out, payload[8:32]...)
+	case ipmiRAKP1:
+		if len(payload) < 28 || len(payload) < 28+int(payload[27]) {
+			return nil, errors.New("truncated RAKP 1")
+		}
+		managed := binary.LittleEndian.Uint32(payload[4:])
+		req.ConsoleSession = ipmiManagedSession(managed)
+		req.ConsoleRandom = hex.EncodeToString(payload[8:24])
+		req.Role = payload[24]
+		req.Username = string(payload[28 : 28+int(payload[27])])
+		respType = ipmiRAKP2
+		out = []byte{payload[0], 0x00, 0x00, 0x00}
+		out = binary.LittleEndian.AppendUint32(out, req.ConsoleSession)
+		out = append(out, ipmiSecret[4:]...)
+		out = append(out, ipmiGUID...)
+		out = append(out, ipmiRAKP2Code(req.ConsoleSession, managed, payload[8:24], payload[24], req.Username)...)
+	case ipmiRAKP3:
+		if len(payload) < 8 {
+			return nil, errors.New("truncated RAKP 3")
+		}
+		req.ConsoleSession = ipmiManagedSession(binary.LittleEndian.Uint32(payload[4:]))
+		req.AuthCode = hex.EncodeToString(payload[8:])
+		respType = ipmiRAKP4
+		out = []byte{payload[0], ipmiInvalidIntegrity, 0x00, 0x00}
+		out = binary.LittleEndian.AppendUint32(out, req.ConsoleSession)
+	default:
+		return nil, nil
+	}
+
+	resp := []byte{rmcpVersion, 0x00, 0xff, rmcpClassIPMI, ipmiAuthRMCPPlus, respType}
+	resp = append(resp, make([]byte, 8)...)
+	resp = binary.LittleEndian.AppendUint16(resp, uint16(len(out)))
+	return append(resp, out...), nil
+}
+
+// ipmiResponse dispatches an RMCP packet to the ASF or IPMI handling
+func ipmiResponse(data []byte) ([]byte, ipmiRequest, error) {
+	req := ipmiRequest{}
+	if len(data) < 4 || data[0] != rmcpVersion {
+		return nil, req, errors.New("invalid RMCP header")
+	}
+	switch data[3] & 0x1f {
+	case rmcpClassASF:
+		if len(data) < 12 || !bytes.Equal(data[4:8], []byte{0x00, 0x00, 0x11, 0xbe}) {
+			return nil, req, errors.New("invalid ASF message")
+		}
+		if data[8] != asfPing {
+			req.Type = "asf"
+			return nil, req, nil
+		}
+		req.Type = "ping"
+		return asfPongMessage(data[9]), req, nil
+	case rmcpClassIPMI:
+		if len(data) < 5 {
+			return nil, req, errors.New("truncated IPMI session")
+		}
+		if data[4] == ipmiAuthRMCPPlus {
+			resp, err := ipmiRMCPPlus(data[4:], &req)
+			return resp, req, err
+		}
+		resp, err := ipmiChannelAuthCaps(data[4:], &req)
+		return resp, req, err
+	}
+	return nil, req, errors.New("unsupported RMCP class")
+}
+
+// HandleIPMI answers RMCP presence pings and IPMI authentication capability
+// requests and walks clients through the RMCP+ handshake, recording the user
+// names of RAKP hash dumping attempts
+func HandleIPMI(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedIPMI{}
+	defer func() {
+		if err := h.ProduceUDP("ipmi", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "ipmi"), producer.ErrAttr(err))
+		}
+	}()
+
+	resp, req, err := ipmiResponse(data)
+	if err != nil {
+		logger.Debug("Failed to parse IPMI packet", slog.String("protocol", "ipmi"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, parsedIPMI{Direction: "read", Request: req, Payload: data})
+	if req.Type == "rakp1" && !slices.Contains(md.Tags, "ipmi_rakp") {
+		md.Tags = append(md.Tags, "ipmi_rakp")
+	}
+	logger.Info(
+		"IPMI request",
+		slog.String("handler", "ipmi"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("type", req.Type),
+		slog.String("username", req.Username),
+		slog.Int("role", int(req.Role)),
+	)
+	if req.Type == "rakp1" {
+		// the RAKP 2 reply lets the client believe the user exists
+		helpers.RecordUDPCredential(srcAddr, dstAddr, md, credentials.Credential{Protocol: "ipmi", Username: req.Username, Success: true}, logger, h)
+	}
+	if resp == nil {
+		return nil
+	}
+
+	events = append(events, parsedIPMI{Direction: "write", Request: req, Payload: resp})
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send IPMI response", slog.String("protocol", "ipmi"), producer.ErrAttr(err))
+	}
+	return nil
+}
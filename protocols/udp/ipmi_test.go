@@ -0,0 +1,90 @@
+package udp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPMIResponse(t *testing.T) {
+	viper.Set("ipmi.password", "admin")
+	defer viper.Reset()
+
+	// RMCP presence ping
+	resp, req, err := ipmiResponse([]byte{0x06, 0x00, 0xff, 0x06, 0x00, 0x00, 0x11, 0xbe, 0x80, 0x2a, 0x00, 0x00})
+	require.NoError(t, err)
+	require.Equal(t, "ping", req.Type)
+	require.Equal(t, []byte{0x40, 0x2a}, resp[8:10])
+
+	// Get Channel Authentication Capabilities as sent by ipmitool
+	caps := []byte{0x06, 0x00, 0xff, 0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x09, 0x20, 0x18, 0xc8, 0x81, 0x00, 0x38, 0x8e, 0x04, 0xb5}
+	resp, req, err = ipmiResponse(caps)
+	require.NoError(t, err)
+	require.Equal(t, ipmiRequest{Type: "get_channel_auth_caps", Role: 4}, req)
+	msg := resp[14:]
+	require.Equal(t, []byte{0x81, 0x1c, 0x63, 0x20, 0x00, 0x38, 0x00, 0x01, 0x97}, msg[:9])
+	require.Zero(t, ipmiChecksum(msg[:3]))
+	require.Zero(t, ipmiChecksum(msg[3:]))
+
+	// open session request followed by RAKP 1 for ADMIN
+	open := []byte{0x06, 0x00, 0xff, 0x07, 0x06, 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 32, 0}
+	open = append(open, 0x00, 0x04, 0x00, 0x00, 0x78, 0x56, 0x34, 0x12)
+	open = append(open, make([]byte, 24)...)
+	resp, req, err = ipmiResponse(open)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0x12345678), req.ConsoleSession)
+	require.Equal(t, byte(ipmiOpenSessionResponse), resp[5])
+	managed := binary.LittleEndian.Uint32(resp[24:])
+
+	rakp := []byte{0x06, 0x00, 0xff, 0x07, 0x06, 0x12, 0, 0, 0, 0, 0, 0, 0, 0, 33, 0}
+	rakp = append(rakp, 0x01, 0x00, 0x00, 0x00)
+	rakp = binary.LittleEndian.AppendUint32(rakp, managed)
+	rakp = append(rakp, make([]byte, 16)...)
+	rakp = append(rakp, 0x14, 0x00, 0x00, 0x05)
+	rakp = append(rakp, "ADMIN"...)
+	resp, req, err = ipmiResponse(rakp)
+	require.NoError(t, err)
+	require.Equal(t, "rakp1", req.Type)
+	require.Equal(t, "ADMIN", req.Username)
+	require.Equal(t, uint32(0x12345678), req.ConsoleSession)
+	require.Equal(t, byte(ipmiRAKP2), resp[5])
+	require.Len(t, resp, 16+60)
+	require.LessOrEqual(t, len(resp), maxAmplification*len(rakp))
+	require.Equal(t, ipmiRAKP2Code(0x12345678, managed, make([]byte, 16), 0x14, "ADMIN"), resp[56:])
+}
+
+func TestHandleIPMIUser(t *testing.T) {
+	creds := []string{}
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().ProduceUDP("ipmi", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(_ string, _, _ *net.UDPAddr, _ connection.Metadata, _ []byte, event interface{}) {
+			if _, ok := event.([]parsedIPMI); ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			require.NoError(t, err)
+			creds = append(creds, string(data))
+		}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("IPMI request", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	src := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9}
+	dst := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 623}
+
+	rakp := []byte{0x06, 0x00, 0xff, 0x07, 0x06, 0x12, 0, 0, 0, 0, 0, 0, 0, 0, 33, 0}
+	rakp = append(rakp, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	rakp = append(rakp, make([]byte, 16)...)
+	rakp = append(rakp, 0x14, 0x00, 0x00, 0x05)
+	rakp = append(rakp, "ADMIN"...)
+	require.NoError(t, HandleIPMI(context.Background(), src, dst, rakp, connection.Metadata{}, l, h))
+	require.Equal(t, []string{`{"event":"credential","protocol":"ipmi","username":"ADMIN","success":true}`}, creds)
+}
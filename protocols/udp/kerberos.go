@@ -0,0 +1,42 @@
+package udp
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// HandleKerberos answers AS-REQ and TGS-REQ messages with the errors of a
+// KDC, recording the requested principals and encryption types
+func HandleKerberos(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	resp, msg, err := helpers.KerberosResponse(data)
+	defer func() {
+		if err := h.ProduceUDP("kerberos", srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+		}
+	}()
+	if err != nil {
+		logger.Debug("Failed to parse Kerberos request", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+		return nil
+	}
+	logger.Info(
+		"Kerberos request",
+		slog.String("handler", "kerberos"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("type", msg.Type),
+		slog.String("realm", msg.Realm),
+		slog.String("client", msg.Client),
+		slog.String("service", msg.Service),
+		slog.String("encryption_types", strings.Join(msg.EncryptionTypes, ",")),
+	)
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send Kerberos response", slog.String("protocol", "kerberos"), producer.ErrAttr(err))
+	}
+	return nil
+}
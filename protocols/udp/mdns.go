@@ -0,0 +1,130 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	localNameTTL = 30
+	// mdnsUnicast is the top bit of the question class asking for a unicast
+	// answer, in answers the same bit flushes the cache
+	mdnsUnicast = 0x8000
+)
+
+// localNameResponse decodes an mDNS or LLMNR query and, when answer is set,
+// claims every A or AAAA name asked for with that address
+func localNameResponse(data []byte, answer net.IP) ([]byte, helpers.DNSMessage, error) {
+	query, err := helpers.DecodeDNS(data)
+	if err != nil {
+		return nil, helpers.DNSMessage{}, err
+	}
+	msg := helpers.DNSMessage{
+		ID:     query.ID,
+		Opcode: query.OpCode.String(),
+	}
+	for _, q := range query.Questions {
+		msg.Questions = append(msg.Questions, helpers.DNSQuestion{Name: string(q.Name), Type: q.Type.String()})
+	}
+	if query.QR {
+		return nil, msg, errors.New("not a name query")
+	}
+	if answer == nil || query.OpCode != layers.DNSOpCodeQuery {
+		return nil, msg, nil
+	}
+
+	resp := &layers.DNS{
+		ID:           query.ID,
+		QR:           true,
+		AA:           true,
+		OpCode:       query.OpCode,
+		ResponseCode: layers.DNSResponseCodeNoErr,
+		Questions:    query.Questions,
+	}
+	for _, q := range query.Questions {
+		record := layers.DNSResourceRecord{
+			Name:  q.Name,
+			Type:  q.Type,
+			Class: layers.DNSClass(uint16(q.Class) &^ mdnsUnicast),
+			TTL:   localNameTTL,
+		}
+		switch {
+		case q.Type == layers.DNSTypeA && answer.To4() != nil:
+			record.IP = answer.To4()
+		case q.Type == layers.DNSTypeAAAA && answer.To4() == nil:
+			record.IP = answer
+		default:
+			continue
+		}
+		resp.Answers = append(resp.Answers, record)
+		msg.Answers = append(msg.Answers, record.IP.String())
+	}
+	if len(resp.Answers) == 0 {
+		// both protocols stay silent for names they do not own
+		return nil, msg, nil
+	}
+	resp.QDCount = uint16(len(resp.Questions))
+	resp.ANCount = uint16(len(resp.Answers))
+	msg.RCode = resp.ResponseCode.String()
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := resp.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		return nil, msg, err
+	}
+	return buf.Bytes(), msg, nil
+}
+
+func handleLocalName(protocol string, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	var answer net.IP
+	if viper.GetBool(protocol + ".respond") {
+		answer = net.ParseIP(viper.GetString("dns.sinkhole"))
+	}
+	resp, msg, err := localNameResponse(data, answer)
+	defer func() {
+		if err := h.ProduceUDP(protocol, srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", protocol), producer.ErrAttr(err))
+		}
+	}()
+	if err != nil {
+		logger.Debug("Failed to parse name query", slog.String("protocol", protocol), producer.ErrAttr(err))
+		return nil
+	}
+	for _, q := range msg.Questions {
+		logger.Info(
+			"Name query",
+			slog.String("handler", protocol),
+			slog.String("src_ip", srcAddr.IP.String()),
+			slog.String("qname", q.Name),
+			slog.String("qtype", q.Type),
+		)
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send name response", slog.String("protocol", protocol), producer.ErrAttr(err))
+	}
+	return nil
+}
+
+// HandleMDNS records multicast DNS queries and, with mdns.respond set,
+// answers them with the dns.sinkhole address
+func HandleMDNS(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	return handleLocalName("mdns", srcAddr, dstAddr, data, md, logger, h)
+}
+
+// HandleLLMNR records LLMNR queries and, with llmnr.respond set, answers
+// them with the dns.sinkhole address the way poisoning responders do
+func HandleLLMNR(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	return handleLocalName("llmnr", srcAddr, dstAddr, data, md, logger, h)
+}
@@ -0,0 +1,64 @@
+package udp
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalNameResponse(t *testing.T) {
+	// an mDNS query for a WPAD host asking for a unicast answer
+	query := &layers.DNS{
+		QDCount:   1,
+		Questions: []layers.DNSQuestion{{Name: []byte("wpad.local"), Type: layers.DNSTypeA, Class: layers.DNSClass(0x8001)}},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, query.SerializeTo(buf, gopacket.SerializeOptions{}))
+
+	data, msg, err := localNameResponse(buf.Bytes(), nil)
+	require.NoError(t, err)
+	require.Nil(t, data)
+	require.Equal(t, "wpad.local", msg.Questions[0].Name)
+
+	data, msg, err = localNameResponse(buf.Bytes(), net.ParseIP("192.0.2.1"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.1"}, msg.Answers)
+	resp := &layers.DNS{}
+	require.NoError(t, resp.DecodeFromBytes(data, gopacket.NilDecodeFeedback))
+	require.True(t, resp.QR)
+	require.True(t, resp.AA)
+	require.Equal(t, layers.DNSClassIN, resp.Answers[0].Class)
+
+	// AAAA questions are left unanswered with an IPv4 address
+	query.Questions[0].Type = layers.DNSTypeAAAA
+	require.NoError(t, query.SerializeTo(buf, gopacket.SerializeOptions{}))
+	data, _, err = localNameResponse(buf.Bytes(), net.ParseIP("192.0.2.1"))
+	require.NoError(t, err)
+	require.Nil(t, data)
+}
+
+func TestHandleLocalNameMalformed(t *testing.T) {
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().ProduceUDP(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Debug(mock.Anything, mock.Anything, mock.Anything).Return()
+	src := &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 5353}
+
+	// questions gopacket fails to decode with a panic
+	mdns, err := hex.DecodeString("8e030300ff030fff4ee30044005200")
+	require.NoError(t, err)
+	llmnr, err := hex.DecodeString("32ff59ff04fff7ffff01d05500")
+	require.NoError(t, err)
+	require.NotPanics(t, func() {
+		require.NoError(t, HandleMDNS(context.Background(), src, src, mdns, connection.Metadata{}, l, h))
+		require.NoError(t, HandleLLMNR(context.Background(), src, src, llmnr, connection.Metadata{}, l, h))
+	})
+}
@@ -0,0 +1,288 @@
+package udp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	nbnsTypeNB     = 0x20
+	nbnsTypeNBSTAT = 0x21
+	nbnsGroup      = 0x8000
+	nbnsActive     = 0x0400
+	// nbnsStatistics is the size of the statistics block closing a node
+	// status answer, it starts with the adapter MAC address
+	nbnsStatistics = 46
+
+	nbdgmHeader = 14
+)
+
+var nbnsOpcodes = map[byte]string{0: "query", 5: "registration", 6: "release", 7: "wack", 8: "refresh", 9: "refresh"}
+
+var nbdgmTypes = map[byte]string{0x10: "direct_unique", 0x11: "direct_group", 0x12: "broadcast", 0x13: "error", 0x14: "query", 0x15: "positive_query", 0x16: "negative_query"}
+
+var browserCommands = map[byte]string{
+	1:  "host_announcement",
+	2:  "announcement_request",
+	8:  "request_election",
+	9:  "get_backup_list_request",
+	10: "get_backup_list_response",
+	11: "become_backup",
+	12: "domain_announcement",
+	13: "master_announcement",
+	14: "reset_state",
+	15: "local_master_announcement",
+}
+
+// nbnsMAC is reported in node status answers
+var nbnsMAC = []byte{0x00, 0x15, 0x5d, 0x3a, 0x1c, 0x07}
+
+type nbnsRequest struct {
+	Opcode string `json:"opcode"`
+	Name   string `json:"name"`
+	Suffix uint8  `json:"suffix"`
+	Type   string `json:"type"`
+}
+
+type parsedNBNS struct {
+	Direction string      `json:"direction,omitempty"`
+	Request   nbnsRequest `json:"request,omitempty"`
+	Payload   []byte      `json:"payload,omitempty"`
+}
+
+type nbdgmDatagram struct {
+	Type        string `json:"type"`
+	SourceIP    string `json:"source_ip,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Mailslot    string `json:"mailslot,omitempty"`
+	Command     string `json:"command,omitempty"`
+	ServerName  string `json:"server_name,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+// decodeNetBIOSName reverses the first level encoding of a NetBIOS name and
+// skips its scope labels, returning the name, its suffix and the rest
+func decodeNetBIOSName(data []byte) (string, byte, []byte, error) {
+	if len(data) < 34 || data[0] != 32 {
+		return "", 0, nil, errors.New("invalid NetBIOS name")
+	}
+	name := make([]byte, 16)
+	for i := range name {
+		high, low := data[1+2*i]-'A', data[2+2*i]-'A'
+		if high > 15 || low > 15 {
+			return "", 0, nil, errors.New("invalid NetBIOS name encoding")
+		}
+		name[i] = high<<4 | low
+	}
+	rest := data[33:]
+	for {
+		if len(rest) < 1 {
+			return "", 0, nil, errors.New("truncated NetBIOS scope")
+		}
+		size := int(rest[0])
+		if size == 0 {
+			rest = rest[1:]
+			break
+		}
+		if len(rest) < 1+size {
+			return "", 0, nil, errors.New("truncated NetBIOS scope")
+		}
+		rest = rest[1+size:]
+	}
+	return strings.TrimRight(string(name[:15]), " \x00"), name[15], rest, nil
+}
+
+// netbiosName pads a name to the 16 byte form ending in the suffix
+func netbiosName(name string, suffix byte) []byte {
+	padded := []byte(strings.ToUpper(name) + strings.Repeat(" ", 15))[:15]
+	return append(padded, suffix)
+}
+
+// nbnsResponse answers node status requests with the configured computer and
+// workgroup names. Name queries, registrations and releases are only
+// recorded as answering them would claim names on the network.
+func nbnsResponse(data []byte) ([]byte, nbnsRequest, error) {
+	if len(data) < 12 {
+		return nil, nbnsRequest{}, errors.New("NBNS packet too short")
+	}
+	flags := binary.BigEndian.Uint16(data[2:])
+	req := nbnsRequest{Opcode: nbnsOpcodes[byte(flags>>11)&0x0f]}
+	if flags&0x8000 != 0 {
+		return nil, req, errors.New("not an NBNS request")
+	}
+	if binary.BigEndian.Uint16(data[4:]) < 1 {
+		return nil, req, errors.New("NBNS request without question")
+	}
+	name, suffix, rest, err := decodeNetBIOSName(data[12:])
+	if err != nil {
+		return nil, req, err
+	}
+	if len(rest) < 4 {
+		return nil, req, errors.New("truncated NBNS question")
+	}
+	req.Name, req.Suffix = name, suffix
+	switch binary.BigEndian.Uint16(rest) {
+	case nbnsTypeNB:
+		req.Type = "NB"
+	case nbnsTypeNBSTAT:
+		req.Type = "NBSTAT"
+	default:
+		req.Type = "other"
+	}
+	if req.Opcode != "query" || req.Type != "NBSTAT" {
+		return nil, req, nil
+	}
+
+	question := data[12 : len(data)-len(rest)]
+	resp := append([]byte{}, data[:2]...)
+	resp = append(resp, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00)
+	resp = append(resp, question...)
+	resp = append(resp, 0x00, nbnsTypeNBSTAT, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00)
+
+	names := []byte{2}
+	names = append(names, netbiosName(viper.GetString("netbios.name"), 0x00)...)
+	names = binary.BigEndian.AppendUint16(names, nbnsActive)
+	names = append(names, netbiosName(viper.GetString("netbios.workgroup"), 0x00)...)
+	names = binary.BigEndian.AppendUint16(names, nbnsActive|nbnsGroup)
+	names = append(names, nbnsMAC...)
+	names = append(names, make([]byte, nbnsStatistics-len(nbnsMAC))...)
+
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(names)))
+	return append(resp, names...), req, nil
+}
+
+// parseBrowser decodes a browser announcement carried in an SMB mailslot
+// transaction
+func parseBrowser(smb []byte, dgm *nbdgmDatagram) error {
+	if len(smb) < 33 || !bytes.Equal(smb[:4], []byte("\xffSMB")) || smb[4] != 0x25 {
+		return errors.New("not an SMB transaction")
+	}
+	words := int(smb[32])
+	if words < 14 || len(smb) < 33+2*words+2 {
+		return errors.New("truncated SMB transaction")
+	}
+	word := func(i int) int { return int(binary.LittleEndian.Uint16(smb[33+2*i:])) }
+	dataCount, dataOffset := word(11), word(12)
+
+	payload := smb[33+2*words+2:]
+	if name, _, ok := bytes.Cut(payload, []byte{0}); ok {
+		dgm.Mailslot = string(name)
+	}
+	if dataOffset+dataCount > len(smb) || dataCount < 1 {
+		return errors.New("SMB transaction data out of range")
+	}
+	data := smb[dataOffset : dataOffset+dataCount]
+	dgm.Command = browserCommands[data[0]]
+	switch data[0] {
+	case 1, 12, 15:
+		// opcode, update count, periodicity, server name, version, type,
+		// browser version, signature and comment
+		if len(data) < 32 {
+			return nil
+		}
+		dgm.ServerName = strings.TrimRight(string(data[6:22]), "\x00 ")
+		if comment, _, ok := bytes.Cut(data[32:], []byte{0}); ok {
+			dgm.Comment = string(comment)
+		}
+	}
+	return nil
+}
+
+// parseNBDatagram decodes the datagram header and the source and
+// destination names of direct and broadcast datagrams
+func parseNBDatagram(data []byte) (nbdgmDatagram, error) {
+	if len(data) < nbdgmHeader {
+		return nbdgmDatagram{}, errors.New("NetBIOS datagram too short")
+	}
+	dgm := nbdgmDatagram{
+		Type:     nbdgmTypes[data[0]],
+		SourceIP: net.IP(data[4:8]).String(),
+	}
+	if data[0] < 0x10 || data[0] > 0x12 {
+		return dgm, nil
+	}
+	source, suffix, rest, err := decodeNetBIOSName(data[nbdgmHeader:])
+	if err != nil {
+		return dgm, err
+	}
+	dgm.Source = fmt.Sprintf("%s<%02X>", source, suffix)
+	destination, suffix, rest, err := decodeNetBIOSName(rest)
+	if err != nil {
+		return dgm, err
+	}
+	dgm.Destination = fmt.Sprintf("%s<%02X>", destination, suffix)
+	return dgm, parseBrowser(rest, &dgm)
+}
+
+// HandleNBNS decodes NetBIOS name service packets and answers node status
+// requests like a Windows file server
+func HandleNBNS(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedNBNS{}
+	defer func() {
+		if err := h.ProduceUDP("nbns", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "nbns"), producer.ErrAttr(err))
+		}
+	}()
+
+	resp, req, err := nbnsResponse(data)
+	if err != nil {
+		logger.Debug("Failed to parse NBNS packet", slog.String("protocol", "nbns"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, parsedNBNS{Direction: "read", Request: req, Payload: data})
+	logger.Info(
+		"NBNS request",
+		slog.String("handler", "nbns"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("opcode", req.Opcode),
+		slog.String("name", req.Name),
+		slog.Int("suffix", int(req.Suffix)),
+		slog.String("type", req.Type),
+	)
+	if resp == nil {
+		return nil
+	}
+
+	events = append(events, parsedNBNS{Direction: "write", Request: req, Payload: resp})
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send NBNS response", slog.String("protocol", "nbns"), producer.ErrAttr(err))
+	}
+	return nil
+}
+
+// HandleNBDatagram decodes NetBIOS datagrams and the browser announcements
+// they carry, nothing is sent back
+func HandleNBDatagram(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	dgm, err := parseNBDatagram(data)
+	defer func() {
+		if err := h.ProduceUDP("nbdgm", srcAddr, dstAddr, md, data, dgm); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "nbdgm"), producer.ErrAttr(err))
+		}
+	}()
+	if err != nil {
+		logger.Debug("Failed to parse NetBIOS datagram", slog.String("protocol", "nbdgm"), producer.ErrAttr(err))
+	}
+	logger.Info(
+		"NetBIOS datagram",
+		slog.String("handler", "nbdgm"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("type", dgm.Type),
+		slog.String("source", dgm.Source),
+		slog.String("destination", dgm.Destination),
+		slog.String("command", dgm.Command),
+		slog.String("server_name", dgm.ServerName),
+	)
+	return nil
+}
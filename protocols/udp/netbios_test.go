@@ -0,0 +1,80 @@
+package udp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeNetBIOSName(name []byte) []byte {
+	encoded := []byte{32}
+	for _, b := range name {
+		encoded = append(encoded, 'A'+b>>4, 'A'+b&0x0f)
+	}
+	return append(encoded, 0)
+}
+
+func TestNBNSResponse(t *testing.T) {
+	viper.Set("netbios.name", "filesrv01")
+	viper.Set("netbios.workgroup", "CORP")
+	defer viper.Reset()
+
+	// node status request for "*" as sent by nbtscan
+	query := []byte{0x12, 0x34, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	query = append(query, encodeNetBIOSName(append([]byte("*"), make([]byte, 15)...))...)
+	query = append(query, 0x00, 0x21, 0x00, 0x01)
+
+	resp, req, err := nbnsResponse(query)
+	require.NoError(t, err)
+	require.Equal(t, nbnsRequest{Opcode: "query", Name: "*", Suffix: 0, Type: "NBSTAT"}, req)
+	require.Equal(t, []byte{0x12, 0x34, 0x84, 0x00}, resp[:4])
+	require.Equal(t, "FILESRV01      \x00", string(resp[57:73]))
+	require.Equal(t, "CORP           \x00", string(resp[75:91]))
+	require.LessOrEqual(t, len(resp), maxAmplification*len(query))
+
+	// name queries are recorded but not answered
+	query[len(query)-3] = 0x20
+	resp, req, err = nbnsResponse(query)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+	require.Equal(t, "NB", req.Type)
+}
+
+func TestParseNBDatagram(t *testing.T) {
+	announcement := []byte{1, 0, 0x60, 0xea, 0, 0}
+	announcement = append(announcement, []byte("WS-042\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")...)
+	announcement = append(announcement, 10, 0, 0x03, 0x10, 0x00, 0x00, 0x0f, 0x01, 0x55, 0xaa)
+	announcement = append(announcement, []byte("finance pc\x00")...)
+
+	smb := append([]byte("\xffSMB\x25"), make([]byte, 27)...)
+	smb = append(smb, 17)
+	words := make([]byte, 34)
+	mailslot := []byte("\\MAILSLOT\\BROWSE\x00")
+	dataOffset := len(smb) + len(words) + 2 + len(mailslot)
+	binary.LittleEndian.PutUint16(words[22:], uint16(len(announcement)))
+	binary.LittleEndian.PutUint16(words[24:], uint16(dataOffset))
+	smb = append(smb, words...)
+	smb = binary.LittleEndian.AppendUint16(smb, uint16(len(mailslot)+len(announcement)))
+	smb = append(smb, mailslot...)
+	smb = append(smb, announcement...)
+
+	data := []byte{0x11, 0x02, 0x00, 0x01, 10, 0, 0, 42, 0x00, 0x8a, 0x00, 0x00, 0x00, 0x00}
+	data = append(data, encodeNetBIOSName([]byte("WS-042         \x00"))...)
+	data = append(data, encodeNetBIOSName([]byte("CORP           \x1d"))...)
+	data = append(data, smb...)
+
+	dgm, err := parseNBDatagram(data)
+	require.NoError(t, err)
+	require.Equal(t, nbdgmDatagram{
+		Type:        "direct_group",
+		SourceIP:    "10.0.0.42",
+		Source:      "WS-042<00>",
+		Destination: "CORP<1D>",
+		Mailslot:    "\\MAILSLOT\\BROWSE",
+		Command:     "host_announcement",
+		ServerName:  "WS-042",
+		Comment:     "finance pc",
+	}, dgm)
+}
@@ -0,0 +1,138 @@
+package udp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	ntpPacketLen     = 48
+	ntpModeClient    = 3
+	ntpModeServer    = 4
+	ntpModeControl   = 6
+	ntpModePrivate   = 7
+	ntpMonlist       = 42
+	ntpMonlistLegacy = 20
+	// seconds between the NTP epoch (1900) and the Unix epoch
+	ntpEpochOffset = 2208988800
+)
+
+type ntpRequest struct {
+	Version int `json:"version"`
+	Mode    int `json:"mode"`
+	// control message opcode for mode 6
+	Opcode int `json:"opcode,omitempty"`
+	// implementation specific request code for mode 7
+	RequestCode int  `json:"request_code,omitempty"`
+	Monlist     bool `json:"monlist,omitempty"`
+}
+
+type parsedNTP struct {
+	Direction string     `json:"direction,omitempty"`
+	Request   ntpRequest `json:"request,omitempty"`
+	Payload   []byte     `json:"payload,omitempty"`
+}
+
+func parseNTP(data []byte) (ntpRequest, error) {
+	req := ntpRequest{}
+	if len(data) < 4 {
+		return req, errors.New("NTP packet too short")
+	}
+	req.Version = int(data[0]>>3) & 0x7
+	req.Mode = int(data[0] & 0x7)
+	switch req.Mode {
+	case ntpModeControl:
+		req.Opcode = int(data[1] & 0x1f)
+	case ntpModePrivate:
+		req.RequestCode = int(data[3])
+		req.Monlist = req.RequestCode == ntpMonlist || req.RequestCode == ntpMonlistLegacy
+	}
+	return req, nil
+}
+
+func ntpTimestamp(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// ntpResponse creates a stratum 2 server reply to a client request received
+// at recv
+func ntpResponse(req []byte, recv time.Time) []byte {
+	resp := make([]byte, ntpPacketLen)
+	// no leap warning, the client's version and server mode
+	resp[0] = req[0]&0x38 | ntpModeServer
+	resp[1] = 2                                          // stratum
+	resp[2] = req[2]                                     // poll interval
+	resp[3] = 0xe9                                       // precision, about 2^-23 seconds
+	binary.BigEndian.PutUint32(resp[4:], 0x00000a3c)     // root delay
+	binary.BigEndian.PutUint32(resp[8:], 0x00000b12)     // root dispersion
+	copy(resp[12:16], net.IPv4(192, 36, 143, 130).To4()) // reference ID of the upstream server
+	binary.BigEndian.PutUint64(resp[16:], ntpTimestamp(recv.Add(-17*time.Minute)))
+	// originate timestamp is the client's transmit timestamp
+	copy(resp[24:32], req[40:48])
+	binary.BigEndian.PutUint64(resp[32:], ntpTimestamp(recv))
+	binary.BigEndian.PutUint64(resp[40:], ntpTimestamp(time.Now()))
+	return resp
+}
+
+// HandleNTP answers NTP client requests and tags mode 6 and 7 probes used to
+// find amplifiers
+func HandleNTP(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	recv := time.Now()
+	events := []parsedNTP{}
+	defer func() {
+		if err := h.ProduceUDP("ntp", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "ntp"), producer.ErrAttr(err))
+		}
+	}()
+
+	req, err := parseNTP(data)
+	if err != nil {
+		logger.Debug("Failed to parse NTP packet", slog.String("protocol", "ntp"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, parsedNTP{
+		Direction: "read",
+		Request:   req,
+		Payload:   data,
+	})
+
+	switch req.Mode {
+	case ntpModeControl, ntpModePrivate:
+		md.Tags = append(md.Tags, "ntp_amplification")
+		logger.Info(
+			"NTP amplification probe",
+			slog.String("handler", "ntp"),
+			slog.String("src_ip", srcAddr.IP.String()),
+			slog.Int("mode", req.Mode),
+			slog.Int("opcode", req.Opcode),
+			slog.Int("request_code", req.RequestCode),
+			slog.Bool("monlist", req.Monlist),
+		)
+		// never answered, we are not going to be the amplifier
+		return nil
+	case ntpModeClient:
+		if len(data) < ntpPacketLen {
+			return nil
+		}
+		resp := ntpResponse(data, recv)
+		events = append(events, parsedNTP{
+			Direction: "write",
+			Request:   req,
+			Payload:   resp,
+		})
+		if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+			logger.Debug("Failed to send NTP response", slog.String("protocol", "ntp"), producer.ErrAttr(err))
+		}
+	}
+	return nil
+}
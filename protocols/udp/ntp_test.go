@@ -0,0 +1,38 @@
+package udp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNTP(t *testing.T) {
+	// ntpdc -c monlist sends a mode 7 request with request code 42
+	req, err := parseNTP([]byte{0x17, 0x00, 0x03, 0x2a, 0x00, 0x00, 0x00, 0x00})
+	require.NoError(t, err)
+	require.Equal(t, ntpModePrivate, req.Mode)
+	require.True(t, req.Monlist)
+
+	req, err = parseNTP([]byte{0x16, 0x02, 0x00, 0x01})
+	require.NoError(t, err)
+	require.Equal(t, ntpModeControl, req.Mode)
+	require.Equal(t, 2, req.Opcode)
+
+	_, err = parseNTP([]byte{0x1b})
+	require.Error(t, err)
+}
+
+func TestNTPResponse(t *testing.T) {
+	client := make([]byte, ntpPacketLen)
+	client[0] = 0x23 // version 4, client mode
+	binary.BigEndian.PutUint64(client[40:], 0xdeadbeefcafebabe)
+
+	now := time.Now()
+	resp := ntpResponse(client, now)
+	require.Len(t, resp, ntpPacketLen)
+	require.Equal(t, byte(0x24), resp[0])
+	require.Equal(t, uint64(0xdeadbeefcafebabe), binary.BigEndian.Uint64(resp[24:]))
+	require.Equal(t, uint64(now.Unix()+ntpEpochOffset), binary.BigEndian.Uint64(resp[32:])>>32)
+}
@@ -0,0 +1,374 @@
+package udp
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	quicMaxConnectionID = 20
+	// quicFlowTimeout bounds how long the CRYPTO data of a ClientHello
+	// spanning several Initial packets is kept
+	quicFlowTimeout = 10 * time.Second
+	quicMaxFlows    = 1024
+)
+
+type quicVersion struct {
+	name        string
+	salt        []byte
+	labelPrefix string
+	initialType byte
+}
+
+// quicVersions are the versions with known Initial secrets, everything else
+// gets a version negotiation
+var quicVersions = map[uint32]quicVersion{
+	0x00000001: {"1", mustHex("38762cf7f55934b34d179ae6a4c80cadccbb7f0a"), "quic ", 0},
+	0x6b3343cf: {"2", mustHex("0dede3def700a6db819381be6e269dcbf9bd2ed9"), "quicv2 ", 1},
+	0xff00001d: {"draft-29", mustHex("afbfec289993d24c9e9786f19c6111e04390a899"), "quic ", 0},
+}
+
+func mustHex(s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+type parsedQUIC struct {
+	Version    string   `json:"version"`
+	DCID       string   `json:"dcid,omitempty"`
+	SCID       string   `json:"scid,omitempty"`
+	ServerName string   `json:"server_name,omitempty"`
+	ALPN       []string `json:"alpn,omitempty"`
+	JA4        string   `json:"ja4,omitempty"`
+	// Complete is set once the whole ClientHello was reassembled
+	Complete bool `json:"complete"`
+}
+
+// quicInitial is a decrypted Initial packet
+type quicInitial struct {
+	version uint32
+	dcid    []byte
+	scid    []byte
+	frames  []byte
+}
+
+func quicVarInt(data []byte) (uint64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	size := 1 << (data[0] >> 6)
+	if len(data) < size {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	value := uint64(data[0] & 0x3f)
+	for _, b := range data[1:size] {
+		value = value<<8 | uint64(b)
+	}
+	return value, size, nil
+}
+
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+	out := make([]byte, length)
+	_, _ = io.ReadFull(hkdf.Expand(sha256.New, secret, info), out)
+	return out
+}
+
+// quicClientKeys derives the key, IV and header protection key protecting
+// the client's Initial packets, all anyone who saw the DCID can compute
+func quicClientKeys(v quicVersion, dcid []byte) ([]byte, []byte, []byte) {
+	initial := hkdf.Extract(sha256.New, dcid, v.salt)
+	client := hkdfExpandLabel(initial, "client in", sha256.Size)
+	return hkdfExpandLabel(client, v.labelPrefix+"key", 16),
+		hkdfExpandLabel(client, v.labelPrefix+"iv", 12),
+		hkdfExpandLabel(client, v.labelPrefix+"hp", 16)
+}
+
+var errQUICVersion = errors.New("unsupported QUIC version")
+
+// decryptQUICInitial removes the protection of the first packet in data if
+// it is a client Initial, returning it and what follows it in the datagram
+func decryptQUICInitial(data []byte) (*quicInitial, []byte, error) {
+	if len(data) < 7 || data[0]&0x80 == 0 {
+		return nil, nil, errors.New("not a QUIC long header packet")
+	}
+	packet := &quicInitial{version: binary.BigEndian.Uint32(data[1:])}
+	offset := 5
+	for _, id := range []*[]byte{&packet.dcid, &packet.scid} {
+		if len(data) <= offset || data[offset] > quicMaxConnectionID || len(data) < offset+1+int(data[offset]) {
+			return nil, nil, errors.New("invalid QUIC connection ID")
+		}
+		*id = data[offset+1 : offset+1+int(data[offset])]
+		offset += 1 + int(data[offset])
+	}
+	v, ok := quicVersions[packet.version]
+	if !ok {
+		return packet, nil, errQUICVersion
+	}
+	if (data[0]>>4)&0x03 != v.initialType {
+		return nil, nil, errors.New("not a QUIC Initial packet")
+	}
+	tokenLength, n, err := quicVarInt(data[offset:])
+	if err != nil || uint64(len(data)) < uint64(offset+n)+tokenLength {
+		return nil, nil, errors.New("invalid QUIC token")
+	}
+	offset += n + int(tokenLength)
+	length, n, err := quicVarInt(data[offset:])
+	if err != nil || uint64(len(data)) < uint64(offset+n)+length {
+		return nil, nil, errors.New("invalid QUIC packet length")
+	}
+	offset += n
+	end := offset + int(length)
+	if end < offset+20 {
+		return nil, nil, errors.New("QUIC packet too short")
+	}
+
+	key, iv, hp := quicClientKeys(v, packet.dcid)
+	block, err := aes.NewCipher(hp)
+	if err != nil {
+		return nil, nil, err
+	}
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, data[offset+4:offset+4+aes.BlockSize])
+	header := append([]byte{}, data[:offset+4]...)
+	header[0] ^= mask[0] & 0x0f
+	pnLength := int(header[0]&0x03) + 1
+	header = header[:offset+pnLength]
+	for i := range pnLength {
+		header[offset+i] ^= mask[1+i]
+		iv[len(iv)-pnLength+i] ^= header[offset+i]
+	}
+
+	block, err = aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	if packet.frames, err = aead.Open(nil, iv, data[offset+pnLength:end], header); err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt QUIC Initial: %w", err)
+	}
+	return packet, data[end:], nil
+}
+
+// quicCryptoFrames collects the CRYPTO frames of a decrypted packet by their
+// offset, skipping padding, pings and acknowledgements
+func quicCryptoFrames(frames []byte, chunks map[uint64][]byte) error {
+	for len(frames) > 0 {
+		frameType, n, err := quicVarInt(frames)
+		if err != nil {
+			return err
+		}
+		frames = frames[n:]
+		fields := 0
+		switch frameType {
+		case 0x00, 0x01:
+			continue
+		case 0x02, 0x03:
+			// largest acknowledged, delay, range count and first range
+			values := make([]uint64, 4)
+			for i := range values {
+				if values[i], n, err = quicVarInt(frames); err != nil {
+					return err
+				}
+				frames = frames[n:]
+			}
+			fields = int(values[2]) * 2
+			if frameType == 0x03 {
+				fields += 3
+			}
+		case 0x06:
+			offset, n, err := quicVarInt(frames)
+			if err != nil {
+				return err
+			}
+			frames = frames[n:]
+			length, n, err := quicVarInt(frames)
+			if err != nil || uint64(len(frames)-n) < length {
+				return errors.New("invalid QUIC CRYPTO frame")
+			}
+			chunks[offset] = frames[n : n+int(length)]
+			frames = frames[n+int(length):]
+			continue
+		default:
+			return fmt.Errorf("unexpected QUIC frame type %d", frameType)
+		}
+		for range fields {
+			if _, n, err = quicVarInt(frames); err != nil {
+				return err
+			}
+			frames = frames[n:]
+		}
+	}
+	return nil
+}
+
+type quicFlow struct {
+	chunks map[uint64][]byte
+	seen   time.Time
+}
+
+// quicAssembler puts ClientHellos spanning several Initial packets back
+// together, flows are keyed by the DCID the client chose
+type quicAssembler struct {
+	flows map[string]*quicFlow
+	mtx   sync.Mutex
+}
+
+var quicFlows = &quicAssembler{flows: map[string]*quicFlow{}}
+
+// add stores the chunks of dcid and returns the CRYPTO stream assembled
+// from offset 0 on as far as it is contiguous
+func (a *quicAssembler) add(dcid []byte, chunks map[uint64][]byte, now time.Time) []byte {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	for id, flow := range a.flows {
+		if now.Sub(flow.seen) > quicFlowTimeout {
+			delete(a.flows, id)
+		}
+	}
+	flow, ok := a.flows[string(dcid)]
+	if !ok {
+		if len(a.flows) >= quicMaxFlows {
+			return nil
+		}
+		flow = &quicFlow{chunks: map[uint64][]byte{}}
+		a.flows[string(dcid)] = flow
+	}
+	flow.seen = now
+	for offset, chunk := range chunks {
+		flow.chunks[offset] = append([]byte{}, chunk...)
+	}
+
+	offsets := make([]uint64, 0, len(flow.chunks))
+	for offset := range flow.chunks {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	stream := []byte{}
+	for _, offset := range offsets {
+		if offset > uint64(len(stream)) {
+			break
+		}
+		if end := offset + uint64(len(flow.chunks[offset])); end > uint64(len(stream)) {
+			stream = append(stream, flow.chunks[offset][uint64(len(stream))-offset:]...)
+		}
+	}
+	return stream
+}
+
+func (a *quicAssembler) done(dcid []byte) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	delete(a.flows, string(dcid))
+}
+
+// quicVersionNegotiation lists the versions we know for a client that
+// offered another one, scanners use this to find QUIC endpoints
+func quicVersionNegotiation(packet *quicInitial) []byte {
+	first := make([]byte, 1)
+	_, _ = rand.Read(first)
+	resp := []byte{first[0] | 0x80, 0, 0, 0, 0}
+	resp = append(append(resp, byte(len(packet.scid))), packet.scid...)
+	resp = append(append(resp, byte(len(packet.dcid))), packet.dcid...)
+	for _, version := range []uint32{0x00000001, 0x6b3343cf} {
+		resp = binary.BigEndian.AppendUint32(resp, version)
+	}
+	return resp
+}
+
+// HandleQUIC decrypts the Initial packets of QUIC clients to record the SNI
+// and ALPN of their ClientHello. Connections are never completed.
+func HandleQUIC(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	msg := parsedQUIC{}
+	defer func() {
+		if err := h.ProduceUDP("quic", srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "quic"), producer.ErrAttr(err))
+		}
+	}()
+
+	packet, rest, err := decryptQUICInitial(data)
+	if packet != nil {
+		msg.Version = fmt.Sprintf("%#08x", packet.version)
+		msg.DCID, msg.SCID = hex.EncodeToString(packet.dcid), hex.EncodeToString(packet.scid)
+	}
+	if errors.Is(err, errQUICVersion) && packet.version != 0 {
+		if err := sendResponse(srcAddr, dstAddr, data, quicVersionNegotiation(packet)); err != nil {
+			logger.Debug("Failed to send QUIC version negotiation", slog.String("protocol", "quic"), producer.ErrAttr(err))
+		}
+		return nil
+	}
+	if err != nil {
+		logger.Debug("Failed to decrypt QUIC packet", slog.String("protocol", "quic"), producer.ErrAttr(err))
+		return nil
+	}
+	msg.Version = quicVersions[packet.version].name
+
+	chunks := map[uint64][]byte{}
+	for {
+		if err := quicCryptoFrames(packet.frames, chunks); err != nil {
+			logger.Debug("Failed to parse QUIC frames", slog.String("protocol", "quic"), producer.ErrAttr(err))
+		}
+		// further Initial packets may be coalesced into the datagram
+		if len(rest) == 0 {
+			break
+		}
+		next, remaining, err := decryptQUICInitial(rest)
+		if err != nil {
+			break
+		}
+		packet.frames, rest = next.frames, remaining
+	}
+
+	stream := quicFlows.add(packet.dcid, chunks, time.Now())
+	length := helpers.ClientHelloLength(stream)
+	if length == 0 || len(stream) < length {
+		return nil
+	}
+	quicFlows.done(packet.dcid)
+	hello, err := helpers.ParseClientHello(stream[:length])
+	if err != nil {
+		logger.Debug("Failed to parse QUIC ClientHello", slog.String("protocol", "quic"), producer.ErrAttr(err))
+		return nil
+	}
+	msg.ServerName, msg.ALPN, msg.Complete = hello.ServerName, hello.ALPN, true
+	msg.JA4 = hello.JA4(helpers.JA4QUIC)
+	logger.Info(
+		"QUIC ClientHello",
+		slog.String("handler", "quic"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("version", msg.Version),
+		slog.String("server_name", msg.ServerName),
+		slog.Any("alpn", msg.ALPN),
+		slog.String("ja4", msg.JA4),
+	)
+	return nil
+}
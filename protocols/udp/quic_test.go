@@ -0,0 +1,145 @@
+package udp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+// testClientHello captures the ClientHello handshake message crypto/tls
+// sends for serverName
+func testClientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: serverName, NextProtos: []string{"h3"}}).Handshake()
+	}()
+	record := make([]byte, 5)
+	_, err := io.ReadFull(server, record)
+	require.NoError(t, err)
+	msg := make([]byte, binary.BigEndian.Uint16(record[3:]))
+	_, err = io.ReadFull(server, msg)
+	require.NoError(t, err)
+	client.Close()
+	return msg
+}
+
+// testQUICInitial protects a version 1 Initial packet carrying frames
+func testQUICInitial(t *testing.T, dcid, frames []byte) []byte {
+	key, iv, hp := quicClientKeys(quicVersions[1], dcid)
+	header := []byte{0xc0 | 0x01, 0, 0, 0, 1, byte(len(dcid))}
+	header = append(header, dcid...)
+	header = append(header, 0, 0)
+	// 2 byte length, 2 byte packet number 7
+	header = binary.BigEndian.AppendUint16(header, uint16(0x4000|(2+len(frames)+16)))
+	pnOffset := len(header)
+	header = append(header, 0, 7)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	iv[len(iv)-1] ^= 7
+	packet := aead.Seal(append([]byte{}, header...), iv, frames, header)
+
+	block, err = aes.NewCipher(hp)
+	require.NoError(t, err)
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, packet[pnOffset+4:pnOffset+4+aes.BlockSize])
+	packet[0] ^= mask[0] & 0x0f
+	packet[pnOffset] ^= mask[1]
+	packet[pnOffset+1] ^= mask[2]
+	return packet
+}
+
+func testCryptoFrame(offset int, data []byte) []byte {
+	frame := []byte{0x06}
+	frame = binary.BigEndian.AppendUint32(frame, 0x80000000|uint32(offset))
+	frame = binary.BigEndian.AppendUint16(frame, 0x4000|uint16(len(data)))
+	return append(frame, data...)
+}
+
+func TestQUICClientKeys(t *testing.T) {
+	// RFC 9001, appendix A.1
+	key, iv, hp := quicClientKeys(quicVersions[1], []byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08})
+	require.Equal(t, "1f369613dd76d5467730efcbe3b1a22d", hex.EncodeToString(key))
+	require.Equal(t, "fa044b2f42a3fd3b46fb255c", hex.EncodeToString(iv))
+	require.Equal(t, "9f50449e04a0e810283a1e9933adedd2", hex.EncodeToString(hp))
+}
+
+func TestQUICInitial(t *testing.T) {
+	hello := testClientHello(t, "vpn.example.com")
+	dcid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	half := len(hello) / 2
+	// the second half arrives first, with a ping and padding around it
+	frames := append([]byte{0x01}, testCryptoFrame(half, hello[half:])...)
+	frames = append(frames, make([]byte, 32)...)
+
+	packet, rest, err := decryptQUICInitial(testQUICInitial(t, dcid, frames))
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Equal(t, dcid, packet.dcid)
+	require.Equal(t, frames, packet.frames)
+
+	assembler := &quicAssembler{flows: map[string]*quicFlow{}}
+	chunks := map[uint64][]byte{}
+	require.NoError(t, quicCryptoFrames(packet.frames, chunks))
+	require.Empty(t, assembler.add(dcid, chunks, time.Now()))
+
+	packet, _, err = decryptQUICInitial(testQUICInitial(t, dcid, testCryptoFrame(0, hello[:half])))
+	require.NoError(t, err)
+	chunks = map[uint64][]byte{}
+	require.NoError(t, quicCryptoFrames(packet.frames, chunks))
+	stream := assembler.add(dcid, chunks, time.Now())
+	require.Equal(t, hello, stream)
+
+	parsed, err := helpers.ParseClientHello(stream[:helpers.ClientHelloLength(stream)])
+	require.NoError(t, err)
+	require.Equal(t, "vpn.example.com", parsed.ServerName)
+	require.Equal(t, []string{"h3"}, parsed.ALPN)
+}
+
+func TestQUICVersionNegotiation(t *testing.T) {
+	data := []byte{0xc0, 0x1a, 0x2a, 0x3a, 0x4a, 2, 0xaa, 0xbb, 1, 0xcc}
+	packet, _, err := decryptQUICInitial(data)
+	require.ErrorIs(t, err, errQUICVersion)
+	resp := quicVersionNegotiation(packet)
+	require.Equal(t, []byte{0, 0, 0, 0, 1, 0xcc, 2, 0xaa, 0xbb, 0, 0, 0, 1}, resp[1:14])
+}
+
+func TestQUICInitialFullSize(t *testing.T) {
+	// clients pad their Initials to at least 1200 bytes
+	hello := testClientHello(t, "vpn.example.com")
+	frames := testCryptoFrame(0, hello)
+	frames = append(frames, make([]byte, 1200-len(frames))...)
+	initial := testQUICInitial(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, frames)
+	require.Greater(t, len(initial), 1200)
+
+	ln, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer ln.Close()
+	client, err := net.DialUDP("udp", nil, ln.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write(initial)
+	require.NoError(t, err)
+
+	buffer := make([]byte, MaxDatagramSize)
+	n, err := ln.Read(buffer)
+	require.NoError(t, err)
+	packet, _, err := decryptQUICInitial(buffer[:n])
+	require.NoError(t, err)
+	require.Equal(t, frames, packet.frames)
+
+	_, _, err = decryptQUICInitial(initial[:1024])
+	require.Error(t, err, "a truncated Initial fails to decrypt")
+}
@@ -0,0 +1,189 @@
+package udp
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"unicode"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+const (
+	radiusAccessRequest = 1
+	radiusAccessReject  = 3
+	radiusHeader        = 20
+
+	radiusUserName         = 1
+	radiusUserPassword     = 2
+	radiusCHAPPassword     = 3
+	radiusNASIPAddress     = 4
+	radiusReplyMessage     = 18
+	radiusCallingStationID = 31
+	radiusNASIdentifier    = 32
+)
+
+var radiusCodes = map[byte]string{1: "access_request", 4: "accounting_request", 12: "status_server", 40: "disconnect_request", 43: "coa_request"}
+
+type radiusRequest struct {
+	Code           string `json:"code"`
+	Identifier     uint8  `json:"identifier"`
+	UserName       string `json:"user_name,omitempty"`
+	Password       string `json:"password,omitempty"`
+	Secret         string `json:"secret,omitempty"`
+	CHAP           bool   `json:"chap,omitempty"`
+	NASIPAddress   string `json:"nas_ip_address,omitempty"`
+	NASIdentifier  string `json:"nas_identifier,omitempty"`
+	CallingStation string `json:"calling_station_id,omitempty"`
+}
+
+type parsedRADIUS struct {
+	Direction string        `json:"direction,omitempty"`
+	Request   radiusRequest `json:"request,omitempty"`
+	Payload   []byte        `json:"payload,omitempty"`
+}
+
+// radiusAttributes splits the attribute list into values keyed by type, only
+// the first occurrence of each type is kept
+func radiusAttributes(data []byte) (map[byte][]byte, error) {
+	attrs := map[byte][]byte{}
+	for len(data) > 0 {
+		if len(data) < 2 || data[1] < 2 || int(data[1]) > len(data) {
+			return nil, errors.New("invalid RADIUS attribute")
+		}
+		if _, ok := attrs[data[0]]; !ok {
+			attrs[data[0]] = data[2:data[1]]
+		}
+		data = data[data[1]:]
+	}
+	return attrs, nil
+}
+
+// radiusDecryptPassword reverses the User-Password hiding of RFC 2865, a
+// wrong secret shows up as binary garbage and is reported as not ok
+func radiusDecryptPassword(hidden, authenticator []byte, secret string) (string, bool) {
+	if len(hidden) == 0 || len(hidden)%16 != 0 {
+		return "", false
+	}
+	password := make([]byte, 0, len(hidden))
+	previous := authenticator
+	for i := 0; i < len(hidden); i += 16 {
+		hash := md5.Sum(append([]byte(secret), previous...))
+		for j := range 16 {
+			password = append(password, hidden[i+j]^hash[j])
+		}
+		previous = hidden[i : i+16]
+	}
+	value := strings.TrimRight(string(password), "\x00")
+	if value == "" || strings.ContainsRune(value, 0) {
+		return "", false
+	}
+	for _, r := range value {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// radiusReject builds an Access-Reject signed with secret
+func radiusReject(identifier byte, authenticator []byte, secret string) []byte {
+	message := []byte("Authentication failed")
+	resp := []byte{radiusAccessReject, identifier}
+	resp = binary.BigEndian.AppendUint16(resp, uint16(radiusHeader+2+len(message)))
+	resp = append(resp, authenticator...)
+	resp = append(resp, radiusReplyMessage, byte(2+len(message)))
+	resp = append(resp, message...)
+	hash := md5.Sum(append(append([]byte{}, resp...), secret...))
+	copy(resp[4:radiusHeader], hash[:])
+	return resp
+}
+
+// parseRADIUS decodes a request and tries the radius.secrets to reveal the
+// password of an Access-Request
+func parseRADIUS(data []byte) (radiusRequest, error) {
+	if len(data) < radiusHeader || int(binary.BigEndian.Uint16(data[2:])) > len(data) || binary.BigEndian.Uint16(data[2:]) < radiusHeader {
+		return radiusRequest{}, errors.New("invalid RADIUS header")
+	}
+	data = data[:binary.BigEndian.Uint16(data[2:])]
+	req := radiusRequest{Code: radiusCodes[data[0]], Identifier: data[1]}
+	if req.Code == "" {
+		req.Code = "other"
+	}
+	attrs, err := radiusAttributes(data[radiusHeader:])
+	if err != nil {
+		return req, err
+	}
+	req.UserName = string(attrs[radiusUserName])
+	req.NASIdentifier = string(attrs[radiusNASIdentifier])
+	req.CallingStation = string(attrs[radiusCallingStationID])
+	if ip, ok := attrs[radiusNASIPAddress]; ok && len(ip) == 4 {
+		req.NASIPAddress = net.IP(ip).String()
+	}
+	_, req.CHAP = attrs[radiusCHAPPassword]
+	if hidden, ok := attrs[radiusUserPassword]; ok && data[0] == radiusAccessRequest {
+		for _, secret := range viper.GetStringSlice("radius.secrets") {
+			if password, ok := radiusDecryptPassword(hidden, data[4:radiusHeader], secret); ok {
+				req.Password, req.Secret = password, secret
+				break
+			}
+		}
+	}
+	return req, nil
+}
+
+// HandleRADIUS decodes RADIUS requests and rejects every Access-Request,
+// revealing the password when one of radius.secrets is the client's secret
+func HandleRADIUS(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedRADIUS{}
+	defer func() {
+		if err := h.ProduceUDP("radius", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "radius"), producer.ErrAttr(err))
+		}
+	}()
+
+	req, err := parseRADIUS(data)
+	if err != nil {
+		logger.Debug("Failed to parse RADIUS packet", slog.String("protocol", "radius"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, parsedRADIUS{Direction: "read", Request: req, Payload: data})
+	logger.Info(
+		"RADIUS request",
+		slog.String("handler", "radius"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("code", req.Code),
+		slog.String("user_name", req.UserName),
+		slog.String("password", req.Password),
+		slog.String("secret", req.Secret),
+		slog.String("nas_identifier", req.NASIdentifier),
+	)
+	if data[0] != radiusAccessRequest {
+		return nil
+	}
+	if req.UserName != "" {
+		helpers.RecordUDPCredential(srcAddr, dstAddr, md, credentials.Credential{Protocol: "radius", Username: req.UserName, Password: req.Password}, logger, h)
+	}
+
+	// the response authenticator needs the secret, a client with an unknown
+	// secret discards the reject like a timeout
+	secret := req.Secret
+	if secrets := viper.GetStringSlice("radius.secrets"); secret == "" && len(secrets) > 0 {
+		secret = secrets[0]
+	}
+	resp := radiusReject(data[1], data[4:radiusHeader], secret)
+	events = append(events, parsedRADIUS{Direction: "write", Request: req, Payload: resp})
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send RADIUS response", slog.String("protocol", "radius"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package udp
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRADIUS(t *testing.T) {
+	viper.Set("radius.secrets", []string{"cisco", "testing123"})
+	defer viper.Reset()
+
+	// hide the password the way a NAS configured with testing123 does
+	authenticator := []byte("0123456789abcdef")
+	hash := md5.Sum(append([]byte("testing123"), authenticator...))
+	hidden := make([]byte, 16)
+	copy(hidden, "admin123")
+	for i := range hidden {
+		hidden[i] ^= hash[i]
+	}
+
+	attrs := append([]byte{1, 7}, "admin"...)
+	attrs = append(attrs, 2, 18)
+	attrs = append(attrs, hidden...)
+	attrs = append(attrs, 4, 6, 10, 0, 0, 1)
+	packet := []byte{radiusAccessRequest, 7}
+	packet = binary.BigEndian.AppendUint16(packet, uint16(radiusHeader+len(attrs)))
+	packet = append(packet, authenticator...)
+	packet = append(packet, attrs...)
+
+	req, err := parseRADIUS(packet)
+	require.NoError(t, err)
+	require.Equal(t, radiusRequest{
+		Code:         "access_request",
+		Identifier:   7,
+		UserName:     "admin",
+		Password:     "admin123",
+		Secret:       "testing123",
+		NASIPAddress: "10.0.0.1",
+	}, req)
+
+	resp := radiusReject(7, authenticator, "testing123")
+	require.Equal(t, byte(radiusAccessReject), resp[0])
+	signed := append([]byte{}, resp...)
+	copy(signed[4:radiusHeader], authenticator)
+	expected := md5.Sum(append(signed, "testing123"...))
+	require.Equal(t, expected[:], resp[4:radiusHeader])
+
+	viper.Set("radius.secrets", []string{"cisco"})
+	req, err = parseRADIUS(packet)
+	require.NoError(t, err)
+	require.Empty(t, req.Password)
+
+	_, err = parseRADIUS(packet[:10])
+	require.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/seud0nym/tproxy-go/tproxy"
+)
+
+const (
+	// maxAmplification is the largest response to request size ratio we send
+	maxAmplification = 3
+	// maxRepliesPerSecond limits the responses sent to a single source
+	maxRepliesPerSecond = 5
+)
+
+var (
+	errAmplification = errors.New("response exceeds amplification limit")
+	errRateLimited   = errors.New("response rate limit reached for source")
+)
+
+// replyGuard keeps the sensor from being abused as a reflector
+type replyGuard struct {
+	window  time.Time
+	replies map[string]int
+	mtx     sync.Mutex
+}
+
+var guard = &replyGuard{replies: map[string]int{}}
+
+func (g *replyGuard) allow(ip string, reqLen, respLen int) error {
+	if respLen > maxAmplification*reqLen {
+		return errAmplification
+	}
+	return g.rate(ip)
+}
+
+func (g *replyGuard) rate(ip string) error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	now := time.Now().Truncate(time.Second)
+	if !now.Equal(g.window) {
+		g.window = now
+		g.replies = map[string]int{}
+	}
+	if g.replies[ip] >= maxRepliesPerSecond {
+		return errRateLimited
+	}
+	g.replies[ip]++
+	return nil
+}
+
+// sendResponse writes resp to srcAddr from the address the request was sent
+// to, provided it passes the amplification safeguard
+func sendResponse(srcAddr, dstAddr *net.UDPAddr, req, resp []byte) error {
+	if err := guard.allow(srcAddr.IP.String(), len(req), len(resp)); err != nil {
+		return err
+	}
+	return writeResponse(srcAddr, dstAddr, resp)
+}
+
+// sendVerifiedResponse writes resp to a source that proved to receive our
+// replies, e.g. by echoing a cookie, so only the rate limit applies
+func sendVerifiedResponse(srcAddr, dstAddr *net.UDPAddr, resp []byte) error {
+	if err := guard.rate(srcAddr.IP.String()); err != nil {
+		return err
+	}
+	return writeResponse(srcAddr, dstAddr, resp)
+}
+
+func writeResponse(srcAddr, dstAddr *net.UDPAddr, resp []byte) error {
+	conn, err := tproxy.DialUDP("udp", dstAddr, srcAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(resp)
+	return err
+}
@@ -0,0 +1,45 @@
+package udp
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// HandleSLP answers SLP service requests with the services of a VMware ESXi
+// host, which is what ESXiArgs style scanners look for
+func HandleSLP(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	resp, msg, err := helpers.SLPResponse(data, dstAddr.IP.String())
+	defer func() {
+		if err := h.ProduceUDP("slp", srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "slp"), producer.ErrAttr(err))
+		}
+	}()
+	if err != nil {
+		logger.Debug("Failed to parse SLP message", slog.String("protocol", "slp"), producer.ErrAttr(err))
+		return nil
+	}
+	if msg.Function == "da_advert" {
+		md.Tags = append(md.Tags, "slp_da_advert")
+	}
+	logger.Info(
+		"SLP message",
+		slog.String("handler", "slp"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("function", msg.Function),
+		slog.String("service_type", msg.ServiceType),
+		slog.String("url", msg.URL),
+	)
+	if resp == nil {
+		return nil
+	}
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send SLP response", slog.String("protocol", "slp"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,474 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/credentials"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/spf13/viper"
+)
+
+// BER tags used by SNMP
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	berTimeTicks   = 0x43
+
+	snmpGet      = 0xa0
+	snmpGetNext  = 0xa1
+	snmpResponse = 0xa2
+	snmpSet      = 0xa3
+	snmpGetBulk  = 0xa5
+	snmpReport   = 0xa8
+
+	snmpNoSuchObject = 0x80
+	snmpEndOfMib     = 0x82
+
+	snmpV1  = 0
+	snmpV2c = 1
+	snmpV3  = 3
+
+	// getbulk replies are cut at this many variables
+	snmpMaxRepetitions = 10
+)
+
+var snmpPDUNames = map[byte]string{
+	snmpGet:     "get",
+	snmpGetNext: "getnext",
+	snmpSet:     "set",
+	snmpGetBulk: "getbulk",
+	0xa4:        "trap",
+	0xa6:        "inform",
+	0xa7:        "trapv2",
+	snmpReport:  "report",
+}
+
+// snmpBoot is used for sysUpTime
+var snmpBoot = time.Now().Add(-37 * 24 * time.Hour)
+
+type snmpVar struct {
+	oid   []int
+	tag   byte
+	value func() []byte
+}
+
+// snmpMIB is the system group, sorted by OID for getnext walks
+var snmpMIB = []snmpVar{
+	{[]int{1, 3, 6, 1, 2, 1, 1, 1, 0}, berOctetString, func() []byte {
+		return []byte("Linux gw-core-01 4.19.0-21-amd64 #1 SMP Debian 4.19.249-2 (2022-06-30) x86_64")
+	}},
+	{[]int{1, 3, 6, 1, 2, 1, 1, 2, 0}, berOID, func() []byte { return berEncodeOID([]int{1, 3, 6, 1, 4, 1, 8072, 3, 2, 10}) }},
+	{[]int{1, 3, 6, 1, 2, 1, 1, 3, 0}, berTimeTicks, func() []byte {
+		return berEncodeInt(int64(time.Since(snmpBoot) / (10 * time.Millisecond)))
+	}},
+	{[]int{1, 3, 6, 1, 2, 1, 1, 4, 0}, berOctetString, func() []byte { return []byte("Network Operations <noc@localdomain>") }},
+	{[]int{1, 3, 6, 1, 2, 1, 1, 5, 0}, berOctetString, func() []byte { return []byte("gw-core-01") }},
+	{[]int{1, 3, 6, 1, 2, 1, 1, 6, 0}, berOctetString, func() []byte { return []byte("Server Room B, Rack 4") }},
+	{[]int{1, 3, 6, 1, 2, 1, 1, 7, 0}, berInteger, func() []byte { return berEncodeInt(72) }},
+}
+
+type snmpRequest struct {
+	Version   int      `json:"version"`
+	Community string   `json:"community,omitempty"`
+	User      string   `json:"user,omitempty"`
+	PDU       string   `json:"pdu,omitempty"`
+	RequestID int64    `json:"request_id"`
+	OIDs      []string `json:"oids,omitempty"`
+}
+
+type parsedSNMP struct {
+	Direction string      `json:"direction,omitempty"`
+	Request   snmpRequest `json:"request,omitempty"`
+	Payload   []byte      `json:"payload,omitempty"`
+}
+
+// berRead splits the first TLV off data
+func berRead(data []byte) (byte, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("BER element too short")
+	}
+	tag := data[0]
+	length := int(data[1])
+	pos := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 || len(data) < pos+n {
+			return 0, nil, nil, errors.New("invalid BER length")
+		}
+		length = 0
+		for _, b := range data[pos : pos+n] {
+			length = length<<8 | int(b)
+		}
+		pos += n
+	}
+	if len(data) < pos+length {
+		return 0, nil, nil, errors.New("BER element truncated")
+	}
+	return tag, data[pos : pos+length], data[pos+length:], nil
+}
+
+func berExpect(data []byte, want byte) ([]byte, []byte, error) {
+	tag, value, rest, err := berRead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tag != want {
+		return nil, nil, fmt.Errorf("unexpected BER tag 0x%x", tag)
+	}
+	return value, rest, nil
+}
+
+func berTLV(tag byte, value []byte) []byte {
+	buf := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		buf = append(buf, byte(n))
+	case n < 0x100:
+		buf = append(buf, 0x81, byte(n))
+	default:
+		buf = append(buf, 0x82, byte(n>>8), byte(n))
+	}
+	return append(buf, value...)
+}
+
+func berDecodeInt(value []byte) int64 {
+	var n int64
+	for i, b := range value {
+		if i == 0 && b&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(b)
+	}
+	return n
+}
+
+func berEncodeInt(n int64) []byte {
+	buf := []byte{byte(n)}
+	for n > 0x7f || n < -0x80 {
+		n >>= 8
+		buf = append([]byte{byte(n)}, buf...)
+	}
+	return buf
+}
+
+func berDecodeOID(value []byte) []int {
+	if len(value) == 0 {
+		return nil
+	}
+	oid := []int{int(value[0]) / 40, int(value[0]) % 40}
+	n := 0
+	for _, b := range value[1:] {
+		n = n<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			oid = append(oid, n)
+			n = 0
+		}
+	}
+	return oid
+}
+
+func berEncodeOID(oid []int) []byte {
+	buf := []byte{byte(oid[0]*40 + oid[1])}
+	for _, n := range oid[2:] {
+		part := []byte{byte(n & 0x7f)}
+		for n >>= 7; n > 0; n >>= 7 {
+			part = append([]byte{byte(n&0x7f) | 0x80}, part...)
+		}
+		buf = append(buf, part...)
+	}
+	return buf
+}
+
+func oidString(oid []int) string {
+	parts := make([]string, len(oid))
+	for i, n := range oid {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// snmpPDU is a decoded request PDU
+type snmpPDU struct {
+	tag       byte
+	requestID int64
+	// non-repeaters and max-repetitions for getbulk
+	nonRepeaters   int64
+	maxRepetitions int64
+	oids           [][]int
+}
+
+func parsePDU(data []byte) (snmpPDU, error) {
+	pdu := snmpPDU{}
+	tag, body, _, err := berRead(data)
+	if err != nil {
+		return pdu, err
+	}
+	pdu.tag = tag
+	fields := make([]int64, 3)
+	for i := range fields {
+		var value []byte
+		if value, body, err = berExpect(body, berInteger); err != nil {
+			return pdu, err
+		}
+		fields[i] = berDecodeInt(value)
+	}
+	pdu.requestID = fields[0]
+	pdu.nonRepeaters, pdu.maxRepetitions = fields[1], fields[2]
+	bindings, _, err := berExpect(body, berSequence)
+	if err != nil {
+		return pdu, err
+	}
+	for len(bindings) > 0 {
+		var binding, oid []byte
+		if binding, bindings, err = berExpect(bindings, berSequence); err != nil {
+			return pdu, err
+		}
+		if oid, _, err = berExpect(binding, berOID); err != nil {
+			return pdu, err
+		}
+		pdu.oids = append(pdu.oids, berDecodeOID(oid))
+	}
+	return pdu, nil
+}
+
+// parseSNMP decodes the message wrapper and the PDU it carries. Encrypted
+// SNMPv3 PDUs are left undecoded.
+func parseSNMP(data []byte) (snmpRequest, *snmpPDU, error) {
+	req := snmpRequest{}
+	msg, _, err := berExpect(data, berSequence)
+	if err != nil {
+		return req, nil, err
+	}
+	version, msg, err := berExpect(msg, berInteger)
+	if err != nil {
+		return req, nil, err
+	}
+	req.Version = int(berDecodeInt(version))
+
+	var pduData []byte
+	switch req.Version {
+	case snmpV1, snmpV2c:
+		community, rest, err := berExpect(msg, berOctetString)
+		if err != nil {
+			return req, nil, err
+		}
+		req.Community = string(community)
+		pduData = rest
+	case snmpV3:
+		// skip the global header, then read the user from the USM parameters
+		_, rest, err := berExpect(msg, berSequence)
+		if err != nil {
+			return req, nil, err
+		}
+		params, rest, err := berExpect(rest, berOctetString)
+		if err != nil {
+			return req, nil, err
+		}
+		if usm, _, err := berExpect(params, berSequence); err == nil {
+			for i := 0; i < 4 && len(usm) > 0; i++ {
+				var value []byte
+				if _, value, usm, err = berRead(usm); err != nil {
+					break
+				}
+				if i == 3 {
+					req.User = string(value)
+				}
+			}
+		}
+		scoped, _, err := berExpect(rest, berSequence)
+		if err != nil {
+			// encrypted scoped PDU
+			return req, nil, nil
+		}
+		// context engine ID and context name precede the PDU
+		for i := 0; i < 2; i++ {
+			if _, scoped, err = berExpect(scoped, berOctetString); err != nil {
+				return req, nil, err
+			}
+		}
+		pduData = scoped
+	default:
+		return req, nil, fmt.Errorf("unsupported SNMP version %d", req.Version)
+	}
+
+	pdu, err := parsePDU(pduData)
+	if err != nil {
+		return req, nil, err
+	}
+	req.PDU = snmpPDUNames[pdu.tag]
+	req.RequestID = pdu.requestID
+	for _, oid := range pdu.oids {
+		req.OIDs = append(req.OIDs, oidString(oid))
+	}
+	return req, &pdu, nil
+}
+
+func snmpLookup(oid []int) (snmpVar, bool) {
+	for _, v := range snmpMIB {
+		if slices.Equal(v.oid, oid) {
+			return v, true
+		}
+	}
+	return snmpVar{}, false
+}
+
+func snmpNext(oid []int) (snmpVar, bool) {
+	for _, v := range snmpMIB {
+		if slices.Compare(v.oid, oid) > 0 {
+			return v, true
+		}
+	}
+	return snmpVar{}, false
+}
+
+func varBind(oid []int, tag byte, value []byte) []byte {
+	return berTLV(berSequence, append(berTLV(berOID, berEncodeOID(oid)), berTLV(tag, value)...))
+}
+
+// snmpResponsePDU answers a v1 or v2c request from the system group
+func snmpResponsePDU(version int, pdu *snmpPDU) []byte {
+	var (
+		bindings  []byte
+		errStatus int64
+		errIndex  int64
+	)
+	// SNMPv1 has no exception values and reports the first failing binding
+	fail := func(i int, status int64) {
+		if errStatus == 0 {
+			errStatus, errIndex = status, int64(i+1)
+		}
+	}
+	oids := pdu.oids
+	if pdu.tag == snmpGetBulk && len(oids) == 1 {
+		oid := oids[0]
+		for i := int64(0); i < min(pdu.maxRepetitions, snmpMaxRepetitions); i++ {
+			v, ok := snmpNext(oid)
+			if !ok {
+				bindings = append(bindings, varBind(oid, snmpEndOfMib, nil)...)
+				break
+			}
+			bindings = append(bindings, varBind(v.oid, v.tag, v.value())...)
+			oid = v.oid
+		}
+		oids = nil
+	}
+	for i, oid := range oids {
+		switch pdu.tag {
+		case snmpGet:
+			if v, ok := snmpLookup(oid); ok {
+				bindings = append(bindings, varBind(oid, v.tag, v.value())...)
+				continue
+			}
+			if version == snmpV1 {
+				fail(i, 2) // noSuchName
+			}
+			bindings = append(bindings, varBind(oid, snmpNoSuchObject, nil)...)
+		case snmpSet:
+			if version == snmpV1 {
+				fail(i, 2) // noSuchName
+			} else {
+				fail(i, 6) // noAccess
+			}
+			bindings = append(bindings, varBind(oid, berNull, nil)...)
+		default:
+			if v, ok := snmpNext(oid); ok {
+				bindings = append(bindings, varBind(v.oid, v.tag, v.value())...)
+				continue
+			}
+			if version == snmpV1 {
+				fail(i, 2) // noSuchName
+			}
+			bindings = append(bindings, varBind(oid, snmpEndOfMib, nil)...)
+		}
+	}
+	body := berTLV(berInteger, berEncodeInt(pdu.requestID))
+	body = append(body, berTLV(berInteger, berEncodeInt(errStatus))...)
+	body = append(body, berTLV(berInteger, berEncodeInt(errIndex))...)
+	body = append(body, berTLV(berSequence, bindings)...)
+	return berTLV(snmpResponse, body)
+}
+
+// snmpCommunityAllowed reports whether we answer requests for community
+func snmpCommunityAllowed(community string) bool {
+	return slices.Contains(viper.GetStringSlice("snmp.communities"), community)
+}
+
+// HandleSNMP decodes SNMP requests and answers v1 and v2c requests for a
+// configured community with a subset of the system group
+func HandleSNMP(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedSNMP{}
+	defer func() {
+		if err := h.ProduceUDP("snmp", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "snmp"), producer.ErrAttr(err))
+		}
+	}()
+
+	req, pdu, err := parseSNMP(data)
+	events = append(events, parsedSNMP{
+		Direction: "read",
+		Request:   req,
+		Payload:   data,
+	})
+	if err != nil {
+		logger.Debug("Failed to parse SNMP message", slog.String("protocol", "snmp"), producer.ErrAttr(err))
+		return nil
+	}
+	logger.Info(
+		"SNMP request",
+		slog.String("handler", "snmp"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.Int("version", req.Version),
+		slog.String("community", req.Community),
+		slog.String("user", req.User),
+		slog.String("pdu", req.PDU),
+		slog.Any("oids", req.OIDs),
+	)
+	// the community string is the password of SNMP v1 and v2c
+	if req.Community != "" || req.User != "" {
+		cred := credentials.Credential{Protocol: "snmp", Username: req.User, Password: req.Community}
+		cred.Success = req.Version != snmpV3 && snmpCommunityAllowed(req.Community)
+		helpers.RecordUDPCredential(srcAddr, dstAddr, md, cred, logger, h)
+	}
+
+	// SNMPv3 needs engine discovery and USM keys, and agents silently drop
+	// requests for unknown communities
+	if pdu == nil || req.Version == snmpV3 || !snmpCommunityAllowed(req.Community) {
+		return nil
+	}
+	switch pdu.tag {
+	case snmpGet, snmpGetNext, snmpSet, snmpGetBulk:
+	default:
+		return nil
+	}
+	if pdu.tag == snmpGetBulk && req.Version == snmpV1 {
+		return nil
+	}
+
+	msg := berTLV(berInteger, berEncodeInt(int64(req.Version)))
+	msg = append(msg, berTLV(berOctetString, []byte(req.Community))...)
+	msg = append(msg, snmpResponsePDU(req.Version, pdu)...)
+	resp := berTLV(berSequence, msg)
+	events = append(events, parsedSNMP{
+		Direction: "write",
+		Request:   req,
+		Payload:   resp,
+	})
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send SNMP response", slog.String("protocol", "snmp"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package udp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/protocols/mocks"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func snmpRequestPacket(version int, community string, tag byte, oids ...[]int) []byte {
+	var bindings []byte
+	for _, oid := range oids {
+		bindings = append(bindings, varBind(oid, berNull, nil)...)
+	}
+	pdu := berTLV(berInteger, berEncodeInt(1234))
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(0))...)
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(0))...)
+	pdu = append(pdu, berTLV(berSequence, bindings)...)
+	msg := berTLV(berInteger, berEncodeInt(int64(version)))
+	msg = append(msg, berTLV(berOctetString, []byte(community))...)
+	msg = append(msg, berTLV(tag, pdu)...)
+	return berTLV(berSequence, msg)
+}
+
+func TestBERCoding(t *testing.T) {
+	oid := []int{1, 3, 6, 1, 4, 1, 8072, 3, 2, 10}
+	require.Equal(t, oid, berDecodeOID(berEncodeOID(oid)))
+	for _, n := range []int64{0, 127, 128, 255, 256, -1, 3200000} {
+		require.Equal(t, n, berDecodeInt(berEncodeInt(n)))
+	}
+	long := make([]byte, 300)
+	tag, value, rest, err := berRead(berTLV(berOctetString, long))
+	require.NoError(t, err)
+	require.Equal(t, byte(berOctetString), tag)
+	require.Len(t, value, 300)
+	require.Empty(t, rest)
+}
+
+func TestParseSNMP(t *testing.T) {
+	sysDescr := []int{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	req, pdu, err := parseSNMP(snmpRequestPacket(snmpV2c, "public", snmpGet, sysDescr))
+	require.NoError(t, err)
+	require.Equal(t, snmpV2c, req.Version)
+	require.Equal(t, "public", req.Community)
+	require.Equal(t, "get", req.PDU)
+	require.Equal(t, int64(1234), req.RequestID)
+	require.Equal(t, []string{"1.3.6.1.2.1.1.1.0"}, req.OIDs)
+
+	resp := snmpResponsePDU(req.Version, pdu)
+	parsed, err := parsePDU(resp)
+	require.NoError(t, err)
+	require.Equal(t, byte(snmpResponse), parsed.tag)
+	require.Equal(t, [][]int{sysDescr}, parsed.oids)
+	require.Contains(t, string(resp), "Linux")
+
+	_, pdu, err = parseSNMP(snmpRequestPacket(snmpV1, "public", snmpGetNext, []int{1, 3, 6, 1, 2, 1, 1, 7, 0}))
+	require.NoError(t, err)
+	parsed, err = parsePDU(snmpResponsePDU(snmpV1, pdu))
+	require.NoError(t, err)
+	// walking off the end of the MIB is noSuchName in SNMPv1
+	require.Equal(t, int64(2), parsed.nonRepeaters)
+
+	_, _, err = parseSNMP([]byte{0x30, 0x03, 0x02, 0x01})
+	require.Error(t, err)
+}
+
+func TestHandleSNMPCommunity(t *testing.T) {
+	viper.Set("snmp.communities", []string{"public"})
+	defer viper.Set("snmp.communities", nil)
+	creds := []string{}
+	h := &mocks.MockHoneypot{}
+	h.EXPECT().ProduceUDP("snmp", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(_ string, _, _ *net.UDPAddr, _ connection.Metadata, _ []byte, event interface{}) {
+			if _, ok := event.([]parsedSNMP); ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			require.NoError(t, err)
+			creds = append(creds, string(data))
+		}).Return(nil)
+	l := &mocks.MockLogger{}
+	l.EXPECT().Info("SNMP request", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	l.EXPECT().Info("credential captured", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	src := &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000}
+	dst := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 161}
+
+	// unknown communities are dropped without a response
+	data := snmpRequestPacket(snmpV2c, "cisco", snmpGet, []int{1, 3, 6, 1, 2, 1, 1, 1, 0})
+	require.NoError(t, HandleSNMP(context.Background(), src, dst, data, connection.Metadata{}, l, h))
+	require.Equal(t, []string{`{"event":"credential","protocol":"snmp","password":"cisco","success":false}`}, creds)
+}
@@ -0,0 +1,125 @@
+package udp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	// the device description is served by the HTTP handler on this port
+	ssdpHTTPPort = 49152
+	ssdpServer   = "Linux/3.14 UPnP/1.0 MiniUPnPd/2.1"
+	ssdpUUID     = "uuid:1c5c2a8e-61d4-4b3b-9f4e-3f0a1d7b2c91"
+	ssdpRootType = "upnp:rootdevice"
+)
+
+type ssdpRequest struct {
+	Method string `json:"method"`
+	ST     string `json:"st,omitempty"`
+	MAN    string `json:"man,omitempty"`
+	MX     string `json:"mx,omitempty"`
+	Agent  string `json:"user_agent,omitempty"`
+}
+
+type parsedSSDP struct {
+	Direction string      `json:"direction,omitempty"`
+	Request   ssdpRequest `json:"request,omitempty"`
+	Payload   []byte      `json:"payload,omitempty"`
+}
+
+func parseSSDP(data []byte) (ssdpRequest, error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return ssdpRequest{}, err
+	}
+	return ssdpRequest{
+		Method: req.Method,
+		ST:     req.Header.Get("ST"),
+		MAN:    req.Header.Get("MAN"),
+		MX:     req.Header.Get("MX"),
+		Agent:  req.Header.Get("User-Agent"),
+	}, nil
+}
+
+// ssdpResponse answers an M-SEARCH for the root device, all devices or the
+// gateway types we advertise
+func ssdpResponse(req ssdpRequest, ip net.IP) []byte {
+	st := req.ST
+	switch {
+	case st == "ssdp:all":
+		st = ssdpRootType
+	case st == ssdpRootType,
+		strings.HasPrefix(st, "urn:schemas-upnp-org:device:InternetGatewayDevice:"),
+		strings.HasPrefix(st, "urn:schemas-upnp-org:service:WANIPConnection:"):
+	default:
+		return nil
+	}
+	usn := ssdpUUID
+	if st != ssdpUUID {
+		usn += "::" + st
+	}
+	return []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\n"+
+		"CACHE-CONTROL: max-age=120\r\n"+
+		"ST: %s\r\n"+
+		"USN: %s\r\n"+
+		"EXT:\r\n"+
+		"SERVER: %s\r\n"+
+		"LOCATION: http://%s/rootDesc.xml\r\n\r\n",
+		st, usn, ssdpServer, net.JoinHostPort(ip.String(), fmt.Sprint(ssdpHTTPPort))))
+}
+
+// HandleSSDP answers M-SEARCH discovery with a gateway device whose
+// description is served by the HTTP handler
+func HandleSSDP(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedSSDP{}
+	defer func() {
+		if err := h.ProduceUDP("ssdp", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "ssdp"), producer.ErrAttr(err))
+		}
+	}()
+
+	req, err := parseSSDP(data)
+	if err != nil {
+		logger.Debug("Failed to parse SSDP request", slog.String("protocol", "ssdp"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, parsedSSDP{
+		Direction: "read",
+		Request:   req,
+		Payload:   data,
+	})
+	logger.Info(
+		"SSDP request",
+		slog.String("handler", "ssdp"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("method", req.Method),
+		slog.String("st", req.ST),
+		slog.String("user_agent", req.Agent),
+	)
+	if req.Method != "M-SEARCH" {
+		return nil
+	}
+	resp := ssdpResponse(req, dstAddr.IP)
+	if resp == nil {
+		return nil
+	}
+	events = append(events, parsedSSDP{
+		Direction: "write",
+		Request:   req,
+		Payload:   resp,
+	})
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send SSDP response", slog.String("protocol", "ssdp"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package udp
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSDPResponse(t *testing.T) {
+	msearch := "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"
+	req, err := parseSSDP([]byte(msearch))
+	require.NoError(t, err)
+	require.Equal(t, "M-SEARCH", req.Method)
+	require.Equal(t, "ssdp:all", req.ST)
+
+	resp := string(ssdpResponse(req, net.ParseIP("192.0.2.1")))
+	require.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	require.Contains(t, resp, "LOCATION: http://192.0.2.1:49152/rootDesc.xml")
+	require.Contains(t, resp, "ST: upnp:rootdevice")
+	// the reply has to pass the amplification guard
+	require.LessOrEqual(t, len(resp), maxAmplification*len(msearch))
+
+	req.ST = "urn:dial-multiscreen-org:service:dial:1"
+	require.Nil(t, ssdpResponse(req, net.ParseIP("192.0.2.1")))
+}
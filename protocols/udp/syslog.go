@@ -0,0 +1,36 @@
+package udp
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+// HandleSyslog records the syslog messages devices send to the sensor,
+// whether misrouted or exfiltrated
+func HandleSyslog(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	msg, err := helpers.ParseSyslog(data)
+	defer func() {
+		if err := h.ProduceUDP("syslog", srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "syslog"), producer.ErrAttr(err))
+		}
+	}()
+	if err != nil {
+		logger.Debug("Failed to parse syslog message", slog.String("protocol", "syslog"), producer.ErrAttr(err))
+		return nil
+	}
+	logger.Info(
+		"syslog message",
+		slog.String("handler", "syslog"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("hostname", msg.Hostname),
+		slog.String("app_name", msg.AppName),
+		slog.String("message", msg.Message),
+	)
+	return nil
+}
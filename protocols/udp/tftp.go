@@ -0,0 +1,205 @@
+package udp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/helpers"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"github.com/seud0nym/tproxy-go/tproxy"
+)
+
+const (
+	tftpRRQ   = 1
+	tftpWRQ   = 2
+	tftpData  = 3
+	tftpAck   = 4
+	tftpError = 5
+	tftpOACK  = 6
+
+	tftpBlockSize = 512
+	tftpTimeout   = 5 * time.Second
+	tftpRetries   = 3
+	// uploads are cut off at this size
+	tftpMaxUpload = 16 << 20
+)
+
+var tftpOpcodes = map[uint16]string{
+	tftpRRQ:   "RRQ",
+	tftpWRQ:   "WRQ",
+	tftpData:  "DATA",
+	tftpAck:   "ACK",
+	tftpError: "ERROR",
+	tftpOACK:  "OACK",
+}
+
+type tftpRequest struct {
+	Opcode   string            `json:"opcode"`
+	Filename string            `json:"filename,omitempty"`
+	Mode     string            `json:"mode,omitempty"`
+	Options  map[string]string `json:"options,omitempty"`
+}
+
+type parsedTFTP struct {
+	Request     tftpRequest `json:"request,omitempty"`
+	Size        int         `json:"size,omitempty"`
+	PayloadHash string      `json:"payload_hash,omitempty"`
+}
+
+func parseTFTP(data []byte) (tftpRequest, error) {
+	req := tftpRequest{}
+	if len(data) < 2 {
+		return req, errors.New("TFTP packet too short")
+	}
+	opcode := binary.BigEndian.Uint16(data)
+	name, ok := tftpOpcodes[opcode]
+	if !ok {
+		return req, errors.New("invalid TFTP opcode")
+	}
+	req.Opcode = name
+	if opcode != tftpRRQ && opcode != tftpWRQ {
+		return req, nil
+	}
+	fields := strings.Split(strings.TrimSuffix(string(data[2:]), "\x00"), "\x00")
+	if len(fields) < 2 {
+		return req, errors.New("invalid TFTP request")
+	}
+	req.Filename = fields[0]
+	req.Mode = strings.ToLower(fields[1])
+	for i := 2; i+1 < len(fields); i += 2 {
+		if req.Options == nil {
+			req.Options = map[string]string{}
+		}
+		req.Options[strings.ToLower(fields[i])] = fields[i+1]
+	}
+	return req, nil
+}
+
+func tftpPacket(opcode, arg uint16, data []byte) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, opcode)
+	buf = binary.BigEndian.AppendUint16(buf, arg)
+	return append(buf, data...)
+}
+
+func tftpErrorPacket(code uint16, msg string) []byte {
+	return tftpPacket(tftpError, code, append([]byte(msg), 0))
+}
+
+// tftpReceive acknowledges the write request and collects the uploaded data
+// blocks until the final short block. Options are ignored, so the client
+// falls back to 512 byte blocks.
+func tftpReceive(conn net.Conn) ([]byte, error) {
+	upload := &bytes.Buffer{}
+	buffer := make([]byte, tftpBlockSize+4)
+	ack := tftpPacket(tftpAck, 0, nil)
+	block := uint16(1)
+	retries := 0
+	for {
+		if _, err := conn.Write(ack); err != nil {
+			return upload.Bytes(), err
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(tftpTimeout)); err != nil {
+			return upload.Bytes(), err
+		}
+		n, err := conn.Read(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && retries < tftpRetries {
+				retries++
+				continue
+			}
+			return upload.Bytes(), err
+		}
+		retries = 0
+		if n < 4 || binary.BigEndian.Uint16(buffer) != tftpData {
+			return upload.Bytes(), errors.New("unexpected TFTP packet during upload")
+		}
+		// a duplicate of the previous block is answered with the same ACK
+		if binary.BigEndian.Uint16(buffer[2:]) != block {
+			continue
+		}
+		upload.Write(buffer[4:n])
+		ack = tftpPacket(tftpAck, block, nil)
+		if n-4 < tftpBlockSize {
+			_, err := conn.Write(ack)
+			return upload.Bytes(), err
+		}
+		if upload.Len() >= tftpMaxUpload {
+			_, _ = conn.Write(tftpErrorPacket(3, "Disk full or allocation exceeded"))
+			return upload.Bytes(), errors.New("TFTP upload too large")
+		}
+		block++
+	}
+}
+
+// HandleTFTP logs read and write requests and captures uploaded files. Read
+// requests are answered with file not found.
+func HandleTFTP(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	event := parsedTFTP{}
+	defer func() {
+		if err := h.ProduceUDP("tftp", srcAddr, dstAddr, md, data, event); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "tftp"), producer.ErrAttr(err))
+		}
+	}()
+
+	req, err := parseTFTP(data)
+	event.Request = req
+	if err != nil {
+		logger.Debug("Failed to parse TFTP packet", slog.String("protocol", "tftp"), producer.ErrAttr(err))
+		return nil
+	}
+	if req.Opcode != "RRQ" && req.Opcode != "WRQ" {
+		return nil
+	}
+	logger.Info(
+		"TFTP request",
+		slog.String("handler", "tftp"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("opcode", req.Opcode),
+		slog.String("filename", req.Filename),
+		slog.String("mode", req.Mode),
+	)
+
+	// the transfer continues from a new port of the server
+	conn, err := tproxy.DialUDP("udp", &net.UDPAddr{IP: dstAddr.IP}, srcAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if req.Opcode == "RRQ" {
+		if _, err := conn.Write(tftpErrorPacket(1, "File not found")); err != nil {
+			logger.Debug("Failed to send TFTP error", slog.String("protocol", "tftp"), producer.ErrAttr(err))
+		}
+		return nil
+	}
+
+	upload, err := tftpReceive(conn)
+	if err != nil {
+		logger.Debug("TFTP upload incomplete", slog.String("protocol", "tftp"), producer.ErrAttr(err))
+	}
+	if len(upload) == 0 {
+		return nil
+	}
+	event.Size = len(upload)
+	if event.PayloadHash, err = helpers.StorePayload(upload); err != nil {
+		logger.Error("Failed to store TFTP upload", slog.String("protocol", "tftp"), producer.ErrAttr(err))
+	}
+	logger.Info(
+		"TFTP upload received",
+		slog.String("handler", "tftp"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("filename", req.Filename),
+		slog.Int("size", event.Size),
+		slog.String("sha256", event.PayloadHash),
+	)
+	return nil
+}
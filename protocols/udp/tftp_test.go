@@ -0,0 +1,50 @@
+package udp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTFTP(t *testing.T) {
+	req, err := parseTFTP([]byte("\x00\x02mozi.m\x00octet\x00blksize\x001428\x00"))
+	require.NoError(t, err)
+	require.Equal(t, "WRQ", req.Opcode)
+	require.Equal(t, "mozi.m", req.Filename)
+	require.Equal(t, "octet", req.Mode)
+	require.Equal(t, map[string]string{"blksize": "1428"}, req.Options)
+
+	_, err = parseTFTP([]byte("\x00\x09"))
+	require.Error(t, err)
+}
+
+func TestTFTPReceive(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	upload := bytes.Repeat([]byte{0x7f}, tftpBlockSize+100)
+	done := make(chan []byte)
+	go func() {
+		data, _ := tftpReceive(server)
+		server.Close()
+		done <- data
+	}()
+
+	buffer := make([]byte, 16)
+	for block, offset := uint16(0), 0; offset <= len(upload); block++ {
+		n, err := client.Read(buffer)
+		require.NoError(t, err)
+		require.Equal(t, tftpPacket(tftpAck, block, nil), buffer[:n])
+		end := min(offset+tftpBlockSize, len(upload))
+		_, err = client.Write(tftpPacket(tftpData, block+1, upload[offset:end]))
+		require.NoError(t, err)
+		offset += tftpBlockSize
+	}
+	n, err := client.Read(buffer)
+	require.NoError(t, err)
+	require.Equal(t, uint16(2), binary.BigEndian.Uint16(buffer[2:n]))
+	require.Equal(t, upload, <-done)
+}
@@ -12,12 +12,20 @@ import (
 	"github.com/mushorg/glutton/protocols/interfaces"
 )
 
+// MaxDatagramSize is the largest UDP payload, packets are read whole so
+// handlers like QUIC see the padded client Initials
+const MaxDatagramSize = 65535
+
+// udpMaxLogged bounds what the generic handler logs and stores of a packet
+const udpMaxLogged = 1024
+
 func HandleUDP(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, log interfaces.Logger, h interfaces.Honeypot) error {
-	log.Info(fmt.Sprintf("UDP payload:\n%s", hex.Dump(data[:len(data)%1024])))
-	if _, err := helpers.StorePayload(data[:len(data)%1024]); err != nil {
+	data = data[:min(len(data), udpMaxLogged)]
+	log.Info(fmt.Sprintf("UDP payload:\n%s", hex.Dump(data)))
+	if _, err := helpers.StorePayload(data); err != nil {
 		log.Error("failed to store UDP payload", producer.ErrAttr(err))
 	}
-	if err := h.ProduceUDP("udp", srcAddr, dstAddr, md, data[:len(data)%1024], nil); err != nil {
+	if err := h.ProduceUDP("udp", srcAddr, dstAddr, md, data, nil); err != nil {
 		log.Error("failed to produce UDP payload", producer.ErrAttr(err))
 	}
 	return nil
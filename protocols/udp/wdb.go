@@ -0,0 +1,213 @@
+package udp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	wdbProgram = 0x55555555
+	// ONC-RPC call header followed by the WDB checksum, size and sequence number
+	wdbRequestHeaderLen = 52
+)
+
+// WDB procedure numbers from the VxWorks wdb.h header
+var wdbProcedures = map[uint32]string{
+	0:  "target_ping",
+	1:  "target_connect",
+	2:  "target_disconnect",
+	3:  "target_mode_set",
+	4:  "target_mode_get",
+	10: "mem_read",
+	11: "mem_write",
+	12: "mem_fill",
+	13: "mem_move",
+	14: "mem_checksum",
+	15: "mem_protect",
+	16: "mem_cache_text_update",
+	17: "mem_scan",
+	18: "mem_write_many",
+	19: "mem_write_many_ints",
+	30: "context_create",
+	31: "context_kill",
+	32: "context_suspend",
+	33: "context_resume",
+	40: "regs_get",
+	41: "regs_set",
+	60: "eventpoint_add",
+	61: "eventpoint_delete",
+	70: "event_get",
+	80: "context_cont",
+	81: "context_step",
+	90: "func_call",
+	91: "evaluate_gopher",
+	92: "direct_call",
+}
+
+type wdbRequest struct {
+	XID       uint32   `json:"xid"`
+	Procedure uint32   `json:"procedure"`
+	Operation string   `json:"operation,omitempty"`
+	Sequence  uint32   `json:"sequence"`
+	Args      []uint32 `json:"args,omitempty"`
+}
+
+type parsedWDB struct {
+	Direction string     `json:"direction,omitempty"`
+	Request   wdbRequest `json:"request,omitempty"`
+	Payload   []byte     `json:"payload,omitempty"`
+}
+
+func parseWDB(data []byte) (wdbRequest, error) {
+	req := wdbRequest{}
+	if len(data) < wdbRequestHeaderLen {
+		return req, errors.New("WDB request too short")
+	}
+	words := make([]uint32, wdbRequestHeaderLen/4)
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &words); err != nil {
+		return req, err
+	}
+	// message type CALL, RPC version 2 and the WDB program
+	if words[1] != 0 || words[2] != 2 || words[3] != wdbProgram {
+		return req, errors.New("not a WDB RPC call")
+	}
+	req.XID = words[0]
+	req.Procedure = words[5]
+	req.Operation = wdbProcedures[req.Procedure]
+	req.Sequence = words[12]
+
+	body := data[wdbRequestHeaderLen:]
+	for i := 0; i+4 <= len(body) && i < 16; i += 4 {
+		req.Args = append(req.Args, binary.BigEndian.Uint32(body[i:i+4]))
+	}
+	return req, nil
+}
+
+func xdrString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.WriteString(s)
+	if pad := len(s) % 4; pad != 0 {
+		buf.Write(make([]byte, 4-pad))
+	}
+}
+
+// wdbChecksum is the ones' complement sum used by the WDB agent
+func wdbChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i : i+2]))
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// wdbTargetInfo is the body of a connect reply describing a VxWorks target
+func wdbTargetInfo() []byte {
+	buf := &bytes.Buffer{}
+	xdrString(buf, "2.0") // agent version
+	binary.Write(buf, binary.BigEndian, []uint32{
+		1500, // agent MTU
+		2,    // agent mode: task
+		0,    // runtime type: VxWorks
+	})
+	xdrString(buf, "5.5.1")
+	binary.Write(buf, binary.BigEndian, []uint32{
+		81,     // CPU type: PPC603
+		1,      // has floating point
+		1,      // has write protect
+		0x1000, // page size
+		4321,   // big endian
+	})
+	xdrString(buf, "PPC 603")
+	xdrString(buf, "")
+	binary.Write(buf, binary.BigEndian, []uint32{
+		0x0,       // memory base
+		0x2000000, // memory size
+		0,         // region count
+		0,         // regions
+		0x1fe0000, // host pool base
+		0x10000,   // host pool size
+	})
+	return buf.Bytes()
+}
+
+// wdbReply creates a successful ONC-RPC reply carrying a WDB body
+func wdbReply(req wdbRequest, body []byte) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, []uint32{
+		req.XID,
+		1, // REPLY
+		0, // MSG_ACCEPTED
+		0, // verifier flavor
+		0, // verifier length
+		0, // SUCCESS
+		0, // checksum
+		uint32(24 + 12 + len(body) - 4),
+		0, // WDB_OK
+	})
+	buf.Write(body)
+	reply := buf.Bytes()
+	binary.BigEndian.PutUint32(reply[24:28], 0xffff0000|uint32(wdbChecksum(reply)))
+	return reply
+}
+
+// HandleWDB handles VxWorks WDB debug agent RPC requests
+func HandleWDB(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedWDB{}
+	defer func() {
+		if err := h.ProduceUDP("wdb", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "wdb"), producer.ErrAttr(err))
+		}
+	}()
+
+	req, err := parseWDB(data)
+	if err != nil {
+		logger.Debug("Failed to parse WDB request", slog.String("protocol", "wdb"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, parsedWDB{
+		Direction: "read",
+		Request:   req,
+		Payload:   data,
+	})
+	logger.Info(
+		fmt.Sprintf("WDB %s request", req.Operation),
+		slog.String("protocol", "wdb"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.Uint64("procedure", uint64(req.Procedure)),
+		slog.Any("args", req.Args),
+	)
+
+	var body []byte
+	switch req.Operation {
+	case "target_connect":
+		body = wdbTargetInfo()
+	case "mem_read":
+		// zero filled memory, never larger than the request
+		if len(req.Args) > 1 && int(req.Args[1]) < len(data) {
+			body = make([]byte, 4+(int(req.Args[1])+3)&^3)
+			binary.BigEndian.PutUint32(body, req.Args[1])
+		}
+	}
+	resp := wdbReply(req, body)
+	events = append(events, parsedWDB{
+		Direction: "write",
+		Request:   req,
+		Payload:   resp,
+	})
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send WDB response", slog.String("protocol", "wdb"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package udp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func wdbCall(procedure uint32, args ...uint32) []byte {
+	words := []uint32{0x1234, 0, 2, wdbProgram, 1, procedure, 0, 0, 0, 0, 0xffff0000, 0, 1}
+	words = append(words, args...)
+	data := make([]byte, len(words)*4)
+	for i, w := range words {
+		binary.BigEndian.PutUint32(data[i*4:], w)
+	}
+	return data
+}
+
+func TestParseWDB(t *testing.T) {
+	req, err := parseWDB(wdbCall(10, 0x80000000, 64))
+	require.NoError(t, err)
+	require.Equal(t, uint32(0x1234), req.XID)
+	require.Equal(t, "mem_read", req.Operation)
+	require.Equal(t, []uint32{0x80000000, 64}, req.Args)
+
+	_, err = parseWDB([]byte("not a wdb request, but long enough to parse the header"))
+	require.Error(t, err)
+}
+
+func TestWDBReply(t *testing.T) {
+	req, err := parseWDB(wdbCall(1))
+	require.NoError(t, err)
+	reply := wdbReply(req, wdbTargetInfo())
+	require.Equal(t, uint32(0x1234), binary.BigEndian.Uint32(reply[0:4]))
+	require.Equal(t, uint32(1), binary.BigEndian.Uint32(reply[4:8]), "expected RPC reply")
+	require.Contains(t, string(reply), "5.5.1")
+	require.LessOrEqual(t, len(reply), maxAmplification*len(wdbCall(1)))
+}
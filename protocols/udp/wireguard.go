@@ -0,0 +1,152 @@
+package udp
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	wgInitiation = 1
+	wgResponse   = 2
+	wgCookie     = 3
+	wgTransport  = 4
+
+	wgInitiationSize = 148
+	wgResponseSize   = 92
+	wgCookieSize     = 64
+	wgTransportMin   = 32
+)
+
+var wgMessageTypes = map[byte]string{
+	wgInitiation: "initiation",
+	wgResponse:   "response",
+	wgCookie:     "cookie_reply",
+	wgTransport:  "transport",
+}
+
+// wgStaticKey is the static key of the responder, its public half keys the
+// cookie replies the way a real endpoint would
+var wgStaticKey = func() *ecdh.PrivateKey {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// wgCookieSecret keys the cookies handed to sources
+var wgCookieSecret = func() []byte {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return secret
+}()
+
+type parsedWireGuard struct {
+	Type          string `json:"type"`
+	SenderIndex   uint32 `json:"sender_index,omitempty"`
+	ReceiverIndex uint32 `json:"receiver_index,omitempty"`
+	Ephemeral     string `json:"ephemeral,omitempty"`
+	MAC1          string `json:"mac1,omitempty"`
+	MAC2          string `json:"mac2,omitempty"`
+}
+
+func wgMAC(key, data []byte) []byte {
+	mac, _ := blake2s.New128(key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// wgCookieReply hands the initiator a cookie for its address, encrypted
+// with the hash of our public key and bound to the mac1 of the initiation
+func wgCookieReply(msg []byte, addr *net.UDPAddr) ([]byte, error) {
+	ip := addr.IP.To16()
+	cookie := wgMAC(wgCookieSecret, binary.BigEndian.AppendUint16(append([]byte{}, ip...), uint16(addr.Port)))
+	key := blake2s.Sum256(append([]byte("cookie--"), wgStaticKey.PublicKey().Bytes()...))
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return nil, err
+	}
+	resp := []byte{wgCookie, 0, 0, 0}
+	// the receiver is the sender of the initiation
+	resp = append(resp, msg[4:8]...)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	resp = append(resp, nonce...)
+	return aead.Seal(resp, nonce, cookie, msg[116:132]), nil
+}
+
+// parseWireGuard decodes the unencrypted fields of a WireGuard message
+func parseWireGuard(data []byte) (parsedWireGuard, error) {
+	if len(data) < 4 || data[1] != 0 || data[2] != 0 || data[3] != 0 {
+		return parsedWireGuard{}, errors.New("not a WireGuard message")
+	}
+	msg := parsedWireGuard{Type: wgMessageTypes[data[0]]}
+	switch {
+	case data[0] == wgInitiation && len(data) == wgInitiationSize:
+		msg.SenderIndex = binary.LittleEndian.Uint32(data[4:])
+		msg.Ephemeral = hex.EncodeToString(data[8:40])
+		msg.MAC1 = hex.EncodeToString(data[116:132])
+		msg.MAC2 = hex.EncodeToString(data[132:148])
+	case data[0] == wgResponse && len(data) == wgResponseSize:
+		msg.SenderIndex = binary.LittleEndian.Uint32(data[4:])
+		msg.ReceiverIndex = binary.LittleEndian.Uint32(data[8:])
+		msg.Ephemeral = hex.EncodeToString(data[12:44])
+		msg.MAC1 = hex.EncodeToString(data[60:76])
+		msg.MAC2 = hex.EncodeToString(data[76:92])
+	case data[0] == wgCookie && len(data) == wgCookieSize,
+		data[0] == wgTransport && len(data) >= wgTransportMin:
+		msg.ReceiverIndex = binary.LittleEndian.Uint32(data[4:])
+	default:
+		return parsedWireGuard{}, errors.New("invalid WireGuard message")
+	}
+	return msg, nil
+}
+
+// HandleWireGuard records WireGuard handshakes. Initiations are answered
+// with a cookie reply, telling VPN scanners apart from other UDP noise.
+func HandleWireGuard(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	msg, err := parseWireGuard(data)
+	defer func() {
+		if err := h.ProduceUDP("wireguard", srcAddr, dstAddr, md, data, msg); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "wireguard"), producer.ErrAttr(err))
+		}
+	}()
+	if err != nil {
+		logger.Debug("Failed to parse WireGuard message", slog.String("protocol", "wireguard"), producer.ErrAttr(err))
+		return nil
+	}
+	logger.Info(
+		"WireGuard message",
+		slog.String("handler", "wireguard"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("type", msg.Type),
+		slog.Uint64("sender_index", uint64(msg.SenderIndex)),
+		slog.String("mac1", msg.MAC1),
+		slog.String("mac2", msg.MAC2),
+	)
+	if data[0] != wgInitiation {
+		return nil
+	}
+	resp, err := wgCookieReply(data, srcAddr)
+	if err != nil {
+		return err
+	}
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send WireGuard cookie reply", slog.String("protocol", "wireguard"), producer.ErrAttr(err))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package udp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestWireGuardCookieReply(t *testing.T) {
+	initiation := make([]byte, wgInitiationSize)
+	_, _ = rand.Read(initiation)
+	copy(initiation, []byte{wgInitiation, 0, 0, 0})
+	binary.LittleEndian.PutUint32(initiation[4:], 0xdeadbeef)
+
+	msg, err := parseWireGuard(initiation)
+	require.NoError(t, err)
+	require.Equal(t, "initiation", msg.Type)
+	require.Equal(t, uint32(0xdeadbeef), msg.SenderIndex)
+	require.Len(t, msg.MAC1, 32)
+
+	addr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820}
+	resp, err := wgCookieReply(initiation, addr)
+	require.NoError(t, err)
+	require.Len(t, resp, wgCookieSize)
+	reply, err := parseWireGuard(resp)
+	require.NoError(t, err)
+	require.Equal(t, parsedWireGuard{Type: "cookie_reply", ReceiverIndex: 0xdeadbeef}, reply)
+
+	// the initiator decrypts the cookie with the public key it dialed
+	key := blake2s.Sum256(append([]byte("cookie--"), wgStaticKey.PublicKey().Bytes()...))
+	aead, err := chacha20poly1305.NewX(key[:])
+	require.NoError(t, err)
+	cookie, err := aead.Open(nil, resp[8:32], resp[32:], initiation[116:132])
+	require.NoError(t, err)
+	require.Len(t, cookie, 16)
+
+	_, err = parseWireGuard(initiation[:100])
+	require.Error(t, err)
+}
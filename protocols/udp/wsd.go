@@ -0,0 +1,122 @@
+package udp
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mushorg/glutton/connection"
+	"github.com/mushorg/glutton/producer"
+	"github.com/mushorg/glutton/protocols/interfaces"
+)
+
+const (
+	wsdProbeAction = "http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe"
+	wsdDeviceUUID  = "urn:uuid:4d454930-3030-3030-3030-e0508bd96c1a"
+)
+
+// wsdProbeMatch presents the sensor as an ONVIF camera, the only part
+// varying between answers is the message ID, the probe it relates to and
+// the address of the device service
+const wsdProbeMatch = `<?xml version="1.0" encoding="UTF-8"?>` +
+	`<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">` +
+	`<SOAP-ENV:Header>` +
+	`<wsa:MessageID>urn:uuid:%s</wsa:MessageID>` +
+	`<wsa:RelatesTo>%s</wsa:RelatesTo>` +
+	`<wsa:To>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</wsa:To>` +
+	`<wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/ProbeMatches</wsa:Action>` +
+	`</SOAP-ENV:Header>` +
+	`<SOAP-ENV:Body><d:ProbeMatches><d:ProbeMatch>` +
+	`<wsa:EndpointReference><wsa:Address>` + wsdDeviceUUID + `</wsa:Address></wsa:EndpointReference>` +
+	`<d:Types>dn:NetworkVideoTransmitter tds:Device</d:Types>` +
+	`<d:Scopes>onvif://www.onvif.org/type/video_encoder onvif://www.onvif.org/Profile/Streaming onvif://www.onvif.org/hardware/DS-2CD2042WD-I onvif://www.onvif.org/name/HIKVISION</d:Scopes>` +
+	`<d:XAddrs>http://%s/onvif/device_service</d:XAddrs>` +
+	`<d:MetadataVersion>10</d:MetadataVersion>` +
+	`</d:ProbeMatch></d:ProbeMatches></SOAP-ENV:Body></SOAP-ENV:Envelope>`
+
+type wsdEnvelope struct {
+	Action    string `xml:"Header>Action"`
+	MessageID string `xml:"Header>MessageID"`
+	Types     string `xml:"Body>Probe>Types"`
+	Scopes    string `xml:"Body>Probe>Scopes"`
+}
+
+type wsdMessage struct {
+	Action    string   `json:"action,omitempty"`
+	MessageID string   `json:"message_id,omitempty"`
+	Types     []string `json:"types,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+}
+
+type parsedWSD struct {
+	Direction string     `json:"direction,omitempty"`
+	Message   wsdMessage `json:"message,omitempty"`
+	Payload   []byte     `json:"payload,omitempty"`
+}
+
+func parseWSD(data []byte) (wsdMessage, error) {
+	envelope := wsdEnvelope{}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return wsdMessage{}, err
+	}
+	msg := wsdMessage{
+		Action:    strings.TrimSpace(envelope.Action),
+		MessageID: strings.TrimSpace(envelope.MessageID),
+		Types:     strings.Fields(envelope.Types),
+		Scopes:    strings.Fields(envelope.Scopes),
+	}
+	if msg.Action == "" {
+		return msg, errors.New("WS-Discovery message without action")
+	}
+	return msg, nil
+}
+
+// wsdResponse answers Probe messages with a ProbeMatch pointing at the
+// address the probe was sent to, other messages get no answer
+func wsdResponse(msg wsdMessage, ip net.IP) []byte {
+	if msg.Action != wsdProbeAction || msg.MessageID == "" {
+		return nil
+	}
+	return []byte(fmt.Sprintf(wsdProbeMatch, uuid.New(), html.EscapeString(msg.MessageID), ip))
+}
+
+// HandleWSD records WS-Discovery messages and answers probes like an ONVIF
+// camera
+func HandleWSD(ctx context.Context, srcAddr, dstAddr *net.UDPAddr, data []byte, md connection.Metadata, logger interfaces.Logger, h interfaces.Honeypot) error {
+	events := []parsedWSD{}
+	defer func() {
+		if err := h.ProduceUDP("wsd", srcAddr, dstAddr, md, data, events); err != nil {
+			logger.Error("Failed to produce message", slog.String("protocol", "wsd"), producer.ErrAttr(err))
+		}
+	}()
+
+	msg, err := parseWSD(data)
+	if err != nil {
+		logger.Debug("Failed to parse WS-Discovery message", slog.String("protocol", "wsd"), producer.ErrAttr(err))
+		return nil
+	}
+	events = append(events, parsedWSD{Direction: "read", Message: msg, Payload: data})
+	logger.Info(
+		"WS-Discovery message",
+		slog.String("handler", "wsd"),
+		slog.String("src_ip", srcAddr.IP.String()),
+		slog.String("action", msg.Action),
+		slog.String("types", strings.Join(msg.Types, " ")),
+	)
+	resp := wsdResponse(msg, dstAddr.IP)
+	if resp == nil {
+		return nil
+	}
+
+	events = append(events, parsedWSD{Direction: "write", Message: msg, Payload: resp})
+	if err := sendResponse(srcAddr, dstAddr, data, resp); err != nil {
+		logger.Debug("Failed to send WS-Discovery response", slog.String("protocol", "wsd"), producer.ErrAttr(err))
+	}
+	return nil
+}
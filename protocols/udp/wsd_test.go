@@ -0,0 +1,39 @@
+package udp
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const wsdProbe = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:tns="http://schemas.xmlsoap.org/ws/2005/04/discovery">` +
+	`<soap:Header><wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</wsa:Action>` +
+	`<wsa:MessageID>urn:uuid:0a6dc791-2be6-4991-9af1-454778a1917a</wsa:MessageID>` +
+	`<wsa:To>urn:schemas-xmlsoap-org:ws:2005:04:discovery</wsa:To></soap:Header>` +
+	`<soap:Body><tns:Probe><tns:Types>dn:NetworkVideoTransmitter</tns:Types></tns:Probe></soap:Body></soap:Envelope>`
+
+func TestWSDResponse(t *testing.T) {
+	msg, err := parseWSD([]byte(wsdProbe))
+	require.NoError(t, err)
+	require.Equal(t, wsdMessage{
+		Action:    wsdProbeAction,
+		MessageID: "urn:uuid:0a6dc791-2be6-4991-9af1-454778a1917a",
+		Types:     []string{"dn:NetworkVideoTransmitter"},
+		Scopes:    []string{},
+	}, msg)
+
+	resp := wsdResponse(msg, net.ParseIP("192.0.2.1"))
+	require.True(t, strings.Contains(string(resp), "<wsa:RelatesTo>urn:uuid:0a6dc791-2be6-4991-9af1-454778a1917a</wsa:RelatesTo>"))
+	require.True(t, strings.Contains(string(resp), "http://192.0.2.1/onvif/device_service"))
+	require.LessOrEqual(t, len(resp), maxAmplification*len(wsdProbe))
+
+	msg.Action = "http://schemas.xmlsoap.org/ws/2005/04/discovery/Hello"
+	require.Nil(t, wsdResponse(msg, net.ParseIP("192.0.2.1")))
+
+	// the bare payload used by amplification scanners is not answered
+	_, err = parseWSD([]byte("<:/>"))
+	require.Error(t, err)
+}
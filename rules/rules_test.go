@@ -140,3 +140,33 @@ func TestWorkingMatch(t *testing.T) {
 		t.Fatal("didn't match")
 	}
 }
+
+func TestMatchSourcePort(t *testing.T) {
+	fh, err := os.Open("../config/rules.yaml")
+	require.NoError(t, err)
+	defer fh.Close()
+	rules, err := Init(fh)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		network string
+		srcPort int
+		dstPort int
+		target  string
+	}{
+		{"tcp", 40000, 6666, "irc"},
+		{"tcp", 40000, 1389, "ldap"},
+		// a client port matching a handler port does not pick the handler
+		{"tcp", 6666, 80, "tcp"},
+		{"tcp", 1389, 80, "tcp"},
+		{"udp", 6666, 80, "udp"},
+		{"udp", 40000, 1389, "udp"},
+	} {
+		src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: tc.srcPort}
+		dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: tc.dstPort}
+		match, err := rules.Match(tc.network, src, dst)
+		require.NoError(t, err)
+		require.NotNil(t, match)
+		require.Equal(t, tc.target, match.Target, "%s %d -> %d", tc.network, tc.srcPort, tc.dstPort)
+	}
+}
@@ -0,0 +1,119 @@
+// Package storage keeps the payloads captured by the handlers once, under
+// the sha256 digest they are referenced by from events
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrTooLarge is returned for payloads over the size limit of a store
+	ErrTooLarge = errors.New("payload exceeds the size limit")
+	// ErrFull is returned for new payloads once a store is full
+	ErrFull = errors.New("payload store is full")
+)
+
+// Store is a content addressed directory of payloads, each stored once at
+// <dir>/<first two hex digits>/<sha256>
+type Store struct {
+	dir string
+	// maxSize bounds a payload and maxTotal the store in bytes, zero lifts
+	// the limit
+	maxSize  int64
+	maxTotal int64
+
+	mu    sync.Mutex
+	total int64
+}
+
+// Open opens the store in dir, creating it if needed, and sums up the size
+// of the payloads already stored
+func Open(dir string, maxSize, maxTotal int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, maxSize: maxSize, maxTotal: maxTotal}
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Hash returns the digest data is stored under
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Path returns where the payload with the digest hash is stored
+func (s *Store) Path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// Put stores data unless it is already, returning its digest and whether
+// it is new. The digest is returned as well when the payload is refused
+// for the size limits.
+func (s *Store) Put(data []byte) (string, bool, error) {
+	hash := Hash(data)
+	if s.maxSize > 0 && int64(len(data)) > s.maxSize {
+		return hash, false, ErrTooLarge
+	}
+	path := s.Path(hash)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(path); err == nil {
+		return hash, false, nil
+	}
+	if s.maxTotal > 0 && s.total+int64(len(data)) > s.maxTotal {
+		return hash, false, ErrFull
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return hash, false, err
+	}
+	// written aside first so a payload is only ever seen complete
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".tmp")
+	if err != nil {
+		return hash, false, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return hash, false, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return hash, false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return hash, false, err
+	}
+	s.total += int64(len(data))
+	return hash, true, nil
+}
+
+// Get reads the payload stored under hash
+func (s *Store) Get(hash string) ([]byte, error) {
+	if len(hash) != sha256.Size*2 {
+		return nil, fs.ErrNotExist
+	}
+	return os.ReadFile(s.Path(hash))
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutDeduplicates(t *testing.T) {
+	s, err := Open(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	hash, stored, err := s.Put([]byte("payload"))
+	require.NoError(t, err)
+	require.True(t, stored)
+	require.Equal(t, Hash([]byte("payload")), hash)
+	require.FileExists(t, s.Path(hash))
+
+	again, stored, err := s.Put([]byte("payload"))
+	require.NoError(t, err)
+	require.False(t, stored)
+	require.Equal(t, hash, again)
+
+	data, err := s.Get(hash)
+	require.NoError(t, err)
+	require.Equal(t, []byte("payload"), data)
+
+	_, err = s.Get("../../etc/passwd")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestPutLimits(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 4, 6)
+	require.NoError(t, err)
+
+	hash, _, err := s.Put([]byte("too large"))
+	require.ErrorIs(t, err, ErrTooLarge)
+	require.Equal(t, Hash([]byte("too large")), hash)
+
+	_, _, err = s.Put([]byte("abcd"))
+	require.NoError(t, err)
+	_, _, err = s.Put([]byte("efgh"))
+	require.ErrorIs(t, err, ErrFull)
+	// known payloads are still referenced once the store is full
+	_, _, err = s.Put([]byte("abcd"))
+	require.NoError(t, err)
+
+	s, err = Open(dir, 4, 6)
+	require.NoError(t, err)
+	_, _, err = s.Put([]byte("efgh"))
+	require.ErrorIs(t, err, ErrFull)
+}
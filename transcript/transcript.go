@@ -0,0 +1,199 @@
+// Package transcript records the bytes exchanged in a session along with
+// their timing and plays them back
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Directions of a chunk
+const (
+	// In is read from the client
+	In = "i"
+	// Out is written to the client
+	Out = "o"
+)
+
+// Header describes the session of a transcript
+type Header struct {
+	ID      string    `json:"id"`
+	Handler string    `json:"handler"`
+	Src     string    `json:"src"`
+	DstPort uint16    `json:"dst_port"`
+	Started time.Time `json:"started"`
+	// Truncated is set if the session went on past the size limit
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Chunk is the data of a single read or write
+type Chunk struct {
+	// Time is the offset into the session in seconds
+	Time float64 `json:"t"`
+	Dir  string  `json:"d"`
+	Data []byte  `json:"data"`
+}
+
+// Transcript is a recorded session. It is stored as JSON lines, the header
+// first and a line per chunk after it.
+type Transcript struct {
+	Header
+	Chunks []Chunk
+}
+
+// Encode writes t as JSON lines
+func (t *Transcript) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(t.Header); err != nil {
+		return err
+	}
+	for _, chunk := range t.Chunks {
+		if err := enc.Encode(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads a transcript written by Encode
+func Decode(r io.Reader) (*Transcript, error) {
+	t := &Transcript{}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	if err := dec.Decode(&t.Header); err != nil {
+		return nil, fmt.Errorf("invalid transcript header: %w", err)
+	}
+	for {
+		var chunk Chunk
+		err := dec.Decode(&chunk)
+		if errors.Is(err, io.EOF) {
+			return t, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid transcript chunk: %w", err)
+		}
+		t.Chunks = append(t.Chunks, chunk)
+	}
+}
+
+// Path returns where the transcript with id is stored in dir
+func Path(dir, id string) string {
+	return filepath.Join(dir, id+".jsonl")
+}
+
+// Load reads the transcript with id from dir
+func Load(dir, id string) (*Transcript, error) {
+	file, err := os.Open(Path(dir, id))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Decode(file)
+}
+
+// Recorder is a connection recording what is read from and written to it,
+// up to maxSize bytes
+type Recorder struct {
+	net.Conn
+	maxSize int
+
+	mu         sync.Mutex
+	transcript Transcript
+	size       int
+}
+
+func NewRecorder(conn net.Conn, handler string, dstPort uint16, maxSize int) *Recorder {
+	return &Recorder{
+		Conn:    conn,
+		maxSize: maxSize,
+		transcript: Transcript{Header: Header{
+			ID:      uuid.NewString(),
+			Handler: handler,
+			Src:     conn.RemoteAddr().String(),
+			DstPort: dstPort,
+			Started: time.Now().UTC(),
+		}},
+	}
+}
+
+// ID returns the id of the transcript being recorded
+func (r *Recorder) ID() string {
+	return r.transcript.ID
+}
+
+func (r *Recorder) record(dir string, p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSize > 0 && r.size+len(p) > r.maxSize {
+		p = p[:max(r.maxSize-r.size, 0)]
+		r.transcript.Truncated = true
+		if len(p) == 0 {
+			return
+		}
+	}
+	r.size += len(p)
+	r.transcript.Chunks = append(r.transcript.Chunks, Chunk{
+		Time: time.Since(r.transcript.Started).Seconds(),
+		Dir:  dir,
+		Data: append([]byte(nil), p...),
+	})
+}
+
+func (r *Recorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	r.record(In, p[:n])
+	return n, err
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	n, err := r.Conn.Write(p)
+	r.record(Out, p[:n])
+	return n, err
+}
+
+// Transcript returns a copy of what is recorded so far
+func (r *Recorder) Transcript() *Transcript {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.transcript
+	t.Chunks = append([]Chunk(nil), t.Chunks...)
+	return &t
+}
+
+// Play writes the chunks of t in the directions dirs to w, waiting between
+// them as long as the session did divided by speed. Pauses are cut to
+// idleLimit if it is set.
+func Play(w io.Writer, t *Transcript, dirs []string, speed float64, idleLimit time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+	last := 0.0
+	for _, chunk := range t.Chunks {
+		if !slices.Contains(dirs, chunk.Dir) {
+			continue
+		}
+		wait := time.Duration((chunk.Time - last) / speed * float64(time.Second))
+		if idleLimit > 0 {
+			wait = min(wait, idleLimit)
+		}
+		time.Sleep(wait)
+		last = chunk.Time
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package transcript
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	r := NewRecorder(server, "telnet", 23, 12)
+	defer r.Close()
+
+	go func() {
+		client.Write([]byte("root\n"))
+		io.ReadFull(client, make([]byte, 10))
+		client.Write([]byte("uname -a\n"))
+	}()
+	buf := make([]byte, 64)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "root\n", string(buf[:n]))
+	_, err = r.Write([]byte("Password: "))
+	require.NoError(t, err)
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+
+	tr := r.Transcript()
+	require.Equal(t, r.ID(), tr.ID)
+	require.Equal(t, "telnet", tr.Handler)
+	require.Equal(t, uint16(23), tr.DstPort)
+	require.True(t, tr.Truncated)
+	require.Len(t, tr.Chunks, 2)
+	require.Equal(t, Chunk{Time: tr.Chunks[0].Time, Dir: In, Data: []byte("root\n")}, tr.Chunks[0])
+	require.Equal(t, Out, tr.Chunks[1].Dir)
+	require.Equal(t, "Passwor", string(tr.Chunks[1].Data))
+
+	var out bytes.Buffer
+	require.NoError(t, tr.Encode(&out))
+	decoded, err := Decode(&out)
+	require.NoError(t, err)
+	require.Equal(t, tr.Header.ID, decoded.ID)
+	require.True(t, tr.Started.Equal(decoded.Started))
+	require.Equal(t, tr.Chunks, decoded.Chunks)
+}
+
+func TestPlay(t *testing.T) {
+	tr := &Transcript{Chunks: []Chunk{
+		{Time: 0, Dir: Out, Data: []byte("login: ")},
+		{Time: 0.1, Dir: In, Data: []byte("root\n")},
+		{Time: 60, Dir: Out, Data: []byte("$ ")},
+	}}
+	var out bytes.Buffer
+	started := time.Now()
+	require.NoError(t, Play(&out, tr, []string{Out}, 10, 10*time.Millisecond))
+	require.Less(t, time.Since(started), time.Second)
+	require.Equal(t, "login: $ ", out.String())
+
+	out.Reset()
+	require.NoError(t, Play(&out, tr, []string{In, Out}, 100, time.Millisecond))
+	require.Equal(t, "login: root\n$ ", out.String())
+}
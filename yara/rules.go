@@ -0,0 +1,880 @@
+// Package yara matches payloads against YARA rules. It implements the
+// commonly used part of the rule language in Go: text, hex and regular
+// expression strings, string counts and offsets, integer reads, filesize,
+// string sets and references to other rules in conditions. Modules are not
+// supported.
+package yara
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxMatches bounds the offsets recorded per string
+const maxMatches = 1000
+
+// Match is a rule matching a payload
+type Match struct {
+	Rule string            `json:"rule"`
+	Tags []string          `json:"tags,omitempty"`
+	Meta map[string]string `json:"meta,omitempty"`
+	// Strings are the identifiers of the strings found
+	Strings []string `json:"strings,omitempty"`
+	// PayloadHash is the sha256 of the stored payload matched, empty for
+	// the payload of the event itself
+	PayloadHash string `json:"payload_hash,omitempty"`
+}
+
+type pattern struct {
+	id string
+	re *regexp.Regexp
+	// fullword requires the match to be delimited by non alphanumeric bytes
+	fullword bool
+}
+
+type rule struct {
+	name      string
+	tags      []string
+	meta      map[string]string
+	private   bool
+	global    bool
+	strings   []pattern
+	condition boolExpr
+}
+
+// Rules is a compiled set of rules, evaluated in the order defined
+type Rules struct {
+	rules []*rule
+}
+
+// scan is the state of matching one payload
+type scan struct {
+	data []byte
+	// text holds a rune per byte of data for the patterns to match bytes
+	text string
+	// offsets of the strings of the rule being evaluated
+	offsets [][]int
+	results map[string]bool
+}
+
+type (
+	boolExpr func(*scan) bool
+	intExpr  func(*scan) int64
+)
+
+// latin1 maps every byte to the rune of the same value
+func latin1(data []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(data) * 2)
+	for _, b := range data {
+		sb.WriteRune(rune(b))
+	}
+	return sb.String()
+}
+
+func isAlnum(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// find returns the offsets in data a pattern matches at
+func (p pattern) find(s *scan) []int {
+	offsets := []int{}
+	pos, prev := 0, 0
+	for _, loc := range p.re.FindAllStringIndex(s.text, maxMatches) {
+		pos += utf8.RuneCountInString(s.text[prev:loc[0]])
+		end := pos + utf8.RuneCountInString(s.text[loc[0]:loc[1]])
+		prev = loc[0]
+		if p.fullword && (pos > 0 && isAlnum(s.data[pos-1]) || end < len(s.data) && isAlnum(s.data[end])) {
+			continue
+		}
+		offsets = append(offsets, pos)
+	}
+	return offsets
+}
+
+// Scan returns the rules matching data, none if a global rule does not
+func (r *Rules) Scan(data []byte) []Match {
+	if r == nil || len(r.rules) == 0 {
+		return nil
+	}
+	s := &scan{data: data, text: latin1(data), results: map[string]bool{}}
+	matches := []Match{}
+	for _, rule := range r.rules {
+		s.offsets = make([][]int, len(rule.strings))
+		for i, p := range rule.strings {
+			s.offsets[i] = p.find(s)
+		}
+		matched := rule.condition(s)
+		s.results[rule.name] = matched
+		if !matched {
+			if rule.global {
+				return nil
+			}
+			continue
+		}
+		if rule.private {
+			continue
+		}
+		match := Match{Rule: rule.name, Tags: rule.tags, Meta: rule.meta}
+		for i, p := range rule.strings {
+			if len(s.offsets[i]) > 0 {
+				match.Strings = append(match.Strings, p.id)
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+// Compile compiles the rules in src
+func Compile(src string) (*Rules, error) {
+	c := newCompiler()
+	if err := c.add("", src); err != nil {
+		return nil, err
+	}
+	return c.rules(), nil
+}
+
+// compiler collects the rules of several sources, later ones may refer to
+// the rules defined before
+type compiler struct {
+	defined []*rule
+	names   map[string]bool
+}
+
+func newCompiler() *compiler {
+	return &compiler{names: map[string]bool{}}
+}
+
+func (c *compiler) rules() *Rules {
+	return &Rules{rules: c.defined}
+}
+
+// parseError carries a syntax error out of the recursive descent
+type parseError struct {
+	err error
+}
+
+func (c *compiler) add(name, src string) (err error) {
+	p := &parser{src: src, compiler: c}
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(parseError)
+			if !ok {
+				panic(r)
+			}
+			line := strings.Count(src[:min(p.pos, len(src))], "\n") + 1
+			if name != "" {
+				err = fmt.Errorf("%s:%d: %w", name, line, perr.err)
+			} else {
+				err = fmt.Errorf("line %d: %w", line, perr.err)
+			}
+		}
+	}()
+	p.file()
+	return nil
+}
+
+type parser struct {
+	src      string
+	pos      int
+	compiler *compiler
+	// current is the rule being parsed
+	current *rule
+}
+
+func (p *parser) fail(format string, args ...any) {
+	panic(parseError{fmt.Errorf(format, args...)})
+}
+
+// skip moves past white space and comments
+func (p *parser) skip() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])):
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.fail("unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func isIdent(b byte) bool {
+	return isAlnum(b) || b == '_'
+}
+
+// ident reads an identifier, empty if there is none
+func (p *parser) ident() string {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.src) && isIdent(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// keyword consumes the keyword kw if it comes next
+func (p *parser) keyword(kw string) bool {
+	p.skip()
+	end := p.pos + len(kw)
+	if !strings.HasPrefix(p.src[p.pos:], kw) || end < len(p.src) && isIdent(p.src[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// accept consumes the token tok if it comes next
+func (p *parser) accept(tok string) bool {
+	p.skip()
+	if strings.HasPrefix(p.src[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(tok string) {
+	if !p.accept(tok) {
+		p.fail("expected %q", tok)
+	}
+}
+
+func (p *parser) file() {
+	for p.peek() != 0 {
+		if p.keyword("import") || p.keyword("include") {
+			p.fail("imports and includes are not supported")
+		}
+		r := &rule{meta: map[string]string{}}
+		for {
+			if p.keyword("private") {
+				r.private = true
+			} else if p.keyword("global") {
+				r.global = true
+			} else {
+				break
+			}
+		}
+		if !p.keyword("rule") {
+			p.fail("expected rule")
+		}
+		if r.name = p.ident(); r.name == "" {
+			p.fail("missing rule name")
+		}
+		if p.compiler.names[r.name] {
+			p.fail("duplicate rule %s", r.name)
+		}
+		if p.accept(":") {
+			for p.peek() != '{' && p.peek() != 0 {
+				r.tags = append(r.tags, p.ident())
+			}
+		}
+		p.expect("{")
+		p.current = r
+		if p.keyword("meta") {
+			p.expect(":")
+			p.meta(r)
+		}
+		if p.keyword("strings") {
+			p.expect(":")
+			p.strings(r)
+		}
+		if !p.keyword("condition") {
+			p.fail("missing condition of rule %s", r.name)
+		}
+		p.expect(":")
+		r.condition = p.boolean(p.expr())
+		p.expect("}")
+		if len(r.meta) == 0 {
+			r.meta = nil
+		}
+		p.compiler.defined = append(p.compiler.defined, r)
+		p.compiler.names[r.name] = true
+	}
+}
+
+func (p *parser) meta(r *rule) {
+	for {
+		start := p.pos
+		key := p.ident()
+		if key == "" || key == "strings" || key == "condition" {
+			p.pos = start
+			return
+		}
+		p.expect("=")
+		switch c := p.peek(); {
+		case c == '"':
+			r.meta[key] = string(p.text())
+		case p.keyword("true"):
+			r.meta[key] = "true"
+		case p.keyword("false"):
+			r.meta[key] = "false"
+		default:
+			neg := p.accept("-")
+			n := p.number()
+			if neg {
+				n = -n
+			}
+			r.meta[key] = strconv.FormatInt(n, 10)
+		}
+	}
+}
+
+func (p *parser) strings(r *rule) {
+	for p.peek() == '$' {
+		p.pos++
+		id := "$" + p.ident()
+		p.expect("=")
+		var expr string
+		var err error
+		switch p.peek() {
+		case '"':
+			lit := p.text()
+			nocase, wide, ascii, fullword := p.modifiers()
+			expr = textExpr(lit, wide, ascii)
+			if nocase {
+				expr = "(?i)" + expr
+			}
+			r.strings = append(r.strings, pattern{id: id, fullword: fullword})
+		case '{':
+			expr = p.hex()
+			if nocase, wide, _, fullword := p.modifiers(); nocase || wide || fullword {
+				p.fail("modifiers are not supported on hex strings")
+			}
+			r.strings = append(r.strings, pattern{id: id})
+		case '/':
+			expr = p.regex()
+			nocase, wide, _, fullword := p.modifiers()
+			if wide {
+				p.fail("wide regular expressions are not supported")
+			}
+			if nocase {
+				expr = "(?i)" + expr
+			}
+			r.strings = append(r.strings, pattern{id: id, fullword: fullword})
+		default:
+			p.fail("expected string, hex string or regular expression for %s", id)
+		}
+		last := &r.strings[len(r.strings)-1]
+		if last.re, err = regexp.Compile(expr); err != nil {
+			p.fail("string %s: %v", id, err)
+		}
+	}
+}
+
+// modifiers reads the modifiers following a string
+func (p *parser) modifiers() (nocase, wide, ascii, fullword bool) {
+	for {
+		switch {
+		case p.keyword("nocase"):
+			nocase = true
+		case p.keyword("wide"):
+			wide = true
+		case p.keyword("ascii"):
+			ascii = true
+		case p.keyword("fullword"):
+			fullword = true
+		case p.keyword("private"):
+		case p.keyword("xor"), p.keyword("base64"), p.keyword("base64wide"):
+			p.fail("xor and base64 modifiers are not supported")
+		default:
+			return
+		}
+	}
+}
+
+// text reads a double quoted string literal
+func (p *parser) text() []byte {
+	p.expect(`"`)
+	lit := []byte{}
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return lit
+		case '\\':
+			if p.pos >= len(p.src) {
+				p.fail("unterminated string")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				lit = append(lit, '\n')
+			case 't':
+				lit = append(lit, '\t')
+			case 'r':
+				lit = append(lit, '\r')
+			case 'x':
+				if p.pos+2 > len(p.src) {
+					p.fail("bad escape")
+				}
+				b, err := strconv.ParseUint(p.src[p.pos:p.pos+2], 16, 8)
+				if err != nil {
+					p.fail("bad escape \\x%s", p.src[p.pos:p.pos+2])
+				}
+				lit = append(lit, byte(b))
+				p.pos += 2
+			case '"', '\\':
+				lit = append(lit, e)
+			default:
+				p.fail("bad escape \\%c", e)
+			}
+		default:
+			lit = append(lit, c)
+		}
+	}
+}
+
+func byteExpr(b byte) string {
+	return fmt.Sprintf(`\x{%02x}`, b)
+}
+
+// textExpr matches lit as ASCII, as UTF-16 with wide or as both
+func textExpr(lit []byte, wide, ascii bool) string {
+	alts := []string{}
+	if ascii || !wide {
+		var sb strings.Builder
+		for _, b := range lit {
+			sb.WriteString(byteExpr(b))
+		}
+		alts = append(alts, sb.String())
+	}
+	if wide {
+		var sb strings.Builder
+		for _, b := range lit {
+			sb.WriteString(byteExpr(b) + byteExpr(0))
+		}
+		alts = append(alts, sb.String())
+	}
+	return "(?:" + strings.Join(alts, "|") + ")"
+}
+
+const anyByte = `[\x{00}-\x{ff}]`
+
+func hexValue(c byte) (byte, bool) {
+	v, err := strconv.ParseUint(string(c), 16, 8)
+	return byte(v), err == nil
+}
+
+// hex reads a hex string into the regular expression matching it
+func (p *parser) hex() string {
+	p.expect("{")
+	var sb strings.Builder
+	for {
+		c := p.peek()
+		switch {
+		case c == '}':
+			p.pos++
+			if sb.Len() == 0 {
+				p.fail("empty hex string")
+			}
+			return sb.String()
+		case c == '(':
+			p.pos++
+			sb.WriteString("(?:")
+		case c == '|' || c == ')':
+			p.pos++
+			sb.WriteByte(c)
+		case c == '[':
+			p.pos++
+			sb.WriteString(anyByte + p.jump())
+		case c != 0 && p.pos+1 < len(p.src):
+			hi, lo := p.src[p.pos], p.src[p.pos+1]
+			p.pos += 2
+			h, hok := hexValue(hi)
+			l, lok := hexValue(lo)
+			switch {
+			case hok && lok:
+				sb.WriteString(byteExpr(h<<4 | l))
+			case hi == '?' && lo == '?':
+				sb.WriteString(anyByte)
+			case hi == '?' && lok:
+				sb.WriteString("[")
+				for h := range byte(16) {
+					sb.WriteString(byteExpr(h<<4 | l))
+				}
+				sb.WriteString("]")
+			case hok && lo == '?':
+				sb.WriteString("[" + byteExpr(h<<4) + "-" + byteExpr(h<<4|0xf) + "]")
+			default:
+				p.fail("bad hex byte %c%c", hi, lo)
+			}
+		default:
+			p.fail("unterminated hex string")
+		}
+	}
+}
+
+// jump reads the [n-m] range of a hex string jump after its bracket
+func (p *parser) jump() string {
+	bound := func() string {
+		p.skip()
+		start := p.pos
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		if n, _ := strconv.Atoi(p.src[start:p.pos]); n > 1000 {
+			p.fail("jumps over 1000 bytes are not supported")
+		}
+		return p.src[start:p.pos]
+	}
+	lo := bound()
+	if p.accept("]") {
+		if lo == "" {
+			p.fail("empty jump")
+		}
+		return "{" + lo + "}"
+	}
+	p.expect("-")
+	hi := bound()
+	p.expect("]")
+	if lo == "" {
+		lo = "0"
+	}
+	return "{" + lo + "," + hi + "}"
+}
+
+// regex reads a /regular expression/ with its i and s flags
+func (p *parser) regex() string {
+	p.expect("/")
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.fail("unterminated regular expression")
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == '/' {
+			break
+		}
+		if c == '\\' && p.pos < len(p.src) && p.src[p.pos] == '/' {
+			c = '/'
+			p.pos++
+		}
+		sb.WriteByte(c)
+	}
+	flags := ""
+	for p.pos < len(p.src) && (p.src[p.pos] == 'i' || p.src[p.pos] == 's') {
+		flags += string(p.src[p.pos])
+		p.pos++
+	}
+	if flags != "" {
+		return "(?" + flags + ")" + sb.String()
+	}
+	return sb.String()
+}
+
+// term is a boolean or integer expression of a condition
+type term struct {
+	b boolExpr
+	i intExpr
+}
+
+func (p *parser) boolean(t term) boolExpr {
+	if t.b != nil {
+		return t.b
+	}
+	i := t.i
+	return func(s *scan) bool { return i(s) != 0 }
+}
+
+func (p *parser) integer(t term) intExpr {
+	if t.i == nil {
+		p.fail("expected an integer expression")
+	}
+	return t.i
+}
+
+func (p *parser) expr() term {
+	t := p.and()
+	for p.keyword("or") {
+		l, r := p.boolean(t), p.boolean(p.and())
+		t = term{b: func(s *scan) bool { return l(s) || r(s) }}
+	}
+	return t
+}
+
+func (p *parser) and() term {
+	t := p.not()
+	for p.keyword("and") {
+		l, r := p.boolean(t), p.boolean(p.not())
+		t = term{b: func(s *scan) bool { return l(s) && r(s) }}
+	}
+	return t
+}
+
+func (p *parser) not() term {
+	if p.keyword("not") {
+		x := p.boolean(p.not())
+		return term{b: func(s *scan) bool { return !x(s) }}
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() term {
+	t := p.additive()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.accept(op) {
+			continue
+		}
+		l, r := p.integer(t), p.integer(p.additive())
+		var cmp func(a, b int64) bool
+		switch op {
+		case "==":
+			cmp = func(a, b int64) bool { return a == b }
+		case "!=":
+			cmp = func(a, b int64) bool { return a != b }
+		case "<=":
+			cmp = func(a, b int64) bool { return a <= b }
+		case ">=":
+			cmp = func(a, b int64) bool { return a >= b }
+		case "<":
+			cmp = func(a, b int64) bool { return a < b }
+		case ">":
+			cmp = func(a, b int64) bool { return a > b }
+		}
+		return term{b: func(s *scan) bool { return cmp(l(s), r(s)) }}
+	}
+	return t
+}
+
+func (p *parser) additive() term {
+	t := p.primary()
+	for {
+		switch {
+		case p.accept("+"):
+			l, r := p.integer(t), p.integer(p.primary())
+			t = term{i: func(s *scan) int64 { return l(s) + r(s) }}
+		case p.accept("-"):
+			l, r := p.integer(t), p.integer(p.primary())
+			t = term{i: func(s *scan) int64 { return l(s) - r(s) }}
+		default:
+			return t
+		}
+	}
+}
+
+// number reads a decimal or 0x prefixed hex integer with an optional KB or
+// MB suffix
+func (p *parser) number() int64 {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.src) && isIdent(p.src[p.pos]) {
+		p.pos++
+	}
+	lit := p.src[start:p.pos]
+	unit := int64(1)
+	if strings.HasSuffix(lit, "KB") {
+		lit, unit = strings.TrimSuffix(lit, "KB"), 1<<10
+	} else if strings.HasSuffix(lit, "MB") {
+		lit, unit = strings.TrimSuffix(lit, "MB"), 1<<20
+	}
+	n, err := strconv.ParseInt(lit, 0, 64)
+	if err != nil {
+		p.fail("bad number %q", p.src[start:p.pos])
+	}
+	return n * unit
+}
+
+// stringRef reads the identifier after a $, # or @ and returns the index
+// of the string in the current rule
+func (p *parser) stringRef() int {
+	p.pos++
+	id := "$" + p.ident()
+	for i, s := range p.current.strings {
+		if s.id == id {
+			return i
+		}
+	}
+	p.fail("undefined string %s", id)
+	return 0
+}
+
+// set reads the strings of a quantifier, them or a list of identifiers
+// which may end with a * wildcard
+func (p *parser) set() []int {
+	if p.keyword("them") {
+		set := make([]int, len(p.current.strings))
+		for i := range set {
+			set[i] = i
+		}
+		return set
+	}
+	p.expect("(")
+	set := []int{}
+	for {
+		p.expect("$")
+		prefix := "$" + p.ident()
+		wildcard := p.accept("*")
+		found := false
+		for i, s := range p.current.strings {
+			if s.id == prefix || wildcard && strings.HasPrefix(s.id, prefix) {
+				set, found = append(set, i), true
+			}
+		}
+		if !found {
+			p.fail("undefined string %s", prefix)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	slices.Sort(set)
+	return slices.Compact(set)
+}
+
+// quantified builds n of set, n is -1 for all
+func (p *parser) quantified(n int64, none bool) term {
+	if !p.keyword("of") {
+		p.fail("expected of")
+	}
+	set := p.set()
+	return term{b: func(s *scan) bool {
+		found := int64(0)
+		for _, i := range set {
+			if len(s.offsets[i]) > 0 {
+				found++
+			}
+		}
+		switch {
+		case none:
+			return found == 0
+		case n < 0:
+			return found == int64(len(set))
+		}
+		return found >= n
+	}}
+}
+
+var readers = map[string]struct {
+	size int
+	read func([]byte) int64
+}{
+	"uint8":    {1, func(b []byte) int64 { return int64(b[0]) }},
+	"uint16":   {2, func(b []byte) int64 { return int64(binary.LittleEndian.Uint16(b)) }},
+	"uint32":   {4, func(b []byte) int64 { return int64(binary.LittleEndian.Uint32(b)) }},
+	"uint8be":  {1, func(b []byte) int64 { return int64(b[0]) }},
+	"uint16be": {2, func(b []byte) int64 { return int64(binary.BigEndian.Uint16(b)) }},
+	"uint32be": {4, func(b []byte) int64 { return int64(binary.BigEndian.Uint32(b)) }},
+	"int8":     {1, func(b []byte) int64 { return int64(int8(b[0])) }},
+	"int16":    {2, func(b []byte) int64 { return int64(int16(binary.LittleEndian.Uint16(b))) }},
+	"int32":    {4, func(b []byte) int64 { return int64(int32(binary.LittleEndian.Uint32(b))) }},
+}
+
+func (p *parser) primary() term {
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		t := p.expr()
+		p.expect(")")
+		return t
+	case c == '$':
+		i := p.stringRef()
+		if p.keyword("at") {
+			at := p.integer(p.additive())
+			return term{b: func(s *scan) bool { return slices.Contains(s.offsets[i], int(at(s))) }}
+		}
+		if p.keyword("in") {
+			p.expect("(")
+			lo := p.integer(p.additive())
+			p.expect("..")
+			hi := p.integer(p.additive())
+			p.expect(")")
+			return term{b: func(s *scan) bool {
+				l, h := lo(s), hi(s)
+				return slices.ContainsFunc(s.offsets[i], func(o int) bool { return int64(o) >= l && int64(o) <= h })
+			}}
+		}
+		return term{b: func(s *scan) bool { return len(s.offsets[i]) > 0 }}
+	case c == '#':
+		i := p.stringRef()
+		return term{i: func(s *scan) int64 { return int64(len(s.offsets[i])) }}
+	case c == '@':
+		i := p.stringRef()
+		p.expect("[")
+		n := p.integer(p.expr())
+		p.expect("]")
+		return term{i: func(s *scan) int64 {
+			if k := n(s); k >= 1 && k <= int64(len(s.offsets[i])) {
+				return int64(s.offsets[i][k-1])
+			}
+			return -1
+		}}
+	case c >= '0' && c <= '9':
+		n := p.number()
+		start := p.pos
+		if p.keyword("of") {
+			p.pos = start
+			return p.quantified(n, false)
+		}
+		return term{i: func(*scan) int64 { return n }}
+	case isIdent(c):
+		start := p.pos
+		name := p.ident()
+		switch name {
+		case "true":
+			return term{b: func(*scan) bool { return true }}
+		case "false":
+			return term{b: func(*scan) bool { return false }}
+		case "filesize":
+			return term{i: func(s *scan) int64 { return int64(len(s.data)) }}
+		case "any":
+			return p.quantified(1, false)
+		case "all":
+			return p.quantified(-1, false)
+		case "none":
+			return p.quantified(0, true)
+		}
+		if reader, ok := readers[name]; ok {
+			p.expect("(")
+			off := p.integer(p.expr())
+			p.expect(")")
+			return term{i: func(s *scan) int64 {
+				o := off(s)
+				if o < 0 || o+int64(reader.size) > int64(len(s.data)) {
+					return 0
+				}
+				return reader.read(s.data[o:])
+			}}
+		}
+		if p.compiler.names[name] {
+			return term{b: func(s *scan) bool { return s.results[name] }}
+		}
+		p.pos = start
+		p.fail("unknown identifier %s", name)
+	}
+	p.fail("unexpected input in condition")
+	return term{}
+}
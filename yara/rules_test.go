@@ -0,0 +1,143 @@
+package yara
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func ruleNames(matches []Match) []string {
+	names := []string{}
+	for _, m := range matches {
+		names = append(names, m.Rule)
+	}
+	return names
+}
+
+func TestScan(t *testing.T) {
+	rules, err := Compile(`
+/* downloaders seen on telnet */
+rule mirai : botnet iot {
+	meta:
+		author = "glutton"
+		score = 80
+	strings:
+		$busybox = "/bin/busybox MIRAI" nocase
+		$tftp = { 74 66 74 70 20 ?? 2D [1-4] 67 }
+		$url = /https?:\/\/[0-9.]+\/[a-z]+\.(arm|mips)/
+	condition:
+		$busybox or ($tftp and #url >= 1)
+}
+
+rule pe {
+	condition:
+		uint16(0) == 0x5A4D and filesize < 1MB
+}
+
+private rule elf_magic {
+	strings:
+		$magic = { 7F 45 4C 46 }
+	condition:
+		$magic at 0
+}
+
+rule elf_dropper {
+	strings:
+		$a1 = "wget" fullword
+		$a2 = "curl" wide ascii
+	condition:
+		elf_magic and any of ($a*)
+}
+
+rule none_of {
+	strings:
+		$x = "evil"
+	condition:
+		none of them
+}
+`)
+	require.NoError(t, err)
+
+	matches := rules.Scan([]byte("cd /tmp; /BIN/BUSYBOX mirai"))
+	require.Equal(t, []string{"mirai", "none_of"}, ruleNames(matches))
+	require.Equal(t, []string{"botnet", "iot"}, matches[0].Tags)
+	require.Equal(t, map[string]string{"author": "glutton", "score": "80"}, matches[0].Meta)
+	require.Equal(t, []string{"$busybox"}, matches[0].Strings)
+
+	matches = rules.Scan([]byte("tftp \xff-\x80\x81g; wget http://1.2.3.4/bins.arm"))
+	require.Equal(t, []string{"mirai", "none_of"}, ruleNames(matches))
+	require.Equal(t, []string{"$tftp", "$url"}, matches[0].Strings)
+
+	require.Equal(t, []string{"pe"}, ruleNames(rules.Scan([]byte("MZ\x90\x00evil"))))
+
+	require.Equal(t, []string{"elf_dropper", "none_of"}, ruleNames(rules.Scan([]byte("\x7fELF\x02 c\x00u\x00r\x00l\x00"))))
+	require.Equal(t, []string{"none_of"}, ruleNames(rules.Scan([]byte("\x7fELF\x02 wgetter"))))
+	require.Equal(t, []string{"none_of"}, ruleNames(rules.Scan([]byte("xx\x7fELF wget"))))
+}
+
+func TestScanOffsets(t *testing.T) {
+	rules, err := Compile(`
+global rule small { condition: filesize <= 64 }
+rule offsets {
+	strings:
+		$a = "ab"
+	condition:
+		#a == 2 and @a[2] == 130 and $a in (0..1) and uint8(1) + 1 == 0x63
+}
+`)
+	require.NoError(t, err)
+	// the bytes over 0x7f must not shift the offsets
+	data := append([]byte("ab"), make([]byte, 128)...)
+	for i := 2; i < 130; i++ {
+		data[i] = 0xff
+	}
+	data = append(data, "ab"...)
+	require.Empty(t, rules.Scan(data), "the global rule fails")
+
+	rules, err = Compile(`
+rule offsets {
+	strings:
+		$a = "ab"
+	condition:
+		#a == 2 and @a[2] == 130 and $a in (0..1) and uint8(1) + 1 == 0x63
+}
+`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"offsets"}, ruleNames(rules.Scan(data)))
+}
+
+func TestCompileErrors(t *testing.T) {
+	for src, msg := range map[string]string{
+		`import "pe"`:                                                "imports",
+		`rule a { condition: $x }`:                                   "undefined string $x",
+		`rule a { condition: b }`:                                    "unknown identifier b",
+		`rule a { strings: $x = "x" xor condition: $x }`:             "not supported",
+		`rule a { condition: true } rule a { condition: true }`:      "duplicate rule a",
+		`rule a { strings: $x = { 4D 5A [2000] 00 } condition: $x }`: "1000 bytes",
+		"rule a {\n condition:\n filesize >\n}":                      "line 4",
+	} {
+		_, err := Compile(src)
+		require.ErrorContains(t, err, msg, src)
+	}
+}
+
+func TestScannerReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.yar")
+	require.NoError(t, os.WriteFile(path, []byte(`rule one { strings: $a = "one" condition: $a }`), 0o600))
+	scanner, err := NewScanner(dir, time.Nanosecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"one"}, ruleNames(scanner.Scan([]byte("one"))))
+
+	// a broken update keeps the rules in use
+	require.NoError(t, os.WriteFile(path, []byte(`rule two {`), 0o600))
+	require.Equal(t, []string{"one"}, ruleNames(scanner.Scan([]byte("one"))))
+
+	require.NoError(t, os.WriteFile(path, []byte(`rule second { strings: $a = "second" condition: $a }`), 0o600))
+	require.Equal(t, []string{"second"}, ruleNames(scanner.Scan([]byte("second"))))
+}
@@ -0,0 +1,117 @@
+package yara
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoadDir compiles the *.yar and *.yara files below dir in lexical order
+func LoadDir(dir string) (*Rules, error) {
+	files, err := ruleFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := newCompiler()
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.add(file, string(src)); err != nil {
+			return nil, err
+		}
+	}
+	return c.rules(), nil
+}
+
+func ruleFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".yar" || ext == ".yara" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	slices.Sort(files)
+	return files, err
+}
+
+// version sums up the rule files of dir to tell when they changed
+func version(dir string) (string, error) {
+	files, err := ruleFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// Scanner holds the rules of a directory, which are compiled again once a
+// rule file changes, checking at most every refresh interval. A broken
+// update keeps the old rules in use.
+type Scanner struct {
+	dir     string
+	refresh time.Duration
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	rules   *Rules
+	version string
+	checked time.Time
+}
+
+func NewScanner(dir string, refresh time.Duration, logger *slog.Logger) (*Scanner, error) {
+	v, err := version(dir)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := LoadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Scanner{dir: dir, refresh: refresh, logger: logger, rules: rules, version: v, checked: time.Now()}, nil
+}
+
+// Rules returns the rules currently in use
+func (s *Scanner) Rules() *Rules {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refresh <= 0 || time.Since(s.checked) < s.refresh {
+		return s.rules
+	}
+	s.checked = time.Now()
+	v, err := version(s.dir)
+	if err != nil || v == s.version {
+		return s.rules
+	}
+	rules, err := LoadDir(s.dir)
+	if err != nil {
+		s.logger.Error("Failed to reload YARA rules", slog.String("dir", s.dir), slog.Any("error", err))
+		return s.rules
+	}
+	s.rules, s.version = rules, v
+	s.logger.Info("Reloaded YARA rules", slog.String("dir", s.dir), slog.Int("rules", len(rules.rules)))
+	return s.rules
+}
+
+// Scan matches data against the rules currently in use
+func (s *Scanner) Scan(data []byte) []Match {
+	return s.Rules().Scan(data)
+}